@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -257,3 +258,16 @@ func UnpackRevert(data []byte) (string, error) {
 	}
 	return reason, nil
 }
+
+// panicSelector is a special function selector for compiler generated panic
+// unpacking.
+var panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+// UnpackPanic resolves the panic code of an assertion failure raised by the
+// solidity compiler (e.g. 0x11 for arithmetic overflow).
+func UnpackPanic(data []byte) (*big.Int, error) {
+	if len(data) != 36 || !bytes.Equal(data[:4], panicSelector) {
+		return nil, errors.New("invalid data for unpacking")
+	}
+	return new(big.Int).SetBytes(data[4:]), nil
+}
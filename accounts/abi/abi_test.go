@@ -1146,3 +1146,29 @@ func TestUnpackRevert(t *testing.T) {
 		})
 	}
 }
+
+func TestUnpackPanic(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		input  string
+		expect int64 // -1 => error
+	}{
+		{"", -1},
+		{"4e487b71", -1},
+		{"08c379a00000000000000000000000000000000000000000000000000000000000000011", -1},
+		{"4e487b710000000000000000000000000000000000000000000000000000000000000011", 0x11},
+	}
+	for index, c := range cases {
+		got, err := UnpackPanic(common.Hex2Bytes(c.input))
+		if c.expect < 0 {
+			if err == nil {
+				t.Errorf("case %d: expected error, got %v", index, got)
+			}
+			continue
+		}
+		if err != nil || got.Int64() != c.expect {
+			t.Errorf("case %d: output mismatch, want %d, got %v (%v)", index, c.expect, got, err)
+		}
+	}
+}
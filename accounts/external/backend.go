@@ -19,6 +19,7 @@ package external
 import (
 	"fmt"
 	"math/big"
+	"reflect"
 	"sync"
 
 	"github.com/ethereum/go-ethereum"
@@ -30,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
 type ExternalBackend struct {
@@ -57,15 +59,20 @@ func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Sub
 	})
 }
 
+// ExternalBackendType is the reflect type of an external signer backend.
+var ExternalBackendType = reflect.TypeOf(&ExternalBackend{})
+
 // ExternalSigner provides an API to interact with an external signer (clef)
 // It proxies request to the external signer while forwarding relevant
 // request headers
 type ExternalSigner struct {
-	client   *rpc.Client
 	endpoint string
-	status   string
 	cacheMu  sync.RWMutex
 	cache    []accounts.Account
+
+	clientMu sync.Mutex
+	client   *rpc.Client // Nil if the connection to the signer was lost
+	status   string
 }
 
 func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
@@ -78,14 +85,69 @@ func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
 		endpoint: endpoint,
 	}
 	// Check if reachable
-	version, err := extsigner.pingVersion()
-	if err != nil {
+	if _, err := extsigner.pingVersion(); err != nil {
 		return nil, err
 	}
-	extsigner.status = fmt.Sprintf("ok [version=%v]", version)
 	return extsigner, nil
 }
 
+// Ping checks whether the external signer is reachable, reconnecting to it if
+// the connection was lost, and returns its version.
+func (api *ExternalSigner) Ping() (string, error) {
+	return api.pingVersion()
+}
+
+// call invokes the given method on the external signer. If the connection to
+// the signer is found to be broken, it is re-established and the call is retried
+// once. Errors returned by the signer itself (e.g. denied requests) are final.
+func (api *ExternalSigner) call(result interface{}, method string, args ...interface{}) error {
+	client, err := api.connect()
+	if err != nil {
+		return err
+	}
+	err = client.Call(result, method, args...)
+	if _, ok := err.(rpc.Error); err == nil || ok {
+		return err
+	}
+	log.Warn("Lost connection to external signer, reconnecting", "url", api.endpoint, "err", err)
+	api.disconnect(client, err)
+	if client, err = api.connect(); err != nil {
+		return err
+	}
+	return client.Call(result, method, args...)
+}
+
+// connect returns the current client of the external signer, dialling it if
+// there is none.
+func (api *ExternalSigner) connect() (*rpc.Client, error) {
+	api.clientMu.Lock()
+	defer api.clientMu.Unlock()
+
+	if api.client != nil {
+		return api.client, nil
+	}
+	client, err := rpc.Dial(api.endpoint)
+	if err != nil {
+		api.status = fmt.Sprintf("disconnected [%v]", err)
+		return nil, err
+	}
+	log.Info("Connected to external signer", "url", api.endpoint)
+	api.client = client
+	return client, nil
+}
+
+// disconnect drops the given broken client, unless it was replaced already.
+func (api *ExternalSigner) disconnect(client *rpc.Client, err error) {
+	api.clientMu.Lock()
+	defer api.clientMu.Unlock()
+
+	if api.client == client {
+		client.Close()
+		api.client = nil
+		api.status = fmt.Sprintf("disconnected [%v]", err)
+	}
+}
+
 func (api *ExternalSigner) URL() accounts.URL {
 	return accounts.URL{
 		Scheme: "extapi",
@@ -94,6 +156,9 @@ func (api *ExternalSigner) URL() accounts.URL {
 }
 
 func (api *ExternalSigner) Status() (string, error) {
+	api.clientMu.Lock()
+	defer api.clientMu.Unlock()
+
 	return api.status, nil
 }
 
@@ -160,7 +225,7 @@ func (api *ExternalSigner) signHash(account accounts.Account, hash []byte) ([]by
 func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
 	var res hexutil.Bytes
 	var signAddress = common.NewMixedcaseAddress(account.Address)
-	if err := api.client.Call(&res, "account_signData",
+	if err := api.call(&res, "account_signData",
 		mimeType,
 		&signAddress, // Need to use the pointer here, because of how MarshalJSON is defined
 		hexutil.Encode(data)); err != nil {
@@ -176,7 +241,7 @@ func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, d
 func (api *ExternalSigner) SignText(account accounts.Account, text []byte) ([]byte, error) {
 	var signature hexutil.Bytes
 	var signAddress = common.NewMixedcaseAddress(account.Address)
-	if err := api.client.Call(&signature, "account_signData",
+	if err := api.call(&signature, "account_signData",
 		accounts.MimetypeTextPlain,
 		&signAddress, // Need to use the pointer here, because of how MarshalJSON is defined
 		hexutil.Encode(text)); err != nil {
@@ -190,6 +255,22 @@ func (api *ExternalSigner) SignText(account accounts.Account, text []byte) ([]by
 	return signature, nil
 }
 
+// SignTypedData requests the signer to sign EIP-712 typed data. Unlike SignData,
+// the structured data is passed along as is, so that clef can display it.
+func (api *ExternalSigner) SignTypedData(account accounts.Account, typedData apitypes.TypedData) ([]byte, error) {
+	var signature hexutil.Bytes
+	var signAddress = common.NewMixedcaseAddress(account.Address)
+	if err := api.call(&signature, "account_signTypedData",
+		&signAddress, // Need to use the pointer here, because of how MarshalJSON is defined
+		typedData); err != nil {
+		return nil, err
+	}
+	if signature[64] == 27 || signature[64] == 28 {
+		signature[64] -= 27 // Transform V from Ethereum-legacy to 0/1
+	}
+	return signature, nil
+}
+
 // signTransactionResult represents the signinig result returned by clef.
 type signTransactionResult struct {
 	Raw hexutil.Bytes      `json:"raw"`
@@ -213,26 +294,43 @@ func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transactio
 		From:     common.NewMixedcaseAddress(account.Address),
 	}
 	var res signTransactionResult
-	if err := api.client.Call(&res, "account_signTransaction", args); err != nil {
+	if err := api.call(&res, "account_signTransaction", args); err != nil {
 		return nil, err
 	}
+	// Make sure the signer didn't sign for a different chain or account
+	if chainID != nil && res.Tx.Protected() && res.Tx.ChainId().Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("external signer used chain id %d, expected %d", res.Tx.ChainId(), chainID)
+	}
+	signer := types.Signer(types.HomesteadSigner{})
+	if res.Tx.Protected() {
+		signer = types.NewEIP155Signer(res.Tx.ChainId())
+	}
+	if from, err := types.Sender(signer, res.Tx); err != nil || from != account.Address {
+		return nil, fmt.Errorf("external signer returned transaction from unexpected sender %x", from)
+	}
 	return res.Tx, nil
 }
 
+// SignTextWithPassphrase delegates to SignText. The passphrase is ignored, since
+// approving the request is up to the rules and UI of the external signer, which
+// allows personal_sign to be served without unlocking keys inside the node.
 func (api *ExternalSigner) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
-	return []byte{}, fmt.Errorf("password-operations not supported on external signers")
+	return api.SignText(account, text)
 }
 
+// SignTxWithPassphrase delegates to SignTx, ignoring the passphrase.
 func (api *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
-	return nil, fmt.Errorf("password-operations not supported on external signers")
+	return api.SignTx(account, tx, chainID)
 }
+
+// SignDataWithPassphrase delegates to SignData, ignoring the passphrase.
 func (api *ExternalSigner) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
-	return nil, fmt.Errorf("password-operations not supported on external signers")
+	return api.SignData(account, mimeType, data)
 }
 
 func (api *ExternalSigner) listAccounts() ([]common.Address, error) {
 	var res []common.Address
-	if err := api.client.Call(&res, "account_list"); err != nil {
+	if err := api.call(&res, "account_list"); err != nil {
 		return nil, err
 	}
 	return res, nil
@@ -240,8 +338,11 @@ func (api *ExternalSigner) listAccounts() ([]common.Address, error) {
 
 func (api *ExternalSigner) pingVersion() (string, error) {
 	var v string
-	if err := api.client.Call(&v, "account_version"); err != nil {
+	if err := api.call(&v, "account_version"); err != nil {
 		return "", err
 	}
+	api.clientMu.Lock()
+	api.status = fmt.Sprintf("ok [version=%v]", v)
+	api.clientMu.Unlock()
 	return v, nil
 }
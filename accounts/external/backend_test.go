@@ -0,0 +1,91 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testSignerAPI is a minimal stand-in for the account API of clef.
+type testSignerAPI struct{}
+
+func (testSignerAPI) Version() string { return "6.0.0" }
+
+func (testSignerAPI) List() []common.Address {
+	return []common.Address{common.HexToAddress("0x1")}
+}
+
+// startTestSigner serves the test signer API over the given IPC path.
+func startTestSigner(t *testing.T, path string) *rpc.Server {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", testSignerAPI{}); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeListener(listener)
+	return server
+}
+
+func TestExternalSignerReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extsigner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "clef.ipc")
+	server := startTestSigner(t, path)
+
+	signer, err := NewExternalSigner(path)
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	if status, _ := signer.Status(); !strings.HasPrefix(status, "ok") {
+		t.Fatalf("status mismatch: have %q, want ok", status)
+	}
+	// Take the signer down and ensure it's reported as such
+	server.Stop()
+	os.Remove(path)
+
+	if _, err := signer.Ping(); err == nil {
+		t.Fatalf("ping succeeded on stopped signer")
+	}
+	if status, _ := signer.Status(); !strings.HasPrefix(status, "disconnected") {
+		t.Fatalf("status mismatch: have %q, want disconnected", status)
+	}
+	// Bring it back up and ensure the connection is re-established
+	server = startTestSigner(t, path)
+	defer server.Stop()
+
+	if version, err := signer.Ping(); err != nil || version != "6.0.0" {
+		t.Fatalf("ping mismatch after restart: have %q (%v), want 6.0.0", version, err)
+	}
+	if accs := signer.Accounts(); len(accs) != 1 || accs[0].Address != common.HexToAddress("0x1") {
+		t.Fatalf("accounts mismatch after restart: %v", accs)
+	}
+}
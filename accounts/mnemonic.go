@@ -0,0 +1,94 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+var errInvalidChildKey = errors.New("invalid derived child key")
+
+// MnemonicSeed converts a BIP-39 mnemonic sentence and optional passphrase into
+// the binary seed of a hierarchical deterministic wallet. The words are not
+// checked against any wordlist.
+//
+// The BIP-39 spec https://github.com/bitcoin/bips/blob/master/bip-0039.mediawiki
+// defines the seed as PBKDF2-HMAC-SHA512 of the NFKD normalized sentence, salted
+// with "mnemonic" and the passphrase.
+func MnemonicSeed(mnemonic string, passphrase string) []byte {
+	mnemonic = norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	return pbkdf2.Key([]byte(mnemonic), []byte(salt), 2048, 64, sha512.New)
+}
+
+// DeriveKey derives the private key at the given path of the hierarchical
+// deterministic wallet generated from seed, as defined by BIP-32.
+func DeriveKey(seed []byte, path DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	var (
+		order = crypto.S256().Params().N
+		key   = new(big.Int).SetBytes(sum[:32])
+		chain = sum[32:]
+	)
+	if key.Sign() == 0 || key.Cmp(order) >= 0 {
+		return nil, errInvalidChildKey
+	}
+	for _, index := range path {
+		// Hardened children commit to the private key, normal ones to the public
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, math.PaddedBigBytes(key, 32)...)
+		} else {
+			priv, err := crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&priv.PublicKey)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		mac := hmac.New(sha512.New, chain)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(order) >= 0 {
+			return nil, errInvalidChildKey
+		}
+		key.Add(key, tweak).Mod(key, order)
+		if key.Sign() == 0 {
+			return nil, errInvalidChildKey
+		}
+		chain = sum[32:]
+	}
+	return crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+}
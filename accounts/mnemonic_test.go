@@ -0,0 +1,58 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that keys derived from a mnemonic match the ones of other wallets.
+func TestMnemonicDerivation(t *testing.T) {
+	tests := []struct {
+		path    DerivationPath
+		address common.Address
+		key     string
+	}{
+		{
+			path:    DefaultBaseDerivationPath,
+			address: common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"),
+			key:     "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80",
+		},
+		{
+			path:    DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000 + 0, 0, 1},
+			address: common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"),
+			key:     "59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d",
+		},
+	}
+	seed := MnemonicSeed("test test test test test test test test test test test junk", "")
+	for i, tt := range tests {
+		key, err := DeriveKey(seed, tt.path)
+		if err != nil {
+			t.Fatalf("test %d: failed to derive key: %v", i, err)
+		}
+		if have := hex.EncodeToString(crypto.FromECDSA(key)); have != tt.key {
+			t.Errorf("test %d: key mismatch: have %s, want %s", i, have, tt.key)
+		}
+		if have := crypto.PubkeyToAddress(key.PublicKey); have != tt.address {
+			t.Errorf("test %d: address mismatch: have %x, want %x", i, have, tt.address)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/pborman/uuid"
+)
+
+// FileScheme is the protocol scheme prefixing the URLs of file vaults.
+const FileScheme = "vault"
+
+// fileVersion is the version of the vault file format.
+const fileVersion = 1
+
+// FileVaultType is the reflect type of a file vault backend.
+var FileVaultType = reflect.TypeOf(&FileVault{})
+
+var (
+	// ErrAccountExists is returned if an imported key is already held by the vault.
+	ErrAccountExists = errors.New("account already exists in vault")
+
+	// errVaultVersion is returned if the vault file was written by an unknown version.
+	errVaultVersion = errors.New("unsupported vault file version")
+)
+
+// vaultFile is the on-disk representation of a file vault. Each key is stored
+// as a standard encrypted keystore entry, all sharing the vault passphrase.
+type vaultFile struct {
+	Version int               `json:"version"`
+	Keys    []json.RawMessage `json:"keys"`
+}
+
+// FileVault is an account backend holding any number of keys in a single file,
+// encrypted with one passphrase. The vault exposes a single wallet, which needs
+// to be opened with the passphrase before its accounts can sign unattended.
+type FileVault struct {
+	path    string
+	scryptN int
+	scryptP int
+
+	lock   sync.Mutex // Serializes modifications of the vault file
+	file   vaultFile
+	wallet *keyWallet
+}
+
+// NewFileVault loads the vault stored at path, or creates an empty one there if
+// the file does not exist yet. New keys are encrypted with the given scrypt
+// parameters.
+func NewFileVault(path string, scryptN, scryptP int) (*FileVault, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	v := &FileVault{
+		path:    path,
+		scryptN: scryptN,
+		scryptP: scryptP,
+		file:    vaultFile{Version: fileVersion},
+	}
+	v.wallet = &keyWallet{
+		url:     accounts.URL{Scheme: FileScheme, Path: path},
+		decrypt: v.decrypt,
+	}
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return v, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &v.file); err != nil {
+		return nil, fmt.Errorf("invalid vault file: %v", err)
+	}
+	if v.file.Version != fileVersion {
+		return nil, fmt.Errorf("%w: %d", errVaultVersion, v.file.Version)
+	}
+	for i, raw := range v.file.Keys {
+		var entry struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(raw, &entry); err != nil || !common.IsHexAddress(entry.Address) {
+			return nil, fmt.Errorf("invalid vault entry %d", i)
+		}
+		v.wallet.accounts = append(v.wallet.accounts, accounts.Account{Address: common.HexToAddress(entry.Address), URL: v.wallet.url})
+	}
+	return v, nil
+}
+
+// Wallets implements accounts.Backend, returning the single wallet of the vault.
+func (v *FileVault) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{v.wallet}
+}
+
+// Subscribe implements accounts.Backend. The vault holds a single wallet which
+// never goes away, so no events are ever fired.
+func (v *FileVault) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// NewAccount generates a new key and stores it into the vault.
+func (v *FileVault) NewAccount(passphrase string) (accounts.Account, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	return v.ImportECDSA(key, passphrase)
+}
+
+// ImportECDSA stores the given key into the vault. If the vault already holds
+// keys, the passphrase must match the one they are encrypted with.
+func (v *FileVault) ImportECDSA(priv *ecdsa.PrivateKey, passphrase string) (accounts.Account, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	account := accounts.Account{Address: crypto.PubkeyToAddress(priv.PublicKey), URL: v.wallet.url}
+	if v.wallet.Contains(account) {
+		return account, ErrAccountExists
+	}
+	// Make sure the whole vault stays encrypted with a single passphrase
+	if len(v.file.Keys) > 0 {
+		if _, err := keystore.DecryptKey(v.file.Keys[0], passphrase); err != nil {
+			return accounts.Account{}, err
+		}
+	}
+	blob, err := keystore.EncryptKey(&keystore.Key{Id: uuid.NewRandom(), Address: account.Address, PrivateKey: priv}, passphrase, v.scryptN, v.scryptP)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	file := vaultFile{Version: fileVersion, Keys: append(append([]json.RawMessage{}, v.file.Keys...), blob)}
+	if err := writeVaultFile(v.path, &file); err != nil {
+		return accounts.Account{}, err
+	}
+	v.file = file
+
+	v.wallet.lock.Lock()
+	v.wallet.accounts = append(v.wallet.accounts, account)
+	if v.wallet.keys != nil {
+		v.wallet.keys[account.Address] = priv
+	}
+	v.wallet.lock.Unlock()
+
+	return account, nil
+}
+
+// decrypt loads all the private keys of the vault with the given passphrase.
+func (v *FileVault) decrypt(passphrase string) (map[common.Address]*ecdsa.PrivateKey, error) {
+	v.lock.Lock()
+	entries := v.file.Keys
+	v.lock.Unlock()
+
+	keys := make(map[common.Address]*ecdsa.PrivateKey, len(entries))
+	for _, raw := range entries {
+		key, err := keystore.DecryptKey(raw, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		keys[key.Address] = key.PrivateKey
+	}
+	return keys, nil
+}
+
+// writeVaultFile atomically replaces the vault file with the given contents.
+func writeVaultFile(path string, file *vaultFile) error {
+	blob, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// HashicorpScheme is the protocol scheme prefixing the URLs of HashiCorp Vault
+// backed wallets.
+const HashicorpScheme = "hashicorp"
+
+// HashicorpBackendType is the reflect type of a HashiCorp Vault backend.
+var HashicorpBackendType = reflect.TypeOf(&HashicorpBackend{})
+
+// hashicorpTimeout is the maximum time to wait for the Vault server to respond.
+const hashicorpTimeout = 10 * time.Second
+
+// HashicorpConfig describes where to load a signing key from a HashiCorp Vault
+// key-value secrets engine.
+type HashicorpConfig struct {
+	Address   string // Address of the Vault server (e.g. https://vault:8200)
+	Path      string // Path of the secret, including the mount (e.g. secret/data/geth/etherbase)
+	Field     string `toml:",omitempty"` // Field of the secret holding the hex private key (default "privateKey")
+	TokenFile string `toml:",omitempty"` // File holding the access token (default $VAULT_TOKEN)
+}
+
+// HashicorpBackend is an account backend sourcing a single signing key from a
+// HashiCorp Vault server. The key is fetched on startup and only ever held in
+// memory, so it never touches the local disk.
+type HashicorpBackend struct {
+	wallet *keyWallet
+}
+
+// NewHashicorpBackend fetches the configured secret from the Vault server and
+// creates a backend signing with the key it contains.
+func NewHashicorpBackend(config *HashicorpConfig) (*HashicorpBackend, error) {
+	if config.Address == "" || config.Path == "" {
+		return nil, errors.New("vault address and secret path required")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if config.TokenFile != "" {
+		blob, err := ioutil.ReadFile(config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token: %v", err)
+		}
+		token = strings.TrimSpace(string(blob))
+	}
+	field := config.Field
+	if field == "" {
+		field = "privateKey"
+	}
+	key, err := fetchHashicorpKey(strings.TrimRight(config.Address, "/")+"/v1/"+strings.TrimLeft(config.Path, "/"), token, field)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		url     = accounts.URL{Scheme: HashicorpScheme, Path: strings.TrimPrefix(strings.TrimPrefix(config.Address, "https://"), "http://") + "/" + strings.TrimLeft(config.Path, "/")}
+	)
+	return &HashicorpBackend{
+		wallet: &keyWallet{
+			url:      url,
+			persist:  true,
+			accounts: []accounts.Account{{Address: address, URL: url}},
+			keys:     map[common.Address]*ecdsa.PrivateKey{address: key},
+			decrypt: func(string) (map[common.Address]*ecdsa.PrivateKey, error) {
+				return map[common.Address]*ecdsa.PrivateKey{address: key}, nil
+			},
+		},
+	}, nil
+}
+
+// Wallets implements accounts.Backend, returning the single wallet of the backend.
+func (b *HashicorpBackend) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{b.wallet}
+}
+
+// Subscribe implements accounts.Backend. The backend holds a single wallet which
+// never goes away, so no events are ever fired.
+func (b *HashicorpBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// fetchHashicorpKey reads the secret at the given URL, and parses the private key
+// stored in the requested field. Both the v1 and v2 key-value engines are supported.
+func fetchHashicorpKey(url string, token string, field string) (*ecdsa.PrivateKey, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	client := &http.Client{Timeout: hashicorpTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault request failed: %s", res.Status)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %v", err)
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner // Versioned (v2) key-value engine
+		}
+	}
+	hexkey, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault secret has no %q field", field)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexkey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in vault secret: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	veryLightScryptN = 2
+	veryLightScryptP = 1
+)
+
+func TestFileVault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.vault")
+	v, err := NewFileVault(path, veryLightScryptN, veryLightScryptP)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	first, err := v.NewAccount("foo")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if _, err := v.NewAccount("bar"); err == nil {
+		t.Fatalf("account with mismatching passphrase imported")
+	}
+	second, err := v.NewAccount("foo")
+	if err != nil {
+		t.Fatalf("failed to create second account: %v", err)
+	}
+	// Reload the vault from disk and make sure both accounts are there, locked
+	v, err = NewFileVault(path, veryLightScryptN, veryLightScryptP)
+	if err != nil {
+		t.Fatalf("failed to reload vault: %v", err)
+	}
+	wallet := v.Wallets()[0]
+	if accs := wallet.Accounts(); len(accs) != 2 || accs[0].Address != first.Address || accs[1].Address != second.Address {
+		t.Fatalf("accounts mismatch: have %v, want [%x %x]", accs, first.Address, second.Address)
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	if _, err := wallet.SignTx(first, tx, big.NewInt(61)); err != ErrLocked {
+		t.Fatalf("locked signing error mismatch: have %v, want %v", err, ErrLocked)
+	}
+	if _, err := wallet.SignTxWithPassphrase(first, "bar", tx, big.NewInt(61)); err == nil {
+		t.Fatalf("signed with invalid passphrase")
+	}
+	if _, err := wallet.SignTxWithPassphrase(first, "foo", tx, big.NewInt(61)); err != nil {
+		t.Fatalf("failed to sign with passphrase: %v", err)
+	}
+	// Open the vault and sign unattended
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open vault: %v", err)
+	}
+	signed, err := wallet.SignTx(second, tx, big.NewInt(61))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, _ := types.Sender(types.NewEIP155Signer(big.NewInt(61)), signed); from != second.Address {
+		t.Fatalf("sender mismatch: have %x, want %x", from, second.Address)
+	}
+	wallet.Close()
+	if _, err := wallet.SignText(second, []byte("hello")); err != ErrLocked {
+		t.Fatalf("closed vault signing error mismatch: have %v, want %v", err, ErrLocked)
+	}
+}
+
+func TestHashicorpBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "secret-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/etherbase" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"data": {"privateKey": "0x%s"}, "metadata": {"version": 1}}}`, hex.EncodeToString(crypto.FromECDSA(key)))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHashicorpBackend(&HashicorpConfig{Address: server.URL, Path: "secret/data/missing", TokenFile: token}); err == nil {
+		t.Fatalf("missing secret loaded")
+	}
+	backend, err := NewHashicorpBackend(&HashicorpConfig{Address: server.URL, Path: "secret/data/etherbase", TokenFile: token})
+	if err != nil {
+		t.Fatalf("failed to load secret: %v", err)
+	}
+	wallet := backend.Wallets()[0]
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	if !wallet.Contains(account) {
+		t.Fatalf("wallet doesn't contain account %x", account.Address)
+	}
+	// Remote keys are always available, even after closing
+	wallet.Close()
+	sig, err := wallet.SignData(account, accounts.MimetypeClique, []byte("header"))
+	if err != nil {
+		t.Fatalf("failed to sign data: %v", err)
+	}
+	pub, err := crypto.SigToPub(crypto.Keccak256([]byte("header")), sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != account.Address {
+		t.Fatalf("signature mismatch: have %v (%v), want %x", pub, err, account.Address)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package vault implements account backends keeping keys outside of the plain
+// keystore directory: an encrypted single-file vault, and a HashiCorp Vault
+// backed signer.
+package vault
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrLocked is returned if a signing request is made against a vault which was
+// not opened yet.
+var ErrLocked = accounts.NewAuthNeededError("vault passphrase or open")
+
+// keyWallet is a wallet holding a fixed set of accounts, whose private keys are
+// held in memory while the wallet is open.
+type keyWallet struct {
+	url     accounts.URL
+	persist bool // Whether keys stay loaded when the wallet is closed
+
+	// decrypt loads all the private keys of the wallet using the passphrase.
+	decrypt func(passphrase string) (map[common.Address]*ecdsa.PrivateKey, error)
+
+	lock     sync.RWMutex
+	accounts []accounts.Account
+	keys     map[common.Address]*ecdsa.PrivateKey // Nil if the wallet is locked
+}
+
+// URL implements accounts.Wallet, returning the URL of the vault.
+func (w *keyWallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the keys are loaded.
+func (w *keyWallet) Status() (string, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.keys == nil {
+		return "Locked", nil
+	}
+	return "Unlocked", nil
+}
+
+// Open implements accounts.Wallet, decrypting all the keys of the vault.
+func (w *keyWallet) Open(passphrase string) error {
+	keys, err := w.decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.keys = keys
+	return nil
+}
+
+// Close implements accounts.Wallet, discarding all decrypted keys, unless they
+// are sourced remotely and cannot be reloaded.
+func (w *keyWallet) Close() error {
+	if w.persist {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, key := range w.keys {
+		zeroKey(key)
+	}
+	w.keys = nil
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the accounts of the vault.
+func (w *keyWallet) Accounts() []accounts.Account {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not held by this vault.
+func (w *keyWallet) Contains(account accounts.Account) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	for _, acc := range w.accounts {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == w.url) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is a noop for vaults since there is no
+// notion of hierarchical account derivation for plain keys.
+func (w *keyWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop for vaults since there is
+// no notion of hierarchical account derivation for plain keys.
+func (w *keyWallet) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {
+}
+
+// SignData implements accounts.Wallet, signing the keccak256 hash of the data.
+func (w *keyWallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, "", false, crypto.Keccak256(data))
+}
+
+// SignDataWithPassphrase implements accounts.Wallet, attempting to sign the given
+// data with the given account using passphrase as extra authentication.
+func (w *keyWallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, passphrase, true, crypto.Keccak256(data))
+}
+
+// SignText implements accounts.Wallet, signing the hash of the prefixed text.
+func (w *keyWallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.signHash(account, "", false, accounts.TextHash(text))
+}
+
+// SignTextWithPassphrase implements accounts.Wallet, attempting to sign the hash
+// of the given text with the given account using passphrase as extra authentication.
+func (w *keyWallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.signHash(account, passphrase, true, accounts.TextHash(text))
+}
+
+// SignTx implements accounts.Wallet, signing the transaction with the key of the
+// requested account.
+func (w *keyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, release, err := w.key(account, "", false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return signTx(tx, chainID, key)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, attempting to sign the given
+// transaction with the given account using passphrase as extra authentication.
+func (w *keyWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, release, err := w.key(account, passphrase, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return signTx(tx, chainID, key)
+}
+
+// signHash signs the hash with the key of the requested account.
+func (w *keyWallet) signHash(account accounts.Account, passphrase string, usePassphrase bool, hash []byte) ([]byte, error) {
+	key, release, err := w.key(account, passphrase, usePassphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return crypto.Sign(hash, key)
+}
+
+// key retrieves the private key of the requested account, along with a function
+// to call once done with it. If the wallet is locked and a passphrase is given,
+// the key is decrypted for the single operation only.
+func (w *keyWallet) key(account accounts.Account, passphrase string, usePassphrase bool) (*ecdsa.PrivateKey, func(), error) {
+	if !w.Contains(account) {
+		return nil, nil, accounts.ErrUnknownAccount
+	}
+	w.lock.RLock()
+	if w.keys != nil {
+		if key, ok := w.keys[account.Address]; ok {
+			return key, w.lock.RUnlock, nil
+		}
+	}
+	w.lock.RUnlock()
+
+	if !usePassphrase {
+		return nil, nil, ErrLocked
+	}
+	keys, err := w.decrypt(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := keys[account.Address]
+	if !ok {
+		return nil, nil, accounts.ErrUnknownAccount
+	}
+	return key, func() {
+		for _, key := range keys {
+			zeroKey(key)
+		}
+	}, nil
+}
+
+// signTx signs the transaction with EIP155 replay protection if a chain id is
+// given, or with the homestead rules otherwise.
+func signTx(tx *types.Transaction, chainID *big.Int, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	if chainID != nil {
+		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+	}
+	return types.SignTx(tx, types.HomesteadSigner{}, key)
+}
+
+// zeroKey zeroes a private key in memory.
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
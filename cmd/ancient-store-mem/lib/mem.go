@@ -19,9 +19,15 @@ package lib
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang/snappy"
 )
 
 const (
@@ -35,17 +41,101 @@ const (
 var (
 	errOutOfBounds = errors.New("out of bounds")
 	errOutOfOrder  = errors.New("out of order")
+
+	errCheckpointExists = errors.New("checkpoint already exists")
+	errChainMismatch    = errors.New("chain identity mismatch")
 )
 
+// ChainIdentity identifies the chain whose ancients a store holds. Namespace is
+// derived by the clients from the genesis hash and network id.
+type ChainIdentity struct {
+	Namespace string `json:"namespace"`
+	Genesis   string `json:"genesis"`
+	NetworkID uint64 `json:"networkId"`
+}
+
+// Checkpoint describes a consistent snapshot of the ancient tables, taken at a
+// given item count.
+type Checkpoint struct {
+	Name    string    `json:"name"`
+	Items   uint64    `json:"items"`
+	Created time.Time `json:"created"`
+}
+
+// memCheckpoint is a checkpoint along with the copy of the items it captured.
+type memCheckpoint struct {
+	info  Checkpoint
+	store map[string][]byte
+}
+
 // MemFreezerRemoteServerAPI is a mock freezer server implementation.
 type MemFreezerRemoteServerAPI struct {
-	store map[string][]byte
-	count uint64
-	mu    sync.Mutex
+	store       map[string][]byte
+	count       uint64
+	checkpoints map[string]*memCheckpoint
+	compressed  map[string]bool // Tables whose items are stored snappy-compressed
+	namespace   string          // Namespace the store is dedicated to, empty for any
+	identity    *ChainIdentity  // Chain the store was bound to by the first handshake
+	mu          sync.Mutex
 }
 
 func NewMemFreezerRemoteServerAPI() *MemFreezerRemoteServerAPI {
-	return &MemFreezerRemoteServerAPI{store: make(map[string][]byte)}
+	return NewNamespacedMemFreezerRemoteServerAPI("")
+}
+
+// NewNamespacedMemFreezerRemoteServerAPI creates a store only accepting clients
+// of the given namespace.
+func NewNamespacedMemFreezerRemoteServerAPI(namespace string) *MemFreezerRemoteServerAPI {
+	return &MemFreezerRemoteServerAPI{
+		store:       make(map[string][]byte),
+		checkpoints: make(map[string]*memCheckpoint),
+		compressed:  make(map[string]bool),
+		namespace:   namespace,
+	}
+}
+
+func (r *MemFreezerRemoteServerAPI) storeKind(key string) string {
+	return key[:strings.LastIndex(key, "-")]
+}
+
+// SetCompression configures the tables whose items are stored snappy-compressed,
+// converting the items stored so far, checkpoints included, in place.
+func (f *MemFreezerRemoteServerAPI) SetCompression(kinds []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	compressed := make(map[string]bool)
+	for _, kind := range kinds {
+		compressed[kind] = true
+	}
+	stores := []map[string][]byte{f.store}
+	for _, checkpoint := range f.checkpoints {
+		stores = append(stores, checkpoint.store)
+	}
+	for _, store := range stores {
+		for k, v := range store {
+			kind := f.storeKind(k)
+			switch {
+			case compressed[kind] && !f.compressed[kind]:
+				store[k] = snappy.Encode(nil, v)
+			case !compressed[kind] && f.compressed[kind]:
+				raw, err := snappy.Decode(nil, v)
+				if err != nil {
+					return err
+				}
+				store[k] = raw
+			}
+		}
+	}
+	f.compressed = compressed
+	return nil
+}
+
+// decode returns the stored item of the given kind as appended.
+func (f *MemFreezerRemoteServerAPI) decode(kind string, v []byte) ([]byte, error) {
+	if !f.compressed[kind] {
+		return v, nil
+	}
+	return snappy.Decode(nil, v)
 }
 
 func (r *MemFreezerRemoteServerAPI) storeKey(kind string, number uint64) string {
@@ -56,9 +146,28 @@ func (f *MemFreezerRemoteServerAPI) Reset() {
 	f.count = 0
 	f.mu.Lock()
 	f.store = make(map[string][]byte)
+	f.checkpoints = make(map[string]*memCheckpoint)
+	f.identity = nil
 	f.mu.Unlock()
 }
 
+// Handshake binds the store to the chain of the first client, and rejects the
+// clients of any other chain afterwards, as well as the ones not belonging to
+// the namespace the store is dedicated to.
+func (f *MemFreezerRemoteServerAPI) Handshake(identity ChainIdentity) (*ChainIdentity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.namespace != "" && identity.Namespace != f.namespace {
+		return nil, fmt.Errorf("%w: namespace %s, store serves %s", errChainMismatch, identity.Namespace, f.namespace)
+	}
+	if f.identity != nil && *f.identity != identity {
+		return nil, fmt.Errorf("%w: genesis %s on network %d, store holds genesis %s on network %d",
+			errChainMismatch, identity.Genesis, identity.NetworkID, f.identity.Genesis, f.identity.NetworkID)
+	}
+	f.identity = &identity
+	return f.identity, nil
+}
+
 func (f *MemFreezerRemoteServerAPI) HasAncient(kind string, number uint64) (bool, error) {
 	// fmt.Println("mock server called", "method=HasAncient")
 	f.mu.Lock()
@@ -75,7 +184,32 @@ func (f *MemFreezerRemoteServerAPI) Ancient(kind string, number uint64) ([]byte,
 	if !ok {
 		return nil, errOutOfBounds
 	}
-	return v, nil
+	return f.decode(kind, v)
+}
+
+func (f *MemFreezerRemoteServerAPI) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var (
+		res  [][]byte
+		size uint64
+	)
+	for i := uint64(0); i < count && size < maxBytes; i++ {
+		v, ok := f.store[f.storeKey(kind, start+i)]
+		if !ok {
+			break
+		}
+		v, err := f.decode(kind, v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+		size += uint64(len(v))
+	}
+	if len(res) == 0 {
+		return nil, errOutOfBounds
+	}
+	return res, nil
 }
 
 func (f *MemFreezerRemoteServerAPI) Ancients() (uint64, error) {
@@ -112,6 +246,9 @@ func (f *MemFreezerRemoteServerAPI) AppendAncient(number uint64, hash, header, b
 	defer f.mu.Unlock()
 	for i, fv := range fields {
 		kind := fieldNames[i]
+		if f.compressed[kind] {
+			fv = snappy.Encode(nil, fv)
+		}
 		f.store[f.storeKey(kind, number)] = fv
 	}
 	return nil
@@ -135,6 +272,64 @@ func (f *MemFreezerRemoteServerAPI) TruncateAncients(n uint64) error {
 	return nil
 }
 
+func (f *MemFreezerRemoteServerAPI) TruncateTail(kind string, n uint64) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n > f.count {
+		n = f.count
+	}
+	for i := uint64(0); i < n; i++ {
+		delete(f.store, f.storeKey(kind, i))
+	}
+	return n, nil
+}
+
+// CreateCheckpoint snapshots the first items of all the tables under the given
+// name. The items appended or truncated afterwards don't affect the checkpoint.
+func (f *MemFreezerRemoteServerAPI) CreateCheckpoint(name string, items uint64) (*Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.checkpoints[name]; ok {
+		return nil, errCheckpointExists
+	}
+	if items > f.count {
+		return nil, errOutOfBounds
+	}
+	checkpoint := &memCheckpoint{
+		info:  Checkpoint{Name: name, Items: items, Created: time.Now().UTC()},
+		store: make(map[string][]byte),
+	}
+	for k, v := range f.store {
+		num, err := strconv.ParseUint(k[len(f.storeKind(k))+1:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if num < items {
+			checkpoint.store[k] = v
+		}
+	}
+	f.checkpoints[name] = checkpoint
+	return &checkpoint.info, nil
+}
+
+// ListCheckpoints returns the checkpoints taken so far, oldest first.
+func (f *MemFreezerRemoteServerAPI) ListCheckpoints() ([]*Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]*Checkpoint, 0, len(f.checkpoints))
+	for _, checkpoint := range f.checkpoints {
+		info := checkpoint.info
+		list = append(list, &info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Created.Equal(list[j].Created) {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list, nil
+}
+
 func (f *MemFreezerRemoteServerAPI) Sync() error {
 	// fmt.Println("mock server called", "method=Sync")
 	return nil
@@ -144,3 +339,43 @@ func (f *MemFreezerRemoteServerAPI) Close() error {
 	// fmt.Println("mock server called", "method=Close")
 	return nil
 }
+
+// MemFreezerRemoteTenants serves a separate store per namespace over HTTP, each
+// at the path named after its namespace, e.g. http://localhost:8545/<namespace>.
+type MemFreezerRemoteTenants struct {
+	servers    map[string]*rpc.Server
+	compressed []string // Tables stored snappy-compressed by the stores
+	mu         sync.Mutex
+}
+
+// NewMemFreezerRemoteTenants creates the stores on demand, compressing the
+// given tables.
+func NewMemFreezerRemoteTenants(compressed []string) *MemFreezerRemoteTenants {
+	return &MemFreezerRemoteTenants{servers: make(map[string]*rpc.Server), compressed: compressed}
+}
+
+// ServeHTTP routes the request to the store of the namespace, creating it if
+// it's the first request of the namespace.
+func (t *MemFreezerRemoteTenants) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	namespace := strings.Trim(r.URL.Path, "/")
+	if namespace == "" || strings.Contains(namespace, "/") {
+		http.Error(w, "namespace required", http.StatusNotFound)
+		return
+	}
+	t.mu.Lock()
+	server, ok := t.servers[namespace]
+	if !ok {
+		store := NewNamespacedMemFreezerRemoteServerAPI(namespace)
+		store.SetCompression(t.compressed)
+
+		server = rpc.NewServer()
+		if err := server.RegisterName("freezer", store); err != nil {
+			t.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.servers[namespace] = server
+	}
+	t.mu.Unlock()
+	server.ServeHTTP(w, r)
+}
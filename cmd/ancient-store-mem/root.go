@@ -19,14 +19,21 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/spf13/cobra"
 )
 
+var (
+	httpAddr string // Address to serve a store per namespace on over HTTP, if any
+	compress string // Comma separated list of the tables to store snappy-compressed
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ancient-store-mem",
@@ -39,10 +46,21 @@ Ancient data is stored ephemerally.
 Expects first and only argument to an IPC path, or, the directory
 in which a default 'mock-freezer.ipc' path should be created.
 
+With --http, a separate store is served instead for each chain namespace over
+HTTP, at the path named after the namespace, and no IPC path is expected.
+
 Package 'lib' logic may be imported and used in testing contexts as well.
 `,
 
 	Run: func(cmd *cobra.Command, args []string) {
+		var compressed []string
+		if compress != "" {
+			compressed = strings.Split(compress, ",")
+		}
+		if httpAddr != "" {
+			log.Println("Serving namespaces on", httpAddr)
+			log.Fatalln(http.ListenAndServe(httpAddr, lib.NewMemFreezerRemoteTenants(compressed)))
+		}
 		ipcPath := args[0]
 		fi, err := os.Stat(ipcPath)
 		if err != nil && !os.IsNotExist(err) {
@@ -57,6 +75,7 @@ Package 'lib' logic may be imported and used in testing contexts as well.
 		}
 		defer os.Remove(ipcPath)
 		mock := lib.NewMemFreezerRemoteServerAPI()
+		mock.SetCompression(compressed)
 		err = server.RegisterName("freezer", mock)
 		if err != nil {
 			log.Fatalln(err)
@@ -70,6 +89,11 @@ Package 'lib' logic may be imported and used in testing contexts as well.
 	},
 }
 
+func init() {
+	rootCmd.Flags().StringVar(&httpAddr, "http", "", "Serve a store per chain namespace over HTTP on the given address")
+	rootCmd.Flags().StringVar(&compress, "compress", "", "Comma separated list of the tables to store snappy-compressed, e.g. headers,bodies,receipts")
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
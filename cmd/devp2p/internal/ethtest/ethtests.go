@@ -0,0 +1,220 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+var (
+	// Remote node under test
+	Remote string
+	// Genesis specification of the chain of the remote node
+	Genesis *genesisT.Genesis
+	// Network ID of the remote node
+	NetworkID uint64
+)
+
+var (
+	specOnce sync.Once
+	spec     *chain
+)
+
+// testenv is the environment of a test: the remote node under test, the
+// specification of its chain and its current head.
+type testenv struct {
+	remote *enode.Node
+	chain  *chain
+	status *statusData
+	head   *types.Header
+}
+
+func newTestEnv(t *utesting.T) *testenv {
+	remote, err := enode.Parse(enode.ValidSchemes, Remote)
+	if err != nil {
+		t.Fatalf("invalid remote node: %v", err)
+	}
+	specOnce.Do(func() {
+		spec = &chain{config: Genesis.Config, genesis: core.GenesisToBlock(Genesis, nil)}
+	})
+	status, head, err := remoteHead(remote, spec, NetworkID)
+	if err != nil {
+		t.Fatalf("failed to retrieve remote head: %v", err)
+	}
+	return &testenv{remote: remote, chain: spec, status: status, head: head}
+}
+
+// Status checks that the remote is on the expected chain, announcing the fork ID
+// derived from the chain configuration at its head.
+func Status(t *utesting.T) {
+	te := newTestEnv(t)
+
+	if te.status.ProtocolVersion != ethVersion {
+		t.Errorf("protocol version mismatch: have %d, want %d", te.status.ProtocolVersion, ethVersion)
+	}
+	if te.status.NetworkID != NetworkID {
+		t.Errorf("network ID mismatch: have %d, want %d", te.status.NetworkID, NetworkID)
+	}
+	if genesis := te.chain.Genesis().Hash(); te.status.Genesis != genesis {
+		t.Errorf("genesis mismatch: have %x, want %x", te.status.Genesis, genesis)
+	}
+	if want := forkid.NewID(te.chain.at(te.head)); te.status.ForkID != want {
+		t.Errorf("fork ID at #%d mismatch: have %x/%d, want %x/%d", te.head.Number, te.status.ForkID.Hash, te.status.ForkID.Next, want.Hash, want.Next)
+	}
+}
+
+// checksum calculates the fork hash of a genesis block and the passed forks.
+func checksum(genesis common.Hash, forks []uint64) [4]byte {
+	hash := crc32.ChecksumIEEE(genesis[:])
+	for _, fork := range forks {
+		var blob [8]byte
+		binary.BigEndian.PutUint64(blob[:], fork)
+		hash = crc32.Update(hash, crc32.IEEETable, blob[:])
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], hash)
+	return sum
+}
+
+// passedForks splits the forks of the chain into the ones passed at the given
+// head and the upcoming ones.
+func passedForks(te *testenv, head uint64) (passed []uint64, upcoming []uint64) {
+	for _, fork := range confp.Forks(te.chain.config) {
+		if fork <= head {
+			passed = append(passed, fork)
+		} else {
+			upcoming = append(upcoming, fork)
+		}
+	}
+	return passed, upcoming
+}
+
+// forkIDTest creates a test announcing a crafted fork ID to the remote, and
+// checks that the remote accepts or rejects it as the forkid filter would,
+// given the chain configuration and the head of the remote.
+func forkIDTest(name string, craft func(te *testenv) forkid.ID) utesting.Test {
+	return utesting.Test{Name: "ForkID/" + name, Fn: func(t *utesting.T) {
+		te := newTestEnv(t)
+
+		id := craft(te)
+		want := forkid.NewFilter(te.chain.at(te.head))(id) == nil
+
+		s, err := connect(te.remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.close()
+
+		if _, err := s.handshake(te.chain, NetworkID, id); err != nil {
+			t.Fatal(err)
+		}
+		have, err := s.accepted(te.chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != want {
+			t.Fatalf("fork ID %x/%d at remote head #%d: accepted %v, want %v", id.Hash, id.Next, te.head.Number, have, want)
+		}
+		t.Logf("fork ID %x/%d at remote head #%d: accepted %v", id.Hash, id.Next, te.head.Number, have)
+	}}
+}
+
+// AllTests are the tests of the eth protocol, to be run against a node of the
+// chain specified by Genesis.
+var AllTests = []utesting.Test{
+	{Name: "Status", Fn: Status},
+
+	// A node syncing from genesis, announcing the first fork as the next one
+	forkIDTest("Genesis", func(te *testenv) forkid.ID {
+		return forkid.NewID(te.chain.at(te.chain.Genesis().Header()))
+	}),
+	// A node in the same fork state as the remote
+	forkIDTest("Current", func(te *testenv) forkid.ID {
+		return forkid.NewID(te.chain.at(te.head))
+	}),
+	// A node ahead of the remote, having passed all the known forks
+	forkIDTest("Future", func(te *testenv) forkid.ID {
+		forks := confp.Forks(te.chain.config)
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), forks)}
+	}),
+	// A node in the fork state before the last fork passed by the remote (or at
+	// genesis), announcing a wrong block number for the following fork
+	forkIDTest("StaleWrongNext", func(te *testenv) forkid.ID {
+		passed, upcoming := passedForks(te, te.head.Number.Uint64())
+		if len(passed) == 0 {
+			next := uint64(1)
+			if len(upcoming) > 0 {
+				next = upcoming[0] + 1
+			}
+			return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), nil), Next: next}
+		}
+		last := len(passed) - 1
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), passed[:last]), Next: passed[last] + 1}
+	}),
+	// A node in the same fork state as the remote, announcing a fork already
+	// passed by the remote
+	forkIDTest("PassedNext", func(te *testenv) forkid.ID {
+		head := te.head.Number.Uint64()
+		passed, _ := passedForks(te, head)
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), passed), Next: head}
+	}),
+	// A node which forked at a block unknown to the remote
+	forkIDTest("UnknownFork", func(te *testenv) forkid.ID {
+		known := make(map[uint64]bool)
+		for _, fork := range confp.Forks(te.chain.config) {
+			known[fork] = true
+		}
+		fork := uint64(1)
+		for known[fork] {
+			fork++
+		}
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), []uint64{fork})}
+	}),
+	// A node on the same genesis following the fork history of Ethereum, which
+	// diverges from the one of Ethereum Classic at the DAO fork
+	forkIDTest("EthereumHistory", func(te *testenv) forkid.ID {
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), confp.Forks(params.MainnetChainConfig))}
+	}),
+	// A node on the same genesis following the fork history of Ethereum Classic
+	forkIDTest("ClassicHistory", func(te *testenv) forkid.ID {
+		return forkid.ID{Hash: checksum(te.chain.Genesis().Hash(), confp.Forks(params.ClassicChainConfig))}
+	}),
+}
+
+// DefaultNetworkID returns the network ID of a genesis specification, falling
+// back to the chain ID and eventually to the main network's.
+func DefaultNetworkID(genesis *genesisT.Genesis) uint64 {
+	if id := genesis.Config.GetNetworkID(); id != nil {
+		return *id
+	}
+	if id := genesis.Config.GetChainID(); id != nil {
+		return id.Uint64()
+	}
+	return 1
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+const (
+	ethVersion = 64 // Version of the eth protocol spoken by the tester
+	ethLength  = 17 // Number of message codes of the eth protocol version
+
+	statusMsg          = 0x00
+	getBlockHeadersMsg = 0x03
+	blockHeadersMsg    = 0x04
+
+	waitTime = 5 * time.Second
+)
+
+// errDisconnected is returned when the remote tears down the session.
+var errDisconnected = errors.New("disconnected by the remote node")
+
+// statusData is the eth/64 status message.
+type statusData struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+// getBlockHeadersData is a header query by the hash of the origin block.
+type getBlockHeadersData struct {
+	Origin  common.Hash
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+// chain is the chain specification of the remote node, implementing
+// forkid.Blockchain at an arbitrary head.
+type chain struct {
+	config  ctypes.ChainConfigurator
+	genesis *types.Block
+	head    *types.Header
+}
+
+func (c *chain) Config() ctypes.ChainConfigurator { return c.config }
+func (c *chain) Genesis() *types.Block            { return c.genesis }
+func (c *chain) CurrentHeader() *types.Header     { return c.head }
+
+// at returns the chain specification with the given head.
+func (c *chain) at(head *types.Header) *chain {
+	return &chain{config: c.config, genesis: c.genesis, head: head}
+}
+
+// session is an eth protocol connection to the remote node.
+type session struct {
+	srv     *p2p.Server
+	started int32 // Whether the protocol was started, ignoring redials
+	peer    *p2p.Peer
+	rw      p2p.MsgReadWriter
+	msgs    chan p2p.Msg // Messages received from the remote, with buffered payloads
+	errc    chan error   // Error the connection got torn down with
+	done    chan struct{}
+}
+
+// connect dials the remote node and waits for the eth protocol to start.
+func connect(remote *enode.Node) (*session, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	started := make(chan struct{})
+	s := &session{
+		msgs: make(chan p2p.Msg, 16),
+		errc: make(chan error, 1),
+		done: make(chan struct{}),
+	}
+	s.srv = &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		MaxPeers:    1,
+		NoDiscovery: true,
+		Name:        "devp2p-ethtest",
+		Protocols: []p2p.Protocol{{
+			Name:    "eth",
+			Version: ethVersion,
+			Length:  ethLength,
+			Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+				// Only run the first connection, not any redials of the static node
+				if !atomic.CompareAndSwapInt32(&s.started, 0, 1) {
+					return p2p.DiscUselessPeer
+				}
+				s.peer, s.rw = peer, rw
+				close(started)
+				return s.readLoop()
+			},
+		}},
+	}}
+	if err := s.srv.Start(); err != nil {
+		return nil, err
+	}
+	s.srv.AddPeer(remote)
+
+	select {
+	case <-started:
+		return s, nil
+	case <-time.After(waitTime):
+		s.srv.Stop()
+		return nil, errors.New("timed out connecting to the remote node")
+	}
+}
+
+// readLoop buffers the messages of the remote until the connection is torn
+// down or the session closed.
+func (s *session) readLoop() error {
+	for {
+		msg, err := s.rw.ReadMsg()
+		if err != nil {
+			s.fail(err)
+			return err
+		}
+		payload, err := ioutil.ReadAll(msg.Payload)
+		if err != nil {
+			s.fail(err)
+			return err
+		}
+		msg.Payload = bytes.NewReader(payload)
+		select {
+		case s.msgs <- msg:
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// fail records the error the session got torn down with.
+func (s *session) fail(err error) {
+	select {
+	case s.errc <- err:
+	default:
+	}
+}
+
+// close disconnects from the remote node.
+func (s *session) close() {
+	close(s.done)
+	s.srv.Stop()
+}
+
+// expect waits for a message with the given code from the remote, skipping any
+// other ones, and decodes it into the given value.
+func (s *session) expect(code uint64, val interface{}) error {
+	timeout := time.After(waitTime)
+	for {
+		select {
+		case msg := <-s.msgs:
+			if msg.Code != code {
+				continue
+			}
+			return msg.Decode(val)
+		case <-s.errc:
+			return errDisconnected
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for message %d", code)
+		}
+	}
+}
+
+// handshake exchanges the status messages with the remote, announcing the given
+// fork ID, and returns the status of the remote.
+func (s *session) handshake(chain *chain, networkID uint64, id forkid.ID) (*statusData, error) {
+	status := new(statusData)
+	if err := s.expect(statusMsg, status); err != nil {
+		return nil, fmt.Errorf("status: %v", err)
+	}
+	genesis := chain.Genesis()
+	err := p2p.Send(s.rw, statusMsg, &statusData{
+		ProtocolVersion: ethVersion,
+		NetworkID:       networkID,
+		TD:              genesis.Difficulty(),
+		Head:            genesis.Hash(),
+		Genesis:         genesis.Hash(),
+		ForkID:          id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// header retrieves a header by hash from the remote.
+func (s *session) header(hash common.Hash) (*types.Header, error) {
+	if err := p2p.Send(s.rw, getBlockHeadersMsg, &getBlockHeadersData{Origin: hash, Amount: 1}); err != nil {
+		return nil, err
+	}
+	var headers []*types.Header
+	if err := s.expect(blockHeadersMsg, &headers); err != nil {
+		return nil, err
+	}
+	if len(headers) != 1 || headers[0].Hash() != hash {
+		return nil, fmt.Errorf("header %x mismatch: have %d headers", hash, len(headers))
+	}
+	return headers[0], nil
+}
+
+// accepted reports whether the remote keeps serving a session after the
+// handshake, probing it with a genesis header query.
+func (s *session) accepted(chain *chain) (bool, error) {
+	switch _, err := s.header(chain.Genesis().Hash()); err {
+	case nil:
+		return true, nil
+	case errDisconnected:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// remoteHead connects to the remote with a fork ID compatible with any chain
+// sharing the genesis block, and returns the head header of the remote.
+func remoteHead(remote *enode.Node, chain *chain, networkID uint64) (*statusData, *types.Header, error) {
+	s, err := connect(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.close()
+
+	status, err := s.handshake(chain, networkID, forkid.NewID(chain.at(chain.Genesis().Header())))
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := s.header(status.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	return status, head, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/devp2p/internal/ethtest"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxCommand = cli.Command{
+		Name:  "rlpx",
+		Usage: "RLPx Commands",
+		Subcommands: []cli.Command{
+			rlpxEthTestCommand,
+		},
+	}
+	rlpxEthTestCommand = cli.Command{
+		Name:   "eth-test",
+		Usage:  "Runs eth protocol tests against a node",
+		Action: rlpxEthTest,
+		Flags:  []cli.Flag{remoteEnodeFlag, testPatternFlag, testChainFlag, testGenesisFlag, testNetworkIDFlag},
+	}
+)
+
+var (
+	testChainFlag = cli.StringFlag{
+		Name:  "chain",
+		Usage: "Chain of the node under test (" + strings.Join(testChainNames(), ", ") + ")",
+		Value: "classic",
+	}
+	testGenesisFlag = cli.StringFlag{
+		Name:  "genesis",
+		Usage: "Genesis JSON file of the chain of the node under test, instead of --chain",
+	}
+	testNetworkIDFlag = cli.Uint64Flag{
+		Name:  "networkid",
+		Usage: "Network ID of the node under test (defaults to the one of the chain)",
+	}
+)
+
+// testChains are the built-in chains the eth protocol tests can be run against.
+var testChains = map[string]func() *genesisT.Genesis{
+	"classic": params.DefaultClassicGenesisBlock,
+	"mordor":  params.DefaultMordorGenesisBlock,
+	"kotti":   params.DefaultKottiGenesisBlock,
+	"mainnet": params.DefaultGenesisBlock,
+	"ropsten": params.DefaultRopstenGenesisBlock,
+	"rinkeby": params.DefaultRinkebyGenesisBlock,
+	"goerli":  params.DefaultGoerliGenesisBlock,
+}
+
+func testChainNames() []string {
+	names := make([]string, 0, len(testChains))
+	for name := range testChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func rlpxEthTest(ctx *cli.Context) error {
+	// Configure test package globals.
+	if !ctx.IsSet(remoteEnodeFlag.Name) {
+		return fmt.Errorf("Missing -%v", remoteEnodeFlag.Name)
+	}
+	ethtest.Remote = ctx.String(remoteEnodeFlag.Name)
+
+	if ctx.IsSet(testGenesisFlag.Name) {
+		file, err := os.Open(ctx.String(testGenesisFlag.Name))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		genesis := new(genesisT.Genesis)
+		if err := json.NewDecoder(file).Decode(genesis); err != nil {
+			return fmt.Errorf("invalid genesis file: %v", err)
+		}
+		ethtest.Genesis = genesis
+	} else {
+		makeGenesis, ok := testChains[ctx.String(testChainFlag.Name)]
+		if !ok {
+			return fmt.Errorf("Unknown chain %q", ctx.String(testChainFlag.Name))
+		}
+		ethtest.Genesis = makeGenesis()
+	}
+	ethtest.NetworkID = ethtest.DefaultNetworkID(ethtest.Genesis)
+	if ctx.IsSet(testNetworkIDFlag.Name) {
+		ethtest.NetworkID = ctx.Uint64(testNetworkIDFlag.Name)
+	}
+
+	// Filter and run test cases.
+	tests := ethtest.AllTests
+	if ctx.IsSet(testPatternFlag.Name) {
+		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
+	}
+	results := utesting.RunTests(tests, os.Stdout)
+	if fails := utesting.CountFailures(results); fails > 0 {
+		return fmt.Errorf("%v/%v tests passed.", len(tests)-fails, len(tests))
+	}
+	fmt.Printf("%v/%v passed\n", len(tests), len(tests))
+	return nil
+}
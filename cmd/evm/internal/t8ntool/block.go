@@ -0,0 +1,251 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// header is the block header given to the block builder. The roots of the
+// transactions and ommers are derived from the block body if not given.
+type header struct {
+	ParentHash  common.Hash           `json:"parentHash"`
+	OmmerHash   *common.Hash          `json:"sha3Uncles"`
+	Coinbase    common.Address        `json:"miner"`
+	Root        common.Hash           `json:"stateRoot"`
+	TxHash      *common.Hash          `json:"transactionsRoot"`
+	ReceiptHash common.Hash           `json:"receiptsRoot"`
+	Bloom       types.Bloom           `json:"logsBloom"`
+	Difficulty  *math.HexOrDecimal256 `json:"difficulty"`
+	Number      *math.HexOrDecimal256 `json:"number"`
+	GasLimit    math.HexOrDecimal64   `json:"gasLimit"`
+	GasUsed     math.HexOrDecimal64   `json:"gasUsed"`
+	Time        math.HexOrDecimal64   `json:"timestamp"`
+	Extra       hexutil.Bytes         `json:"extraData"`
+	MixDigest   common.Hash           `json:"mixHash"`
+	Nonce       *types.BlockNonce     `json:"nonce"`
+}
+
+type blockInput struct {
+	Header *header            `json:"header,omitempty"`
+	Ommers []hexutil.Bytes    `json:"ommers,omitempty"`
+	Txs    types.Transactions `json:"txs,omitempty"`
+}
+
+// toBlock assembles the block from the header and body.
+func (i *blockInput) toBlock() (*types.Block, error) {
+	if i.Header == nil {
+		return nil, errors.New("header missing")
+	}
+	if i.Header.Number == nil {
+		return nil, errors.New("header number missing")
+	}
+	if i.Header.Difficulty == nil {
+		return nil, errors.New("header difficulty missing")
+	}
+	ommers := make([]*types.Header, len(i.Ommers))
+	for j, blob := range i.Ommers {
+		ommers[j] = new(types.Header)
+		if err := rlp.DecodeBytes(blob, ommers[j]); err != nil {
+			return nil, fmt.Errorf("invalid ommer %d: %v", j, err)
+		}
+	}
+	head := &types.Header{
+		ParentHash:  i.Header.ParentHash,
+		UncleHash:   types.CalcUncleHash(ommers),
+		Coinbase:    i.Header.Coinbase,
+		Root:        i.Header.Root,
+		TxHash:      types.DeriveSha(i.Txs, new(trie.Trie)),
+		ReceiptHash: i.Header.ReceiptHash,
+		Bloom:       i.Header.Bloom,
+		Difficulty:  (*big.Int)(i.Header.Difficulty),
+		Number:      (*big.Int)(i.Header.Number),
+		GasLimit:    uint64(i.Header.GasLimit),
+		GasUsed:     uint64(i.Header.GasUsed),
+		Time:        uint64(i.Header.Time),
+		Extra:       i.Header.Extra,
+		MixDigest:   i.Header.MixDigest,
+	}
+	if i.Header.OmmerHash != nil {
+		head.UncleHash = *i.Header.OmmerHash
+	}
+	if i.Header.TxHash != nil {
+		head.TxHash = *i.Header.TxHash
+	}
+	if i.Header.Nonce != nil {
+		head.Nonce = *i.Header.Nonce
+	}
+	return types.NewBlockWithHeader(head).WithBody(i.Txs, ommers), nil
+}
+
+// BuildBlock assembles a block from a header, transactions and ommers, sealing
+// it if requested.
+func BuildBlock(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	var (
+		headerStr = ctx.String(InputHeaderFlag.Name)
+		ommersStr = ctx.String(InputOmmersFlag.Name)
+		txsStr    = ctx.String(InputTxsFlag.Name)
+		inputData = &blockInput{}
+	)
+	if headerStr == stdinSelector || ommersStr == stdinSelector || txsStr == stdinSelector {
+		decoder := json.NewDecoder(os.Stdin)
+		if err := decoder.Decode(inputData); err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
+		}
+	}
+	if headerStr != stdinSelector {
+		if err := readJSONFile(headerStr, &inputData.Header); err != nil {
+			return err
+		}
+	}
+	if ommersStr != stdinSelector && ommersStr != "" {
+		if err := readJSONFile(ommersStr, &inputData.Ommers); err != nil {
+			return err
+		}
+	}
+	if txsStr != stdinSelector && txsStr != "" {
+		if err := readJSONFile(txsStr, &inputData.Txs); err != nil {
+			return err
+		}
+	}
+	block, err := inputData.toBlock()
+	if err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed assembling block: %v", err))
+	}
+	// Seal the block if requested
+	switch {
+	case ctx.Bool(SealEthashFlag.Name) && ctx.IsSet(SealCliqueFlag.Name):
+		return NewError(ErrorVMConfig, errors.New("ethash and clique sealing are exclusive"))
+	case ctx.Bool(SealEthashFlag.Name):
+		if block, err = sealEthash(ctx, block); err != nil {
+			return NewError(ErrorSealing, fmt.Errorf("failed sealing with ethash: %v", err))
+		}
+	case ctx.IsSet(SealCliqueFlag.Name):
+		if block, err = sealClique(ctx.String(SealCliqueFlag.Name), block); err != nil {
+			return NewError(ErrorSealing, fmt.Errorf("failed sealing with clique: %v", err))
+		}
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed encoding block: %v", err))
+	}
+	output := struct {
+		Rlp  hexutil.Bytes `json:"rlp"`
+		Hash common.Hash   `json:"hash"`
+	}{blob, block.Hash()}
+
+	switch dest := ctx.String(OutputBlockFlag.Name); dest {
+	case "stdout", "stderr":
+		b, err := json.MarshalIndent(output, "", " ")
+		if err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+		}
+		if dest == "stdout" {
+			os.Stdout.Write(b)
+		} else {
+			os.Stderr.Write(b)
+		}
+	default:
+		return saveFile(ctx.String(OutputBasedir.Name), dest, output)
+	}
+	return nil
+}
+
+// readJSONFile decodes the JSON content of a file.
+func readJSONFile(name string, dest interface{}) error {
+	inFile, err := os.Open(name)
+	if err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed reading %s: %v", name, err))
+	}
+	defer inFile.Close()
+	if err := json.NewDecoder(inFile).Decode(dest); err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed unmarshaling %s: %v", name, err))
+	}
+	return nil
+}
+
+// sealEthash mines a valid proof-of-work for the block.
+func sealEthash(ctx *cli.Context, block *types.Block) (*types.Block, error) {
+	if block.Header().Nonce != (types.BlockNonce{}) {
+		return nil, errors.New("sealing with ethash will overwrite provided nonce")
+	}
+	config := ethash.Config{
+		CacheDir:       ctx.String(SealEthashDirFlag.Name),
+		DatasetDir:     ctx.String(SealEthashDirFlag.Name),
+		CachesInMem:    2,
+		CachesOnDisk:   3,
+		DatasetsInMem:  1,
+		DatasetsOnDisk: 2,
+	}
+	switch mode := ctx.String(SealEthashModeFlag.Name); mode {
+	case "normal":
+		config.PowMode = ethash.ModeNormal
+	case "test":
+		config.PowMode = ethash.ModeTest
+	case "fake":
+		config.PowMode = ethash.ModeFake
+	default:
+		return nil, fmt.Errorf("unknown ethash mode %q", mode)
+	}
+	engine := ethash.New(config, nil, true)
+	defer engine.Close()
+
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(nil, block, results, nil); err != nil {
+		return nil, err
+	}
+	return <-results, nil
+}
+
+// sealClique signs the block with the clique signer key stored in a file.
+func sealClique(keyFile string, block *types.Block) (*types.Block, error) {
+	key, err := crypto.LoadECDSA(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	head := block.Header()
+	if len(head.Extra) < crypto.SignatureLength {
+		return nil, fmt.Errorf("extra-data too short for clique signature: %d < %d", len(head.Extra), crypto.SignatureLength)
+	}
+	sig, err := crypto.Sign(clique.SealHash(head).Bytes(), key)
+	if err != nil {
+		return nil, err
+	}
+	copy(head.Extra[len(head.Extra)-crypto.SignatureLength:], sig)
+	return block.WithSeal(head), nil
+}
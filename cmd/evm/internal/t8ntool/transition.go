@@ -40,8 +40,9 @@ const (
 	ErrorVMConfig         = 3
 	ErrorMissingBlockhash = 4
 
-	ErrorJson = 10
-	ErrorIO   = 11
+	ErrorJson    = 10
+	ErrorIO      = 11
+	ErrorSealing = 12
 
 	stdinSelector = "stdin"
 )
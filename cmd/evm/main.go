@@ -134,6 +134,14 @@ var (
 		Usage: "External EVM configuration (default = built-in interpreter)",
 		Value: "",
 	}
+	DiffEIPsFlag = cli.StringFlag{
+		Name:  "diff.eips",
+		Usage: "Comma separated EIPs to enable when re-running the code to compare the executions",
+	}
+	DiffEVMInterpreterFlag = cli.StringFlag{
+		Name:  "diff.vm.evm",
+		Usage: "External EVM configuration to re-run the code with to compare the executions",
+	}
 )
 
 var stateTransitionCommand = cli.Command{
@@ -159,6 +167,25 @@ var stateTransitionCommand = cli.Command{
 	},
 }
 
+var blockBuilderCommand = cli.Command{
+	Name:    "block-builder",
+	Aliases: []string{"b11r"},
+	Usage:   "builds a block",
+	Action:  t8ntool.BuildBlock,
+	Flags: []cli.Flag{
+		t8ntool.OutputBasedir,
+		t8ntool.OutputBlockFlag,
+		t8ntool.InputHeaderFlag,
+		t8ntool.InputOmmersFlag,
+		t8ntool.InputTxsFlag,
+		t8ntool.SealEthashFlag,
+		t8ntool.SealEthashDirFlag,
+		t8ntool.SealEthashModeFlag,
+		t8ntool.SealCliqueFlag,
+		t8ntool.VerbosityFlag,
+	},
+}
+
 func init() {
 	app.Flags = []cli.Flag{
 		BenchFlag,
@@ -185,6 +212,8 @@ func init() {
 		DisableStorageFlag,
 		DisableReturnDataFlag,
 		EVMInterpreterFlag,
+		DiffEIPsFlag,
+		DiffEVMInterpreterFlag,
 	}
 	app.Commands = []cli.Command{
 		compileCommand,
@@ -192,6 +221,7 @@ func init() {
 		runCommand,
 		stateTestCommand,
 		stateTransitionCommand,
+		blockBuilderCommand,
 	}
 	cli.CommandHelpTemplate = flags.OriginCommandHelpTemplate
 }
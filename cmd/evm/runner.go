@@ -19,12 +19,15 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
 	goruntime "runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -254,6 +257,9 @@ func runCmd(ctx *cli.Context) error {
 	}
 	input := common.FromHex(string(bytes.TrimSpace(hexInput)))
 
+	if ctx.GlobalIsSet(DiffEIPsFlag.Name) || ctx.GlobalIsSet(DiffEVMInterpreterFlag.Name) {
+		return runDiff(ctx, &runtimeConfig, code, input, receiver)
+	}
 	var execFunc func() ([]byte, uint64, error)
 	if ctx.GlobalBool(CreateFlag.Name) {
 		input = append(code, input...)
@@ -317,3 +323,62 @@ allocated bytes: %d
 
 	return nil
 }
+
+// runDiff executes the code twice, the second time with the EIPs or the external
+// EVM requested by the diff flags, and reports any divergence between the runs.
+func runDiff(ctx *cli.Context, cfg *runtime.Config, code, input []byte, receiver common.Address) error {
+	other := *cfg
+	other.EVMConfig.Tracer, other.EVMConfig.Debug = nil, false
+	other.EVMConfig.ExtraEips = append([]int{}, cfg.EVMConfig.ExtraEips...)
+
+	if eips := ctx.GlobalString(DiffEIPsFlag.Name); eips != "" {
+		for _, s := range strings.Split(eips, ",") {
+			eip, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || !vm.ValidEip(eip) {
+				return fmt.Errorf("invalid eip %q, available: %v", s, strings.Join(vm.ActivateableEips(), ", "))
+			}
+			other.EVMConfig.ExtraEips = append(other.EVMConfig.ExtraEips, eip)
+		}
+	}
+	if config := ctx.GlobalString(DiffEVMInterpreterFlag.Name); config != "" {
+		if cfg.EVMConfig.EVMInterpreter != "" {
+			return errors.New("only one external EVM can be loaded")
+		}
+		vm.InitEVMCEVM(config)
+		other.EVMConfig.EVMInterpreter = config
+	}
+	create := ctx.GlobalBool(CreateFlag.Name)
+	if len(code) > 0 && !create {
+		cfg.State.SetCode(receiver, code)
+	}
+	exec := func(cfg *runtime.Config) ([]byte, uint64, error) {
+		if create {
+			output, _, leftOverGas, err := runtime.Create(append(code, input...), cfg)
+			return output, leftOverGas, err
+		}
+		return runtime.Call(receiver, input, cfg)
+	}
+	res, _, div := runtime.Compare(exec, cfg, &other)
+
+	if ctx.GlobalBool(DumpFlag.Name) {
+		cfg.State.Commit(true)
+		cfg.State.IntermediateRoot(true)
+		fmt.Println(string(cfg.State.Dump(false, false, true)))
+	}
+	if ctx.GlobalBool(DebugFlag.Name) {
+		if logger, ok := cfg.EVMConfig.Tracer.(*vm.StructLogger); ok {
+			fmt.Fprintln(os.Stderr, "#### TRACE ####")
+			vm.WriteTrace(os.Stderr, logger.StructLogs())
+		}
+	}
+	if cfg.EVMConfig.Tracer == nil || ctx.GlobalBool(DebugFlag.Name) {
+		fmt.Printf("0x%x\n", res.Output)
+		if res.Err != nil {
+			fmt.Printf(" error: %v\n", res.Err)
+		}
+	}
+	if div != nil {
+		return fmt.Errorf("executions diverged, %v", div)
+	}
+	return nil
+}
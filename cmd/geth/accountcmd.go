@@ -22,7 +22,9 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/vault"
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"gopkg.in/urfave/cli.v1"
@@ -161,6 +163,7 @@ changing your password is only possible interactively.
 				Flags: []cli.Flag{
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
+					utils.KeyVaultFileFlag,
 					utils.PasswordFileFlag,
 					utils.LightKDFFlag,
 				},
@@ -173,7 +176,9 @@ Prints the address.
 
 The keyfile is assumed to contain an unencrypted private key in hexadecimal format.
 
-The account is saved in encrypted format, you are prompted for a password.
+The account is saved in encrypted format, you are prompted for a password. If
+--vault.file is given, the key is stored in that encrypted single-file vault
+instead of the keystore directory, and the password must match the vault's.
 
 You must remember this password to unlock your account in the future.
 
@@ -232,6 +237,34 @@ func unlockAccount(ks *keystore.KeyStore, address string, i int, passwords []str
 	return accounts.Account{}, ""
 }
 
+// openKeyVault tries opening the key vault holding the specified account a few
+// times, returning false if no vault contains it.
+func openKeyVault(vaults []accounts.Backend, address common.Address, i int, passwords []string) bool {
+	for _, backend := range vaults {
+		wallet := backend.Wallets()[0]
+		if !wallet.Contains(accounts.Account{Address: address}) {
+			continue
+		}
+		if status, _ := wallet.Status(); status == "Unlocked" {
+			return true
+		}
+		var err error
+		for trials := 0; trials < 3; trials++ {
+			prompt := fmt.Sprintf("Opening key vault %s for account %s | Attempt %d/%d", wallet.URL().Path, address.Hex(), trials+1, 3)
+			password := utils.GetPassPhraseWithList(prompt, false, i, passwords)
+			if err = wallet.Open(password); err == nil {
+				log.Info("Opened key vault", "url", wallet.URL(), "address", address.Hex())
+				return true
+			}
+			if err != keystore.ErrDecrypt {
+				break
+			}
+		}
+		utils.Fatalf("Failed to open key vault %s (%v)", wallet.URL().Path, err)
+	}
+	return false
+}
+
 func ambiguousAddrRecovery(ks *keystore.KeyStore, err *keystore.AmbiguousAddrError, auth string) accounts.Account {
 	fmt.Printf("Multiple key files exist for address %x:\n", err.Addr)
 	for _, a := range err.Matches {
@@ -344,8 +377,14 @@ func accountImport(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 	passphrase := utils.GetPassPhraseWithList("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
 
-	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
-	acct, err := ks.ImportECDSA(key, passphrase)
+	var acct accounts.Account
+	if vaults := stack.AccountManager().Backends(vault.FileVaultType); len(vaults) > 0 {
+		// Import into the key vault if one is configured, all keys share its passphrase
+		acct, err = vaults[0].(*vault.FileVault).ImportECDSA(key, passphrase)
+	} else {
+		ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+		acct, err = ks.ImportECDSA(key, passphrase)
+	}
 	if err != nil {
 		utils.Fatalf("Could not create the account: %v", err)
 	}
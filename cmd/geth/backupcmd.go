@@ -0,0 +1,198 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	backupBaseFlag = cli.StringFlag{
+		Name:  "backup.base",
+		Usage: "Previous backup to reuse unchanged ancient files from (incremental backup)",
+	}
+
+	backupCommand = cli.Command{
+		Name:      "backup",
+		Usage:     "Create, verify and restore chain database backups",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Description: `
+The backup commands operate on consistent snapshots of the chain database,
+comprising both the key-value store and the ancient store. A backup directory
+contains a copy of both along with a manifest recording checksums of all data,
+which is verified before any restoration.
+
+Backups of a running node can be taken with the admin_backup RPC method.`,
+		Subcommands: []cli.Command{
+			backupCreateCmd,
+			backupVerifyCmd,
+			backupRestoreCmd,
+			backupCheckpointsCmd,
+		},
+	}
+	backupCreateCmd = cli.Command{
+		Action:    utils.MigrateFlags(backupCreate),
+		Name:      "create",
+		Usage:     "Back up the chain database into a new directory",
+		ArgsUsage: "<backup dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			backupBaseFlag,
+		},
+		Description: `
+The create command writes a backup of the chain database of a stopped node into
+the given directory, which must not exist yet or be empty.
+
+With --backup.base, immutable ancient files which did not change since the given
+previous backup are hard-linked from it instead of being copied. If the ancient
+store is remote (--ancient.rpc), the remote store is asked to create a
+checkpoint of its tables at the number of frozen items, which is recorded in the
+backup. Remote stores not supporting checkpoints must be backed up separately.`,
+	}
+	backupVerifyCmd = cli.Command{
+		Action:    utils.MigrateFlags(backupVerify),
+		Name:      "verify",
+		Usage:     "Verify the integrity of a backup",
+		ArgsUsage: "<backup dir>",
+		Description: `
+The verify command checks all the data of a backup against the checksums in
+its manifest.`,
+	}
+	backupRestoreCmd = cli.Command{
+		Action:    utils.MigrateFlags(backupRestore),
+		Name:      "restore",
+		Usage:     "Restore a backup into the chain database",
+		ArgsUsage: "<backup dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The restore command verifies the given backup and restores it into the data
+directory, whose chain database must not exist yet. Once restored, the database
+is opened and checked for consistency against the backup's manifest.`,
+	}
+	backupCheckpointsCmd = cli.Command{
+		Action:    utils.MigrateFlags(backupCheckpoints),
+		Name:      "checkpoints",
+		Usage:     "List the checkpoints of the remote ancient store",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The checkpoints command lists the snapshots held by the remote ancient store
+(--ancient.rpc), such as the ones created along with backups.`,
+	}
+)
+
+func backupCreate(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a backup directory argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	manifest, err := rawdb.CreateBackup(db, ctx.Args().First(), ctx.String(backupBaseFlag.Name))
+	if err != nil {
+		utils.Fatalf("Backup failed: %v", err)
+	}
+	fmt.Printf("Backup created: head %x, %d key-value items, %d ancients\n", manifest.HeadHeader, manifest.KeyValueItems, manifest.Ancients)
+	return nil
+}
+
+func backupVerify(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a backup directory argument.")
+	}
+	manifest, err := rawdb.VerifyBackup(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Backup verification failed: %v", err)
+	}
+	fmt.Printf("Backup verified: head %x, %d key-value items, %d ancients\n", manifest.HeadHeader, manifest.KeyValueItems, manifest.Ancients)
+	return nil
+}
+
+func backupRestore(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a backup directory argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	name := "chaindata"
+	if ctx.GlobalString(utils.SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	// Resolve the ancient directory the same way the node does when opening it
+	chaindata := stack.ResolvePath(name)
+	ancient := ctx.GlobalString(utils.AncientFlag.Name)
+	switch {
+	case ancient == "":
+		ancient = filepath.Join(chaindata, "ancient")
+	case !filepath.IsAbs(ancient):
+		ancient = stack.ResolvePath(ancient)
+	}
+	manifest, err := rawdb.RestoreBackup(ctx.Args().First(), chaindata, ancient)
+	if err != nil {
+		utils.Fatalf("Restore failed: %v", err)
+	}
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	if err := rawdb.VerifyRestoredBackup(db, manifest); err != nil {
+		utils.Fatalf("Restored database inconsistent: %v", err)
+	}
+	fmt.Printf("Backup restored: head %x, %d ancients\n", manifest.HeadHeader, manifest.Ancients)
+	return nil
+}
+
+func backupCheckpoints(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	checkpoints, err := rawdb.ListAncientCheckpoints(db)
+	if err != nil {
+		utils.Fatalf("Failed to list checkpoints: %v", err)
+	}
+	for _, checkpoint := range checkpoints {
+		fmt.Printf("%s: %d ancients, created %v\n", checkpoint.Name, checkpoint.Items, checkpoint.Created)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/wit"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	replayBadBlockOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "File to write the execution trace into (default = stdout)",
+	}
+	replayBadBlockMemoryFlag = cli.BoolFlag{
+		Name:  "trace.memory",
+		Usage: "Include the EVM memory in the execution trace",
+	}
+	replayBadBlockNoStackFlag = cli.BoolFlag{
+		Name:  "trace.nostack",
+		Usage: "Omit the EVM stack from the execution trace",
+	}
+
+	replayBadBlockCommand = cli.Command{
+		Action:    utils.MigrateFlags(replayBadBlock),
+		Name:      "replay-bad-block",
+		Usage:     "Re-execute the block of a bad-block report in isolation with full tracing",
+		ArgsUsage: "<report>",
+		Flags: []cli.Flag{
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			replayBadBlockOutputFlag,
+			replayBadBlockMemoryFlag,
+			replayBadBlockNoStackFlag,
+		},
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+    geth replay-bad-block [--output <file>] <report>
+
+The replay-bad-block command loads a bad-block report written with
+debug.writeBadBlockReport, bundling a block with the witness of its parent state
+and the headers of its recent ancestors, and re-executes the block on top of it
+with the chain rules of the selected network, without touching any local chain
+data.
+
+Every opcode executed is traced as a JSON line, delimited by a line before and
+after each transaction and followed by a summary line of the block. The trace
+carries no timing information, so the traces of two replays, e.g. with different
+releases or the reports of different nodes, can be diffed to locate the first
+diverging step. The header fields contradicting the replay are reported at the
+end.`,
+	}
+)
+
+func replayBadBlock(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	report, err := wit.ReadBadBlockReport(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to read bad-block report: %v", err)
+	}
+	genesis := utils.MakeGenesis(ctx)
+	if genesis == nil {
+		genesis = params.DefaultGenesisBlock()
+	}
+	config := genesis.Config
+
+	var engine consensus.Engine
+	if config.GetConsensusEngineType().IsClique() {
+		engine = clique.New(&ctypes.CliqueConfig{
+			Period: config.GetCliquePeriod(),
+			Epoch:  config.GetCliqueEpoch(),
+		}, rawdb.NewMemoryDatabase())
+	} else {
+		engine = ethash.NewFaker()
+	}
+	var out io.Writer = os.Stdout
+	if path := ctx.String(replayBadBlockOutputFlag.Name); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			utils.Fatalf("Failed to create trace file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	block := report.Block
+	fmt.Fprintf(os.Stderr, "Block:     #%d [%x]\n", block.NumberU64(), block.Hash())
+	fmt.Fprintf(os.Stderr, "Witness:   %d trie nodes, %d codes, %d ancestors\n", len(report.Witness.Nodes), len(report.Witness.Codes), len(report.Ancestors))
+	if report.Client != "" {
+		fmt.Fprintf(os.Stderr, "Reporter:  %s\n", report.Client)
+	}
+	if report.Reason != "" {
+		fmt.Fprintf(os.Stderr, "Rejected:  %s\n", report.Reason)
+	}
+	logConfig := &vm.LogConfig{
+		DisableMemory: !ctx.Bool(replayBadBlockMemoryFlag.Name),
+		DisableStack:  ctx.Bool(replayBadBlockNoStackFlag.Name),
+	}
+	result, err := wit.Replay(config, engine, report, logConfig, out)
+	if err != nil {
+		utils.Fatalf("Failed to replay block: %v", err)
+	}
+	mismatches := result.Mismatches(block.Header())
+	if len(mismatches) == 0 {
+		fmt.Fprintf(os.Stderr, "Replay:    consistent with the header (%d transactions, %d gas)\n", len(result.Receipts), result.GasUsed)
+		return nil
+	}
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(os.Stderr, "Mismatch:  %s\n", mismatch)
+	}
+	return nil
+}
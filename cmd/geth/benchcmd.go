@@ -0,0 +1,372 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// benchDatabaseName is the name of the scratch database the benchmarks run on.
+const benchDatabaseName = "benchdata"
+
+var (
+	benchCountFlag = cli.IntFlag{
+		Name:  "bench.count",
+		Usage: "Number of items written and read by each workload",
+		Value: 100000,
+	}
+	benchValueSizeFlag = cli.IntFlag{
+		Name:  "bench.valuesize",
+		Usage: "Size in bytes of the values written (of the bodies and receipts of ancient items)",
+		Value: 256,
+	}
+	benchBatchFlag = cli.IntFlag{
+		Name:  "bench.batch",
+		Usage: "Number of items written per database batch",
+		Value: 1000,
+	}
+	benchSeedFlag = cli.Int64Flag{
+		Name:  "bench.seed",
+		Usage: "Seed of the pseudo-random keys and access patterns",
+		Value: 1,
+	}
+
+	benchCommand = cli.Command{
+		Name:      "bench",
+		Usage:     "Benchmark the storage backends",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Description: `
+The bench commands run standardized workloads against the storage backends
+configured for the chain, printing the throughput and latency percentiles of
+each of them, to validate storage choices before syncing. The workloads run on
+a scratch database next to the chain database, removed once done.`,
+		Subcommands: []cli.Command{
+			benchDBCommand,
+			benchAncientCommand,
+		},
+	}
+	benchDBCommand = cli.Command{
+		Action:    utils.MigrateFlags(benchDB),
+		Name:      "db",
+		Usage:     "Benchmark the key-value store",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			benchCountFlag,
+			benchValueSizeFlag,
+			benchBatchFlag,
+			benchSeedFlag,
+		},
+		Description: `
+The db command writes random keys in batches, then reads them back in random
+order, looks up missing keys and iterates over the whole store.`,
+	}
+	benchAncientCommand = cli.Command{
+		Action:    utils.MigrateFlags(benchAncient),
+		Name:      "ancient",
+		Usage:     "Benchmark the ancient store",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.AncientCompressFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			benchCountFlag,
+			benchValueSizeFlag,
+			benchSeedFlag,
+		},
+		Description: `
+The ancient command appends block-like items to the freezer, then reads them
+back in random and sequential order and finally truncates them all.
+
+A local freezer is created within the configured ancient directory. A remote
+freezer is used as is, so it must be empty: the benchmark refuses to run on a
+remote freezer already holding chain data.`,
+	}
+)
+
+// benchResult is the outcome of a benchmark workload.
+type benchResult struct {
+	name      string
+	ops       int
+	bytes     uint64
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+// newBenchResult creates the result of a workload of the given number of ops.
+func newBenchResult(name string, ops int) *benchResult {
+	return &benchResult{name: name, latencies: make([]time.Duration, 0, ops)}
+}
+
+// measure runs and times a single operation of the workload, accounting for the
+// given amount of data.
+func (r *benchResult) measure(size int, op func() error) error {
+	start := time.Now()
+	if err := op(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	r.ops++
+	r.bytes += uint64(size)
+	r.elapsed += elapsed
+	r.latencies = append(r.latencies, elapsed)
+	return nil
+}
+
+// percentile returns the latency of the given percentile of the operations.
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(float64(len(r.latencies)-1)*p)]
+}
+
+// printBenchResults prints the throughput and latency percentiles of the given
+// workloads as a table.
+func printBenchResults(out io.Writer, results []*benchResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Workload\tOps\tOps/s\tMB/s\tp50\tp90\tp99\tMax\t")
+	for _, r := range results {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+		var rate, mbs float64
+		if secs := r.elapsed.Seconds(); secs > 0 {
+			rate, mbs = float64(r.ops)/secs, float64(r.bytes)/secs/1024/1024
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%.2f\t%v\t%v\t%v\t%v\t\n", r.name, r.ops, rate, mbs,
+			r.percentile(0.5), r.percentile(0.9), r.percentile(0.99), r.percentile(1))
+	}
+	w.Flush()
+}
+
+// benchKeyValueStore runs the key-value workloads with the given number of
+// random keys of the given value size.
+func benchKeyValueStore(db ethdb.KeyValueStore, rng *rand.Rand, count, valueSize, batchSize int) ([]*benchResult, error) {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = make([]byte, common.HashLength)
+		rng.Read(keys[i])
+	}
+	value := make([]byte, valueSize)
+	rng.Read(value)
+
+	// Write the keys in batches
+	write := newBenchResult("batch-write", count/batchSize+1)
+	for i := 0; i < count; i += batchSize {
+		end := i + batchSize
+		if end > count {
+			end = count
+		}
+		batch := db.NewBatch()
+		for _, key := range keys[i:end] {
+			batch.Put(key, value)
+		}
+		if err := write.measure(batch.ValueSize(), batch.Write); err != nil {
+			return nil, err
+		}
+	}
+	// Read them back in random order
+	read := newBenchResult("read", count)
+	for _, i := range rng.Perm(count) {
+		err := read.measure(len(keys[i])+valueSize, func() error {
+			_, err := db.Get(keys[i])
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Look up keys not in the store
+	missing := newBenchResult("read-missing", count)
+	key := make([]byte, common.HashLength)
+	for i := 0; i < count; i++ {
+		rng.Read(key)
+		err := missing.measure(0, func() error {
+			_, err := db.Has(key)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Iterate over the whole store
+	iterate := newBenchResult("iterate", count)
+	it := db.NewIterator(nil, nil)
+	for {
+		var next bool
+		if err := iterate.measure(0, func() error { next = it.Next(); return nil }); err != nil {
+			return nil, err
+		}
+		if !next {
+			iterate.ops--
+			break
+		}
+		iterate.bytes += uint64(len(it.Key()) + len(it.Value()))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if iterate.ops != count {
+		return nil, fmt.Errorf("iterated over %d items, want %d", iterate.ops, count)
+	}
+	return []*benchResult{write, read, missing, iterate}, nil
+}
+
+// benchAncientStore runs the ancient store workloads with the given number of
+// block-like items, whose bodies and receipts are of the given size.
+func benchAncientStore(db ethdb.AncientStore, rng *rand.Rand, count, valueSize int) ([]*benchResult, error) {
+	var (
+		hash    = make([]byte, common.HashLength)
+		header  = make([]byte, 512)
+		body    = make([]byte, valueSize)
+		receipt = make([]byte, valueSize)
+		td      = make([]byte, 8)
+		size    = len(hash) + len(header) + len(body) + len(receipt) + len(td)
+	)
+	rng.Read(header)
+	rng.Read(body)
+	rng.Read(receipt)
+
+	// Append the items, syncing them to disk once done
+	appends := newBenchResult("append", count)
+	for i := 0; i < count; i++ {
+		rng.Read(hash)
+		err := appends.measure(size, func() error {
+			return db.AppendAncient(uint64(i), hash, header, body, receipt, td)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sync := newBenchResult("sync", 1)
+	if err := sync.measure(0, db.Sync); err != nil {
+		return nil, err
+	}
+	// Read the bodies back in random order, then sequentially
+	read := newBenchResult("read", count)
+	for _, i := range rng.Perm(count) {
+		var blob []byte
+		err := read.measure(valueSize, func() (err error) {
+			blob, err = db.Ancient("bodies", uint64(i))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(blob, body) {
+			return nil, fmt.Errorf("ancient body %d mismatch", i)
+		}
+	}
+	sequential := newBenchResult("read-seq", count)
+	for i := 0; i < count; i++ {
+		err := sequential.measure(valueSize, func() error {
+			_, err := db.Ancient("bodies", uint64(i))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	truncate := newBenchResult("truncate", 1)
+	if err := truncate.measure(0, func() error { return db.TruncateAncients(0) }); err != nil {
+		return nil, err
+	}
+	return []*benchResult{appends, sync, read, sequential, truncate}, nil
+}
+
+func benchDB(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	dir := stack.ResolveDatabasePath(benchDatabaseName)
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	db, err := utils.MakeBenchDatabase(ctx, stack, benchDatabaseName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rng := rand.New(rand.NewSource(ctx.Int64(benchSeedFlag.Name)))
+	results, err := benchKeyValueStore(db, rng, ctx.Int(benchCountFlag.Name), ctx.Int(benchValueSizeFlag.Name), ctx.Int(benchBatchFlag.Name))
+	if err != nil {
+		return fmt.Errorf("benchmark failed: %v", err)
+	}
+	printBenchResults(os.Stdout, results)
+	return nil
+}
+
+func benchAncient(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	dirs := []string{stack.ResolveDatabasePath(benchDatabaseName)}
+	if ctx.GlobalIsSet(utils.AncientFlag.Name) && !ctx.GlobalIsSet(utils.AncientRPCFlag.Name) {
+		// The local freezer is out of the database directory
+		ancient := filepath.Join(ctx.GlobalString(utils.AncientFlag.Name), benchDatabaseName)
+		if !filepath.IsAbs(ancient) {
+			ancient = stack.ResolvePath(ancient)
+		}
+		dirs = append(dirs, ancient)
+	}
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+	db, err := utils.MakeBenchDatabase(ctx, stack, benchDatabaseName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if frozen, err := db.Ancients(); err != nil {
+		return fmt.Errorf("failed to retrieve ancient items: %v", err)
+	} else if frozen > 0 {
+		return fmt.Errorf("ancient store not empty (%d items), refusing to overwrite it", frozen)
+	}
+	rng := rand.New(rand.NewSource(ctx.Int64(benchSeedFlag.Name)))
+	results, err := benchAncientStore(db, rng, ctx.Int(benchCountFlag.Name), ctx.Int(benchValueSizeFlag.Name))
+	if err != nil {
+		return fmt.Errorf("benchmark failed: %v", err)
+	}
+	printBenchResults(os.Stdout, results)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// Tests that the storage benchmark workloads run over all the generated items
+// and report them.
+func TestBenchWorkloads(t *testing.T) {
+	results, err := benchKeyValueStore(memorydb.New(), rand.New(rand.NewSource(1)), 1000, 64, 100)
+	if err != nil {
+		t.Fatalf("key-value benchmark failed: %v", err)
+	}
+	want := map[string]int{"batch-write": 10, "read": 1000, "read-missing": 1000, "iterate": 1000}
+	for _, r := range results {
+		if r.ops != want[r.name] {
+			t.Errorf("workload %s op count mismatch: have %d, want %d", r.name, r.ops, want[r.name])
+		}
+	}
+	dir, err := ioutil.TempDir("", "benchancient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewDatabaseWithFreezer(memorydb.New(), dir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	defer db.Close()
+
+	ancients, err := benchAncientStore(db, rand.New(rand.NewSource(1)), 500, 128)
+	if err != nil {
+		t.Fatalf("ancient benchmark failed: %v", err)
+	}
+	want = map[string]int{"append": 500, "sync": 1, "read": 500, "read-seq": 500, "truncate": 1}
+	for _, r := range ancients {
+		if r.ops != want[r.name] {
+			t.Errorf("workload %s op count mismatch: have %d, want %d", r.name, r.ops, want[r.name])
+		}
+	}
+	if frozen, _ := db.Ancients(); frozen != 0 {
+		t.Fatalf("ancient items left behind: %d", frozen)
+	}
+	out := new(bytes.Buffer)
+	printBenchResults(out, append(results, ancients...))
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 10 {
+		t.Fatalf("result table line count mismatch: have %d, want 10", len(lines))
+	}
+}
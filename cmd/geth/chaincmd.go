@@ -29,6 +29,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/console/prompt"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -45,6 +46,15 @@ import (
 )
 
 var (
+	initAllocFlag = cli.StringFlag{
+		Name:  "alloc",
+		Usage: "CSV (address,balance[,nonce[,code]]) or JSON Lines file of genesis accounts to stream in addition to the genesis alloc",
+	}
+	initVerifyAllocRootFlag = cli.StringFlag{
+		Name:  "verify-alloc-root",
+		Usage: "Expected state root of the genesis block, aborting without writing it on a mismatch",
+	}
+
 	initCommand = cli.Command{
 		Action:    utils.MigrateFlags(initGenesis),
 		Name:      "init",
@@ -52,6 +62,8 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			initAllocFlag,
+			initVerifyAllocRootFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -59,7 +71,18 @@ The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
 
-It expects the genesis file as argument.`,
+It expects the genesis file as argument.
+
+Allocations too large for the genesis file can be streamed from a separate file
+with --alloc, without loading them into memory. The accounts of the file are
+added to the ones of the genesis file, an account present in both is rejected.
+Files ending with .csv hold one account per line as address,balance[,nonce[,code]],
+any other file holds one JSON account per line, in the format of the genesis alloc
+section with an additional "address" field. Streaming requires an empty data
+directory.
+
+With --verify-alloc-root, the state root of the genesis block is checked against
+the given one, and the genesis block isn't written on a mismatch.`,
 	}
 	dumpGenesisCommand = cli.Command{
 		Action:    utils.MigrateFlags(dumpGenesis),
@@ -98,6 +121,13 @@ The dumpgenesis command dumps the genesis block configuration in JSON format to
 			utils.MetricsInfluxDBUsernameFlag,
 			utils.MetricsInfluxDBPasswordFlag,
 			utils.MetricsInfluxDBTagsFlag,
+			utils.MetricsEnableInfluxDBV2Flag,
+			utils.MetricsInfluxDBTokenFlag,
+			utils.MetricsInfluxDBBucketFlag,
+			utils.MetricsInfluxDBOrganizationFlag,
+			utils.MetricsPushGatewayFlag,
+			utils.MetricsPushGatewayJobFlag,
+			utils.MetricsPushGatewayLabelsFlag,
 			utils.TxLookupLimitFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -117,6 +147,9 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 			utils.DataDirFlag,
 			utils.CacheFlag,
 			utils.SyncModeFlag,
+			exportFormatFlag,
+			exportWorkersFlag,
+			exportTracerFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -124,7 +157,13 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
-be gzipped.`,
+be gzipped.
+
+With --format jsonl, the blocks are written as JSON Lines, one
+document per block holding the block with its transactions, their
+receipts and, if --tracer is set, their traces. Each document
+carries a "schema" version field. Blocks are extracted by
+--workers in parallel, tracing requires the historical state.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -255,6 +294,18 @@ func initGenesis(ctx *cli.Context) error {
 	if err != nil {
 		utils.Fatalf("invalid genesis file: %v", err)
 	}
+	var (
+		allocPath = ctx.String(initAllocFlag.Name)
+		root      *common.Hash
+	)
+	if ctx.IsSet(initVerifyAllocRootFlag.Name) {
+		blob, err := hexutil.Decode(ctx.String(initVerifyAllocRootFlag.Name))
+		if err != nil || len(blob) != common.HashLength {
+			utils.Fatalf("Invalid --%s: must be a 32 byte hex hash", initVerifyAllocRootFlag.Name)
+		}
+		root = new(common.Hash)
+		copy(root[:], blob)
+	}
 	// Open and initialise both full and light databases
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
@@ -264,9 +315,30 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
-		_, hash, err := core.SetupGenesisBlock(chaindb, genesis)
-		if err != nil {
-			utils.Fatalf("Failed to write genesis block: %v", err)
+		var hash common.Hash
+		if allocPath != "" {
+			if stored := rawdb.ReadCanonicalHash(chaindb, 0); stored != (common.Hash{}) {
+				utils.Fatalf("Database %s already contains genesis block %x, --%s requires an empty data directory", name, stored, initAllocFlag.Name)
+			}
+			alloc, err := core.OpenAllocFile(allocPath)
+			if err != nil {
+				utils.Fatalf("Failed to open alloc file: %v", err)
+			}
+			block, err := core.CommitGenesisStream(genesis, chaindb, alloc, root)
+			alloc.Close()
+			if err != nil {
+				utils.Fatalf("Failed to write genesis block: %v", err)
+			}
+			hash = block.Hash()
+		} else {
+			if root != nil {
+				if have := core.GenesisToBlock(genesis, nil).Root(); have != *root {
+					utils.Fatalf("Genesis state root mismatch: have %x, want %x", have, *root)
+				}
+			}
+			if _, hash, err = core.SetupGenesisBlock(chaindb, genesis); err != nil {
+				utils.Fatalf("Failed to write genesis block: %v", err)
+			}
 		}
 		chaindb.Close()
 		log.Info("Successfully wrote genesis state", "database", name, "hash", hash)
@@ -395,10 +467,20 @@ func exportChain(ctx *cli.Context) error {
 	chain, _ := utils.MakeChain(ctx, stack, true)
 	start := time.Now()
 
-	var err error
-	fp := ctx.Args().First()
+	var (
+		err    error
+		fp     = ctx.Args().First()
+		format = ctx.String(exportFormatFlag.Name)
+	)
+	if format != "rlp" && format != "jsonl" {
+		utils.Fatalf("Export error: unknown format %q\n", format)
+	}
 	if len(ctx.Args()) < 3 {
-		err = utils.ExportChain(chain, fp)
+		if format == "jsonl" {
+			err = exportJSONL(chain, fp, 0, chain.CurrentBlock().NumberU64(), ctx.Int(exportWorkersFlag.Name), ctx.String(exportTracerFlag.Name), false)
+		} else {
+			err = utils.ExportChain(chain, fp)
+		}
 	} else {
 		// This can be improved to allow for numbers larger than 9223372036854775807
 		first, ferr := strconv.ParseInt(ctx.Args().Get(1), 10, 64)
@@ -409,7 +491,14 @@ func exportChain(ctx *cli.Context) error {
 		if first < 0 || last < 0 {
 			utils.Fatalf("Export error: block number must be greater than 0\n")
 		}
-		err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+		if format == "jsonl" {
+			if head := chain.CurrentBlock().NumberU64(); first > last || uint64(last) > head {
+				utils.Fatalf("Export error: invalid block range %d-%d, head is %d\n", first, last, head)
+			}
+			err = exportJSONL(chain, fp, uint64(first), uint64(last), ctx.Int(exportWorkersFlag.Name), ctx.String(exportTracerFlag.Name), true)
+		} else {
+			err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+		}
 	}
 
 	if err != nil {
@@ -479,7 +568,7 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(0, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "")
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "", nil)
 	if err != nil {
 		return err
 	}
@@ -517,7 +606,7 @@ func removeDB(ctx *cli.Context) error {
 	stack, config := makeConfigNode(ctx)
 
 	// Remove the full node state database
-	path := stack.ResolvePath("chaindata")
+	path := stack.ResolveDatabasePath("chaindata")
 	if common.FileExist(path) {
 		confirmAndRemoveDB(path, "full node state database")
 	} else {
@@ -527,7 +616,7 @@ func removeDB(ctx *cli.Context) error {
 	path = config.Eth.DatabaseFreezer
 	switch {
 	case path == "":
-		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+		path = filepath.Join(stack.ResolveDatabasePath("chaindata"), "ancient")
 	case !filepath.IsAbs(path):
 		path = config.Node.ResolvePath(path)
 	}
@@ -537,7 +626,7 @@ func removeDB(ctx *cli.Context) error {
 		log.Info("Full node ancient database missing", "path", path)
 	}
 	// Remove the light node database
-	path = stack.ResolvePath("lightchaindata")
+	path = stack.ResolveDatabasePath("lightchaindata")
 	if common.FileExist(path) {
 		confirmAndRemoveDB(path, "light node database")
 	} else {
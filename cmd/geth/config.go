@@ -28,9 +28,13 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/firehose"
+	"github.com/ethereum/go-ethereum/follower"
+	"github.com/ethereum/go-ethereum/grpcapi"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 	"github.com/naoina/toml"
 )
@@ -78,6 +82,10 @@ type gethConfig struct {
 	Shh      whisper.Config
 	Node     node.Config
 	Ethstats ethstatsConfig
+	GRPC     grpcapi.Config
+	Firehose firehose.Config
+	Follower follower.Config
+	Plugins  plugins.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -99,6 +107,7 @@ func defaultNodeConfig() node.Config {
 	cfg := node.DefaultConfig
 	cfg.Name = databaseIdentifier
 	cfg.Version = params.VersionWithCommit(gitCommit, gitDate)
+	params.GitCommit, params.GitDate = gitCommit, gitDate
 	cfg.HTTPModules = append(cfg.HTTPModules, "eth")
 	cfg.WSModules = append(cfg.WSModules, "eth")
 	cfg.IPCPath = "geth.ipc"
@@ -109,9 +118,12 @@ func defaultNodeConfig() node.Config {
 func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 	// Load defaults.
 	cfg := gethConfig{
-		Eth:  eth.DefaultConfig,
-		Shh:  whisper.DefaultConfig,
-		Node: defaultNodeConfig(),
+		Eth:      eth.DefaultConfig,
+		Shh:      whisper.DefaultConfig,
+		Node:     defaultNodeConfig(),
+		GRPC:     grpcapi.DefaultConfig,
+		Firehose: firehose.DefaultConfig,
+		Follower: follower.DefaultConfig,
 	}
 
 	// Load config file.
@@ -132,6 +144,10 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		cfg.Ethstats.URL = ctx.GlobalString(utils.EthStatsURLFlag.Name)
 	}
 	utils.SetShhConfig(ctx, stack, &cfg.Shh)
+	utils.SetGRPCConfig(ctx, &cfg.GRPC)
+	utils.SetFirehoseConfig(ctx, &cfg.Firehose)
+	utils.SetFollowerConfig(ctx, &cfg.Follower)
+	utils.SetPluginsConfig(ctx, &cfg.Plugins)
 
 	return stack, cfg
 }
@@ -171,10 +187,28 @@ func makeFullNode(ctx *cli.Context) (*node.Node, ethapi.Backend) {
 	if ctx.GlobalIsSet(utils.GraphQLEnabledFlag.Name) {
 		utils.RegisterGraphQLService(stack, backend, cfg.Node)
 	}
+	// Serve the block explorer if requested
+	if ctx.GlobalIsSet(utils.ExplorerEnabledFlag.Name) {
+		utils.RegisterExplorerService(stack, backend, cfg.Node, cfg.Eth.TokenIndex)
+	}
+	// Configure the gRPC server if requested
+	if cfg.GRPC.Host != "" {
+		utils.RegisterGRPCService(stack, backend, cfg.GRPC)
+	}
 	// Add the Ethereum Stats daemon if requested.
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, backend, cfg.Ethstats.URL)
 	}
+	// Stream the chain events to a message broker if requested
+	if cfg.Firehose.URL != "" {
+		utils.RegisterFirehoseService(stack, backend, cfg.Firehose)
+	}
+	// Replicate the chain of a leader node instead of syncing it if requested
+	if cfg.Follower.Leader != "" {
+		utils.RegisterFollowerService(stack, backend, cfg.Follower)
+	}
+	// Initialize the plugins compiled in or loaded from the plugins directory
+	utils.RegisterPlugins(stack, backend, cfg.Plugins)
 	return stack, backend
 }
 
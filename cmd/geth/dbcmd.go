@@ -0,0 +1,642 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/wit"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbWorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "Number of sections to generate in parallel",
+		Value: runtime.NumCPU(),
+	}
+	dbWitnessesFlag = cli.StringFlag{
+		Name:  "witnesses",
+		Usage: "File of RLP encoded block witnesses to re-execute against, instead of historical state",
+	}
+	dbCheckOnlyFlag = cli.BoolFlag{
+		Name:  "checkonly",
+		Usage: "Only report the damaged receipts, without repairing them",
+	}
+	dbDryRunFlag = cli.BoolFlag{
+		Name:  "dryrun",
+		Usage: "Only report the changes of the migrations, without writing them",
+	}
+	dbSchemaVersionFlag = cli.Uint64Flag{
+		Name:  "version",
+		Usage: "Schema version to migrate to, rolling back newer migrations (default = latest)",
+	}
+
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Description: `
+The db commands operate directly on individual entries of the key-value store
+backing the chain database. They are meant for surgical recovery operations
+and must only be used against a stopped node; the database lock prevents them
+from running while another process has the datadir open.
+
+Keys may be given either as a hex string (0x-prefixed), or as one of the
+well-known key schema names followed by their arguments, e.g.
+
+    geth db get headHeader
+    geth db get txlookup 0x<hash>
+    geth db get header <number> 0x<hash>`,
+		Subcommands: []cli.Command{
+			dbGetCmd,
+			dbPutCmd,
+			dbDeleteCmd,
+			dbKeysCmd,
+			dbRebuildBloombitsCmd,
+			dbRepairReceiptsCmd,
+			dbIndexContractsCmd,
+			dbMigrateCmd,
+			dbRecompressCmd,
+		},
+	}
+	dbGetCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbGet),
+		Name:      "get",
+		Usage:     "Show the value of a database key",
+		ArgsUsage: "<key> | <key name> [<args>...]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The get command opens the database in read-only mode and prints the hex
+encoded value stored under the given key.`,
+	}
+	dbPutCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbPut),
+		Name:      "put",
+		Usage:     "Set the value of a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<key> | <key name> [<args>...] <hex-encoded value>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The put command writes the hex encoded value given as the last argument under
+the given key, printing the previous value (if any) beforehand.`,
+	}
+	dbDeleteCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbDelete),
+		Name:      "delete",
+		Usage:     "Delete a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<key> | <key name> [<args>...]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The delete command removes the given key from the database, printing the
+deleted value (if any) beforehand.`,
+	}
+	dbKeysCmd = cli.Command{
+		Action: utils.MigrateFlags(dbKeys),
+		Name:   "keys",
+		Usage:  "List the well-known key names accepted by the db commands",
+		Description: `
+The keys command lists the well-known key schema names, and the arguments they
+expect, which can be used in place of raw hex keys.`,
+	}
+	dbRebuildBloombitsCmd = cli.Command{
+		Action: utils.MigrateFlags(dbRebuildBloombits),
+		Name:   "rebuild-bloombits",
+		Usage:  "Regenerate the bloombits index used for log filtering",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.SyncModeFlag,
+			dbWorkersFlag,
+		},
+		Description: `
+The rebuild-bloombits command discards the bloombits index of the chain database
+and regenerates it from the receipts of the canonical blocks, including the ones
+in the (local or remote) ancient store. It's meant to recover from a corrupted
+index without resyncing; an interrupted rebuild leaves the index empty, to be
+regenerated by the node on its next start.`,
+	}
+	dbRepairReceiptsCmd = cli.Command{
+		Action: utils.MigrateFlags(dbRepairReceipts),
+		Name:   "repair-receipts",
+		Usage:  "Regenerate missing or corrupted receipts by re-executing their blocks",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			reexecFromFlag,
+			reexecToFlag,
+			reexecReexecFlag,
+			dbWitnessesFlag,
+			dbCheckOnlyFlag,
+		},
+		Description: `
+    geth db repair-receipts --from N --to M
+
+The repair-receipts command checks the stored receipts of the given range of
+canonical blocks (the whole chain by default) against the receipt roots of their
+headers. The blocks with missing or mismatching receipts are re-executed against
+the historical state of their parents, regenerated from up to --reexec preceding
+blocks if needed, or against their witness if found in the --witnesses file.
+
+Repaired receipts of blocks in the (local or remote) ancient store require moving
+the ancients from the first repaired block onwards back into the key-value store,
+from where the node freezes them again once restarted.`,
+	}
+	dbIndexContractsCmd = cli.Command{
+		Action: utils.MigrateFlags(dbIndexContracts),
+		Name:   "index-contracts",
+		Usage:  "Backfill the contract index by re-executing a range of blocks",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			reexecFromFlag,
+			reexecToFlag,
+			reexecReexecFlag,
+		},
+		Description: `
+    geth db index-contracts --from N --to M
+
+The index-contracts command re-executes the given range of canonical blocks (the
+whole chain by default) and stores the contracts they deployed into the contract
+index maintained with --contractindex, for the blocks imported without it. The
+historical state of the block preceding the range is regenerated from up to
+--reexec preceding blocks if needed.`,
+	}
+	dbMigrateCmd = cli.Command{
+		Action: utils.MigrateFlags(dbMigrate),
+		Name:   "migrate",
+		Usage:  "Migrate the key schema of the database",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.SyncModeFlag,
+			dbDryRunFlag,
+			dbSchemaVersionFlag,
+		},
+		Description: `
+    geth db migrate [--dryrun] [--version N]
+
+The migrate command upgrades the key schema of the database to the latest
+version known to this release, or to the given version, rolling back the newer
+migrations if the database is ahead of it. Pending upgrades also run when the
+node starts. With --dryrun, the migrations only report how many keys they'd
+write and delete.`,
+	}
+	dbRecompressCmd = cli.Command{
+		Action: utils.MigrateFlags(dbRecompress),
+		Name:   "recompress",
+		Usage:  "Convert the ancient tables to the configured compression",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DatabaseDirFlag,
+			utils.AncientFlag,
+			utils.AncientCompressFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+    geth db recompress [--datadir.ancient.compress <tables>]
+
+The recompress command rewrites the tables of the local ancient store whose
+compression differs from the given settings (or the defaults), in place. Each
+table is written next to the original one before replacing it, so an interrupted
+conversion is either discarded or completed the next time the ancient store is
+opened.`,
+	}
+)
+
+// parseDatabaseKey interprets the given arguments either as a single hex encoded
+// raw key, or as a well-known key name followed by its arguments.
+func parseDatabaseKey(args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing key")
+	}
+	if strings.HasPrefix(args[0], "0x") {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("raw hex keys take no further arguments")
+		}
+		return hexutil.Decode(args[0])
+	}
+	return rawdb.WellKnownKey(args[0], args[1:]...)
+}
+
+func dbGet(ctx *cli.Context) error {
+	key, err := parseDatabaseKey(ctx.Args())
+	if err != nil {
+		utils.Fatalf("Invalid key: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueStore(ctx, stack, true)
+	defer db.Close()
+
+	data, err := db.Get(key)
+	if err != nil {
+		log.Info("Get operation failed", "key", fmt.Sprintf("%#x", key), "error", err)
+		return err
+	}
+	fmt.Printf("key %#x: %#x\n", key, data)
+	return nil
+}
+
+func dbPut(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) < 2 {
+		utils.Fatalf("This command requires a key and a value argument.")
+	}
+	key, err := parseDatabaseKey(args[:len(args)-1])
+	if err != nil {
+		utils.Fatalf("Invalid key: %v", err)
+	}
+	value, err := hexutil.Decode(args[len(args)-1])
+	if err != nil {
+		utils.Fatalf("Invalid value, expected 0x-prefixed hex: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueStore(ctx, stack, false)
+	defer db.Close()
+
+	if data, err := db.Get(key); err == nil {
+		fmt.Printf("Previous value: %#x\n", data)
+	}
+	if err := db.Put(key, value); err != nil {
+		log.Info("Put operation failed", "key", fmt.Sprintf("%#x", key), "error", err)
+		return err
+	}
+	log.Info("Database key updated", "key", fmt.Sprintf("%#x", key), "size", len(value))
+	return nil
+}
+
+func dbDelete(ctx *cli.Context) error {
+	key, err := parseDatabaseKey(ctx.Args())
+	if err != nil {
+		utils.Fatalf("Invalid key: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainKeyValueStore(ctx, stack, false)
+	defer db.Close()
+
+	if data, err := db.Get(key); err == nil {
+		fmt.Printf("Previous value: %#x\n", data)
+	}
+	if err := db.Delete(key); err != nil {
+		log.Info("Delete operation failed", "key", fmt.Sprintf("%#x", key), "error", err)
+		return err
+	}
+	log.Info("Database key deleted", "key", fmt.Sprintf("%#x", key))
+	return nil
+}
+
+func dbKeys(ctx *cli.Context) error {
+	for _, name := range rawdb.WellKnownKeyNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func dbRebuildBloombits(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var (
+		start  = time.Now()
+		logged int64
+	)
+	atomic.StoreInt64(&logged, start.UnixNano())
+
+	sections, err := eth.RebuildBloomBits(db, vars.BloomBitsBlocks, vars.BloomConfirms, ctx.Int(dbWorkersFlag.Name), func(done, total uint64) {
+		last := atomic.LoadInt64(&logged)
+		if done < total && time.Since(time.Unix(0, last)) < 8*time.Second {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&logged, last, time.Now().UnixNano()) || done == total {
+			log.Info("Regenerating bloombits index", "sections", done, "total", total, "elapsed", common.PrettyDuration(time.Since(start)))
+		}
+	})
+	if err != nil {
+		utils.Fatalf("Failed to rebuild bloombits index: %v", err)
+	}
+	log.Info("Rebuilt bloombits index", "sections", sections, "blocks", sections*vars.BloomBitsBlocks, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func dbRepairReceipts(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+	defer chain.Stop()
+
+	witnesses := make(map[common.Hash]*wit.Witness)
+	if path := ctx.String(dbWitnessesFlag.Name); path != "" {
+		var err error
+		if witnesses, err = loadWitnesses(path); err != nil {
+			utils.Fatalf("Failed to load witnesses: %v", err)
+		}
+	}
+	from, to := ctx.Uint64(reexecFromFlag.Name), chain.CurrentBlock().NumberU64()
+	if ctx.IsSet(reexecToFlag.Name) {
+		to = ctx.Uint64(reexecToFlag.Name)
+	}
+	if to < from {
+		utils.Fatalf("Invalid block range: --%s (%d) is below --%s (%d)", reexecToFlag.Name, to, reexecFromFlag.Name, from)
+	}
+	var (
+		database = state.NewDatabaseWithCache(db, 16, "")
+		start    = time.Now()
+		logged   = time.Now()
+		damaged  int
+	)
+	for number := from; number <= to; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			utils.Fatalf("Block #%d not found", number)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Checking receipts", "number", number, "target", to, "damaged", damaged, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		err := core.CheckReceipts(db, block.Header())
+		if err == nil {
+			continue
+		}
+		log.Warn("Damaged receipts found", "number", number, "hash", block.Hash(), "err", err)
+		damaged++
+		if ctx.Bool(dbCheckOnlyFlag.Name) {
+			continue
+		}
+		var statedb *state.StateDB
+		if witness, ok := witnesses[block.Hash()]; ok {
+			statedb, err = witness.State()
+		} else if parent := chain.GetBlock(block.ParentHash(), number-1); parent != nil {
+			statedb, err = regenerateState(chain, database, parent, ctx.Uint64(reexecReexecFlag.Name))
+		} else {
+			err = fmt.Errorf("parent block #%d not found", number-1)
+		}
+		if err != nil {
+			utils.Fatalf("Failed to retrieve parent state of block #%d: %v", number, err)
+		}
+		receipts, err := core.RegenerateReceipts(chain, block, statedb)
+		if err != nil {
+			utils.Fatalf("Failed to regenerate receipts of block #%d: %v", number, err)
+		}
+		if err := rawdb.WriteRepairedReceipts(db, block.Hash(), number, receipts); err != nil {
+			utils.Fatalf("Failed to write receipts of block #%d: %v", number, err)
+		}
+		log.Info("Repaired receipts", "number", number, "hash", block.Hash(), "receipts", len(receipts))
+	}
+	if damaged > 0 && ctx.Bool(dbCheckOnlyFlag.Name) {
+		utils.Fatalf("Found %d blocks with damaged receipts", damaged)
+	}
+	log.Info("Receipts checked", "blocks", to-from+1, "repaired", damaged, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func dbIndexContracts(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+	defer chain.Stop()
+
+	from, to := ctx.Uint64(reexecFromFlag.Name), chain.CurrentBlock().NumberU64()
+	if ctx.IsSet(reexecToFlag.Name) {
+		to = ctx.Uint64(reexecToFlag.Name)
+	}
+	if from == 0 {
+		from = 1 // Genesis allocations aren't deployments
+	}
+	if to == 0 {
+		log.Info("No blocks to index")
+		return nil
+	}
+	if to < from {
+		utils.Fatalf("Invalid block range: --%s (%d) is below --%s (%d)", reexecToFlag.Name, to, reexecFromFlag.Name, from)
+	}
+	parent := chain.GetBlockByNumber(from - 1)
+	if parent == nil {
+		utils.Fatalf("Block #%d not found", from-1)
+	}
+	database := state.NewDatabaseWithCache(db, 16, "")
+	statedb, err := regenerateState(chain, database, parent, ctx.Uint64(reexecReexecFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to retrieve state of block #%d: %v", from-1, err)
+	}
+	var (
+		start     = time.Now()
+		logged    = time.Now()
+		contracts int
+		proot     common.Hash
+	)
+	for number := from; number <= to; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			utils.Fatalf("Block #%d not found", number)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing contracts", "number", number, "target", to, "contracts", contracts, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if _, _, _, err := chain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			utils.Fatalf("Failed to process block #%d: %v", number, err)
+		}
+		rawdb.WriteContractLookupEntries(db, block.Hash(), number, statedb.Creations())
+		contracts += len(statedb.Creations())
+
+		root, err := statedb.Commit(chain.Config().IsEnabled(chain.Config().GetEIP161dTransition, block.Number()))
+		if err != nil {
+			utils.Fatalf("Failed to commit state of block #%d: %v", number, err)
+		}
+		if root != block.Root() {
+			utils.Fatalf("State root mismatch at block #%d: have %x, want %x", number, root, block.Root())
+		}
+		// Only keep the state of the last processed block in memory
+		database.TrieDB().Reference(root, common.Hash{})
+		if proot != (common.Hash{}) {
+			database.TrieDB().Dereference(proot)
+		}
+		proot = root
+
+		if statedb, err = state.New(root, database, nil); err != nil {
+			utils.Fatalf("Failed to reopen state of block #%d: %v", number, err)
+		}
+	}
+	log.Info("Contracts indexed", "blocks", to-from+1, "contracts", contracts, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// dbMigrate migrates the key schema of the chain database to the latest or the
+// requested version, reporting the changes made by each step.
+func dbMigrate(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var (
+		current = rawdb.ReadSchemaVersion(db)
+		target  = rawdb.LatestSchemaVersion(rawdb.SchemaMigrations)
+	)
+	if ctx.IsSet(dbSchemaVersionFlag.Name) {
+		target = ctx.Uint64(dbSchemaVersionFlag.Name)
+	}
+	fmt.Printf("Schema version: %d (latest %d)\n", current, rawdb.LatestSchemaVersion(rawdb.SchemaMigrations))
+	if marker := rawdb.ReadMigrationMarker(db); marker != nil {
+		action := "upgrade"
+		if marker.Rollback() {
+			action = "rollback"
+		}
+		fmt.Printf("Interrupted %s: %d -> %d, started %v\n", action, marker.From, marker.To, time.Unix(int64(marker.Started), 0))
+	}
+	reports, err := rawdb.RunMigrations(db, rawdb.SchemaMigrations, target, ctx.Bool(dbDryRunFlag.Name))
+	for _, report := range reports {
+		action := "Upgraded to"
+		if report.Rollback {
+			action = "Rolled back"
+		}
+		fmt.Printf("%s %d (%s): %d puts, %d deletes, %v\n", action, report.Version, report.Description, report.Puts, report.Deletes, common.PrettyDuration(report.Elapsed))
+	}
+	if err != nil {
+		utils.Fatalf("Migration failed: %v", err)
+	}
+	if len(reports) == 0 {
+		fmt.Println("No migrations to run")
+	}
+	return nil
+}
+
+func dbRecompress(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	compression := utils.MakeAncientCompression(ctx)
+	if compression == nil {
+		compression = rawdb.DefaultFreezerCompression()
+	}
+	name := "chaindata"
+	if ctx.GlobalString(utils.SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	// Resolve the ancient directory the same way the node does when opening it
+	ancient := ctx.GlobalString(utils.AncientFlag.Name)
+	switch {
+	case ancient == "":
+		ancient = filepath.Join(stack.ResolveDatabasePath(name), "ancient")
+	case !filepath.IsAbs(ancient):
+		ancient = stack.ResolvePath(ancient)
+	}
+	if _, err := os.Stat(ancient); err != nil {
+		utils.Fatalf("No ancient store found: %v", err)
+	}
+	start := time.Now()
+	converted, err := rawdb.RecompressFreezer(ancient, compression)
+	for _, kind := range converted {
+		fmt.Printf("Recompressed %s\n", kind)
+	}
+	if err != nil {
+		utils.Fatalf("Recompression failed: %v", err)
+	}
+	fmt.Printf("Ancient tables compressed: %s (%d converted, %v)\n", compression, len(converted), common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// loadWitnesses reads a stream of RLP encoded block witnesses from a file, keyed
+// by the hash of their blocks.
+func loadWitnesses(path string) (map[common.Hash]*wit.Witness, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		stream    = rlp.NewStream(file, 0)
+		witnesses = make(map[common.Hash]*wit.Witness)
+	)
+	for {
+		witness := new(wit.Witness)
+		if err := stream.Decode(witness); err == io.EOF {
+			return witnesses, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("witness %d: %v", len(witnesses), err)
+		}
+		witnesses[witness.Block] = witness
+	}
+}
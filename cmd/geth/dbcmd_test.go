@@ -0,0 +1,124 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that raw database keys can be written, read back and deleted through
+// the db maintenance commands.
+func TestDatabaseKeyCommands(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	json := filepath.Join(datadir, "genesis.json")
+	if err := ioutil.WriteFile(json, []byte(customGenesisTests[0].genesis), 0600); err != nil {
+		t.Fatalf("failed to write genesis file: %v", err)
+	}
+	runGeth(t, "--nousb", "--datadir", datadir, "init", json).WaitExit()
+
+	runGeth(t, "--nousb", "--datadir", datadir, "db", "put", "0xc0ffee", "0xbeef").WaitExit()
+
+	geth := runGeth(t, "--nousb", "--datadir", datadir, "db", "get", "0xc0ffee")
+	geth.ExpectRegexp("key 0xc0ffee: 0xbeef")
+	geth.ExpectExit()
+
+	// The genesis header is always known, so the well-known schema must resolve it
+	geth = runGeth(t, "--nousb", "--datadir", datadir, "db", "get", "canonical", "0")
+	geth.ExpectRegexp("key 0x6800000000000000006e: 0x[0-9a-f]{64}")
+	geth.ExpectExit()
+
+	runGeth(t, "--nousb", "--datadir", datadir, "db", "delete", "0xc0ffee").WaitExit()
+
+	geth = runGeth(t, "--nousb", "--datadir", datadir, "db", "get", "0xc0ffee")
+	geth.WaitExit()
+	if status := geth.ExitStatus(); status == 0 {
+		t.Fatalf("expected deleted key lookup to fail")
+	}
+	if stderr := geth.StderrText(); !strings.Contains(stderr, "not found") {
+		t.Fatalf("unexpected error output: %s", stderr)
+	}
+}
+
+// Tests that the bloombits index can be rebuilt on a freshly initialized chain.
+func TestDatabaseRebuildBloombits(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	json := filepath.Join(datadir, "genesis.json")
+	if err := ioutil.WriteFile(json, []byte(customGenesisTests[0].genesis), 0600); err != nil {
+		t.Fatalf("failed to write genesis file: %v", err)
+	}
+	runGeth(t, "--nousb", "--datadir", datadir, "init", json).WaitExit()
+
+	geth := runGeth(t, "--nousb", "--datadir", datadir, "db", "rebuild-bloombits", "--workers", "2")
+	geth.WaitExit()
+	if status := geth.ExitStatus(); status != 0 {
+		t.Fatalf("rebuild failed with status %d: %s", status, geth.StderrText())
+	}
+	if stderr := geth.StderrText(); !strings.Contains(stderr, "Rebuilt bloombits index") {
+		t.Fatalf("unexpected output: %s", stderr)
+	}
+}
+
+// Tests that the receipts of a freshly initialized chain pass the repair check.
+func TestDatabaseRepairReceipts(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	json := filepath.Join(datadir, "genesis.json")
+	if err := ioutil.WriteFile(json, []byte(customGenesisTests[0].genesis), 0600); err != nil {
+		t.Fatalf("failed to write genesis file: %v", err)
+	}
+	runGeth(t, "--nousb", "--datadir", datadir, "init", json).WaitExit()
+
+	geth := runGeth(t, "--nousb", "--datadir", datadir, "db", "repair-receipts", "--checkonly")
+	geth.WaitExit()
+	if status := geth.ExitStatus(); status != 0 {
+		t.Fatalf("check failed with status %d: %s", status, geth.StderrText())
+	}
+	if stderr := geth.StderrText(); !strings.Contains(stderr, "Receipts checked") {
+		t.Fatalf("unexpected output: %s", stderr)
+	}
+}
+
+func TestDatabaseIndexContracts(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	json := filepath.Join(datadir, "genesis.json")
+	if err := ioutil.WriteFile(json, []byte(customGenesisTests[0].genesis), 0600); err != nil {
+		t.Fatalf("failed to write genesis file: %v", err)
+	}
+	runGeth(t, "--nousb", "--datadir", datadir, "init", json).WaitExit()
+
+	geth := runGeth(t, "--nousb", "--datadir", datadir, "db", "index-contracts", "--from", "2", "--to", "1")
+	geth.WaitExit()
+	if status := geth.ExitStatus(); status == 0 {
+		t.Fatalf("inverted range accepted")
+	}
+	geth = runGeth(t, "--nousb", "--datadir", datadir, "db", "index-contracts")
+	geth.WaitExit()
+	if status := geth.ExitStatus(); status != 0 {
+		t.Fatalf("indexing failed with status %d: %s", status, geth.StderrText())
+	}
+}
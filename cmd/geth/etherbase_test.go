@@ -0,0 +1,110 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// derivingWallet is a wallet deriving a fixed account, recording the derivation
+// requested. Any other wallet method panics.
+type derivingWallet struct {
+	accounts.Wallet
+	url     accounts.URL
+	account accounts.Account
+	err     error
+
+	path accounts.DerivationPath
+	pin  bool
+}
+
+func (w *derivingWallet) URL() accounts.URL { return w.url }
+
+func (w *derivingWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.path, w.pin = path, pin
+	return w.account, w.err
+}
+
+// Tests that the etherbase derivation path is only parsed when requested.
+func TestHardwareEtherbasePath(t *testing.T) {
+	parse := func(args ...string) (accounts.DerivationPath, error) {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String(utils.MinerEtherbasePathFlag.Name, "", "")
+		if err := set.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return hardwareEtherbasePath(cli.NewContext(nil, set, nil))
+	}
+	if path, err := parse(); path != nil || err != nil {
+		t.Fatalf("unrequested path mismatch: have %v, %v, want nil", path, err)
+	}
+	path, err := parse("--" + utils.MinerEtherbasePathFlag.Name + "=m/44'/60'/0'/0/3")
+	if err != nil {
+		t.Fatalf("failed to parse path: %v", err)
+	}
+	if want := (accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000, 0, 3}); path.String() != want.String() {
+		t.Fatalf("path mismatch: have %v, want %v", path, want)
+	}
+	if _, err := parse("--" + utils.MinerEtherbasePathFlag.Name + "=m/foo"); err == nil {
+		t.Fatal("invalid path accepted")
+	}
+}
+
+// Tests that the etherbase is only derived on hardware wallets, pinning the
+// account to keep the signing session open.
+func TestDeriveEtherbase(t *testing.T) {
+	var (
+		path    = accounts.DefaultBaseDerivationPath
+		account = accounts.Account{Address: common.HexToAddress("0x1111111111111111111111111111111111111111")}
+	)
+	for i, tt := range []struct {
+		scheme string
+		err    error
+		want   bool
+	}{
+		{usbwallet.LedgerScheme, nil, true},
+		{usbwallet.TrezorScheme, nil, true},
+		{"keystore", nil, false},
+		{usbwallet.LedgerScheme, errors.New("device locked"), false},
+	} {
+		var etherbase common.Address
+		wallet := &derivingWallet{url: accounts.URL{Scheme: tt.scheme, Path: "test"}, account: account, err: tt.err}
+		if have := deriveEtherbase(func(addr common.Address) { etherbase = addr }, wallet, path); have != tt.want {
+			t.Fatalf("test %d: derivation mismatch: have %v, want %v", i, have, tt.want)
+		}
+		if !tt.want {
+			if etherbase != (common.Address{}) {
+				t.Fatalf("test %d: etherbase set to %x", i, etherbase)
+			}
+			continue
+		}
+		if etherbase != account.Address {
+			t.Fatalf("test %d: etherbase mismatch: have %x, want %x", i, etherbase, account.Address)
+		}
+		if wallet.path.String() != path.String() || !wallet.pin {
+			t.Fatalf("test %d: derivation request mismatch: path %v, pin %v", i, wallet.path, wallet.pin)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// exportSchemaVersion is the version of the documents written by the JSON Lines
+// export, bumped whenever a field is changed or removed.
+const exportSchemaVersion = 1
+
+var (
+	exportFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: `Export format ("rlp" or "jsonl")`,
+		Value: "rlp",
+	}
+	exportWorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "Number of blocks to extract in parallel in the jsonl format",
+		Value: runtime.NumCPU(),
+	}
+	exportTracerFlag = cli.StringFlag{
+		Name:  "tracer",
+		Usage: "Name of a built-in tracer (e.g. callTracer) or JavaScript tracer code to include transaction traces in the jsonl format, requires the historical state",
+	}
+)
+
+// exportedBlock is a document of the JSON Lines export, holding a block with its
+// transactions, their receipts and optionally their traces.
+type exportedBlock struct {
+	Schema   int                    `json:"schema"`
+	Block    map[string]interface{} `json:"block"` // Block in the eth_getBlockByNumber format, with full transactions
+	Receipts types.Receipts         `json:"receipts"`
+	Traces   []*reexecTxResult      `json:"traces,omitempty"`
+}
+
+// exportJSONL exports the given range of canonical blocks into the specified
+// file as JSON Lines, one document per block, extracting the blocks with the
+// given number of workers in parallel while keeping them in order in the file.
+// If appending is set, the file is appended to if it already exists.
+func exportJSONL(chain *core.BlockChain, fn string, first, last uint64, workers int, tracer string, appending bool) error {
+	log.Info("Exporting blockchain", "file", fn, "format", "jsonl", "first", first, "last", last)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appending {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	fh, err := os.OpenFile(fn, flags, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	out := bufio.NewWriter(writer)
+	defer out.Flush()
+
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		database = chain.StateCache()
+		batch    = uint64(workers * 16)
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	// Extract the blocks in batches, so the documents can be written out in order
+	for from := first; from <= last; from += batch {
+		to := from + batch - 1
+		if to > last || to < from {
+			to = last
+		}
+		var (
+			docs = make([][]byte, to-from+1)
+			errs = make([]error, to-from+1)
+			next = make(chan uint64)
+			wg   sync.WaitGroup
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for number := range next {
+					docs[number-from], errs[number-from] = exportBlockJSON(chain, database, number, tracer)
+				}
+			}()
+		}
+		for number := from; number <= to; number++ {
+			next <- number
+		}
+		close(next)
+		wg.Wait()
+
+		for i, doc := range docs {
+			if errs[i] != nil {
+				return fmt.Errorf("block #%d: %v", from+uint64(i), errs[i])
+			}
+			if _, err := out.Write(doc); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting blocks", "number", to, "target", last, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if to == last {
+			break
+		}
+	}
+	log.Info("Exported blockchain", "file", fn, "blocks", last-first+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportBlockJSON creates the JSON Lines document of a canonical block, ending
+// with a newline.
+func exportBlockJSON(chain *core.BlockChain, database state.Database, number uint64, tracer string) ([]byte, error) {
+	block := chain.GetBlockByNumber(number)
+	if block == nil {
+		return nil, fmt.Errorf("block not found")
+	}
+	fields, err := ethapi.RPCMarshalBlock(block, true, true)
+	if err != nil {
+		return nil, err
+	}
+	fields["totalDifficulty"] = (*hexutil.Big)(chain.GetTd(block.Hash(), number))
+
+	receipts := chain.GetReceiptsByHash(block.Hash())
+	if len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("receipts missing")
+	}
+	doc := &exportedBlock{Schema: exportSchemaVersion, Block: fields, Receipts: receipts}
+	if receipts == nil {
+		doc.Receipts = types.Receipts{}
+	}
+	if tracer != "" && len(block.Transactions()) > 0 {
+		parent := chain.GetBlock(block.ParentHash(), number-1)
+		if parent == nil {
+			return nil, fmt.Errorf("parent block not found")
+		}
+		statedb, err := state.New(parent.Root(), database, nil)
+		if err != nil {
+			return nil, fmt.Errorf("state of parent not available, traces require an archive node (%v)", err)
+		}
+		if doc.Traces, err = traceBlockOffline(chain, statedb, block, tracer); err != nil {
+			return nil, err
+		}
+	}
+	blob, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
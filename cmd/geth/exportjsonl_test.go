@@ -0,0 +1,130 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that the JSON Lines export writes one document per block in order, with
+// the transactions, receipts and traces of the blocks.
+func TestExportJSONL(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 40, func(i int, gen *core.BlockGen) {
+		for j := 0; j < i%3; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(address), common.Address{0xaa}, big.NewInt(1), 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+			gen.AddTx(tx)
+		}
+	})
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "geth-export-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "chain.jsonl")
+
+	// Export the chain in two parts, appending the second one
+	if err := exportJSONL(chain, file, 0, 20, 4, "callTracer", false); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	if err := exportJSONL(chain, file, 21, 40, 3, "callTracer", true); err != nil {
+		t.Fatalf("failed to append chain: %v", err)
+	}
+	fh, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	var (
+		scanner = bufio.NewScanner(fh)
+		number  uint64
+	)
+	scanner.Buffer(nil, 1024*1024)
+	for ; scanner.Scan(); number++ {
+		var doc struct {
+			Schema int `json:"schema"`
+			Block  struct {
+				Number       hexutil.Uint64    `json:"number"`
+				Hash         common.Hash       `json:"hash"`
+				Transactions []json.RawMessage `json:"transactions"`
+			} `json:"block"`
+			Receipts []*types.Receipt  `json:"receipts"`
+			Traces   []*reexecTxResult `json:"traces"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("line %d: invalid document: %v", number, err)
+		}
+		block := chain.GetBlockByNumber(number)
+		switch {
+		case doc.Schema != exportSchemaVersion:
+			t.Errorf("block #%d: schema mismatch: have %d, want %d", number, doc.Schema, exportSchemaVersion)
+		case uint64(doc.Block.Number) != number || doc.Block.Hash != block.Hash():
+			t.Errorf("block #%d: block mismatch: have #%d %x", number, doc.Block.Number, doc.Block.Hash)
+		case len(doc.Block.Transactions) != len(block.Transactions()):
+			t.Errorf("block #%d: have %d transactions, want %d", number, len(doc.Block.Transactions), len(block.Transactions()))
+		case len(doc.Receipts) != len(block.Transactions()):
+			t.Errorf("block #%d: have %d receipts, want %d", number, len(doc.Receipts), len(block.Transactions()))
+		case len(doc.Traces) != len(block.Transactions()):
+			t.Errorf("block #%d: have %d traces, want %d", number, len(doc.Traces), len(block.Transactions()))
+		}
+		for i, trace := range doc.Traces {
+			if trace.TxHash != block.Transactions()[i].Hash() || trace.Result == nil {
+				t.Errorf("block #%d: trace %d mismatch: %+v", number, i, trace)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if number != 41 {
+		t.Fatalf("have %d documents, want 41", number)
+	}
+}
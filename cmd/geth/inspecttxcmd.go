@@ -0,0 +1,308 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	inspectTxFileFlag = cli.StringFlag{
+		Name:  "file",
+		Usage: "File containing the hex encoded raw transaction (instead of an argument)",
+	}
+	inspectTxBlockFlag = cli.Uint64Flag{
+		Name:  "block",
+		Usage: "Block number whose chain rules to validate against (default = chain head when simulating, otherwise all configured forks)",
+	}
+	inspectTxSimulateFlag = cli.BoolFlag{
+		Name:  "simulate",
+		Usage: "Simulate the transaction against the head state of the local chain database",
+	}
+
+	inspectTxCommand = cli.Command{
+		Action:    utils.MigrateFlags(inspectTx),
+		Name:      "inspect-tx",
+		Usage:     "Decode, verify and optionally simulate a raw signed transaction",
+		ArgsUsage: "<hex encoded transaction>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			inspectTxFileFlag,
+			inspectTxBlockFlag,
+			inspectTxSimulateFlag,
+		},
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+The inspect-tx command decodes a raw signed transaction, given either as a hex
+argument or in a file, and prints all of its fields along with the recovered
+sender. The intrinsic gas of the transaction is validated against the rules of
+the selected chain configuration.
+
+With --simulate, the local chain database is opened (the node must be stopped)
+and the transaction is executed against the head state, without persisting any
+changes. Typed transaction envelopes (EIP-2718) are not supported by this client
+version, and are reported as such.`,
+	}
+)
+
+// inspectedTx is the decoded representation of a transaction printed by the
+// inspect-tx command.
+type inspectedTx struct {
+	Hash      common.Hash     `json:"hash"`
+	Type      string          `json:"type"`
+	Nonce     hexutil.Uint64  `json:"nonce"`
+	GasPrice  *hexutil.Big    `json:"gasPrice"`
+	Gas       hexutil.Uint64  `json:"gas"`
+	To        *common.Address `json:"to"`
+	Value     *hexutil.Big    `json:"value"`
+	Input     hexutil.Bytes   `json:"input"`
+	V         *hexutil.Big    `json:"v"`
+	R         *hexutil.Big    `json:"r"`
+	S         *hexutil.Big    `json:"s"`
+	Protected bool            `json:"protected"`
+	ChainID   *hexutil.Big    `json:"chainId,omitempty"`
+	Size      string          `json:"size"`
+
+	From        *common.Address `json:"from,omitempty"`
+	SenderError string          `json:"senderError,omitempty"`
+
+	IntrinsicGas      hexutil.Uint64 `json:"intrinsicGas"`
+	IntrinsicGasError string         `json:"intrinsicGasError,omitempty"`
+	ChainIDError      string         `json:"chainIdError,omitempty"`
+
+	Simulation *inspectedTxSimulation `json:"simulation,omitempty"`
+}
+
+// inspectedTxSimulation is the outcome of simulating a transaction against the
+// head state.
+type inspectedTxSimulation struct {
+	Block        hexutil.Uint64 `json:"block"`
+	UsedGas      hexutil.Uint64 `json:"usedGas"`
+	Failed       bool           `json:"failed"`
+	Error        string         `json:"error,omitempty"`
+	ReturnData   hexutil.Bytes  `json:"returnData,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+}
+
+// readRawTransaction reads the hex encoded transaction either from the file given
+// with --file, or from the first command line argument.
+func readRawTransaction(ctx *cli.Context) ([]byte, error) {
+	var input string
+	switch {
+	case ctx.IsSet(inspectTxFileFlag.Name):
+		blob, err := ioutil.ReadFile(ctx.String(inspectTxFileFlag.Name))
+		if err != nil {
+			return nil, err
+		}
+		input = string(blob)
+	case len(ctx.Args()) == 1:
+		input = ctx.Args().First()
+	default:
+		return nil, fmt.Errorf("expected a raw transaction argument or --%s", inspectTxFileFlag.Name)
+	}
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "0x") {
+		input = "0x" + input
+	}
+	return hexutil.Decode(input)
+}
+
+func inspectTx(ctx *cli.Context) error {
+	raw, err := readRawTransaction(ctx)
+	if err != nil {
+		utils.Fatalf("Failed to read transaction: %v", err)
+	}
+	if len(raw) > 0 && raw[0] <= 0x7f {
+		utils.Fatalf("Typed transaction envelope (type %#x) is not supported by this client version", raw[0])
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		utils.Fatalf("Failed to decode transaction: %v", err)
+	}
+	var (
+		config ctypes.ChainConfigurator
+		number *big.Int
+		report = describeTx(tx)
+	)
+	if ctx.Bool(inspectTxSimulateFlag.Name) {
+		stack, _ := makeConfigNode(ctx)
+		defer stack.Close()
+
+		chain, db := utils.MakeChain(ctx, stack, true)
+		defer db.Close()
+		defer chain.Stop()
+
+		config = chain.Config()
+		number = chain.CurrentBlock().Number()
+		if ctx.IsSet(inspectTxBlockFlag.Name) {
+			number = new(big.Int).SetUint64(ctx.Uint64(inspectTxBlockFlag.Name))
+		}
+		validateTx(tx, config, number, report)
+		report.Simulation = simulateTx(chain, tx)
+	} else {
+		genesis := utils.MakeGenesis(ctx)
+		if genesis == nil {
+			genesis = params.DefaultGenesisBlock()
+		}
+		config = genesis.Config
+		number = new(big.Int).SetUint64(math.MaxInt64)
+		if ctx.IsSet(inspectTxBlockFlag.Name) {
+			number = new(big.Int).SetUint64(ctx.Uint64(inspectTxBlockFlag.Name))
+		}
+		validateTx(tx, config, number, report)
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(out))
+	return nil
+}
+
+// describeTx assembles the chain-independent fields of the transaction report.
+func describeTx(tx *types.Transaction) *inspectedTx {
+	v, r, s := tx.RawSignatureValues()
+	report := &inspectedTx{
+		Hash:      tx.Hash(),
+		Type:      "legacy",
+		Nonce:     hexutil.Uint64(tx.Nonce()),
+		GasPrice:  (*hexutil.Big)(tx.GasPrice()),
+		Gas:       hexutil.Uint64(tx.Gas()),
+		To:        tx.To(),
+		Value:     (*hexutil.Big)(tx.Value()),
+		Input:     tx.Data(),
+		V:         (*hexutil.Big)(v),
+		R:         (*hexutil.Big)(r),
+		S:         (*hexutil.Big)(s),
+		Protected: tx.Protected(),
+		Size:      tx.Size().String(),
+	}
+	signer := types.Signer(types.HomesteadSigner{})
+	if tx.Protected() {
+		report.ChainID = (*hexutil.Big)(tx.ChainId())
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	if from, err := types.Sender(signer, tx); err != nil {
+		report.SenderError = err.Error()
+	} else {
+		report.From = &from
+	}
+	return report
+}
+
+// validateTx checks the transaction against the chain rules active at the given
+// block number, recording any violations in the report.
+func validateTx(tx *types.Transaction, config ctypes.ChainConfigurator, number *big.Int, report *inspectedTx) {
+	if tx.Protected() {
+		if !config.IsEnabled(config.GetEIP155Transition, number) {
+			report.ChainIDError = "replay protected transactions are not yet valid (EIP-155 not activated)"
+		} else if chainID := config.GetChainID(); chainID != nil && chainID.Cmp(tx.ChainId()) != 0 {
+			report.ChainIDError = fmt.Sprintf("chain id mismatch: have %d, want %d", tx.ChainId(), chainID)
+		}
+	}
+	eip2f := config.IsEnabled(config.GetEIP2Transition, number)
+	eip2028f := config.IsEnabled(config.GetEIP2028Transition, number)
+	gas, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, eip2f, eip2028f)
+	if err != nil {
+		report.IntrinsicGasError = err.Error()
+		return
+	}
+	report.IntrinsicGas = hexutil.Uint64(gas)
+	if tx.Gas() < gas {
+		report.IntrinsicGasError = fmt.Sprintf("%v: have %d, want %d", core.ErrIntrinsicGas, tx.Gas(), gas)
+	}
+}
+
+// simulateTx executes the transaction against the head state of the chain,
+// discarding any resulting state changes.
+func simulateTx(chain *core.BlockChain, tx *types.Transaction) *inspectedTxSimulation {
+	head := chain.CurrentBlock()
+	sim := &inspectedTxSimulation{Block: hexutil.Uint64(head.NumberU64())}
+
+	msg, err := tx.AsMessage(types.MakeSigner(chain.Config(), head.Number()))
+	if err != nil {
+		sim.Error = err.Error()
+		return sim
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		sim.Error = err.Error()
+		return sim
+	}
+	// Execute the transaction on top of the head block, as if it was the first
+	// transaction of the next one.
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Number:     new(big.Int).Add(head.Number(), common.Big1),
+		GasLimit:   head.GasLimit(),
+		Time:       head.Time() + 1,
+		Difficulty: head.Difficulty(),
+		Coinbase:   head.Coinbase(),
+	}
+	vmctx := core.NewEVMContext(msg, header, chain, nil)
+	evm := vm.NewEVM(vmctx, statedb, chain.Config(), vm.Config{})
+
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if err != nil {
+		sim.Error = err.Error()
+		return sim
+	}
+	sim.UsedGas = hexutil.Uint64(result.UsedGas)
+	sim.Failed = result.Failed()
+	sim.ReturnData = result.Return()
+	if result.Err != nil {
+		sim.Error = result.Err.Error()
+	}
+	if revert := result.Revert(); len(revert) > 0 {
+		sim.ReturnData = revert
+		if reason, err := abi.UnpackRevert(revert); err == nil {
+			sim.RevertReason = reason
+		}
+	}
+	return sim
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that a raw transaction is decoded, its sender recovered and its
+// intrinsic gas validated against the selected chain rules.
+func TestInspectTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), 20000, big.NewInt(1), nil)
+	tx, err := types.SignTx(tx, types.NewEIP155Signer(big.NewInt(61)), key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	raw, _ := rlp.EncodeToBytes(tx)
+
+	geth := runGeth(t, "--nousb", "--classic", "inspect-tx", hexutil.Encode(raw))
+	geth.ExpectRegexp(`(?s)"hash": "` + tx.Hash().Hex() + `".*` +
+		`"chainId": "0x3d".*` +
+		`"from": "` + strings.ToLower(sender.Hex()) + `".*` +
+		`"intrinsicGas": "0x5208",\s*` +
+		`"intrinsicGasError": "intrinsic gas too low: have 20000, want 21000"`)
+	geth.ExpectExit()
+
+	// The same transaction is replay protected for a different chain on Mordor
+	geth = runGeth(t, "--nousb", "--mordor", "inspect-tx", hexutil.Encode(raw))
+	geth.ExpectRegexp(`"chainIdError": "chain id mismatch: have 61, want 63"`)
+	geth.ExpectExit()
+}
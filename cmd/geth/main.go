@@ -29,6 +29,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/accounts/vault"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/console/prompt"
@@ -68,9 +70,30 @@ var (
 		utils.LegacyBootnodesV5Flag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.AncientCompressFlag,
+		utils.AncientFileSizeFlag,
+		utils.AncientSyncItemsFlag,
+		utils.DatabaseDirFlag,
+		utils.DataDirPrimaryFlag,
+		utils.DataDirPrimaryCatchupFlag,
+		utils.NodeKeyPathFlag,
+		utils.AncientThresholdFlag,
+		utils.AncientAggressiveFlag,
 		utils.AncientRPCFlag,
+		utils.AncientRPCServeLimitFlag,
+		utils.AncientRPCMirrorFlag,
+		utils.AncientRPCRemoteOnlyFlag,
+		utils.AncientRPCPolicyFlag,
+		utils.AncientRPCFallbackFlag,
+		utils.AncientRPCFallbackTimeoutFlag,
+		utils.IntegrityCheckFlag,
+		utils.IntegrityRepairFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
+		utils.KeyVaultFileFlag,
+		utils.HashicorpVaultAddrFlag,
+		utils.HashicorpVaultPathFlag,
+		utils.HashicorpVaultTokenFileFlag,
 		utils.NoUSBFlag,
 		utils.SmartCardDaemonPathFlag,
 		utils.EthashCacheDirFlag,
@@ -92,11 +115,43 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolArchiveFlag,
+		utils.TxPoolArchiveFileFlag,
+		utils.TxManagerFlag,
+		utils.TxManagerRebroadcastFlag,
+		utils.TxManagerBumpIntervalFlag,
+		utils.TxManagerBumpPercentFlag,
+		utils.TxManagerPriceCapFlag,
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
+		utils.HeadWatchEndpointsFlag,
+		utils.HeadWatchIntervalFlag,
+		utils.HeadWatchDepthFlag,
+		utils.HeadWatchChecksFlag,
+		utils.HeadWatchHaltMiningFlag,
+		utils.AlertsWebhooksFlag,
+		utils.AlertsFormatFlag,
+		utils.AlertsTemplateFlag,
+		utils.AlertsNodeFlag,
+		utils.AlertsRateLimitFlag,
+		utils.AlertsReorgDepthFlag,
+		utils.AlertsSyncStallFlag,
+		utils.AlertsMinPeersFlag,
+		utils.ForkMonitorFlag,
+		utils.ForkMonitorIntervalFlag,
+		utils.ForkMonitorDepthFlag,
+		utils.ForkMonitorWarnLengthFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
+		utils.SnapshotNoReadsFlag,
+		utils.SnapshotAuditFlag,
 		utils.TxLookupLimitFlag,
+		utils.HistoryRetainFlag,
+		utils.VerifyReceiptsFlag,
+		utils.UncleIndexFlag,
+		utils.ContractIndexFlag,
+		utils.TokenIndexFlag,
+		utils.TrackSupplyFlag,
 		utils.LightServeFlag,
 		utils.LegacyLightServFlag,
 		utils.LightIngressFlag,
@@ -114,9 +169,13 @@ var (
 		utils.CacheTrieFlag,
 		utils.CacheTrieJournalFlag,
 		utils.CacheTrieRejournalFlag,
+		utils.CacheTrieFlushIntervalFlag,
+		utils.CacheTrieFlushBlocksFlag,
+		utils.CacheTrieFlushTimeoutFlag,
 		utils.CacheGCFlag,
 		utils.CacheSnapshotFlag,
 		utils.CacheNoPrefetchFlag,
+		utils.CacheWarmupFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -130,11 +189,13 @@ var (
 		utils.MinerGasPriceFlag,
 		utils.LegacyMinerGasPriceFlag,
 		utils.MinerEtherbaseFlag,
+		utils.MinerEtherbasePathFlag,
 		utils.LegacyMinerEtherbaseFlag,
 		utils.MinerExtraDataFlag,
 		utils.LegacyMinerExtraDataFlag,
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.MinerClockGuardFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -142,8 +203,23 @@ var (
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DNSDiscoveryFlag,
+		utils.WitnessFlag,
+		utils.WitnessCacheFlag,
+		utils.P2PRecordFlag,
+		utils.P2PRecordPayloadsFlag,
+		utils.PropagationMinPeersFlag,
+		utils.PropagationMaxPeersFlag,
+		utils.PropagationMinedAllFlag,
+		utils.StateServeLimitFlag,
+		utils.NTPServersFlag,
+		utils.NTPIntervalFlag,
+		utils.NTPThresholdFlag,
 		utils.DeveloperFlag,
 		utils.DeveloperPeriodFlag,
+		utils.DeveloperPoWFlag,
+		utils.DeveloperClassicFlag,
+		utils.DeveloperMnemonicFlag,
+		utils.DeveloperAccountsFlag,
 		utils.ClassicFlag,
 		utils.MordorFlag,
 		utils.SocialFlag,
@@ -158,6 +234,12 @@ var (
 		utils.VMEnableDebugFlag,
 		utils.NetworkIdFlag,
 		utils.EthStatsURLFlag,
+		utils.FirehoseURLFlag,
+		utils.FirehoseTopicPrefixFlag,
+		utils.FollowLeaderFlag,
+		utils.FollowPollFlag,
+		utils.PluginsDirFlag,
+		utils.PluginsFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
@@ -166,6 +248,7 @@ var (
 		utils.LegacyGpoPercentileFlag,
 		utils.EWASMInterpreterFlag,
 		utils.EVMInterpreterFlag,
+		utils.VMStatsFlag,
 		configFileFlag,
 	}
 
@@ -183,6 +266,10 @@ var (
 		utils.GraphQLEnabledFlag,
 		utils.GraphQLCORSDomainFlag,
 		utils.GraphQLVirtualHostsFlag,
+		utils.ExplorerEnabledFlag,
+		utils.GRPCEnabledFlag,
+		utils.GRPCListenAddrFlag,
+		utils.GRPCPortFlag,
 		utils.HTTPApiFlag,
 		utils.LegacyRPCApiFlag,
 		utils.WSEnabledFlag,
@@ -193,12 +280,31 @@ var (
 		utils.WSApiFlag,
 		utils.LegacyWSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.WSMaxSubscriptionsFlag,
+		utils.WSMaxTotalSubscriptionsFlag,
 		utils.LegacyWSAllowedOriginsFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
+		utils.RPCDrainTimeoutFlag,
+		utils.RPCCoalesceFlag,
+		utils.RPCArchiveMethodsFlag,
+		utils.RPCArchiveDepthFlag,
+		utils.RPCArchiveWorkersFlag,
+		utils.RPCArchiveQueueFlag,
+		utils.RPCHeadWorkersFlag,
+		utils.RPCHeadQueueFlag,
+		utils.RPCSlowThresholdFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCap,
 		utils.RPCGlobalTxFeeCap,
+		utils.RPCGlobalLogsRangeCap,
+		utils.RPCErrorCodesFlag,
+		utils.TraceRegenerateFlag,
+		utils.RPCCacheSizeFlag,
+		utils.RPCCacheTTLFlag,
+		utils.RPCFilterTimeoutFlag,
+		utils.RPCFilterPersistFlag,
+		utils.RPCResumeWindowFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -219,6 +325,13 @@ var (
 		utils.MetricsInfluxDBUsernameFlag,
 		utils.MetricsInfluxDBPasswordFlag,
 		utils.MetricsInfluxDBTagsFlag,
+		utils.MetricsEnableInfluxDBV2Flag,
+		utils.MetricsInfluxDBTokenFlag,
+		utils.MetricsInfluxDBBucketFlag,
+		utils.MetricsInfluxDBOrganizationFlag,
+		utils.MetricsPushGatewayFlag,
+		utils.MetricsPushGatewayJobFlag,
+		utils.MetricsPushGatewayLabelsFlag,
 	}
 )
 
@@ -239,6 +352,22 @@ func init() {
 		dumpCommand,
 		dumpGenesisCommand,
 		inspectCommand,
+		// See dbcmd.go:
+		dbCommand,
+		// See backupcmd.go:
+		backupCommand,
+		// See snapshotcmd.go:
+		snapshotCommand,
+		simchainCommand,
+		benchCommand,
+		// See reexeccmd.go:
+		reexecCommand,
+		// See replaycmd.go:
+		p2pReplayCommand,
+		// See inspecttxcmd.go:
+		inspectTxCommand,
+		// See badblockcmd.go:
+		replayBadBlockCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
@@ -427,7 +556,25 @@ func startNode(ctx *cli.Context, stack *node.Node, backend ethapi.Backend) {
 	}
 	ethClient := ethclient.NewClient(rpcClient)
 
+	// Derive the etherbase on the first hardware wallet opened, if requested
+	etherbasePath, err := hardwareEtherbasePath(ctx)
+	if err != nil {
+		utils.Fatalf("Invalid miner etherbase path: %v", err)
+	}
+	var setEtherbase func(common.Address)
+	if ethBackend, ok := backend.(*eth.EthAPIBackend); ok {
+		setEtherbase = ethBackend.SetEtherbase
+	} else if etherbasePath != nil {
+		log.Warn("Hardware wallet etherbase requires a full node, ignoring", "path", etherbasePath)
+		etherbasePath = nil
+	}
+	etherbaseReady := make(chan struct{})
+	if etherbasePath == nil {
+		close(etherbaseReady)
+	}
 	go func() {
+		pending := etherbasePath
+
 		// Open any wallets already attached
 		for _, wallet := range stack.AccountManager().Wallets() {
 			if err := wallet.Open(""); err != nil {
@@ -453,6 +600,10 @@ func startNode(ctx *cli.Context, stack *node.Node, backend ethapi.Backend) {
 
 				event.Wallet.SelfDerive(derivationPaths, ethClient)
 
+				if pending != nil && deriveEtherbase(setEtherbase, event.Wallet, pending) {
+					close(etherbaseReady)
+					pending = nil
+				}
 			case accounts.WalletDropped:
 				log.Info("Old wallet dropped", "url", event.Wallet.URL())
 				event.Wallet.Close()
@@ -507,12 +658,49 @@ func startNode(ctx *cli.Context, stack *node.Node, backend ethapi.Backend) {
 			threads = ctx.GlobalInt(utils.LegacyMinerThreadsFlag.Name)
 			log.Warn("The flag --minerthreads is deprecated and will be removed in the future, please use --miner.threads")
 		}
-		if err := ethBackend.StartMining(threads); err != nil {
-			utils.Fatalf("Failed to start mining: %v", err)
+		if etherbasePath == nil {
+			if err := ethBackend.StartMining(threads); err != nil {
+				utils.Fatalf("Failed to start mining: %v", err)
+			}
+			return
 		}
+		// Wait for the hardware wallet holding the etherbase to be opened
+		log.Info("Waiting for the hardware wallet etherbase to start mining", "path", etherbasePath)
+		go func() {
+			<-etherbaseReady
+			if err := ethBackend.StartMining(threads); err != nil {
+				utils.Fatalf("Failed to start mining: %v", err)
+			}
+		}()
 	}
 }
 
+// hardwareEtherbasePath parses the derivation path of the etherbase account on
+// a hardware wallet, nil if none was requested.
+func hardwareEtherbasePath(ctx *cli.Context) (accounts.DerivationPath, error) {
+	if !ctx.GlobalIsSet(utils.MinerEtherbasePathFlag.Name) {
+		return nil, nil
+	}
+	return accounts.ParseDerivationPath(ctx.GlobalString(utils.MinerEtherbasePathFlag.Name))
+}
+
+// deriveEtherbase derives the account at the given path on a hardware wallet just
+// opened, pinning it to keep it available for signing, and sets it as the
+// etherbase. It reports whether the etherbase was set.
+func deriveEtherbase(setEtherbase func(common.Address), wallet accounts.Wallet, path accounts.DerivationPath) bool {
+	if scheme := wallet.URL().Scheme; scheme != usbwallet.LedgerScheme && scheme != usbwallet.TrezorScheme {
+		return false
+	}
+	account, err := wallet.Derive(path, true)
+	if err != nil {
+		log.Warn("Failed to derive hardware wallet etherbase", "url", wallet.URL(), "path", path, "err", err)
+		return false
+	}
+	setEtherbase(account.Address)
+	log.Info("Etherbase derived on hardware wallet", "url", wallet.URL(), "path", path, "address", account.Address)
+	return true
+}
+
 // unlockAccounts unlocks any account specifically requested.
 func unlockAccounts(ctx *cli.Context, stack *node.Node) {
 	var unlocks []string
@@ -532,8 +720,13 @@ func unlockAccounts(ctx *cli.Context, stack *node.Node) {
 		utils.Fatalf("Account unlock with HTTP access is forbidden!")
 	}
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	vaults := stack.AccountManager().Backends(vault.FileVaultType)
 	passwords := utils.MakePasswordList(ctx)
 	for i, account := range unlocks {
+		// Accounts held in a key vault are unlocked by opening the whole vault
+		if common.IsHexAddress(account) && openKeyVault(vaults, common.HexToAddress(account), i, passwords) {
+			continue
+		}
 		unlockAccount(ks, account, i, passwords)
 	}
 }
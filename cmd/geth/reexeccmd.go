@@ -0,0 +1,337 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/eth/wit"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	reexecFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block of the range to re-execute",
+	}
+	reexecToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block of the range to re-execute (defaults to --from)",
+	}
+	reexecTracerFlag = cli.StringFlag{
+		Name:  "tracer",
+		Usage: "Name of a built-in tracer (e.g. callTracer) or JavaScript tracer code; the struct logger is used if empty",
+	}
+	reexecOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "Directory to write the per-block trace files into",
+		Value: "traces",
+	}
+	reexecReexecFlag = cli.Uint64Flag{
+		Name:  "reexec",
+		Usage: "Number of blocks to go back and re-execute to regenerate missing historical state",
+		Value: 128,
+	}
+
+	reexecCommand = cli.Command{
+		Action:    utils.MigrateFlags(reexecute),
+		Name:      "re-execute",
+		Usage:     "Re-execute a range of blocks offline, writing tracer output to files",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			reexecFromFlag,
+			reexecToFlag,
+			reexecTracerFlag,
+			reexecOutFlag,
+			reexecReexecFlag,
+			dbWitnessesFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+    geth re-execute --from N --to M --tracer callTracer --out dir/
+
+The re-execute command replays the given range of canonical blocks against the
+historical state of their parents, tracing every transaction. The results of
+each block are written as a JSON array to <out>/block_<number>_<hash>.json, with
+the full block hash.
+
+If the state of the first block's parent is not available (e.g. on a non-archive
+node), up to --reexec preceding blocks are re-executed to regenerate it. Blocks
+whose witness is found in the --witnesses file are executed statelessly, against
+their witness alone. The command requires a stopped node, and does not need the
+RPC server.`,
+	}
+)
+
+// reexecTxResult is the trace result of a single transaction, as written to the
+// output files of the re-execute command.
+type reexecTxResult struct {
+	TxHash common.Hash `json:"txHash"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func reexecute(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, true)
+	defer db.Close()
+	defer chain.Stop()
+
+	from := ctx.Uint64(reexecFromFlag.Name)
+	to := ctx.Uint64(reexecToFlag.Name)
+	if !ctx.IsSet(reexecToFlag.Name) {
+		to = from
+	}
+	if from == 0 {
+		utils.Fatalf("The genesis block cannot be re-executed, --%s must be at least 1", reexecFromFlag.Name)
+	}
+	if to < from {
+		utils.Fatalf("Invalid block range: --%s (%d) is below --%s (%d)", reexecToFlag.Name, to, reexecFromFlag.Name, from)
+	}
+	if head := chain.CurrentBlock().NumberU64(); to > head {
+		utils.Fatalf("Block range exceeds the current head: %d > %d", to, head)
+	}
+	witnesses := make(map[common.Hash]*wit.Witness)
+	if path := ctx.String(dbWitnessesFlag.Name); path != "" {
+		var err error
+		if witnesses, err = loadWitnesses(path); err != nil {
+			utils.Fatalf("Failed to load witnesses: %v", err)
+		}
+	}
+	out := ctx.String(reexecOutFlag.Name)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		utils.Fatalf("Failed to create output directory: %v", err)
+	}
+	if err := reexecuteBlocks(chain, db, from, to, ctx.String(reexecTracerFlag.Name), out, ctx.Uint64(reexecReexecFlag.Name), witnesses); err != nil {
+		utils.Fatalf("Re-execution failed: %v", err)
+	}
+	return nil
+}
+
+// reexecuteBlocks traces the given range of canonical blocks into per-block files
+// in the out directory. Blocks having a witness are executed against it alone,
+// the others against the historical state of their parents, regenerated from up
+// to reexec preceding blocks if needed.
+func reexecuteBlocks(chain *core.BlockChain, db ethdb.Database, from, to uint64, tracer, out string, reexec uint64, witnesses map[common.Hash]*wit.Witness) error {
+	var (
+		database = state.NewDatabaseWithCache(db, 16, "")
+		statedb  *state.StateDB // Post state of the last block executed on historical state
+		start    = time.Now()
+		logged   = time.Now()
+		txs      int
+	)
+	for number := from; number <= to; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("block #%d not found", number)
+		}
+		var (
+			blockState *state.StateDB
+			err        error
+		)
+		witness, stateless := witnesses[block.Hash()]
+		switch {
+		case stateless:
+			if blockState, err = witness.State(); err != nil {
+				return fmt.Errorf("failed to open witness of block #%d: %v", number, err)
+			}
+		case statedb == nil:
+			parent := chain.GetBlock(block.ParentHash(), number-1)
+			if parent == nil {
+				return fmt.Errorf("parent block #%d not found", number-1)
+			}
+			if statedb, err = regenerateState(chain, database, parent, reexec); err != nil {
+				return fmt.Errorf("failed to retrieve parent state of block #%d: %v", number, err)
+			}
+			blockState = statedb
+		default:
+			blockState = statedb
+		}
+		results, err := traceBlockOffline(chain, blockState, block, tracer)
+		if err != nil {
+			return fmt.Errorf("failed to re-execute block #%d: %v", number, err)
+		}
+		// Make sure the re-execution agrees with the canonical chain before writing anything out
+		root, err := blockState.Commit(chain.Config().IsEnabled(chain.Config().GetEIP161dTransition, block.Number()))
+		if err != nil {
+			return fmt.Errorf("failed to commit state of block #%d: %v", number, err)
+		}
+		if root != block.Root() {
+			return fmt.Errorf("state root mismatch after block #%d: have %x, want %x", number, root, block.Root())
+		}
+		// The post state of a witness only covers its block, so the next block
+		// without a witness regenerates its parent state from the database
+		if stateless {
+			statedb = nil
+		} else if statedb, err = state.New(root, database, nil); err != nil {
+			return fmt.Errorf("failed to reopen state after block #%d: %v", number, err)
+		}
+		if err := writeJSONFile(filepath.Join(out, reexecFileName(block)), results); err != nil {
+			return fmt.Errorf("failed to write trace file: %v", err)
+		}
+		txs += len(results)
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Re-executing blocks", "number", number, "target", to, "txs", txs, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Re-execution done", "blocks", to-from+1, "txs", txs, "out", out, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// reexecFileName returns the name of the trace file of the given block.
+func reexecFileName(block *types.Block) string {
+	return fmt.Sprintf("block_%d_%s.json", block.NumberU64(), block.Hash().Hex())
+}
+
+// traceBlockOffline executes all the transactions of the given block on top of
+// the provided parent state, tracing each of them with the requested tracer. The
+// state is mutated in place, and left as it is after the block's finalization.
+func traceBlockOffline(chain *core.BlockChain, statedb *state.StateDB, block *types.Block, tracerCode string) ([]*reexecTxResult, error) {
+	var (
+		config  = chain.Config()
+		header  = block.Header()
+		gp      = new(core.GasPool).AddGas(block.GasLimit())
+		usedGas = new(uint64)
+		results = make([]*reexecTxResult, 0, len(block.Transactions()))
+	)
+	// Mutate the state according to any hard-fork specs, just like the state processor does
+	if config.IsEnabled(config.GetEthashEIP779Transition, block.Number()) {
+		if daoNumber := config.GetEthashEIP779Transition(); daoNumber != nil && *daoNumber == block.NumberU64() {
+			misc.ApplyDAOHardFork(statedb)
+		}
+	}
+	for i, tx := range block.Transactions() {
+		var tracer vm.Tracer = vm.NewStructLogger(nil)
+		if tracerCode != "" {
+			t, err := tracers.New(tracerCode)
+			if err != nil {
+				return nil, err
+			}
+			tracer = t
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := core.ApplyTransaction(config, chain, nil, gp, statedb, header, tx, usedGas, vm.Config{Debug: true, Tracer: tracer})
+		if err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		res := &reexecTxResult{TxHash: tx.Hash()}
+		switch tracer := tracer.(type) {
+		case *vm.StructLogger:
+			res.Result = &ethapi.ExecutionResult{
+				Gas:         receipt.GasUsed,
+				Failed:      receipt.Status == types.ReceiptStatusFailed,
+				ReturnValue: fmt.Sprintf("%x", tracer.Output()),
+				StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
+			}
+		case *tracers.Tracer:
+			out, err := tracer.GetResult()
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Result = out
+			}
+		}
+		results = append(results, res)
+	}
+	if *usedGas != block.GasUsed() {
+		return nil, fmt.Errorf("gas used mismatch: have %d, want %d", *usedGas, block.GasUsed())
+	}
+	chain.Engine().Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
+	return results, nil
+}
+
+// regenerateState retrieves the state associated with the given block. If it is
+// not available, up to reexec preceding blocks are re-executed to regenerate it.
+func regenerateState(chain *core.BlockChain, database state.Database, block *types.Block, reexec uint64) (*state.StateDB, error) {
+	statedb, err := state.New(block.Root(), database, nil)
+	if err == nil {
+		return statedb, nil
+	}
+	origin := block.NumberU64()
+	for i := uint64(0); i < reexec; i++ {
+		if block = chain.GetBlock(block.ParentHash(), block.NumberU64()-1); block == nil {
+			break
+		}
+		if statedb, err = state.New(block.Root(), database, nil); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+	}
+	for block.NumberU64() < origin {
+		next := block.NumberU64() + 1
+		if block = chain.GetBlockByNumber(next); block == nil {
+			return nil, fmt.Errorf("block #%d not found", next)
+		}
+		if _, _, _, err := chain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("processing block %d failed: %v", block.NumberU64(), err)
+		}
+		root, err := statedb.Commit(chain.Config().IsEnabled(chain.Config().GetEIP161dTransition, block.Number()))
+		if err != nil {
+			return nil, err
+		}
+		if statedb, err = state.New(root, database, nil); err != nil {
+			return nil, fmt.Errorf("state reset after block %d failed: %v", block.NumberU64(), err)
+		}
+	}
+	log.Info("Historical state regenerated", "block", block.NumberU64())
+	return statedb, nil
+}
+
+// writeJSONFile writes the indented JSON encoding of v into the given file.
+func writeJSONFile(file string, v interface{}) error {
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, blob, 0644)
+}
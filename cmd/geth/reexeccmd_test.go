@@ -0,0 +1,88 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/eth/wit"
+)
+
+// Tests that historical states are regenerated within the re-execution limit
+// only, and that block ranges are traced into per-block files, either against
+// historical state or statelessly against witnesses.
+func TestReexecute(t *testing.T) {
+	chain, _ := generateSimChain(t, 1, 8)
+	defer chain.Stop()
+
+	// Only the genesis state is on disk, the others being held by the chain
+	db := rawdb.NewDatabase(chain.StateCache().TrieDB().DiskDB())
+	block := chain.GetBlockByNumber(6)
+	if _, err := regenerateState(chain, state.NewDatabase(db), block, 2); err == nil {
+		t.Fatal("state regenerated beyond the re-execution limit")
+	}
+	statedb, err := regenerateState(chain, state.NewDatabase(db), block, 8)
+	if err != nil {
+		t.Fatalf("failed to regenerate state: %v", err)
+	}
+	if root := statedb.IntermediateRoot(true); root != block.Root() {
+		t.Fatalf("regenerated state root mismatch: have %x, want %x", root, block.Root())
+	}
+	out, err := ioutil.TempDir("", "reexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	if err := reexecuteBlocks(chain, db, 1, 8, "", out, 8, nil); err != nil {
+		t.Fatalf("failed to re-execute blocks: %v", err)
+	}
+	for i := uint64(1); i <= 8; i++ {
+		block := chain.GetBlockByNumber(i)
+		blob, err := ioutil.ReadFile(filepath.Join(out, reexecFileName(block)))
+		if err != nil {
+			t.Fatalf("trace file of block #%d missing: %v", i, err)
+		}
+		var results []*reexecTxResult
+		if err := json.Unmarshal(blob, &results); err != nil {
+			t.Fatalf("invalid trace file of block #%d: %v", i, err)
+		}
+		if len(results) != len(block.Transactions()) {
+			t.Fatalf("block #%d trace count mismatch: have %d, want %d", i, len(results), len(block.Transactions()))
+		}
+	}
+	// Re-execute statelessly a block whose parent state is not available
+	block = chain.GetBlockByNumber(5)
+	if err := reexecuteBlocks(chain, db, 5, 5, "callTracer", out, 0, nil); err == nil {
+		t.Fatal("block re-executed without its parent state")
+	}
+	witness, err := wit.Generate(chain, block)
+	if err != nil {
+		t.Fatalf("failed to generate witness: %v", err)
+	}
+	witnesses := map[common.Hash]*wit.Witness{block.Hash(): witness}
+	if err := reexecuteBlocks(chain, db, 5, 5, "callTracer", out, 0, witnesses); err != nil {
+		t.Fatalf("failed to re-execute block against its witness: %v", err)
+	}
+}
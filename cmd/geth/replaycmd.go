@@ -0,0 +1,112 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/eth"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	replayRealtimeFlag = cli.BoolFlag{
+		Name:  "realtime",
+		Usage: "Feed the messages with their recorded timing instead of as fast as they're handled",
+	}
+	replayLingerFlag = cli.DurationFlag{
+		Name:  "linger",
+		Usage: "Time to keep the replayed peer connected after its last message",
+		Value: 5 * time.Second,
+	}
+
+	p2pReplayCommand = cli.Command{
+		Action:    utils.MigrateFlags(p2pReplay),
+		Name:      "p2p-replay",
+		Usage:     "Replay a recorded eth protocol session into the local protocol handlers",
+		ArgsUsage: "<recording>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ClassicFlag,
+			utils.MordorFlag,
+			utils.KottiFlag,
+			utils.SocialFlag,
+			utils.EthersocialFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV1Flag,
+			replayRealtimeFlag,
+			replayLingerFlag,
+		},
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+    geth p2p-replay [--realtime] <recording>
+
+The p2p-replay command re-feeds the inbound messages of a session recorded with
+--p2p.record and --p2p.record.payloads into the eth protocol handlers running on
+top of the local chain, as if the recorded peer connected again. The responses
+of the handlers are discarded, and the error the peer got dropped with, if any,
+is reported. Run with --verbosity 5 to follow the handling of each message.
+
+Blocks delivered by the replayed peer are imported into the local chain, so use
+a copy of the data directory to keep the original state. The command requires a
+stopped node.`,
+	}
+)
+
+func p2pReplay(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	header, msgs, err := eth.ReadRecording(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to read recording: %v", err)
+	}
+	var inbound int
+	for _, msg := range msgs {
+		if msg.Inbound {
+			inbound++
+		}
+	}
+	fmt.Printf("Peer:     %x (%s, %s)\n", header.ID[:], header.Name, header.RemoteAddr)
+	fmt.Printf("Protocol: eth/%d, network %d\n", header.Version, header.NetworkID)
+	fmt.Printf("Started:  %v at head #%d [%x]\n", time.Unix(0, int64(header.Start)), header.HeadNumber, header.HeadHash[:8])
+	fmt.Printf("Messages: %d inbound, %d outbound\n", inbound, len(msgs)-inbound)
+
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+	defer chain.Stop()
+
+	result, err := eth.Replay(chain, db, ctx.Args().First(), ctx.Bool(replayRealtimeFlag.Name), ctx.Duration(replayLingerFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to replay session: %v", err)
+	}
+	fmt.Printf("Replayed %d of %d inbound messages, %d responses\n", result.Inbound, inbound, result.Outbound)
+	if result.Err != nil {
+		fmt.Printf("Peer dropped: %v\n", result.Err)
+	}
+	return nil
+}
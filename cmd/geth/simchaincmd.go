@@ -0,0 +1,408 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/confp/generic"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	simBlockTime    = 13      // Seconds between the timestamps of simulated blocks
+	simGasLimit     = 8000000 // Gas limit of the simulated blocks
+	simTransferGas  = 21000   // Gas allowance of the value transfers
+	simDeployGas    = 100000  // Gas allowance of the contract deployments
+	simStoreGas     = 60000   // Gas allowance of the storage writes
+	simStorageSlots = 256     // Number of storage slots written of each contract
+)
+
+var (
+	simchainBlocksFlag = cli.Uint64Flag{
+		Name:  "simchain.blocks",
+		Usage: "Number of blocks to generate",
+		Value: 10000,
+	}
+	simchainSeedFlag = cli.Int64Flag{
+		Name:  "simchain.seed",
+		Usage: "Seed of the pseudo-random generation, same seeds yielding the same chain",
+		Value: 1,
+	}
+	simchainAccountsFlag = cli.IntFlag{
+		Name:  "simchain.accounts",
+		Usage: "Number of funded accounts sending the transactions",
+		Value: 1000,
+	}
+	simchainTransfersFlag = cli.IntFlag{
+		Name:  "simchain.transfers",
+		Usage: "Number of value transfers per block",
+		Value: 20,
+	}
+	simchainDeploysFlag = cli.IntFlag{
+		Name:  "simchain.deploys",
+		Usage: "Number of contract deployments per block",
+		Value: 1,
+	}
+	simchainStoresFlag = cli.IntFlag{
+		Name:  "simchain.stores",
+		Usage: "Number of contract storage writes per block",
+		Value: 10,
+	}
+	simchainConfigFlag = cli.StringFlag{
+		Name:  "simchain.config",
+		Usage: "Chain configuration file defining the fork schedule (default = configuration of the selected network)",
+	}
+
+	simchainCommand = cli.Command{
+		Action:    utils.MigrateFlags(simChain),
+		Name:      "simchain",
+		Usage:     "Generate a deterministic pseudo-random test chain",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.GCModeFlag,
+			simchainBlocksFlag,
+			simchainSeedFlag,
+			simchainAccountsFlag,
+			simchainTransfersFlag,
+			simchainDeploysFlag,
+			simchainStoresFlag,
+			simchainConfigFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The simchain command generates a chain into an empty chain database, for
+benchmarking sync, pruning and ancient stores at scale. Each block holds the
+given mix of value transfers between funded and fresh accounts, deployments of
+a storage contract and writes to random slots of the deployed contracts.
+
+The chain is derived from the seed alone: generating it again with the same
+flags yields the same blocks. The fork schedule is the one of the selected
+network, or of the given chain configuration file, on a genesis of its own.
+
+The blocks are not sealed, so nodes running on the generated chain, or syncing
+it, must be started with --fakepow.`,
+	}
+)
+
+// simStorageCode is the init code of the storage contract, whose runtime code
+// stores the second word of the call data in the slot of the first one.
+var simStorageCode = common.FromHex("6008600c60003960086000f3" + "6020356000355500")
+
+// simChainGenerator generates the blocks of a simulated chain.
+type simChainGenerator struct {
+	config    ctypes.ChainConfigurator
+	rand      *rand.Rand
+	keys      []*ecdsa.PrivateKey
+	accounts  []common.Address
+	contracts []common.Address
+	coinbase  common.Address
+
+	transfers int
+	deploys   int
+	stores    int
+}
+
+// newSimChainGenerator creates a generator of simulated blocks on the given
+// fork schedule, deriving its accounts from the seed.
+func newSimChainGenerator(config ctypes.ChainConfigurator, seed int64, accounts, transfers, deploys, stores int) (*simChainGenerator, error) {
+	if accounts <= 0 {
+		return nil, errors.New("no funded accounts")
+	}
+	if gas := transfers*simTransferGas + deploys*simDeployGas + stores*simStoreGas; gas > simGasLimit {
+		return nil, fmt.Errorf("transactions need %d gas per block, over the %d gas limit", gas, simGasLimit)
+	}
+	g := &simChainGenerator{
+		config:    config,
+		rand:      rand.New(rand.NewSource(seed)),
+		transfers: transfers,
+		deploys:   deploys,
+		stores:    stores,
+	}
+	var blob [16]byte
+	binary.BigEndian.PutUint64(blob[:8], uint64(seed))
+	for i := 0; i < accounts; i++ {
+		binary.BigEndian.PutUint64(blob[8:], uint64(i))
+		key, err := crypto.ToECDSA(crypto.Keccak256(blob[:]))
+		if err != nil {
+			return nil, err
+		}
+		g.keys = append(g.keys, key)
+		g.accounts = append(g.accounts, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	g.coinbase = common.BytesToAddress(crypto.Keccak256(blob[:8]))
+	return g, nil
+}
+
+// genesis creates the genesis of the simulated chain, funding its accounts.
+func (g *simChainGenerator) genesis() *genesisT.Genesis {
+	balance := new(big.Int).Mul(big.NewInt(1000000), big.NewInt(vars.Ether))
+
+	alloc := make(genesisT.GenesisAlloc, len(g.accounts))
+	for _, addr := range g.accounts {
+		alloc[addr] = genesisT.GenesisAccount{Balance: balance}
+	}
+	return &genesisT.Genesis{
+		Config:     g.config,
+		ExtraData:  []byte("simchain"),
+		GasLimit:   simGasLimit,
+		Difficulty: big.NewInt(131072),
+		Alloc:      alloc,
+	}
+}
+
+// generate appends the given number of blocks to the chain, stopping early if
+// the interrupt channel is closed.
+func (g *simChainGenerator) generate(chain *core.BlockChain, engine consensus.Engine, blocks uint64, interrupt <-chan struct{}) error {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		txs    int
+	)
+	for i := uint64(0); i < blocks; i++ {
+		select {
+		case <-interrupt:
+			return errors.New("interrupted")
+		default:
+		}
+		block, err := g.generateBlock(chain, engine)
+		if err != nil {
+			return err
+		}
+		txs += len(block.Transactions())
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating simulated chain", "number", block.Number(), "txs", txs, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return nil
+}
+
+// generateBlock assembles the next block on top of the chain head and writes it
+// along with its state, as the miner does.
+func (g *simChainGenerator) generateBlock(chain *core.BlockChain, engine consensus.Engine) (*types.Block, error) {
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, simGasLimit, simGasLimit),
+		Time:       parent.Time() + simBlockTime,
+		Coinbase:   g.coinbase,
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		return nil, err
+	}
+	if daoBlock := g.config.GetEthashEIP779Transition(); daoBlock != nil {
+		if number := header.Number.Uint64(); number >= *daoBlock && number < *daoBlock+vars.DAOForkExtraRange.Uint64() {
+			header.Extra = common.CopyBytes(vars.DAOForkBlockExtra)
+		}
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	if daoBlock := g.config.GetEthashEIP779Transition(); daoBlock != nil && *daoBlock == header.Number.Uint64() {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	var (
+		signer   = types.MakeSigner(g.config, header.Number)
+		gasPrice = big.NewInt(vars.GWei)
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+	)
+	apply := func(sender int, to *common.Address, value *big.Int, gas uint64, data []byte) error {
+		nonce := statedb.GetNonce(g.accounts[sender])
+
+		var tx *types.Transaction
+		if to == nil {
+			tx = types.NewContractCreation(nonce, value, gas, gasPrice, data)
+		} else {
+			tx = types.NewTransaction(nonce, *to, value, gas, gasPrice, data)
+		}
+		tx, err := types.SignTx(tx, signer, g.keys[sender])
+		if err != nil {
+			return err
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(txs))
+		receipt, err := core.ApplyTransaction(g.config, chain, &header.Coinbase, gp, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			return err
+		}
+		if to == nil {
+			g.contracts = append(g.contracts, receipt.ContractAddress)
+		}
+		txs, receipts = append(txs, tx), append(receipts, receipt)
+		return nil
+	}
+	for i := 0; i < g.transfers; i++ {
+		// Send to funded accounts and fresh ones alike, growing the state
+		to := g.accounts[g.rand.Intn(len(g.accounts))]
+		if g.rand.Intn(2) == 0 {
+			g.rand.Read(to[:])
+		}
+		if err := apply(g.rand.Intn(len(g.accounts)), &to, big.NewInt(g.rand.Int63n(vars.GWei)+1), simTransferGas, nil); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < g.deploys; i++ {
+		if err := apply(g.rand.Intn(len(g.accounts)), nil, new(big.Int), simDeployGas, simStorageCode); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < g.stores && len(g.contracts) > 0; i++ {
+		// Write random values into a bounded set of slots, overwriting and
+		// clearing previously written ones as well
+		to := g.contracts[g.rand.Intn(len(g.contracts))]
+		data := make([]byte, 64)
+		data[31] = byte(g.rand.Intn(simStorageSlots))
+		if g.rand.Intn(8) != 0 {
+			g.rand.Read(data[32:])
+		}
+		if err := apply(g.rand.Intn(len(g.accounts)), &to, new(big.Int), simStoreGas, data); err != nil {
+			return nil, err
+		}
+	}
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		receipt.BlockHash, receipt.BlockNumber = block.Hash(), block.Number()
+		for _, l := range receipt.Logs {
+			l.BlockHash = block.Hash()
+		}
+		logs = append(logs, receipt.Logs...)
+	}
+	if _, err := chain.WriteBlockWithState(block, receipts, logs, statedb, false); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func simChain(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 {
+		utils.Fatalf("This command doesn't take any arguments.")
+	}
+	var config ctypes.ChainConfigurator
+	if file := ctx.String(simchainConfigFlag.Name); file != "" {
+		blob, err := ioutil.ReadFile(file)
+		if err != nil {
+			utils.Fatalf("Failed to read chain configuration: %v", err)
+		}
+		if config, err = generic.UnmarshalChainConfigurator(blob); err != nil {
+			utils.Fatalf("Invalid chain configuration: %v", err)
+		}
+	} else if genesis := utils.MakeGenesis(ctx); genesis != nil {
+		config = genesis.Config
+	} else {
+		config = params.MainnetChainConfig
+	}
+	if config.GetConsensusEngineType().IsClique() {
+		utils.Fatalf("Simulated chains are only supported on ethash fork schedules")
+	}
+	if gcmode := ctx.GlobalString(utils.GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
+		utils.Fatalf("--%s must be either 'full' or 'archive'", utils.GCModeFlag.Name)
+	}
+	gen, err := newSimChainGenerator(config, ctx.Int64(simchainSeedFlag.Name), ctx.Int(simchainAccountsFlag.Name),
+		ctx.Int(simchainTransfersFlag.Name), ctx.Int(simchainDeploysFlag.Name), ctx.Int(simchainStoresFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid simulated chain: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	if rawdb.ReadCanonicalHash(db, 0) != (common.Hash{}) {
+		utils.Fatalf("Chain database already contains a chain")
+	}
+	genesis, err := core.CommitGenesis(gen.genesis(), db)
+	if err != nil {
+		utils.Fatalf("Failed to write genesis block: %v", err)
+	}
+	cache := &core.CacheConfig{
+		TrieCleanLimit:    eth.DefaultConfig.TrieCleanCache,
+		TrieDirtyLimit:    eth.DefaultConfig.TrieDirtyCache,
+		TrieDirtyDisabled: ctx.GlobalString(utils.GCModeFlag.Name) == "archive",
+		TrieTimeLimit:     eth.DefaultConfig.TrieTimeout,
+	}
+	if ctx.GlobalIsSet(utils.CacheFlag.Name) {
+		cache.TrieCleanLimit = ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheTrieFlag.Name) / 100
+		cache.TrieDirtyLimit = ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheGCFlag.Name) / 100
+	}
+	engine := ethash.NewFaker()
+	chain, err := core.NewBlockChain(db, cache, config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		utils.Fatalf("Can't create BlockChain: %v", err)
+	}
+	// Stop at the next block on interrupt, keeping the blocks generated so far
+	interrupt := make(chan struct{})
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	go func() {
+		if _, ok := <-sigc; ok {
+			log.Info("Interrupted, stopping at the next block")
+			close(interrupt)
+		}
+	}()
+	start := time.Now()
+	err = gen.generate(chain, engine, ctx.Uint64(simchainBlocksFlag.Name), interrupt)
+	head := chain.CurrentBlock()
+	chain.Stop()
+
+	fmt.Printf("Genesis: %x\n", genesis.Hash())
+	fmt.Printf("Head: #%d [%x]\n", head.NumberU64(), head.Hash())
+	fmt.Printf("Generation done in %v\n", time.Since(start))
+	if err != nil {
+		utils.Fatalf("Generation failed: %v", err)
+	}
+	return nil
+}
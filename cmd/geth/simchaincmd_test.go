@@ -0,0 +1,109 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// generateSimChain generates a simulated chain into a new database, returning
+// the resulting chain along with its generator.
+func generateSimChain(t *testing.T, seed int64, blocks uint64) (*core.BlockChain, *simChainGenerator) {
+	gen, err := newSimChainGenerator(params.ClassicChainConfig, seed, 16, 4, 1, 3)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	db := rawdb.NewMemoryDatabase()
+	if _, err := core.CommitGenesis(gen.genesis(), db); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	engine := ethash.NewFaker()
+	chain, err := core.NewBlockChain(db, nil, params.ClassicChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if err := gen.generate(chain, engine, blocks, nil); err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	return chain, gen
+}
+
+// Tests that simulated chains are derived from their seed alone, and that their
+// blocks are valid and hold the requested transaction mix.
+func TestSimChain(t *testing.T) {
+	chain, gen := generateSimChain(t, 1, 20)
+	defer chain.Stop()
+
+	head := chain.CurrentBlock()
+	if head.NumberU64() != 20 {
+		t.Fatalf("head number mismatch: have %d, want 20", head.NumberU64())
+	}
+	same, _ := generateSimChain(t, 1, 20)
+	defer same.Stop()
+	if same.CurrentBlock().Hash() != head.Hash() {
+		t.Fatal("same seed generated different chains")
+	}
+	other, _ := generateSimChain(t, 2, 20)
+	defer other.Stop()
+	if other.CurrentBlock().Hash() == head.Hash() {
+		t.Fatal("different seeds generated the same chain")
+	}
+	// Import the generated blocks into a fresh chain to validate them
+	var blocks types.Blocks
+	for i := uint64(1); i <= 20; i++ {
+		block := chain.GetBlockByNumber(i)
+		if n := len(block.Transactions()); n != 8 {
+			t.Fatalf("block #%d transaction count mismatch: have %d, want 8", i, n)
+		}
+		blocks = append(blocks, block)
+	}
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gen.genesis())
+	verifier, _ := core.NewBlockChain(db, nil, params.ClassicChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer verifier.Stop()
+	if n, err := verifier.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block #%d: %v", n+1, err)
+	}
+	// Ensure the contracts were deployed and written to
+	if len(gen.contracts) != 20 {
+		t.Fatalf("deployed contract count mismatch: have %d, want 20", len(gen.contracts))
+	}
+	statedb, _ := chain.State()
+	var written int
+	for _, addr := range gen.contracts {
+		if len(statedb.GetCode(addr)) == 0 {
+			t.Fatalf("storage contract %x not deployed", addr)
+		}
+		for slot := int64(0); slot < simStorageSlots; slot++ {
+			if statedb.GetState(addr, common.BigToHash(big.NewInt(slot))) != (common.Hash{}) {
+				written++
+			}
+		}
+	}
+	if written == 0 {
+		t.Fatal("no contract storage written")
+	}
+}
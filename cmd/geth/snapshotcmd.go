@@ -0,0 +1,175 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of core-geth.
+//
+// core-geth is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// core-geth is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with core-geth. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotChunkSizeFlag = cli.IntFlag{
+		Name:  "snapshot.chunksize",
+		Usage: "Amount of uncompressed state data in bytes per chunk of a state dump",
+		Value: snapshot.DefaultStateDumpChunkSize,
+	}
+
+	snapshotCommand = cli.Command{
+		Name:      "snapshot",
+		Usage:     "Export, verify and import flat dumps of the state",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+The snapshot commands operate on flat dumps of the accounts, storage slots and
+contract codes of the state at a given block, used to clone the state of a node
+into new ones. A dump directory holds snappy compressed chunks of the sorted
+state items along with a manifest recording the hash of each chunk and the root
+of the Merkle tree of these hashes, committing to the whole dump.`,
+		Subcommands: []cli.Command{
+			snapshotExportCmd,
+			snapshotVerifyCmd,
+			snapshotImportCmd,
+		},
+	}
+	snapshotExportCmd = cli.Command{
+		Action:    utils.MigrateFlags(snapshotExport),
+		Name:      "export",
+		Usage:     "Export the state of a block into a new dump directory",
+		ArgsUsage: "<dump dir> [<block number|hash>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			snapshotChunkSizeFlag,
+		},
+		Description: `
+The export command writes the state of the given block, the head block by
+default, into the given directory, which must not exist yet or be empty. The
+state of the block must be available in the database, which for blocks other
+than the most recent ones requires an archive node.`,
+	}
+	snapshotVerifyCmd = cli.Command{
+		Action:    utils.MigrateFlags(snapshotVerify),
+		Name:      "verify",
+		Usage:     "Verify the integrity of a state dump",
+		ArgsUsage: "<dump dir>",
+		Description: `
+The verify command checks all the chunks of a state dump against the commitment
+in its manifest. The state root itself is verified when importing the dump.`,
+	}
+	snapshotImportCmd = cli.Command{
+		Action:    utils.MigrateFlags(snapshotImport),
+		Name:      "import",
+		Usage:     "Import a state dump into the chain database",
+		ArgsUsage: "<dump dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.AncientRPCFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The import command rebuilds the state tries of the given dump in the chain
+database, failing if they don't match the state root of the dumped block, and
+writes the state snapshot along with them.
+
+Once imported, the state doesn't need to be downloaded again: as the node syncs
+towards the chain head, only the state trie nodes which changed since the dumped
+block are retrieved from the network, healing the imported state.`,
+	}
+)
+
+func snapshotExport(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 || len(ctx.Args()) > 2 {
+		utils.Fatalf("This command requires a dump directory argument and an optional block.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var header *types.Header
+	switch arg := ctx.Args().Get(1); {
+	case arg == "":
+		if hash := rawdb.ReadHeadBlockHash(db); hash != (common.Hash{}) {
+			if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+				header = rawdb.ReadHeader(db, hash, *number)
+			}
+		}
+	case hashish(arg):
+		hash := common.HexToHash(arg)
+		if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+			header = rawdb.ReadHeader(db, hash, *number)
+		}
+	default:
+		number, err := strconv.ParseUint(arg, 0, 64)
+		if err != nil {
+			utils.Fatalf("Invalid block number %q: %v", arg, err)
+		}
+		header = rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, number), number)
+	}
+	if header == nil {
+		utils.Fatalf("Block not found")
+	}
+	manifest, err := snapshot.ExportState(db, header, ctx.Args().First(), ctx.Int(snapshotChunkSizeFlag.Name))
+	if err != nil {
+		utils.Fatalf("Export failed: %v", err)
+	}
+	fmt.Printf("State exported: block #%d [%x], root %x, %d accounts, %d slots, %d codes in %d chunks\n", manifest.Number, manifest.Hash, manifest.Root, manifest.Accounts, manifest.Slots, manifest.Codes, len(manifest.Chunks))
+	return nil
+}
+
+func snapshotVerify(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a dump directory argument.")
+	}
+	manifest, err := snapshot.VerifyStateDump(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("State dump verification failed: %v", err)
+	}
+	fmt.Printf("State dump verified: block #%d [%x], root %x, commitment %x\n", manifest.Number, manifest.Hash, manifest.Root, manifest.Commitment)
+	return nil
+}
+
+func snapshotImport(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a dump directory argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	manifest, err := snapshot.ImportState(db, ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Import failed: %v", err)
+	}
+	fmt.Printf("State imported: block #%d [%x], root %x, %d accounts, %d slots, %d codes\n", manifest.Number, manifest.Hash, manifest.Root, manifest.Accounts, manifest.Slots, manifest.Codes)
+	return nil
+}
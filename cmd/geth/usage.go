@@ -36,7 +36,24 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.AncientCompressFlag,
+			utils.AncientFileSizeFlag,
+			utils.AncientSyncItemsFlag,
+			utils.DatabaseDirFlag,
+			utils.DataDirPrimaryFlag,
+			utils.DataDirPrimaryCatchupFlag,
+			utils.NodeKeyPathFlag,
+			utils.AncientThresholdFlag,
+			utils.AncientAggressiveFlag,
 			utils.AncientRPCFlag,
+			utils.AncientRPCServeLimitFlag,
+			utils.AncientRPCMirrorFlag,
+			utils.AncientRPCRemoteOnlyFlag,
+			utils.AncientRPCPolicyFlag,
+			utils.AncientRPCFallbackFlag,
+			utils.AncientRPCFallbackTimeoutFlag,
+			utils.IntegrityCheckFlag,
+			utils.IntegrityRepairFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
 			utils.SmartCardDaemonPathFlag,
@@ -54,9 +71,38 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.RopstenFlag,
 			utils.SyncModeFlag,
 			utils.ExitWhenSyncedFlag,
+			utils.HeadWatchEndpointsFlag,
+			utils.HeadWatchIntervalFlag,
+			utils.HeadWatchDepthFlag,
+			utils.HeadWatchChecksFlag,
+			utils.HeadWatchHaltMiningFlag,
+			utils.AlertsWebhooksFlag,
+			utils.AlertsFormatFlag,
+			utils.AlertsTemplateFlag,
+			utils.AlertsNodeFlag,
+			utils.AlertsRateLimitFlag,
+			utils.AlertsReorgDepthFlag,
+			utils.AlertsSyncStallFlag,
+			utils.AlertsMinPeersFlag,
+			utils.ForkMonitorFlag,
+			utils.ForkMonitorIntervalFlag,
+			utils.ForkMonitorDepthFlag,
+			utils.ForkMonitorWarnLengthFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.HistoryRetainFlag,
+			utils.VerifyReceiptsFlag,
+			utils.UncleIndexFlag,
+			utils.ContractIndexFlag,
+			utils.TokenIndexFlag,
+			utils.TrackSupplyFlag,
 			utils.EthStatsURLFlag,
+			utils.FirehoseURLFlag,
+			utils.FirehoseTopicPrefixFlag,
+			utils.FollowLeaderFlag,
+			utils.FollowPollFlag,
+			utils.PluginsDirFlag,
+			utils.PluginsFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
@@ -80,6 +126,10 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Flags: []cli.Flag{
 			utils.DeveloperFlag,
 			utils.DeveloperPeriodFlag,
+			utils.DeveloperPoWFlag,
+			utils.DeveloperClassicFlag,
+			utils.DeveloperMnemonicFlag,
+			utils.DeveloperAccountsFlag,
 		},
 	},
 	{
@@ -109,6 +159,13 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
+			utils.TxPoolArchiveFlag,
+			utils.TxPoolArchiveFileFlag,
+			utils.TxManagerFlag,
+			utils.TxManagerRebroadcastFlag,
+			utils.TxManagerBumpIntervalFlag,
+			utils.TxManagerBumpPercentFlag,
+			utils.TxManagerPriceCapFlag,
 		},
 	},
 	{
@@ -119,9 +176,13 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.CacheTrieFlag,
 			utils.CacheTrieJournalFlag,
 			utils.CacheTrieRejournalFlag,
+			utils.CacheTrieFlushIntervalFlag,
+			utils.CacheTrieFlushBlocksFlag,
+			utils.CacheTrieFlushTimeoutFlag,
 			utils.CacheGCFlag,
 			utils.CacheSnapshotFlag,
 			utils.CacheNoPrefetchFlag,
+			utils.CacheWarmupFlag,
 		},
 	},
 	{
@@ -130,6 +191,10 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.UnlockedAccountFlag,
 			utils.PasswordFileFlag,
 			utils.ExternalSignerFlag,
+			utils.KeyVaultFileFlag,
+			utils.HashicorpVaultAddrFlag,
+			utils.HashicorpVaultPathFlag,
+			utils.HashicorpVaultTokenFileFlag,
 			utils.InsecureUnlockAllowedFlag,
 		},
 	},
@@ -138,6 +203,15 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Flags: []cli.Flag{
 			utils.IPCDisabledFlag,
 			utils.IPCPathFlag,
+			utils.RPCDrainTimeoutFlag,
+			utils.RPCCoalesceFlag,
+			utils.RPCArchiveMethodsFlag,
+			utils.RPCArchiveDepthFlag,
+			utils.RPCArchiveWorkersFlag,
+			utils.RPCArchiveQueueFlag,
+			utils.RPCHeadWorkersFlag,
+			utils.RPCHeadQueueFlag,
+			utils.RPCSlowThresholdFlag,
 			utils.HTTPEnabledFlag,
 			utils.HTTPListenAddrFlag,
 			utils.HTTPPortFlag,
@@ -149,11 +223,25 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.WSPortFlag,
 			utils.WSApiFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.WSMaxSubscriptionsFlag,
+			utils.WSMaxTotalSubscriptionsFlag,
 			utils.GraphQLEnabledFlag,
 			utils.GraphQLCORSDomainFlag,
 			utils.GraphQLVirtualHostsFlag,
+			utils.ExplorerEnabledFlag,
+			utils.GRPCEnabledFlag,
+			utils.GRPCListenAddrFlag,
+			utils.GRPCPortFlag,
 			utils.RPCGlobalGasCap,
 			utils.RPCGlobalTxFeeCap,
+			utils.RPCGlobalLogsRangeCap,
+			utils.RPCErrorCodesFlag,
+			utils.TraceRegenerateFlag,
+			utils.RPCCacheSizeFlag,
+			utils.RPCCacheTTLFlag,
+			utils.RPCFilterTimeoutFlag,
+			utils.RPCFilterPersistFlag,
+			utils.RPCResumeWindowFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -175,6 +263,17 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.NetrestrictFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
+			utils.WitnessFlag,
+			utils.WitnessCacheFlag,
+			utils.P2PRecordFlag,
+			utils.P2PRecordPayloadsFlag,
+			utils.PropagationMinPeersFlag,
+			utils.PropagationMaxPeersFlag,
+			utils.PropagationMinedAllFlag,
+			utils.StateServeLimitFlag,
+			utils.NTPServersFlag,
+			utils.NTPIntervalFlag,
+			utils.NTPThresholdFlag,
 		},
 	},
 	{
@@ -187,9 +286,11 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerGasTargetFlag,
 			utils.MinerGasLimitFlag,
 			utils.MinerEtherbaseFlag,
+			utils.MinerEtherbasePathFlag,
 			utils.MinerExtraDataFlag,
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerNoVerfiyFlag,
+			utils.MinerClockGuardFlag,
 		},
 	},
 	{
@@ -204,6 +305,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Flags: []cli.Flag{
 			utils.VMEnableDebugFlag,
 			utils.EVMInterpreterFlag,
+			utils.VMStatsFlag,
 			utils.EWASMInterpreterFlag,
 		},
 	},
@@ -245,6 +347,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Name: "MISC",
 		Flags: []cli.Flag{
 			utils.SnapshotFlag,
+			utils.SnapshotNoReadsFlag,
+			utils.SnapshotAuditFlag,
 			cli.HelpFlag,
 		},
 	},
@@ -33,6 +33,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/vault"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/fdlimit"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -43,11 +44,20 @@ import (
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/alerts"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/forkmon"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/headwatch"
+	"github.com/ethereum/go-ethereum/eth/txmgr"
+	"github.com/ethereum/go-ethereum/eth/wit"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethstats"
+	"github.com/ethereum/go-ethereum/explorer"
+	"github.com/ethereum/go-ethereum/firehose"
+	"github.com/ethereum/go-ethereum/follower"
 	"github.com/ethereum/go-ethereum/graphql"
+	"github.com/ethereum/go-ethereum/grpcapi"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/les"
@@ -55,6 +65,7 @@ import (
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/metrics/exp"
 	"github.com/ethereum/go-ethereum/metrics/influxdb"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -62,9 +73,11 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/p2p/ntp"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/plugins"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 	pcsclite "github.com/gballet/go-libpcsclite"
 	cli "gopkg.in/urfave/cli.v1"
@@ -116,11 +129,82 @@ var (
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	AncientCompressFlag = cli.StringFlag{
+		Name:  "datadir.ancient.compress",
+		Usage: "Comma separated list of the ancient tables to snappy-compress when created, converted by 'geth db recompress' (default = headers,bodies,receipts)",
+	}
+	AncientFileSizeFlag = cli.StringFlag{
+		Name:  "datadir.ancient.filesize",
+		Usage: "Maximum size in bytes of the ancient data files, for all tables and/or per table, e.g. 1000000000,bodies=4000000000 (default = 2000000000)",
+	}
+	AncientSyncItemsFlag = cli.Uint64Flag{
+		Name:  "datadir.ancient.syncitems",
+		Usage: "Number of items appended to an ancient table after which it is flushed to disk (0 = after each freezing batch)",
+	}
+	DatabaseDirFlag = DirectoryFlag{
+		Name:  "datadir.db",
+		Usage: "Data directory for the key-value databases (default = inside the datadir)",
+	}
+	DataDirPrimaryFlag = DirectoryFlag{
+		Name:  "datadir.primary",
+		Usage: "Data directory of another node whose chain database to follow read-only, as a secondary instance without networking (head state only available if the primary runs with --gcmode=archive, transactions can't be sent)",
+	}
+	DataDirPrimaryCatchupFlag = cli.DurationFlag{
+		Name:  "datadir.primary.catchup",
+		Usage: "Interval between two catch-ups of a secondary instance with the writes of the primary node",
+		Value: rawdb.DefaultSecondaryCatchup,
+	}
+	NodeKeyPathFlag = cli.StringFlag{
+		Name:  "datadir.nodekey",
+		Usage: "File to keep the persistent node key in, generated there if missing unlike --nodekey (default = inside the datadir)",
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "ancient.threshold",
+		Usage: "Number of recent blocks kept in the key-value store rather than moved into the ancient store (default = 90000, or 128 with --ancient.aggressive)",
+	}
+	AncientAggressiveFlag = cli.BoolFlag{
+		Name:  "ancient.aggressive",
+		Usage: "Move blocks into the ancient store as soon as they pass the threshold, checking every few seconds instead of every minute",
+	}
 	AncientRPCFlag = cli.StringFlag{
 		Name:  "ancient.rpc",
 		Usage: "Connect to a remote freezer via RPC. Value must an HTTP(S), WS(S), unix socket, or 'stdio' URL. Incompatible with --datadir.ancient",
 		Value: "",
 	}
+	AncientRPCServeLimitFlag = cli.Uint64Flag{
+		Name:  "ancient.rpc.servelimit",
+		Usage: "Bytes per second of ancient block bodies and receipts served to each peer from the remote freezer (0 = unlimited)",
+		Value: eth.DefaultConfig.AncientServeLimit,
+	}
+	AncientRPCMirrorFlag = cli.Uint64Flag{
+		Name:  "ancient.rpc.mirror",
+		Usage: "Number of most recent blocks of the remote freezer mirrored in the local database",
+	}
+	AncientRPCRemoteOnlyFlag = cli.Uint64Flag{
+		Name:  "ancient.rpc.remoteonly",
+		Usage: "Number of the first block of the remote freezer eligible for local mirroring, older ones staying remote only",
+	}
+	AncientRPCPolicyFlag = cli.StringFlag{
+		Name:  "ancient.rpc.policy",
+		Usage: "JSON file of the remote freezer tiering policy, overriding --ancient.rpc.mirror and --ancient.rpc.remoteonly and reloadable via admin_reloadAncientTiering",
+	}
+	AncientRPCFallbackFlag = cli.BoolFlag{
+		Name:  "ancient.rpc.fallback",
+		Usage: "Retrieve the historical headers, bodies and receipts the remote freezer fails to serve to local and RPC reads from the peers, verified against the canonical hash",
+	}
+	AncientRPCFallbackTimeoutFlag = cli.DurationFlag{
+		Name:  "ancient.rpc.fallback.timeout",
+		Usage: "Time a remote freezer read may take before falling back to the peers (0 = unlimited)",
+		Value: eth.DefaultConfig.AncientFallbackTimeout,
+	}
+	IntegrityCheckFlag = cli.Uint64Flag{
+		Name:  "integrity.check",
+		Usage: "Number of recent blocks whose linkage to verify on startup, along with the head markers and freezer boundary (0 = disabled)",
+	}
+	IntegrityRepairFlag = cli.BoolFlag{
+		Name:  "integrity.repair",
+		Usage: "Rewind the chain to the last consistent block if the startup integrity check fails, instead of refusing to start",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -187,6 +271,23 @@ var (
 		Name:  "dev.period",
 		Usage: "Block period to use in developer mode (0 = mine only if transaction pending)",
 	}
+	DeveloperPoWFlag = cli.BoolFlag{
+		Name:  "dev.pow",
+		Usage: "Seal developer blocks with a faked proof-of-work, enabling the evm_ test APIs",
+	}
+	DeveloperClassicFlag = cli.BoolFlag{
+		Name:  "dev.classic",
+		Usage: "Use the Ethereum Classic rules and ECIP-1017 monetary policy in developer mode (implies --dev.pow)",
+	}
+	DeveloperMnemonicFlag = cli.StringFlag{
+		Name:  "dev.mnemonic",
+		Usage: "BIP-39 mnemonic to derive pre-funded developer accounts from (m/44'/60'/0'/0/i)",
+	}
+	DeveloperAccountsFlag = cli.IntFlag{
+		Name:  "dev.accounts",
+		Usage: "Number of developer accounts derived from the mnemonic",
+		Value: 10,
+	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
 		Usage: "Custom node name",
@@ -200,6 +301,85 @@ var (
 		Name:  "exitwhensynced",
 		Usage: "Exits after block synchronisation completes",
 	}
+	HeadWatchEndpointsFlag = cli.StringFlag{
+		Name:  "headwatch.endpoints",
+		Usage: "Comma separated RPC endpoints of reference nodes to compare the chain head against, reporting the health on /health of the HTTP-RPC server",
+	}
+	HeadWatchIntervalFlag = cli.DurationFlag{
+		Name:  "headwatch.interval",
+		Usage: "Interval between two comparisons of the chain head against the reference nodes",
+		Value: eth.DefaultConfig.HeadWatch.Interval,
+	}
+	HeadWatchDepthFlag = cli.Uint64Flag{
+		Name:  "headwatch.depth",
+		Usage: "Number of blocks the chain may diverge from the reference nodes by",
+		Value: eth.DefaultConfig.HeadWatch.Depth,
+	}
+	HeadWatchChecksFlag = cli.IntFlag{
+		Name:  "headwatch.checks",
+		Usage: "Number of consecutive diverged comparisons marking the node unhealthy",
+		Value: eth.DefaultConfig.HeadWatch.Checks,
+	}
+	HeadWatchHaltMiningFlag = cli.BoolFlag{
+		Name:  "headwatch.haltmining",
+		Usage: "Stops block production when the node is marked unhealthy",
+	}
+	AlertsWebhooksFlag = cli.StringFlag{
+		Name:  "alerts.webhooks",
+		Usage: "Comma separated webhook URLs to post critical node events to (deep reorgs, sync stalls, low peer count, database corruption, remote freezer outages)",
+	}
+	AlertsFormatFlag = cli.StringFlag{
+		Name:  "alerts.format",
+		Usage: `Payload format of the alert webhooks ("json" or "slack")`,
+		Value: eth.DefaultConfig.Alerts.Format,
+	}
+	AlertsTemplateFlag = cli.StringFlag{
+		Name:  "alerts.template",
+		Usage: "Path of a Go text/template file rendering the alert payloads, overriding the format",
+	}
+	AlertsNodeFlag = cli.StringFlag{
+		Name:  "alerts.node",
+		Usage: "Name of the node in the alerts (default: host name)",
+	}
+	AlertsRateLimitFlag = cli.DurationFlag{
+		Name:  "alerts.ratelimit",
+		Usage: "Minimum time between two alerts of the same kind",
+		Value: eth.DefaultConfig.Alerts.RateLimit,
+	}
+	AlertsReorgDepthFlag = cli.Uint64Flag{
+		Name:  "alerts.reorgdepth",
+		Usage: "Number of blocks dropped by a reorg to raise an alert (0 = disabled)",
+		Value: eth.DefaultConfig.Alerts.ReorgDepth,
+	}
+	AlertsSyncStallFlag = cli.DurationFlag{
+		Name:  "alerts.syncstall",
+		Usage: "Time without sync progress to raise an alert (0 = disabled)",
+		Value: eth.DefaultConfig.Alerts.SyncStall,
+	}
+	AlertsMinPeersFlag = cli.IntFlag{
+		Name:  "alerts.minpeers",
+		Usage: "Peer count below which to raise an alert (0 = disabled)",
+		Value: eth.DefaultConfig.Alerts.MinPeers,
+	}
+	ForkMonitorFlag = cli.BoolFlag{
+		Name:  "forkmon",
+		Usage: "Monitor the branches of the chain advertised by the peers, exposed by debug_forkView and in metrics",
+	}
+	ForkMonitorIntervalFlag = cli.DurationFlag{
+		Name:  "forkmon.interval",
+		Usage: "Interval between two samplings of the peer heads",
+		Value: eth.DefaultConfig.ForkMonitor.Interval,
+	}
+	ForkMonitorDepthFlag = cli.Uint64Flag{
+		Name:  "forkmon.depth",
+		Usage: "Maximum number of blocks to trace a forked branch back to its fork point",
+		Value: eth.DefaultConfig.ForkMonitor.Depth,
+	}
+	ForkMonitorWarnLengthFlag = cli.Uint64Flag{
+		Name:  "forkmon.warnlength",
+		Usage: "Number of blocks of a forked branch beyond its fork point to warn about it",
+		Value: eth.DefaultConfig.ForkMonitor.WarnLength,
+	}
 	IterativeOutputFlag = cli.BoolFlag{
 		Name:  "iterative",
 		Usage: "Print streaming JSON iteratively, delimited by newlines",
@@ -231,11 +411,44 @@ var (
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode -- experimental work in progress feature`,
 	}
+	SnapshotNoReadsFlag = cli.BoolFlag{
+		Name:  "snapshot.noreads",
+		Usage: "Serve the RPC state reads from the trie, using the snapshot for block processing only",
+	}
+	SnapshotAuditFlag = cli.Float64Flag{
+		Name:  "snapshot.audit",
+		Usage: "Fraction of the RPC state reads served from the snapshot to check against the trie, logging mismatches (0 = disabled)",
+	}
 	TxLookupLimitFlag = cli.Int64Flag{
 		Name:  "txlookuplimit",
 		Usage: "Number of recent blocks to maintain transactions index by-hash for (default = index all blocks)",
 		Value: 0,
 	}
+	HistoryRetainFlag = cli.Uint64Flag{
+		Name:  "history.retain",
+		Usage: "Number of recent blocks to retain the bodies and receipts of, pruning older ones while keeping all headers (default = retain all blocks)",
+		Value: 0,
+	}
+	VerifyReceiptsFlag = cli.BoolFlag{
+		Name:  "sync.verifyreceipts",
+		Usage: "Verify the receipts downloaded by fast sync against the receipt roots and log blooms of their blocks in the background, once synced",
+	}
+	UncleIndexFlag = cli.BoolFlag{
+		Name:  "uncleindex",
+		Usage: "Maintain an index of the included uncles by miner, for fast eth_getUnclesByMiner lookups",
+	}
+	ContractIndexFlag = cli.BoolFlag{
+		Name:  "contractindex",
+		Usage: "Maintain an index of the deployed contracts by address and code hash, for eth_getContractCreation and debug_getAddressesByCodeHash",
+	}
+	TokenIndexFlag = cli.BoolFlag{
+		Name:  "tokenindex",
+		Usage: "Maintain an index of the ERC-20 and ERC-721 token transfers, enabling the token RPC namespace",
+	}
+	TrackSupplyFlag = cli.BoolFlag{
+		Name:  "tracksupply",
+		Usage: "Track the circulating supply and the balance changes at every imported block, for eth_getSupply and debug_getBalanceHistory (requires full sync from genesis)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -375,6 +588,40 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: eth.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolArchiveFlag = cli.IntFlag{
+		Name:  "txpool.archive",
+		Usage: "Maximum number of transactions dropped without inclusion to archive for inspection (0 = disabled)",
+		Value: eth.DefaultConfig.TxPool.ArchiveLimit,
+	}
+	TxPoolArchiveFileFlag = cli.StringFlag{
+		Name:  "txpool.archivefile",
+		Usage: "Disk file for the archive of dropped transactions to survive node restarts",
+		Value: core.DefaultTxPoolConfig.ArchiveFile,
+	}
+	// Local transaction manager settings
+	TxManagerFlag = cli.BoolFlag{
+		Name:  "txmgr",
+		Usage: "Track, rebroadcast and optionally reprice transactions submitted through this node",
+	}
+	TxManagerRebroadcastFlag = cli.DurationFlag{
+		Name:  "txmgr.rebroadcast",
+		Usage: "Interval between rebroadcasts of pending local transactions",
+		Value: eth.DefaultConfig.TxManager.Rebroadcast,
+	}
+	TxManagerBumpIntervalFlag = cli.DurationFlag{
+		Name:  "txmgr.bumpinterval",
+		Usage: "Time after which a pending local transaction is resubmitted with a higher gas price (0 = never)",
+		Value: eth.DefaultConfig.TxManager.BumpInterval,
+	}
+	TxManagerBumpPercentFlag = cli.Uint64Flag{
+		Name:  "txmgr.bumppercent",
+		Usage: "Percentage to raise the gas price of a pending local transaction with on each bump",
+		Value: eth.DefaultConfig.TxManager.BumpPercent,
+	}
+	TxManagerPriceCapFlag = BigFlag{
+		Name:  "txmgr.pricecap",
+		Usage: "Gas price a local transaction is never bumped over (unset = no bumping)",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -401,6 +648,21 @@ var (
 		Usage: "Time interval to regenerate the trie cache journal",
 		Value: eth.DefaultConfig.TrieCleanCacheRejournal,
 	}
+	CacheTrieFlushIntervalFlag = cli.DurationFlag{
+		Name:  "cache.trie.flushinterval",
+		Usage: "Block processing time after which to flush the in-memory state to disk",
+		Value: eth.DefaultConfig.TrieTimeout,
+	}
+	CacheTrieFlushBlocksFlag = cli.Uint64Flag{
+		Name:  "cache.trie.flushblocks",
+		Usage: "Number of blocks after which to flush the in-memory state to disk (0 = no limit)",
+		Value: eth.DefaultConfig.TrieFlushBlocks,
+	}
+	CacheTrieFlushTimeoutFlag = cli.DurationFlag{
+		Name:  "cache.trie.flushtimeout",
+		Usage: "Time limit on shutdown for flushing the cached state, past which only the head state is written (0 = no limit)",
+		Value: eth.DefaultConfig.TrieFlushTimeout,
+	}
 	CacheGCFlag = cli.IntFlag{
 		Name:  "cache.gc",
 		Usage: "Percentage of cache memory allowance to use for trie pruning (default = 25% full mode, 0% archive mode)",
@@ -415,6 +677,10 @@ var (
 		Name:  "cache.noprefetch",
 		Usage: "Disable heuristic state prefetch during block import (less CPU and disk IO, more time waiting for data)",
 	}
+	CacheWarmupFlag = cli.BoolFlag{
+		Name:  "cache.warmup",
+		Usage: "Preload recent blocks, the state trie around the head and recently accessed accounts into the caches after startup",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -449,6 +715,10 @@ var (
 		Usage: "Public address for block mining rewards (default = first account)",
 		Value: "0",
 	}
+	MinerEtherbasePathFlag = cli.StringFlag{
+		Name:  "miner.etherbase.path",
+		Usage: "HD derivation path of the etherbase account on the first hardware wallet opened (e.g. m/44'/60'/0'/0/0)",
+	}
 	MinerExtraDataFlag = cli.StringFlag{
 		Name:  "miner.extradata",
 		Usage: "Block extra data set by the miner (default = client version)",
@@ -462,6 +732,10 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerClockGuardFlag = cli.BoolFlag{
+		Name:  "miner.clockguard",
+		Usage: "Refuse to seal blocks while the system clock drifts more than --ntp.threshold (requires --ntp.servers)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -478,6 +752,22 @@ var (
 		Usage: "External signer (url or path to ipc file)",
 		Value: "",
 	}
+	KeyVaultFileFlag = cli.StringFlag{
+		Name:  "vault.file",
+		Usage: "Encrypted single-file key vault to load accounts from, in addition to the keystore",
+	}
+	HashicorpVaultAddrFlag = cli.StringFlag{
+		Name:  "vault.hashicorp.addr",
+		Usage: "HashiCorp Vault server address to load a signing key (e.g. for the etherbase) from",
+	}
+	HashicorpVaultPathFlag = cli.StringFlag{
+		Name:  "vault.hashicorp.path",
+		Usage: "Path of the HashiCorp Vault secret holding the signing key (e.g. secret/data/geth/etherbase)",
+	}
+	HashicorpVaultTokenFileFlag = cli.StringFlag{
+		Name:  "vault.hashicorp.tokenfile",
+		Usage: "File containing the HashiCorp Vault access token (default = $VAULT_TOKEN)",
+	}
 	VMEnableDebugFlag = cli.BoolFlag{
 		Name:  "vmdebug",
 		Usage: "Record information useful for VM and contract debugging",
@@ -486,6 +776,50 @@ var (
 		Name:  "allow-insecure-unlock",
 		Usage: "Allow insecure account unlocking when account-related RPCs are exposed by http",
 	}
+	RPCDrainTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.draintimeout",
+		Usage: "Time limit on shutdown for the RPC calls in flight to complete",
+		Value: node.DefaultConfig.RPCDrainTimeout,
+	}
+	RPCCoalesceFlag = cli.StringFlag{
+		Name:  "rpc.coalesce",
+		Usage: "Comma separated list of read-only methods whose identical concurrent calls over HTTP and WebSocket are executed once (empty = disabled)",
+		Value: strings.Join(node.DefaultConfig.RPCCoalesce, ","),
+	}
+	RPCArchiveMethodsFlag = cli.StringFlag{
+		Name:  "rpc.archive.methods",
+		Usage: "Comma separated list of methods whose HTTP and WebSocket calls are archive work, a trailing * matching any suffix",
+		Value: strings.Join(node.DefaultConfig.RPCScheduler.ArchiveMethods, ","),
+	}
+	RPCArchiveDepthFlag = cli.Uint64Flag{
+		Name:  "rpc.archive.depth",
+		Usage: "Number of blocks below the head past which calls on a block, or log queries from one, are archive work (0 = by method only)",
+		Value: node.DefaultConfig.RPCScheduler.ArchiveDepth,
+	}
+	RPCArchiveWorkersFlag = cli.IntFlag{
+		Name:  "rpc.archive.workers",
+		Usage: "Maximum number of archive calls running at once (0 = unlimited)",
+		Value: node.DefaultConfig.RPCScheduler.ArchiveWorkers,
+	}
+	RPCArchiveQueueFlag = cli.IntFlag{
+		Name:  "rpc.archive.queue",
+		Usage: "Maximum number of archive calls waiting for a worker, others being refused (0 = unlimited)",
+		Value: node.DefaultConfig.RPCScheduler.ArchiveQueue,
+	}
+	RPCHeadWorkersFlag = cli.IntFlag{
+		Name:  "rpc.head.workers",
+		Usage: "Maximum number of head calls running at once (0 = unlimited)",
+		Value: node.DefaultConfig.RPCScheduler.HeadWorkers,
+	}
+	RPCHeadQueueFlag = cli.IntFlag{
+		Name:  "rpc.head.queue",
+		Usage: "Maximum number of head calls waiting for a worker, others being refused (0 = unlimited)",
+		Value: node.DefaultConfig.RPCScheduler.HeadQueue,
+	}
+	RPCSlowThresholdFlag = cli.DurationFlag{
+		Name:  "rpc.slowthreshold",
+		Usage: "Duration above which served RPC calls are logged with their method and parameter count (0 = disabled)",
+	}
 	RPCGlobalGasCap = cli.Uint64Flag{
 		Name:  "rpc.gascap",
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas (0=infinite)",
@@ -496,11 +830,74 @@ var (
 		Usage: "Sets a cap on transaction fee (in ether) that can be sent via the RPC APIs (0 = no cap)",
 		Value: eth.DefaultConfig.RPCTxFeeCap,
 	}
+	RPCGlobalLogsRangeCap = cli.Uint64Flag{
+		Name:  "rpc.logsrangecap",
+		Usage: "Sets a cap on the number of blocks a log query can span (0 = no cap)",
+		Value: eth.DefaultConfig.RPCLogsRangeCap,
+	}
+	RPCErrorCodesFlag = cli.BoolFlag{
+		Name:  "rpc.errorcodes",
+		Usage: "Return canonical error codes and machine-readable error data from the eth, debug and txpool APIs",
+	}
+	TraceRegenerateFlag = cli.Uint64Flag{
+		Name:  "trace.regenerate",
+		Usage: "Number of blocks the tracers may reexecute to regenerate a pruned historical state beyond their reexec limit, retaining it for subsequent traces (0 = disabled)",
+	}
+	RPCCacheSizeFlag = cli.IntFlag{
+		Name:  "rpc.cache",
+		Usage: "Number of responses of historical eth queries (old blocks by number, receipts, chain ID) to cache (0 = disabled)",
+		Value: eth.DefaultConfig.RPCCacheSize,
+	}
+	RPCCacheTTLFlag = cli.DurationFlag{
+		Name:  "rpc.cachettl",
+		Usage: "Time after which cached RPC responses expire",
+		Value: eth.DefaultConfig.RPCCacheTTL,
+	}
+	RPCFilterTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.filtertimeout",
+		Usage: "Time after which the filters not polled via eth_getFilterChanges are uninstalled",
+		Value: eth.DefaultConfig.Filters.Timeout,
+	}
+	RPCFilterPersistFlag = cli.BoolFlag{
+		Name:  "rpc.filterpersist",
+		Usage: "Persist the installed log and block filters across restarts",
+	}
+	RPCResumeWindowFlag = cli.Uint64Flag{
+		Name:  "rpc.resumewindow",
+		Usage: "Maximum number of blocks replayed to the newHeads and logs subscriptions resumed from a cursor",
+		Value: eth.DefaultConfig.Filters.ResumeWindow,
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
 		Usage: "Reporting URL of a ethstats service (nodename:secret@host:port)",
 	}
+	FirehoseURLFlag = cli.StringFlag{
+		Name:  "firehose.url",
+		Usage: "Broker URL to stream chain events to (kafka://host:port[,host:port...], nats://host:port, or tls://host:port for NATS over TLS)",
+	}
+	FirehoseTopicPrefixFlag = cli.StringFlag{
+		Name:  "firehose.topicprefix",
+		Usage: "Prefix of the topics chain events are streamed to",
+		Value: firehose.DefaultConfig.TopicPrefix,
+	}
+	FollowLeaderFlag = cli.StringFlag{
+		Name:  "follow",
+		Usage: "RPC endpoint of a leader node to replicate the chain from, disabling p2p networking (ws:// or ipc preferred)",
+	}
+	FollowPollFlag = cli.DurationFlag{
+		Name:  "follow.poll",
+		Usage: "Interval between polls of the leader head if it doesn't support subscriptions",
+		Value: follower.DefaultConfig.Poll,
+	}
+	PluginsDirFlag = DirectoryFlag{
+		Name:  "plugins.dir",
+		Usage: "Directory to load Go plugins (*.so) from",
+	}
+	PluginsFlag = cli.StringFlag{
+		Name:  "plugins",
+		Usage: "Comma separated list of plugins to enable (default = all available)",
+	}
 	FakePoWFlag = cli.BoolFlag{
 		Name:  "fakepow",
 		Usage: "Disables proof-of-work verification",
@@ -561,6 +958,24 @@ var (
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
 		Value: strings.Join(node.DefaultConfig.GraphQLVirtualHosts, ","),
 	}
+	ExplorerEnabledFlag = cli.BoolFlag{
+		Name:  "explorer",
+		Usage: "Enable the block explorer web UI at /explorer on the HTTP-RPC server. Note that the explorer can only be started if an HTTP server is started as well.",
+	}
+	GRPCEnabledFlag = cli.BoolFlag{
+		Name:  "grpc",
+		Usage: "Enable the gRPC server streaming blocks and receipts and serving state reads",
+	}
+	GRPCListenAddrFlag = cli.StringFlag{
+		Name:  "grpc.addr",
+		Usage: "gRPC server listening interface",
+		Value: node.DefaultHTTPHost,
+	}
+	GRPCPortFlag = cli.IntFlag{
+		Name:  "grpc.port",
+		Usage: "gRPC server listening port",
+		Value: grpcapi.DefaultConfig.Port,
+	}
 	WSEnabledFlag = cli.BoolFlag{
 		Name:  "ws",
 		Usage: "Enable the WS-RPC server",
@@ -585,6 +1000,14 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	WSMaxSubscriptionsFlag = cli.IntFlag{
+		Name:  "ws.maxsubs",
+		Usage: "Maximum number of subscriptions of a single WS-RPC connection (0 = unlimited)",
+	}
+	WSMaxTotalSubscriptionsFlag = cli.IntFlag{
+		Name:  "ws.maxsubs.total",
+		Usage: "Maximum number of subscriptions of all WS-RPC connections together (0 = unlimited)",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -644,6 +1067,53 @@ var (
 		Name:  "discovery.dns",
 		Usage: "Sets DNS discovery entry points (use \"\" to disable DNS)",
 	}
+	WitnessFlag = cli.BoolFlag{
+		Name:  "wit",
+		Usage: "Generate block execution witnesses on import and serve them over the wit protocol (experimental)",
+	}
+	WitnessCacheFlag = cli.IntFlag{
+		Name:  "wit.cache",
+		Usage: "Number of recent block witnesses to keep for serving",
+		Value: eth.DefaultConfig.Witness.Cache,
+	}
+	P2PRecordFlag = DirectoryFlag{
+		Name:  "p2p.record",
+		Usage: "Directory to record the eth protocol messages exchanged with each peer into",
+	}
+	P2PRecordPayloadsFlag = cli.BoolFlag{
+		Name:  "p2p.record.payloads",
+		Usage: "Include the message payloads in the p2p recordings (required for replaying them)",
+	}
+	PropagationMinPeersFlag = cli.IntFlag{
+		Name:  "propagation.minpeers",
+		Usage: "Minimum number of peers to send new blocks in full to, instead of only announcing them",
+	}
+	PropagationMaxPeersFlag = cli.IntFlag{
+		Name:  "propagation.maxpeers",
+		Usage: "Maximum number of peers to send new blocks in full to (0 = unlimited)",
+	}
+	PropagationMinedAllFlag = cli.BoolFlag{
+		Name:  "propagation.minedall",
+		Usage: "Send locally mined blocks in full to all peers, instead of announcing them to most",
+	}
+	StateServeLimitFlag = cli.Uint64Flag{
+		Name:  "serve.state.limit",
+		Usage: "Bytes per second of state data served to all syncing peers together (0 = unlimited)",
+	}
+	NTPServersFlag = cli.StringFlag{
+		Name:  "ntp.servers",
+		Usage: "Comma separated NTP servers to monitor the system clock drift against (e.g. pool.ntp.org)",
+	}
+	NTPIntervalFlag = cli.DurationFlag{
+		Name:  "ntp.interval",
+		Usage: "Time between system clock drift measurements",
+		Value: ntp.DefaultInterval,
+	}
+	NTPThresholdFlag = cli.DurationFlag{
+		Name:  "ntp.threshold",
+		Usage: "System clock drift to warn about",
+		Value: ntp.DefaultThreshold,
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -739,6 +1209,40 @@ var (
 		Usage: "Comma-separated InfluxDB tags (key/values) attached to all measurements",
 		Value: "host=localhost",
 	}
+	MetricsEnableInfluxDBV2Flag = cli.BoolFlag{
+		Name:  "metrics.influxdbv2",
+		Usage: "Enable metrics export/push to an external InfluxDB v2 database",
+	}
+	MetricsInfluxDBTokenFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.token",
+		Usage: "Token to authorize access to the database (v2 only)",
+	}
+	MetricsInfluxDBBucketFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.bucket",
+		Usage: "InfluxDB bucket name to push reported metrics to (v2 only)",
+		Value: "geth",
+	}
+	MetricsInfluxDBOrganizationFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.organization",
+		Usage: "InfluxDB organization name (v2 only)",
+		Value: "geth",
+	}
+	// The pushgateway lets nodes which can't be scraped, e.g. behind a NAT, push their
+	// metrics to Prometheus. The metrics of a node are grouped by the job and the labels,
+	// so every node pushing to the same gateway needs a distinct `instance` label.
+	MetricsPushGatewayFlag = cli.StringFlag{
+		Name:  "metrics.pushgateway",
+		Usage: "Prometheus pushgateway URL to push metrics to",
+	}
+	MetricsPushGatewayJobFlag = cli.StringFlag{
+		Name:  "metrics.pushgateway.job",
+		Usage: "Prometheus pushgateway job name to group the pushed metrics under",
+		Value: "geth",
+	}
+	MetricsPushGatewayLabelsFlag = cli.StringFlag{
+		Name:  "metrics.pushgateway.labels",
+		Usage: "Comma-separated Prometheus pushgateway labels (key/values) grouping the pushed metrics (default: instance=<hostname>)",
+	}
 	EWASMInterpreterFlag = cli.StringFlag{
 		Name:  "vm.ewasm",
 		Usage: "External ewasm configuration (default = built-in interpreter)",
@@ -749,6 +1253,10 @@ var (
 		Usage: "External EVM configuration (default = built-in interpreter)",
 		Value: "",
 	}
+	VMStatsFlag = cli.BoolFlag{
+		Name:  "vm.stats",
+		Usage: "Collect per-opcode execution counts and gas of the imported blocks (built-in interpreter only)",
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -916,6 +1424,20 @@ func setNAT(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setNTP creates the system clock drift monitoring settings from the command
+// line flags.
+func setNTP(ctx *cli.Context, cfg *p2p.Config) {
+	if ctx.GlobalIsSet(NTPServersFlag.Name) {
+		cfg.NTPServers = splitAndTrim(ctx.GlobalString(NTPServersFlag.Name))
+	}
+	if ctx.GlobalIsSet(NTPIntervalFlag.Name) {
+		cfg.NTPInterval = ctx.GlobalDuration(NTPIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(NTPThresholdFlag.Name) {
+		cfg.NTPThreshold = ctx.GlobalDuration(NTPThresholdFlag.Name)
+	}
+}
+
 // splitAndTrim splits input separated by a comma
 // and trims excessive white space from the substrings.
 func splitAndTrim(input string) (ret []string) {
@@ -1027,6 +1549,12 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(WSApiFlag.Name) {
 		cfg.WSModules = splitAndTrim(ctx.GlobalString(WSApiFlag.Name))
 	}
+	if ctx.GlobalIsSet(WSMaxSubscriptionsFlag.Name) {
+		cfg.WSMaxSubscriptions = ctx.GlobalInt(WSMaxSubscriptionsFlag.Name)
+	}
+	if ctx.GlobalIsSet(WSMaxTotalSubscriptionsFlag.Name) {
+		cfg.WSMaxTotalSubscriptions = ctx.GlobalInt(WSMaxTotalSubscriptionsFlag.Name)
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1168,6 +1696,7 @@ func MakePasswordList(ctx *cli.Context) []string {
 func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	setNodeKey(ctx, cfg)
 	setNAT(ctx, cfg)
+	setNTP(ctx, cfg)
 	setListenAddress(ctx, cfg)
 	setBootstrapNodes(ctx, cfg)
 	setBootstrapNodesV5(ctx, cfg)
@@ -1238,6 +1767,13 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.NoDiscovery = true
 		cfg.DiscoveryV5 = false
 	}
+	if ctx.GlobalIsSet(FollowLeaderFlag.Name) {
+		// Followers replicate the leader chain only, without p2p exposure.
+		cfg.MaxPeers = 0
+		cfg.ListenAddr = ""
+		cfg.NoDiscovery = true
+		cfg.DiscoveryV5 = false
+	}
 }
 
 // SetNodeConfig applies node-related command line flags to the config.
@@ -1254,10 +1790,44 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
 		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
 	}
+	if ctx.GlobalIsSet(KeyVaultFileFlag.Name) {
+		cfg.KeyVaultFile = ctx.GlobalString(KeyVaultFileFlag.Name)
+	}
+	if ctx.GlobalIsSet(HashicorpVaultAddrFlag.Name) || ctx.GlobalIsSet(HashicorpVaultPathFlag.Name) {
+		if cfg.HashicorpVault == nil {
+			cfg.HashicorpVault = new(vault.HashicorpConfig)
+		}
+		if ctx.GlobalIsSet(HashicorpVaultAddrFlag.Name) {
+			cfg.HashicorpVault.Address = ctx.GlobalString(HashicorpVaultAddrFlag.Name)
+		}
+		if ctx.GlobalIsSet(HashicorpVaultPathFlag.Name) {
+			cfg.HashicorpVault.Path = ctx.GlobalString(HashicorpVaultPathFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(HashicorpVaultTokenFileFlag.Name) && cfg.HashicorpVault != nil {
+		cfg.HashicorpVault.TokenFile = ctx.GlobalString(HashicorpVaultTokenFileFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
+	if ctx.GlobalIsSet(DatabaseDirFlag.Name) {
+		cfg.DatabaseDir = ctx.GlobalString(DatabaseDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(NodeKeyPathFlag.Name) {
+		CheckExclusive(ctx, NodeKeyPathFlag, NodeKeyFileFlag, NodeKeyHexFlag)
+		cfg.NodeKeyFile = expandPath(ctx.GlobalString(NodeKeyPathFlag.Name))
+	}
+	if ctx.GlobalIsSet(DataDirPrimaryFlag.Name) {
+		cfg.PrimaryDataDir = ctx.GlobalString(DataDirPrimaryFlag.Name)
+		cfg.SecondaryCatchup = ctx.GlobalDuration(DataDirPrimaryCatchupFlag.Name)
+
+		// Secondary instances don't sync, they follow the primary one
+		cfg.P2P.MaxPeers = 0
+		cfg.P2P.NoDiscovery = true
+		cfg.P2P.DiscoveryV5 = false
+		cfg.P2P.ListenAddr = ""
+	}
 	if ctx.GlobalIsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.GlobalBool(LightKDFFlag.Name)
 	}
@@ -1267,6 +1837,33 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(InsecureUnlockAllowedFlag.Name) {
 		cfg.InsecureUnlockAllowed = ctx.GlobalBool(InsecureUnlockAllowedFlag.Name)
 	}
+	if ctx.GlobalIsSet(RPCDrainTimeoutFlag.Name) {
+		cfg.RPCDrainTimeout = ctx.GlobalDuration(RPCDrainTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCCoalesceFlag.Name) {
+		cfg.RPCCoalesce = splitAndTrim(ctx.GlobalString(RPCCoalesceFlag.Name))
+	}
+	if ctx.GlobalIsSet(RPCArchiveMethodsFlag.Name) {
+		cfg.RPCScheduler.ArchiveMethods = splitAndTrim(ctx.GlobalString(RPCArchiveMethodsFlag.Name))
+	}
+	if ctx.GlobalIsSet(RPCArchiveDepthFlag.Name) {
+		cfg.RPCScheduler.ArchiveDepth = ctx.GlobalUint64(RPCArchiveDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCArchiveWorkersFlag.Name) {
+		cfg.RPCScheduler.ArchiveWorkers = ctx.GlobalInt(RPCArchiveWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCArchiveQueueFlag.Name) {
+		cfg.RPCScheduler.ArchiveQueue = ctx.GlobalInt(RPCArchiveQueueFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCHeadWorkersFlag.Name) {
+		cfg.RPCScheduler.HeadWorkers = ctx.GlobalInt(RPCHeadWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCHeadQueueFlag.Name) {
+		cfg.RPCScheduler.HeadQueue = ctx.GlobalInt(RPCHeadQueueFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSlowThresholdFlag.Name) {
+		cfg.RPCSlowThreshold = ctx.GlobalDuration(RPCSlowThresholdFlag.Name)
+	}
 }
 
 func setSmartCard(ctx *cli.Context, cfg *node.Config) {
@@ -1408,6 +2005,109 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolArchiveFlag.Name) {
+		cfg.ArchiveLimit = ctx.GlobalInt(TxPoolArchiveFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolArchiveFileFlag.Name) {
+		cfg.ArchiveFile = ctx.GlobalString(TxPoolArchiveFileFlag.Name)
+	}
+}
+
+func setHeadWatch(ctx *cli.Context, cfg *headwatch.Config) {
+	if ctx.GlobalIsSet(HeadWatchEndpointsFlag.Name) {
+		cfg.Endpoints = nil
+		for _, endpoint := range strings.Split(ctx.GlobalString(HeadWatchEndpointsFlag.Name), ",") {
+			if trimmed := strings.TrimSpace(endpoint); trimmed != "" {
+				cfg.Endpoints = append(cfg.Endpoints, trimmed)
+			}
+		}
+	}
+	if ctx.GlobalIsSet(HeadWatchIntervalFlag.Name) {
+		cfg.Interval = ctx.GlobalDuration(HeadWatchIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(HeadWatchDepthFlag.Name) {
+		cfg.Depth = ctx.GlobalUint64(HeadWatchDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(HeadWatchChecksFlag.Name) {
+		cfg.Checks = ctx.GlobalInt(HeadWatchChecksFlag.Name)
+	}
+	if ctx.GlobalIsSet(HeadWatchHaltMiningFlag.Name) {
+		cfg.HaltMining = ctx.GlobalBool(HeadWatchHaltMiningFlag.Name)
+	}
+}
+
+func setForkMonitor(ctx *cli.Context, cfg *forkmon.Config) {
+	if ctx.GlobalIsSet(ForkMonitorFlag.Name) {
+		cfg.Enabled = ctx.GlobalBool(ForkMonitorFlag.Name)
+	}
+	if ctx.GlobalIsSet(ForkMonitorIntervalFlag.Name) {
+		cfg.Interval = ctx.GlobalDuration(ForkMonitorIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(ForkMonitorDepthFlag.Name) {
+		cfg.Depth = ctx.GlobalUint64(ForkMonitorDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(ForkMonitorWarnLengthFlag.Name) {
+		cfg.WarnLength = ctx.GlobalUint64(ForkMonitorWarnLengthFlag.Name)
+	}
+}
+
+func setAlerts(ctx *cli.Context, cfg *alerts.Config) {
+	if ctx.GlobalIsSet(AlertsWebhooksFlag.Name) {
+		cfg.Webhooks = nil
+		for _, webhook := range strings.Split(ctx.GlobalString(AlertsWebhooksFlag.Name), ",") {
+			if trimmed := strings.TrimSpace(webhook); trimmed != "" {
+				cfg.Webhooks = append(cfg.Webhooks, trimmed)
+			}
+		}
+	}
+	if ctx.GlobalIsSet(AlertsFormatFlag.Name) {
+		cfg.Format = ctx.GlobalString(AlertsFormatFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsTemplateFlag.Name) {
+		cfg.Template = ctx.GlobalString(AlertsTemplateFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsNodeFlag.Name) {
+		cfg.Node = ctx.GlobalString(AlertsNodeFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsRateLimitFlag.Name) {
+		cfg.RateLimit = ctx.GlobalDuration(AlertsRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsReorgDepthFlag.Name) {
+		cfg.ReorgDepth = ctx.GlobalUint64(AlertsReorgDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsSyncStallFlag.Name) {
+		cfg.SyncStall = ctx.GlobalDuration(AlertsSyncStallFlag.Name)
+	}
+	if ctx.GlobalIsSet(AlertsMinPeersFlag.Name) {
+		cfg.MinPeers = ctx.GlobalInt(AlertsMinPeersFlag.Name)
+	}
+}
+
+func setTxManager(ctx *cli.Context, cfg *txmgr.Config) {
+	if ctx.GlobalIsSet(TxManagerFlag.Name) {
+		cfg.Enabled = ctx.GlobalBool(TxManagerFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxManagerRebroadcastFlag.Name) {
+		cfg.Rebroadcast = ctx.GlobalDuration(TxManagerRebroadcastFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxManagerBumpIntervalFlag.Name) {
+		cfg.BumpInterval = ctx.GlobalDuration(TxManagerBumpIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxManagerBumpPercentFlag.Name) {
+		cfg.BumpPercent = ctx.GlobalUint64(TxManagerBumpPercentFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxManagerPriceCapFlag.Name) {
+		cfg.PriceCap = GlobalBig(ctx, TxManagerPriceCapFlag.Name)
+	}
+}
+
+func setWitness(ctx *cli.Context, cfg *wit.Config) {
+	if ctx.GlobalIsSet(WitnessFlag.Name) {
+		cfg.Enabled = ctx.GlobalBool(WitnessFlag.Name)
+	}
+	if ctx.GlobalIsSet(WitnessCacheFlag.Name) {
+		cfg.Cache = ctx.GlobalInt(WitnessCacheFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *eth.Config) {
@@ -1471,6 +2171,9 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerClockGuardFlag.Name) {
+		cfg.ClockGuard = ctx.GlobalBool(MinerClockGuardFlag.Name)
+	}
 }
 
 func setWhitelist(ctx *cli.Context, cfg *eth.Config) {
@@ -1561,6 +2264,8 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	// Ancient tx indices pruning is not available for les server now
 	// since light client relies on the server for transaction status query.
 	CheckExclusive(ctx, LegacyLightServFlag, LightServeFlag, TxLookupLimitFlag)
+	CheckExclusive(ctx, GCModeFlag, "archive", HistoryRetainFlag)
+	CheckExclusive(ctx, LegacyLightServFlag, LightServeFlag, HistoryRetainFlag)
 
 	CheckExclusive(ctx, AncientFlag, AncientRPCFlag)
 
@@ -1571,6 +2276,11 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO, ctx.GlobalString(SyncModeFlag.Name) == "light")
 	setTxPool(ctx, &cfg.TxPool)
+	setTxManager(ctx, &cfg.TxManager)
+	setHeadWatch(ctx, &cfg.HeadWatch)
+	setAlerts(ctx, &cfg.Alerts)
+	setForkMonitor(ctx, &cfg.ForkMonitor)
+	setWitness(ctx, &cfg.Witness)
 	setEthash(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
@@ -1586,9 +2296,48 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(AncientFlag.Name) {
 		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
 	}
+	if ctx.GlobalIsSet(AncientCompressFlag.Name) {
+		cfg.AncientCompression = MakeAncientCompression(ctx)
+	}
+	if ctx.GlobalIsSet(AncientFileSizeFlag.Name) {
+		cfg.AncientFileSizes = MakeFreezerOptions(ctx).FileSizes
+	}
+	if ctx.GlobalIsSet(AncientSyncItemsFlag.Name) {
+		cfg.AncientSyncItems = ctx.GlobalUint64(AncientSyncItemsFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientThresholdFlag.Name) {
+		cfg.AncientThreshold = ctx.GlobalUint64(AncientThresholdFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientAggressiveFlag.Name) {
+		cfg.AncientAggressive = ctx.GlobalBool(AncientAggressiveFlag.Name)
+	}
 	if ctx.GlobalIsSet(AncientRPCFlag.Name) {
 		cfg.DatabaseFreezerRemote = ctx.GlobalString(AncientRPCFlag.Name)
 	}
+	if ctx.GlobalIsSet(AncientRPCServeLimitFlag.Name) {
+		cfg.AncientServeLimit = ctx.GlobalUint64(AncientRPCServeLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientRPCMirrorFlag.Name) {
+		cfg.AncientTiering.Mirror = ctx.GlobalUint64(AncientRPCMirrorFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientRPCRemoteOnlyFlag.Name) {
+		cfg.AncientTiering.RemoteOnlyBelow = ctx.GlobalUint64(AncientRPCRemoteOnlyFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientRPCPolicyFlag.Name) {
+		cfg.AncientTieringFile = ctx.GlobalString(AncientRPCPolicyFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientRPCFallbackFlag.Name) {
+		cfg.AncientFallback = ctx.GlobalBool(AncientRPCFallbackFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientRPCFallbackTimeoutFlag.Name) {
+		cfg.AncientFallbackTimeout = ctx.GlobalDuration(AncientRPCFallbackTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(IntegrityCheckFlag.Name) {
+		cfg.IntegrityCheck = ctx.GlobalUint64(IntegrityCheckFlag.Name)
+	}
+	if ctx.GlobalIsSet(IntegrityRepairFlag.Name) {
+		cfg.IntegrityRepair = ctx.GlobalBool(IntegrityRepairFlag.Name)
+	}
 
 	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
@@ -1599,9 +2348,48 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 	}
+	if ctx.GlobalIsSet(CacheWarmupFlag.Name) {
+		cfg.CacheWarmup = ctx.GlobalBool(CacheWarmupFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(HistoryRetainFlag.Name) {
+		cfg.HistoryRetain = ctx.GlobalUint64(HistoryRetainFlag.Name)
+	}
+	if ctx.GlobalIsSet(VerifyReceiptsFlag.Name) {
+		cfg.VerifyReceipts = ctx.GlobalBool(VerifyReceiptsFlag.Name)
+	}
+	if ctx.GlobalIsSet(UncleIndexFlag.Name) {
+		cfg.UncleIndex = ctx.GlobalBool(UncleIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(ContractIndexFlag.Name) {
+		cfg.ContractIndex = ctx.GlobalBool(ContractIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(TokenIndexFlag.Name) {
+		cfg.TokenIndex = ctx.GlobalBool(TokenIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(TrackSupplyFlag.Name) {
+		cfg.TrackSupply = ctx.GlobalBool(TrackSupplyFlag.Name)
+	}
+	if ctx.GlobalIsSet(P2PRecordFlag.Name) {
+		cfg.P2PRecordDir = ctx.GlobalString(P2PRecordFlag.Name)
+	}
+	if ctx.GlobalIsSet(P2PRecordPayloadsFlag.Name) {
+		cfg.P2PRecordPayloads = ctx.GlobalBool(P2PRecordPayloadsFlag.Name)
+	}
+	if ctx.GlobalIsSet(PropagationMinPeersFlag.Name) {
+		cfg.BlockPropagation.MinPeers = ctx.GlobalInt(PropagationMinPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(PropagationMaxPeersFlag.Name) {
+		cfg.BlockPropagation.MaxPeers = ctx.GlobalInt(PropagationMaxPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(PropagationMinedAllFlag.Name) {
+		cfg.BlockPropagation.MinedAll = ctx.GlobalBool(PropagationMinedAllFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateServeLimitFlag.Name) {
+		cfg.StateServeLimit = ctx.GlobalUint64(StateServeLimitFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1611,6 +2399,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheTrieRejournalFlag.Name) {
 		cfg.TrieCleanCacheRejournal = ctx.GlobalDuration(CacheTrieRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(CacheTrieFlushIntervalFlag.Name) {
+		cfg.TrieTimeout = ctx.GlobalDuration(CacheTrieFlushIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(CacheTrieFlushBlocksFlag.Name) {
+		cfg.TrieFlushBlocks = ctx.GlobalUint64(CacheTrieFlushBlocksFlag.Name)
+	}
+	if ctx.GlobalIsSet(CacheTrieFlushTimeoutFlag.Name) {
+		cfg.TrieFlushTimeout = ctx.GlobalDuration(CacheTrieFlushTimeoutFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieDirtyCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
@@ -1621,6 +2418,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		cfg.TrieCleanCache += cfg.SnapshotCache
 		cfg.SnapshotCache = 0 // Disabled
 	}
+	if ctx.GlobalIsSet(SnapshotNoReadsFlag.Name) {
+		cfg.SnapshotNoReads = ctx.GlobalBool(SnapshotNoReadsFlag.Name)
+	}
+	if ctx.GlobalIsSet(SnapshotAuditFlag.Name) {
+		if rate := ctx.GlobalFloat64(SnapshotAuditFlag.Name); rate < 0 || rate > 1 {
+			Fatalf("Invalid snapshot audit rate %v, must be between 0 and 1", rate)
+		}
+		cfg.SnapshotAudit = ctx.GlobalFloat64(SnapshotAuditFlag.Name)
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -1638,6 +2444,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		cfg.EVMInterpreter = ctx.GlobalString(EVMInterpreterFlag.Name)
 		vm.InitEVMCEVM(cfg.EVMInterpreter)
 	}
+	if ctx.GlobalIsSet(VMStatsFlag.Name) {
+		cfg.EnableOpcodeStats = ctx.GlobalBool(VMStatsFlag.Name)
+	}
 	if ctx.GlobalIsSet(RPCGlobalGasCap.Name) {
 		cfg.RPCGasCap = ctx.GlobalUint64(RPCGlobalGasCap.Name)
 	}
@@ -1649,6 +2458,30 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalTxFeeCap.Name) {
 		cfg.RPCTxFeeCap = ctx.GlobalFloat64(RPCGlobalTxFeeCap.Name)
 	}
+	if ctx.GlobalIsSet(RPCGlobalLogsRangeCap.Name) {
+		cfg.RPCLogsRangeCap = ctx.GlobalUint64(RPCGlobalLogsRangeCap.Name)
+	}
+	if ctx.GlobalIsSet(RPCErrorCodesFlag.Name) {
+		cfg.RPCErrorCodes = ctx.GlobalBool(RPCErrorCodesFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceRegenerateFlag.Name) {
+		cfg.TraceRegenerate = ctx.GlobalUint64(TraceRegenerateFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCCacheSizeFlag.Name) {
+		cfg.RPCCacheSize = ctx.GlobalInt(RPCCacheSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCCacheTTLFlag.Name) {
+		cfg.RPCCacheTTL = ctx.GlobalDuration(RPCCacheTTLFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCFilterTimeoutFlag.Name) {
+		cfg.Filters.Timeout = ctx.GlobalDuration(RPCFilterTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCFilterPersistFlag.Name) {
+		cfg.Filters.Persist = ctx.GlobalBool(RPCFilterPersistFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResumeWindowFlag.Name) {
+		cfg.Filters.ResumeWindow = ctx.GlobalUint64(RPCResumeWindowFlag.Name)
+	}
 	if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
 		urls := ctx.GlobalString(DNSDiscoveryFlag.Name)
 		if urls == "" {
@@ -1711,9 +2544,35 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 			// when we're definitely concerned with only one account.
 			passphrase = list[0]
 		}
+		// Import and unlock the deterministic developer accounts, if requested
+		var funded []common.Address
+		if ctx.GlobalIsSet(DeveloperMnemonicFlag.Name) {
+			seed := accounts.MnemonicSeed(ctx.GlobalString(DeveloperMnemonicFlag.Name), "")
+			for i := 0; i < ctx.GlobalInt(DeveloperAccountsFlag.Name); i++ {
+				path := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+				path[len(path)-1] += uint32(i)
+
+				key, err := accounts.DeriveKey(seed, path)
+				if err != nil {
+					Fatalf("Failed to derive developer account %d: %v", i, err)
+				}
+				account, err := ks.ImportECDSA(key, passphrase)
+				if err != nil && err != keystore.ErrAccountAlreadyExists {
+					Fatalf("Failed to import developer account %d: %v", i, err)
+				}
+				if err := ks.Unlock(account, passphrase); err != nil {
+					Fatalf("Failed to unlock developer account %d: %v", i, err)
+				}
+				funded = append(funded, account.Address)
+				log.Info("Using mnemonic developer account", "index", i, "address", account.Address)
+			}
+		}
 		// setEtherbase has been called above, configuring the miner address from command line flags.
 		if cfg.Miner.Etherbase != (common.Address{}) {
 			developer = accounts.Account{Address: cfg.Miner.Etherbase}
+		} else if len(funded) > 0 {
+			developer = accounts.Account{Address: funded[0]}
+			cfg.Miner.Etherbase = developer.Address
 		} else if accs := ks.Accounts(); len(accs) > 0 {
 			developer = ks.Accounts()[0]
 		} else {
@@ -1728,7 +2587,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		log.Info("Using developer account", "address", developer.Address)
 
 		// Create a new developer genesis block or reuse existing one
-		cfg.Genesis = params.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), developer.Address)
+		period := uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name))
+		if ctx.GlobalBool(DeveloperPoWFlag.Name) || ctx.GlobalBool(DeveloperClassicFlag.Name) {
+			cfg.DeveloperPoW = true
+			cfg.DeveloperPeriod = period
+			cfg.Ethash.PowMode = ethash.ModeFullFake
+			cfg.Genesis = params.DeveloperPoWGenesisBlock(ctx.GlobalBool(DeveloperClassicFlag.Name), append([]common.Address{developer.Address}, funded...)...)
+		} else {
+			cfg.Genesis = params.DeveloperGenesisBlock(period, developer.Address, funded...)
+		}
 		if ctx.GlobalIsSet(DataDirFlag.Name) {
 			// Check if we have an already initialized chain and fall back to
 			// that if so. Otherwise we need to generate a new genesis spec.
@@ -1808,6 +2675,83 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 	}
 }
 
+// SetGRPCConfig applies gRPC-related command line flags to the config.
+func SetGRPCConfig(ctx *cli.Context, cfg *grpcapi.Config) {
+	if ctx.GlobalBool(GRPCEnabledFlag.Name) && cfg.Host == "" {
+		cfg.Host = "127.0.0.1"
+		if ctx.GlobalIsSet(GRPCListenAddrFlag.Name) {
+			cfg.Host = ctx.GlobalString(GRPCListenAddrFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(GRPCPortFlag.Name) {
+		cfg.Port = ctx.GlobalInt(GRPCPortFlag.Name)
+	}
+}
+
+// RegisterGRPCService configures the gRPC server and adds it to the given node.
+func RegisterGRPCService(stack *node.Node, backend ethapi.Backend, cfg grpcapi.Config) {
+	if err := grpcapi.New(stack, backend, cfg); err != nil {
+		Fatalf("Failed to register the gRPC service: %v", err)
+	}
+}
+
+// SetFirehoseConfig applies firehose-related command line flags to the config.
+func SetFirehoseConfig(ctx *cli.Context, cfg *firehose.Config) {
+	if ctx.GlobalIsSet(FirehoseURLFlag.Name) {
+		cfg.URL = ctx.GlobalString(FirehoseURLFlag.Name)
+	}
+	if ctx.GlobalIsSet(FirehoseTopicPrefixFlag.Name) {
+		cfg.TopicPrefix = ctx.GlobalString(FirehoseTopicPrefixFlag.Name)
+	}
+}
+
+// RegisterFirehoseService configures the chain event firehose and adds it to
+// the given node.
+func RegisterFirehoseService(stack *node.Node, backend ethapi.Backend, cfg firehose.Config) {
+	if err := firehose.New(stack, backend, cfg); err != nil {
+		Fatalf("Failed to register the firehose service: %v", err)
+	}
+}
+
+// SetFollowerConfig applies follower-related command line flags to the config.
+func SetFollowerConfig(ctx *cli.Context, cfg *follower.Config) {
+	if ctx.GlobalIsSet(FollowLeaderFlag.Name) {
+		cfg.Leader = ctx.GlobalString(FollowLeaderFlag.Name)
+	}
+	if ctx.GlobalIsSet(FollowPollFlag.Name) {
+		cfg.Poll = ctx.GlobalDuration(FollowPollFlag.Name)
+	}
+}
+
+// RegisterFollowerService configures the replication of a leader node and adds
+// it to the given node. Light clients can't follow a leader.
+func RegisterFollowerService(stack *node.Node, backend ethapi.Backend, cfg follower.Config) {
+	full, ok := backend.(follower.Backend)
+	if !ok {
+		Fatalf("Following a leader is not supported in light sync mode")
+	}
+	if err := follower.New(stack, full, cfg); err != nil {
+		Fatalf("Failed to register the follower service: %v", err)
+	}
+}
+
+// SetPluginsConfig applies plugin-related command line flags to the config.
+func SetPluginsConfig(ctx *cli.Context, cfg *plugins.Config) {
+	if ctx.GlobalIsSet(PluginsDirFlag.Name) {
+		cfg.Dir = ctx.GlobalString(PluginsDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(PluginsFlag.Name) {
+		cfg.Enabled = splitAndTrim(ctx.GlobalString(PluginsFlag.Name))
+	}
+}
+
+// RegisterPlugins initializes the enabled plugins on the given node.
+func RegisterPlugins(stack *node.Node, backend ethapi.Backend, cfg plugins.Config) {
+	if _, err := plugins.Setup(stack, backend, cfg); err != nil {
+		Fatalf("Failed to set up plugins: %v", err)
+	}
+}
+
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
 	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
@@ -1815,24 +2759,59 @@ func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.C
 	}
 }
 
+// RegisterExplorerService adds the block explorer web UI to the HTTP-RPC server of
+// the given node.
+func RegisterExplorerService(stack *node.Node, backend ethapi.Backend, cfg node.Config, tokenIndex bool) {
+	if err := explorer.New(stack, backend, explorer.Config{VirtualHosts: cfg.HTTPVirtualHosts, TokenIndex: tokenIndex}); err != nil {
+		Fatalf("Failed to register the explorer: %v", err)
+	}
+}
+
 func SetupMetrics(ctx *cli.Context) {
 	if metrics.Enabled {
 		log.Info("Enabling metrics collection")
 
 		var (
-			enableExport = ctx.GlobalBool(MetricsEnableInfluxDBFlag.Name)
-			endpoint     = ctx.GlobalString(MetricsInfluxDBEndpointFlag.Name)
-			database     = ctx.GlobalString(MetricsInfluxDBDatabaseFlag.Name)
-			username     = ctx.GlobalString(MetricsInfluxDBUsernameFlag.Name)
-			password     = ctx.GlobalString(MetricsInfluxDBPasswordFlag.Name)
+			enableExport   = ctx.GlobalBool(MetricsEnableInfluxDBFlag.Name)
+			enableExportV2 = ctx.GlobalBool(MetricsEnableInfluxDBV2Flag.Name)
+			endpoint       = ctx.GlobalString(MetricsInfluxDBEndpointFlag.Name)
+			database       = ctx.GlobalString(MetricsInfluxDBDatabaseFlag.Name)
+			username       = ctx.GlobalString(MetricsInfluxDBUsernameFlag.Name)
+			password       = ctx.GlobalString(MetricsInfluxDBPasswordFlag.Name)
 		)
 
-		if enableExport {
-			tagsMap := SplitTagsFlag(ctx.GlobalString(MetricsInfluxDBTagsFlag.Name))
+		if enableExport || enableExportV2 {
+			tagsMap := addNodeTags(ctx, SplitTagsFlag(ctx.GlobalString(MetricsInfluxDBTagsFlag.Name)))
 
-			log.Info("Enabling metrics export to InfluxDB")
+			if enableExport {
+				log.Info("Enabling metrics export to InfluxDB")
 
-			go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, 10*time.Second, endpoint, database, username, password, "geth.", tagsMap)
+				go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, 10*time.Second, endpoint, database, username, password, "geth.", tagsMap)
+			}
+			if enableExportV2 {
+				var (
+					token        = ctx.GlobalString(MetricsInfluxDBTokenFlag.Name)
+					bucket       = ctx.GlobalString(MetricsInfluxDBBucketFlag.Name)
+					organization = ctx.GlobalString(MetricsInfluxDBOrganizationFlag.Name)
+				)
+				log.Info("Enabling metrics export to InfluxDB (v2)")
+
+				go influxdb.InfluxDBV2WithTags(metrics.DefaultRegistry, 10*time.Second, endpoint, token, bucket, organization, "geth.", tagsMap)
+			}
+		}
+
+		if gateway := ctx.GlobalString(MetricsPushGatewayFlag.Name); gateway != "" {
+			labels := SplitTagsFlag(ctx.GlobalString(MetricsPushGatewayLabelsFlag.Name))
+			if _, ok := labels["instance"]; !ok {
+				if host, err := os.Hostname(); err == nil {
+					labels["instance"] = host
+				}
+			}
+			labels = addNodeTags(ctx, labels)
+
+			log.Info("Enabling metrics push to Prometheus pushgateway", "url", gateway)
+
+			go prometheus.Push(metrics.DefaultRegistry, 10*time.Second, gateway, ctx.GlobalString(MetricsPushGatewayJobFlag.Name), labels)
 		}
 
 		if ctx.GlobalIsSet(MetricsHTTPFlag.Name) {
@@ -1843,6 +2822,51 @@ func SetupMetrics(ctx *cli.Context) {
 	}
 }
 
+// addNodeTags adds the chain and the role of the node to the tags attached to the
+// reported metrics, unless already set by the user.
+func addNodeTags(ctx *cli.Context, tags map[string]string) map[string]string {
+	if _, ok := tags["chain"]; !ok {
+		tags["chain"] = metricsChainName(ctx)
+	}
+	if _, ok := tags["role"]; !ok {
+		tags["role"] = metricsNodeRole(ctx)
+	}
+	return tags
+}
+
+// metricsChainName returns the name of the chain the node runs, tagging the
+// reported metrics.
+func metricsChainName(ctx *cli.Context) string {
+	switch {
+	case ctx.GlobalBool(DeveloperFlag.Name):
+		return "dev"
+	case ctx.GlobalBool(LegacyTestnetFlag.Name):
+		return "ropsten"
+	}
+	if name := dataDirPathForCtxChainConfig(ctx, ""); name != "" {
+		return name
+	}
+	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
+		return fmt.Sprintf("network-%d", ctx.GlobalUint64(NetworkIdFlag.Name))
+	}
+	return "mainnet"
+}
+
+// metricsNodeRole returns the role of the node, tagging the reported metrics.
+func metricsNodeRole(ctx *cli.Context) string {
+	switch {
+	case ctx.GlobalString(SyncModeFlag.Name) == "light":
+		return "light"
+	case ctx.GlobalBool(MiningEnabledFlag.Name) || ctx.GlobalBool(DeveloperFlag.Name):
+		return "miner"
+	case ctx.GlobalInt(LegacyLightServFlag.Name) != 0 || ctx.GlobalInt(LightServeFlag.Name) != 0:
+		return "lightserver"
+	case ctx.GlobalString(GCModeFlag.Name) == "archive":
+		return "archive"
+	}
+	return "full"
+}
+
 func SplitTagsFlag(tagsFlag string) map[string]string {
 	tags := strings.Split(tagsFlag, ",")
 	tagsMap := map[string]string{}
@@ -1875,9 +2899,119 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 		name = "lightchaindata"
 	}
 	if ctx.GlobalIsSet(AncientRPCFlag.Name) {
-		chainDb, err = stack.OpenDatabaseWithFreezerRemote(name, cache, handles, ctx.GlobalString(AncientRPCFlag.Name))
+		options := MakeFreezerOptions(ctx)
+		options.Genesis, options.NetworkID = makeChainIdentity(ctx)
+		chainDb, err = stack.OpenDatabaseWithFreezerRemote(name, cache, handles, ctx.GlobalString(AncientRPCFlag.Name), options)
+	} else {
+		chainDb, err = stack.OpenDatabaseWithFreezer(name, cache, handles, ctx.GlobalString(AncientFlag.Name), "", MakeFreezerOptions(ctx))
+	}
+	if err != nil {
+		Fatalf("Could not open database: %v", err)
+	}
+	return chainDb
+}
+
+// makeChainIdentity returns the genesis hash and network id of the chain selected
+// by the flags, presented to a remote freezer shared between chains. Developer
+// chains are ephemeral and left unidentified.
+func makeChainIdentity(ctx *cli.Context) (common.Hash, uint64) {
+	if ctx.GlobalBool(DeveloperFlag.Name) {
+		return common.Hash{}, 0
+	}
+	var (
+		genesis   = params.MainnetGenesisHash
+		networkID = eth.DefaultConfig.NetworkId
+	)
+	if gen := genesisForCtxChainConfig(ctx); gen != nil {
+		genesis = core.GenesisToBlock(gen, nil).Hash()
+		if id := gen.GetNetworkID(); id != nil {
+			networkID = *id
+		}
+	}
+	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
+		networkID = ctx.GlobalUint64(NetworkIdFlag.Name)
+	}
+	return genesis, networkID
+}
+
+// MakeBenchDatabase opens a scratch database of the given name for storage
+// benchmarks, with the cache allowance and freezer settings of the chain
+// database. A local freezer is placed within the configured ancient directory,
+// a remote one is used as is. Errors are returned rather than fatal, so that the
+// caller can clean up the scratch directories first.
+func MakeBenchDatabase(ctx *cli.Context, stack *node.Node, name string) (ethdb.Database, error) {
+	var (
+		cache   = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
+		handles = makeDatabaseHandles()
+
+		err error
+		db  ethdb.Database
+	)
+	switch {
+	case ctx.GlobalIsSet(AncientRPCFlag.Name):
+		db, err = stack.OpenDatabaseWithFreezerRemote(name, cache, handles, ctx.GlobalString(AncientRPCFlag.Name), MakeFreezerOptions(ctx))
+	case ctx.GlobalIsSet(AncientFlag.Name):
+		db, err = stack.OpenDatabaseWithFreezer(name, cache, handles, filepath.Join(ctx.GlobalString(AncientFlag.Name), name), "", MakeFreezerOptions(ctx))
+	default:
+		db, err = stack.OpenDatabaseWithFreezer(name, cache, handles, "", "", MakeFreezerOptions(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open benchmark database: %v", err)
+	}
+	return db, nil
+}
+
+// MakeAncientCompression parses the ancient table compression settings given on
+// the command line, returning nil for the defaults.
+func MakeAncientCompression(ctx *cli.Context) rawdb.FreezerCompression {
+	if !ctx.GlobalIsSet(AncientCompressFlag.Name) {
+		return nil
+	}
+	compression, err := rawdb.ParseFreezerCompression(ctx.GlobalString(AncientCompressFlag.Name))
+	if err != nil {
+		Fatalf("Invalid --%s: %v", AncientCompressFlag.Name, err)
+	}
+	return compression
+}
+
+// MakeFreezerOptions assembles the freezer and ancient table options given on
+// the command line.
+func MakeFreezerOptions(ctx *cli.Context) *rawdb.FreezerOptions {
+	options := &rawdb.FreezerOptions{
+		Threshold:   ctx.GlobalUint64(AncientThresholdFlag.Name),
+		Aggressive:  ctx.GlobalBool(AncientAggressiveFlag.Name),
+		Compression: MakeAncientCompression(ctx),
+		SyncItems:   ctx.GlobalUint64(AncientSyncItemsFlag.Name),
+	}
+	if ctx.GlobalIsSet(AncientFileSizeFlag.Name) {
+		sizes, err := rawdb.ParseFreezerFileSizes(ctx.GlobalString(AncientFileSizeFlag.Name))
+		if err != nil {
+			Fatalf("Invalid --%s: %v", AncientFileSizeFlag.Name, err)
+		}
+		options.FileSizes = sizes
+	}
+	return options
+}
+
+// MakeChainKeyValueStore opens the key-value store backing the chain database,
+// without attaching any ancient store to it. If readonly is set, the store is
+// opened in read-only mode and no modifications will be permitted.
+func MakeChainKeyValueStore(ctx *cli.Context, stack *node.Node, readonly bool) ethdb.Database {
+	var (
+		cache   = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
+		handles = makeDatabaseHandles()
+
+		err     error
+		chainDb ethdb.Database
+	)
+	name := "chaindata"
+	if ctx.GlobalString(SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	if readonly {
+		chainDb, err = rawdb.NewLevelDBDatabaseReadOnly(stack.ResolvePath(name), cache, handles, "")
 	} else {
-		chainDb, err = stack.OpenDatabaseWithFreezer(name, cache, handles, ctx.GlobalString(AncientFlag.Name), "")
+		chainDb, err = rawdb.NewLevelDBDatabase(stack.ResolvePath(name), cache, handles, "")
 	}
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
@@ -1960,7 +3094,9 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.B
 		TrieCleanNoPrefetch: ctx.GlobalBool(CacheNoPrefetchFlag.Name),
 		TrieDirtyLimit:      eth.DefaultConfig.TrieDirtyCache,
 		TrieDirtyDisabled:   ctx.GlobalString(GCModeFlag.Name) == "archive",
-		TrieTimeLimit:       eth.DefaultConfig.TrieTimeout,
+		TrieTimeLimit:       ctx.GlobalDuration(CacheTrieFlushIntervalFlag.Name),
+		TrieBlockLimit:      ctx.GlobalUint64(CacheTrieFlushBlocksFlag.Name),
+		TrieFlushTimeout:    ctx.GlobalDuration(CacheTrieFlushTimeoutFlag.Name),
 		SnapshotLimit:       eth.DefaultConfig.SnapshotCache,
 	}
 	if !ctx.GlobalIsSet(SnapshotFlag.Name) {
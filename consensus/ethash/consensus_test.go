@@ -25,6 +25,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/params/types/goethereum"
 )
 
@@ -84,3 +85,55 @@ func TestCalcDifficulty(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRewards(t *testing.T) {
+	ether := func(num, denom int64) *big.Int {
+		r := new(big.Int).Mul(big.NewInt(num), big.NewInt(1e18))
+		return r.Div(r, big.NewInt(denom))
+	}
+	tests := []struct {
+		name        string
+		config      *goethereum.ChainConfig
+		number      int64
+		uncles      []int64
+		miner       *big.Int
+		uncleReward []*big.Int
+	}{
+		{"byzantium", params.MainnetChainConfig, 4370000, []int64{4369999, 4369994}, ether(3*34, 32), []*big.Int{ether(3*7, 8), ether(3*2, 8)}},
+		{"constantinople", params.MainnetChainConfig, 7280000, nil, ether(2, 1), []*big.Int{}},
+	}
+	for _, tt := range tests {
+		miner, uncles := GetRewards(tt.config, &types.Header{Number: big.NewInt(tt.number)}, uncleHeaders(tt.uncles))
+		checkRewards(t, tt.name, miner, uncles, tt.miner, tt.uncleReward)
+	}
+	// ECIP-1017 rewards uncles equally from the second era on
+	classic := params.ClassicChainConfig
+	miner, uncles := GetRewards(classic, &types.Header{Number: big.NewInt(5000000)}, uncleHeaders([]int64{4999999}))
+	checkRewards(t, "classic era 1", miner, uncles, ether(5*33, 32), []*big.Int{ether(5*7, 8)})
+
+	miner, uncles = GetRewards(classic, &types.Header{Number: big.NewInt(5000001)}, uncleHeaders([]int64{5000000, 4999995}))
+	checkRewards(t, "classic era 2", miner, uncles, ether(4*34, 32), []*big.Int{ether(4, 32), ether(4, 32)})
+}
+
+func uncleHeaders(numbers []int64) []*types.Header {
+	var uncles []*types.Header
+	for _, number := range numbers {
+		uncles = append(uncles, &types.Header{Number: big.NewInt(number)})
+	}
+	return uncles
+}
+
+func checkRewards(t *testing.T, name string, miner *big.Int, uncles []*big.Int, wantMiner *big.Int, wantUncles []*big.Int) {
+	t.Helper()
+	if miner.Cmp(wantMiner) != 0 {
+		t.Errorf("%s: miner reward mismatch: have %v, want %v", name, miner, wantMiner)
+	}
+	if len(uncles) != len(wantUncles) {
+		t.Fatalf("%s: uncle reward count mismatch: have %d, want %d", name, len(uncles), len(wantUncles))
+	}
+	for i := range uncles {
+		if uncles[i].Cmp(wantUncles[i]) != 0 {
+			t.Errorf("%s: uncle %d reward mismatch: have %v, want %v", name, i, uncles[i], wantUncles[i])
+		}
+	}
+}
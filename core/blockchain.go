@@ -80,6 +80,7 @@ var (
 	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
 
 	errInsertionInterrupted = errors.New("insertion is interrupted")
+	errSecondaryChain       = errors.New("secondary chain is read-only")
 )
 
 const (
@@ -128,7 +129,10 @@ type CacheConfig struct {
 	TrieDirtyLimit      int           // Memory limit (MB) at which to start flushing dirty trie nodes to disk
 	TrieDirtyDisabled   bool          // Whether to disable trie write caching and GC altogether (archive node)
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
+	TrieBlockLimit      uint64        // Number of blocks after which to flush the current in-memory trie to disk (0 = no limit)
+	TrieFlushTimeout    time.Duration // Time limit on shutdown after which to only flush the head state (0 = no limit)
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
+	SecondaryCatchup    time.Duration // Interval between two reloads of the head written by the primary process of a secondary database (0 = not secondary)
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -143,6 +147,14 @@ var defaultCacheConfig = &CacheConfig{
 	SnapshotWait:   true,
 }
 
+// TrieFlushPolicy is the policy of flushing the in-memory tries of a full node
+// to disk, trading the blocks to reprocess after a crash against the disk writes.
+type TrieFlushPolicy struct {
+	TimeLimit  time.Duration // Block processing time after which to flush an entire trie to disk
+	BlockLimit uint64        // Number of blocks after which to flush an entire trie to disk (0 = no limit)
+	DirtyLimit int           // Memory limit (MB) at which to start flushing dirty trie nodes to disk
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -166,6 +178,9 @@ type BlockChain struct {
 	triegc *prque.Prque   // Priority queue mapping block numbers to tries to gc
 	gcproc time.Duration  // Accumulates canonical block processing for trie dumping
 
+	flushPolicy atomic.Value // Policy of flushing the in-memory tries to disk (*TrieFlushPolicy)
+	lastWrite   uint64       // Number of the block whose trie was last flushed to disk
+
 	// txLookupLimit is the maximum number of blocks from head whose tx indices
 	// are reserved:
 	//  * 0:   means no limit and regenerate any missing indexes
@@ -173,6 +188,14 @@ type BlockChain struct {
 	//  * nil: disable tx reindexer/deleter, but still index new blocks
 	txLookupLimit uint64
 
+	// historyRetain is the number of recent blocks whose bodies and receipts are
+	// retained, 0 if all of them are.
+	historyRetain uint64
+
+	// snapProfile tracks the accounts read from the snapshot to guide the cache
+	// warmup after the next restart, nil if the warmup is disabled.
+	snapProfile *snapshot.AccessProfile
+
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
 	chainFeed     event.Feed
@@ -207,6 +230,11 @@ type BlockChain struct {
 	processor  Processor  // Block transaction processor interface
 	vmConfig   vm.Config
 
+	opcodeStats    *vm.OpcodeStats // Opcode statistics of the processed blocks, if enabled
+	trackSupply    bool            // Whether to record the circulating supply at every written block
+	indexContracts bool            // Whether to index the contracts deployed by every written block
+	indexTokens    bool            // Whether to index the token transfers of every written block
+
 	badBlocks       *lru.Cache                     // Bad block cache
 	shouldPreserve  func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
@@ -245,6 +273,11 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 		vmConfig:       vmConfig,
 		badBlocks:      badBlocks,
 	}
+	bc.flushPolicy.Store(&TrieFlushPolicy{
+		TimeLimit:  cacheConfig.TrieTimeLimit,
+		BlockLimit: cacheConfig.TrieBlockLimit,
+		DirtyLimit: cacheConfig.TrieDirtyLimit,
+	})
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 	bc.processor = NewStateProcessor(chainConfig, bc, engine)
@@ -266,7 +299,11 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 	// Initialize the chain with ancient data if it isn't empty.
 	var txIndexBlock uint64
 
-	if bc.empty() {
+	secondary := cacheConfig.SecondaryCatchup > 0
+	if secondary && rawdb.ReadHeadBlockHash(bc.db) == (common.Hash{}) {
+		return nil, errors.New("secondary chain database is empty")
+	}
+	if bc.empty() && !secondary {
 		rawdb.InitDatabaseFromFreezer(bc.db)
 		// If ancient database is not empty, reconstruct all missing
 		// indices in the background.
@@ -282,16 +319,25 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	// Complete a chain rewind interrupted by a crash, if any
+	if target := rawdb.ReadSetHeadJournal(bc.db); target != nil && !secondary {
+		log.Warn("Resuming interrupted chain rewind", "target", *target)
+		if err := bc.SetHead(*target); err != nil {
+			return nil, err
+		}
+	}
 	// Make sure the state associated with the block is available
 	head := bc.CurrentBlock()
-	if _, err := state.New(head.Root(), bc.stateCache, bc.snaps); err != nil {
+	if _, err := state.New(head.Root(), bc.stateCache, bc.snaps); err != nil && secondary {
+		log.Warn("Head state missing, not flushed by the primary yet", "number", head.Number(), "hash", head.Hash())
+	} else if err != nil {
 		log.Warn("Head state missing, repairing", "number", head.Number(), "hash", head.Hash())
 		if err := bc.SetHead(head.NumberU64()); err != nil {
 			return nil, err
 		}
 	}
 	// Ensure that a previous crash in SetHead doesn't leave extra ancients
-	if frozen, err := bc.db.Ancients(); err == nil && frozen > 0 {
+	if frozen, err := bc.db.Ancients(); err == nil && frozen > 0 && !secondary {
 		var (
 			needRewind bool
 			low        uint64
@@ -332,7 +378,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 			// get the canonical block corresponding to the offending header's number
 			headerByNumber := bc.GetHeaderByNumber(header.Number.Uint64())
 			// make sure the headerByNumber (if present) is in our current canonical chain
-			if headerByNumber != nil && headerByNumber.Hash() == header.Hash() {
+			if headerByNumber != nil && headerByNumber.Hash() == header.Hash() && secondary {
+				log.Error("Found bad hash in the secondary chain", "number", header.Number, "hash", header.Hash())
+			} else if headerByNumber != nil && headerByNumber.Hash() == header.Hash() {
 				log.Error("Found bad hash, rewinding chain", "number", header.Number, "hash", header.ParentHash)
 				if err := bc.SetHead(header.Number.Uint64() - 1); err != nil {
 					return nil, err
@@ -342,12 +390,23 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig ctyp
 		}
 	}
 	// Load any existing snapshot, regenerating it if loading failed
-	if bc.cacheConfig.SnapshotLimit > 0 {
+	if bc.cacheConfig.SnapshotLimit > 0 && !secondary {
 		bc.snaps = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, bc.CurrentBlock().Root(), !bc.cacheConfig.SnapshotWait)
 	}
+	// Report an unclean previous shutdown, marking this run as unclean until it
+	// stops, the marker of a secondary chain being the one of the primary process
+	if !secondary {
+		if marker := rawdb.ReadShutdownMarker(bc.db); marker != nil && !marker.Clean {
+			log.Warn("Previous shutdown did not flush the chain state, recent blocks may be reprocessed", "started", time.Unix(int64(marker.Time), 0))
+		}
+		rawdb.WriteShutdownMarker(bc.db, false)
+	}
 	// Take ownership of this particular state
 	go bc.update()
-	if txLookupLimit != nil {
+	if secondary {
+		bc.wg.Add(1)
+		go bc.followPrimary(bc.cacheConfig.SecondaryCatchup)
+	} else if txLookupLimit != nil {
 		bc.txLookupLimit = *txLookupLimit
 		go bc.maintainTxIndex(txIndexBlock)
 	}
@@ -372,6 +431,24 @@ func (bc *BlockChain) GetVMConfig() *vm.Config {
 	return &bc.vmConfig
 }
 
+// EnableOpcodeStats starts collecting the opcode statistics of the processed
+// blocks. It must be called before importing blocks.
+func (bc *BlockChain) EnableOpcodeStats() {
+	bc.opcodeStats = new(vm.OpcodeStats)
+}
+
+// OpcodeStats returns the opcode statistics of the processed blocks, or nil if
+// they aren't collected.
+func (bc *BlockChain) OpcodeStats() *vm.OpcodeStats {
+	return bc.opcodeStats
+}
+
+// EnableContractIndex starts indexing the contracts deployed by the written
+// blocks, by address and by code hash. It must be called before importing blocks.
+func (bc *BlockChain) EnableContractIndex() {
+	bc.indexContracts = true
+}
+
 // empty returns an indicator whether the blockchain is empty.
 // Note, it's a special case that we connect a non-empty ancient
 // database with an empty node, so that we can plugin the ancient
@@ -449,6 +526,19 @@ func (bc *BlockChain) loadLastState() error {
 // was fast synced or full synced and in which state, the method will try to
 // delete minimal data from disk whilst retaining chain consistency.
 func (bc *BlockChain) SetHead(head uint64) error {
+	if bc.cacheConfig.SecondaryCatchup > 0 {
+		return errSecondaryChain
+	}
+	if err := bc.setHead(head); err != nil {
+		return err
+	}
+	// Send a chain head event to update the transaction pool and the miner
+	bc.chainHeadFeed.Send(ChainHeadEvent{Block: bc.CurrentBlock()})
+	return nil
+}
+
+// setHead rewinds the local chain to a new head, see SetHead.
+func (bc *BlockChain) setHead(head uint64) error {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
@@ -457,32 +547,15 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	pivot := rawdb.ReadLastPivotNumber(bc.db)
 	frozen, _ := bc.db.Ancients()
 
+	// Journal the rewind, so it's resumed on the next start if interrupted
+	rawdb.WriteSetHeadJournal(bc.db, head)
+
 	updateFn := func(db ethdb.KeyValueWriter, header *types.Header) (uint64, bool) {
 		// Rewind the block chain, ensuring we don't end up with a stateless head
 		// block. Note, depth equality is permitted to allow using SetHead as a
 		// chain reparation mechanism without deleting any data!
 		if currentBlock := bc.CurrentBlock(); currentBlock != nil && header.Number.Uint64() <= currentBlock.NumberU64() {
-			newHeadBlock := bc.GetBlock(header.Hash(), header.Number.Uint64())
-			if newHeadBlock == nil {
-				log.Error("Gap in the chain, rewinding to genesis", "number", header.Number, "hash", header.Hash())
-				newHeadBlock = bc.genesisBlock
-			} else {
-				// Block exists, keep rewinding until we find one with state
-				for {
-					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
-						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
-						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
-							newHeadBlock = bc.GetBlock(newHeadBlock.ParentHash(), newHeadBlock.NumberU64()-1)
-							continue
-						} else {
-							log.Trace("Rewind passed pivot, aiming genesis", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash(), "pivot", *pivot)
-							newHeadBlock = bc.genesisBlock
-						}
-					}
-					log.Debug("Rewound to block with state", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
-					break
-				}
-			}
+			newHeadBlock := bc.rewindHeadBlock(header, pivot)
 			rawdb.WriteHeadBlockHash(db, newHeadBlock.Hash())
 
 			// Degrade the chain markers if they are explicitly reverted.
@@ -521,6 +594,10 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	}
 	// Rewind the header chain, deleting all block bodies until then
 	delFn := func(db ethdb.KeyValueWriter, hash common.Hash, num uint64) {
+		// Unindex the transactions while the body is still around
+		for _, tx := range bc.indexedTxs(hash, num) {
+			rawdb.DeleteTxLookupEntry(db, tx)
+		}
 		// Ignore the error here since light client won't hit this path
 		frozen, _ := bc.db.Ancients()
 		if num+1 <= frozen {
@@ -538,7 +615,7 @@ func (bc *BlockChain) SetHead(head uint64) error {
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
 		}
-		// Todo(rjl493456442) txlookup, bloombits, etc
+		// Todo(rjl493456442) bloombits, etc
 	}
 	// If SetHead was only called as a chain reparation method, try to skip
 	// touching the header chain altogether, unless the freezer is broken
@@ -560,7 +637,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.txLookupCache.Purge()
 	bc.futureBlocks.Purge()
 
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return err
+	}
+	rawdb.DeleteSetHeadJournal(bc.db)
+	return nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -941,14 +1022,39 @@ func (bc *BlockChain) Stop() {
 	bc.StopInsert()
 	bc.wg.Wait()
 
+	// Secondary chains have nothing to flush, the primary owning the database
+	if bc.cacheConfig.SecondaryCatchup > 0 {
+		log.Info("Blockchain stopped")
+		return
+	}
+	// Flush the state within the configured deadline, past which only the head
+	// state is committed to keep the shutdown short.
+	var (
+		clean    = true
+		deadline time.Time
+	)
+	if bc.cacheConfig.TrieFlushTimeout > 0 {
+		deadline = time.Now().Add(bc.cacheConfig.TrieFlushTimeout)
+	}
+	expired := func() bool {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			clean = false
+			return true
+		}
+		return false
+	}
 	// Ensure that the entirety of the state snapshot is journalled to disk.
 	var snapBase common.Hash
 	if bc.snaps != nil {
 		var err error
 		if snapBase, err = bc.snaps.Journal(bc.CurrentBlock().Root()); err != nil {
 			log.Error("Failed to journal state snapshot", "err", err)
+			clean = false
 		}
 	}
+	if bc.snapProfile != nil {
+		rawdb.WriteSnapshotAccessProfile(bc.db, bc.snapProfile.Accounts())
+	}
 	// Ensure the state of a recent block is also stored to disk before exiting.
 	// We're writing three different states to catch different restart scenarios:
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
@@ -960,17 +1066,26 @@ func (bc *BlockChain) Stop() {
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
 			if number := bc.CurrentBlock().NumberU64(); number > offset {
 				recent := bc.GetBlockByNumber(number - offset)
-
+				if offset > 0 && expired() {
+					log.Warn("State flush deadline exceeded, skipping cached state", "block", recent.Number(), "timeout", bc.cacheConfig.TrieFlushTimeout)
+					continue
+				}
 				log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
 				if err := triedb.Commit(recent.Root(), true, nil); err != nil {
 					log.Error("Failed to commit recent state trie", "err", err)
+					clean = false
 				}
 			}
 		}
 		if snapBase != (common.Hash{}) {
-			log.Info("Writing snapshot state to disk", "root", snapBase)
-			if err := triedb.Commit(snapBase, true, nil); err != nil {
-				log.Error("Failed to commit recent state trie", "err", err)
+			if expired() {
+				log.Warn("State flush deadline exceeded, skipping snapshot state", "root", snapBase, "timeout", bc.cacheConfig.TrieFlushTimeout)
+			} else {
+				log.Info("Writing snapshot state to disk", "root", snapBase)
+				if err := triedb.Commit(snapBase, true, nil); err != nil {
+					log.Error("Failed to commit recent state trie", "err", err)
+					clean = false
+				}
 			}
 		}
 		for !bc.triegc.Empty() {
@@ -983,10 +1098,15 @@ func (bc *BlockChain) Stop() {
 	// Ensure all live cached entries be saved into disk, so that we can skip
 	// cache warmup when node restarts.
 	if bc.cacheConfig.TrieCleanJournal != "" {
-		triedb := bc.stateCache.TrieDB()
-		triedb.SaveCache(bc.cacheConfig.TrieCleanJournal)
+		if expired() {
+			log.Warn("State flush deadline exceeded, skipping trie cache journal", "timeout", bc.cacheConfig.TrieFlushTimeout)
+		} else {
+			triedb := bc.stateCache.TrieDB()
+			triedb.SaveCache(bc.cacheConfig.TrieCleanJournal)
+		}
 	}
-	log.Info("Blockchain stopped")
+	rawdb.WriteShutdownMarker(bc.db, clean)
+	log.Info("Blockchain stopped", "clean", clean)
 }
 
 // StopInsert interrupts all insertion methods, causing them to return
@@ -1069,6 +1189,9 @@ type numberHash struct {
 // InsertReceiptChain attempts to complete an already existing header chain with
 // transaction and receipt data.
 func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain []types.Receipts, ancientLimit uint64) (int, error) {
+	if bc.cacheConfig.SecondaryCatchup > 0 {
+		return 0, errSecondaryChain
+	}
 	// We don't require the chainMu here since we want to maximize the
 	// concurrency of header insertion and receipt insertion.
 	bc.wg.Add(1)
@@ -1393,7 +1516,27 @@ func (bc *BlockChain) TxLookupLimit() uint64 {
 	return bc.txLookupLimit
 }
 
-var lastWrite uint64
+// TrieFlushPolicy retrieves the policy of flushing the in-memory tries to disk.
+func (bc *BlockChain) TrieFlushPolicy() TrieFlushPolicy {
+	return *bc.flushPolicy.Load().(*TrieFlushPolicy)
+}
+
+// SetTrieFlushPolicy changes the policy of flushing the in-memory tries to disk,
+// taking effect from the next block written.
+func (bc *BlockChain) SetTrieFlushPolicy(policy TrieFlushPolicy) error {
+	if bc.cacheConfig.TrieDirtyDisabled {
+		return errors.New("trie flush policy not applicable to archive nodes")
+	}
+	if policy.TimeLimit <= 0 {
+		return fmt.Errorf("invalid trie flush time limit %v", policy.TimeLimit)
+	}
+	if policy.DirtyLimit <= 0 {
+		return fmt.Errorf("invalid trie dirty memory limit %d", policy.DirtyLimit)
+	}
+	bc.flushPolicy.Store(&policy)
+	log.Info("Updated trie flush policy", "time", policy.TimeLimit, "blocks", policy.BlockLimit, "dirty", common.StorageSize(policy.DirtyLimit)*1024*1024)
+	return nil
+}
 
 // writeBlockWithoutState writes only the block and its metadata to the database,
 // but does not write any state. This is used to construct competing side forks
@@ -1460,6 +1603,20 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	rawdb.WriteBlock(blockBatch, block)
 	rawdb.WriteReceipts(blockBatch, block.Hash(), block.NumberU64(), receipts)
 	rawdb.WritePreimages(blockBatch, state.Preimages())
+	if bc.trackSupply {
+		if record, balances, err := bc.supplyRecord(block, state); err != nil {
+			log.Error("Failed to track supply", "number", block.Number(), "hash", block.Hash(), "err", err)
+		} else if record != nil {
+			rawdb.WriteSupply(blockBatch, block.Hash(), block.NumberU64(), record)
+			rawdb.WriteBalanceChanges(blockBatch, block.Hash(), block.NumberU64(), balances)
+		}
+	}
+	if bc.indexContracts {
+		rawdb.WriteContractLookupEntries(blockBatch, block.Hash(), block.NumberU64(), state.Creations())
+	}
+	if bc.indexTokens {
+		rawdb.WriteTokenTransfers(blockBatch, block.Hash(), block.NumberU64(), ParseTokenTransfers(logs))
+	}
 	if err := blockBatch.Write(); err != nil {
 		log.Crit("Failed to write block into disk", "err", err)
 	}
@@ -1483,8 +1640,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		if current := block.NumberU64(); current > TriesInMemory {
 			// If we exceeded our memory allowance, flush matured singleton nodes to disk
 			var (
+				policy      = bc.flushPolicy.Load().(*TrieFlushPolicy)
 				nodes, imgs = triedb.Size()
-				limit       = common.StorageSize(bc.cacheConfig.TrieDirtyLimit) * 1024 * 1024
+				limit       = common.StorageSize(policy.DirtyLimit) * 1024 * 1024
 			)
 			if nodes > limit || imgs > 4*1024*1024 {
 				triedb.Cap(limit - ethdb.IdealBatchSize)
@@ -1492,8 +1650,8 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			// Find the next state trie we need to commit
 			chosen := current - TriesInMemory
 
-			// If we exceeded out time allowance, flush an entire trie to disk
-			if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+			// If we exceeded out time or block allowance, flush an entire trie to disk
+			if bc.gcproc > policy.TimeLimit || (policy.BlockLimit > 0 && chosen >= bc.lastWrite+policy.BlockLimit) {
 				// If the header is missing (canonical chain behind), we're reorging a low
 				// diff sidechain. Suspend committing until this operation is completed.
 				header := bc.GetHeaderByNumber(chosen)
@@ -1502,12 +1660,12 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 				} else {
 					// If we're exceeding limits but haven't reached a large enough memory gap,
 					// warn the user that the system is becoming unstable.
-					if chosen < lastWrite+TriesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
-						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/TriesInMemory)
+					if chosen < bc.lastWrite+TriesInMemory && bc.gcproc >= 2*policy.TimeLimit {
+						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", policy.TimeLimit, "optimum", float64(chosen-bc.lastWrite)/TriesInMemory)
 					}
 					// Flush an entire trie and restart the counters
 					triedb.Commit(header.Root, true, nil)
-					lastWrite = chosen
+					bc.lastWrite = chosen
 					bc.gcproc = 0
 				}
 			}
@@ -1599,6 +1757,9 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	if len(chain) == 0 {
 		return 0, nil
 	}
+	if bc.cacheConfig.SecondaryCatchup > 0 {
+		return 0, errSecondaryChain
+	}
 
 	bc.blockProcFeed.Send(true)
 	defer bc.blockProcFeed.Send(false)
@@ -1820,7 +1981,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		}
 		// Process block using the parent state as reference point
 		substart := time.Now()
-		receipts, logs, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
+		vmConfig := bc.vmConfig
+		vmConfig.OpcodeStats = bc.opcodeStats
+		receipts, logs, usedGas, err := bc.processor.Process(block, statedb, vmConfig)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
@@ -2356,6 +2519,9 @@ Error: %v
 // of the header retrieval mechanisms already need to verify nonces, as well as
 // because nonces can be verified sparsely, not needing to check each.
 func (bc *BlockChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
+	if bc.cacheConfig.SecondaryCatchup > 0 {
+		return 0, errSecondaryChain
+	}
 	start := time.Now()
 	if i, err := bc.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
@@ -0,0 +1,192 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// SetHeadPlan describes what rewinding the chain to a given head unindexes,
+// deletes and truncates, as previewed by SetHeadPreview.
+type SetHeadPlan struct {
+	Target uint64 `json:"target"` // Requested head
+
+	HeadHeader    uint64 `json:"headHeader"`
+	HeadBlock     uint64 `json:"headBlock"`
+	HeadFastBlock uint64 `json:"headFastBlock"`
+
+	NewHeadHeader    uint64 `json:"newHeadHeader"`    // Below the target if the ancient store is wiped
+	NewHeadBlock     uint64 `json:"newHeadBlock"`     // Below the target if its state is missing
+	NewHeadFastBlock uint64 `json:"newHeadFastBlock"` // Genesis if the target block is missing
+
+	DeletedHeaders uint64 `json:"deletedHeaders"` // Headers deleted from the key-value store, side chains included
+	DeletedBodies  uint64 `json:"deletedBodies"`  // Bodies and receipts deleted from the key-value store
+	UnindexedTxs   uint64 `json:"unindexedTxs"`   // Transaction lookup entries deleted
+
+	Ancients         uint64 `json:"ancients"`         // Items in the ancient store
+	RetainedAncients uint64 `json:"retainedAncients"` // Items left by the ancient store truncation
+
+	RemoteAncients         *uint64 `json:"remoteAncients,omitempty"`         // Items moved into a remote ancient store, if any
+	RetainedRemoteAncients *uint64 `json:"retainedRemoteAncients,omitempty"` // Items left in the remote ancient store
+}
+
+// rewindHeadBlock returns the block to rewind the head block to along with the
+// header chain: the given one if its state is available, otherwise the closest
+// ancestor with a state, or the genesis block beyond the fast sync pivot.
+func (bc *BlockChain) rewindHeadBlock(header *types.Header, pivot *uint64) *types.Block {
+	newHeadBlock := bc.GetBlock(header.Hash(), header.Number.Uint64())
+	if newHeadBlock == nil {
+		log.Error("Gap in the chain, rewinding to genesis", "number", header.Number, "hash", header.Hash())
+		return bc.genesisBlock
+	}
+	// Block exists, keep rewinding until we find one with state
+	for {
+		if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
+			log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
+			if pivot == nil || newHeadBlock.NumberU64() > *pivot {
+				newHeadBlock = bc.GetBlock(newHeadBlock.ParentHash(), newHeadBlock.NumberU64()-1)
+				continue
+			} else {
+				log.Trace("Rewind passed pivot, aiming genesis", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash(), "pivot", *pivot)
+				newHeadBlock = bc.genesisBlock
+			}
+		}
+		log.Debug("Rewound to block with state", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
+		return newHeadBlock
+	}
+}
+
+// indexedTxs returns the hashes of the transactions of a block whose lookup
+// entries point to its number, to be unindexed along with the block.
+func (bc *BlockChain) indexedTxs(hash common.Hash, number uint64) []common.Hash {
+	body := rawdb.ReadBody(bc.db, hash, number)
+	if body == nil {
+		return nil
+	}
+	var hashes []common.Hash
+	for _, tx := range body.Transactions {
+		if lookup := rawdb.ReadTxLookupEntry(bc.db, tx.Hash()); lookup != nil && *lookup == number {
+			hashes = append(hashes, tx.Hash())
+		}
+	}
+	return hashes
+}
+
+// SetHeadPreview reports the effects of rewinding the local chain to a new head
+// with SetHead, without modifying anything.
+func (bc *BlockChain) SetHeadPreview(head uint64) *SetHeadPlan {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	pivot := rawdb.ReadLastPivotNumber(bc.db)
+	frozen, _ := bc.db.Ancients()
+
+	var (
+		headHeader = bc.CurrentHeader()
+		headBlock  = bc.CurrentBlock()
+		headFast   = bc.CurrentFastBlock()
+	)
+	plan := &SetHeadPlan{
+		Target:           head,
+		HeadHeader:       headHeader.Number.Uint64(),
+		HeadBlock:        headBlock.NumberU64(),
+		HeadFastBlock:    headFast.NumberU64(),
+		Ancients:         frozen,
+		RetainedAncients: frozen,
+	}
+	// Follow the markers the way setHead updates them
+	block, fast := headBlock, headFast
+	update := func(header *types.Header) (uint64, bool) {
+		if header.Number.Uint64() <= block.NumberU64() {
+			block = bc.rewindHeadBlock(header, pivot)
+		}
+		if header.Number.Uint64() < fast.NumberU64() {
+			if fast = bc.GetBlock(header.Hash(), header.Number.Uint64()); fast == nil {
+				fast = bc.genesisBlock
+			}
+		}
+		var wipe bool
+		if block.NumberU64()+1 < frozen {
+			wipe = pivot == nil || block.NumberU64() >= *pivot
+		}
+		return block.NumberU64(), wipe
+	}
+	walk := true
+	if headBlock.NumberU64() == head {
+		target, force := update(headBlock.Header())
+		walk, head = force, target
+	}
+	// Follow the header chain rewind, tallying the deleted data
+	hdr := headHeader
+	for origin := true; walk && hdr.Number.Uint64() > head; {
+		num := hdr.Number.Uint64()
+
+		parent := bc.GetHeader(hdr.ParentHash, num-1)
+		if parent == nil {
+			parent = bc.genesisBlock.Header()
+		}
+		if newHead, force := update(parent); force && newHead < head {
+			head = newHead
+		}
+		var nums []uint64
+		if origin {
+			for n := num + 1; len(rawdb.ReadAllHashes(bc.db, n)) > 0; n++ {
+				nums = append([]uint64{n}, nums...)
+			}
+			origin = false
+		}
+		nums = append(nums, num)
+
+		for _, num := range nums {
+			hashes := rawdb.ReadAllHashes(bc.db, num)
+			if len(hashes) == 0 {
+				hashes = append(hashes, hdr.Hash())
+			}
+			for _, hash := range hashes {
+				plan.UnindexedTxs += uint64(len(bc.indexedTxs(hash, num)))
+				if num+1 <= plan.RetainedAncients {
+					plan.RetainedAncients = num
+					continue
+				}
+				if rawdb.HasHeader(bc.db, hash, num) {
+					plan.DeletedHeaders++
+				}
+				if rawdb.HasBody(bc.db, hash, num) {
+					plan.DeletedBodies++
+				}
+			}
+		}
+		hdr = parent
+	}
+	plan.NewHeadHeader = hdr.Number.Uint64()
+	plan.NewHeadBlock = block.NumberU64()
+	plan.NewHeadFastBlock = fast.NumberU64()
+
+	// Truncating the ancient store lowers the remote count along with it
+	if remote := rawdb.ReadRemoteAncients(bc.db); remote != nil {
+		retained := *remote
+		if retained > plan.RetainedAncients {
+			retained = plan.RetainedAncients
+		}
+		plan.RemoteAncients, plan.RetainedRemoteAncients = remote, &retained
+	}
+	return plan
+}
@@ -32,8 +32,10 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
 )
 
 // rewindTest is a test case for chain rollback upon user request.
@@ -1757,7 +1759,7 @@ func testSetHead(t *testing.T, tt *rewindTest) {
 	}
 	os.RemoveAll(datadir)
 
-	db, err := rawdb.NewLevelDBDatabaseWithFreezer(datadir, 0, 0, datadir, "")
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(datadir, 0, 0, datadir, "", nil)
 	if err != nil {
 		t.Fatalf("Failed to create persistent database: %v", err)
 	}
@@ -1813,9 +1815,20 @@ func testSetHead(t *testing.T, tt *rewindTest) {
 	if tt.pivotBlock != nil {
 		rawdb.WriteLastPivotNumber(db, *tt.pivotBlock)
 	}
-	// Set the head of the chain back to the requested number
+	// Preview the rewind, then set the head of the chain back to the requested number
+	plan := chain.SetHeadPreview(tt.setheadBlock)
 	chain.SetHead(tt.setheadBlock)
 
+	if plan.NewHeadHeader != tt.expHeadHeader || plan.NewHeadFastBlock != tt.expHeadFastBlock || plan.NewHeadBlock != tt.expHeadBlock {
+		t.Errorf("Previewed heads mismatch: have %d/%d/%d, want %d/%d/%d", plan.NewHeadHeader, plan.NewHeadFastBlock, plan.NewHeadBlock, tt.expHeadHeader, tt.expHeadFastBlock, tt.expHeadBlock)
+	}
+	if int(plan.RetainedAncients) != tt.expFrozen {
+		t.Errorf("Previewed frozen block count mismatch: have %d, want %d", plan.RetainedAncients, tt.expFrozen)
+	}
+	if target := rawdb.ReadSetHeadJournal(db); target != nil {
+		t.Errorf("Rewind journal left over: %d", *target)
+	}
+
 	// Iterate over all the remaining blocks and ensure there are no gaps
 	verifyNoGaps(t, chain, true, canonblocks)
 	verifyNoGaps(t, chain, false, sideblocks)
@@ -1948,3 +1961,67 @@ func verifyCutoff(t *testing.T, chain *BlockChain, canonical bool, inserted type
 func uint64ptr(n uint64) *uint64 {
 	return &n
 }
+
+// Tests that a rewind interrupted before completion is resumed when the chain is
+// reopened, and that the transactions of the discarded blocks are unindexed as
+// previewed.
+func TestSetHeadJournal(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig, Alloc: genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(gendb, gspec)
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+	)
+	MustCommitGenesis(db, gspec)
+	archiveCaching := *defaultCacheConfig
+	archiveCaching.TrieDirtyDisabled = true
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 8, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, err := NewBlockChain(db, &archiveCaching, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to import chain: %v", err)
+	}
+	plan := chain.SetHeadPreview(5)
+	if plan.NewHeadHeader != 5 || plan.NewHeadBlock != 5 || plan.DeletedHeaders != 3 || plan.DeletedBodies != 3 || plan.UnindexedTxs != 3 {
+		t.Fatalf("Preview mismatch: have %+v", plan)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 8 {
+		t.Fatalf("Preview modified the chain: head %d", head)
+	}
+	// Simulate a crash right after the rewind started
+	rawdb.WriteSetHeadJournal(db, 5)
+	chain.Stop()
+
+	chain, err = NewBlockChain(db, &archiveCaching, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock().NumberU64(); head != 5 {
+		t.Fatalf("Rewind not resumed: head %d, want 5", head)
+	}
+	if target := rawdb.ReadSetHeadJournal(db); target != nil {
+		t.Fatalf("Rewind journal left over: %d", *target)
+	}
+	for i, block := range blocks {
+		for _, tx := range block.Transactions() {
+			indexed := rawdb.ReadTxLookupEntry(db, tx.Hash()) != nil
+			if want := block.NumberU64() <= 5; indexed != want {
+				t.Errorf("Block %d transaction index mismatch: have %v, want %v", i+1, indexed, want)
+			}
+		}
+	}
+}
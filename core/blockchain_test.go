@@ -653,7 +653,7 @@ func TestFastVsFullChains(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -727,7 +727,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 			t.Fatalf("failed to create temp freezer dir: %v", err)
 		}
 		defer os.Remove(dir)
-		db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "")
+		db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "", nil)
 		if err != nil {
 			t.Fatalf("failed to create temp freezer db: %v", err)
 		}
@@ -1598,7 +1598,7 @@ func TestBlockchainRecovery(t *testing.T) {
 	}
 	defer os.Remove(frdir)
 
-	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -1655,7 +1655,7 @@ func TestIncompleteAncientReceiptChainInsertion(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -1854,7 +1854,7 @@ func testInsertKnownChainData(t *testing.T, typ string) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(dir)
-	chaindb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "")
+	chaindb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -2134,7 +2134,7 @@ func TestTransactionIndices(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -2162,7 +2162,7 @@ func TestTransactionIndices(t *testing.T) {
 	// Init block chain with external ancients, check all needed indices has been indexed.
 	limit := []uint64{0, 32, 64, 128}
 	for _, l := range limit {
-		ancientDb, err = rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+		ancientDb, err = rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 		if err != nil {
 			t.Fatalf("failed to create temp freezer db: %v", err)
 		}
@@ -2182,7 +2182,7 @@ func TestTransactionIndices(t *testing.T) {
 	}
 
 	// Reconstruct a block chain which only reserves HEAD-64 tx indices
-	ancientDb, err = rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err = rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -2261,7 +2261,7 @@ func TestSkipStaleTxIndicesInFastSync(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -3036,3 +3036,238 @@ func TestInitThenFailCreateContract(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the opcode statistics are collected from the imported blocks.
+func TestOpcodeStats(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		aa      = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				aa: {
+					Code:    []byte{byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.SSTORE)},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), aa, new(big.Int), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		block.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if chain.OpcodeStats() != nil {
+		t.Fatalf("opcode statistics collected by default")
+	}
+	chain.EnableOpcodeStats()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	stats := chain.OpcodeStats().Snapshot()
+	if stat := stats["SSTORE"]; stat == nil || stat.Count != 2 {
+		t.Fatalf("SSTORE stats mismatch: have %+v, want 2 executions", stat)
+	}
+	if stat := stats["PUSH1"]; stat == nil || stat.Count != 4 || stat.Gas != 12 {
+		t.Fatalf("PUSH1 stats mismatch: have %+v, want 4 executions using 12 gas", stat)
+	}
+}
+
+// Tests that the contracts deployed by transactions and by contracts are indexed
+// by address and code hash, leaving out the deployments which were reverted.
+func TestContractIndex(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		aa      = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		bb      = common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+
+		// initcode deploys the single byte 0xfe as contract code
+		initcode = []byte{
+			byte(vm.PUSH1), 0xfe, byte(vm.PUSH1), 0, byte(vm.MSTORE8),
+			byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.RETURN),
+		}
+		// factory deploys the initcode, optionally reverting afterwards
+		factory = func(revert bool) []byte {
+			code := append([]byte{byte(vm.PUSH10)}, initcode...)
+			code = append(code, byte(vm.PUSH1), 0, byte(vm.MSTORE))
+			code = append(code, byte(vm.PUSH1), byte(len(initcode)), byte(vm.PUSH1), byte(32-len(initcode)), byte(vm.PUSH1), 0, byte(vm.CREATE))
+			if revert {
+				code = append(code, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.REVERT))
+			}
+			return code
+		}
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				aa:      {Code: factory(false), Balance: big.NewInt(0)},
+				bb:      {Code: factory(true), Balance: big.NewInt(0)},
+			},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, block *BlockGen) {
+		var txs []*types.Transaction
+		if i == 0 {
+			txs = append(txs, types.NewContractCreation(block.TxNonce(address), new(big.Int), 100000, big.NewInt(1), initcode))
+		} else {
+			txs = append(txs, types.NewTransaction(block.TxNonce(address), aa, new(big.Int), 100000, big.NewInt(1), nil))
+			txs = append(txs, types.NewTransaction(block.TxNonce(address)+1, bb, new(big.Int), 100000, big.NewInt(1), nil))
+		}
+		for _, tx := range txs {
+			tx, _ = types.SignTx(tx, types.HomesteadSigner{}, key)
+			block.AddTx(tx)
+		}
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	chain.EnableContractIndex()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var (
+		codeHash = crypto.Keccak256Hash([]byte{0xfe})
+		direct   = crypto.CreateAddress(address, 0)
+		nested   = crypto.CreateAddress(aa, 0)
+	)
+	for _, want := range []struct {
+		address common.Address
+		creator common.Address
+		block   *types.Block
+		txIndex uint
+	}{
+		{direct, address, blocks[0], 0},
+		{nested, aa, blocks[1], 0},
+	} {
+		entries := rawdb.ReadContractLookupEntries(diskdb, want.address)
+		if len(entries) != 1 {
+			t.Fatalf("contract %x: have %d lookup entries, want 1", want.address, len(entries))
+		}
+		entry := entries[0]
+		if entry.BlockHash != want.block.Hash() || entry.BlockNumber != want.block.NumberU64() {
+			t.Errorf("contract %x: block mismatch: have #%d [%x], want #%d [%x]", want.address, entry.BlockNumber, entry.BlockHash, want.block.NumberU64(), want.block.Hash())
+		}
+		if tx := want.block.Transactions()[want.txIndex]; entry.Creation.TxHash != tx.Hash() || entry.Creation.TxIndex != want.txIndex {
+			t.Errorf("contract %x: transaction mismatch: have %d [%x], want %d [%x]", want.address, entry.Creation.TxIndex, entry.Creation.TxHash, want.txIndex, tx.Hash())
+		}
+		if entry.Creation.Creator != want.creator || entry.Creation.CodeHash != codeHash {
+			t.Errorf("contract %x: creation mismatch: have %+v", want.address, entry.Creation)
+		}
+	}
+	if entries := rawdb.ReadContractLookupEntries(diskdb, crypto.CreateAddress(bb, 0)); len(entries) != 0 {
+		t.Errorf("reverted deployment indexed")
+	}
+	entries := rawdb.ReadCodeHashLookupEntries(diskdb, codeHash)
+	if len(entries) != 2 {
+		t.Fatalf("have %d code hash lookup entries, want 2", len(entries))
+	}
+	found := map[common.Address]bool{entries[0].Creation.Address: true, entries[1].Creation.Address: true}
+	if !found[direct] || !found[nested] {
+		t.Errorf("code hash lookup mismatch: have %x and %x", entries[0].Creation.Address, entries[1].Creation.Address)
+	}
+}
+
+// Tests that the shutdown marker tracks whether the chain state was flushed on
+// the last shutdown, and that the flush deadline still commits the head state.
+func TestShutdownMarker(t *testing.T) {
+	var (
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0x01})
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+
+	// A running chain is marked unclean, a stopped one clean
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if marker := rawdb.ReadShutdownMarker(diskdb); marker == nil || marker.Clean {
+		t.Fatalf("running chain marker mismatch: have %+v, want unclean", marker)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+	if marker := rawdb.ReadShutdownMarker(diskdb); marker == nil || !marker.Clean {
+		t.Fatalf("stopped chain marker mismatch: have %+v, want clean", marker)
+	}
+	// An expired flush deadline commits the head state only and marks it unclean
+	cache := *defaultCacheConfig
+	cache.TrieFlushTimeout = time.Nanosecond
+
+	chain, _ = NewBlockChain(diskdb, &cache, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	head := chain.CurrentBlock()
+	chain.Stop()
+	if marker := rawdb.ReadShutdownMarker(diskdb); marker == nil || marker.Clean {
+		t.Fatalf("expired flush marker mismatch: have %+v, want unclean", marker)
+	}
+	if _, err := state.New(head.Root(), state.NewDatabase(diskdb), nil); err != nil {
+		t.Fatalf("head state missing after expired flush: %v", err)
+	}
+}
+
+// Tests that the trie flush policy can be changed at runtime, flushing the state
+// to disk every configured number of blocks.
+func TestTrieFlushPolicy(t *testing.T) {
+	var (
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, TriesInMemory+12, func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0x01})
+	})
+	for _, limit := range []uint64{0, 4} {
+		diskdb := rawdb.NewMemoryDatabase()
+		MustCommitGenesis(diskdb, gspec)
+
+		chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+		policy := chain.TrieFlushPolicy()
+		if policy.TimeLimit != defaultCacheConfig.TrieTimeLimit || policy.BlockLimit != 0 || policy.DirtyLimit != defaultCacheConfig.TrieDirtyLimit {
+			t.Fatalf("initial policy mismatch: have %+v", policy)
+		}
+		policy.BlockLimit = limit
+		if err := chain.SetTrieFlushPolicy(policy); err != nil {
+			t.Fatalf("failed to set policy: %v", err)
+		}
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		for i := 1; i <= 12; i++ {
+			root := blocks[i-1].Root()
+			want := limit > 0 && uint64(i)%limit == 0
+			if have := rawdb.ReadTrieNode(diskdb, root) != nil; have != want {
+				t.Errorf("block limit %d: state of block #%d flushed %v, want %v", limit, i, have, want)
+			}
+		}
+		chain.Stop()
+	}
+	// Invalid policies are rejected
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	for _, policy := range []TrieFlushPolicy{{TimeLimit: 0, DirtyLimit: 256}, {TimeLimit: time.Minute, DirtyLimit: 0}} {
+		if err := chain.SetTrieFlushPolicy(policy); err == nil {
+			t.Errorf("invalid policy %+v accepted", policy)
+		}
+	}
+}
@@ -520,3 +520,27 @@ func (c *ChainIndexer) removeSectionHead(section uint64) {
 
 	c.indexDb.Delete(append([]byte("shead"), data[:]...))
 }
+
+// WriteChainIndexSections overwrites the processed sections recorded in the index
+// database of a chain indexer with the given section heads, dropping any stored
+// beyond them. It's meant for tools regenerating an index offline.
+func WriteChainIndexSections(indexDb ethdb.Database, heads []common.Hash) {
+	var stored uint64
+	if data, _ := indexDb.Get([]byte("count")); len(data) == 8 {
+		stored = binary.BigEndian.Uint64(data)
+	}
+	// Write the section heads before the count, so the index is never considered
+	// to contain sections it has no heads for
+	var data [8]byte
+	for section, head := range heads {
+		binary.BigEndian.PutUint64(data[:], uint64(section))
+		indexDb.Put(append([]byte("shead"), data[:]...), head.Bytes())
+	}
+	binary.BigEndian.PutUint64(data[:], uint64(len(heads)))
+	indexDb.Put([]byte("count"), data[:])
+
+	for section := uint64(len(heads)); section < stored; section++ {
+		binary.BigEndian.PutUint64(data[:], section)
+		indexDb.Delete(append([]byte("shead"), data[:]...))
+	}
+}
@@ -78,6 +78,7 @@ func SetupGenesisBlock(db ethdb.Database, genesis *genesisT.Genesis) (ctypes.Cha
 		// Ensure the stored genesis matches with the given one.
 		hash := GenesisToBlock(genesis, nil).Hash()
 		if hash != stored {
+			logGenesisMismatch(db, stored, genesis)
 			return genesis.Config, hash, &genesisT.GenesisMismatchError{Stored: stored, New: hash}
 		}
 		block, err := CommitGenesis(genesis, db)
@@ -91,6 +92,7 @@ func SetupGenesisBlock(db ethdb.Database, genesis *genesisT.Genesis) (ctypes.Cha
 	if genesis != nil {
 		hash := GenesisToBlock(genesis, nil).Hash()
 		if hash != stored {
+			logGenesisMismatch(db, stored, genesis)
 			return genesis.Config, hash, &genesisT.GenesisMismatchError{Stored: stored, New: hash}
 		}
 	}
@@ -127,8 +129,10 @@ func SetupGenesisBlock(db ethdb.Database, genesis *genesisT.Genesis) (ctypes.Cha
 	}
 	compatErr := confp.Compatible(height, storedcfg, newcfg)
 	if compatErr != nil && *height != 0 && compatErr.RewindTo != 0 {
+		logConfigDiff(log.Warn, "Incompatible chain config change", storedcfg, newcfg)
 		return newcfg, stored, compatErr
 	}
+	logConfigDiff(log.Info, "Updating stored chain config", storedcfg, newcfg)
 	rawdb.WriteChainConfig(db, stored, newcfg)
 	return newcfg, stored, nil
 }
@@ -178,6 +182,15 @@ func GenesisToBlock(g *genesisT.Genesis, db ethdb.Database) *types.Block {
 		}
 	}
 	root := statedb.IntermediateRoot(false)
+	head := genesisHeader(g, root)
+	statedb.Commit(false)
+	statedb.Database().TrieDB().Commit(root, true, nil)
+
+	return types.NewBlock(head, nil, nil, nil, new(trie.Trie))
+}
+
+// genesisHeader creates the header of a genesis block with the given state root.
+func genesisHeader(g *genesisT.Genesis, root common.Hash) *types.Header {
 	head := &types.Header{
 		Number:     new(big.Int).SetUint64(g.Number),
 		Nonce:      types.EncodeNonce(g.Nonce),
@@ -197,10 +210,7 @@ func GenesisToBlock(g *genesisT.Genesis, db ethdb.Database) *types.Block {
 	if g.Difficulty == nil {
 		head.Difficulty = vars.GenesisDifficulty
 	}
-	statedb.Commit(false)
-	statedb.Database().TrieDB().Commit(root, true, nil)
-
-	return types.NewBlock(head, nil, nil, nil, new(trie.Trie))
+	return head
 }
 
 // CommitGenesis writes the block and state of a genesis specification to the database.
@@ -210,6 +220,13 @@ func CommitGenesis(g *genesisT.Genesis, db ethdb.Database) (*types.Block, error)
 	if block.Number().Sign() != 0 {
 		return nil, fmt.Errorf("can't commit genesis block with number > 0")
 	}
+	writeGenesis(g, db, block)
+	return block, nil
+}
+
+// writeGenesis writes a genesis block to the database as the canonical head
+// block, along with the chain configuration of the genesis specification.
+func writeGenesis(g *genesisT.Genesis, db ethdb.Database, block *types.Block) {
 	config := g.Config
 	if config == nil {
 		config = params.AllEthashProtocolChanges
@@ -222,7 +239,6 @@ func CommitGenesis(g *genesisT.Genesis, db ethdb.Database) (*types.Block, error)
 	rawdb.WriteHeadFastBlockHash(db, block.Hash())
 	rawdb.WriteHeadHeaderHash(db, block.Hash())
 	rawdb.WriteChainConfig(db, block.Hash(), config)
-	return block, nil
 }
 
 // MustCommitGenesis writes the genesis block and state to db, panicking on error.
@@ -0,0 +1,89 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// DiffGenesis compares the header of a stored genesis block with the one of the
+// block of the given genesis specification, field by field, named after the
+// fields of the specification. Differing allocations show up as differing state
+// roots of the Alloc field.
+func DiffGenesis(stored *types.Header, genesis *genesisT.Genesis) []ctypes.FieldDiff {
+	header := GenesisToBlock(genesis, nil).Header()
+
+	var diffs []ctypes.FieldDiff
+	add := func(field string, a, b interface{}, equal bool) {
+		if !equal {
+			diffs = append(diffs, ctypes.FieldDiff{Field: field, Stored: a, New: b})
+		}
+	}
+	add("Alloc", stored.Root, header.Root, stored.Root == header.Root)
+	add("Coinbase", stored.Coinbase, header.Coinbase, stored.Coinbase == header.Coinbase)
+	add("Difficulty", stored.Difficulty, header.Difficulty, bigEqual(stored.Difficulty, header.Difficulty))
+	add("ExtraData", hexutil.Bytes(stored.Extra), hexutil.Bytes(header.Extra), string(stored.Extra) == string(header.Extra))
+	add("GasLimit", stored.GasLimit, header.GasLimit, stored.GasLimit == header.GasLimit)
+	add("GasUsed", stored.GasUsed, header.GasUsed, stored.GasUsed == header.GasUsed)
+	add("Mixhash", stored.MixDigest, header.MixDigest, stored.MixDigest == header.MixDigest)
+	add("Nonce", hexutil.Uint64(stored.Nonce.Uint64()), hexutil.Uint64(header.Nonce.Uint64()), stored.Nonce == header.Nonce)
+	add("Number", stored.Number, header.Number, bigEqual(stored.Number, header.Number))
+	add("ParentHash", stored.ParentHash, header.ParentHash, stored.ParentHash == header.ParentHash)
+	add("Timestamp", stored.Time, header.Time, stored.Time == header.Time)
+	return diffs
+}
+
+// bigEqual reports whether two possibly nil big integers are the same.
+func bigEqual(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+// logGenesisMismatch explains why the genesis specification doesn't match the
+// genesis block stored in the database, logging the differing fields of the
+// genesis blocks and of their chain configurations.
+func logGenesisMismatch(db ethdb.Database, stored common.Hash, genesis *genesisT.Genesis) {
+	header := rawdb.ReadHeader(db, stored, 0)
+	if header == nil {
+		return
+	}
+	for _, diff := range DiffGenesis(header, genesis) {
+		log.Error("Genesis block mismatch", "field", diff.Field, "stored", ctypes.FormatDiffValue(diff.Stored), "new", ctypes.FormatDiffValue(diff.New))
+	}
+	if storedcfg := rawdb.ReadChainConfig(db, stored); storedcfg != nil && genesis.Config != nil {
+		logConfigDiff(log.Error, "Chain config mismatch", storedcfg, genesis.Config)
+	}
+}
+
+// logConfigDiff logs the fields differing between two chain configurations.
+func logConfigDiff(logf func(msg string, ctx ...interface{}), msg string, stored, new ctypes.ChainConfigurator) {
+	for _, diff := range confp.Diff(stored, new) {
+		logf(msg, "field", diff.Field, "stored", ctypes.FormatDiffValue(diff.Stored), "new", ctypes.FormatDiffValue(diff.New))
+	}
+}
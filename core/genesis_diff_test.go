@@ -0,0 +1,48 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that the fields of a genesis specification differing from the stored
+// genesis block are reported.
+func TestDiffGenesis(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	stored := MustCommitGenesis(db, params.DefaultMordorGenesisBlock())
+
+	if diffs := DiffGenesis(stored.Header(), params.DefaultMordorGenesisBlock()); len(diffs) != 0 {
+		t.Fatalf("same genesis reported different: %v", diffs)
+	}
+	custom := params.DefaultMordorGenesisBlock()
+	custom.GasLimit++
+	custom.Alloc = genesisT.GenesisAlloc{{1}: {Balance: big.NewInt(1)}}
+
+	diffs := DiffGenesis(stored.Header(), custom)
+	if len(diffs) != 2 || diffs[0].Field != "Alloc" || diffs[1].Field != "GasLimit" {
+		t.Fatalf("diff mismatch: %v", diffs)
+	}
+	if _, _, err := SetupGenesisBlock(db, custom); err == nil {
+		t.Fatal("mismatching genesis accepted")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// allocCommitInterval is the number of streamed genesis accounts after which
+	// the state is committed, to drop the cached accounts from memory.
+	allocCommitInterval = 10000
+
+	// allocFlushSize is the size of the dirty trie nodes above which they are
+	// flushed to disk while streaming genesis accounts.
+	allocFlushSize = 256 * 1024 * 1024
+)
+
+// AllocStream is a stream of genesis accounts, allowing allocations too large
+// to be held in memory.
+type AllocStream interface {
+	// Next returns the next account of the stream, or io.EOF at the end.
+	Next() (common.Address, *genesisT.GenesisAccount, error)
+
+	// Close releases the resources of the stream.
+	Close() error
+}
+
+// OpenAllocFile opens a file of genesis accounts as a stream. Files ending with
+// .csv hold one account per line as address,balance[,nonce[,code]], with an
+// optional header line. Any other file is treated as JSON Lines, holding one
+// account per line in the format of the genesis alloc section, along with an
+// "address" field.
+func OpenAllocFile(path string) (AllocStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		r := csv.NewReader(bufio.NewReader(file))
+		r.FieldsPerRecord = -1
+		r.ReuseRecord = true
+		return &csvAllocStream{file: file, reader: r}, nil
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	return &jsonAllocStream{file: file, scanner: scanner}, nil
+}
+
+// csvAllocStream is a stream of genesis accounts read from a CSV file.
+type csvAllocStream struct {
+	file   *os.File
+	reader *csv.Reader
+	line   int
+}
+
+func (s *csvAllocStream) Next() (common.Address, *genesisT.GenesisAccount, error) {
+	for {
+		record, err := s.reader.Read()
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		s.line++
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if s.line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue // header line
+		}
+		addr, account, err := parseAllocRecord(record)
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		return addr, account, nil
+	}
+}
+
+func (s *csvAllocStream) Close() error {
+	return s.file.Close()
+}
+
+// parseAllocRecord parses a CSV record of a genesis account.
+func parseAllocRecord(record []string) (common.Address, *genesisT.GenesisAccount, error) {
+	if len(record) < 2 || len(record) > 4 {
+		return common.Address{}, nil, fmt.Errorf("have %d fields, want 2 to 4", len(record))
+	}
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+	if !common.IsHexAddress(record[0]) {
+		return common.Address{}, nil, fmt.Errorf("invalid address %q", record[0])
+	}
+	balance, ok := math.ParseBig256(record[1])
+	if !ok {
+		return common.Address{}, nil, fmt.Errorf("invalid balance %q", record[1])
+	}
+	account := &genesisT.GenesisAccount{Balance: balance}
+	if len(record) > 2 && record[2] != "" {
+		nonce, ok := math.ParseUint64(record[2])
+		if !ok {
+			return common.Address{}, nil, fmt.Errorf("invalid nonce %q", record[2])
+		}
+		account.Nonce = nonce
+	}
+	if len(record) > 3 && record[3] != "" {
+		code, err := hexutil.Decode(record[3])
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("invalid code: %v", err)
+		}
+		account.Code = code
+	}
+	return common.HexToAddress(record[0]), account, nil
+}
+
+// jsonAllocStream is a stream of genesis accounts read from a JSON Lines file.
+type jsonAllocStream struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (s *jsonAllocStream) Next() (common.Address, *genesisT.GenesisAccount, error) {
+	for s.scanner.Scan() {
+		s.line++
+		blob := s.scanner.Bytes()
+		if len(strings.TrimSpace(string(blob))) == 0 {
+			continue
+		}
+		var entry struct {
+			Address *common.Address `json:"address"`
+		}
+		if err := json.Unmarshal(blob, &entry); err != nil {
+			return common.Address{}, nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		if entry.Address == nil {
+			return common.Address{}, nil, fmt.Errorf("line %d: missing address", s.line)
+		}
+		account := new(genesisT.GenesisAccount)
+		if err := json.Unmarshal(blob, account); err != nil {
+			return common.Address{}, nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		return *entry.Address, account, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return common.Address{}, nil, err
+	}
+	return common.Address{}, nil, io.EOF
+}
+
+func (s *jsonAllocStream) Close() error {
+	return s.file.Close()
+}
+
+// CommitGenesisStream writes the block and state of a genesis specification to
+// the database like CommitGenesis, adding the accounts read from the stream to
+// the allocation of the specification. The state is committed periodically, so
+// the streamed accounts don't need to fit into memory. Accounts present more than
+// once are rejected.
+//
+// If root is set, the state root of the genesis block is checked against it and
+// the block isn't written on a mismatch.
+func CommitGenesisStream(g *genesisT.Genesis, db ethdb.Database, alloc AllocStream, root *common.Hash) (*types.Block, error) {
+	if g.Number != 0 {
+		return nil, errors.New("can't commit genesis block with number > 0")
+	}
+	var (
+		sdb        = state.NewDatabase(db)
+		statedb, _ = state.New(common.Hash{}, sdb, nil)
+		prev       common.Hash // Root of the last commit, referenced in the trie database
+		accounts   int
+	)
+	add := func(addr common.Address, account *genesisT.GenesisAccount) error {
+		if statedb.Exist(addr) {
+			return fmt.Errorf("duplicate account %x", addr)
+		}
+		balance := account.Balance
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		statedb.AddBalance(addr, balance)
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+		accounts++
+		return nil
+	}
+	commit := func() (common.Hash, error) {
+		root, err := statedb.Commit(false)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		// Drop the nodes of the previous commit which aren't part of the new one
+		triedb := sdb.TrieDB()
+		triedb.Reference(root, common.Hash{})
+		if prev != (common.Hash{}) {
+			triedb.Dereference(prev)
+		}
+		prev = root
+
+		if nodes, _ := triedb.Size(); nodes > allocFlushSize {
+			if err := triedb.Commit(root, false, nil); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		statedb, err = state.New(root, sdb, nil)
+		return root, err
+	}
+	for addr, account := range g.Alloc {
+		account := account
+		if err := add(addr, &account); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		addr, account, err := alloc.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := add(addr, account); err != nil {
+			return nil, err
+		}
+		if accounts%allocCommitInterval == 0 {
+			if _, err := commit(); err != nil {
+				return nil, err
+			}
+			log.Info("Importing genesis accounts", "accounts", accounts)
+		}
+	}
+	stateRoot, err := commit()
+	if err != nil {
+		return nil, err
+	}
+	if root != nil && stateRoot != *root {
+		return nil, fmt.Errorf("genesis state root mismatch: have %x, want %x", stateRoot, *root)
+	}
+	if err := sdb.TrieDB().Commit(stateRoot, true, nil); err != nil {
+		return nil, err
+	}
+	block := types.NewBlock(genesisHeader(g, stateRoot), nil, nil, nil, new(trie.Trie))
+	writeGenesis(g, db, block)
+	log.Info("Imported genesis accounts", "accounts", accounts, "root", stateRoot)
+	return block, nil
+}
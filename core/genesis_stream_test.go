@@ -0,0 +1,144 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that streaming the genesis accounts from CSV and JSON Lines files yields
+// the same genesis block as specifying them in the genesis alloc.
+func TestCommitGenesisStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genesis-stream-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		alloc = genesisT.GenesisAlloc{
+			{0xff}: {Balance: big.NewInt(1), Code: []byte{0x60, 0x00}, Storage: map[common.Hash]common.Hash{{1}: {2}}},
+		}
+		csv   strings.Builder
+		jsonl strings.Builder
+	)
+	csv.WriteString("address,balance,nonce,code\n")
+	for i := 0; i < 2*allocCommitInterval+10; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		account := genesisT.GenesisAccount{Balance: big.NewInt(int64(i)), Nonce: uint64(i % 3)}
+		if i%1000 == 0 {
+			account.Code = []byte{byte(i / 1000)}
+		}
+		alloc[addr] = account
+
+		fmt.Fprintf(&csv, "%s,%d,%d,%#x\n", addr.Hex(), account.Balance, account.Nonce, account.Code)
+		fmt.Fprintf(&jsonl, `{"address":"%s","balance":"%#x","nonce":"%#x","code":"%#x"}`+"\n", addr.Hex(), account.Balance, account.Nonce, account.Code)
+	}
+	spec := &genesisT.Genesis{Config: params.AllEthashProtocolChanges, ExtraData: []byte("stream")}
+	spec.Alloc = alloc
+	want := GenesisToBlock(spec, nil)
+	spec.Alloc = genesisT.GenesisAlloc{{0xff}: alloc[common.Address{0xff}]}
+
+	for name, content := range map[string]string{"alloc.csv": csv.String(), "alloc.jsonl": jsonl.String()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Mismatching roots must be rejected without writing the genesis block
+		db := rawdb.NewMemoryDatabase()
+		stream, err := OpenAllocFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CommitGenesisStream(spec, db, stream, &common.Hash{0x01}); err == nil {
+			t.Errorf("%s: mismatching root accepted", name)
+		}
+		stream.Close()
+		if hash := rawdb.ReadCanonicalHash(db, 0); hash != (common.Hash{}) {
+			t.Errorf("%s: genesis block written despite root mismatch", name)
+		}
+		// Matching roots must yield the same genesis block
+		db = rawdb.NewMemoryDatabase()
+		if stream, err = OpenAllocFile(path); err != nil {
+			t.Fatal(err)
+		}
+		root := want.Root()
+		block, err := CommitGenesisStream(spec, db, stream, &root)
+		stream.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to commit genesis: %v", name, err)
+		}
+		if block.Hash() != want.Hash() {
+			t.Errorf("%s: genesis hash mismatch: have %x, want %x", name, block.Hash(), want.Hash())
+		}
+		if hash := rawdb.ReadCanonicalHash(db, 0); hash != want.Hash() {
+			t.Errorf("%s: canonical genesis mismatch: have %x, want %x", name, hash, want.Hash())
+		}
+		if _, hash, err := SetupGenesisBlock(db, nil); err != nil || hash != want.Hash() {
+			t.Errorf("%s: stored genesis not usable: hash %x, err %v", name, hash, err)
+		}
+	}
+}
+
+// Tests that accounts present more than once and malformed lines are rejected.
+func TestCommitGenesisStreamInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genesis-stream-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"duplicate.csv":   "0x0000000000000000000000000000000000000001,1\n0x0000000000000000000000000000000000000001,2\n",
+		"genesis.csv":     "0xff00000000000000000000000000000000000000,1\n",
+		"address.csv":     "0x01,1\n",
+		"balance.csv":     "0x0000000000000000000000000000000000000001,one\n",
+		"fields.csv":      "0x0000000000000000000000000000000000000001,1,0,0x,extra\n",
+		"duplicate.jsonl": "{\"address\":\"0x0000000000000000000000000000000000000001\",\"balance\":\"1\"}\n{\"address\":\"0x0000000000000000000000000000000000000001\",\"balance\":\"1\"}\n",
+		"missing.jsonl":   "{\"balance\":\"1\"}\n",
+		"garbage.jsonl":   "{\n",
+	}
+	spec := &genesisT.Genesis{
+		Config: params.AllEthashProtocolChanges,
+		Alloc:  genesisT.GenesisAlloc{{0xff}: {Balance: big.NewInt(1)}},
+	}
+	for name, content := range tests {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stream, err := OpenAllocFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CommitGenesisStream(spec, rawdb.NewMemoryDatabase(), stream, nil); err == nil {
+			t.Errorf("%s: invalid allocation accepted", name)
+		}
+		stream.Close()
+	}
+}
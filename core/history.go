@@ -0,0 +1,89 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// EnableHistoryPruning starts discarding the bodies and receipts of the blocks
+// older than the given number of recent blocks as the chain progresses, both
+// from the key-value store and the ancient store, retaining all the headers.
+// Pruned blocks can't be served or rewound to anymore.
+func (bc *BlockChain) EnableHistoryPruning(retain uint64) {
+	if retain == 0 {
+		return
+	}
+	bc.historyRetain = retain
+	go bc.maintainHistory()
+}
+
+// HistoryTail returns the number of the oldest block whose body and receipts
+// are retained.
+func (bc *BlockChain) HistoryTail() uint64 {
+	if tail := rawdb.ReadHistoryTail(bc.db); tail != nil {
+		return *tail
+	}
+	return 0
+}
+
+// maintainHistory moves the history tail along with the chain head, pruning
+// the blocks falling out of the retention window in the background.
+func (bc *BlockChain) maintainHistory() {
+	prune := func(head uint64, done chan struct{}) {
+		defer func() { done <- struct{}{} }()
+
+		if head < bc.historyRetain {
+			return
+		}
+		tail := head - bc.historyRetain + 1
+		if err := rawdb.PruneHistory(bc.db, tail); err != nil {
+			log.Error("Failed to prune chain history", "tail", tail, "err", err)
+		}
+	}
+	var (
+		done   chan struct{}                  // Non-nil if background pruning is active
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	// Catch up with the current head right away
+	done = make(chan struct{})
+	go prune(bc.CurrentBlock().NumberU64(), done)
+
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				done = make(chan struct{})
+				go prune(head.Block.NumberU64(), done)
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				<-done
+			}
+			return
+		}
+	}
+}
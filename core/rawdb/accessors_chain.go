@@ -213,6 +213,40 @@ func WriteLastPivotNumber(db ethdb.KeyValueWriter, pivot uint64) {
 	}
 }
 
+// ReceiptVerification is the progress of verifying the receipts of the blocks
+// imported without execution by fast sync against their headers.
+type ReceiptVerification struct {
+	Number        uint64 // Last verified block, the verification watermark
+	Mismatches    uint64 // Number of blocks whose receipts didn't match
+	FirstMismatch uint64 // First block whose receipts didn't match, if any
+}
+
+// ReadReceiptVerification retrieves the progress of the receipt verification,
+// nil if it never ran.
+func ReadReceiptVerification(db ethdb.KeyValueReader) *ReceiptVerification {
+	enc, _ := db.Get(receiptVerificationKey)
+	if len(enc) == 0 {
+		return nil
+	}
+	progress := new(ReceiptVerification)
+	if err := rlp.DecodeBytes(enc, progress); err != nil {
+		log.Error("Invalid receipt verification progress", "err", err)
+		return nil
+	}
+	return progress
+}
+
+// WriteReceiptVerification stores the progress of the receipt verification.
+func WriteReceiptVerification(db ethdb.KeyValueWriter, progress *ReceiptVerification) {
+	enc, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		log.Crit("Failed to encode receipt verification progress", "err", err)
+	}
+	if err := db.Put(receiptVerificationKey, enc); err != nil {
+		log.Crit("Failed to store receipt verification progress", "err", err)
+	}
+}
+
 // ReadFastTrieProgress retrieves the number of tries nodes fast synced to allow
 // reporting correct numbers across restarts.
 func ReadFastTrieProgress(db ethdb.KeyValueReader) uint64 {
@@ -231,6 +265,44 @@ func WriteFastTrieProgress(db ethdb.KeyValueWriter, count uint64) {
 	}
 }
 
+// StateSyncProgress is the progress of the fast sync state download, persisted
+// to continue reporting it across restarts.
+type StateSyncProgress struct {
+	Root       common.Hash // State root the download targeted
+	Processed  uint64      // Number of state entries processed
+	Pending    uint64      // Number of state entries still pending
+	Duplicate  uint64      // Number of state entries downloaded twice
+	Unexpected uint64      // Number of non-requested state entries received
+}
+
+// ReadStateSyncProgress retrieves the progress of the fast sync state download.
+// Databases synced by previous versions only report the processed entries.
+func ReadStateSyncProgress(db ethdb.KeyValueReader) *StateSyncProgress {
+	enc, _ := db.Get(stateSyncProgressKey)
+	if len(enc) == 0 {
+		return &StateSyncProgress{Processed: ReadFastTrieProgress(db)}
+	}
+	progress := new(StateSyncProgress)
+	if err := rlp.DecodeBytes(enc, progress); err != nil {
+		log.Error("Invalid state sync progress", "err", err)
+		return &StateSyncProgress{Processed: ReadFastTrieProgress(db)}
+	}
+	return progress
+}
+
+// WriteStateSyncProgress stores the progress of the fast sync state download,
+// along with the plain processed counter for previous versions.
+func WriteStateSyncProgress(db ethdb.KeyValueWriter, progress *StateSyncProgress) {
+	enc, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		log.Crit("Failed to encode state sync progress", "err", err)
+	}
+	if err := db.Put(stateSyncProgressKey, enc); err != nil {
+		log.Crit("Failed to store state sync progress", "err", err)
+	}
+	WriteFastTrieProgress(db, progress.Processed)
+}
+
 // ReadTxIndexTail retrieves the number of oldest indexed block
 // whose transaction indices has been indexed. If the corresponding entry
 // is non-existent in database it means the indexing has been finished.
@@ -268,6 +340,24 @@ func WriteFastTxLookupLimit(db ethdb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadRemoteAncients retrieves the number of items the local node moved into a
+// remote ancient store, as recorded after each successful freezer run.
+func ReadRemoteAncients(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(remoteAncientsKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteRemoteAncients stores the number of items moved into a remote ancient store.
+func WriteRemoteAncients(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(remoteAncientsKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the remote ancient count", "err", err)
+	}
+}
+
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -293,6 +383,19 @@ func ReadHeaderRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValu
 	return nil // Can't find the data anywhere.
 }
 
+// ReadCanonicalHeaderRLP retrieves the canonical block header at the given number
+// in its raw RLP database encoding, straight from the ancient store if frozen.
+func ReadCanonicalHeaderRLP(db ethdb.Reader, number uint64) rlp.RawValue {
+	if data, _ := db.Ancient(freezerHeaderTable, number); len(data) > 0 {
+		return data
+	}
+	hash := ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return ReadHeaderRLP(db, hash, number)
+}
+
 // HasHeader verifies the existence of a block header corresponding to the hash.
 func HasHeader(db ethdb.Reader, hash common.Hash, number uint64) bool {
 	if has, err := db.Ancient(freezerHashTable, number); err == nil && common.BytesToHash(has) == hash {
@@ -691,6 +794,7 @@ func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteHeader(db, hash, number)
 	DeleteBody(db, hash, number)
 	DeleteTd(db, hash, number)
+	DeleteSupply(db, hash, number)
 }
 
 // DeleteBlockWithoutNumber removes all block data associated with a hash, except
@@ -28,6 +28,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
@@ -370,7 +371,7 @@ func TestAncientStorage(t *testing.T) {
 	}
 	defer os.Remove(frdir)
 
-	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "")
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create database with ancient backend")
 	}
@@ -457,3 +458,56 @@ func TestCanonicalHashIteration(t *testing.T) {
 		}
 	}
 }
+
+// Tests that canonical headers are retrieved from both the ancient store and the
+// key-value store, ignoring non-canonical ones.
+func TestCanonicalHeaderRLP(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend")
+	}
+	defer db.Close()
+
+	frozen := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Extra: []byte("frozen")})
+	WriteAncientBlock(db, frozen, nil, big.NewInt(1))
+
+	live := &types.Header{Number: big.NewInt(1), ParentHash: frozen.Hash(), Extra: []byte("live")}
+	side := &types.Header{Number: big.NewInt(1), ParentHash: frozen.Hash(), Extra: []byte("side")}
+	WriteHeader(db, live)
+	WriteHeader(db, side)
+	WriteCanonicalHash(db, live.Hash(), 1)
+
+	for number, want := range []common.Hash{frozen.Hash(), live.Hash()} {
+		blob := ReadCanonicalHeaderRLP(db, uint64(number))
+		if have := crypto.Keccak256Hash(blob); have != want {
+			t.Errorf("header #%d mismatch: have %x, want %x", number, have, want)
+		}
+	}
+	if blob := ReadCanonicalHeaderRLP(db, 2); len(blob) != 0 {
+		t.Errorf("non existent header returned")
+	}
+}
+
+func TestStateSyncProgressStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Databases synced by previous versions only report the processed entries
+	WriteFastTrieProgress(db, 10)
+	if progress := ReadStateSyncProgress(db); progress.Processed != 10 || progress.Pending != 0 {
+		t.Fatalf("legacy progress mismatch: %+v", progress)
+	}
+	want := &StateSyncProgress{Root: common.Hash{0x01}, Processed: 20, Pending: 5, Duplicate: 2, Unexpected: 1}
+	WriteStateSyncProgress(db, want)
+	if have := ReadStateSyncProgress(db); *have != *want {
+		t.Fatalf("progress mismatch: have %+v, want %+v", have, want)
+	}
+	if processed := ReadFastTrieProgress(db); processed != 20 {
+		t.Fatalf("legacy progress mismatch: have %d, want 20", processed)
+	}
+}
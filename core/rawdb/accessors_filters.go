@@ -0,0 +1,56 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// installedFilterKey = installedFilterPrefix + id
+func installedFilterKey(id string) []byte {
+	return append(append([]byte{}, installedFilterPrefix...), id...)
+}
+
+// ReadInstalledFilters retrieves the encoded RPC filters persisted across
+// restarts, keyed by their ids.
+func ReadInstalledFilters(db ethdb.Iteratee) map[string][]byte {
+	it := db.NewIterator(installedFilterPrefix, nil)
+	defer it.Release()
+
+	filters := make(map[string][]byte)
+	for it.Next() {
+		id := string(it.Key()[len(installedFilterPrefix):])
+		filters[id] = common.CopyBytes(it.Value())
+	}
+	return filters
+}
+
+// WriteInstalledFilter stores an encoded RPC filter to persist it across restarts.
+func WriteInstalledFilter(db ethdb.KeyValueWriter, id string, enc []byte) {
+	if err := db.Put(installedFilterKey(id), enc); err != nil {
+		log.Crit("Failed to store installed filter", "err", err)
+	}
+}
+
+// DeleteInstalledFilter removes a persisted RPC filter.
+func DeleteInstalledFilter(db ethdb.KeyValueWriter, id string) {
+	if err := db.Delete(installedFilterKey(id)); err != nil {
+		log.Crit("Failed to delete installed filter", "err", err)
+	}
+}
@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -173,3 +174,234 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// UncleLookupEntry is a positional metadata to help looking up an uncle mined
+// by a given account.
+type UncleLookupEntry struct {
+	BlockNumber uint64
+	BlockHash   common.Hash
+	Index       int
+	UncleHash   common.Hash
+}
+
+// WriteUncleLookupEntries stores a positional metadata for every uncle included
+// in a block, keyed by the coinbase of the uncle.
+func WriteUncleLookupEntries(db ethdb.KeyValueWriter, hash common.Hash, number uint64, uncles []*types.Header) {
+	for i, uncle := range uncles {
+		if err := db.Put(uncleMinerKey(uncle.Coinbase, number, hash, i), uncle.Hash().Bytes()); err != nil {
+			log.Crit("Failed to store uncle lookup entry", "err", err)
+		}
+	}
+}
+
+// ReadUncleLookupEntries retrieves the positional metadata of the uncles mined by
+// the given account which were included in blocks of the range [from, to]. The
+// entries of all blocks are returned, canonical or not.
+func ReadUncleLookupEntries(db ethdb.Iteratee, miner common.Address, from, to uint64) []*UncleLookupEntry {
+	prefix := append(uncleMinerPrefix, miner.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var entries []*UncleLookupEntry
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength+1 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number > to {
+			break
+		}
+		entries = append(entries, &UncleLookupEntry{
+			BlockNumber: number,
+			BlockHash:   common.BytesToHash(key[len(prefix)+8 : len(prefix)+8+common.HashLength]),
+			Index:       int(key[len(key)-1]),
+			UncleHash:   common.BytesToHash(it.Value()),
+		})
+	}
+	return entries
+}
+
+// ContractLookupEntry is a contract creation made by a given block.
+type ContractLookupEntry struct {
+	BlockNumber uint64
+	BlockHash   common.Hash
+	Creation    *types.ContractCreation
+}
+
+// WriteContractLookupEntries stores the contract creations made by a block, keyed
+// by the address of the contracts, as well as by their code hash.
+func WriteContractLookupEntries(db ethdb.KeyValueWriter, hash common.Hash, number uint64, creations []*types.ContractCreation) {
+	for _, creation := range creations {
+		data, err := rlp.EncodeToBytes(creation)
+		if err != nil {
+			log.Crit("Failed to encode contract creation", "err", err)
+		}
+		if err := db.Put(contractKey(creation.Address, number, hash), data); err != nil {
+			log.Crit("Failed to store contract lookup entry", "err", err)
+		}
+		if err := db.Put(codeHashKey(creation.CodeHash, creation.Address, number, hash), nil); err != nil {
+			log.Crit("Failed to store code hash lookup entry", "err", err)
+		}
+	}
+}
+
+// ReadContractLookupEntries retrieves the creations of the contract at the given
+// address, in ascending block order. The entries of all blocks are returned,
+// canonical or not.
+func ReadContractLookupEntries(db ethdb.Iteratee, address common.Address) []*ContractLookupEntry {
+	prefix := append(contractPrefix, address.Bytes()...)
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var entries []*ContractLookupEntry
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength {
+			continue
+		}
+		creation := new(types.ContractCreation)
+		if err := rlp.DecodeBytes(it.Value(), creation); err != nil {
+			log.Error("Invalid contract lookup entry RLP", "address", address, "err", err)
+			continue
+		}
+		entries = append(entries, &ContractLookupEntry{
+			BlockNumber: binary.BigEndian.Uint64(key[len(prefix):]),
+			BlockHash:   common.BytesToHash(key[len(prefix)+8:]),
+			Creation:    creation,
+		})
+	}
+	return entries
+}
+
+// ReadCodeHashLookupEntries retrieves the creations of contracts storing the code
+// with the given hash, ordered by contract address. Only the address and the code
+// hash of the creations are filled in. The entries of all blocks are returned,
+// canonical or not.
+func ReadCodeHashLookupEntries(db ethdb.Iteratee, codeHash common.Hash) []*ContractLookupEntry {
+	prefix := append(codeHashPrefix, codeHash.Bytes()...)
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var entries []*ContractLookupEntry
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+common.AddressLength+8+common.HashLength {
+			continue
+		}
+		entries = append(entries, &ContractLookupEntry{
+			BlockNumber: binary.BigEndian.Uint64(key[len(prefix)+common.AddressLength:]),
+			BlockHash:   common.BytesToHash(key[len(prefix)+common.AddressLength+8:]),
+			Creation: &types.ContractCreation{
+				Address:  common.BytesToAddress(key[len(prefix) : len(prefix)+common.AddressLength]),
+				CodeHash: codeHash,
+			},
+		})
+	}
+	return entries
+}
+
+// TokenTransfer is a transfer of ERC-20 or ERC-721 tokens, as announced by the
+// Transfer event of the token contract.
+type TokenTransfer struct {
+	Token       common.Address
+	From        common.Address
+	To          common.Address
+	Value       *big.Int // Amount of ERC-20 tokens, or the id of the ERC-721 token
+	NonFungible bool     // Whether the transfer is of an ERC-721 token
+	TxHash      common.Hash
+	LogIndex    uint
+}
+
+// TokenTransferEntry is a token transfer made by a given block.
+type TokenTransferEntry struct {
+	BlockNumber uint64
+	BlockHash   common.Hash
+	Transfer    *TokenTransfer
+}
+
+// WriteTokenTransfers stores the token transfers made by a block, keyed by both
+// their sender and recipient, and marks the tokens as held by them. Transfers
+// from and to the zero address, i.e. mints and burns, are only indexed for the
+// other party.
+func WriteTokenTransfers(db ethdb.KeyValueWriter, hash common.Hash, number uint64, transfers []*TokenTransfer) {
+	for _, transfer := range transfers {
+		data, err := rlp.EncodeToBytes(transfer)
+		if err != nil {
+			log.Crit("Failed to encode token transfer", "err", err)
+		}
+		for i, party := range []common.Address{transfer.From, transfer.To} {
+			if party == (common.Address{}) || (i == 1 && party == transfer.From) {
+				continue
+			}
+			if err := db.Put(tokenTransferKey(party, number, hash, transfer.LogIndex), data); err != nil {
+				log.Crit("Failed to store token transfer", "err", err)
+			}
+			if err := db.Put(tokenHoldingKey(party, transfer.Token), nil); err != nil {
+				log.Crit("Failed to store token holding", "err", err)
+			}
+			if err := db.Put(tokenHolderKey(transfer.Token, party), nil); err != nil {
+				log.Crit("Failed to store token holder", "err", err)
+			}
+		}
+	}
+}
+
+// ReadTokenTransfers retrieves the token transfers sent or received by the given
+// address in blocks of the range [from, to]. The entries of all blocks are
+// returned, canonical or not.
+func ReadTokenTransfers(db ethdb.Iteratee, address common.Address, from, to uint64) []*TokenTransferEntry {
+	prefix := append(tokenTransferPrefix, address.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var entries []*TokenTransferEntry
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength+4 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number > to {
+			break
+		}
+		transfer := new(TokenTransfer)
+		if err := rlp.DecodeBytes(it.Value(), transfer); err != nil {
+			log.Error("Invalid token transfer RLP", "address", address, "err", err)
+			continue
+		}
+		entries = append(entries, &TokenTransferEntry{
+			BlockNumber: number,
+			BlockHash:   common.BytesToHash(key[len(prefix)+8 : len(prefix)+8+common.HashLength]),
+			Transfer:    transfer,
+		})
+	}
+	return entries
+}
+
+// ReadTokenHoldings retrieves the tokens which were ever transferred to or from
+// the given holder.
+func ReadTokenHoldings(db ethdb.Iteratee, holder common.Address) []common.Address {
+	return readAddressPairs(db, append(tokenHoldingPrefix, holder.Bytes()...))
+}
+
+// ReadTokenHolders retrieves the accounts which ever sent or received the given
+// token.
+func ReadTokenHolders(db ethdb.Iteratee, token common.Address) []common.Address {
+	return readAddressPairs(db, append(tokenHolderPrefix, token.Bytes()...))
+}
+
+// readAddressPairs retrieves the second addresses of the keys made of the given
+// prefix and an address.
+func readAddressPairs(db ethdb.Iteratee, prefix []byte) []common.Address {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var addresses []common.Address
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+common.AddressLength {
+			addresses = append(addresses, common.BytesToAddress(key[len(prefix):]))
+		}
+	}
+	return addresses
+}
@@ -177,3 +177,71 @@ func TestDeleteBloomBits(t *testing.T) {
 	check(1, 1, params.MainnetGenesisHash, true)
 	check(1, 1, params.RinkebyGenesisHash, true)
 }
+
+// Tests that uncle lookup entries are found by miner within the requested range.
+func TestUncleLookupStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	minerA, minerB := common.Address{0xa}, common.Address{0xb}
+	uncles := []*types.Header{
+		{Number: big.NewInt(9), Coinbase: minerA},
+		{Number: big.NewInt(8), Coinbase: minerB},
+	}
+	WriteUncleLookupEntries(db, common.Hash{0x1}, 10, uncles)
+	WriteUncleLookupEntries(db, common.Hash{0x2}, 20, uncles[:1])
+	WriteUncleLookupEntries(db, common.Hash{0x3}, 256, uncles[1:])
+
+	entries := ReadUncleLookupEntries(db, minerA, 0, 100)
+	if len(entries) != 2 {
+		t.Fatalf("entry count mismatch: have %d, want 2", len(entries))
+	}
+	if e := entries[0]; e.BlockNumber != 10 || e.BlockHash != (common.Hash{0x1}) || e.Index != 0 || e.UncleHash != uncles[0].Hash() {
+		t.Fatalf("first entry mismatch: %+v", e)
+	}
+	if entries := ReadUncleLookupEntries(db, minerA, 11, 20); len(entries) != 1 || entries[0].BlockNumber != 20 {
+		t.Fatalf("ranged entries mismatch: %+v", entries)
+	}
+	entries = ReadUncleLookupEntries(db, minerB, 0, 1000)
+	if len(entries) != 2 || entries[0].Index != 1 || entries[1].BlockNumber != 256 || entries[1].Index != 0 {
+		t.Fatalf("second miner entries mismatch: %+v", entries)
+	}
+	if entries := ReadUncleLookupEntries(db, common.Address{0xc}, 0, 1000); len(entries) != 0 {
+		t.Fatalf("unknown miner has entries: %+v", entries)
+	}
+}
+
+// Tests that token transfers are indexed for both parties, except for the zero
+// address, and that the tokens are marked as held by them.
+func TestTokenTransferStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	token, nft := common.Address{0x70}, common.Address{0x71}
+	alice, bob := common.Address{0xa}, common.Address{0xb}
+	WriteTokenTransfers(db, common.Hash{0x1}, 10, []*TokenTransfer{
+		{Token: token, To: alice, Value: big.NewInt(100), LogIndex: 0},
+		{Token: token, From: alice, To: bob, Value: big.NewInt(40), LogIndex: 1},
+	})
+	WriteTokenTransfers(db, common.Hash{0x2}, 20, []*TokenTransfer{
+		{Token: nft, From: bob, To: bob, Value: big.NewInt(7), NonFungible: true, LogIndex: 3},
+	})
+	entries := ReadTokenTransfers(db, alice, 0, 100)
+	if len(entries) != 2 {
+		t.Fatalf("alice transfer count mismatch: have %d, want 2", len(entries))
+	}
+	if e := entries[1]; e.BlockNumber != 10 || e.BlockHash != (common.Hash{0x1}) || e.Transfer.To != bob || e.Transfer.Value.Cmp(big.NewInt(40)) != 0 {
+		t.Fatalf("second alice transfer mismatch: %+v", e.Transfer)
+	}
+	entries = ReadTokenTransfers(db, bob, 11, 100)
+	if len(entries) != 1 || !entries[0].Transfer.NonFungible || entries[0].Transfer.LogIndex != 3 {
+		t.Fatalf("ranged bob transfers mismatch: %+v", entries)
+	}
+	if entries := ReadTokenTransfers(db, common.Address{}, 0, 100); len(entries) != 0 {
+		t.Fatalf("zero address transfers indexed: %+v", entries)
+	}
+	if tokens := ReadTokenHoldings(db, bob); len(tokens) != 2 || tokens[0] != token || tokens[1] != nft {
+		t.Fatalf("bob holdings mismatch: %x", tokens)
+	}
+	if holders := ReadTokenHolders(db, token); len(holders) != 2 || holders[0] != alice || holders[1] != bob {
+		t.Fatalf("token holders mismatch: %x", holders)
+	}
+}
@@ -17,7 +17,9 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -53,6 +55,97 @@ func WriteDatabaseVersion(db ethdb.KeyValueWriter, version uint64) {
 	}
 }
 
+// ShutdownMarker records whether the node flushed its chain state on the last
+// shutdown, and when the marker was last updated.
+type ShutdownMarker struct {
+	Clean bool
+	Time  uint64 // Unix time in seconds
+}
+
+// ReadShutdownMarker retrieves the shutdown marker of the database, nil if the
+// database never ran a chain.
+func ReadShutdownMarker(db ethdb.KeyValueReader) *ShutdownMarker {
+	enc, _ := db.Get(shutdownMarkerKey)
+	if len(enc) == 0 {
+		return nil
+	}
+	marker := new(ShutdownMarker)
+	if err := rlp.DecodeBytes(enc, marker); err != nil {
+		log.Error("Invalid shutdown marker", "err", err)
+		return nil
+	}
+	return marker
+}
+
+// WriteShutdownMarker stores the shutdown marker of the database.
+func WriteShutdownMarker(db ethdb.KeyValueWriter, clean bool) {
+	enc, err := rlp.EncodeToBytes(&ShutdownMarker{Clean: clean, Time: uint64(time.Now().Unix())})
+	if err != nil {
+		log.Crit("Failed to encode shutdown marker", "err", err)
+	}
+	if err = db.Put(shutdownMarkerKey, enc); err != nil {
+		log.Crit("Failed to store shutdown marker", "err", err)
+	}
+}
+
+// ReadSetHeadJournal retrieves the target of the chain rewind in progress, nil
+// if none was interrupted.
+func ReadSetHeadJournal(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(setHeadJournalKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteSetHeadJournal stores the target of a chain rewind about to start.
+func WriteSetHeadJournal(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(setHeadJournalKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the chain rewind journal", "err", err)
+	}
+}
+
+// DeleteSetHeadJournal removes the journal of a completed chain rewind.
+func DeleteSetHeadJournal(db ethdb.KeyValueWriter) {
+	if err := db.Delete(setHeadJournalKey); err != nil {
+		log.Crit("Failed to delete the chain rewind journal", "err", err)
+	}
+}
+
+// FirehoseCursor is the last block whose events the firehose delivered to the
+// broker, the point to resume publishing from.
+type FirehoseCursor struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// ReadFirehoseCursor retrieves the firehose cursor, nil if the firehose never
+// published anything.
+func ReadFirehoseCursor(db ethdb.KeyValueReader) *FirehoseCursor {
+	enc, _ := db.Get(firehoseCursorKey)
+	if len(enc) == 0 {
+		return nil
+	}
+	cursor := new(FirehoseCursor)
+	if err := rlp.DecodeBytes(enc, cursor); err != nil {
+		log.Error("Invalid firehose cursor", "err", err)
+		return nil
+	}
+	return cursor
+}
+
+// WriteFirehoseCursor stores the firehose cursor.
+func WriteFirehoseCursor(db ethdb.KeyValueWriter, number uint64, hash common.Hash) {
+	enc, err := rlp.EncodeToBytes(&FirehoseCursor{Number: number, Hash: hash})
+	if err != nil {
+		log.Crit("Failed to encode firehose cursor", "err", err)
+	}
+	if err = db.Put(firehoseCursorKey, enc); err != nil {
+		log.Crit("Failed to store firehose cursor", "err", err)
+	}
+}
+
 // ReadChainConfig retrieves the consensus settings based on the given genesis hash.
 func ReadChainConfig(db ethdb.KeyValueReader, hash common.Hash) ctypes.ChainConfigurator {
 	data, _ := db.Get(ConfigKey(hash))
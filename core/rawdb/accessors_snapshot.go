@@ -118,3 +118,26 @@ func DeleteSnapshotJournal(db ethdb.KeyValueWriter) {
 		log.Crit("Failed to remove snapshot journal", "err", err)
 	}
 }
+
+// ReadSnapshotAccessProfile retrieves the hashes of the accounts recently read
+// from the snapshot, saved at the last shutdown.
+func ReadSnapshotAccessProfile(db ethdb.KeyValueReader) []common.Hash {
+	data, _ := db.Get(snapshotAccessProfileKey)
+	hashes := make([]common.Hash, len(data)/common.HashLength)
+	for i := range hashes {
+		hashes[i] = common.BytesToHash(data[i*common.HashLength : (i+1)*common.HashLength])
+	}
+	return hashes
+}
+
+// WriteSnapshotAccessProfile stores the hashes of the accounts recently read
+// from the snapshot, to save at shutdown.
+func WriteSnapshotAccessProfile(db ethdb.KeyValueWriter, hashes []common.Hash) {
+	data := make([]byte, 0, len(hashes)*common.HashLength)
+	for _, hash := range hashes {
+		data = append(data, hash[:]...)
+	}
+	if err := db.Put(snapshotAccessProfileKey, data); err != nil {
+		log.Crit("Failed to store snapshot access profile", "err", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// SupplyRecord is the circulating supply at a block, along with the amounts of
+// ether minted and destroyed since genesis that led to it.
+type SupplyRecord struct {
+	Supply   *big.Int // Sum of all account balances after the block
+	Issuance *big.Int // Cumulative block and uncle rewards, excluding the genesis allocation
+	Burned   *big.Int // Cumulative ether destroyed, e.g. by contracts self-destructing to themselves
+}
+
+// ReadSupply retrieves the supply record of a block, or nil if the supply was not
+// tracked at it.
+func ReadSupply(db ethdb.KeyValueReader, hash common.Hash, number uint64) *SupplyRecord {
+	data, _ := db.Get(supplyKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	record := new(SupplyRecord)
+	if err := rlp.DecodeBytes(data, record); err != nil {
+		log.Error("Invalid supply record RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return record
+}
+
+// WriteSupply stores the supply record of a block into the database.
+func WriteSupply(db ethdb.KeyValueWriter, hash common.Hash, number uint64, record *SupplyRecord) {
+	data, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		log.Crit("Failed to RLP encode supply record", "err", err)
+	}
+	if err := db.Put(supplyKey(number, hash), data); err != nil {
+		log.Crit("Failed to store supply record", "err", err)
+	}
+}
+
+// DeleteSupply removes the supply record of a block.
+func DeleteSupply(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(supplyKey(number, hash)); err != nil {
+		log.Crit("Failed to delete supply record", "err", err)
+	}
+}
+
+// BalanceChangeEntry is the balance of an account after a block changing it.
+type BalanceChangeEntry struct {
+	BlockNumber uint64
+	BlockHash   common.Hash
+	Balance     *big.Int
+}
+
+// WriteBalanceChanges stores the balances of the accounts changed by a block.
+func WriteBalanceChanges(db ethdb.KeyValueWriter, hash common.Hash, number uint64, balances map[common.Address]*big.Int) {
+	for address, balance := range balances {
+		if err := db.Put(balanceKey(address, number, hash), balance.Bytes()); err != nil {
+			log.Crit("Failed to store balance change", "err", err)
+		}
+	}
+}
+
+// ReadBalanceChanges retrieves the balance changes of the given account in blocks
+// of the range [from, to], in ascending block order. The entries of all blocks
+// are returned, canonical or not.
+func ReadBalanceChanges(db ethdb.Iteratee, address common.Address, from, to uint64) []*BalanceChangeEntry {
+	prefix := append(balancePrefix, address.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var entries []*BalanceChangeEntry
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number > to {
+			break
+		}
+		entries = append(entries, &BalanceChangeEntry{
+			BlockNumber: number,
+			BlockHash:   common.BytesToHash(key[len(prefix)+8:]),
+			Balance:     new(big.Int).SetBytes(it.Value()),
+		})
+	}
+	return entries
+}
+
+// ReadBalanceIndexTail retrieves the number of the oldest block whose balance
+// changes are indexed, nil if balance changes were never indexed.
+func ReadBalanceIndexTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(balanceIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteBalanceIndexTail stores the number of the oldest block whose balance
+// changes are indexed.
+func WriteBalanceIndexTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(balanceIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the balance index tail", "err", err)
+	}
+}
+
+// DeleteBalanceIndexTail removes the number of the oldest block whose balance
+// changes are indexed.
+func DeleteBalanceIndexTail(db ethdb.KeyValueWriter) {
+	if err := db.Delete(balanceIndexTailKey); err != nil {
+		log.Crit("Failed to delete the balance index tail", "err", err)
+	}
+}
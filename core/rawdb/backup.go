@@ -0,0 +1,473 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// BackupManifestFile is the name of the file describing a database backup.
+	BackupManifestFile = "manifest.json"
+
+	// backupVersion is the version of the backup layout created by CreateBackup.
+	backupVersion = 1
+
+	// backupKeyValueDir and backupAncientDir are the directories within a backup
+	// holding the key-value store and the ancient tables respectively.
+	backupKeyValueDir = "chaindata"
+	backupAncientDir  = "ancient"
+
+	// backupBatchSize is the amount of key-value data to accumulate before flushing
+	// it into the backup database.
+	backupBatchSize = 16 * 1024 * 1024
+)
+
+var (
+	// errBackupExists is returned if the backup target directory is not empty.
+	errBackupExists = errors.New("backup directory already exists and is not empty")
+
+	// errBackupVersion is returned if a backup was created by an unknown version.
+	errBackupVersion = errors.New("unsupported backup version")
+)
+
+// BackupFile describes a single ancient table file captured in a backup.
+type BackupFile struct {
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Checksum common.Hash `json:"checksum"`
+	Linked   bool        `json:"linked"` // Whether the file was hard-linked from the base backup
+}
+
+// BackupManifest describes the contents of a database backup, and carries all
+// the information needed to verify its integrity upon restoration.
+type BackupManifest struct {
+	Version uint64    `json:"version"`
+	Created time.Time `json:"created"`
+	Base    string    `json:"base,omitempty"` // Backup this one reused ancient files from
+
+	HeadHeader common.Hash `json:"headHeader"`
+	HeadBlock  common.Hash `json:"headBlock"`
+
+	KeyValueItems    uint64      `json:"kvItems"`
+	KeyValueChecksum common.Hash `json:"kvChecksum"`
+
+	// Ancients is the number of frozen items at the time of the backup. For remote
+	// ancient stores it acts as a checkpoint marker: the remote store must hold at
+	// least this many items for the backup to be restorable. If the remote store
+	// supports checkpoints, RemoteCheckpoint names the snapshot of its tables it
+	// took at that count.
+	Ancients         uint64       `json:"ancients"`
+	RemoteAncient    bool         `json:"remoteAncient"`
+	RemoteCheckpoint string       `json:"remoteCheckpoint,omitempty"`
+	AncientFiles     []BackupFile `json:"ancientFiles,omitempty"`
+}
+
+// ReadBackupManifest loads the manifest of the backup stored in dir.
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, BackupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(BackupManifest)
+	if err := json.Unmarshal(blob, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("%w: %d", errBackupVersion, manifest.Version)
+	}
+	return manifest, nil
+}
+
+// CreateBackup writes a consistent backup of the given database into dir, which
+// must either not exist or be empty. The database may be in use while the backup
+// is taken.
+//
+// The key-value store is captured from a point-in-time snapshot. The number of
+// frozen items is read after the snapshot was taken, so any block moved into the
+// ancient store in the meantime is held by both, which is harmless.
+//
+// If the ancient store is remote and supports checkpoints, it is asked to snapshot
+// its tables at the frozen item count, coordinating both halves of the backup.
+//
+// If base points to a previous backup, immutable ancient files whose contents
+// did not change since are hard-linked from it, making the new backup
+// incremental. The key-value store is always captured in full.
+func CreateBackup(db ethdb.Database, dir string, base string) (*BackupManifest, error) {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, errBackupExists
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var baseManifest *BackupManifest
+	if base != "" {
+		var err error
+		if baseManifest, err = ReadBackupManifest(base); err != nil {
+			return nil, fmt.Errorf("failed to load base backup: %v", err)
+		}
+	}
+	start := time.Now()
+
+	// Snapshot the key-value store first, the iterator pins a consistent view.
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	manifest := &BackupManifest{
+		Version:    backupVersion,
+		Created:    time.Now().UTC(),
+		Base:       base,
+		HeadHeader: ReadHeadHeaderHash(db),
+		HeadBlock:  ReadHeadBlockHash(db),
+	}
+	frozen, err := db.Ancients()
+	if err != nil && err != errNotSupported {
+		return nil, err
+	}
+	manifest.Ancients = frozen
+
+	kvdb, err := leveldb.New(filepath.Join(dir, backupKeyValueDir), 16, 16, "")
+	if err != nil {
+		return nil, err
+	}
+	items, checksum, err := copyKeyValues(it, kvdb)
+	if cerr := kvdb.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest.KeyValueItems, manifest.KeyValueChecksum = items, checksum
+	log.Info("Backed up key-value store", "items", items, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Capture the ancient store, if it is held locally
+	switch ancients, err := db.AncientDatadir(); {
+	case err == errNotSupported && frozen > 0:
+		manifest.RemoteAncient = true
+		checkpoint, err := createAncientCheckpoint(db, manifest.Created, frozen)
+		switch {
+		case err == nil:
+			manifest.RemoteCheckpoint = checkpoint.Name
+			log.Info("Created remote ancient store checkpoint", "name", checkpoint.Name, "items", frozen)
+		case err == errNotSupported:
+			log.Info("Recorded remote ancient store checkpoint", "items", frozen)
+		default:
+			return nil, fmt.Errorf("failed to checkpoint remote ancient store: %v", err)
+		}
+
+	case err == nil:
+		files, err := backupAncients(ancients, filepath.Join(dir, backupAncientDir), baseManifest, base)
+		if err != nil {
+			return nil, err
+		}
+		manifest.AncientFiles = files
+
+	case err != errNotSupported:
+		return nil, err
+	}
+	if err := writeBackupManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	log.Info("Database backup created", "dir", dir, "ancients", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+	return manifest, nil
+}
+
+// VerifyBackup checks the integrity of the backup stored in dir against the
+// checksums recorded in its manifest.
+func VerifyBackup(dir string) (*BackupManifest, error) {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range manifest.AncientFiles {
+		size, checksum, err := hashFile(filepath.Join(dir, backupAncientDir, file.Name))
+		if err != nil {
+			return nil, err
+		}
+		if size != file.Size || checksum != file.Checksum {
+			return nil, fmt.Errorf("ancient file %s corrupted: size %d/%d, checksum %x/%x", file.Name, size, file.Size, checksum, file.Checksum)
+		}
+	}
+	kvdb, err := leveldb.New(filepath.Join(dir, backupKeyValueDir), 16, 16, "")
+	if err != nil {
+		return nil, err
+	}
+	defer kvdb.Close()
+
+	it := kvdb.NewIterator(nil, nil)
+	defer it.Release()
+
+	items, checksum, err := copyKeyValues(it, nil)
+	if err != nil {
+		return nil, err
+	}
+	if items != manifest.KeyValueItems || checksum != manifest.KeyValueChecksum {
+		return nil, fmt.Errorf("key-value store corrupted: items %d/%d, checksum %x/%x", items, manifest.KeyValueItems, checksum, manifest.KeyValueChecksum)
+	}
+	return manifest, nil
+}
+
+// RestoreBackup verifies the backup stored in dir and restores it into the given
+// key-value store and ancient store directories, neither of which may contain any
+// data yet. For backups of a remote ancient store, ancientdir is ignored.
+func RestoreBackup(dir string, kvdir string, ancientdir string) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range []string{kvdir, ancientdir} {
+		if entries, err := ioutil.ReadDir(target); err == nil && len(entries) > 0 {
+			return nil, fmt.Errorf("restore target %s is not empty", target)
+		}
+	}
+	if err := copyDir(filepath.Join(dir, backupKeyValueDir), kvdir); err != nil {
+		return nil, err
+	}
+	// The freezer files are copied rather than linked, as the restored freezer
+	// appends to and truncates them in place, which would alter the backup too.
+	if len(manifest.AncientFiles) > 0 {
+		if err := copyDir(filepath.Join(dir, backupAncientDir), ancientdir); err != nil {
+			return nil, err
+		}
+	}
+	log.Info("Database backup restored", "dir", dir, "chaindata", kvdir, "ancients", manifest.Ancients)
+	if manifest.RemoteCheckpoint != "" {
+		log.Info("Remote ancient store must be restored from its checkpoint", "name", manifest.RemoteCheckpoint, "items", manifest.Ancients)
+	}
+	return manifest, nil
+}
+
+// VerifyRestoredBackup checks that a database opened from a restored backup is
+// consistent with the backup's manifest.
+func VerifyRestoredBackup(db ethdb.Database, manifest *BackupManifest) error {
+	frozen, err := db.Ancients()
+	if err != nil && err != errNotSupported {
+		return err
+	}
+	if frozen < manifest.Ancients {
+		return fmt.Errorf("ancient store behind backup checkpoint: have %d, want %d", frozen, manifest.Ancients)
+	}
+	if head := ReadHeadHeaderHash(db); head != manifest.HeadHeader {
+		return fmt.Errorf("head header mismatch: have %x, want %x", head, manifest.HeadHeader)
+	}
+	return nil
+}
+
+// copyKeyValues drains the iterator into the destination database (if any), and
+// returns the number of items and a checksum over all of them.
+func copyKeyValues(it ethdb.Iterator, dst ethdb.KeyValueStore) (uint64, common.Hash, error) {
+	var (
+		hasher = sha3.NewLegacyKeccak256()
+		items  uint64
+		batch  ethdb.Batch
+		logged = time.Now()
+		length [8]byte
+	)
+	if dst != nil {
+		batch = dst.NewBatch()
+	}
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+
+		binary.BigEndian.PutUint64(length[:], uint64(len(key)))
+		hasher.Write(length[:])
+		hasher.Write(key)
+		binary.BigEndian.PutUint64(length[:], uint64(len(value)))
+		hasher.Write(length[:])
+		hasher.Write(value)
+		items++
+
+		if batch != nil {
+			if err := batch.Put(key, value); err != nil {
+				return 0, common.Hash{}, err
+			}
+			if batch.ValueSize() > backupBatchSize {
+				if err := batch.Write(); err != nil {
+					return 0, common.Hash{}, err
+				}
+				batch.Reset()
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Processing key-value store", "items", items)
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return 0, common.Hash{}, err
+	}
+	if batch != nil {
+		if err := batch.Write(); err != nil {
+			return 0, common.Hash{}, err
+		}
+	}
+	return items, common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// backupAncients captures the ancient tables in src into dst. Data files other
+// than the last one of each table are immutable, and are hard-linked from the
+// base backup if unchanged since. Everything else is copied from the live store.
+// Index files are copied before the data files, so that any partially captured
+// tail is dropped by the freezer repair upon opening the restored store.
+func backupAncients(src, dst string, base *BackupManifest, basedir string) ([]BackupFile, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		index []string
+		data  []string
+		heads = make(map[string]string) // table name -> last data file
+	)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".ridx") || strings.HasSuffix(name, ".cidx"):
+			index = append(index, name)
+		case strings.HasSuffix(name, ".rdat") || strings.HasSuffix(name, ".cdat"):
+			data = append(data, name)
+			table := name[:strings.Index(name, ".")]
+			if name > heads[table] {
+				heads[table] = name
+			}
+		}
+	}
+	sort.Strings(data)
+
+	known := make(map[string]BackupFile)
+	if base != nil {
+		for _, file := range base.AncientFiles {
+			known[file.Name] = file
+		}
+	}
+	var files []BackupFile
+	for _, name := range append(index, data...) {
+		var (
+			mutable = !strings.HasSuffix(name, "dat") || heads[name[:strings.Index(name, ".")]] == name
+			target  = filepath.Join(dst, name)
+		)
+		info, err := os.Stat(filepath.Join(src, name))
+		if err != nil {
+			return nil, err
+		}
+		// Reuse the base backup's copy if the immutable file is unchanged
+		if prev, ok := known[name]; ok && !mutable && prev.Size == info.Size() {
+			if err := os.Link(filepath.Join(basedir, backupAncientDir, name), target); err == nil {
+				files = append(files, BackupFile{Name: name, Size: prev.Size, Checksum: prev.Checksum, Linked: true})
+				continue
+			}
+		}
+		// Live files are always copied, never linked: a deep rewind of the freezer
+		// truncates older data files in place, which would corrupt the backup too.
+		if err := copyFile(filepath.Join(src, name), target); err != nil {
+			return nil, err
+		}
+		size, checksum, err := hashFile(target)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, BackupFile{Name: name, Size: size, Checksum: checksum})
+	}
+	return files, nil
+}
+
+// writeBackupManifest stores the manifest of a backup in its directory.
+func writeBackupManifest(dir string, manifest *BackupManifest) error {
+	blob, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, BackupManifestFile), blob, 0644)
+}
+
+// hashFile returns the size and keccak256 checksum of the given file.
+func hashFile(path string) (int64, common.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	defer f.Close()
+
+	hasher := sha3.NewLegacyKeccak256()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	return size, common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// copyFile copies the contents of src into a newly created file at dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyDir copies all the regular files of src into dst, creating it if needed.
+func copyDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestBackupRestore(t *testing.T) {
+	root, err := ioutil.TempDir("", "backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db, err := NewLevelDBDatabaseWithFreezer(filepath.Join(root, "src"), 16, 16, filepath.Join(root, "src", "ancient"), "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	// Fill the freezer with a few blocks and the key-value store with some data
+	var head *types.Block
+	for i := 0; i < 3; i++ {
+		head = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: []byte("test block")})
+		WriteAncientBlock(db, head, nil, big.NewInt(int64(i)))
+	}
+	WriteHeadHeaderHash(db, head.Hash())
+	db.Put([]byte("some-key"), []byte("some-value"))
+
+	dir := filepath.Join(root, "backup")
+	manifest, err := CreateBackup(db, dir, "")
+	if err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	if manifest.Ancients != 3 || manifest.RemoteAncient {
+		t.Fatalf("ancients mismatch: have %d (remote %v), want 3 (local)", manifest.Ancients, manifest.RemoteAncient)
+	}
+	if _, err := CreateBackup(db, dir, ""); err != errBackupExists {
+		t.Fatalf("overwrite error mismatch: have %v, want %v", err, errBackupExists)
+	}
+	// Make an incremental backup on top and verify both
+	incr := filepath.Join(root, "incr")
+	if _, err := CreateBackup(db, incr, dir); err != nil {
+		t.Fatalf("failed to create incremental backup: %v", err)
+	}
+	db.Close()
+
+	for _, path := range []string{dir, incr} {
+		if _, err := VerifyBackup(path); err != nil {
+			t.Fatalf("backup %s failed verification: %v", path, err)
+		}
+	}
+	// Restore the incremental backup and check the contents
+	restored := filepath.Join(root, "restored")
+	if _, err := RestoreBackup(incr, restored, filepath.Join(restored, "ancient")); err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	db, err = NewLevelDBDatabaseWithFreezer(restored, 16, 16, filepath.Join(restored, "ancient"), "", nil)
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	if err := VerifyRestoredBackup(db, manifest); err != nil {
+		t.Fatalf("restored database inconsistent: %v", err)
+	}
+	if value, _ := db.Get([]byte("some-key")); !bytes.Equal(value, []byte("some-value")) {
+		t.Fatalf("restored value mismatch: have %q, want %q", value, "some-value")
+	}
+	if hash := ReadCanonicalHash(db, 2); hash != head.Hash() {
+		t.Fatalf("restored ancient hash mismatch: have %x, want %x", hash, head.Hash())
+	}
+	db.Close()
+
+	if _, err := RestoreBackup(dir, restored, filepath.Join(restored, "ancient")); err == nil {
+		t.Fatalf("restore into non-empty directory succeeded")
+	}
+	// Corrupt one of the copied index files and make sure it's detected
+	file := filepath.Join(dir, backupAncientDir, freezerHashTable+".ridx")
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob[len(blob)-1] ^= 0xff
+	if err := ioutil.WriteFile(file, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(dir); err == nil {
+		t.Fatalf("corrupted backup passed verification")
+	}
+}
+
+// Tests that writing to a restored freezer, appending to or truncating its tables,
+// leaves the files of the backup it was restored from untouched.
+func TestRestoreDetached(t *testing.T) {
+	root, err := ioutil.TempDir("", "backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db, err := NewLevelDBDatabaseWithFreezer(filepath.Join(root, "src"), 16, 16, filepath.Join(root, "src", "ancient"), "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	var head *types.Block
+	for i := 0; i < 3; i++ {
+		head = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: []byte("test block")})
+		WriteAncientBlock(db, head, nil, big.NewInt(int64(i)))
+	}
+	WriteHeadHeaderHash(db, head.Hash())
+
+	base, incr := filepath.Join(root, "backup"), filepath.Join(root, "incr")
+	if _, err := CreateBackup(db, base, ""); err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	if _, err := CreateBackup(db, incr, base); err != nil {
+		t.Fatalf("failed to create incremental backup: %v", err)
+	}
+	db.Close()
+
+	// Snapshot the backed up freezer files to compare against later
+	files := make(map[string][]byte)
+	for _, dir := range []string{base, incr} {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, backupAncientDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, backupAncientDir, entry.Name())
+			if files[path], err = ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Restore the incremental backup, then extend and rewind the restored freezer
+	restored := filepath.Join(root, "restored")
+	if _, err := RestoreBackup(incr, restored, filepath.Join(restored, "ancient")); err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	db, err = NewLevelDBDatabaseWithFreezer(restored, 16, 16, filepath.Join(restored, "ancient"), "", nil)
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	for i := 3; i < 5; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: []byte("new block")})
+		WriteAncientBlock(db, block, nil, big.NewInt(int64(i)))
+	}
+	if err := db.TruncateAncients(1); err != nil {
+		t.Fatalf("failed to truncate restored freezer: %v", err)
+	}
+	db.Close()
+
+	for path, blob := range files {
+		have, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("backup file %s unreadable: %v", path, err)
+		}
+		if !bytes.Equal(have, blob) {
+			t.Errorf("backup file %s modified by the restored freezer", path)
+		}
+	}
+	for _, dir := range []string{base, incr} {
+		if _, err := VerifyBackup(dir); err != nil {
+			t.Errorf("backup %s failed verification: %v", dir, err)
+		}
+	}
+}
+
+// Tests that backups of a database with a remote ancient store create a matching
+// checkpoint of the remote tables, if the remote store supports it.
+func TestBackupRemoteCheckpoint(t *testing.T) {
+	root, err := ioutil.TempDir("", "backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	mem := lib.NewMemFreezerRemoteServerAPI()
+	for i := 0; i < 5; i++ {
+		b := []byte{byte(i)}
+		if err := mem.AppendAncient(uint64(i), b, b, b, b, b); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	supported, unsupported := rpc.NewServer(), rpc.NewServer()
+	if err := supported.RegisterName("freezer", mem); err != nil {
+		t.Fatal(err)
+	}
+	if err := unsupported.RegisterName("freezer", &rangelessFreezerServer{mem}); err != nil {
+		t.Fatal(err)
+	}
+	// Checkpoints beyond the remote items are refused
+	remote := &FreezerRemoteClient{client: rpc.DialInProc(supported), quit: make(chan struct{})}
+	if _, err := remote.CreateCheckpoint("too-far", 6); err == nil {
+		t.Fatal("checkpoint beyond the frozen items created")
+	}
+	db := &freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: &countingAncients{remote, 4}}
+	manifest, err := CreateBackup(db, filepath.Join(root, "backup"), "")
+	if err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	if !manifest.RemoteAncient || manifest.RemoteCheckpoint == "" {
+		t.Fatalf("remote checkpoint not recorded: %+v", manifest)
+	}
+	checkpoints, err := ListAncientCheckpoints(db)
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Name != manifest.RemoteCheckpoint || checkpoints[0].Items != 4 {
+		t.Fatalf("checkpoints mismatch: have %+v, want %s at 4 items", checkpoints, manifest.RemoteCheckpoint)
+	}
+	if _, err := remote.CreateCheckpoint(manifest.RemoteCheckpoint, 4); err == nil {
+		t.Fatal("duplicate checkpoint created")
+	}
+	// Stores lacking checkpoints still get backed up, leaving it to the operator
+	remote = &FreezerRemoteClient{client: rpc.DialInProc(unsupported), quit: make(chan struct{})}
+	db = &freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: &countingAncients{remote, 4}}
+	manifest, err = CreateBackup(db, filepath.Join(root, "unsupported"), "")
+	if err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	if !manifest.RemoteAncient || manifest.RemoteCheckpoint != "" {
+		t.Fatalf("remote checkpoint mismatch: %+v", manifest)
+	}
+	if _, err := ListAncientCheckpoints(db); err != errNotSupported {
+		t.Fatalf("listing error mismatch: have %v, want %v", err, errNotSupported)
+	}
+}
+
+// countingAncients is a remote ancient store reporting a fixed number of frozen
+// items, regardless of what the server holds or implements.
+type countingAncients struct {
+	*FreezerRemoteClient
+	items uint64
+}
+
+func (c *countingAncients) Ancients() (uint64, error) { return c.items, nil }
@@ -31,8 +31,45 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/olekukonko/tablewriter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
+// AncientRanger is implemented by ancient stores able to retrieve a range of
+// consecutive items in a single call, such as the remote freezer.
+type AncientRanger interface {
+	// AncientRange retrieves up to count consecutive items of the given kind
+	// starting at start, stopping once maxBytes is exceeded.
+	AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error)
+}
+
+// AncientTailTruncater is implemented by ancient stores able to discard the
+// oldest items of individual tables, such as the local freezer.
+type AncientTailTruncater interface {
+	// TruncateTail discards the items of the given kind below the provided
+	// threshold number, as far as the store allows, returning the number of the
+	// oldest item retained.
+	TruncateTail(kind string, items uint64) (uint64, error)
+}
+
+// AncientOutageReporter is implemented by ancient stores which may become
+// unreachable, such as the remote freezer.
+type AncientOutageReporter interface {
+	// AncientOutage returns the error the last write into the store failed with
+	// because of it being unreachable, nil if the last write reached it.
+	AncientOutage() error
+}
+
+// AncientFreezePauser is implemented by ancient stores moving the immutable chain
+// segments into cold storage in the background, such as the freezer.
+type AncientFreezePauser interface {
+	// PauseFreezing stops freezing new blocks at a block boundary, returning once
+	// the blocks being frozen are flushed.
+	PauseFreezing()
+
+	// ResumeFreezing lets the blocks be frozen again after a pause.
+	ResumeFreezing()
+}
+
 // freezerdb is a database wrapper that enabled freezer data retrievals.
 type freezerdb struct {
 	ethdb.KeyValueStore
@@ -43,6 +80,10 @@ type freezerdb struct {
 // the slow ancient tables.
 func (frdb *freezerdb) Close() error {
 	var errs []error
+	// Flush the ancient data to disk (or the remote store) before closing it
+	if err := frdb.AncientStore.Sync(); err != nil {
+		errs = append(errs, err)
+	}
 	if err := frdb.AncientStore.Close(); err != nil {
 		errs = append(errs, err)
 	}
@@ -55,6 +96,84 @@ func (frdb *freezerdb) Close() error {
 	return nil
 }
 
+// TruncateAncients discards all but the first n ancient data from the ancient
+// store, lowering the recorded remote ancient count along with it, if any.
+func (frdb *freezerdb) TruncateAncients(items uint64) error {
+	if err := frdb.AncientStore.TruncateAncients(items); err != nil {
+		return err
+	}
+	if marker := ReadRemoteAncients(frdb.KeyValueStore); marker != nil && *marker > items {
+		WriteRemoteAncients(frdb.KeyValueStore, items)
+	}
+	return nil
+}
+
+// AncientRange retrieves a range of consecutive ancient items in a single call,
+// if the ancient store supports it.
+func (frdb *freezerdb) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	if ranger, ok := frdb.AncientStore.(AncientRanger); ok {
+		return ranger.AncientRange(kind, start, count, maxBytes)
+	}
+	return nil, errNotSupported
+}
+
+// TruncateTail discards the oldest ancient items of the given kind, if the
+// ancient store supports it.
+func (frdb *freezerdb) TruncateTail(kind string, items uint64) (uint64, error) {
+	if truncater, ok := frdb.AncientStore.(AncientTailTruncater); ok {
+		return truncater.TruncateTail(kind, items)
+	}
+	return 0, errNotSupported
+}
+
+// AncientOutage returns the error the ancient store was last found unreachable
+// with, if it may become unreachable.
+func (frdb *freezerdb) AncientOutage() error {
+	if reporter, ok := frdb.AncientStore.(AncientOutageReporter); ok {
+		return reporter.AncientOutage()
+	}
+	return nil
+}
+
+// PauseFreezing stops the ancient store from freezing new blocks at a block
+// boundary, if it freezes them in the background.
+func (frdb *freezerdb) PauseFreezing() {
+	if pauser, ok := frdb.AncientStore.(AncientFreezePauser); ok {
+		pauser.PauseFreezing()
+	}
+}
+
+// ResumeFreezing lets the ancient store freeze blocks again after a pause.
+func (frdb *freezerdb) ResumeFreezing() {
+	if pauser, ok := frdb.AncientStore.(AncientFreezePauser); ok {
+		pauser.ResumeFreezing()
+	}
+}
+
+// SetTieringPolicy replaces the tiering policy of the ancient store, if it
+// mirrors a remote one.
+func (frdb *freezerdb) SetTieringPolicy(policy TieringPolicy, file string) {
+	if tiering, ok := frdb.AncientStore.(AncientTiering); ok {
+		tiering.SetTieringPolicy(policy, file)
+	}
+}
+
+// ReloadTieringPolicy rereads the tiering policy file of the ancient store.
+func (frdb *freezerdb) ReloadTieringPolicy() error {
+	if tiering, ok := frdb.AncientStore.(AncientTiering); ok {
+		return tiering.ReloadTieringPolicy()
+	}
+	return errNotSupported
+}
+
+// TieringStats returns the state of the local mirror of the ancient store.
+func (frdb *freezerdb) TieringStats() TieringStats {
+	if tiering, ok := frdb.AncientStore.(AncientTiering); ok {
+		return tiering.TieringStats()
+	}
+	return TieringStats{}
+}
+
 // Freeze is a helper method used for external testing to trigger and block until
 // a freeze cycle completes, without having to sleep for a minute to trigger the
 // automatic background run.
@@ -96,6 +215,11 @@ func (db *nofreezedb) AncientSize(kind string) (uint64, error) {
 	return 0, errNotSupported
 }
 
+// AncientDatadir returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) AncientDatadir() (string, error) {
+	return "", errNotSupported
+}
+
 // AppendAncient returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
 	return errNotSupported
@@ -121,16 +245,21 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 
 // NewDatabaseWithFreezerRemote creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezerRemote(db ethdb.KeyValueStore, freezerURL string) (ethdb.Database, error) {
+// storage, as tuned by the given options (the defaults if nil).
+func NewDatabaseWithFreezerRemote(db ethdb.KeyValueStore, freezerURL string, options *FreezerOptions) (ethdb.Database, error) {
 	// Create the idle freezer instance
 	log.Info("New remote freezer", "freezer", freezerURL)
 
-	frdb, err := newFreezerRemoteClient(freezerURL)
+	frdb, err := newFreezerRemoteClient(freezerURL, db, options)
 	if err != nil {
 		log.Error("NewDatabaseWithFreezerRemote error", "error", err)
 		return nil, err
 	}
+	// Make sure a remote freezer shared between chains holds this one's before
+	// reading or freezing anything
+	if err := identifyRemoteFreezer(db, frdb, options); err != nil {
+		return nil, err
+	}
 	// Core-Geth: The validation below is the original and contemporary upstream
 	// ethereum/go-ethereum implementation of validations in NewDatabaseWithFreezer. Core-Geth's
 	// implementation of the "standard" (built-in FS) freezer initialization has been
@@ -202,21 +331,23 @@ Please set --ancient.rpc to the correct path, and/or review the remote freezer's
 			// feezer.
 		}
 	}
-	// Freezer is consistent with the key-value database, permit combining the two
-	go freezeRemote(db, frdb, frdb.threshold, frdb.quit, frdb.trigger)
+	// Freezer is consistent with the key-value database, permit combining the two,
+	// mirroring the ancients selected by the tiering policy locally
+	tiered := newTieredAncientStore(db, frdb)
+	go freezeRemote(db, tiered, frdb.threshold, frdb.recheck, frdb.quit, frdb.trigger, frdb.gate)
 
 	return &freezerdb{
 		KeyValueStore: db,
-		AncientStore:  frdb,
+		AncientStore:  tiered,
 	}, nil
 }
 
 // NewDatabaseWithFreezer creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezerStr string, namespace string) (ethdb.Database, error) {
+// storage, as tuned by the given options (the defaults if nil).
+func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezerStr string, namespace string, options *FreezerOptions) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezerStr, namespace)
+	frdb, err := newFreezer(freezerStr, namespace, options)
 	if err != nil {
 		return nil, err
 	}
@@ -303,14 +434,30 @@ func NewLevelDBDatabase(file string, cache int, handles int, namespace string) (
 	return NewDatabase(db), nil
 }
 
-// NewLevelDBDatabaseWithFreezer creates a persistent key-value database with a
-// freezer moving immutable chain segments into cold storage.
-func NewLevelDBDatabaseWithFreezerRemote(file string, cache int, handles int, freezerURL string) (ethdb.Database, error) {
+// NewLevelDBDatabaseReadOnly opens an existing persistent key-value database in
+// read-only mode, without a freezer moving immutable chain segments into cold
+// storage. The database must not be in use by another process.
+func NewLevelDBDatabaseReadOnly(file string, cache int, handles int, namespace string) (ethdb.Database, error) {
+	db, err := leveldb.NewCustom(file, namespace, func(options *opt.Options) {
+		options.OpenFilesCacheCapacity = handles
+		options.BlockCacheCapacity = cache / 2 * opt.MiB
+		options.ReadOnly = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(db), nil
+}
+
+// NewLevelDBDatabaseWithFreezerRemote creates a persistent key-value database
+// with a remote freezer moving immutable chain segments into cold storage, as
+// tuned by the given options (the defaults if nil).
+func NewLevelDBDatabaseWithFreezerRemote(file string, cache int, handles int, freezerURL string, options *FreezerOptions) (ethdb.Database, error) {
 	kvdb, err := leveldb.New(file, cache, handles, "eth/db/chaindata")
 	if err != nil {
 		return nil, err
 	}
-	frdb, err := NewDatabaseWithFreezerRemote(kvdb, freezerURL)
+	frdb, err := NewDatabaseWithFreezerRemote(kvdb, freezerURL, options)
 	if err != nil {
 		kvdb.Close()
 		return nil, err
@@ -319,13 +466,14 @@ func NewLevelDBDatabaseWithFreezerRemote(file string, cache int, handles int, fr
 }
 
 // NewLevelDBDatabaseWithFreezer creates a persistent key-value database with a
-// freezer moving immutable chain segments into cold storage.
-func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
+// freezer moving immutable chain segments into cold storage, as tuned by the
+// given options (the defaults if nil).
+func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string, options *FreezerOptions) (ethdb.Database, error) {
 	kvdb, err := leveldb.New(file, cache, handles, namespace)
 	if err != nil {
 		return nil, err
 	}
-	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace)
+	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace, options)
 	if err != nil {
 		kvdb.Close()
 		return nil, err
@@ -359,7 +507,12 @@ func InspectDatabase(db ethdb.Database) error {
 		storageSnapSize common.StorageSize
 		preimageSize    common.StorageSize
 		bloomBitsSize   common.StorageSize
+		uncleIndexSize  common.StorageSize
+		supplySize      common.StorageSize
+		contractsSize   common.StorageSize
+		tokensSize      common.StorageSize
 		cliqueSnapsSize common.StorageSize
+		mirrorSize      common.StorageSize
 
 		// Ancient store statistics
 		ancientHeaders  common.StorageSize
@@ -406,6 +559,22 @@ func InspectDatabase(db ethdb.Database) error {
 			preimageSize += size
 		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
 			bloomBitsSize += size
+		case bytes.HasPrefix(key, uncleMinerPrefix) && len(key) == (len(uncleMinerPrefix)+common.AddressLength+8+common.HashLength+1):
+			uncleIndexSize += size
+		case bytes.HasPrefix(key, supplyPrefix) && len(key) == (len(supplyPrefix)+8+common.HashLength):
+			supplySize += size
+		case bytes.HasPrefix(key, balancePrefix) && len(key) == (len(balancePrefix)+common.AddressLength+8+common.HashLength):
+			supplySize += size
+		case bytes.HasPrefix(key, contractPrefix) && len(key) == (len(contractPrefix)+common.AddressLength+8+common.HashLength):
+			contractsSize += size
+		case bytes.HasPrefix(key, tokenTransferPrefix) && len(key) == (len(tokenTransferPrefix)+common.AddressLength+8+common.HashLength+4):
+			tokensSize += size
+		case bytes.HasPrefix(key, tokenHoldingPrefix) && len(key) == (len(tokenHoldingPrefix)+2*common.AddressLength):
+			tokensSize += size
+		case bytes.HasPrefix(key, tokenHolderPrefix) && len(key) == (len(tokenHolderPrefix)+2*common.AddressLength):
+			tokensSize += size
+		case bytes.HasPrefix(key, codeHashPrefix) && len(key) == (len(codeHashPrefix)+common.HashLength+common.AddressLength+8+common.HashLength):
+			contractsSize += size
 		case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
 			cliqueSnapsSize += size
 		case bytes.HasPrefix(key, []byte("cht-")) && len(key) == 4+common.HashLength:
@@ -414,11 +583,17 @@ func InspectDatabase(db ethdb.Database) error {
 			bloomTrieNodes += size
 		case bytes.HasPrefix(key, codePrefix) && len(key) == len(codePrefix)+common.HashLength:
 			codeSize += size
+		case bytes.HasPrefix(key, installedFilterPrefix):
+			metadata += size
+		case bytes.HasPrefix(key, ancientMirrorPrefix):
+			mirrorSize += size
+		case bytes.HasPrefix(key, remoteJournalPrefix):
+			mirrorSize += size
 		case len(key) == common.HashLength:
 			trieSize += size
 		default:
 			var accounted bool
-			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey} {
+			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey, stateSyncProgressKey, shutdownMarkerKey, firehoseCursorKey, historyTailKey, receiptVerificationKey, schemaVersionKey, schemaMigrationKey, snapshotAccessProfileKey, ancientMirrorKey, setHeadJournalKey} {
 				if bytes.Equal(key, meta) {
 					metadata += size
 					accounted = true
@@ -453,12 +628,17 @@ func InspectDatabase(db ethdb.Database) error {
 		{"Key-Value store", "Block hash->number", hashNumPairing.String()},
 		{"Key-Value store", "Transaction index", txlookupSize.String()},
 		{"Key-Value store", "Bloombit index", bloomBitsSize.String()},
+		{"Key-Value store", "Uncle index", uncleIndexSize.String()},
+		{"Key-Value store", "Supply records", supplySize.String()},
+		{"Key-Value store", "Contract index", contractsSize.String()},
+		{"Key-Value store", "Token index", tokensSize.String()},
 		{"Key-Value store", "Contract codes", codeSize.String()},
 		{"Key-Value store", "Trie nodes", trieSize.String()},
 		{"Key-Value store", "Trie preimages", preimageSize.String()},
 		{"Key-Value store", "Account snapshot", accountSnapSize.String()},
 		{"Key-Value store", "Storage snapshot", storageSnapSize.String()},
 		{"Key-Value store", "Clique snapshots", cliqueSnapsSize.String()},
+		{"Key-Value store", "Ancient mirror and journal", mirrorSize.String()},
 		{"Key-Value store", "Singleton metadata", metadata.String()},
 		{"Ancient store", "Headers", ancientHeaders.String()},
 		{"Ancient store", "Bodies", ancientBodies.String()},
@@ -30,7 +30,6 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
-	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/prometheus/tsdb/fileutil"
 )
 
@@ -54,6 +53,10 @@ const (
 	// storage.
 	freezerRecheckInterval = time.Minute
 
+	// freezerAggressiveRecheckInterval is the frequency of the checks in the
+	// aggressive freezing mode.
+	freezerAggressiveRecheckInterval = 3 * time.Second
+
 	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
 	// before doing an fsync and deleting it from the key-value store.
 	freezerBatchLimit = 30000
@@ -70,21 +73,26 @@ type freezer struct {
 	// WARNING: The `frozen` field is accessed atomically. On 32 bit platforms, only
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
-	frozen    uint64 // Number of blocks already frozen
-	threshold uint64 // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
+	frozen    uint64        // Number of blocks already frozen
+	threshold uint64        // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
+	recheck   time.Duration // Time between two checks for blocks to freeze
 
+	datadir      string                   // Path of the directory holding the tables
 	tables       map[string]*freezerTable // Data tables for storing everything
-	instanceLock fileutil.Releaser        // File-system lock to prevent double opens
+	instanceLock fileutil.Releaser        // File-system lock to prevent double opens, nil if read-only
+	readonly     bool                     // Whether the tables are written by another process
 
 	trigger chan chan struct{} // Manual blocking freeze trigger, test determinism
+	gate    *freezeGate        // Pauses the freezing at a block boundary
 
 	quit      chan struct{}
 	closeOnce sync.Once
 }
 
 // newFreezer creates a chain freezer that moves ancient chain data into
-// append-only flat file containers.
-func newFreezer(datadir string, namespace string) (*freezer, error) {
+// append-only flat file containers, with the tables tuned by the given options,
+// or the default ones if nil.
+func newFreezer(datadir string, namespace string, options *FreezerOptions) (*freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
@@ -106,14 +114,25 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 	}
 	// Open all the supported data tables
 	freezer := &freezer{
-		threshold:    vars.FullImmutabilityThreshold,
+		threshold:    options.threshold(),
+		recheck:      options.recheckInterval(),
+		datadir:      datadir,
 		tables:       make(map[string]*freezerTable),
 		instanceLock: lock,
 		trigger:      make(chan chan struct{}),
+		gate:         newFreezeGate(),
 		quit:         make(chan struct{}),
 	}
-	for name, disableSnappy := range freezerNoSnappy {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy)
+	for name := range freezerNoSnappy {
+		compressed, err := tableCompression(datadir, name, options.compression())
+		if err != nil {
+			for _, table := range freezer.tables {
+				table.Close()
+			}
+			lock.Release()
+			return nil, err
+		}
+		table, err := newCustomTable(datadir, name, readMeter, writeMeter, sizeGauge, options.fileSize(name), !compressed)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -121,6 +140,7 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 			lock.Release()
 			return nil, err
 		}
+		table.syncItems = options.syncItems()
 		freezer.tables[name] = table
 	}
 	if err := freezer.repair(); err != nil {
@@ -138,14 +158,18 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 func (f *freezer) Close() error {
 	var errs []error
 	f.closeOnce.Do(func() {
-		f.quit <- struct{}{}
+		if !f.readonly {
+			f.quit <- struct{}{}
+		}
 		for _, table := range f.tables {
 			if err := table.Close(); err != nil {
 				errs = append(errs, err)
 			}
 		}
-		if err := f.instanceLock.Release(); err != nil {
-			errs = append(errs, err)
+		if f.instanceLock != nil {
+			if err := f.instanceLock.Release(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	})
 	if errs != nil {
@@ -184,6 +208,11 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 	return 0, errUnknownTable
 }
 
+// AncientDatadir returns the path of the directory holding the ancient tables.
+func (f *freezer) AncientDatadir() (string, error) {
+	return f.datadir, nil
+}
+
 // AppendAncient injects all binary blobs belong to block at the end of the
 // append-only immutable table files.
 //
@@ -191,10 +220,19 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 // injection will be rejected. But if two injections with same number happen at
 // the same time, we can get into the trouble.
 func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+	if f.readonly {
+		return errReadOnly
+	}
 	// Ensure the binary blobs we are appending is continuous with freezer.
 	if atomic.LoadUint64(&f.frozen) != number {
 		return errOutOrderInsertion
 	}
+	// Refuse the items the tables can't address before writing any of them
+	for _, blob := range [][]byte{hash, header, body, receipts, td} {
+		if uint64(len(blob)) > freezerMaxItemSize {
+			return fmt.Errorf("%w: block #%d has an item of %d bytes", errItemTooLarge, number, len(blob))
+		}
+	}
 	// Rollback all inserted data if any insertion below failed to ensure
 	// the tables won't out of sync.
 	defer func() {
@@ -233,6 +271,9 @@ func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td
 
 // TruncateAncients discards any recent data above the provided threshold number.
 func (f *freezer) TruncateAncients(items uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
 	if atomic.LoadUint64(&f.frozen) <= items {
 		return nil
 	}
@@ -245,6 +286,30 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateTail discards the oldest items of the given kind below the provided
+// threshold number, as far as whole data files allow, returning the number of
+// the oldest item retained.
+func (f *freezer) TruncateTail(kind string, items uint64) (uint64, error) {
+	if f.readonly {
+		return 0, errReadOnly
+	}
+	if table := f.tables[kind]; table != nil {
+		return table.truncateTail(items)
+	}
+	return 0, errUnknownTable
+}
+
+// PauseFreezing stops the freezer from freezing new blocks at a block boundary,
+// returning once the blocks being frozen are flushed.
+func (f *freezer) PauseFreezing() {
+	f.gate.Pause(f.quit)
+}
+
+// ResumeFreezing lets the freezer freeze blocks again after a pause.
+func (f *freezer) ResumeFreezing() {
+	f.gate.Resume(f.quit)
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -278,6 +343,9 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 			return
 		default:
 		}
+		if !f.gate.wait(f.quit) {
+			return
+		}
 		if backoff {
 			// If we were doing a manual trigger, notify it
 			if triggered != nil {
@@ -285,10 +353,15 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 				triggered = nil
 			}
 			select {
-			case <-time.NewTimer(freezerRecheckInterval).C:
+			case <-time.NewTimer(f.recheck).C:
 				backoff = false
 			case triggered = <-f.trigger:
 				backoff = false
+			case ack := <-f.gate.pause:
+				if !f.gate.hold(ack, f.quit) {
+					return
+				}
+				continue
 			case <-f.quit:
 				return
 			}
@@ -336,7 +409,7 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 			first    = f.frozen
 			ancients = make([]common.Hash, 0, limit-f.frozen)
 		)
-		for f.frozen <= limit {
+		for f.frozen <= limit && !f.gate.stopping() {
 			// Retrieves all the components of the canonical block
 			hash := ReadCanonicalHash(nfdb, f.frozen)
 			if hash == (common.Hash{}) {
@@ -349,12 +422,12 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 				break
 			}
 			body := ReadBodyRLP(nfdb, hash, f.frozen)
-			if len(body) == 0 {
+			if len(body) == 0 && !historyPruned(nfdb, f.frozen) {
 				log.Error("Block body missing, can't freeze", "number", f.frozen, "hash", hash)
 				break
 			}
 			receipts := ReadReceiptsRLP(nfdb, hash, f.frozen)
-			if len(receipts) == 0 {
+			if len(receipts) == 0 && !historyPruned(nfdb, f.frozen) {
 				log.Error("Block receipts missing, can't freeze", "number", f.frozen, "hash", hash)
 				break
 			}
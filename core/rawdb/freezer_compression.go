@@ -0,0 +1,297 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// recompressSuffix is appended to the name of a table being recompressed, while
+// it's written next to the original one.
+const recompressSuffix = ".recompress"
+
+// FreezerCompression configures which ancient tables are snappy-compressed, by
+// table kind. Kinds missing from it use the default setting.
+//
+// The setting only applies to newly created tables, existing ones are kept in the
+// format they were written in until converted by RecompressFreezer.
+type FreezerCompression map[string]bool
+
+// DefaultFreezerCompression returns the default compression settings, in which
+// hashes and difficulties are left raw, as they don't compress well.
+func DefaultFreezerCompression() FreezerCompression {
+	compression := make(FreezerCompression)
+	for kind, noSnappy := range freezerNoSnappy {
+		compression[kind] = !noSnappy
+	}
+	return compression
+}
+
+// ParseFreezerCompression parses a comma separated list of the ancient tables to
+// compress, leaving the other ones raw.
+func ParseFreezerCompression(list string) (FreezerCompression, error) {
+	compression := make(FreezerCompression)
+	for kind := range freezerNoSnappy {
+		compression[kind] = false
+	}
+	for _, kind := range strings.Split(list, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		if _, ok := freezerNoSnappy[kind]; !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownTable, kind)
+		}
+		compression[kind] = true
+	}
+	return compression, nil
+}
+
+// String returns the list of the compressed tables.
+func (c FreezerCompression) String() string {
+	var kinds []string
+	for kind := range freezerNoSnappy {
+		if c.compressed(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, ",")
+}
+
+// compressed reports whether new tables of the given kind are compressed.
+func (c FreezerCompression) compressed(kind string) bool {
+	if compressed, ok := c[kind]; ok {
+		return compressed
+	}
+	return !freezerNoSnappy[kind]
+}
+
+// tableIndexFile returns the path of the index file of a table in the given
+// format.
+func tableIndexFile(datadir, name string, compressed bool) string {
+	if compressed {
+		return filepath.Join(datadir, name+".cidx")
+	}
+	return filepath.Join(datadir, name+".ridx")
+}
+
+// tableDataFiles returns the paths of the data files of a table in the given
+// format.
+func tableDataFiles(datadir, name string, compressed bool) ([]string, error) {
+	ext := "rdat"
+	if compressed {
+		ext = "cdat"
+	}
+	return filepath.Glob(filepath.Join(datadir, name+".[0-9][0-9][0-9][0-9]."+ext))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// storedCompression reports the format of the table of the given kind stored in
+// datadir, if there is any.
+func storedCompression(datadir, kind string) (compressed bool, exists bool, err error) {
+	raw, cmp := fileExists(tableIndexFile(datadir, kind, false)), fileExists(tableIndexFile(datadir, kind, true))
+	if raw && cmp {
+		return false, true, fmt.Errorf("table %s stored both raw and compressed", kind)
+	}
+	return cmp, raw || cmp, nil
+}
+
+// tableCompression resolves whether the table of the given kind is to be opened
+// compressed: existing tables stay in their stored format, new ones follow the
+// settings. A recompression interrupted earlier is resolved first.
+func tableCompression(datadir, kind string, compression FreezerCompression) (bool, error) {
+	if err := recoverRecompression(datadir, kind); err != nil {
+		return false, err
+	}
+	compressed, exists, err := storedCompression(datadir, kind)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return compression.compressed(kind), nil
+	}
+	if compressed != compression.compressed(kind) {
+		log.Warn("Ancient table compression differs from the configured one", "table", kind, "compressed", compressed)
+	}
+	return compressed, nil
+}
+
+// RecompressFreezer converts the tables of the ancient store in datadir, which
+// must not be in use, whose format differs from the given compression settings,
+// returning the kinds of the tables converted.
+//
+// Each table is rewritten next to the original one, which is only replaced once
+// the new one is complete, so an interrupted conversion is either discarded or
+// completed the next time the ancient store is opened.
+func RecompressFreezer(datadir string, compression FreezerCompression) ([]string, error) {
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	var (
+		kinds     []string
+		converted []string
+	)
+	for kind := range freezerNoSnappy {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if err := recoverRecompression(datadir, kind); err != nil {
+			return converted, err
+		}
+		compressed, exists, err := storedCompression(datadir, kind)
+		if err != nil {
+			return converted, err
+		}
+		if !exists || compressed == compression.compressed(kind) {
+			continue
+		}
+		if err := recompressTable(datadir, kind, !compressed); err != nil {
+			return converted, fmt.Errorf("failed to recompress table %s: %v", kind, err)
+		}
+		converted = append(converted, kind)
+	}
+	return converted, nil
+}
+
+// recompressTable rewrites the table of the given kind in the requested format.
+func recompressTable(datadir, kind string, compress bool) error {
+	src, err := newTable(datadir, kind, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, compress)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var (
+		tail  = uint64(atomic.LoadUint32(&src.itemOffset))
+		items = atomic.LoadUint64(&src.items)
+	)
+	if tail > 0 && tail == items {
+		return fmt.Errorf("no items retained above tail %d", tail)
+	}
+	log.Info("Recompressing ancient table", "table", kind, "compress", compress, "items", items-tail)
+
+	staging := kind + recompressSuffix
+	dst, err := newTable(datadir, staging, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, !compress)
+	if err != nil {
+		return err
+	}
+	// Carry the tail over, the first index entry recording it as the number of
+	// discarded items in front of the first data file
+	atomic.StoreUint64(&dst.items, tail)
+	dst.itemOffset = uint32(tail)
+	for item := tail; item < items; item++ {
+		blob, err := src.Retrieve(item)
+		if err == nil {
+			err = dst.Append(item, blob)
+		}
+		if err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	head := indexEntry{filenum: 0, offset: uint32(tail)}
+	if _, err := dst.index.WriteAt(head.marshallBinary(), 0); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	// Removing the original index commits the conversion
+	if err := os.Remove(tableIndexFile(datadir, kind, !compress)); err != nil {
+		return err
+	}
+	return finishRecompression(datadir, kind, compress)
+}
+
+// recoverRecompression resolves an interrupted recompression of the table of the
+// given kind, discarding the new table if the original one is still complete,
+// replacing the latter otherwise.
+func recoverRecompression(datadir, kind string) error {
+	staging := kind + recompressSuffix
+	for _, compress := range []bool{false, true} {
+		if !fileExists(tableIndexFile(datadir, staging, compress)) {
+			continue
+		}
+		if !fileExists(tableIndexFile(datadir, kind, !compress)) {
+			log.Info("Completing interrupted ancient table recompression", "table", kind)
+			return finishRecompression(datadir, kind, compress)
+		}
+		log.Warn("Discarding interrupted ancient table recompression", "table", kind)
+		files, err := tableDataFiles(datadir, staging, compress)
+		if err != nil {
+			return err
+		}
+		for _, file := range append(files, tableIndexFile(datadir, staging, compress)) {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finishRecompression replaces the data files of the original table of the given
+// kind, whose index is gone already, with the recompressed ones, moving the new
+// index in place last.
+func finishRecompression(datadir, kind string, compress bool) error {
+	staging := kind + recompressSuffix
+
+	files, err := tableDataFiles(datadir, kind, !compress)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	if files, err = tableDataFiles(datadir, staging, compress); err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := kind + strings.TrimPrefix(filepath.Base(file), staging)
+		if err := os.Rename(file, filepath.Join(datadir, name)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tableIndexFile(datadir, staging, compress), tableIndexFile(datadir, kind, compress))
+}
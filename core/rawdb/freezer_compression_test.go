@@ -0,0 +1,227 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// checkStoredCompression ensures the tables in dir are stored in the format of
+// the given settings.
+func checkStoredCompression(t *testing.T, dir string, compression FreezerCompression) {
+	t.Helper()
+
+	for kind := range freezerNoSnappy {
+		compressed, exists, err := storedCompression(dir, kind)
+		if err != nil || !exists {
+			t.Fatalf("table %s missing: %v", kind, err)
+		}
+		if compressed != compression.compressed(kind) {
+			t.Fatalf("table %s compression mismatch: have %v, want %v", kind, compressed, !compressed)
+		}
+	}
+}
+
+// Tests that new ancient tables follow the compression settings, existing ones
+// keep their format until recompressed, and recompression keeps the data.
+func TestFreezerCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	raw, err := ParseFreezerCompression("hashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFreezerCompression("hashes,blobs"); err == nil {
+		t.Fatal("unknown table accepted")
+	}
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", &FreezerOptions{Compression: raw})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	var blocks []*types.Block
+	for i := 0; i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: bytes.Repeat([]byte{'x'}, 64)})
+		WriteAncientBlock(db, block, nil, big.NewInt(int64(i)))
+		blocks = append(blocks, block)
+	}
+	db.Close()
+	checkStoredCompression(t, dir, raw)
+
+	// Reopening with other settings keeps the stored format
+	db, err = NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", &FreezerOptions{Compression: DefaultFreezerCompression()})
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	db.Close()
+	checkStoredCompression(t, dir, raw)
+
+	// Recompression converts all the tables differing from the settings
+	converted, err := RecompressFreezer(dir, DefaultFreezerCompression())
+	if err != nil {
+		t.Fatalf("recompression failed: %v", err)
+	}
+	if len(converted) != 4 {
+		t.Fatalf("converted tables mismatch: have %v, want all but diffs", converted)
+	}
+	checkStoredCompression(t, dir, DefaultFreezerCompression())
+	if converted, err := RecompressFreezer(dir, DefaultFreezerCompression()); err != nil || len(converted) != 0 {
+		t.Fatalf("repeated recompression converted %v: %v", converted, err)
+	}
+	db, err = NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if frozen, _ := db.Ancients(); frozen != 10 {
+		t.Fatalf("frozen items mismatch: have %d, want 10", frozen)
+	}
+	for _, block := range blocks {
+		if hash := ReadCanonicalHash(db, block.NumberU64()); hash != block.Hash() {
+			t.Fatalf("block #%d hash mismatch: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+		if header := ReadHeader(db, block.Hash(), block.NumberU64()); header == nil || header.Hash() != block.Hash() {
+			t.Fatalf("block #%d header mismatch", block.NumberU64())
+		}
+	}
+}
+
+// Tests that recompressing a table carries its tail over, and that interrupted
+// recompressions are discarded or completed depending on how far they got.
+func TestRecompressTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-recompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create a table spanning several files and drop the first ones
+	table, err := newCustomTable(dir, freezerBodiesTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := table.Append(uint64(i), bytes.Repeat([]byte{byte(i)}, 10)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	tail, err := table.truncateTail(12)
+	if err != nil || tail != 10 {
+		t.Fatalf("tail truncation mismatch: have %d (%v), want 10", tail, err)
+	}
+	table.Close()
+
+	check := func(compressed bool) {
+		t.Helper()
+
+		table, err := newTable(dir, freezerBodiesTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, !compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer table.Close()
+
+		if table.items != 30 || table.itemOffset != 10 {
+			t.Fatalf("table bounds mismatch: have %d items from %d, want 30 from 10", table.items, table.itemOffset)
+		}
+		for i := 10; i < 30; i++ {
+			if blob, err := table.Retrieve(uint64(i)); err != nil || !bytes.Equal(blob, bytes.Repeat([]byte{byte(i)}, 10)) {
+				t.Fatalf("item %d mismatch: %x, %v", i, blob, err)
+			}
+		}
+		if _, err := table.Retrieve(9); err == nil {
+			t.Fatal("discarded item retrieved")
+		}
+	}
+	if err := recompressTable(dir, freezerBodiesTable, true); err != nil {
+		t.Fatalf("recompression failed: %v", err)
+	}
+	check(true)
+
+	// Recompressions interrupted before replacing the original table are dropped
+	staging := freezerBodiesTable + recompressSuffix
+	if err := ioutil.WriteFile(tableIndexFile(dir, staging, false), make([]byte, indexEntrySize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := recoverRecompression(dir, freezerBodiesTable); err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	if fileExists(tableIndexFile(dir, staging, false)) {
+		t.Fatal("interrupted recompression left behind")
+	}
+	check(true)
+
+	// Ones interrupted while replacing it are completed
+	if err := os.Rename(tableIndexFile(dir, freezerBodiesTable, true), tableIndexFile(dir, staging, true)); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := tableDataFiles(dir, freezerBodiesTable, true)
+	if err := os.Rename(files[0], filepath.Join(dir, staging+filepath.Base(files[0])[len(freezerBodiesTable):])); err != nil {
+		t.Fatal(err)
+	}
+	if err := recoverRecompression(dir, freezerBodiesTable); err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	check(true)
+}
+
+// Tests that the reference remote server serves the same items regardless of
+// their compression.
+func TestRemoteServerCompression(t *testing.T) {
+	mem := lib.NewMemFreezerRemoteServerAPI()
+	blob := bytes.Repeat([]byte{'x'}, 100)
+	for i := 0; i < 5; i++ {
+		if err := mem.AppendAncient(uint64(i), blob, blob, blob, blob, blob); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+		if i == 2 {
+			if err := mem.SetCompression([]string{FreezerRemoteBodiesTable}); err != nil {
+				t.Fatalf("failed to enable compression: %v", err)
+			}
+		}
+	}
+	size, _ := mem.AncientSize(FreezerRemoteBodiesTable)
+	if raw, _ := mem.AncientSize(FreezerRemoteHeaderTable); size >= raw {
+		t.Fatalf("compressed table not smaller: %d >= %d", size, raw)
+	}
+	for _, kinds := range [][]string{{FreezerRemoteBodiesTable}, nil} {
+		if err := mem.SetCompression(kinds); err != nil {
+			t.Fatalf("failed to set compression: %v", err)
+		}
+		for i := uint64(0); i < 5; i++ {
+			if item, err := mem.Ancient(FreezerRemoteBodiesTable, i); err != nil || !bytes.Equal(item, blob) {
+				t.Fatalf("compression %v: item %d mismatch: %v", kinds, i, err)
+			}
+		}
+		items, err := mem.AncientRange(FreezerRemoteBodiesTable, 0, 5, 1000)
+		if err != nil || len(items) != 5 || !bytes.Equal(items[4], blob) {
+			t.Fatalf("compression %v: range mismatch: %v", kinds, err)
+		}
+	}
+}
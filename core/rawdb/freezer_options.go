@@ -0,0 +1,159 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// defaultFreezerFileSize is the default maximum size of the data files of the
+// ancient tables.
+const defaultFreezerFileSize = 2 * 1000 * 1000 * 1000
+
+// AggressiveFreezerThreshold is the number of recent blocks not to freeze in
+// aggressive mode, unless configured otherwise.
+const AggressiveFreezerThreshold = 128
+
+// freezerMaxItemSize is the size of the largest item the ancient tables can
+// store, the offsets of their index being 32 bits wide.
+var freezerMaxItemSize uint64 = math.MaxUint32
+
+// errItemTooLarge is returned if an item is too large for the ancient tables to
+// address it.
+var errItemTooLarge = errors.New("ancient item too large")
+
+// FreezerOptions tunes the freezing of the chain into the ancient store and the
+// tables of the local one. The zero value, as well as nil, selects the defaults.
+type FreezerOptions struct {
+	// Threshold is the number of recent blocks kept in the key-value store rather
+	// than frozen. If zero, vars.FullImmutabilityThreshold, or
+	// AggressiveFreezerThreshold in aggressive mode.
+	Threshold uint64
+
+	// Aggressive freezes the blocks as soon as they pass the threshold, checking
+	// the chain progression every few seconds instead of every minute.
+	Aggressive bool
+
+	// Compression configures the tables to snappy-compress when created.
+	Compression FreezerCompression
+
+	// FileSizes is the maximum size of the data files of the tables, by kind, the
+	// ones missing using 2GB. Items larger than the limit are stored in a data
+	// file of their own.
+	FileSizes map[string]uint32
+
+	// SyncItems is the number of items appended to a table after which it's
+	// flushed to disk. If zero, tables are only flushed after each freezing
+	// batch.
+	SyncItems uint64
+
+	// Genesis and NetworkID identify the chain to a remote freezer shared between
+	// chains, which is handshaken when the database is opened. The genesis of the
+	// key-value store, if any, overrides Genesis. Without either, or without a
+	// network id, the chain identity isn't verified.
+	Genesis   common.Hash
+	NetworkID uint64
+}
+
+// threshold returns the number of recent blocks not to freeze, warning if the
+// chain can't be reorganised that deep anymore.
+func (o *FreezerOptions) threshold() uint64 {
+	switch {
+	case o == nil:
+		return vars.FullImmutabilityThreshold
+	case o.Threshold == 0 && o.Aggressive:
+		return AggressiveFreezerThreshold
+	case o.Threshold == 0:
+		return vars.FullImmutabilityThreshold
+	}
+	if o.Threshold < vars.FullImmutabilityThreshold {
+		log.Warn("Freezing blocks below the immutability threshold, deeper reorgs can't be handled", "threshold", o.Threshold, "immutability", vars.FullImmutabilityThreshold)
+	}
+	return o.Threshold
+}
+
+func (o *FreezerOptions) recheckInterval() time.Duration {
+	if o != nil && o.Aggressive {
+		return freezerAggressiveRecheckInterval
+	}
+	return freezerRecheckInterval
+}
+
+func (o *FreezerOptions) compression() FreezerCompression {
+	if o == nil {
+		return nil
+	}
+	return o.Compression
+}
+
+func (o *FreezerOptions) fileSize(kind string) uint32 {
+	if o != nil && o.FileSizes[kind] > 0 {
+		return o.FileSizes[kind]
+	}
+	return defaultFreezerFileSize
+}
+
+func (o *FreezerOptions) syncItems() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.SyncItems
+}
+
+// ParseFreezerFileSizes parses a comma separated list of maximum data file sizes
+// in bytes, either applying to all tables or to a given kind, e.g.
+// "1000000000,bodies=4000000000", later entries overriding the earlier ones.
+func ParseFreezerFileSizes(list string) (map[string]uint32, error) {
+	sizes := make(map[string]uint32)
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		kinds, value := []string(nil), entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			kind := strings.TrimSpace(entry[:i])
+			if _, ok := freezerNoSnappy[kind]; !ok {
+				return nil, fmt.Errorf("%w: %s", errUnknownTable, kind)
+			}
+			kinds, value = []string{kind}, strings.TrimSpace(entry[i+1:])
+		} else {
+			for kind := range freezerNoSnappy {
+				kinds = append(kinds, kind)
+			}
+		}
+		size, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file size %q, must be at most %d bytes: %v", value, uint32(math.MaxUint32), err)
+		}
+		if size == 0 {
+			return nil, fmt.Errorf("invalid file size %q", value)
+		}
+		for _, kind := range kinds {
+			sizes[kind] = uint32(size)
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests the parsing of the ancient data file size settings.
+func TestParseFreezerFileSizes(t *testing.T) {
+	sizes, err := ParseFreezerFileSizes("1000, bodies=4000000000,hashes = 50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind := range freezerNoSnappy {
+		want := uint32(1000)
+		switch kind {
+		case freezerBodiesTable:
+			want = 4000000000
+		case freezerHashTable:
+			want = 50
+		}
+		if sizes[kind] != want {
+			t.Errorf("table %s size mismatch: have %d, want %d", kind, sizes[kind], want)
+		}
+	}
+	for _, list := range []string{"0", "blobs=1000", "5000000000", "bodies=x"} {
+		if _, err := ParseFreezerFileSizes(list); err == nil {
+			t.Errorf("invalid sizes %q accepted", list)
+		}
+	}
+	options := &FreezerOptions{FileSizes: sizes}
+	if size := options.fileSize(freezerHeaderTable); size != 1000 {
+		t.Errorf("header file size mismatch: have %d, want 1000", size)
+	}
+	if size := (*FreezerOptions)(nil).fileSize(freezerHeaderTable); size != defaultFreezerFileSize {
+		t.Errorf("default file size mismatch: have %d, want %d", size, defaultFreezerFileSize)
+	}
+}
+
+// Tests that items larger than the data files get a file of their own, and the
+// ones the index can't address are rejected.
+func TestFreezerTableItemSizes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-sizes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newCustomTable(dir, "sizes", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+
+	items := [][]byte{getChunk(20, 0), getChunk(120, 1), getChunk(20, 2), getChunk(20, 3)}
+	for i, item := range items {
+		if err := table.Append(uint64(i), item); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	for i, item := range items {
+		blob, err := table.Retrieve(uint64(i))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", i, err)
+		}
+		if !bytes.Equal(blob, item) {
+			t.Fatalf("item %d mismatch", i)
+		}
+	}
+	// The large item went into the second file, and the following ones into a third
+	if head := table.headId; head != 2 {
+		t.Fatalf("head file mismatch: have %d, want 2", head)
+	}
+	defer func(limit uint64) { freezerMaxItemSize = limit }(freezerMaxItemSize)
+	freezerMaxItemSize = 100
+
+	if err := table.Append(uint64(len(items)), getChunk(101, 4)); !errors.Is(err, errItemTooLarge) {
+		t.Fatalf("oversized item error mismatch: have %v, want %v", err, errItemTooLarge)
+	}
+	if table.items != uint64(len(items)) {
+		t.Fatalf("item count mismatch: have %d, want %d", table.items, len(items))
+	}
+}
+
+// Tests that oversized blocks are refused by the freezer without touching any
+// of its tables, and that the tables are flushed every so many items.
+func TestFreezerOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", &FreezerOptions{
+		FileSizes: map[string]uint32{freezerHeaderTable: 256},
+		SyncItems: 4,
+	})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: bytes.Repeat([]byte{'x'}, 64)})
+		WriteAncientBlock(db, block, nil, big.NewInt(int64(i)))
+	}
+	// The headers are split across small files, the other tables aren't
+	if _, err := os.Stat(filepath.Join(dir, freezerHeaderTable+".0001.cdat")); err != nil {
+		t.Fatalf("small header files not used: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, freezerHashTable+".0001.rdat")); err == nil {
+		t.Fatal("hash table split across files")
+	}
+	defer func(limit uint64) { freezerMaxItemSize = limit }(freezerMaxItemSize)
+	freezerMaxItemSize = 128
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10), Extra: bytes.Repeat([]byte{'x'}, 256)})
+	if err := db.AppendAncient(10, block.Hash().Bytes(), []byte{0x01}, []byte{0x02}, []byte{0x03}, make([]byte, 129)); !errors.Is(err, errItemTooLarge) {
+		t.Fatalf("oversized block error mismatch: have %v, want %v", err, errItemTooLarge)
+	}
+	if frozen, _ := db.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want 10", frozen)
+	}
+	for kind := range freezerNoSnappy {
+		if size, _ := db.AncientSize(kind); size == 0 {
+			t.Fatalf("table %s empty", kind)
+		}
+		if _, err := db.Ancient(kind, 10); err == nil {
+			t.Fatalf("table %s holds part of the refused block", kind)
+		}
+	}
+}
+
+// Tests that the freezer keeps the configured number of recent blocks in the
+// key-value store.
+func TestFreezerThreshold(t *testing.T) {
+	if threshold := (*FreezerOptions)(nil).threshold(); threshold != vars.FullImmutabilityThreshold {
+		t.Errorf("default threshold mismatch: have %d, want %d", threshold, vars.FullImmutabilityThreshold)
+	}
+	aggressive := &FreezerOptions{Aggressive: true}
+	if threshold := aggressive.threshold(); threshold != AggressiveFreezerThreshold {
+		t.Errorf("aggressive threshold mismatch: have %d, want %d", threshold, AggressiveFreezerThreshold)
+	}
+	if interval := aggressive.recheckInterval(); interval != freezerAggressiveRecheckInterval {
+		t.Errorf("aggressive recheck interval mismatch: have %v, want %v", interval, freezerAggressiveRecheckInterval)
+	}
+	dir, err := ioutil.TempDir("", "freezer-threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", &FreezerOptions{Threshold: 4})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for i := uint64(0); i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(i)})
+		WriteBlock(db, block)
+		WriteReceipts(db, block.Hash(), i, nil)
+		WriteTd(db, block.Hash(), i, big.NewInt(int64(i)))
+		WriteCanonicalHash(db, block.Hash(), i)
+		WriteHeadBlockHash(db, block.Hash())
+	}
+	trigger := make(chan struct{}, 1)
+	db.(*freezerdb).AncientStore.(*freezer).trigger <- trigger
+	<-trigger
+
+	if frozen, _ := db.Ancients(); frozen != 6 {
+		t.Fatalf("frozen count mismatch: have %d, want 6", frozen)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// freezeGate pauses the background loop of a freezer at a block boundary, once
+// the blocks being frozen are flushed, e.g. for the database to be backed up.
+type freezeGate struct {
+	paused uint32             // Whether freezing is paused or being paused (accessed atomically)
+	pause  chan chan struct{} // Pause requests, acknowledged once the freezing loop is idle
+	resume chan struct{}      // Resume requests of a paused freezing loop
+}
+
+func newFreezeGate() *freezeGate {
+	return &freezeGate{
+		pause:  make(chan chan struct{}),
+		resume: make(chan struct{}),
+	}
+}
+
+// stopping reports whether the freezing loop should stop freezing blocks.
+func (g *freezeGate) stopping() bool {
+	return atomic.LoadUint32(&g.paused) == 1
+}
+
+// Pause stops the freezing loop from freezing new blocks, returning once the
+// blocks being frozen are flushed, or the freezer is closed.
+func (g *freezeGate) Pause(quit chan struct{}) {
+	if !atomic.CompareAndSwapUint32(&g.paused, 0, 1) {
+		return
+	}
+	ack := make(chan struct{})
+	select {
+	case g.pause <- ack:
+		<-ack
+	case <-quit:
+	}
+}
+
+// Resume lets the paused freezing loop freeze blocks again.
+func (g *freezeGate) Resume(quit chan struct{}) {
+	if !atomic.CompareAndSwapUint32(&g.paused, 1, 0) {
+		return
+	}
+	select {
+	case g.resume <- struct{}{}:
+	case <-quit:
+	}
+}
+
+// wait blocks the freezing loop at a block boundary while paused, returning
+// false if the freezer is closed meanwhile.
+func (g *freezeGate) wait(quit chan struct{}) bool {
+	if !g.stopping() {
+		return true
+	}
+	select {
+	case ack := <-g.pause:
+		return g.hold(ack, quit)
+	case <-quit:
+		return false
+	}
+}
+
+// hold acknowledges a pause request of the freezing loop and blocks it until
+// resumed, returning false if the freezer is closed meanwhile.
+func (g *freezeGate) hold(ack chan struct{}, quit chan struct{}) bool {
+	log.Info("Freezer paused")
+	close(ack)
+	select {
+	case <-g.resume:
+		log.Info("Freezer resumed")
+		return true
+	case <-quit:
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that a paused freezer doesn't freeze any block until resumed.
+func TestFreezerPause(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", &FreezerOptions{Threshold: 4})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	pauser, ok := db.(AncientFreezePauser)
+	if !ok {
+		t.Fatal("freezer database can't be paused")
+	}
+	pauser.PauseFreezing()
+	pauser.PauseFreezing() // Pausing twice is a no-op
+
+	for i := uint64(0); i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(i)})
+		WriteBlock(db, block)
+		WriteReceipts(db, block.Hash(), i, nil)
+		WriteTd(db, block.Hash(), i, big.NewInt(int64(i)))
+		WriteCanonicalHash(db, block.Hash(), i)
+		WriteHeadBlockHash(db, block.Hash())
+	}
+	trigger := make(chan struct{}, 1)
+	select {
+	case db.(*freezerdb).AncientStore.(*freezer).trigger <- trigger:
+		t.Fatal("paused freezer triggered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if frozen, _ := db.Ancients(); frozen != 0 {
+		t.Fatalf("paused freezer froze %d blocks", frozen)
+	}
+	pauser.ResumeFreezing()
+
+	db.(*freezerdb).AncientStore.(*freezer).trigger <- trigger
+	<-trigger
+	if frozen, _ := db.Ancients(); frozen != 6 {
+		t.Fatalf("frozen count mismatch: have %d, want 6", frozen)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	FreezerMethodCreateCheckpoint = "freezer_createCheckpoint"
+	FreezerMethodListCheckpoints  = "freezer_listCheckpoints"
+)
+
+// AncientCheckpoint describes a consistent snapshot of the ancient tables kept
+// by the ancient store, taken at a given item count.
+type AncientCheckpoint struct {
+	Name    string    `json:"name"`
+	Items   uint64    `json:"items"`
+	Created time.Time `json:"created"`
+}
+
+// AncientCheckpointer is implemented by ancient stores able to snapshot their
+// tables on request, such as remote freezers supporting checkpoints.
+type AncientCheckpointer interface {
+	// CreateCheckpoint snapshots the first items of all the ancient tables under
+	// the given name.
+	CreateCheckpoint(name string, items uint64) (*AncientCheckpoint, error)
+
+	// ListCheckpoints returns the checkpoints held by the ancient store.
+	ListCheckpoints() ([]*AncientCheckpoint, error)
+}
+
+// CreateCheckpoint asks the remote freezer to snapshot or hard-link its tables
+// at the given item count. Servers not implementing checkpoints return
+// errNotSupported.
+//
+// The journaled blocks not sent yet, if any, are sent first, so that the
+// checkpoint can cover them.
+func (api *FreezerRemoteClient) CreateCheckpoint(name string, items uint64) (*AncientCheckpoint, error) {
+	if api.journal != nil {
+		if err := api.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	var res AncientCheckpoint
+	err := api.client.Call(&res, FreezerMethodCreateCheckpoint, name, items)
+	if rerr, ok := err.(rpc.Error); ok && rerr.ErrorCode() == -32601 {
+		return nil, errNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListCheckpoints returns the checkpoints held by the remote freezer.
+func (api *FreezerRemoteClient) ListCheckpoints() ([]*AncientCheckpoint, error) {
+	var res []*AncientCheckpoint
+	err := api.client.Call(&res, FreezerMethodListCheckpoints)
+	if rerr, ok := err.(rpc.Error); ok && rerr.ErrorCode() == -32601 {
+		return nil, errNotSupported
+	}
+	return res, err
+}
+
+// CreateCheckpoint snapshots the ancient store, mirrored items included, if the
+// remote store supports it.
+func (t *tieredAncientStore) CreateCheckpoint(name string, items uint64) (*AncientCheckpoint, error) {
+	if checkpointer, ok := t.AncientStore.(AncientCheckpointer); ok {
+		return checkpointer.CreateCheckpoint(name, items)
+	}
+	return nil, errNotSupported
+}
+
+// ListCheckpoints returns the checkpoints held by the remote store.
+func (t *tieredAncientStore) ListCheckpoints() ([]*AncientCheckpoint, error) {
+	if checkpointer, ok := t.AncientStore.(AncientCheckpointer); ok {
+		return checkpointer.ListCheckpoints()
+	}
+	return nil, errNotSupported
+}
+
+// CreateCheckpoint snapshots the ancient store, if it supports it.
+func (frdb *freezerdb) CreateCheckpoint(name string, items uint64) (*AncientCheckpoint, error) {
+	if checkpointer, ok := frdb.AncientStore.(AncientCheckpointer); ok {
+		return checkpointer.CreateCheckpoint(name, items)
+	}
+	return nil, errNotSupported
+}
+
+// ListCheckpoints returns the checkpoints held by the ancient store, if it
+// supports them.
+func (frdb *freezerdb) ListCheckpoints() ([]*AncientCheckpoint, error) {
+	if checkpointer, ok := frdb.AncientStore.(AncientCheckpointer); ok {
+		return checkpointer.ListCheckpoints()
+	}
+	return nil, errNotSupported
+}
+
+// ListAncientCheckpoints returns the checkpoints held by the ancient store of the
+// database.
+func ListAncientCheckpoints(db ethdb.Database) ([]*AncientCheckpoint, error) {
+	checkpointer, ok := db.(AncientCheckpointer)
+	if !ok {
+		return nil, errNotSupported
+	}
+	return checkpointer.ListCheckpoints()
+}
+
+// createAncientCheckpoint snapshots the first items of the ancient store of the
+// database under a name derived from the given time, returning errNotSupported
+// if it can't take checkpoints.
+func createAncientCheckpoint(db ethdb.Database, created time.Time, items uint64) (*AncientCheckpoint, error) {
+	checkpointer, ok := db.(AncientCheckpointer)
+	if !ok {
+		return nil, errNotSupported
+	}
+	name := fmt.Sprintf("backup-%s", created.Format("20060102-150405.000"))
+	return checkpointer.CreateCheckpoint(name, items)
+}
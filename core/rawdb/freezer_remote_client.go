@@ -2,12 +2,12 @@ package rawdb
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -15,11 +15,20 @@ import (
 // The struct's methods delegate the business logic to an external server
 // that is responsible for managing an actual ancient store.
 type FreezerRemoteClient struct {
+	noRange   uint32 // Flag whether the server lacks the range API (accessed atomically)
 	client    *rpc.Client
 	quit      chan struct{}
 	threshold uint64             // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
+	recheck   time.Duration      // Time between two checks for blocks to freeze
 	trigger   chan chan struct{} // Manual blocking freeze trigger, test determinism
+	gate      *freezeGate        // Pauses the freezing at a block boundary
 	closeOnce sync.Once
+
+	journal     *remoteJournal // Write-ahead journal of the appended blocks, nil on read-only secondary clients
+	journalLock sync.Mutex
+
+	outage     error // Error the last write failed with because of the remote freezer being unreachable
+	outageLock sync.Mutex
 }
 
 const (
@@ -27,23 +36,30 @@ const (
 	FreezerMethodHasAncient       = "freezer_hasAncient"
 	FreezerMethodAncient          = "freezer_ancient"
 	FreezerMethodAncients         = "freezer_ancients"
+	FreezerMethodAncientRange     = "freezer_ancientRange"
 	FreezerMethodAncientSize      = "freezer_ancientSize"
 	FreezerMethodAppendAncient    = "freezer_appendAncient"
 	FreezerMethodTruncateAncients = "freezer_truncateAncients"
+	FreezerMethodTruncateTail     = "freezer_truncateTail"
 	FreezerMethodSync             = "freezer_sync"
 )
 
-// newFreezerRemoteClient constructs a rpc client to connect to a remote freezer
-func newFreezerRemoteClient(endpoint string) (*FreezerRemoteClient, error) {
+// newFreezerRemoteClient constructs a rpc client to connect to a remote freezer,
+// journaling the appended blocks in the given key-value store, and freezing the
+// blocks as tuned by the given options (the defaults if nil).
+func newFreezerRemoteClient(endpoint string, db ethdb.KeyValueStore, options *FreezerOptions) (*FreezerRemoteClient, error) {
 	client, err := rpc.Dial(endpoint)
 	if err != nil {
 		return nil, err
 	}
 	return &FreezerRemoteClient{
 		client:    client,
-		threshold: vars.FullImmutabilityThreshold,
+		threshold: options.threshold(),
+		recheck:   options.recheckInterval(),
 		quit:      make(chan struct{}),
 		trigger:   make(chan chan struct{}),
+		gate:      newFreezeGate(),
+		journal:   openRemoteJournal(db),
 	}, nil
 }
 
@@ -55,6 +71,9 @@ func (api *FreezerRemoteClient) Close() error {
 // HasAncient returns an indicator whether the specified ancient data exists
 // in the freezer.
 func (api *FreezerRemoteClient) HasAncient(kind string, number uint64) (bool, error) {
+	if api.journaled(number) {
+		return true, nil
+	}
 	var res bool
 	err := api.client.Call(&res, FreezerMethodHasAncient, kind, number)
 	return res, err
@@ -62,6 +81,14 @@ func (api *FreezerRemoteClient) HasAncient(kind string, number uint64) (bool, er
 
 // Ancient retrieves an ancient binary blob from the append-only immutable files.
 func (api *FreezerRemoteClient) Ancient(kind string, number uint64) ([]byte, error) {
+	if api.journal != nil {
+		api.journalLock.Lock()
+		if api.journal.contains(number) {
+			defer api.journalLock.Unlock()
+			return api.journal.item(kind, number)
+		}
+		api.journalLock.Unlock()
+	}
 	res := []byte{}
 	if err := api.client.Call(&res, FreezerMethodAncient, kind, number); err != nil {
 		return nil, err
@@ -69,11 +96,99 @@ func (api *FreezerRemoteClient) Ancient(kind string, number uint64) ([]byte, err
 	return res, nil
 }
 
-// Ancients returns the length of the frozen items.
+// AncientRange retrieves up to count consecutive ancient binary blobs of the
+// given kind starting at start, stopping once maxBytes is exceeded. At least one
+// blob is returned if the first one exists.
+//
+// Servers not implementing the range API are served by retrieving the items one
+// by one instead.
+func (api *FreezerRemoteClient) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	if api.journaled(start) {
+		var (
+			res  [][]byte
+			size uint64
+		)
+		for i := uint64(0); i < count && size < maxBytes && api.journaled(start+i); i++ {
+			blob, err := api.Ancient(kind, start+i)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, blob)
+			size += uint64(len(blob))
+		}
+		return res, nil
+	}
+	if atomic.LoadUint32(&api.noRange) == 0 {
+		var res [][]byte
+		err := api.client.Call(&res, FreezerMethodAncientRange, kind, start, count, maxBytes)
+		if err == nil {
+			return res, nil
+		}
+		if rerr, ok := err.(rpc.Error); !ok || rerr.ErrorCode() != -32601 {
+			return nil, err
+		}
+		log.Warn("Remote freezer does not support range retrievals", "method", FreezerMethodAncientRange)
+		atomic.StoreUint32(&api.noRange, 1)
+	}
+	var (
+		res  [][]byte
+		size uint64
+	)
+	for i := uint64(0); i < count && size < maxBytes; i++ {
+		blob, err := api.Ancient(kind, start+i)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			break
+		}
+		res = append(res, blob)
+		size += uint64(len(blob))
+	}
+	return res, nil
+}
+
+// Ancients returns the length of the frozen items, including the journaled ones
+// not synced by the remote freezer yet. The journaled blocks not sent yet, if
+// any, are sent as soon as the remote freezer is reachable again.
 func (api *FreezerRemoteClient) Ancients() (uint64, error) {
 	var res uint64
 	err := api.client.Call(&res, FreezerMethodAncients)
-	return res, err
+	if api.journal == nil {
+		return res, err
+	}
+	api.journalLock.Lock()
+	defer api.journalLock.Unlock()
+
+	j := api.journal
+	if err != nil {
+		if isRemoteOutage(err) && j.frozen > 0 {
+			j.offline = true
+			return j.frozen, nil
+		}
+		return res, err
+	}
+	if j.sent < j.end {
+		if err := j.deliver(api.client); err != nil {
+			log.Warn("Failed to replay remote freezer journal", "err", err)
+		}
+	}
+	if j.begin < j.end && j.end > res {
+		res = j.end
+	}
+	j.frozen = res
+	return res, nil
+}
+
+// journaled reports whether the given block is journaled.
+func (api *FreezerRemoteClient) journaled(number uint64) bool {
+	if api.journal == nil {
+		return false
+	}
+	api.journalLock.Lock()
+	defer api.journalLock.Unlock()
+
+	return api.journal.contains(number)
 }
 
 // AncientSize returns the ancient size of the specified category.
@@ -83,6 +198,12 @@ func (api *FreezerRemoteClient) AncientSize(kind string) (uint64, error) {
 	return res, err
 }
 
+// AncientDatadir returns an error, since the remote ancient store is not held on
+// the local file system.
+func (api *FreezerRemoteClient) AncientDatadir() (string, error) {
+	return "", errNotSupported
+}
+
 // AppendAncient injects all binary blobs belong to block at the end of the
 // append-only immutable table files.
 //
@@ -91,18 +212,121 @@ func (api *FreezerRemoteClient) AncientSize(kind string) (uint64, error) {
 // the same time, we can get into the trouble.
 //
 // Note that the frozen marker is updated outside of the service calls.
+//
+// The block is journaled before being sent, and acknowledged even if the remote
+// freezer is unreachable, to be resent once it is reachable again.
 func (api *FreezerRemoteClient) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
-	return api.client.Call(nil, FreezerMethodAppendAncient, number, hash, header, body, receipts, td)
+	api.journalLock.Lock()
+	defer api.journalLock.Unlock()
+
+	j := api.journal
+	if err := j.append(number, hash, header, body, receipts, td); err != nil {
+		return err
+	}
+	j.frozen = j.end
+
+	err = j.deliver(api.client)
+	api.noteOutage(err)
+	switch {
+	case err == nil:
+		return nil
+	case isRemoteOutage(err):
+		log.Warn("Remote freezer unreachable, journaling ancient block", "number", number, "err", err)
+		return nil
+	}
+	// The remote freezer rejected the block or a previous one, don't acknowledge it
+	j.frozen = number
+	if terr := j.truncate(number); terr != nil {
+		log.Error("Failed to discard rejected ancient block", "number", number, "err", terr)
+	}
+	return err
 }
 
 // TruncateAncients discards any recent data above the provided threshold number.
 func (api *FreezerRemoteClient) TruncateAncients(items uint64) error {
+	api.journalLock.Lock()
+	defer api.journalLock.Unlock()
+
+	if err := api.journal.truncate(items); err != nil {
+		return err
+	}
+	if api.journal.frozen > items {
+		api.journal.frozen = items
+	}
 	return api.client.Call(nil, FreezerMethodTruncateAncients, items)
 }
 
+// TruncateTail discards the items of the given kind below the provided threshold
+// number from the remote store, returning the number of the oldest item retained.
+// Servers not implementing tail truncation retain all their items.
+func (api *FreezerRemoteClient) TruncateTail(kind string, items uint64) (uint64, error) {
+	var res uint64
+	err := api.client.Call(&res, FreezerMethodTruncateTail, kind, items)
+	if rerr, ok := err.(rpc.Error); ok && rerr.ErrorCode() == -32601 {
+		return 0, errNotSupported
+	}
+	return res, err
+}
+
 // Sync flushes all data tables to disk.
+//
+// The journaled blocks not sent yet are sent first, and the ones synced by the
+// remote freezer released from the journal. The blocks being journaled, an
+// unreachable remote freezer is not an error.
 func (api *FreezerRemoteClient) Sync() error {
-	return api.client.Call(nil, FreezerMethodSync)
+	api.journalLock.Lock()
+	defer api.journalLock.Unlock()
+
+	j := api.journal
+	err := j.deliver(api.client)
+	if err == nil {
+		if err = api.client.Call(nil, FreezerMethodSync); err == nil {
+			return j.release()
+		}
+		if isRemoteOutage(err) {
+			j.offline = true
+		}
+	}
+	api.noteOutage(err)
+	if isRemoteOutage(err) {
+		log.Warn("Remote freezer unreachable, retaining journal", "blocks", j.end-j.begin, "err", err)
+		return nil
+	}
+	return err
+}
+
+// PauseFreezing stops sending new blocks to the remote freezer at a block
+// boundary, returning once the blocks being frozen are flushed.
+func (api *FreezerRemoteClient) PauseFreezing() {
+	api.gate.Pause(api.quit)
+}
+
+// ResumeFreezing lets the blocks be sent to the remote freezer again after a
+// pause.
+func (api *FreezerRemoteClient) ResumeFreezing() {
+	api.gate.Resume(api.quit)
+}
+
+// noteOutage records whether a write failed because of the remote freezer being
+// unreachable, or reached it.
+func (api *FreezerRemoteClient) noteOutage(err error) {
+	api.outageLock.Lock()
+	defer api.outageLock.Unlock()
+
+	if isRemoteOutage(err) {
+		api.outage = err
+	} else {
+		api.outage = nil
+	}
+}
+
+// AncientOutage returns the error the last write failed with because of the
+// remote freezer being unreachable, nil if the last write reached it.
+func (api *FreezerRemoteClient) AncientOutage() error {
+	api.outageLock.Lock()
+	defer api.outageLock.Unlock()
+
+	return api.outage
 }
 
 // freezeRemote is a background thread that periodically checks the blockchain for any
@@ -117,7 +341,7 @@ func (api *FreezerRemoteClient) Sync() error {
 // to exist unmodified and untouched by the remote freezer client, which demands
 // a slightly different signature, and uses the freezer.Ancients() method instead
 // of direct access to the atomic freezer.frozen field.
-func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64, quitChan chan struct{}, triggerChanChan chan chan struct{}) {
+func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64, recheck time.Duration, quitChan chan struct{}, triggerChanChan chan chan struct{}, gate *freezeGate) {
 	nfdb := &nofreezedb{KeyValueStore: db}
 
 	var (
@@ -131,6 +355,9 @@ func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64
 			return
 		default:
 		}
+		if !gate.wait(quitChan) {
+			return
+		}
 		if backoff {
 			// If we were doing a manual trigger, notify it
 			if triggered != nil {
@@ -138,10 +365,15 @@ func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64
 				triggered = nil
 			}
 			select {
-			case <-time.NewTimer(freezerRecheckInterval).C:
+			case <-time.NewTimer(recheck).C:
 				backoff = false
 			case triggered = <-triggerChanChan:
 				backoff = false
+			case ack := <-gate.pause:
+				if !gate.hold(ack, quitChan) {
+					return
+				}
+				continue
 			case <-quitChan:
 				return
 			}
@@ -192,7 +424,7 @@ func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64
 			first    = numFrozen
 			ancients = make([]common.Hash, 0, limit-numFrozen)
 		)
-		for numFrozen <= limit {
+		for numFrozen <= limit && !gate.stopping() {
 			// Retrieves all the components of the canonical block
 			hash := ReadCanonicalHash(nfdb, numFrozen)
 			if hash == (common.Hash{}) {
@@ -205,12 +437,12 @@ func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64
 				break
 			}
 			body := ReadBodyRLP(nfdb, hash, numFrozen)
-			if len(body) == 0 {
+			if len(body) == 0 && !historyPruned(nfdb, numFrozen) {
 				log.Error("Block body missing, can't freeze", "number", numFrozen, "hash", hash)
 				break
 			}
 			receipts := ReadReceiptsRLP(nfdb, hash, numFrozen)
-			if len(receipts) == 0 {
+			if len(receipts) == 0 && !historyPruned(nfdb, numFrozen) {
 				log.Error("Block receipts missing, can't freeze", "number", numFrozen, "hash", hash)
 				break
 			}
@@ -239,6 +471,9 @@ func freezeRemote(db ethdb.KeyValueStore, f ethdb.AncientStore, threshold uint64
 				DeleteCanonicalHash(batch, first+uint64(i))
 			}
 		}
+		if len(ancients) > 0 {
+			WriteRemoteAncients(batch, first+uint64(len(ancients)))
+		}
 		if err := batch.Write(); err != nil {
 			log.Crit("Failed to delete frozen canonical blocks", "err", err)
 		}
@@ -23,8 +23,9 @@ func TestClient1(t *testing.T) {
 	client := rpc.DialInProc(server)
 
 	frClient := &FreezerRemoteClient{
-		client: client,
-		quit:   make(chan struct{}),
+		client:  client,
+		quit:    make(chan struct{}),
+		journal: openRemoteJournal(NewMemoryDatabase()),
 	}
 
 	ancientTestProgram := func(head *uint64, i int) {
@@ -96,3 +97,59 @@ func TestClient1(t *testing.T) {
 		t.Fatalf("got: %d, want: 670", n)
 	}
 }
+
+// rangelessFreezerServer is a remote freezer lacking the range API.
+type rangelessFreezerServer struct {
+	mem *lib.MemFreezerRemoteServerAPI
+}
+
+func (s *rangelessFreezerServer) Ancient(kind string, number uint64) ([]byte, error) {
+	return s.mem.Ancient(kind, number)
+}
+
+func TestClientAncientRange(t *testing.T) {
+	mem := lib.NewMemFreezerRemoteServerAPI()
+	for i := 0; i < 10; i++ {
+		b := []byte{uint8(i), uint8(i)}
+		if err := mem.AppendAncient(uint64(i), b, b, b, b, b); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	ranged, rangeless := rpc.NewServer(), rpc.NewServer()
+	if err := ranged.RegisterName("freezer", mem); err != nil {
+		t.Fatal(err)
+	}
+	if err := rangeless.RegisterName("freezer", &rangelessFreezerServer{mem}); err != nil {
+		t.Fatal(err)
+	}
+	for name, server := range map[string]*rpc.Server{"ranged": ranged, "rangeless": rangeless} {
+		frClient := &FreezerRemoteClient{client: rpc.DialInProc(server), quit: make(chan struct{}), journal: openRemoteJournal(NewMemoryDatabase())}
+
+		// Retrieve a range capped by the item count, the byte limit and the data available
+		for _, tt := range []struct {
+			start, count, maxBytes uint64
+			want                   int
+		}{
+			{2, 3, 100, 3},
+			{2, 10, 5, 3},
+			{8, 10, 100, 2},
+			{0, 10, 1, 1},
+		} {
+			blobs, err := frClient.AncientRange(FreezerRemoteBodiesTable, tt.start, tt.count, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("%s: range %d+%d: %v", name, tt.start, tt.count, err)
+			}
+			if len(blobs) != tt.want {
+				t.Fatalf("%s: range %d+%d limit %d: have %d items, want %d", name, tt.start, tt.count, tt.maxBytes, len(blobs), tt.want)
+			}
+			for i, blob := range blobs {
+				if n := uint8(tt.start) + uint8(i); !bytes.Equal(blob, []byte{n, n}) {
+					t.Fatalf("%s: item %d mismatch: have %x", name, n, blob)
+				}
+			}
+		}
+		if _, err := frClient.AncientRange(FreezerRemoteBodiesTable, 10, 1, 100); err == nil {
+			t.Fatalf("%s: out of bounds range retrieved", name)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// fallbackHashItems is the number of canonical hashes of ancient blocks kept
+	// in memory to verify the items retrieved by the fallback against.
+	fallbackHashItems = 65536
+
+	// fallbackRemoteReads is the maximum number of remote reads in flight while
+	// falling back is enabled, including the ones which timed out already. Reads
+	// beyond it fall back right away instead of piling up on a stalled remote.
+	fallbackRemoteReads = 16
+)
+
+var (
+	tierFallbackMeter = metrics.NewRegisteredMeter("ancient/tier/fallback", nil)
+	errAncientTimeout = errors.New("remote ancient read timed out")
+	errAncientBusy    = errors.New("too many remote ancient reads in flight")
+)
+
+// AncientFallback retrieves ancient items from elsewhere than the ancient store,
+// such as the network peers, checking them against the canonical block hash.
+type AncientFallback interface {
+	// FetchAncient retrieves the header, body or receipts item of the canonical
+	// block with the given number and hash, in the ancient store encoding.
+	FetchAncient(kind string, number uint64, hash common.Hash) ([]byte, error)
+}
+
+// AncientFallbackSetter is implemented by ancient stores able to fall back to
+// another source when the remote ancient store fails to serve a read.
+type AncientFallbackSetter interface {
+	// SetAncientFallback sets the source to fall back to on the reads failing
+	// because of a remote outage or taking longer than the timeout (0 = never
+	// time out), or disables falling back if nil.
+	SetAncientFallback(fallback AncientFallback, timeout time.Duration)
+}
+
+// SetAncientFallback implements AncientFallbackSetter.
+//
+// Only the blocks whose canonical hash was recently read or appended can be
+// retrieved by the fallback, the hash being unavailable otherwise during an
+// outage; their hashes are served from memory too.
+func (t *tieredAncientStore) SetAncientFallback(fallback AncientFallback, timeout time.Duration) {
+	t.fallbackLock.Lock()
+	defer t.fallbackLock.Unlock()
+
+	t.fallback, t.fallbackTimeout = fallback, timeout
+}
+
+// SetAncientFallback sets the source to fall back to when the ancient store fails
+// to serve a read, if it is a remote one.
+func (frdb *freezerdb) SetAncientFallback(fallback AncientFallback, timeout time.Duration) {
+	if setter, ok := frdb.AncientStore.(AncientFallbackSetter); ok {
+		setter.SetAncientFallback(fallback, timeout)
+	}
+}
+
+// noFallbackStore is a tiered ancient store whose reads never fall back.
+type noFallbackStore struct {
+	*tieredAncientStore
+}
+
+// Ancient retrieves an ancient binary blob from the local mirror or the remote
+// store only.
+func (s noFallbackStore) Ancient(kind string, number uint64) ([]byte, error) {
+	return s.ancient(kind, number, false)
+}
+
+// NoAncientFallback returns a view of the database whose ancient reads never
+// fall back, for the reads which must not wait on the fallback, such as the ones
+// serving the network peers: retrieving an item from the peers on behalf of a
+// peer would block its message handling meanwhile. Databases without a remote
+// ancient store are returned as is. The view shares the database and must not be
+// closed.
+func NoAncientFallback(db ethdb.Database) ethdb.Database {
+	frdb, ok := db.(*freezerdb)
+	if !ok {
+		return db
+	}
+	tiered, ok := frdb.AncientStore.(*tieredAncientStore)
+	if !ok {
+		return db
+	}
+	return &freezerdb{KeyValueStore: frdb.KeyValueStore, AncientStore: noFallbackStore{tiered}}
+}
+
+// remote retrieves an item from the remote store. If falling back is allowed
+// and enabled, it gives up once the fallback timeout elapses, or right away if
+// too many reads are in flight already.
+func (t *tieredAncientStore) remote(kind string, number uint64, allowFallback bool) ([]byte, error) {
+	t.fallbackLock.RLock()
+	fallback, timeout := t.fallback, t.fallbackTimeout
+	t.fallbackLock.RUnlock()
+
+	if !allowFallback || fallback == nil || timeout == 0 {
+		return t.AncientStore.Ancient(kind, number)
+	}
+	// The read can't be aborted, so it keeps its slot until the remote store
+	// answers, bounding the reads left behind by timeouts
+	select {
+	case t.remoteSlots <- struct{}{}:
+	default:
+		return nil, errAncientBusy
+	}
+	type result struct {
+		blob []byte
+		err  error
+	}
+	res := make(chan result, 1) // Buffered to let the read finish after the timeout
+	go func() {
+		defer func() { <-t.remoteSlots }()
+		blob, err := t.AncientStore.Ancient(kind, number)
+		res <- result{blob, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-res:
+		return r.blob, r.err
+	case <-timer.C:
+		return nil, errAncientTimeout
+	}
+}
+
+// learnHash records the canonical hash of an ancient block, to verify the items
+// retrieved by the fallback against.
+func (t *tieredAncientStore) learnHash(number uint64, hash []byte) {
+	if len(hash) == common.HashLength {
+		t.hashes.Add(number, common.BytesToHash(hash))
+	}
+}
+
+// fallbackAncient retrieves an item the remote store failed to serve with the
+// given error from the fallback, if the failure is an outage, a timeout or too
+// many reads in flight and the canonical hash of the block is known. The original
+// error is returned if the item can't be retrieved.
+func (t *tieredAncientStore) fallbackAncient(kind string, number uint64, err error) ([]byte, error) {
+	t.fallbackLock.RLock()
+	fallback := t.fallback
+	t.fallbackLock.RUnlock()
+
+	if fallback == nil || (err != errAncientTimeout && err != errAncientBusy && !isRemoteOutage(err)) {
+		return nil, err
+	}
+	cached, ok := t.hashes.Get(number)
+	if !ok {
+		return nil, err
+	}
+	hash := cached.(common.Hash)
+
+	var blob []byte
+	switch kind {
+	case freezerHashTable:
+		blob = hash.Bytes()
+	case freezerHeaderTable, freezerBodiesTable, freezerReceiptTable:
+		var ferr error
+		if blob, ferr = fallback.FetchAncient(kind, number, hash); ferr != nil {
+			log.Debug("Failed to retrieve ancient item from fallback", "kind", kind, "number", number, "hash", hash, "err", ferr)
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	log.Debug("Served ancient item from fallback", "kind", kind, "number", number, "err", err)
+	atomic.AddUint64(&t.fallbackHits, 1)
+	tierFallbackMeter.Mark(1)
+	return blob, nil
+}
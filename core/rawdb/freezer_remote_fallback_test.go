@@ -0,0 +1,190 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// testAncientFallback serves the items of the blocks with known hashes.
+type testAncientFallback struct {
+	hashes  map[uint64]common.Hash
+	fetched int
+}
+
+func (f *testAncientFallback) FetchAncient(kind string, number uint64, hash common.Hash) ([]byte, error) {
+	if f.hashes[number] != hash {
+		return nil, errors.New("hash mismatch")
+	}
+	f.fetched++
+	return []byte(kind), nil
+}
+
+// slowAncientStore delays the reads of an ancient store.
+type slowAncientStore struct {
+	ethdb.AncientStore
+	delay time.Duration
+}
+
+func (s *slowAncientStore) Ancient(kind string, number uint64) ([]byte, error) {
+	time.Sleep(s.delay)
+	return s.AncientStore.Ancient(kind, number)
+}
+
+// stalledAncientStore holds the reads of an ancient store until released,
+// counting the reads waiting.
+type stalledAncientStore struct {
+	ethdb.AncientStore
+	release chan struct{}
+	waiting int32 // Accessed atomically
+}
+
+func (s *stalledAncientStore) Ancient(kind string, number uint64) ([]byte, error) {
+	atomic.AddInt32(&s.waiting, 1)
+	defer atomic.AddInt32(&s.waiting, -1)
+
+	<-s.release
+	return s.AncientStore.Ancient(kind, number)
+}
+
+// Tests that the reads the remote ancient store fails to serve during an outage
+// are served by the fallback, for the blocks whose canonical hash is known.
+func TestAncientFallbackOutage(t *testing.T) {
+	store := newTieredTestStore(t, 0)
+	defer store.Close()
+
+	fallback := &testAncientFallback{hashes: make(map[uint64]common.Hash)}
+	for i := 0; i < 4; i++ {
+		hash := common.BytesToHash([]byte{byte(i + 1)})
+		fallback.hashes[uint64(i)] = hash
+
+		b := []byte{byte(i)}
+		if err := store.AppendAncient(uint64(i), hash.Bytes(), b, b, b, b); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	// Release the blocks from the journal, for the remote store to serve them
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	// Reads are served remotely as long as the remote store is reachable
+	store.SetAncientFallback(fallback, 0)
+	if blob, err := store.Ancient(freezerBodiesTable, 1); err != nil || !bytes.Equal(blob, []byte{1}) {
+		t.Fatalf("remote item mismatch: %x, %v", blob, err)
+	}
+	// Have the hash of block #3 forgotten, and the remote store go away
+	store.hashes.Remove(uint64(3))
+	store.AncientStore.(*FreezerRemoteClient).client.Close()
+
+	for _, kind := range []string{freezerHeaderTable, freezerBodiesTable, freezerReceiptTable} {
+		if blob, err := store.Ancient(kind, 2); err != nil || string(blob) != kind {
+			t.Fatalf("fallback %s mismatch: %q, %v", kind, blob, err)
+		}
+	}
+	if blob, err := store.Ancient(freezerHashTable, 2); err != nil || common.BytesToHash(blob) != fallback.hashes[2] {
+		t.Fatalf("fallback hash mismatch: %x, %v", blob, err)
+	}
+	if _, err := store.Ancient(freezerDifficultyTable, 2); err == nil {
+		t.Fatal("difficulty served from the fallback")
+	}
+	// Reads through the view serving the peers never fall back
+	view := NoAncientFallback(&freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: store})
+	if _, err := view.Ancient(freezerBodiesTable, 2); err == nil {
+		t.Fatal("item served from the fallback through the view without it")
+	}
+	if _, err := store.Ancient(freezerBodiesTable, 3); err == nil {
+		t.Fatal("block with unknown hash served from the fallback")
+	}
+	if fallback.fetched != 3 {
+		t.Fatalf("fallback retrievals mismatch: have %d, want 3", fallback.fetched)
+	}
+	if hits := store.TieringStats().FallbackHits; hits != 4 {
+		t.Fatalf("fallback hits mismatch: have %d, want 4", hits)
+	}
+	// Without the fallback, the outage is reported again
+	store.SetAncientFallback(nil, 0)
+	if _, err := store.Ancient(freezerBodiesTable, 2); err == nil {
+		t.Fatal("item served without the fallback")
+	}
+}
+
+// Tests that the remote reads taking longer than the timeout are served by the
+// fallback, and that missing items are not.
+func TestAncientFallbackTimeout(t *testing.T) {
+	remote := newTieredTestStore(t, 0).AncientStore
+	store := newTieredAncientStore(NewMemoryDatabase(), &slowAncientStore{AncientStore: remote, delay: 100 * time.Millisecond})
+	defer store.Close()
+
+	hash := common.BytesToHash([]byte{1})
+	if err := store.AppendAncient(0, hash.Bytes(), []byte{0}, []byte{0}, []byte{0}, []byte{0}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	fallback := &testAncientFallback{hashes: map[uint64]common.Hash{0: hash}}
+
+	store.SetAncientFallback(fallback, time.Second)
+	if blob, err := store.Ancient(freezerBodiesTable, 0); err != nil || !bytes.Equal(blob, []byte{0}) {
+		t.Fatalf("remote item mismatch: %x, %v", blob, err)
+	}
+	store.SetAncientFallback(fallback, 10*time.Millisecond)
+	if blob, err := store.Ancient(freezerBodiesTable, 0); err != nil || string(blob) != freezerBodiesTable {
+		t.Fatalf("fallback item mismatch: %q, %v", blob, err)
+	}
+	// Items rejected by the remote store are not retrieved from the fallback
+	store.SetAncientFallback(fallback, time.Second)
+	if _, err := store.Ancient(freezerBodiesTable, 1); err == nil {
+		t.Fatal("missing item served from the fallback")
+	}
+}
+
+// Tests that the remote reads left behind by timeouts are bounded, the reads
+// beyond the bound falling back right away.
+func TestAncientFallbackInflight(t *testing.T) {
+	remote := &stalledAncientStore{AncientStore: newTieredTestStore(t, 0).AncientStore, release: make(chan struct{})}
+	store := newTieredAncientStore(NewMemoryDatabase(), remote)
+	defer store.Close()
+
+	hash := common.BytesToHash([]byte{1})
+	if err := store.AppendAncient(0, hash.Bytes(), []byte{0}, []byte{0}, []byte{0}, []byte{0}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	store.SetAncientFallback(&testAncientFallback{hashes: map[uint64]common.Hash{0: hash}}, 10*time.Millisecond)
+
+	for i := 0; i < 2*fallbackRemoteReads; i++ {
+		if blob, err := store.Ancient(freezerBodiesTable, 0); err != nil || string(blob) != freezerBodiesTable {
+			t.Fatalf("read %d: fallback item mismatch: %q, %v", i, blob, err)
+		}
+	}
+	if waiting := atomic.LoadInt32(&remote.waiting); waiting != fallbackRemoteReads {
+		t.Fatalf("remote reads in flight mismatch: have %d, want %d", waiting, fallbackRemoteReads)
+	}
+	// Once the remote store answers, its reads are served again
+	close(remote.release)
+	for len(store.remoteSlots) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	store.SetAncientFallback(&testAncientFallback{}, time.Second)
+	if blob, err := store.Ancient(freezerBodiesTable, 0); err != nil || !bytes.Equal(blob, []byte{0}) {
+		t.Fatalf("remote item mismatch: %x, %v", blob, err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var remoteJournalGauge = metrics.NewRegisteredGauge("ancient/remote/journal", nil)
+
+// remoteJournal is the local write-ahead journal of a remote freezer client. The
+// appended blocks are recorded before being sent to the remote freezer, and
+// retained until it synced them, so that blocks missed by the remote freezer
+// during an outage are resent on reconnection instead of being lost with the
+// key-value store copies deleted by the freezer loop.
+type remoteJournal struct {
+	db      ethdb.KeyValueStore
+	begin   uint64 // Number of the oldest journaled block
+	sent    uint64 // Number of the first journaled block not sent yet
+	end     uint64 // Number of the block following the last journaled one
+	frozen  uint64 // Number of frozen blocks last known, to report during outages
+	offline bool   // Whether the remote freezer became unreachable, the blocks it received being unknown
+}
+
+// openRemoteJournal opens the journal of a remote freezer client, to be replayed
+// if left over by a previous run.
+func openRemoteJournal(db ethdb.KeyValueStore) *remoteJournal {
+	j := &remoteJournal{db: db}
+
+	it := db.NewIterator(remoteJournalPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if len(it.Key()) != len(remoteJournalPrefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(it.Key()[len(remoteJournalPrefix):])
+		if j.begin == j.end {
+			j.begin = number
+		}
+		j.end = number + 1
+	}
+	j.sent, j.offline = j.begin, j.begin < j.end
+	if j.offline {
+		log.Info("Found remote freezer journal", "first", j.begin, "last", j.end-1)
+	}
+	remoteJournalGauge.Update(int64(j.end - j.begin))
+	return j
+}
+
+// isRemoteOutage reports whether an error of a remote freezer call is caused by
+// the remote freezer being unreachable, rather than rejecting the call.
+func isRemoteOutage(err error) bool {
+	_, rejected := err.(rpc.Error)
+	return err != nil && !rejected
+}
+
+// contains reports whether the given block is journaled.
+func (j *remoteJournal) contains(number uint64) bool {
+	return number >= j.begin && number < j.end
+}
+
+// item retrieves an item of a journaled block.
+func (j *remoteJournal) item(kind string, number uint64) ([]byte, error) {
+	blobs, err := j.read(number)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range ancientKinds {
+		if k == kind {
+			return blobs[i], nil
+		}
+	}
+	return nil, errUnknownTable
+}
+
+// read retrieves the items of a journaled block, in the order of ancientKinds.
+func (j *remoteJournal) read(number uint64) ([][]byte, error) {
+	enc, err := j.db.Get(remoteJournalKey(number))
+	if err != nil {
+		return nil, err
+	}
+	var blobs [][]byte
+	if err := rlp.DecodeBytes(enc, &blobs); err != nil {
+		return nil, err
+	}
+	if len(blobs) != len(ancientKinds) {
+		return nil, fmt.Errorf("invalid journaled block #%d", number)
+	}
+	return blobs, nil
+}
+
+// append journals the next block.
+func (j *remoteJournal) append(number uint64, hash, header, body, receipts, td []byte) error {
+	if j.begin == j.end {
+		j.begin, j.sent, j.end = number, number, number
+	}
+	if number != j.end {
+		return errOutOrderInsertion
+	}
+	enc, err := rlp.EncodeToBytes([][]byte{hash, header, body, receipts, td})
+	if err != nil {
+		return err
+	}
+	if err := j.db.Put(remoteJournalKey(number), enc); err != nil {
+		return err
+	}
+	j.end++
+	remoteJournalGauge.Update(int64(j.end - j.begin))
+	return nil
+}
+
+// truncate drops the journaled blocks from the given number on.
+func (j *remoteJournal) truncate(items uint64) error {
+	if items >= j.end {
+		return nil
+	}
+	if items < j.begin {
+		items = j.begin
+	}
+	batch := j.db.NewBatch()
+	for number := items; number < j.end; number++ {
+		batch.Delete(remoteJournalKey(number))
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	j.end = items
+	if j.sent > j.end {
+		j.sent = j.end
+	}
+	remoteJournalGauge.Update(int64(j.end - j.begin))
+	return nil
+}
+
+// release drops the journaled blocks synced by the remote freezer.
+func (j *remoteJournal) release() error {
+	if j.begin == j.sent {
+		return nil
+	}
+	batch := j.db.NewBatch()
+	for number := j.begin; number < j.sent; number++ {
+		batch.Delete(remoteJournalKey(number))
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	j.begin = j.sent
+	remoteJournalGauge.Update(int64(j.end - j.begin))
+	return nil
+}
+
+// deliver sends the journaled blocks not sent yet to the remote freezer. After an
+// outage, the blocks received by the remote freezer are looked up first, and the
+// missing ones resent.
+func (j *remoteJournal) deliver(client *rpc.Client) error {
+	if j.sent == j.end {
+		return nil
+	}
+	if j.offline {
+		var frozen uint64
+		if err := client.Call(&frozen, FreezerMethodAncients); err != nil {
+			return err
+		}
+		if frozen < j.begin {
+			return fmt.Errorf("remote freezer lost synced blocks: has %d, journal starts at %d", frozen, j.begin)
+		}
+		if frozen > j.end {
+			frozen = j.end
+		}
+		j.sent, j.offline = frozen, false
+		if j.sent < j.end {
+			log.Info("Replaying remote freezer journal", "first", j.sent, "last", j.end-1)
+		}
+	}
+	for ; j.sent < j.end; j.sent++ {
+		blobs, err := j.read(j.sent)
+		if err != nil {
+			return err
+		}
+		if err := client.Call(nil, FreezerMethodAppendAncient, j.sent, blobs[0], blobs[1], blobs[2], blobs[3], blobs[4]); err != nil {
+			if isRemoteOutage(err) {
+				j.offline = true
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the blocks appended while the remote freezer is unreachable, or
+// lost by it before being synced, are journaled and replayed on reconnection.
+func TestRemoteFreezerJournal(t *testing.T) {
+	var (
+		mem    = lib.NewMemFreezerRemoteServerAPI()
+		server = rpc.NewServer()
+		down   int32
+	)
+	if err := server.RegisterName("freezer", mem); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer endpoint.Close()
+
+	db := NewMemoryDatabase()
+	client, err := newFreezerRemoteClient(endpoint.URL, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendBlocks := func(client *FreezerRemoteClient, from, to uint64) {
+		t.Helper()
+		for number := from; number < to; number++ {
+			b := []byte{byte(number)}
+			if err := client.AppendAncient(number, b, b, b, b, b); err != nil {
+				t.Fatalf("failed to append block #%d: %v", number, err)
+			}
+		}
+	}
+	checkFrozen := func(client *FreezerRemoteClient, local, remote uint64) {
+		t.Helper()
+		if frozen, err := client.Ancients(); err != nil || frozen != local {
+			t.Fatalf("frozen blocks mismatch: have %d (%v), want %d", frozen, err, local)
+		}
+		if frozen, _ := mem.Ancients(); frozen != remote {
+			t.Fatalf("remote frozen blocks mismatch: have %d, want %d", frozen, remote)
+		}
+	}
+	// Synced blocks are released from the journal
+	appendBlocks(client, 0, 10)
+	if err := client.Sync(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if n := countPrefix(db, string(remoteJournalPrefix)); n != 0 {
+		t.Fatalf("synced blocks still journaled: %d", n)
+	}
+	// Blocks lost by the remote freezer before a sync, or appended while it's
+	// down, are acknowledged and served from the journal
+	appendBlocks(client, 10, 15)
+	mem.TruncateAncients(12)
+
+	atomic.StoreInt32(&down, 1)
+	appendBlocks(client, 15, 18)
+	checkFrozen(client, 18, 12)
+	if err := client.Sync(); err != nil {
+		t.Fatalf("sync during outage failed: %v", err)
+	}
+	if blob, err := client.Ancient(freezerBodiesTable, 13); err != nil || !bytes.Equal(blob, []byte{13}) {
+		t.Fatalf("journaled block mismatch: %x, %v", blob, err)
+	}
+	// The missing blocks are replayed once reachable again
+	atomic.StoreInt32(&down, 0)
+	checkFrozen(client, 18, 18)
+	if err := client.Sync(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if blob, _ := mem.Ancient(freezerBodiesTable, 13); !bytes.Equal(blob, []byte{13}) {
+		t.Fatalf("replayed block mismatch: %x", blob)
+	}
+	if n := countPrefix(db, string(remoteJournalPrefix)); n != 0 {
+		t.Fatalf("replayed blocks still journaled: %d", n)
+	}
+	// Journals left over by a previous run are replayed
+	atomic.StoreInt32(&down, 1)
+	appendBlocks(client, 18, 20)
+
+	restarted := &FreezerRemoteClient{client: client.client, journal: openRemoteJournal(db)}
+	atomic.StoreInt32(&down, 0)
+	if err := restarted.Sync(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	checkFrozen(restarted, 20, 20)
+
+	// Blocks rejected by the remote freezer are not journaled
+	mem.TruncateAncients(5)
+	b := []byte{20}
+	if err := restarted.AppendAncient(20, b, b, b, b, b); err == nil {
+		t.Fatal("rejected block acknowledged")
+	}
+	if restarted.journaled(20) {
+		t.Fatal("rejected block journaled")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const FreezerMethodHandshake = "freezer_handshake"
+
+// ChainIdentity identifies the chain whose ancients a remote freezer holds, so
+// that a single server can hold the ancients of several networks apart.
+type ChainIdentity struct {
+	Namespace string      `json:"namespace"`
+	Genesis   common.Hash `json:"genesis"`
+	NetworkID uint64      `json:"networkId"`
+}
+
+// NewChainIdentity creates the identity of the chain with the given genesis hash
+// and network id, deriving its namespace from both.
+func NewChainIdentity(genesis common.Hash, networkID uint64) ChainIdentity {
+	return ChainIdentity{
+		Namespace: fmt.Sprintf("%d-%x", networkID, genesis[:8]),
+		Genesis:   genesis,
+		NetworkID: networkID,
+	}
+}
+
+// AncientIdentifier is implemented by ancient stores shared between chains,
+// which need to verify the identity of the chain they are used by.
+type AncientIdentifier interface {
+	// Handshake presents the identity of the chain to the ancient store, failing
+	// if it holds the ancients of another chain.
+	Handshake(identity ChainIdentity) error
+}
+
+// Handshake presents the chain identity to the remote freezer, which binds its
+// namespace to the chain if it's new and rejects the identity otherwise if it
+// doesn't match. Servers not implementing namespaces return errNotSupported.
+func (api *FreezerRemoteClient) Handshake(identity ChainIdentity) error {
+	var res ChainIdentity
+	err := api.client.Call(&res, FreezerMethodHandshake, identity)
+	if rerr, ok := err.(rpc.Error); ok && rerr.ErrorCode() == -32601 {
+		return errNotSupported
+	}
+	if err != nil {
+		return err
+	}
+	if res != identity {
+		return fmt.Errorf("remote freezer bound to namespace %s (genesis %x, network %d)", res.Namespace, res.Genesis, res.NetworkID)
+	}
+	return nil
+}
+
+// Handshake presents the chain identity to the remote store.
+func (t *tieredAncientStore) Handshake(identity ChainIdentity) error {
+	if identifier, ok := t.AncientStore.(AncientIdentifier); ok {
+		return identifier.Handshake(identity)
+	}
+	return errNotSupported
+}
+
+// Handshake presents the chain identity to the ancient store, if it's shared.
+func (frdb *freezerdb) Handshake(identity ChainIdentity) error {
+	if identifier, ok := frdb.AncientStore.(AncientIdentifier); ok {
+		return identifier.Handshake(identity)
+	}
+	return errNotSupported
+}
+
+// IdentifyAncientStore presents the chain identity to the ancient store of the
+// database, failing if the latter belongs to another chain. Ancient stores not
+// verifying chain identities are accepted as they are.
+func IdentifyAncientStore(db ethdb.Database, identity ChainIdentity) error {
+	identifier, ok := db.(AncientIdentifier)
+	if !ok {
+		return nil
+	}
+	return identifyAncientStore(identifier, identity)
+}
+
+// identifyRemoteFreezer presents the identity of the chain in the key-value store
+// or the options to a remote freezer, before anything is read from or frozen
+// into it.
+func identifyRemoteFreezer(db ethdb.KeyValueStore, remote *FreezerRemoteClient, options *FreezerOptions) error {
+	if options == nil || options.NetworkID == 0 {
+		log.Warn("Chain identity unknown, not verifying the remote freezer")
+		return nil
+	}
+	genesis := options.Genesis
+	if kvgenesis, _ := db.Get(headerHashKey(0)); len(kvgenesis) > 0 {
+		genesis = common.BytesToHash(kvgenesis)
+	}
+	if genesis == (common.Hash{}) {
+		log.Warn("Chain identity unknown, not verifying the remote freezer")
+		return nil
+	}
+	return identifyAncientStore(remote, NewChainIdentity(genesis, options.NetworkID))
+}
+
+// identifyAncientStore presents the chain identity to an ancient store verifying
+// chain identities.
+func identifyAncientStore(identifier AncientIdentifier, identity ChainIdentity) error {
+	switch err := identifier.Handshake(identity); err {
+	case nil:
+		log.Info("Verified ancient store chain identity", "namespace", identity.Namespace)
+		return nil
+	case errNotSupported:
+		log.Warn("Ancient store can't verify the chain identity", "namespace", identity.Namespace)
+		return nil
+	default:
+		return fmt.Errorf("ancient store rejected chain identity (namespace %s): %v", identity.Namespace, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that a remote freezer serving several chains only accepts the clients
+// of the chain each namespace is bound to.
+func TestRemoteFreezerNamespaces(t *testing.T) {
+	server := httptest.NewServer(lib.NewMemFreezerRemoteTenants(nil))
+	defer server.Close()
+
+	dial := func(namespace string) *freezerdb {
+		client, err := rpc.Dial(server.URL + "/" + namespace)
+		if err != nil {
+			t.Fatalf("failed to dial namespace %s: %v", namespace, err)
+		}
+		remote := &FreezerRemoteClient{client: client, quit: make(chan struct{}), journal: openRemoteJournal(NewMemoryDatabase())}
+		return &freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: newTieredAncientStore(NewMemoryDatabase(), remote)}
+	}
+	var (
+		mainnet = NewChainIdentity(common.HexToHash("0x01"), 1)
+		mordor  = NewChainIdentity(common.HexToHash("0x02"), 7)
+		private = NewChainIdentity(common.HexToHash("0x01"), 1337) // Reusing the mainnet genesis
+	)
+	// Each chain gets its own store
+	for _, identity := range []ChainIdentity{mainnet, mordor, private} {
+		db := dial(identity.Namespace)
+		if err := IdentifyAncientStore(db, identity); err != nil {
+			t.Fatalf("namespace %s rejected its chain: %v", identity.Namespace, err)
+		}
+		b := []byte{byte(identity.NetworkID)}
+		if err := db.AppendAncient(0, b, b, b, b, b); err != nil {
+			t.Fatalf("namespace %s: append failed: %v", identity.Namespace, err)
+		}
+	}
+	for _, identity := range []ChainIdentity{mainnet, mordor, private} {
+		db := dial(identity.Namespace)
+		if err := IdentifyAncientStore(db, identity); err != nil {
+			t.Fatalf("namespace %s rejected its chain on reconnection: %v", identity.Namespace, err)
+		}
+		if frozen, _ := db.Ancients(); frozen != 1 {
+			t.Fatalf("namespace %s: have %d ancients, want 1", identity.Namespace, frozen)
+		}
+		if blob, err := db.Ancient(freezerHashTable, 0); err != nil || blob[0] != byte(identity.NetworkID) {
+			t.Fatalf("namespace %s: ancient mismatch: %x, %v", identity.Namespace, blob, err)
+		}
+	}
+	// Chains are rejected by the namespaces of others
+	if err := IdentifyAncientStore(dial(mainnet.Namespace), mordor); err == nil {
+		t.Fatal("mainnet namespace accepted mordor")
+	}
+	forged := private
+	forged.Namespace = mainnet.Namespace
+	if err := IdentifyAncientStore(dial(mainnet.Namespace), forged); err == nil {
+		t.Fatal("mainnet namespace accepted another network")
+	}
+	// Servers not implementing namespaces are accepted as they are
+	legacy := rpc.NewServer()
+	if err := legacy.RegisterName("freezer", &rangelessFreezerServer{lib.NewMemFreezerRemoteServerAPI()}); err != nil {
+		t.Fatal(err)
+	}
+	remote := &FreezerRemoteClient{client: rpc.DialInProc(legacy), quit: make(chan struct{}), journal: openRemoteJournal(NewMemoryDatabase())}
+	if err := IdentifyAncientStore(&freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: remote}, mainnet); err != nil {
+		t.Fatalf("legacy server rejected: %v", err)
+	}
+}
+
+// Tests that the chain identity is verified when a database with a remote freezer
+// is opened, the genesis of the key-value store overriding the configured one.
+func TestRemoteFreezerOpenIdentity(t *testing.T) {
+	server := httptest.NewServer(lib.NewMemFreezerRemoteTenants(nil))
+	defer server.Close()
+
+	var (
+		mainnet = NewChainIdentity(common.HexToHash("0x01"), 1)
+		mordor  = NewChainIdentity(common.HexToHash("0x02"), 7)
+	)
+	open := func(kvdb ethdb.KeyValueStore, namespace string, genesis common.Hash, networkID uint64) error {
+		db, err := NewDatabaseWithFreezerRemote(kvdb, server.URL+"/"+namespace, &FreezerOptions{Genesis: genesis, NetworkID: networkID})
+		if err == nil {
+			db.Close()
+		}
+		return err
+	}
+	if err := open(NewMemoryDatabase(), mainnet.Namespace, mainnet.Genesis, mainnet.NetworkID); err != nil {
+		t.Fatalf("namespace rejected its chain: %v", err)
+	}
+	if err := open(NewMemoryDatabase(), mainnet.Namespace, mordor.Genesis, mordor.NetworkID); err == nil {
+		t.Fatal("namespace accepted another chain on open")
+	}
+	// The genesis already in the database is the one presented
+	kvdb := NewMemoryDatabase()
+	WriteCanonicalHash(kvdb, mordor.Genesis, 0)
+	if err := open(kvdb, mainnet.Namespace, mainnet.Genesis, mainnet.NetworkID); err == nil {
+		t.Fatal("namespace accepted the chain of another database")
+	}
+	// Without a network id, the identity can't be verified
+	if err := open(NewMemoryDatabase(), mainnet.Namespace, mordor.Genesis, 0); err != nil {
+		t.Fatalf("unidentified chain rejected: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// newSecondaryFreezer opens the chain freezer in datadir read-only, without
+// locking it, to follow the ancient chain data frozen by another process. The
+// tables must be refreshed to pick up the changes done by the other process.
+func newSecondaryFreezer(datadir string, namespace string, options *FreezerOptions) (*freezer, error) {
+	var (
+		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
+		writeMeter = metrics.NewRegisteredMeter(namespace+"ancient/write", nil)
+		sizeGauge  = metrics.NewRegisteredGauge(namespace+"ancient/size", nil)
+	)
+	freezer := &freezer{
+		threshold: options.threshold(),
+		recheck:   options.recheckInterval(),
+		datadir:   datadir,
+		tables:    make(map[string]*freezerTable),
+		readonly:  true,
+		trigger:   make(chan chan struct{}),
+		gate:      newFreezeGate(),
+		quit:      make(chan struct{}),
+	}
+	for name := range freezerNoSnappy {
+		compressed, exists, err := storedCompression(datadir, name)
+		if err == nil && !exists {
+			err = fmt.Errorf("ancient table %s missing in %s", name, datadir)
+		}
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		table, err := newReadOnlyTable(datadir, name, readMeter, writeMeter, sizeGauge, options.fileSize(name), !compressed)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	if err := freezer.refresh(); err != nil {
+		freezer.Close()
+		return nil, err
+	}
+	return freezer, nil
+}
+
+// refresh reloads the tables of a read-only freezer, the number of frozen
+// blocks being the one of the shortest table as the other process appends the
+// items of a block table by table.
+func (f *freezer) refresh() error {
+	min := uint64(math.MaxUint64)
+	for _, table := range f.tables {
+		if err := table.refresh(); err != nil {
+			return err
+		}
+		if items := atomic.LoadUint64(&table.items); min > items {
+			min = items
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// newReadOnlyTable opens a freezer table written by another process, without
+// repairing it.
+func newReadOnlyTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
+	index, err := openFreezerFileForReadOnly(tableIndexFile(path, name, !noCompression))
+	if err != nil {
+		return nil, err
+	}
+	tab := &freezerTable{
+		index:         index,
+		files:         make(map[uint32]*os.File),
+		readMeter:     readMeter,
+		writeMeter:    writeMeter,
+		sizeGauge:     sizeGauge,
+		name:          name,
+		path:          path,
+		logger:        log.New("database", path, "table", name),
+		noCompression: noCompression,
+		maxFileSize:   maxFilesize,
+		readonly:      true,
+	}
+	if err := tab.refresh(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// refresh reloads the index of a read-only table, picking up the items appended
+// or truncated by the other process since, as well as the data files discarded
+// from the tail or replaced.
+func (t *freezerTable) refresh() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	// Reopen the index if it was replaced by a tail truncation
+	name := t.index.Name()
+	stat, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if current, err := t.index.Stat(); err != nil || !os.SameFile(stat, current) {
+		index, err := openFreezerFileForReadOnly(name)
+		if err != nil {
+			return err
+		}
+		t.index.Close()
+		t.index = index
+		if stat, err = index.Stat(); err != nil {
+			return err
+		}
+	}
+	entries := stat.Size() / indexEntrySize
+	if entries == 0 {
+		return fmt.Errorf("empty index %s", name)
+	}
+	var (
+		buffer      = make([]byte, indexEntrySize)
+		first, last indexEntry
+	)
+	if _, err := t.index.ReadAt(buffer, 0); err != nil {
+		return err
+	}
+	first.unmarshalBinary(buffer)
+
+	// Skip the items whose data isn't written yet, the data being written before
+	// the index entry pointing to its end
+	for ; entries > 1; entries-- {
+		if _, err := t.index.ReadAt(buffer, (entries-1)*indexEntrySize); err != nil {
+			return err
+		}
+		last.unmarshalBinary(buffer)
+		if info, err := os.Stat(filepath.Join(t.path, t.fileName(last.filenum))); err == nil && info.Size() >= int64(last.offset) {
+			break
+		}
+	}
+	if entries == 1 {
+		last = indexEntry{filenum: first.filenum}
+	}
+	// Release the data files out of the table or replaced since opened, and
+	// open the missing ones
+	for num, f := range t.files {
+		if num < first.filenum || num > last.filenum {
+			t.releaseFile(num)
+			continue
+		}
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if stored, err := os.Stat(f.Name()); err != nil || !os.SameFile(stored, current) {
+			t.releaseFile(num)
+		}
+	}
+	for num := first.filenum; num <= last.filenum; num++ {
+		if _, err := t.openFile(num, openFreezerFileForReadOnly); err != nil {
+			return err
+		}
+	}
+	t.tailId, t.headId = first.filenum, last.filenum
+	t.head = t.files[t.headId]
+	t.headBytes = last.offset
+	atomic.StoreUint32(&t.itemOffset, first.offset)
+	atomic.StoreUint64(&t.items, uint64(first.offset)+uint64(entries-1))
+	return nil
+}
@@ -21,8 +21,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -43,6 +45,10 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errReadOnly is returned if an operation attempts to write to a freezer
+	// table opened read-only.
+	errReadOnly = errors.New("read-only")
 )
 
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
@@ -81,6 +87,8 @@ type freezerTable struct {
 
 	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
 	maxFileSize   uint32 // Max file size for data-files
+	syncItems     uint64 // Number of appended items after which the table is flushed, 0 if never
+	readonly      bool   // Whether the table is written by another process, see refresh
 	name          string
 	path          string
 
@@ -105,7 +113,7 @@ type freezerTable struct {
 
 // newTable opens a freezer table with default settings - 2G files
 func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, disableSnappy bool) (*freezerTable, error) {
-	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, disableSnappy)
+	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, defaultFreezerFileSize, disableSnappy)
 }
 
 // openFreezerFileForAppend opens a freezer table file and seeks to the end
@@ -329,6 +337,9 @@ func (t *freezerTable) truncate(items uint64) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	if t.readonly {
+		return errReadOnly
+	}
 	// If our item count is correct, don't do anything
 	existing := atomic.LoadUint64(&t.items)
 	if existing <= items {
@@ -344,13 +355,17 @@ func (t *freezerTable) truncate(items uint64) error {
 	if existing > items+1 {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
+	if items < uint64(t.itemOffset) {
+		return fmt.Errorf("truncation below the tail of the table: %d < %d", items, t.itemOffset)
+	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+	position := items - uint64(t.itemOffset) // Index entries start at the tail
+	if err := truncateFreezerFile(t.index, int64(position+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
@@ -388,6 +403,121 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards the data files holding only items below the provided
+// threshold number, returning the number of the oldest item retained. Items can
+// only be discarded by whole data files, so the ones sharing the file of the
+// item at the threshold are retained. The index is rewritten to start at the new
+// tail before any data file is removed.
+func (t *freezerTable) truncateTail(items uint64) (uint64, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return 0, errClosed
+	}
+	if t.readonly {
+		return 0, errReadOnly
+	}
+	var (
+		tail  = uint64(t.itemOffset)
+		total = atomic.LoadUint64(&t.items)
+	)
+	if items > total {
+		items = total
+	}
+	if items <= tail {
+		return tail, nil
+	}
+	// Find the data file holding the item at the threshold
+	filenum := t.headId
+	if items < total {
+		_, _, num, err := t.getBounds(items - tail)
+		if err != nil {
+			return 0, err
+		}
+		filenum = num
+	}
+	if filenum == t.tailId {
+		return tail, nil
+	}
+	// Find the first item in that file, items being stored in the data file of
+	// the index entry following them
+	var (
+		buffer  = make([]byte, indexEntrySize)
+		readErr error
+	)
+	first := sort.Search(int(total-tail), func(i int) bool {
+		if _, err := t.index.ReadAt(buffer, int64(i+1)*indexEntrySize); err != nil {
+			readErr = err
+			return true
+		}
+		var entry indexEntry
+		entry.unmarshalBinary(buffer)
+		return entry.filenum >= filenum
+	})
+	if readErr != nil {
+		return 0, readErr
+	}
+	newTail := tail + uint64(first)
+	if newTail > math.MaxUint32 {
+		return 0, fmt.Errorf("tail item %d out of range", newTail)
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return 0, err
+	}
+	t.logger.Info("Truncating freezer table tail", "items", total, "tail", tail, "newtail", newTail, "files", filenum-t.tailId)
+
+	// Rewrite the index, its first entry carrying the new tail file and item
+	name := t.index.Name()
+	tmp, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	head := indexEntry{filenum: filenum, offset: uint32(newTail)}
+	if _, err := tmp.Write(head.marshallBinary()); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(t.index, int64(first+1)*indexEntrySize, math.MaxInt64)); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := t.index.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return 0, err
+	}
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return 0, err
+	}
+	// Remove the data files of the discarded items, along with any left behind
+	// by an interrupted truncation
+	for num := uint32(0); num < filenum; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num))); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	t.tailId = filenum
+	atomic.StoreUint32(&t.itemOffset, uint32(newTail))
+
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return 0, err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return newTail, nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -416,13 +546,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(filepath.Join(t.path, t.fileName(num)))
 		if err != nil {
 			return nil, err
 		}
@@ -431,6 +555,14 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the name of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -457,8 +589,9 @@ func (t *freezerTable) releaseFilesAfter(num uint32, remove bool) {
 // is a precautionary parameter to ensure data correctness, but the table will
 // reject already existing data.
 //
-// Note, this method will *not* flush any data to disk so be sure to explicitly
-// fsync before irreversibly deleting data from the database.
+// Note, this method only flushes data to disk every syncItems appended items, if
+// configured at all, so be sure to explicitly fsync before irreversibly deleting
+// data from the database.
 func (t *freezerTable) Append(item uint64, blob []byte) error {
 	// Read lock prevents competition with truncate
 	t.lock.RLock()
@@ -467,18 +600,31 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 		t.lock.RUnlock()
 		return errClosed
 	}
+	if t.readonly {
+		t.lock.RUnlock()
+		return errReadOnly
+	}
 	// Ensure only the next item can be written, nothing else
 	if atomic.LoadUint64(&t.items) != item {
 		t.lock.RUnlock()
 		return fmt.Errorf("appending unexpected item: want %d, have %d", t.items, item)
 	}
-	// Encode the blob and write it into the data file
+	// Encode the blob and write it into the data file, items larger than a data
+	// file getting one of their own
+	if uint64(len(blob)) > freezerMaxItemSize {
+		t.lock.RUnlock()
+		return fmt.Errorf("%w: %d bytes", errItemTooLarge, len(blob))
+	}
 	if !t.noCompression {
 		blob = snappy.Encode(nil, blob)
+		if uint64(len(blob)) > freezerMaxItemSize {
+			t.lock.RUnlock()
+			return fmt.Errorf("%w: %d bytes compressed", errItemTooLarge, len(blob))
+		}
 	}
 	bLen := uint32(len(blob))
-	if t.headBytes+bLen < bLen ||
-		t.headBytes+bLen > t.maxFileSize {
+	if t.headBytes > 0 && (t.headBytes+bLen < bLen ||
+		t.headBytes+bLen > t.maxFileSize) {
 		// we need a new file, writing would overflow
 		t.lock.RUnlock()
 		t.lock.Lock()
@@ -517,7 +663,9 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 	t.writeMeter.Mark(int64(bLen + indexEntrySize))
 	t.sizeGauge.Inc(int64(bLen + indexEntrySize))
 
-	atomic.AddUint64(&t.items, 1)
+	if items := atomic.AddUint64(&t.items, 1); t.syncItems > 0 && items%t.syncItems == 0 {
+		return t.Sync()
+	}
 	return nil
 }
 
@@ -600,7 +748,7 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && uint64(atomic.LoadUint32(&t.itemOffset)) <= number
 }
 
 // size returns the total data size in the freezer table.
@@ -625,6 +773,9 @@ func (t *freezerTable) sizeNolock() (uint64, error) {
 // Sync pushes any pending data from memory out to disk. This is an expensive
 // operation, so use it with care.
 func (t *freezerTable) Sync() error {
+	if t.readonly {
+		return nil
+	}
 	if err := t.index.Sync(); err != nil {
 		return err
 	}
@@ -640,3 +640,75 @@ func TestOffset(t *testing.T) {
 // However, all 'normal' failure modes arising due to failing to sync() or save a file should be
 // handled already, and the case described above can only (?) happen if an external process/user
 // deletes files from the filesystem.
+
+// TestFreezerTruncateTail tests discarding the oldest items of a table by whole
+// data files, and that the table keeps working after reopening it.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	fname := fmt.Sprintf("truncatetail-%d", rand.Uint64())
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+
+	// Fill 10 files with 3 items each
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 30; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	// Item 10 is in the fourth file, which starts with item 9
+	tail, err := f.truncateTail(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tail != 9 {
+		t.Fatalf("tail mismatch: have %d, want 9", tail)
+	}
+	if _, err := os.Stat(filepath.Join(os.TempDir(), f.fileName(2))); !os.IsNotExist(err) {
+		t.Fatalf("discarded data file still present: %v", err)
+	}
+	// Truncating within the tail file is a noop
+	if tail, err := f.truncateTail(11); err != nil || tail != 9 {
+		t.Fatalf("truncation within the tail file: have %d, %v", tail, err)
+	}
+	f.Close()
+
+	// Reopen the table and check the retained items
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.items != 30 {
+		t.Fatalf("item count mismatch: have %d, want 30", f.items)
+	}
+	if f.has(8) || !f.has(9) {
+		t.Fatalf("tail presence mismatch: 8 %v, 9 %v", f.has(8), f.has(9))
+	}
+	if _, err := f.Retrieve(8); err != errOutOfBounds {
+		t.Fatalf("discarded item retrieved: %v", err)
+	}
+	for y := 9; y < 30; y++ {
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatalf("item %d: %v", y, err)
+		}
+		if !bytes.Equal(got, getChunk(15, y)) {
+			t.Fatalf("item %d mismatch: %x", y, got)
+		}
+	}
+	// Truncating the head and appending respects the tail
+	if err := f.truncate(20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Append(20, getChunk(15, 0xaa)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.Retrieve(20); err != nil || !bytes.Equal(got, getChunk(15, 0xaa)) {
+		t.Fatalf("appended item mismatch: %x, %v", got, err)
+	}
+	if err := f.truncate(5); err == nil {
+		t.Fatal("truncated below the tail")
+	}
+}
@@ -0,0 +1,577 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// tieringBatchItems is the number of consecutive items of a kind retrieved from
+	// the remote ancient store at once when filling the local mirror.
+	tieringBatchItems = 1024
+
+	// tieringBatchBytes is the maximum size of a single retrieval from the remote
+	// ancient store when filling the local mirror.
+	tieringBatchBytes = 16 * 1024 * 1024
+)
+
+var (
+	tierLocalMeter     = metrics.NewRegisteredMeter("ancient/tier/local", nil)
+	tierRemoteMeter    = metrics.NewRegisteredMeter("ancient/tier/remote", nil)
+	tierMirroredGauge  = metrics.NewRegisteredGauge("ancient/tier/mirrored", nil)
+	errNoTieringPolicy = errors.New("no ancient tiering policy file configured")
+)
+
+// ancientKinds are the tables of the ancient store, all mirrored together.
+var ancientKinds = []string{freezerHashTable, freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable}
+
+// TieringPolicy defines which ancient blocks of a remote ancient store are also
+// mirrored in the local database, to be served without a round trip.
+type TieringPolicy struct {
+	Mirror          uint64 `json:"mirror"`          // Number of most recent ancient blocks mirrored locally
+	RemoteOnlyBelow uint64 `json:"remoteOnlyBelow"` // Number of the first block eligible for mirroring
+}
+
+// window returns the range of ancient blocks to mirror with the given number of
+// frozen blocks.
+func (p TieringPolicy) window(frozen uint64) (uint64, uint64) {
+	begin := uint64(0)
+	if frozen > p.Mirror {
+		begin = frozen - p.Mirror
+	}
+	if begin < p.RemoteOnlyBelow {
+		begin = p.RemoteOnlyBelow
+	}
+	if begin > frozen {
+		begin = frozen
+	}
+	return begin, frozen
+}
+
+// LoadTieringPolicy reads a tiering policy from a JSON file.
+func LoadTieringPolicy(file string) (TieringPolicy, error) {
+	var policy TieringPolicy
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return policy, err
+	}
+	err = json.Unmarshal(blob, &policy)
+	return policy, err
+}
+
+// TieringStats is the state of the local mirror of a remote ancient store.
+type TieringStats struct {
+	Policy       TieringPolicy `json:"policy"`
+	PolicyFile   string        `json:"policyFile,omitempty"`
+	Frozen       uint64        `json:"frozen"`       // Number of blocks in the remote ancient store
+	MirrorBegin  uint64        `json:"mirrorBegin"`  // Number of the first locally mirrored block
+	MirrorEnd    uint64        `json:"mirrorEnd"`    // Number of the block following the last locally mirrored one
+	LocalHits    uint64        `json:"localHits"`    // Number of items served from the local mirror
+	RemoteHits   uint64        `json:"remoteHits"`   // Number of items served from the remote ancient store
+	FallbackHits uint64        `json:"fallbackHits"` // Number of items served from the fallback during remote failures
+}
+
+// AncientTiering is implemented by ancient stores mirroring part of a remote
+// ancient store locally according to a tiering policy.
+type AncientTiering interface {
+	// SetTieringPolicy replaces the tiering policy, the items to mirror or evict
+	// accordingly being moved in the background. The policy file, if any, is
+	// reported along with the policy and reread by ReloadTieringPolicy.
+	SetTieringPolicy(policy TieringPolicy, file string)
+
+	// ReloadTieringPolicy rereads the policy file set along with the policy.
+	ReloadTieringPolicy() error
+
+	// TieringStats returns the state of the local mirror.
+	TieringStats() TieringStats
+}
+
+// tieredAncientStore is a remote ancient store mirroring the blocks selected by
+// a tiering policy in the local key-value store. Reads of mirrored items are
+// served locally, and the mirror follows the policy and the appended blocks in
+// the background.
+type tieredAncientStore struct {
+	ethdb.AncientStore
+	db ethdb.KeyValueStore
+
+	policy     TieringPolicy
+	policyFile string
+	policySet  bool // Whether a policy was set, the persisted mirror being left alone until then
+	policyLock sync.RWMutex
+
+	begin, end uint64     // Range of mirrored blocks
+	lock       sync.Mutex // Lock protecting the mirrored range and the moves between tiers
+
+	localHits    uint64 // Accessed atomically
+	remoteHits   uint64 // Accessed atomically
+	fallbackHits uint64 // Accessed atomically
+
+	fallback        AncientFallback // Source of the items the remote store fails to serve, if any
+	fallbackTimeout time.Duration   // Time a remote read may take before falling back (0 = unlimited)
+	fallbackLock    sync.RWMutex
+	remoteSlots     chan struct{} // Remote reads in flight while falling back is enabled
+	hashes          *lru.Cache    // Recently read or appended canonical hashes, keyed by number
+
+	update    chan struct{}
+	quit      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// newTieredAncientStore wraps a remote ancient store with a local mirror in the
+// given key-value store. The mirror persisted by a previous run keeps being
+// served, but is neither filled up nor evicted until a policy is set.
+func newTieredAncientStore(db ethdb.KeyValueStore, remote ethdb.AncientStore) *tieredAncientStore {
+	hashes, _ := lru.New(fallbackHashItems)
+	t := &tieredAncientStore{
+		AncientStore: remote,
+		remoteSlots:  make(chan struct{}, fallbackRemoteReads),
+		hashes:       hashes,
+		db:           db,
+		update:       make(chan struct{}, 1),
+		quit:         make(chan struct{}),
+	}
+	if blob, _ := db.Get(ancientMirrorKey); len(blob) == 16 {
+		t.begin, t.end = binary.BigEndian.Uint64(blob[:8]), binary.BigEndian.Uint64(blob[8:])
+	}
+	t.wg.Add(1)
+	go t.loop()
+	return t
+}
+
+// SetTieringPolicy implements AncientTiering.
+func (t *tieredAncientStore) SetTieringPolicy(policy TieringPolicy, file string) {
+	t.policyLock.Lock()
+	t.policy, t.policyFile, t.policySet = policy, file, true
+	t.policyLock.Unlock()
+
+	log.Info("Updated ancient tiering policy", "mirror", policy.Mirror, "remoteonly", policy.RemoteOnlyBelow)
+	select {
+	case t.update <- struct{}{}:
+	default:
+	}
+}
+
+// ReloadTieringPolicy implements AncientTiering.
+func (t *tieredAncientStore) ReloadTieringPolicy() error {
+	t.policyLock.RLock()
+	file := t.policyFile
+	t.policyLock.RUnlock()
+
+	if file == "" {
+		return errNoTieringPolicy
+	}
+	policy, err := LoadTieringPolicy(file)
+	if err != nil {
+		return err
+	}
+	t.SetTieringPolicy(policy, file)
+	return nil
+}
+
+// TieringStats implements AncientTiering.
+func (t *tieredAncientStore) TieringStats() TieringStats {
+	t.policyLock.RLock()
+	stats := TieringStats{Policy: t.policy, PolicyFile: t.policyFile}
+	t.policyLock.RUnlock()
+
+	stats.Frozen, _ = t.AncientStore.Ancients()
+	t.lock.Lock()
+	stats.MirrorBegin, stats.MirrorEnd = t.begin, t.end
+	t.lock.Unlock()
+
+	stats.LocalHits = atomic.LoadUint64(&t.localHits)
+	stats.RemoteHits = atomic.LoadUint64(&t.remoteHits)
+	stats.FallbackHits = atomic.LoadUint64(&t.fallbackHits)
+	return stats
+}
+
+// local retrieves an item from the local mirror, if present.
+func (t *tieredAncientStore) local(kind string, number uint64) []byte {
+	blob, err := t.db.Get(ancientMirrorItemKey(kind, number))
+	if err != nil || blob == nil {
+		return nil
+	}
+	return blob
+}
+
+// hit records the tier an item was served from.
+func (t *tieredAncientStore) hit(local bool, items int) {
+	if local {
+		atomic.AddUint64(&t.localHits, uint64(items))
+		tierLocalMeter.Mark(int64(items))
+	} else {
+		atomic.AddUint64(&t.remoteHits, uint64(items))
+		tierRemoteMeter.Mark(int64(items))
+	}
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists,
+// locally or in the remote store.
+func (t *tieredAncientStore) HasAncient(kind string, number uint64) (bool, error) {
+	if ok, _ := t.db.Has(ancientMirrorItemKey(kind, number)); ok {
+		return true, nil
+	}
+	return t.AncientStore.HasAncient(kind, number)
+}
+
+// Ancient retrieves an ancient binary blob, from the local mirror if present, or
+// from the fallback if set and the remote store fails to serve it.
+func (t *tieredAncientStore) Ancient(kind string, number uint64) ([]byte, error) {
+	return t.ancient(kind, number, true)
+}
+
+// ancient retrieves an ancient binary blob, from the local mirror if present, or
+// from the remote store, falling back if allowed.
+func (t *tieredAncientStore) ancient(kind string, number uint64, allowFallback bool) ([]byte, error) {
+	if blob := t.local(kind, number); blob != nil {
+		t.hit(true, 1)
+		if kind == freezerHashTable {
+			t.learnHash(number, blob)
+		}
+		return blob, nil
+	}
+	blob, err := t.remote(kind, number, allowFallback)
+	if err != nil {
+		if !allowFallback {
+			return nil, err
+		}
+		return t.fallbackAncient(kind, number, err)
+	}
+	t.hit(false, 1)
+	if kind == freezerHashTable {
+		t.learnHash(number, blob)
+	}
+	return blob, nil
+}
+
+// AncientRange retrieves up to count consecutive ancient binary blobs, from the
+// local mirror as long as they are present there.
+func (t *tieredAncientStore) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	var (
+		blobs [][]byte
+		size  uint64
+	)
+	for i := uint64(0); i < count && size < maxBytes; i++ {
+		blob := t.local(kind, start+i)
+		if blob == nil {
+			break
+		}
+		blobs = append(blobs, blob)
+		size += uint64(len(blob))
+	}
+	if len(blobs) > 0 {
+		t.hit(true, len(blobs))
+		return blobs, nil
+	}
+	ranger, ok := t.AncientStore.(AncientRanger)
+	if !ok {
+		return nil, errNotSupported
+	}
+	blobs, err := ranger.AncientRange(kind, start, count, maxBytes)
+	if err == nil {
+		t.hit(false, len(blobs))
+	}
+	return blobs, err
+}
+
+// AppendAncient injects the block into the remote store, mirroring it locally
+// if the policy selects it.
+func (t *tieredAncientStore) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	if err := t.AncientStore.AppendAncient(number, hash, header, body, receipts, td); err != nil {
+		return err
+	}
+	t.learnHash(number, hash)
+
+	t.policyLock.RLock()
+	begin, _ := t.policy.window(number + 1)
+	t.policyLock.RUnlock()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Only extend a contiguous mirror, the gaps are filled in the background
+	if number < begin || number != t.end {
+		return nil
+	}
+	batch := t.db.NewBatch()
+	for i, blob := range [][]byte{hash, header, body, receipts, td} {
+		batch.Put(ancientMirrorItemKey(ancientKinds[i], number), blob)
+	}
+	if t.begin == t.end {
+		t.begin = number
+	}
+	t.end = number + 1
+	t.writeRange(batch)
+	return batch.Write()
+}
+
+// TruncateAncients discards all but the first n ancient data from the remote
+// store and the local mirror.
+func (t *tieredAncientStore) TruncateAncients(items uint64) error {
+	if err := t.AncientStore.TruncateAncients(items); err != nil {
+		return err
+	}
+	for _, key := range t.hashes.Keys() {
+		if key.(uint64) >= items {
+			t.hashes.Remove(key)
+		}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.end <= items {
+		return nil
+	}
+	from := items
+	if from < t.begin {
+		from = t.begin
+	}
+	batch := t.db.NewBatch()
+	t.evict(batch, from, t.end)
+	if t.end = from; t.begin > t.end {
+		t.begin = t.end
+	}
+	t.writeRange(batch)
+	return batch.Write()
+}
+
+// TruncateTail discards the oldest items of the given kind from the remote store,
+// if it supports it, and from the local mirror.
+func (t *tieredAncientStore) TruncateTail(kind string, items uint64) (uint64, error) {
+	truncater, ok := t.AncientStore.(AncientTailTruncater)
+	if !ok {
+		return 0, errNotSupported
+	}
+	retained, err := truncater.TruncateTail(kind, items)
+	if err != nil {
+		return retained, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	batch := t.db.NewBatch()
+	for number := t.begin; number < items && number < t.end; number++ {
+		batch.Delete(ancientMirrorItemKey(kind, number))
+	}
+	return retained, batch.Write()
+}
+
+// PauseFreezing stops sending new blocks to the remote store at a block boundary.
+func (t *tieredAncientStore) PauseFreezing() {
+	if pauser, ok := t.AncientStore.(AncientFreezePauser); ok {
+		pauser.PauseFreezing()
+	}
+}
+
+// ResumeFreezing lets the blocks be sent to the remote store again after a pause.
+func (t *tieredAncientStore) ResumeFreezing() {
+	if pauser, ok := t.AncientStore.(AncientFreezePauser); ok {
+		pauser.ResumeFreezing()
+	}
+}
+
+// AncientOutage returns the error the remote store was last found unreachable
+// with.
+func (t *tieredAncientStore) AncientOutage() error {
+	if reporter, ok := t.AncientStore.(AncientOutageReporter); ok {
+		return reporter.AncientOutage()
+	}
+	return nil
+}
+
+// Close stops moving items between the tiers and closes the remote store.
+func (t *tieredAncientStore) Close() error {
+	t.closeOnce.Do(func() { close(t.quit) })
+	t.wg.Wait()
+	return t.AncientStore.Close()
+}
+
+// evict adds the deletion of the mirrored blocks in the given range to the batch.
+func (t *tieredAncientStore) evict(batch ethdb.Batch, begin, end uint64) {
+	for number := begin; number < end; number++ {
+		for _, kind := range ancientKinds {
+			batch.Delete(ancientMirrorItemKey(kind, number))
+		}
+	}
+}
+
+// writeRange adds the mirrored range to the batch and updates the gauge.
+func (t *tieredAncientStore) writeRange(batch ethdb.KeyValueWriter) {
+	blob := make([]byte, 16)
+	binary.BigEndian.PutUint64(blob[:8], t.begin)
+	binary.BigEndian.PutUint64(blob[8:], t.end)
+	batch.Put(ancientMirrorKey, blob)
+	tierMirroredGauge.Update(int64(t.end - t.begin))
+}
+
+// loop moves items between the tiers whenever the policy changes, and
+// periodically to keep up with the appended blocks.
+func (t *tieredAncientStore) loop() {
+	defer t.wg.Done()
+
+	for {
+		if err := t.maintain(); err != nil {
+			log.Warn("Failed to update the ancient mirror", "err", err)
+		}
+		select {
+		case <-t.update:
+		case <-time.After(freezerRecheckInterval):
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// maintain evicts the mirrored blocks falling out of the policy window and fills
+// up the ones missing from it, in batches, until the mirror matches the policy.
+// Without a policy set yet, the mirror is left as is.
+func (t *tieredAncientStore) maintain() error {
+	for {
+		select {
+		case <-t.quit:
+			return nil
+		default:
+		}
+		frozen, err := t.AncientStore.Ancients()
+		if err != nil {
+			return err
+		}
+		t.policyLock.RLock()
+		begin, end := t.policy.window(frozen)
+		set := t.policySet
+		t.policyLock.RUnlock()
+
+		if !set {
+			return nil
+		}
+		done, err := t.step(begin, end)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// step moves a batch of items between the tiers towards mirroring the given
+// range of blocks, reporting whether the mirror already matches it.
+func (t *tieredAncientStore) step(begin, end uint64) (bool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	batch := t.db.NewBatch()
+	prevBegin, prevEnd := t.begin, t.end
+
+	// Drop the whole mirror if disjoint from the window, or its parts outside
+	if t.end <= begin || t.begin >= end || t.begin == t.end {
+		t.evict(batch, t.begin, t.end)
+		t.begin, t.end = begin, begin
+	}
+	if t.begin < begin {
+		t.evict(batch, t.begin, begin)
+		t.begin = begin
+	}
+	if t.end > end {
+		t.evict(batch, end, t.end)
+		t.end = end
+	}
+	// Extend the mirror forwards first, backwards then
+	var (
+		from, count uint64
+		forward     = t.end < end
+	)
+	switch {
+	case forward:
+		from, count = t.end, end-t.end
+		if count > tieringBatchItems {
+			count = tieringBatchItems
+		}
+	case t.begin > begin:
+		count = t.begin - begin
+		if count > tieringBatchItems {
+			count = tieringBatchItems
+		}
+		from = t.begin - count
+	default:
+		if t.begin == prevBegin && t.end == prevEnd {
+			return true, nil
+		}
+		t.writeRange(batch)
+		return true, batch.Write()
+	}
+	retrieved, err := t.fetch(batch, from, count)
+	if err != nil {
+		return false, err
+	}
+	if forward {
+		t.end = from + retrieved
+	} else {
+		if retrieved < count {
+			return false, errors.New("remote ancient items missing")
+		}
+		t.begin = from
+	}
+	t.writeRange(batch)
+	if err := batch.Write(); err != nil {
+		return false, err
+	}
+	return retrieved == 0, nil
+}
+
+// fetch retrieves up to count consecutive blocks from the remote store into the
+// batch, returning the number of complete blocks retrieved.
+func (t *tieredAncientStore) fetch(batch ethdb.Batch, from, count uint64) (uint64, error) {
+	complete := count
+	blobs := make([][][]byte, len(ancientKinds))
+	for i, kind := range ancientKinds {
+		var err error
+		if ranger, ok := t.AncientStore.(AncientRanger); ok {
+			blobs[i], err = ranger.AncientRange(kind, from, complete, tieringBatchBytes)
+		} else {
+			for n := uint64(0); n < complete; n++ {
+				blob, err := t.AncientStore.Ancient(kind, from+n)
+				if err != nil {
+					break
+				}
+				blobs[i] = append(blobs[i], blob)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		if uint64(len(blobs[i])) < complete {
+			complete = uint64(len(blobs[i]))
+		}
+	}
+	for i, kind := range ancientKinds {
+		for n := uint64(0); n < complete; n++ {
+			batch.Put(ancientMirrorItemKey(kind, from+n), blobs[i][n])
+		}
+	}
+	return complete, nil
+}
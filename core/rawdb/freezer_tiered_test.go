@@ -0,0 +1,173 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func newTieredTestStore(t *testing.T, blocks int) *tieredAncientStore {
+	server := rpc.NewServer()
+	if err := server.RegisterName("freezer", lib.NewMemFreezerRemoteServerAPI()); err != nil {
+		t.Fatal(err)
+	}
+	remote := &FreezerRemoteClient{client: rpc.DialInProc(server), quit: make(chan struct{}), journal: openRemoteJournal(NewMemoryDatabase())}
+	store := newTieredAncientStore(NewMemoryDatabase(), remote)
+	for i := 0; i < blocks; i++ {
+		b := []byte{byte(i)}
+		if err := store.AppendAncient(uint64(i), b, b, b, b, b); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	return store
+}
+
+func checkMirror(t *testing.T, store *tieredAncientStore, begin, end uint64) {
+	t.Helper()
+
+	if err := store.maintain(); err != nil {
+		t.Fatalf("failed to update the mirror: %v", err)
+	}
+	stats := store.TieringStats()
+	if stats.MirrorBegin != begin || stats.MirrorEnd != end {
+		t.Fatalf("mirrored range mismatch: have [%d, %d), want [%d, %d)", stats.MirrorBegin, stats.MirrorEnd, begin, end)
+	}
+	for number := uint64(0); number < stats.Frozen; number++ {
+		for _, kind := range ancientKinds {
+			if mirrored := store.local(kind, number) != nil; mirrored != (number >= begin && number < end) {
+				t.Fatalf("block #%d %s mirrored: %v", number, kind, mirrored)
+			}
+		}
+	}
+}
+
+// Tests that the local mirror of a remote ancient store follows the tiering
+// policy and the appended blocks.
+func TestTieredAncientStore(t *testing.T) {
+	store := newTieredTestStore(t, 100)
+	defer store.Close()
+
+	// Nothing is mirrored before a policy is set
+	checkMirror(t, store, 0, 0)
+
+	// Mirror the recent blocks
+	store.SetTieringPolicy(TieringPolicy{Mirror: 30}, "")
+	checkMirror(t, store, 70, 100)
+
+	if blob, err := store.Ancient(freezerBodiesTable, 80); err != nil || !bytes.Equal(blob, []byte{80}) {
+		t.Fatalf("mirrored item mismatch: %x, %v", blob, err)
+	}
+	if blob, err := store.Ancient(freezerBodiesTable, 10); err != nil || !bytes.Equal(blob, []byte{10}) {
+		t.Fatalf("remote item mismatch: %x, %v", blob, err)
+	}
+	if blobs, err := store.AncientRange(freezerHashTable, 95, 10, 1024); err != nil || len(blobs) != 5 {
+		t.Fatalf("mirrored range mismatch: %d items, %v", len(blobs), err)
+	}
+	if stats := store.TieringStats(); stats.LocalHits != 6 || stats.RemoteHits != 1 {
+		t.Fatalf("hits mismatch: %d local, %d remote", stats.LocalHits, stats.RemoteHits)
+	}
+	// Appended blocks are mirrored right away, the old ones evicted later
+	for i := 100; i < 110; i++ {
+		b := []byte{byte(i)}
+		if err := store.AppendAncient(uint64(i), b, b, b, b, b); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if stats := store.TieringStats(); stats.MirrorEnd != 110 {
+		t.Fatalf("appended blocks not mirrored: have end %d", stats.MirrorEnd)
+	}
+	checkMirror(t, store, 80, 110)
+
+	// Old blocks stay remote only, even if recent enough
+	store.SetTieringPolicy(TieringPolicy{Mirror: 50, RemoteOnlyBelow: 90}, "")
+	checkMirror(t, store, 90, 110)
+
+	store.SetTieringPolicy(TieringPolicy{Mirror: 50}, "")
+	checkMirror(t, store, 60, 110)
+
+	// Truncations apply to the mirror too
+	if err := store.TruncateAncients(95); err != nil {
+		t.Fatalf("truncation failed: %v", err)
+	}
+	checkMirror(t, store, 45, 95)
+}
+
+// Tests that the mirror persisted by a previous run is left alone until a policy
+// is set, instead of being evicted by the empty default one.
+func TestTieredAncientStoreReopen(t *testing.T) {
+	store := newTieredTestStore(t, 100)
+	store.SetTieringPolicy(TieringPolicy{Mirror: 30}, "")
+	checkMirror(t, store, 70, 100)
+
+	// Stop the maintenance of the first store, keeping the remote one open
+	store.closeOnce.Do(func() { close(store.quit) })
+	store.wg.Wait()
+
+	reopened := newTieredAncientStore(store.db, store.AncientStore)
+	defer reopened.Close()
+
+	checkMirror(t, reopened, 70, 100)
+	if blob, err := reopened.Ancient(freezerBodiesTable, 80); err != nil || !bytes.Equal(blob, []byte{80}) {
+		t.Fatalf("mirrored item mismatch: %x, %v", blob, err)
+	}
+	if stats := reopened.TieringStats(); stats.LocalHits != 1 {
+		t.Fatalf("persisted mirror not served: %d local hits", stats.LocalHits)
+	}
+	reopened.SetTieringPolicy(TieringPolicy{Mirror: 10}, "")
+	checkMirror(t, reopened, 90, 100)
+}
+
+// Tests that the tiering policy is reloaded from its file.
+func TestTieringPolicyReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := newTieredTestStore(t, 20)
+	defer store.Close()
+
+	if err := store.ReloadTieringPolicy(); err != errNoTieringPolicy {
+		t.Fatalf("reload without a file: have %v, want %v", err, errNoTieringPolicy)
+	}
+	file := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(file, []byte(`{"mirror": 5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadTieringPolicy(file)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	store.SetTieringPolicy(policy, file)
+	checkMirror(t, store, 15, 20)
+
+	if err := ioutil.WriteFile(file, []byte(`{"mirror": 10}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ReloadTieringPolicy(); err != nil {
+		t.Fatalf("failed to reload policy: %v", err)
+	}
+	checkMirror(t, store, 10, 20)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReadHistoryTail retrieves the number of the oldest block whose body and
+// receipts are retained, nil if the history was never pruned.
+func ReadHistoryTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(historyTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteHistoryTail stores the number of the oldest block whose body and
+// receipts are retained.
+func WriteHistoryTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(historyTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the history tail", "err", err)
+	}
+}
+
+// historyPruned reports whether the body and receipts of the given block were
+// discarded by history pruning.
+func historyPruned(db ethdb.KeyValueReader, number uint64) bool {
+	tail := ReadHistoryTail(db)
+	return tail != nil && number < *tail
+}
+
+// PruneHistory discards the bodies and receipts of the canonical blocks below
+// the given number, retaining their headers, and records the new history tail.
+// The genesis block is always retained.
+//
+// Frozen bodies and receipts are discarded from the ancient store as far as it
+// supports it; the local freezer only discards whole data files, so the items
+// sharing a file with retained ones are kept around until the file is complete.
+func PruneHistory(db ethdb.Database, tail uint64) error {
+	prev := uint64(1)
+	if stored := ReadHistoryTail(db); stored != nil && *stored > prev {
+		prev = *stored
+	}
+	if tail <= prev {
+		return nil
+	}
+	frozen, _ := db.Ancients()
+
+	// Delete the bodies and receipts still in the key-value store
+	start := prev
+	if start < frozen {
+		start = frozen
+	}
+	batch := db.NewBatch()
+	for number := start; number < tail; number++ {
+		hash := ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		DeleteBody(batch, hash, number)
+		DeleteReceipts(batch, hash, number)
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	WriteHistoryTail(batch, tail)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	// Discard the frozen ones from the ancient store
+	if frozen > 0 {
+		truncater, ok := db.(AncientTailTruncater)
+		if !ok {
+			return nil
+		}
+		limit := tail
+		if limit > frozen {
+			limit = frozen
+		}
+		for _, kind := range []string{freezerBodiesTable, freezerReceiptTable} {
+			retained, err := truncater.TruncateTail(kind, limit)
+			if err == errNotSupported {
+				log.Debug("Ancient store doesn't support tail truncation", "kind", kind)
+				break
+			}
+			if err != nil {
+				return err
+			}
+			log.Debug("Truncated ancient tail", "kind", kind, "limit", limit, "retained", retained)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that pruning the history discards the bodies and receipts of the old
+// canonical blocks only, and never moves the tail backwards.
+func TestPruneHistory(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	hashes := make([]common.Hash, 10)
+	for i := range hashes {
+		hashes[i] = common.BytesToHash([]byte{byte(i + 1)})
+		WriteCanonicalHash(db, hashes[i], uint64(i))
+		WriteBody(db, hashes[i], uint64(i), &types.Body{})
+		WriteReceipts(db, hashes[i], uint64(i), types.Receipts{})
+	}
+	if tail := ReadHistoryTail(db); tail != nil {
+		t.Fatalf("history tail of an unpruned database: %d", *tail)
+	}
+	if err := PruneHistory(db, 5); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	check := func(tail uint64) {
+		t.Helper()
+		if stored := ReadHistoryTail(db); stored == nil || *stored != tail {
+			t.Fatalf("history tail mismatch: have %v, want %d", stored, tail)
+		}
+		for i, hash := range hashes {
+			number := uint64(i)
+			retained := number == 0 || number >= tail
+			if HasBody(db, hash, number) != retained || HasReceipts(db, hash, number) != retained {
+				t.Fatalf("block %d: retention mismatch, want %v", number, retained)
+			}
+			if historyPruned(db, number) == retained && number != 0 {
+				t.Fatalf("block %d: pruned mismatch, want %v", number, !retained)
+			}
+		}
+	}
+	check(5)
+
+	// Lower tails are ignored
+	if err := PruneHistory(db, 3); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	check(5)
+
+	if err := PruneHistory(db, 8); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	check(8)
+}
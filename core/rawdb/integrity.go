@@ -0,0 +1,215 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// IntegrityError is returned by CheckChainIntegrity if the chain data is found
+// to be inconsistent. Repair holds the highest block number below which all the
+// checked data was found valid, which is a safe point to rewind the chain to.
+type IntegrityError struct {
+	Reason string
+	Repair uint64
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("chain integrity check failed: %s (repairable by rewinding to #%d)", e.Reason, e.Repair)
+}
+
+// CheckChainIntegrity runs a fast consistency check over the chain data:
+//
+//   - The head header, block and fast block markers reference canonical headers.
+//   - The last depth canonical headers below the head link to their parents.
+//   - The key-value store continues the ancient store without gaps.
+//   - A remote ancient store holds at least as many items as were moved into it.
+//
+// A nil error is returned for an empty database.
+func CheckChainIntegrity(db ethdb.Database, depth uint64) error {
+	start := time.Now()
+
+	headHash := ReadHeadHeaderHash(db)
+	if headHash == (common.Hash{}) {
+		return nil
+	}
+	head := ReadHeaderNumber(db, headHash)
+	if head == nil {
+		return &IntegrityError{Reason: fmt.Sprintf("head header %x has no number", headHash)}
+	}
+	// Ensure a remote ancient store didn't get rolled back or swapped out
+	frozen, err := db.Ancients()
+	if err != nil && err != errNotSupported {
+		return err
+	}
+	if marker := ReadRemoteAncients(db); marker != nil && frozen < *marker {
+		repair := uint64(0)
+		if frozen > 0 {
+			repair = frozen - 1
+		}
+		return &IntegrityError{Reason: fmt.Sprintf("remote ancient store holds %d items, %d were frozen", frozen, *marker), Repair: repair}
+	}
+	// Walk the canonical chain backwards from the head, ensuring the hashes link
+	var (
+		number = *head
+		hash   = headHash
+		limit  = uint64(0)
+	)
+	if *head > depth {
+		limit = *head - depth
+	}
+	// Always cross the freezer boundary to make sure the two stores are contiguous
+	if frozen > 0 && frozen-1 < limit && frozen <= *head {
+		limit = frozen - 1
+	}
+	for {
+		header := ReadHeader(db, hash, number)
+		if header == nil {
+			return &IntegrityError{Reason: fmt.Sprintf("canonical header #%d [%x] missing", number, hash), Repair: parentOf(number)}
+		}
+		if header.Hash() != hash {
+			return &IntegrityError{Reason: fmt.Sprintf("header #%d corrupted: have hash %x, want %x", number, header.Hash(), hash), Repair: parentOf(number)}
+		}
+		if canon := ReadCanonicalHash(db, number); canon != hash {
+			return &IntegrityError{Reason: fmt.Sprintf("canonical hash mismatch at #%d: have %x, want %x", number, canon, hash), Repair: parentOf(number)}
+		}
+		if number <= limit || number == 0 {
+			break
+		}
+		number, hash = number-1, header.ParentHash
+	}
+	// Seems the chain itself is fine, check the side head markers
+	markers := []struct {
+		name string
+		hash common.Hash
+	}{
+		{"head block", ReadHeadBlockHash(db)},
+		{"head fast block", ReadHeadFastBlockHash(db)},
+	}
+	for _, marker := range markers {
+		if marker.hash == (common.Hash{}) {
+			continue
+		}
+		number := ReadHeaderNumber(db, marker.hash)
+		if number == nil {
+			return &IntegrityError{Reason: fmt.Sprintf("%s %x unknown", marker.name, marker.hash), Repair: *head}
+		}
+		if *number > *head {
+			return &IntegrityError{Reason: fmt.Sprintf("%s #%d above head header #%d", marker.name, *number, *head), Repair: *head}
+		}
+		if canon := ReadCanonicalHash(db, *number); canon != marker.hash {
+			return &IntegrityError{Reason: fmt.Sprintf("%s #%d [%x] not canonical", marker.name, *number, marker.hash), Repair: parentOf(*number)}
+		}
+	}
+	log.Info("Chain integrity verified", "head", *head, "checked", *head-number+1, "frozen", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// RewindChainHeads resets all the head markers to the canonical block at the
+// given number, so that the blockchain is loaded from a consistent point.
+func RewindChainHeads(db ethdb.Database, number uint64) error {
+	hash := ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return fmt.Errorf("canonical block #%d missing", number)
+	}
+	batch := db.NewBatch()
+	WriteHeadHeaderHash(batch, hash)
+	if current := ReadHeaderNumber(db, ReadHeadBlockHash(db)); current == nil || *current > number {
+		WriteHeadBlockHash(batch, hash)
+	}
+	if current := ReadHeaderNumber(db, ReadHeadFastBlockHash(db)); current == nil || *current > number {
+		WriteHeadFastBlockHash(batch, hash)
+	}
+	return batch.Write()
+}
+
+// WriteRepairedReceipts stores the regenerated receipts of a canonical block. As
+// the (local or remote) ancient store is append-only, a frozen block is moved back
+// into the key-value store together with all the ancients after it, from where
+// the freezer of the node moves them again once restarted.
+func WriteRepairedReceipts(db ethdb.Database, hash common.Hash, number uint64, receipts types.Receipts) error {
+	frozen, err := db.Ancients()
+	if err != nil && err != errNotSupported {
+		return err
+	}
+	if number < frozen {
+		if err := unfreezeAncients(db, number, frozen); err != nil {
+			return err
+		}
+	}
+	if canon := ReadCanonicalHash(db, number); canon != hash {
+		return fmt.Errorf("block #%d [%x] not canonical", number, hash)
+	}
+	WriteReceipts(db, hash, number, receipts)
+	if number >= frozen {
+		return nil
+	}
+	// The whole tail is safe in the key-value store, drop it from the ancients
+	if err := db.TruncateAncients(number); err != nil {
+		return err
+	}
+	if marker := ReadRemoteAncients(db); marker != nil && *marker > number {
+		WriteRemoteAncients(db, number)
+	}
+	log.Info("Moved ancients back into the key-value store", "from", number, "count", frozen-number)
+	return nil
+}
+
+// unfreezeAncients copies the canonical blocks of the ancient store in the range
+// [from, to) back into the key-value store, leaving the ancients untouched.
+func unfreezeAncients(db ethdb.Database, from, to uint64) error {
+	batch := db.NewBatch()
+	for number := from; number < to; number++ {
+		var blobs [5][]byte
+		for i, kind := range []string{freezerHashTable, freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable} {
+			blob, err := db.Ancient(kind, number)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve ancient %s #%d: %v", kind, number, err)
+			}
+			blobs[i] = blob
+		}
+		hash := common.BytesToHash(blobs[0])
+		WriteCanonicalHash(batch, hash, number)
+		WriteHeaderNumber(batch, hash, number)
+		batch.Put(headerKey(number, hash), blobs[1])
+		batch.Put(blockBodyKey(number, hash), blobs[2])
+		batch.Put(blockReceiptsKey(number, hash), blobs[3])
+		batch.Put(headerTDKey(number, hash), blobs[4])
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
+
+// parentOf returns the number of the parent of the given block, or the genesis.
+func parentOf(number uint64) uint64 {
+	if number == 0 {
+		return 0
+	}
+	return number - 1
+}
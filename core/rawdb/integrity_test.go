@@ -0,0 +1,155 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// writeTestHeaderChain writes a linked canonical header chain of the given
+// length into the database, returning the headers.
+func writeTestHeaderChain(db ethdb.Database, n int) []*types.Header {
+	var (
+		headers []*types.Header
+		parent  common.Hash
+	)
+	for i := 0; i < n; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Extra: []byte("test header")}
+		WriteHeader(db, header)
+		WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		headers, parent = append(headers, header), header.Hash()
+	}
+	WriteHeadHeaderHash(db, parent)
+	WriteHeadBlockHash(db, parent)
+	return headers
+}
+
+func TestChainIntegrity(t *testing.T) {
+	// An empty database is always fine
+	if err := CheckChainIntegrity(NewMemoryDatabase(), 16); err != nil {
+		t.Fatalf("empty database failed check: %v", err)
+	}
+	db := NewMemoryDatabase()
+	headers := writeTestHeaderChain(db, 10)
+	if err := CheckChainIntegrity(db, 16); err != nil {
+		t.Fatalf("valid chain failed check: %v", err)
+	}
+	// Break the linkage in the middle of the chain and make sure it's detected
+	// only if the check goes deep enough
+	DeleteHeader(db, headers[5].Hash(), 5)
+	if err := CheckChainIntegrity(db, 3); err != nil {
+		t.Fatalf("shallow check failed on valid tail: %v", err)
+	}
+	err := CheckChainIntegrity(db, 16)
+	ierr, ok := err.(*IntegrityError)
+	if !ok {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+	if ierr.Repair != 4 {
+		t.Fatalf("repair point mismatch: have %d, want 4", ierr.Repair)
+	}
+	// Rewind the markers and ensure the chain checks out again
+	if err := RewindChainHeads(db, ierr.Repair); err != nil {
+		t.Fatalf("failed to rewind heads: %v", err)
+	}
+	if err := CheckChainIntegrity(db, 16); err != nil {
+		t.Fatalf("rewound chain failed check: %v", err)
+	}
+	if head := ReadHeadBlockHash(db); head != headers[4].Hash() {
+		t.Fatalf("head block mismatch: have %x, want %x", head, headers[4].Hash())
+	}
+	// A non-canonical head block marker should also be caught
+	WriteHeadBlockHash(db, headers[6].Hash())
+	if err := CheckChainIntegrity(db, 16); err == nil {
+		t.Fatalf("head block above head header passed check")
+	}
+	WriteHeadBlockHash(db, headers[4].Hash())
+
+	// Pretend items were moved into a remote ancient store that lost them
+	WriteRemoteAncients(db, 3)
+	if err := CheckChainIntegrity(db, 16); err == nil {
+		t.Fatalf("missing remote ancients passed check")
+	}
+}
+
+// Tests that repaired receipts of frozen blocks are written back by moving the
+// ancient tail into the key-value store.
+func TestWriteRepairedReceipts(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	defer db.Close()
+
+	var blocks []*types.Block
+	for i := 0; i < 6; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: []byte("test block")})
+		receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: uint64(i), Logs: []*types.Log{}}}
+		WriteAncientBlock(db, block, receipts, big.NewInt(int64(i)))
+		blocks = append(blocks, block)
+	}
+	WriteRemoteAncients(db, 6)
+
+	// Receipts may only be repaired for canonical blocks
+	fixed := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 42, Logs: []*types.Log{}}}
+	if err := WriteRepairedReceipts(db, blocks[3].Hash(), 6, fixed); err == nil {
+		t.Fatalf("non-canonical block repaired")
+	}
+	// Repairing a frozen block moves the ancients back
+	if err := WriteRepairedReceipts(db, blocks[3].Hash(), 3, fixed); err != nil {
+		t.Fatalf("failed to repair receipts: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 3 {
+		t.Fatalf("ancients not truncated: have %d, want 3", frozen)
+	}
+	if marker := ReadRemoteAncients(db); marker == nil || *marker != 3 {
+		t.Fatalf("remote ancient marker not lowered: %v", marker)
+	}
+	if receipts := ReadRawReceipts(db, blocks[3].Hash(), 3); len(receipts) != 1 || receipts[0].CumulativeGasUsed != 42 {
+		t.Fatalf("repaired receipts not stored: %v", receipts)
+	}
+	for _, block := range blocks {
+		number := block.NumberU64()
+		if hash := ReadCanonicalHash(db, number); hash != block.Hash() {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", number, hash, block.Hash())
+		}
+		if ReadHeader(db, block.Hash(), number) == nil || ReadBody(db, block.Hash(), number) == nil {
+			t.Errorf("block #%d: header or body missing", number)
+		}
+		if td := ReadTd(db, block.Hash(), number); td == nil || td.Uint64() != number {
+			t.Errorf("block #%d: total difficulty mismatch: %v", number, td)
+		}
+		if number != 3 {
+			if receipts := ReadRawReceipts(db, block.Hash(), number); len(receipts) != 1 || receipts[0].CumulativeGasUsed != number {
+				t.Errorf("block #%d: receipts mismatch: %v", number, receipts)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Migration is a versioned change of the key schema of the database.
+//
+// Migrations must be idempotent, as an interrupted migration is run again from
+// the start. Their writes are batched and only applied once flushed (and never
+// in dry runs), so they must not rely on reading them back.
+type Migration struct {
+	Version     uint64                      // Schema version of the database after the migration
+	Description string                      // Human readable summary of the change
+	Up          func(op *MigrationOp) error // Upgrades the database from the previous version
+	Down        func(op *MigrationOp) error // Reverts the upgrade, nil if it can't be rolled back
+}
+
+// SchemaMigrations are the migrations of the key schema, ordered by version,
+// which run automatically when a node opens its database.
+var SchemaMigrations []Migration
+
+// LatestSchemaVersion returns the schema version of a database after applying
+// all the given migrations.
+func LatestSchemaVersion(migrations []Migration) uint64 {
+	return uint64(len(migrations))
+}
+
+// MigrationMarker records the migration in progress, so that an interrupted
+// one is resumed before the database is used again.
+type MigrationMarker struct {
+	From    uint64 // Schema version of the database before the migration
+	To      uint64 // Schema version of the database after the migration
+	Started uint64 // Unix time in seconds the migration started at
+}
+
+// Rollback reports whether the marker records the rollback of a migration.
+func (m *MigrationMarker) Rollback() bool {
+	return m.To < m.From
+}
+
+// ReadSchemaVersion retrieves the key schema version of the database, zero if
+// no migration ever ran.
+func ReadSchemaVersion(db ethdb.KeyValueReader) uint64 {
+	enc, _ := db.Get(schemaVersionKey)
+	if len(enc) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(enc)
+}
+
+// WriteSchemaVersion stores the key schema version of the database.
+func WriteSchemaVersion(db ethdb.KeyValueWriter, version uint64) {
+	if err := db.Put(schemaVersionKey, encodeBlockNumber(version)); err != nil {
+		log.Crit("Failed to store schema version", "err", err)
+	}
+}
+
+// ReadMigrationMarker retrieves the marker of the migration in progress, nil
+// if there's none.
+func ReadMigrationMarker(db ethdb.KeyValueReader) *MigrationMarker {
+	enc, _ := db.Get(schemaMigrationKey)
+	if len(enc) == 0 {
+		return nil
+	}
+	marker := new(MigrationMarker)
+	if err := rlp.DecodeBytes(enc, marker); err != nil {
+		log.Error("Invalid migration marker", "err", err)
+		return nil
+	}
+	return marker
+}
+
+// WriteMigrationMarker stores the marker of the migration in progress.
+func WriteMigrationMarker(db ethdb.KeyValueWriter, from, to uint64) {
+	enc, err := rlp.EncodeToBytes(&MigrationMarker{From: from, To: to, Started: uint64(time.Now().Unix())})
+	if err != nil {
+		log.Crit("Failed to encode migration marker", "err", err)
+	}
+	if err = db.Put(schemaMigrationKey, enc); err != nil {
+		log.Crit("Failed to store migration marker", "err", err)
+	}
+}
+
+// DeleteMigrationMarker removes the marker of the migration in progress.
+func DeleteMigrationMarker(db ethdb.KeyValueWriter) {
+	if err := db.Delete(schemaMigrationKey); err != nil {
+		log.Crit("Failed to delete migration marker", "err", err)
+	}
+}
+
+// MigrationOp is the database access of a running migration, batching its
+// writes and reporting its progress.
+type MigrationOp struct {
+	db     ethdb.Database
+	batch  ethdb.Batch
+	dryRun bool
+
+	name   string
+	start  time.Time
+	logged time.Time
+
+	Puts    uint64 // Number of keys written by the migration
+	Deletes uint64 // Number of keys deleted by the migration
+}
+
+// Database returns the database being migrated, for reading.
+func (op *MigrationOp) Database() ethdb.Database {
+	return op.db
+}
+
+// DryRun reports whether the writes of the migration are discarded.
+func (op *MigrationOp) DryRun() bool {
+	return op.dryRun
+}
+
+// Put stores a key of the new schema.
+func (op *MigrationOp) Put(key, value []byte) error {
+	op.Puts++
+	if op.dryRun {
+		return nil
+	}
+	if err := op.batch.Put(key, value); err != nil {
+		return err
+	}
+	return op.flushIfFull()
+}
+
+// Delete removes a key of the old schema.
+func (op *MigrationOp) Delete(key []byte) error {
+	op.Deletes++
+	if op.dryRun {
+		return nil
+	}
+	if err := op.batch.Delete(key); err != nil {
+		return err
+	}
+	return op.flushIfFull()
+}
+
+// Progress reports the progress of the migration, logging it periodically.
+func (op *MigrationOp) Progress(done, total uint64) {
+	if time.Since(op.logged) < 8*time.Second {
+		return
+	}
+	context := []interface{}{"migration", op.name, "done", done}
+	if total > 0 {
+		context = append(context, "total", total, "progress", fmt.Sprintf("%.2f%%", float64(done)*100/float64(total)))
+	}
+	context = append(context, "puts", op.Puts, "deletes", op.Deletes, "elapsed", common.PrettyDuration(time.Since(op.start)))
+	log.Info("Migrating database", context...)
+	op.logged = time.Now()
+}
+
+func (op *MigrationOp) flushIfFull() error {
+	if op.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	return op.flush()
+}
+
+func (op *MigrationOp) flush() error {
+	if op.dryRun {
+		return nil
+	}
+	if err := op.batch.Write(); err != nil {
+		return err
+	}
+	op.batch.Reset()
+	return nil
+}
+
+// MigrationReport is the outcome of a migration step.
+type MigrationReport struct {
+	Version     uint64 // Schema version the step migrated to or rolled back from
+	Description string
+	Rollback    bool
+	Puts        uint64
+	Deletes     uint64
+	Elapsed     time.Duration
+}
+
+// ValidateMigrations checks that the migrations are ordered by consecutive
+// versions, starting with the first.
+func ValidateMigrations(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != uint64(i+1) {
+			return fmt.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d has no upgrade", m.Version)
+		}
+	}
+	return nil
+}
+
+// RunMigrations migrates the key schema of the database to the target version,
+// upgrading or rolling it back as needed. A migration interrupted before is
+// completed first. Each step is recorded in a marker before it starts, and the
+// new schema version is written along with the removal of the marker once it's
+// done. In dry runs, the migrations run without writing anything, to report the
+// extent of the changes.
+func RunMigrations(db ethdb.Database, migrations []Migration, target uint64, dryRun bool) ([]*MigrationReport, error) {
+	if err := ValidateMigrations(migrations); err != nil {
+		return nil, err
+	}
+	latest := LatestSchemaVersion(migrations)
+	if target > latest {
+		return nil, fmt.Errorf("unknown schema version %d, latest is %d", target, latest)
+	}
+	current := ReadSchemaVersion(db)
+	if current > latest {
+		return nil, fmt.Errorf("database schema version is v%d, only v%d is supported", current, latest)
+	}
+	var reports []*MigrationReport
+
+	// Complete an interrupted migration before anything else
+	if marker := ReadMigrationMarker(db); marker != nil {
+		if marker.From != current || marker.From > latest || marker.To > latest || (marker.To != marker.From+1 && marker.To+1 != marker.From) {
+			return nil, fmt.Errorf("invalid migration marker %d->%d at schema version %d", marker.From, marker.To, current)
+		}
+		log.Warn("Resuming interrupted database migration", "from", marker.From, "to", marker.To, "started", time.Unix(int64(marker.Started), 0))
+		report, err := runMigration(db, migrations, marker.From, marker.To, dryRun)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+		current = marker.To
+	}
+	// Check all the steps back can be rolled back before starting any
+	for v := current; v > target; v-- {
+		if migrations[v-1].Down == nil {
+			return reports, fmt.Errorf("migration %d (%s) can't be rolled back", v, migrations[v-1].Description)
+		}
+	}
+	for current != target {
+		next := current + 1
+		if target < current {
+			next = current - 1
+		}
+		report, err := runMigration(db, migrations, current, next, dryRun)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+		current = next
+	}
+	return reports, nil
+}
+
+// runMigration runs a single migration step between adjacent schema versions.
+func runMigration(db ethdb.Database, migrations []Migration, from, to uint64, dryRun bool) (*MigrationReport, error) {
+	var (
+		m      Migration
+		run    func(op *MigrationOp) error
+		action = "Migrating"
+	)
+	if to > from {
+		m, run = migrations[to-1], migrations[to-1].Up
+	} else {
+		m, run, action = migrations[from-1], migrations[from-1].Down, "Rolling back"
+	}
+	if run == nil {
+		return nil, fmt.Errorf("migration %d (%s) can't be rolled back", m.Version, m.Description)
+	}
+	op := &MigrationOp{
+		db:     db,
+		batch:  db.NewBatch(),
+		dryRun: dryRun,
+		name:   m.Description,
+		start:  time.Now(),
+		logged: time.Now(),
+	}
+	log.Info(action+" database schema", "from", from, "to", to, "migration", m.Description, "dryrun", dryRun)
+	if !dryRun {
+		WriteMigrationMarker(db, from, to)
+	}
+	if err := run(op); err != nil {
+		return nil, fmt.Errorf("migration %d->%d (%s) failed: %v", from, to, m.Description, err)
+	}
+	if !dryRun {
+		WriteSchemaVersion(op.batch, to)
+		DeleteMigrationMarker(op.batch)
+		if err := op.flush(); err != nil {
+			return nil, fmt.Errorf("migration %d->%d (%s) failed: %v", from, to, m.Description, err)
+		}
+	}
+	report := &MigrationReport{
+		Version:     m.Version,
+		Description: m.Description,
+		Rollback:    to < from,
+		Puts:        op.Puts,
+		Deletes:     op.Deletes,
+		Elapsed:     time.Since(op.start),
+	}
+	log.Info("Database schema migrated", "from", from, "to", to, "puts", report.Puts, "deletes", report.Deletes, "elapsed", common.PrettyDuration(report.Elapsed))
+	return report, nil
+}
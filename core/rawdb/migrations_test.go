@@ -0,0 +1,287 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// renameMigration creates a migration moving the keys of a prefix under another
+// one.
+func renameMigration(version uint64, from, to string) Migration {
+	move := func(src, dst string) func(op *MigrationOp) error {
+		return func(op *MigrationOp) error {
+			it := op.Database().NewIterator([]byte(src), nil)
+			defer it.Release()
+
+			for it.Next() {
+				key := append([]byte(dst), it.Key()[len(src):]...)
+				if err := op.Put(key, it.Value()); err != nil {
+					return err
+				}
+				if err := op.Delete(it.Key()); err != nil {
+					return err
+				}
+			}
+			return it.Error()
+		}
+	}
+	return Migration{Version: version, Description: from + "->" + to, Up: move(from, to), Down: move(to, from)}
+}
+
+func countPrefix(db ethdb.Iteratee, prefix string) int {
+	it := db.NewIterator([]byte(prefix), nil)
+	defer it.Release()
+
+	var n int
+	for it.Next() {
+		n++
+	}
+	return n
+}
+
+func newMigrationTestDB() ethdb.Database {
+	db := NewMemoryDatabase()
+	for i := byte(0); i < 10; i++ {
+		db.Put([]byte{'a', '-', i}, []byte{i})
+	}
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	var (
+		db         = newMigrationTestDB()
+		migrations = []Migration{renameMigration(1, "a-", "b-"), renameMigration(2, "b-", "c-")}
+	)
+	// Dry runs report the changes without applying them
+	reports, err := RunMigrations(db, migrations, 2, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Puts != 10 || reports[0].Deletes != 10 {
+		t.Fatalf("dry run reports mismatch: %+v", reports)
+	}
+	if v := ReadSchemaVersion(db); v != 0 || countPrefix(db, "a-") != 10 {
+		t.Fatalf("dry run changed the database: version %d, %d keys left", v, countPrefix(db, "a-"))
+	}
+	// Upgrade to the first version, then the latest
+	if _, err := RunMigrations(db, migrations, 1, false); err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if v := ReadSchemaVersion(db); v != 1 || countPrefix(db, "a-") != 0 || countPrefix(db, "b-") != 10 {
+		t.Fatalf("upgrade mismatch: version %d", v)
+	}
+	if _, err := RunMigrations(db, migrations, 2, false); err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if v := ReadSchemaVersion(db); v != 2 || countPrefix(db, "c-") != 10 {
+		t.Fatalf("upgrade mismatch: version %d", v)
+	}
+	if ReadMigrationMarker(db) != nil {
+		t.Fatal("migration marker left behind")
+	}
+	// Nothing to do at the target version
+	if reports, err := RunMigrations(db, migrations, 2, false); err != nil || len(reports) != 0 {
+		t.Fatalf("unexpected migrations: %v, %v", reports, err)
+	}
+	// Roll all the way back
+	reports, err = RunMigrations(db, migrations, 0, false)
+	if err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if len(reports) != 2 || !reports[0].Rollback || reports[0].Version != 2 {
+		t.Fatalf("rollback reports mismatch: %+v", reports[0])
+	}
+	if v := ReadSchemaVersion(db); v != 0 || countPrefix(db, "a-") != 10 {
+		t.Fatalf("rollback mismatch: version %d", v)
+	}
+}
+
+func TestMigrationResume(t *testing.T) {
+	var (
+		db    = newMigrationTestDB()
+		fail  = true
+		first = renameMigration(1, "a-", "b-")
+		up    = first.Up
+	)
+	first.Up = func(op *MigrationOp) error {
+		if err := up(op); err != nil {
+			return err
+		}
+		if fail {
+			op.flush()
+			return errors.New("interrupted")
+		}
+		return nil
+	}
+	migrations := []Migration{first, renameMigration(2, "b-", "c-")}
+
+	if _, err := RunMigrations(db, migrations, 2, false); err == nil {
+		t.Fatal("interrupted migration succeeded")
+	}
+	if v := ReadSchemaVersion(db); v != 0 {
+		t.Fatalf("schema version advanced to %d", v)
+	}
+	marker := ReadMigrationMarker(db)
+	if marker == nil || marker.From != 0 || marker.To != 1 || marker.Rollback() {
+		t.Fatalf("migration marker mismatch: %+v", marker)
+	}
+	// The interrupted migration is completed before the rest
+	fail = false
+	reports, err := RunMigrations(db, migrations, 2, false)
+	if err != nil {
+		t.Fatalf("resumed migration failed: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Version != 1 {
+		t.Fatalf("resumed reports mismatch: %+v", reports)
+	}
+	if v := ReadSchemaVersion(db); v != 2 || countPrefix(db, "c-") != 10 || ReadMigrationMarker(db) != nil {
+		t.Fatalf("resumed migration mismatch: version %d", v)
+	}
+}
+
+func TestMigrationErrors(t *testing.T) {
+	db := newMigrationTestDB()
+
+	// Versions must be consecutive
+	if _, err := RunMigrations(db, []Migration{renameMigration(2, "a-", "b-")}, 0, false); err == nil {
+		t.Error("non-consecutive migrations accepted")
+	}
+	// Targets must be known
+	migrations := []Migration{renameMigration(1, "a-", "b-")}
+	if _, err := RunMigrations(db, migrations, 2, false); err == nil {
+		t.Error("unknown target accepted")
+	}
+	// Migrations without a rollback can't be reverted
+	migrations[0].Down = nil
+	if _, err := RunMigrations(db, migrations, 1, false); err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if _, err := RunMigrations(db, migrations, 0, false); err == nil {
+		t.Error("irreversible migration rolled back")
+	}
+	if v := ReadSchemaVersion(db); v != 1 {
+		t.Errorf("schema version changed to %d", v)
+	}
+	// Databases newer than the migrations are refused
+	WriteSchemaVersion(db, 5)
+	if _, err := RunMigrations(db, migrations, 1, false); err == nil {
+		t.Error("newer database schema accepted")
+	}
+	if enc, _ := db.Get(schemaVersionKey); !bytes.Equal(enc, encodeBlockNumber(5)) {
+		t.Errorf("schema version overwritten")
+	}
+}
+
+// newChainMigrationTestDB creates a database holding a short canonical header
+// chain, the way a node stores it.
+func newChainMigrationTestDB() ethdb.Database {
+	db := NewMemoryDatabase()
+	parent := common.Hash{}
+	for i := uint64(0); i < 10; i++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(i), ParentHash: parent, Extra: []byte("migration")}
+		WriteHeader(db, header)
+		WriteCanonicalHash(db, header.Hash(), i)
+		WriteTd(db, header.Hash(), i, new(big.Int).SetUint64(i+1))
+		parent = header.Hash()
+	}
+	WriteHeadHeaderHash(db, parent)
+	return db
+}
+
+// snapshotMigrationTestDB collects the content of a database apart from the
+// schema version, which legitimately changes across a round trip.
+func snapshotMigrationTestDB(db ethdb.Iteratee) map[string]string {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	content := make(map[string]string)
+	for it.Next() {
+		if !bytes.Equal(it.Key(), schemaVersionKey) {
+			content[string(it.Key())] = string(it.Value())
+		}
+	}
+	return content
+}
+
+// Tests that a migration step rewriting real chain data can be applied and
+// rolled back, leaving the database exactly as it was.
+func TestMigrationChainData(t *testing.T) {
+	var (
+		db         = newChainMigrationTestDB()
+		snapshot   = snapshotMigrationTestDB(db)
+		head       = ReadHeadHeaderHash(db)
+		migrations = []Migration{renameMigration(1, string(headerPrefix), "migrated-"+string(headerPrefix))}
+	)
+	if _, err := RunMigrations(db, migrations, 1, false); err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if header := ReadHeader(db, head, 9); header != nil {
+		t.Fatalf("header still readable from the old schema")
+	}
+	if hash := ReadCanonicalHash(db, 9); hash != (common.Hash{}) {
+		t.Fatalf("canonical hash still readable from the old schema")
+	}
+	if _, err := RunMigrations(db, migrations, 0, false); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if header := ReadHeader(db, head, 9); header == nil || header.Hash() != head {
+		t.Fatalf("head header not restored")
+	}
+	if content := snapshotMigrationTestDB(db); !reflect.DeepEqual(content, snapshot) {
+		t.Fatalf("database content changed across the round trip: have %d entries, want %d", len(content), len(snapshot))
+	}
+}
+
+// Tests that the shipped schema migrations are well formed and round trip on a
+// chain database, so every step added to them is exercised against real data.
+func TestSchemaMigrations(t *testing.T) {
+	if err := ValidateMigrations(SchemaMigrations); err != nil {
+		t.Fatalf("invalid schema migrations: %v", err)
+	}
+	var (
+		db       = newChainMigrationTestDB()
+		snapshot = snapshotMigrationTestDB(db)
+		latest   = LatestSchemaVersion(SchemaMigrations)
+	)
+	if _, err := RunMigrations(db, SchemaMigrations, latest, false); err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if version := ReadSchemaVersion(db); version != latest {
+		t.Fatalf("schema version mismatch: have %d, want %d", version, latest)
+	}
+	// Steps without a rollback can only be checked up to the upgrade
+	for _, migration := range SchemaMigrations {
+		if migration.Down == nil {
+			return
+		}
+	}
+	if _, err := RunMigrations(db, SchemaMigrations, 0, false); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if content := snapshotMigrationTestDB(db); !reflect.DeepEqual(content, snapshot) {
+		t.Fatalf("database content changed across the round trip: have %d entries, want %d", len(content), len(snapshot))
+	}
+}
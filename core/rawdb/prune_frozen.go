@@ -0,0 +1,331 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// frozenHashChunk is the number of consecutive canonical hashes retrieved from
+	// the ancient store at once while pruning.
+	frozenHashChunk = 1024
+
+	// frozenHashChunks is the number of chunks of canonical hashes kept in memory
+	// while pruning.
+	frozenHashChunks = 1024
+
+	// frozenPruneLogInterval is the time between two progress logs of a prune.
+	frozenPruneLogInterval = 8 * time.Second
+)
+
+// FrozenPruneStats counts the key-value entries of a category pruned, or that
+// would be pruned in a dry run.
+type FrozenPruneStats struct {
+	Entries uint64 `json:"entries"`
+	Bytes   uint64 `json:"bytes"` // Size of the keys and values
+}
+
+// add counts an entry of the given key and value.
+func (s *FrozenPruneStats) add(key, value []byte) {
+	s.Entries++
+	s.Bytes += uint64(len(key) + len(value))
+}
+
+// FrozenPruneReport is the outcome of a prune of the key-value entries made
+// redundant by the ancient store.
+type FrozenPruneReport struct {
+	DryRun        bool             `json:"dryRun"`
+	Frozen        uint64           `json:"frozen"`        // Number of frozen blocks when the prune started
+	Blocks        FrozenPruneStats `json:"blocks"`        // Headers, bodies, receipts, difficulties and canonical hashes at frozen heights
+	HeaderNumbers FrozenPruneStats `json:"headerNumbers"` // Hash to number mappings of side chain blocks at frozen heights
+	Supplies      FrozenPruneStats `json:"supplies"`      // Supply entries of side chain blocks at frozen heights
+	TxLookups     FrozenPruneStats `json:"txLookups"`     // Lookups of unindexed, pruned or side chain frozen transactions
+	Elapsed       string           `json:"elapsed"`
+}
+
+// Total returns the number of entries and bytes of all the categories.
+func (r *FrozenPruneReport) Total() FrozenPruneStats {
+	var total FrozenPruneStats
+	for _, stats := range []FrozenPruneStats{r.Blocks, r.HeaderNumbers, r.Supplies, r.TxLookups} {
+		total.Entries += stats.Entries
+		total.Bytes += stats.Bytes
+	}
+	return total
+}
+
+// frozenPruner walks the key-value store, deleting the entries of the blocks
+// already frozen that the ancient store makes redundant.
+type frozenPruner struct {
+	db     ethdb.Database
+	report *FrozenPruneReport
+	batch  ethdb.Batch
+	hashes *lru.Cache // Chunks of canonical hashes of frozen blocks, keyed by first number
+
+	txTail      uint64 // Number of the first block with indexed transactions
+	historyTail uint64 // Number of the first block with retained body and receipts
+	logged      time.Time
+}
+
+// canonical retrieves the canonical hash of a frozen block from the ancient
+// store, reporting whether it is available there.
+func (p *frozenPruner) canonical(number uint64) (common.Hash, bool) {
+	if number == 0 || number >= p.report.Frozen {
+		return common.Hash{}, false
+	}
+	first := number - number%frozenHashChunk
+	if chunk, ok := p.hashes.Get(first); ok {
+		blobs := chunk.([][]byte)
+		if n := number - first; n < uint64(len(blobs)) && len(blobs[n]) == common.HashLength {
+			return common.BytesToHash(blobs[n]), true
+		}
+		return common.Hash{}, false
+	}
+	count := uint64(frozenHashChunk)
+	if first+count > p.report.Frozen {
+		count = p.report.Frozen - first
+	}
+	var blobs [][]byte
+	if ranger, ok := p.db.(AncientRanger); ok {
+		blobs, _ = ranger.AncientRange(freezerHashTable, first, count, count*common.HashLength)
+	}
+	// Fall back to item by item retrievals if ranges are unsupported or partial
+	for n := uint64(len(blobs)); n < count; n++ {
+		blob, err := p.db.Ancient(freezerHashTable, first+n)
+		if err != nil {
+			break
+		}
+		blobs = append(blobs, blob)
+	}
+	p.hashes.Add(first, blobs)
+	if n := number - first; n < uint64(len(blobs)) && len(blobs[n]) == common.HashLength {
+		return common.BytesToHash(blobs[n]), true
+	}
+	return common.Hash{}, false
+}
+
+// prune counts an entry into the stats and deletes it unless in a dry run.
+func (p *frozenPruner) prune(stats *FrozenPruneStats, key, value []byte) error {
+	stats.add(key, value)
+	if time.Since(p.logged) > frozenPruneLogInterval {
+		total := p.report.Total()
+		log.Info("Pruning frozen chain entries", "dryrun", p.report.DryRun, "entries", total.Entries, "size", common.StorageSize(total.Bytes))
+		p.logged = time.Now()
+	}
+	if p.report.DryRun {
+		return nil
+	}
+	if err := p.batch.Delete(common.CopyBytes(key)); err != nil {
+		return err
+	}
+	if p.batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := p.batch.Write(); err != nil {
+			return err
+		}
+		p.batch.Reset()
+	}
+	return nil
+}
+
+// pruneBlocks deletes the block data entries of the given prefix, keyed by
+// number and hash, at the frozen heights, or only the side chain ones if the
+// entries of the canonical blocks aren't held by the ancient store.
+func (p *frozenPruner) pruneBlocks(prefix []byte, stats *FrozenPruneStats, sideOnly bool) error {
+	it := p.db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) < len(prefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix) : len(prefix)+8])
+		if number >= p.report.Frozen {
+			break
+		}
+		hash, ok := p.canonical(number)
+		if !ok {
+			continue
+		}
+		if sideOnly {
+			if len(key) < len(prefix)+8+common.HashLength || bytes.Equal(key[len(prefix)+8:len(prefix)+8+common.HashLength], hash[:]) {
+				continue
+			}
+		}
+		if err := p.prune(stats, key, it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// pruneHeaderNumbers deletes the hash to number mappings of the side chain
+// blocks at the frozen heights.
+func (p *frozenPruner) pruneHeaderNumbers() error {
+	it := p.db.NewIterator(headerNumberPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if len(key) != len(headerNumberPrefix)+common.HashLength || len(value) != 8 {
+			continue
+		}
+		hash, ok := p.canonical(binary.BigEndian.Uint64(value))
+		if !ok || bytes.Equal(key[len(headerNumberPrefix):], hash[:]) {
+			continue
+		}
+		if err := p.prune(&p.report.HeaderNumbers, key, value); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// pruneTxLookups deletes the lookup entries of the transactions of the frozen
+// blocks below the transaction index or history tails, and the ones pointing at
+// side chain or unknown blocks.
+func (p *frozenPruner) pruneTxLookups() error {
+	it := p.db.NewIterator(txLookupPrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if len(key) != len(txLookupPrefix)+common.HashLength || len(value) == 0 {
+			continue
+		}
+		var (
+			number uint64
+			block  *common.Hash
+		)
+		switch {
+		case len(value) < common.HashLength:
+			// Database v6 lookups store the block number
+			var n big.Int
+			number = n.SetBytes(value).Uint64()
+		case len(value) == common.HashLength:
+			// Database v4-v5 lookups store the block hash
+			hash := common.BytesToHash(value)
+			block = &hash
+		default:
+			// Database v3 lookups store the block hash and number
+			var entry LegacyTxLookupEntry
+			if err := rlp.DecodeBytes(value, &entry); err != nil {
+				continue
+			}
+			block = &entry.BlockHash
+		}
+		if block != nil {
+			stored := ReadHeaderNumber(p.db, *block)
+			if stored == nil {
+				// The block is gone altogether, the lookup can't be resolved anymore
+				if err := p.prune(&p.report.TxLookups, key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			number = *stored
+		}
+		if number >= p.report.Frozen {
+			continue
+		}
+		stale := number < p.txTail || number < p.historyTail
+		if block != nil && !stale {
+			hash, ok := p.canonical(number)
+			stale = ok && hash != *block
+		}
+		if !stale {
+			continue
+		}
+		if err := p.prune(&p.report.TxLookups, key, value); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// PruneFrozen deletes the key-value entries of the blocks already frozen that
+// the ancient store makes redundant: the headers, bodies, receipts, difficulties
+// and canonical hashes left over at the frozen heights, the hash to number
+// mappings and supply entries of the side chain blocks there, and the stale
+// transaction lookups. Only the heights whose canonical hash is readable from
+// the ancient store are pruned, the genesis block being always retained. In a
+// dry run, the entries are only counted, to report the reclaimable space.
+//
+// Once done, the pruned key ranges are compacted to reclaim the space.
+func PruneFrozen(db ethdb.Database, dryRun bool) (*FrozenPruneReport, error) {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return nil, err
+	}
+	hashes, _ := lru.New(frozenHashChunks)
+	p := &frozenPruner{
+		db:     db,
+		report: &FrozenPruneReport{DryRun: dryRun, Frozen: frozen},
+		batch:  db.NewBatch(),
+		hashes: hashes,
+		logged: time.Now(),
+	}
+	if tail := ReadTxIndexTail(db); tail != nil {
+		p.txTail = *tail
+	}
+	if tail := ReadHistoryTail(db); tail != nil {
+		p.historyTail = *tail
+	}
+	start := time.Now()
+	if frozen > 1 {
+		for _, prefix := range [][]byte{headerPrefix, blockBodyPrefix, blockReceiptsPrefix} {
+			if err := p.pruneBlocks(prefix, &p.report.Blocks, false); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.pruneBlocks(supplyPrefix, &p.report.Supplies, true); err != nil {
+			return nil, err
+		}
+		if err := p.pruneHeaderNumbers(); err != nil {
+			return nil, err
+		}
+		if err := p.pruneTxLookups(); err != nil {
+			return nil, err
+		}
+	}
+	if !dryRun {
+		if err := p.batch.Write(); err != nil {
+			return nil, err
+		}
+		if p.report.Total().Entries > 0 {
+			for _, prefix := range [][]byte{headerPrefix, headerNumberPrefix, blockBodyPrefix, blockReceiptsPrefix, supplyPrefix, txLookupPrefix} {
+				if err := db.Compact(prefix, []byte{prefix[0] + 1}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	p.report.Elapsed = common.PrettyDuration(time.Since(start)).String()
+
+	total := p.report.Total()
+	log.Info("Pruned frozen chain entries", "dryrun", dryRun, "frozen", frozen, "entries", total.Entries, "size", common.StorageSize(total.Bytes), "elapsed", p.report.Elapsed)
+	return p.report, nil
+}
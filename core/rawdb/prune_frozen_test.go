@@ -0,0 +1,154 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/ancient-store-mem/lib"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that pruning the frozen chain entries deletes the key-value data the
+// ancient store makes redundant, and that dry runs only count it.
+func TestPruneFrozen(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("freezer", lib.NewMemFreezerRemoteServerAPI()); err != nil {
+		t.Fatal(err)
+	}
+	remote := &FreezerRemoteClient{client: rpc.DialInProc(server), quit: make(chan struct{}), journal: openRemoteJournal(NewMemoryDatabase())}
+	db := &freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: remote}
+
+	// Freeze 10 blocks, leaving their canonical and side chain entries around
+	var canon, side []*types.Header
+	for i := 0; i < 12; i++ {
+		canon = append(canon, &types.Header{Number: big.NewInt(int64(i)), Difficulty: big.NewInt(1)})
+		side = append(side, &types.Header{Number: big.NewInt(int64(i)), Difficulty: big.NewInt(1), Extra: []byte("side")})
+
+		for _, header := range []*types.Header{canon[i], side[i]} {
+			if i == 0 && header == side[i] {
+				continue
+			}
+			WriteHeader(db, header)
+			WriteTd(db, header.Hash(), uint64(i), big.NewInt(1))
+			db.Put(supplyKey(uint64(i), header.Hash()), []byte{0x01})
+		}
+		WriteCanonicalHash(db, canon[i].Hash(), uint64(i))
+		WriteBody(db, canon[i].Hash(), uint64(i), &types.Body{})
+
+		if i < 10 {
+			blob, _ := rlp.EncodeToBytes(canon[i])
+			if err := remote.AppendAncient(uint64(i), canon[i].Hash().Bytes(), blob, []byte{0xc2, 0xc0, 0xc0}, []byte{0xc0}, []byte{0x01}); err != nil {
+				t.Fatalf("append failed: %v", err)
+			}
+		}
+	}
+	// Index transactions from block 5 on, with some stale lookups
+	WriteTxIndexTail(db, 5)
+	lookups := map[common.Hash][]byte{
+		common.HexToHash("0xa"): big.NewInt(3).Bytes(),              // Below the index tail
+		common.HexToHash("0xb"): big.NewInt(7).Bytes(),              // Canonical
+		common.HexToHash("0xc"): side[6].Hash().Bytes(),             // Side chain
+		common.HexToHash("0xd"): common.HexToHash("0xdead").Bytes(), // Unknown block
+		common.HexToHash("0xe"): canon[8].Hash().Bytes(),            // Canonical
+		common.HexToHash("0xf"): big.NewInt(11).Bytes(),             // Not frozen
+	}
+	for hash, value := range lookups {
+		db.Put(txLookupKey(hash), value)
+	}
+	check := func(report *FrozenPruneReport) {
+		t.Helper()
+		if report.Frozen != 10 {
+			t.Fatalf("frozen mismatch: have %d, want 10", report.Frozen)
+		}
+		for name, have := range map[string]uint64{
+			"blocks":        report.Blocks.Entries,
+			"headerNumbers": report.HeaderNumbers.Entries,
+			"supplies":      report.Supplies.Entries,
+			"txLookups":     report.TxLookups.Entries,
+		} {
+			want := map[string]uint64{"blocks": 9 * 6, "headerNumbers": 9, "supplies": 9, "txLookups": 3}[name]
+			if have != want {
+				t.Fatalf("%s entries mismatch: have %d, want %d", name, have, want)
+			}
+		}
+		if report.Total().Bytes == 0 {
+			t.Fatal("no reclaimable space reported")
+		}
+	}
+	// Dry runs don't delete anything
+	report, err := PruneFrozen(db, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	check(report)
+	if has, _ := db.KeyValueStore.Has(headerKey(3, side[3].Hash())); !has {
+		t.Fatal("side chain header deleted in a dry run")
+	}
+	report, err = PruneFrozen(db, false)
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	check(report)
+
+	for i := 0; i < 12; i++ {
+		number, frozen := uint64(i), i > 0 && i < 10
+		if has, _ := db.KeyValueStore.Has(headerKey(number, canon[i].Hash())); has == frozen {
+			t.Fatalf("block #%d: canonical header retained: %v", i, has)
+		}
+		if has, _ := db.KeyValueStore.Has(blockBodyKey(number, canon[i].Hash())); has == frozen {
+			t.Fatalf("block #%d: canonical body retained: %v", i, has)
+		}
+		if has, _ := db.KeyValueStore.Has(headerHashKey(number)); has == frozen {
+			t.Fatalf("block #%d: canonical hash retained: %v", i, has)
+		}
+		if ReadHeaderNumber(db, canon[i].Hash()) == nil {
+			t.Fatalf("block #%d: canonical hash to number mapping deleted", i)
+		}
+		if has, _ := db.KeyValueStore.Has(supplyKey(number, canon[i].Hash())); !has {
+			t.Fatalf("block #%d: canonical supply deleted", i)
+		}
+		if ReadCanonicalHash(db, number) != canon[i].Hash() || ReadHeader(db, canon[i].Hash(), number) == nil {
+			t.Fatalf("block #%d: canonical header unreadable", i)
+		}
+		if i == 0 {
+			continue
+		}
+		if has := ReadHeaderNumber(db, side[i].Hash()) != nil; has == frozen {
+			t.Fatalf("block #%d: side chain hash to number mapping retained: %v", i, has)
+		}
+		if has, _ := db.KeyValueStore.Has(headerKey(number, side[i].Hash())); has == frozen {
+			t.Fatalf("block #%d: side chain header retained: %v", i, has)
+		}
+	}
+	for hash, want := range map[common.Hash]bool{
+		common.HexToHash("0xa"): false, common.HexToHash("0xb"): true, common.HexToHash("0xc"): false,
+		common.HexToHash("0xd"): false, common.HexToHash("0xe"): true, common.HexToHash("0xf"): true,
+	} {
+		if has, _ := db.KeyValueStore.Has(txLookupKey(hash)); has != want {
+			t.Fatalf("lookup %x: retained %v, want %v", hash, has, want)
+		}
+	}
+	// Nothing is left to prune afterwards
+	if report, err = PruneFrozen(db, true); err != nil || report.Total().Entries != 0 {
+		t.Fatalf("entries left after pruning: %+v, %v", report, err)
+	}
+}
@@ -20,8 +20,12 @@ package rawdb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/metrics"
 )
 
@@ -45,18 +49,57 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// stateSyncProgressKey tracks the progress counters of the fast sync state
+	// download, along with the state root it targets.
+	stateSyncProgressKey = []byte("StateSyncProgress")
+
 	// snapshotRootKey tracks the hash of the last snapshot.
 	snapshotRootKey = []byte("SnapshotRoot")
 
 	// snapshotJournalKey tracks the in-memory diff layers across restarts.
 	snapshotJournalKey = []byte("SnapshotJournal")
 
+	// snapshotAccessProfileKey tracks the accounts recently read from the snapshot,
+	// to preload into the caches after a restart.
+	snapshotAccessProfileKey = []byte("SnapshotAccessProfile")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// remoteAncientsKey tracks the number of items moved into a remote ancient store.
+	remoteAncientsKey = []byte("RemoteAncients")
+
+	// shutdownMarkerKey tracks whether the last shutdown flushed the chain state.
+	shutdownMarkerKey = []byte("ShutdownMarker")
+
+	// balanceIndexTailKey tracks the oldest block whose balance changes are indexed.
+	balanceIndexTailKey = []byte("BalanceIndexTail")
+
+	// firehoseCursorKey tracks the last block published by the chain event firehose.
+	firehoseCursorKey = []byte("FirehoseCursor")
+
+	// historyTailKey tracks the oldest block whose body and receipts are retained.
+	historyTailKey = []byte("HistoryTail")
+
+	// receiptVerificationKey tracks the progress of verifying the receipts of the
+	// blocks imported without execution by fast sync.
+	receiptVerificationKey = []byte("ReceiptVerification")
+
+	// schemaVersionKey tracks the version of the key schema, advanced by migrations.
+	schemaVersionKey = []byte("SchemaVersion")
+
+	// schemaMigrationKey tracks the schema migration in progress, if any.
+	schemaMigrationKey = []byte("SchemaMigration")
+
+	// ancientMirrorKey tracks the range of remote ancient blocks mirrored locally.
+	ancientMirrorKey = []byte("AncientMirror")
+
+	// setHeadJournalKey tracks the chain rewind in progress, if any.
+	setHeadJournalKey = []byte("SetHeadJournal")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -71,12 +114,24 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	codePrefix            = []byte("c") // codePrefix + code hash -> account code
-
-	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
-	ConfigPrefix   = []byte("ethereum-config-") // config prefix for the db
+	uncleMinerPrefix      = []byte("u") // uncleMinerPrefix + miner + num (uint64 big endian) + hash + uncle index (uint8) -> uncle hash
+	supplyPrefix          = []byte("m") // supplyPrefix + num (uint64 big endian) + hash -> cumulative supply
+	balancePrefix         = []byte("M") // balancePrefix + address + num (uint64 big endian) + hash -> balance after the block
+	contractPrefix        = []byte("C") // contractPrefix + address + num (uint64 big endian) + hash -> contract creation
+	codeHashPrefix        = []byte("X") // codeHashPrefix + code hash + address + num (uint64 big endian) + hash -> nil
+	tokenTransferPrefix   = []byte("q") // tokenTransferPrefix + address + num (uint64 big endian) + hash + log index (uint32 big endian) -> token transfer
+	tokenHoldingPrefix    = []byte("Q") // tokenHoldingPrefix + holder + token -> nil
+	tokenHolderPrefix     = []byte("G") // tokenHolderPrefix + token + holder -> nil
+
+	preimagePrefix        = []byte("secure-key-")      // preimagePrefix + hash -> preimage
+	ConfigPrefix          = []byte("ethereum-config-") // config prefix for the db
+	installedFilterPrefix = []byte("filter-")          // installedFilterPrefix + filter id -> installed RPC filter
+	ancientMirrorPrefix   = []byte("ancient-mirror-")  // ancientMirrorPrefix + kind + num (uint64 big endian) -> mirrored ancient item
+	remoteJournalPrefix   = []byte("ancient-journal-") // remoteJournalPrefix + num (uint64 big endian) -> block journaled for the remote freezer
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	UncleIndexPrefix     = []byte("iU") // UncleIndexPrefix is the data table of the uncle indexer to track its progress
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -220,6 +275,61 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// uncleMinerKey = uncleMinerPrefix + miner + num (uint64 big endian) + hash + uncle index (uint8)
+func uncleMinerKey(miner common.Address, number uint64, hash common.Hash, index int) []byte {
+	key := append(append(append(uncleMinerPrefix, miner.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+	return append(key, byte(index))
+}
+
+// contractKey = contractPrefix + address + num (uint64 big endian) + hash
+func contractKey(address common.Address, number uint64, hash common.Hash) []byte {
+	return append(append(append(contractPrefix, address.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// codeHashKey = codeHashPrefix + code hash + address + num (uint64 big endian) + hash
+func codeHashKey(codeHash common.Hash, address common.Address, number uint64, hash common.Hash) []byte {
+	key := append(append(codeHashPrefix, codeHash.Bytes()...), address.Bytes()...)
+	return append(append(key, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// tokenTransferKey = tokenTransferPrefix + address + num (uint64 big endian) + hash + log index (uint32 big endian)
+func tokenTransferKey(address common.Address, number uint64, hash common.Hash, index uint) []byte {
+	key := append(append(append(tokenTransferPrefix, address.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+	enc := make([]byte, 4)
+	binary.BigEndian.PutUint32(enc, uint32(index))
+	return append(key, enc...)
+}
+
+// tokenHoldingKey = tokenHoldingPrefix + holder + token
+func tokenHoldingKey(holder, token common.Address) []byte {
+	return append(append(tokenHoldingPrefix, holder.Bytes()...), token.Bytes()...)
+}
+
+// tokenHolderKey = tokenHolderPrefix + token + holder
+func tokenHolderKey(token, holder common.Address) []byte {
+	return append(append(tokenHolderPrefix, token.Bytes()...), holder.Bytes()...)
+}
+
+// supplyKey = supplyPrefix + num (uint64 big endian) + hash
+func supplyKey(number uint64, hash common.Hash) []byte {
+	return append(append(supplyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// balanceKey = balancePrefix + address + num (uint64 big endian) + hash
+func balanceKey(address common.Address, number uint64, hash common.Hash) []byte {
+	return append(append(append(balancePrefix, address.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// ancientMirrorItemKey = ancientMirrorPrefix + kind + num (uint64 big endian)
+func ancientMirrorItemKey(kind string, number uint64) []byte {
+	return append(append(append([]byte{}, ancientMirrorPrefix...), kind...), encodeBlockNumber(number)...)
+}
+
+// remoteJournalKey = remoteJournalPrefix + num (uint64 big endian)
+func remoteJournalKey(number uint64) []byte {
+	return append(append([]byte{}, remoteJournalPrefix...), encodeBlockNumber(number)...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
@@ -243,3 +353,128 @@ func IsCodeKey(key []byte) (bool, []byte) {
 func ConfigKey(hash common.Hash) []byte {
 	return append(ConfigPrefix, hash.Bytes()...)
 }
+
+// wellKnownSingletonKeys maps the human readable names of the singleton metadata
+// keys to their raw database keys.
+var wellKnownSingletonKeys = map[string][]byte{
+	"databaseVersion":   databaseVerisionKey,
+	"headHeader":        headHeaderKey,
+	"headBlock":         headBlockKey,
+	"headFastBlock":     headFastBlockKey,
+	"lastPivot":         lastPivotKey,
+	"fastTrieProgress":  fastTrieProgressKey,
+	"stateSyncProgress": stateSyncProgressKey,
+	"snapshotRoot":      snapshotRootKey,
+	"snapshotJournal":   snapshotJournalKey,
+	"snapshotProfile":   snapshotAccessProfileKey,
+	"txIndexTail":       txIndexTailKey,
+	"fastTxLookupLimit": fastTxLookupLimitKey,
+	"remoteAncients":    remoteAncientsKey,
+	"shutdownMarker":    shutdownMarkerKey,
+	"balanceIndexTail":  balanceIndexTailKey,
+	"firehoseCursor":    firehoseCursorKey,
+	"historyTail":       historyTailKey,
+	"receiptVerify":     receiptVerificationKey,
+	"schemaVersion":     schemaVersionKey,
+	"schemaMigration":   schemaMigrationKey,
+	"setHeadJournal":    setHeadJournalKey,
+}
+
+// WellKnownKeyNames returns the names accepted by WellKnownKey, along with
+// the arguments each of them expects.
+func WellKnownKeyNames() []string {
+	names := make([]string, 0, len(wellKnownSingletonKeys)+9)
+	for name := range wellKnownSingletonKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names,
+		"header <number> <hash>",
+		"td <number> <hash>",
+		"canonical <number>",
+		"number <hash>",
+		"body <number> <hash>",
+		"receipts <number> <hash>",
+		"txlookup <hash>",
+		"code <hash>",
+		"preimage <hash>",
+	)
+}
+
+// WellKnownKey resolves a human readable key name, along with any number or hash
+// arguments it requires, into the raw database key it refers to. It is intended
+// for maintenance tooling operating on individual database entries.
+func WellKnownKey(name string, args ...string) ([]byte, error) {
+	if key, ok := wellKnownSingletonKeys[name]; ok {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("key %q takes no arguments", name)
+		}
+		return common.CopyBytes(key), nil
+	}
+	parseNumber := func(s string) (uint64, error) {
+		n, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid block number %q: %v", s, err)
+		}
+		return n, nil
+	}
+	parseHash := func(s string) (common.Hash, error) {
+		b, err := hexutil.Decode(s)
+		if err != nil || len(b) != common.HashLength {
+			return common.Hash{}, fmt.Errorf("invalid hash %q", s)
+		}
+		return common.BytesToHash(b), nil
+	}
+	switch name {
+	case "header", "td", "body", "receipts":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("key %q requires <number> <hash> arguments", name)
+		}
+		number, err := parseNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		hash, err := parseHash(args[1])
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "header":
+			return headerKey(number, hash), nil
+		case "td":
+			return headerTDKey(number, hash), nil
+		case "body":
+			return blockBodyKey(number, hash), nil
+		default:
+			return blockReceiptsKey(number, hash), nil
+		}
+	case "canonical":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("key %q requires a <number> argument", name)
+		}
+		number, err := parseNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return headerHashKey(number), nil
+	case "number", "txlookup", "code", "preimage":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("key %q requires a <hash> argument", name)
+		}
+		hash, err := parseHash(args[0])
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "number":
+			return headerNumberKey(hash), nil
+		case "txlookup":
+			return txLookupKey(hash), nil
+		case "code":
+			return codeKey(hash), nil
+		default:
+			return preimageKey(hash), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key name %q", name)
+}
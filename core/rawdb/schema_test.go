@@ -0,0 +1,73 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestWellKnownKey(t *testing.T) {
+	hash := common.HexToHash("0xdeadbeef")
+
+	tests := []struct {
+		name string
+		args []string
+		want []byte
+	}{
+		{"headHeader", nil, headHeaderKey},
+		{"snapshotRoot", nil, snapshotRootKey},
+		{"header", []string{"42", hash.Hex()}, headerKey(42, hash)},
+		{"td", []string{"0x2a", hash.Hex()}, headerTDKey(42, hash)},
+		{"canonical", []string{"42"}, headerHashKey(42)},
+		{"number", []string{hash.Hex()}, headerNumberKey(hash)},
+		{"body", []string{"42", hash.Hex()}, blockBodyKey(42, hash)},
+		{"receipts", []string{"42", hash.Hex()}, blockReceiptsKey(42, hash)},
+		{"txlookup", []string{hash.Hex()}, txLookupKey(hash)},
+		{"code", []string{hash.Hex()}, codeKey(hash)},
+		{"preimage", []string{hash.Hex()}, preimageKey(hash)},
+	}
+	for _, tt := range tests {
+		key, err := WellKnownKey(tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(key, tt.want) {
+			t.Errorf("%s: key mismatch: have %x, want %x", tt.name, key, tt.want)
+		}
+	}
+	// Make sure malformed requests are rejected
+	failures := []struct {
+		name string
+		args []string
+	}{
+		{"unknown", nil},
+		{"headHeader", []string{"1"}},
+		{"header", []string{"42"}},
+		{"header", []string{"x", hash.Hex()}},
+		{"txlookup", []string{"0x1234"}},
+		{"canonical", nil},
+	}
+	for _, tt := range failures {
+		if key, err := WellKnownKey(tt.name, tt.args...); err == nil {
+			t.Errorf("%s %v: expected error, got key %x", tt.name, tt.args, key)
+		}
+	}
+}
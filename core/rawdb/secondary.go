@@ -0,0 +1,193 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultSecondaryCatchup is the default interval between two catch-ups of a
+// secondary database with the writes of the primary process.
+const DefaultSecondaryCatchup = 3 * time.Second
+
+// secondarydb is a database opened read-only as the secondary instance of the
+// chain database of another process, catching up with its writes periodically.
+type secondarydb struct {
+	ethdb.KeyValueStore
+	ethdb.AncientStore
+
+	kv      *leveldb.Secondary
+	freezer *freezer // Local freezer to refresh, nil if the ancient store is remote
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewLevelDBDatabaseSecondary opens the persistent key-value database in file
+// and its chain freezer, both written by another process, read-only as a
+// secondary instance catching up with the writes of the primary process every
+// given interval.
+//
+// The key-value database is mirrored into the given directory, which must be on
+// the same file system, see leveldb.NewSecondary. The ancient store is either
+// the local freezer in the freezer directory, opened without locking it, or the
+// remote one at freezerURL, if not empty, which is left open on close.
+func NewLevelDBDatabaseSecondary(file string, mirror string, cache int, handles int, freezer string, freezerURL string, namespace string, options *FreezerOptions, interval time.Duration) (ethdb.Database, error) {
+	kv, err := leveldb.NewSecondary(file, mirror, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	db := &secondarydb{
+		KeyValueStore: kv,
+		kv:            kv,
+		quit:          make(chan struct{}),
+	}
+	if freezerURL != "" {
+		client, err := rpc.Dial(freezerURL)
+		if err != nil {
+			kv.Close()
+			return nil, err
+		}
+		db.AncientStore = &secondaryRemoteAncients{&FreezerRemoteClient{
+			client:    client,
+			threshold: options.threshold(),
+			recheck:   options.recheckInterval(),
+			quit:      make(chan struct{}),
+			trigger:   make(chan chan struct{}),
+			gate:      newFreezeGate(),
+		}}
+	} else {
+		if db.freezer, err = newSecondaryFreezer(freezer, namespace, options); err != nil {
+			kv.Close()
+			return nil, err
+		}
+		db.AncientStore = db.freezer
+	}
+	if kvgenesis, _ := kv.Get(headerHashKey(0)); len(kvgenesis) > 0 {
+		if frozen, _ := db.Ancients(); frozen > 0 {
+			if frgenesis, err := db.Ancient(freezerHashTable, 0); err != nil || !bytes.Equal(frgenesis, kvgenesis) {
+				db.AncientStore.Close()
+				kv.Close()
+				return nil, fmt.Errorf("genesis mismatch: %#x (leveldb) != %#x (ancients)", kvgenesis, frgenesis)
+			}
+		}
+	}
+	if interval == 0 {
+		interval = DefaultSecondaryCatchup
+	}
+	db.wg.Add(1)
+	go db.loop(interval)
+
+	log.Info("Opened secondary chain database", "primary", file, "catchup", interval)
+	return db, nil
+}
+
+// loop catches up with the writes of the primary process periodically.
+func (db *secondarydb) loop(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.Catchup(); err != nil {
+				log.Warn("Failed to catch up with the primary database", "err", err)
+			}
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+// Catchup makes the writes done so far by the primary process visible.
+func (db *secondarydb) Catchup() error {
+	// The primary deletes the frozen blocks from the key-value store after they
+	// are in the freezer, so catching up with the key-value store first doesn't
+	// leave a gap between them
+	if err := db.kv.Catchup(); err != nil {
+		return err
+	}
+	if db.freezer != nil {
+		return db.freezer.refresh()
+	}
+	return nil
+}
+
+// Close stops catching up with the primary process and closes both the key-value
+// store and the ancient store.
+func (db *secondarydb) Close() error {
+	var errs []error
+	db.once.Do(func() {
+		close(db.quit)
+		db.wg.Wait()
+
+		if err := db.AncientStore.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := db.KeyValueStore.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) != 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// secondaryRemoteAncients is a remote ancient store accessed by a secondary
+// database, refusing writes and leaving the remote store open on close.
+type secondaryRemoteAncients struct {
+	*FreezerRemoteClient
+}
+
+// AppendAncient returns an error as secondary databases are read-only.
+func (a *secondaryRemoteAncients) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	return errReadOnly
+}
+
+// TruncateAncients returns an error as secondary databases are read-only.
+func (a *secondaryRemoteAncients) TruncateAncients(items uint64) error {
+	return errReadOnly
+}
+
+// TruncateTail returns an error as secondary databases are read-only.
+func (a *secondaryRemoteAncients) TruncateTail(kind string, items uint64) (uint64, error) {
+	return 0, errReadOnly
+}
+
+// Sync is a noop as secondary databases are read-only.
+func (a *secondaryRemoteAncients) Sync() error {
+	return nil
+}
+
+// Close disconnects from the remote ancient store, leaving it open for the
+// primary process.
+func (a *secondaryRemoteAncients) Close() error {
+	a.client.Close()
+	return nil
+}
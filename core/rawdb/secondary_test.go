@@ -0,0 +1,120 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that a secondary database follows the key-value store and the freezer
+// written by the primary one as it catches up, including truncations.
+func TestSecondaryDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Give every body a data file of its own for the tail truncation
+	options := &FreezerOptions{FileSizes: map[string]uint32{freezerBodiesTable: 64}}
+	primary, err := NewLevelDBDatabaseWithFreezer(filepath.Join(dir, "chaindata"), 0, 0, filepath.Join(dir, "ancient"), "", options)
+	if err != nil {
+		t.Fatalf("failed to open primary: %v", err)
+	}
+	defer primary.Close()
+
+	hash := func(number uint64) common.Hash {
+		return common.BytesToHash([]byte{byte(number + 1)})
+	}
+	freeze := func(from, to uint64) {
+		for number := from; number < to; number++ {
+			blob := bytes.Repeat([]byte{byte(number)}, 40)
+			if err := primary.AppendAncient(number, hash(number).Bytes(), blob, blob, blob, blob); err != nil {
+				t.Fatalf("failed to freeze block %d: %v", number, err)
+			}
+		}
+		if err := primary.Sync(); err != nil {
+			t.Fatalf("failed to sync freezer: %v", err)
+		}
+		WriteHeadHeaderHash(primary, hash(to-1))
+	}
+	WriteCanonicalHash(primary, hash(0), 0)
+	freeze(0, 10)
+
+	secondary, err := NewLevelDBDatabaseSecondary(filepath.Join(dir, "chaindata"), filepath.Join(dir, "mirror"), 0, 0, filepath.Join(dir, "ancient"), "", "", options, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to open secondary: %v", err)
+	}
+	defer secondary.Close()
+
+	check := func(frozen uint64) {
+		t.Helper()
+		if have, _ := secondary.Ancients(); have != frozen {
+			t.Fatalf("frozen block count mismatch: have %d, want %d", have, frozen)
+		}
+		if head := ReadHeadHeaderHash(secondary); head != hash(frozen-1) {
+			t.Fatalf("head mismatch: have %x, want %x", head, hash(frozen-1))
+		}
+		if blob, err := secondary.Ancient(freezerHashTable, frozen-1); err != nil || !bytes.Equal(blob, hash(frozen-1).Bytes()) {
+			t.Fatalf("last frozen hash mismatch: have %x (%v), want %x", blob, err, hash(frozen-1))
+		}
+		if _, err := secondary.Ancient(freezerHashTable, frozen); err == nil {
+			t.Fatalf("block %d visible before being caught up with", frozen)
+		}
+	}
+	check(10)
+
+	freeze(10, 20)
+	check(10)
+	if err := secondary.(*secondarydb).Catchup(); err != nil {
+		t.Fatalf("failed to catch up: %v", err)
+	}
+	check(20)
+
+	// Discarded bodies and truncated blocks vanish from the secondary too
+	if _, err := primary.(AncientTailTruncater).TruncateTail(freezerBodiesTable, 15); err != nil {
+		t.Fatalf("failed to truncate bodies tail: %v", err)
+	}
+	if err := primary.TruncateAncients(12); err != nil {
+		t.Fatalf("failed to truncate ancients: %v", err)
+	}
+	WriteHeadHeaderHash(primary, hash(11))
+	if err := secondary.(*secondarydb).Catchup(); err != nil {
+		t.Fatalf("failed to catch up: %v", err)
+	}
+	check(12)
+	if ok, _ := secondary.HasAncient(freezerBodiesTable, 5); ok {
+		t.Fatal("discarded body still available")
+	}
+	if _, err := secondary.Ancient(freezerHeaderTable, 5); err != nil {
+		t.Fatalf("failed to retrieve retained header: %v", err)
+	}
+	// The secondary database can't be written
+	if err := secondary.AppendAncient(12, hash(12).Bytes(), nil, nil, nil, nil); err != errReadOnly {
+		t.Fatalf("append error mismatch: have %v, want %v", err, errReadOnly)
+	}
+	if err := secondary.Put(headHeaderKey, hash(12).Bytes()); err == nil {
+		t.Fatal("secondary database written")
+	}
+}
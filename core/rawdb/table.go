@@ -74,6 +74,12 @@ func (t *table) AncientSize(kind string) (uint64, error) {
 	return t.db.AncientSize(kind)
 }
 
+// AncientDatadir is a noop passthrough that just forwards the request to the
+// underlying database.
+func (t *table) AncientDatadir() (string, error) {
+	return t.db.AncientDatadir()
+}
+
 // AppendAncient is a noop passthrough that just forwards the request to the underlying
 // database.
 func (t *table) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
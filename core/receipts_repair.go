@@ -0,0 +1,66 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// CheckReceipts verifies the stored receipts of a block against the receipt root
+// and log bloom of its header, returning an error if they are missing or don't
+// match.
+func CheckReceipts(db ethdb.Reader, header *types.Header) error {
+	receipts := rawdb.ReadRawReceipts(db, header.Hash(), header.Number.Uint64())
+	if receipts == nil {
+		if header.ReceiptHash == types.EmptyRootHash {
+			return nil
+		}
+		return fmt.Errorf("receipts of block #%d [%x] missing", header.Number, header.Hash())
+	}
+	if root := types.DeriveSha(receipts, new(trie.Trie)); root != header.ReceiptHash {
+		return fmt.Errorf("receipts of block #%d [%x] corrupted: have root %x, want %x", header.Number, header.Hash(), root, header.ReceiptHash)
+	}
+	if bloom := types.CreateBloom(receipts); bloom != header.Bloom {
+		return fmt.Errorf("receipts of block #%d [%x] corrupted: log bloom mismatch", header.Number, header.Hash())
+	}
+	return nil
+}
+
+// RegenerateReceipts re-executes a block on top of the given parent state (e.g.
+// historical state or the one of a witness), returning its receipts once they're
+// verified against the receipt root of the block. The state is left as after the
+// block's execution.
+func RegenerateReceipts(chain *BlockChain, block *types.Block, statedb *state.StateDB) (types.Receipts, error) {
+	receipts, _, usedGas, err := chain.Processor().Process(block, statedb, vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if usedGas != block.GasUsed() {
+		return nil, fmt.Errorf("gas used mismatch: have %d, want %d", usedGas, block.GasUsed())
+	}
+	if root := types.DeriveSha(receipts, new(trie.Trie)); root != block.ReceiptHash() {
+		return nil, fmt.Errorf("receipt root mismatch: have %x, want %x", root, block.ReceiptHash())
+	}
+	return receipts, nil
+}
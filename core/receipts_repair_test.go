@@ -0,0 +1,94 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that damaged receipts are detected and regenerated by re-executing their
+// blocks.
+func TestRepairReceipts(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 4, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	for _, block := range blocks {
+		if err := CheckReceipts(db, block.Header()); err != nil {
+			t.Fatalf("valid receipts failed check: %v", err)
+		}
+	}
+	// Corrupt and drop the receipts of a block, ensuring both are detected
+	block := blocks[2]
+	rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), types.Receipts{})
+	if err := CheckReceipts(db, block.Header()); err == nil {
+		t.Fatalf("corrupted receipts passed check")
+	}
+	rawdb.DeleteReceipts(db, block.Hash(), block.NumberU64())
+	if err := CheckReceipts(db, block.Header()); err == nil {
+		t.Fatalf("missing receipts passed check")
+	}
+	// Regenerate them from the parent state
+	statedb, err := chain.StateAt(blocks[1].Root())
+	if err != nil {
+		t.Fatalf("failed to open parent state: %v", err)
+	}
+	receipts, err := RegenerateReceipts(chain, block, statedb)
+	if err != nil {
+		t.Fatalf("failed to regenerate receipts: %v", err)
+	}
+	rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts)
+	if err := CheckReceipts(db, block.Header()); err != nil {
+		t.Fatalf("regenerated receipts failed check: %v", err)
+	}
+	// Executing on top of the wrong state must fail
+	statedb, _ = chain.StateAt(blocks[0].Root())
+	if _, err := RegenerateReceipts(chain, block, statedb); err == nil {
+		t.Fatalf("regeneration against wrong state succeeded")
+	}
+}
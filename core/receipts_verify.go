@@ -0,0 +1,133 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// receiptVerifyBatch is the number of blocks verified between two updates of the
+// persisted verification watermark.
+const receiptVerifyBatch = 10000
+
+var receiptVerifyMismatchMeter = metrics.NewRegisteredMeter("chain/receipts/verify/mismatch", nil)
+
+// EnableReceiptVerification starts verifying in the background the receipts of
+// the blocks imported without execution by fast sync, up to and including the
+// pivot, against the receipt roots and log blooms of their headers. The last
+// verified block and the mismatches found are persisted, so the verification
+// resumes across restarts and its result can be retrieved once done.
+func (bc *BlockChain) EnableReceiptVerification() {
+	bc.wg.Add(1)
+	go func() {
+		defer bc.wg.Done()
+		bc.maintainReceiptVerification()
+	}()
+}
+
+// ReceiptVerification returns the progress of the receipt verification, nil if
+// it never ran.
+func (bc *BlockChain) ReceiptVerification() *rawdb.ReceiptVerification {
+	return rawdb.ReadReceiptVerification(bc.db)
+}
+
+// maintainReceiptVerification waits for fast sync to complete, verifying the
+// receipts of the fast synced blocks once it did.
+func (bc *BlockChain) maintainReceiptVerification() {
+	headCh := make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		if pivot := rawdb.ReadLastPivotNumber(bc.db); pivot != nil && bc.CurrentBlock().NumberU64() >= *pivot {
+			bc.verifyReceipts(*pivot)
+			return
+		}
+		select {
+		case <-headCh:
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// verifyReceipts verifies the receipts of the canonical blocks after the
+// verification watermark up to the given one, skipping the ones whose history
+// was pruned.
+func (bc *BlockChain) verifyReceipts(last uint64) {
+	progress := rawdb.ReadReceiptVerification(bc.db)
+	if progress == nil {
+		progress = new(rawdb.ReceiptVerification)
+	}
+	first := progress.Number + 1
+	if tail := bc.HistoryTail(); tail > first {
+		first = tail
+	}
+	if first > last {
+		return
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	log.Info("Verifying fast synced receipts", "from", first, "to", last)
+	for number := first; number <= last; number++ {
+		select {
+		case <-bc.quit:
+			rawdb.WriteReceiptVerification(bc.db, progress)
+			log.Info("Receipt verification interrupted", "number", progress.Number)
+			return
+		default:
+		}
+		hash := rawdb.ReadCanonicalHash(bc.db, number)
+		header := bc.GetHeader(hash, number)
+		if hash == (common.Hash{}) || header == nil {
+			log.Error("Missing header for receipt verification", "number", number)
+			return
+		}
+		if err := CheckReceipts(bc.db, header); err != nil {
+			log.Error("Fast synced receipts mismatch", "err", err)
+			receiptVerifyMismatchMeter.Mark(1)
+			if progress.Mismatches == 0 {
+				progress.FirstMismatch = number
+			}
+			progress.Mismatches++
+		}
+		progress.Number = number
+		if number%receiptVerifyBatch == 0 {
+			rawdb.WriteReceiptVerification(bc.db, progress)
+		}
+		if time.Since(logged) > statsReportLimit {
+			log.Info("Verifying fast synced receipts", "number", number, "last", last, "mismatches", progress.Mismatches, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	rawdb.WriteReceiptVerification(bc.db, progress)
+	if progress.Mismatches > 0 {
+		log.Error("Fast synced receipts failed verification", "last", last, "mismatches", progress.Mismatches, "first", progress.FirstMismatch, "elapsed", common.PrettyDuration(time.Since(start)))
+		return
+	}
+	log.Info("Verified fast synced receipts", "last", last, "elapsed", common.PrettyDuration(time.Since(start)))
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that the receipts of the blocks up to the fast sync pivot are verified in
+// the background, with mismatches recorded, and that the verification resumes
+// from its watermark.
+func TestReceiptVerification(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 6, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	rawdb.WriteLastPivotNumber(db, 4)
+	rawdb.WriteReceipts(db, blocks[2].Hash(), blocks[2].NumberU64(), types.Receipts{})
+
+	chain.EnableReceiptVerification()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if progress := chain.ReceiptVerification(); progress != nil && progress.Number == 4 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("receipt verification timed out: %+v", chain.ReceiptVerification())
+		}
+	}
+	if progress := chain.ReceiptVerification(); progress.Mismatches != 1 || progress.FirstMismatch != 3 {
+		t.Fatalf("verification mismatch: have %+v, want 1 mismatch at #3", progress)
+	}
+	// Extending the range only verifies the blocks after the watermark
+	chain.verifyReceipts(6)
+	if progress := chain.ReceiptVerification(); progress.Number != 6 || progress.Mismatches != 1 {
+		t.Fatalf("resumed verification mismatch: have %+v, want up to #6 with 1 mismatch", progress)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// secondaryEventLimit is the maximum number of blocks announced when a secondary
+// chain catches up with the primary one, only the most recent ones being
+// announced past it.
+const secondaryEventLimit = 1024
+
+// followPrimary periodically reloads the chain head written by the primary
+// process into a secondary database.
+func (bc *BlockChain) followPrimary(interval time.Duration) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bc.reloadHead()
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// reloadHead loads the chain heads written by the primary process, announcing
+// the canonical blocks the head block moved past, and the ones it dropped in a
+// reorg, as if they were inserted.
+func (bc *BlockChain) reloadHead() {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	if hash := rawdb.ReadHeadHeaderHash(bc.db); hash != bc.CurrentHeader().Hash() {
+		if header := bc.GetHeaderByHash(hash); header != nil {
+			bc.hc.SetCurrentHeader(header)
+		}
+	}
+	if hash := rawdb.ReadHeadFastBlockHash(bc.db); hash != bc.CurrentFastBlock().Hash() {
+		if block := bc.GetBlockByHash(hash); block != nil {
+			bc.currentFastBlock.Store(block)
+			headFastBlockGauge.Update(int64(block.NumberU64()))
+		}
+	}
+	current := bc.CurrentBlock()
+	hash := rawdb.ReadHeadBlockHash(bc.db)
+	if hash == (common.Hash{}) || hash == current.Hash() {
+		return
+	}
+	head := bc.GetBlockByHash(hash)
+	if head == nil {
+		log.Debug("Secondary chain head not available yet", "hash", hash)
+		return
+	}
+	// Find the blocks of the old chain dropped by a reorg, if any
+	var dropped []*types.Block
+	ancestor := current
+	for ancestor != nil && rawdb.ReadCanonicalHash(bc.db, ancestor.NumberU64()) != ancestor.Hash() && len(dropped) < secondaryEventLimit {
+		dropped = append(dropped, ancestor)
+		ancestor = bc.GetBlock(ancestor.ParentHash(), ancestor.NumberU64()-1)
+	}
+	bc.currentBlock.Store(head)
+	headBlockGauge.Update(int64(head.NumberU64()))
+
+	if len(dropped) > 0 {
+		var removed []*types.Log
+		for _, block := range dropped {
+			for _, l := range bc.blockLogs(block) {
+				l.Removed = true
+				removed = append(removed, l)
+			}
+			bc.chainSideFeed.Send(ChainSideEvent{Block: block})
+		}
+		if len(removed) > 0 {
+			bc.rmLogsFeed.Send(RemovedLogsEvent{removed})
+		}
+		log.Info("Secondary chain reorganised", "dropped", len(dropped), "number", head.Number(), "hash", head.Hash())
+	}
+	// Announce the new canonical blocks
+	first := uint64(1)
+	if ancestor != nil {
+		first = ancestor.NumberU64() + 1
+	}
+	if number := head.NumberU64(); number >= secondaryEventLimit && first <= number-secondaryEventLimit {
+		first = number - secondaryEventLimit + 1
+	}
+	for number := first; number <= head.NumberU64(); number++ {
+		block := head
+		if number != head.NumberU64() {
+			if block = bc.GetBlockByNumber(number); block == nil {
+				continue
+			}
+		}
+		logs := bc.blockLogs(block)
+		bc.chainFeed.Send(ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
+		if len(logs) > 0 {
+			bc.logsFeed.Send(logs)
+		}
+	}
+	bc.chainHeadFeed.Send(ChainHeadEvent{Block: head})
+	log.Debug("Secondary chain head reloaded", "number", head.Number(), "hash", head.Hash())
+}
+
+// blockLogs retrieves the logs generated by the transactions of a block.
+func (bc *BlockChain) blockLogs(block *types.Block) []*types.Log {
+	var logs []*types.Log
+	for _, receipt := range rawdb.ReadReceipts(bc.db, block.Hash(), block.NumberU64(), bc.chainConfig) {
+		for _, l := range receipt.Logs {
+			copied := *l
+			logs = append(logs, &copied)
+		}
+	}
+	return logs
+}
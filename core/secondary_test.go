@@ -0,0 +1,118 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that a chain opened on a secondary database follows the head of the
+// chain written by the primary process, announcing the blocks it moves past,
+// and refuses to be written.
+func TestSecondaryChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(filepath.Join(dir, "chaindata"), 0, 0, filepath.Join(dir, "ancient"), "", nil)
+	if err != nil {
+		t.Fatalf("failed to open primary database: %v", err)
+	}
+	defer db.Close()
+
+	gspec := &genesisT.Genesis{Config: params.TestChainConfig}
+	genesis := MustCommitGenesis(db, gspec)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 15, nil)
+
+	primary, err := NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true}, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create primary chain: %v", err)
+	}
+	defer primary.Stop()
+	if _, err := primary.InsertChain(blocks[:10]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	sdb, err := rawdb.NewLevelDBDatabaseSecondary(filepath.Join(dir, "chaindata"), filepath.Join(dir, "mirror"), 0, 0, filepath.Join(dir, "ancient"), "", "", nil, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to open secondary database: %v", err)
+	}
+	defer sdb.Close()
+
+	secondary, err := NewBlockChain(sdb, &CacheConfig{SecondaryCatchup: 20 * time.Millisecond}, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create secondary chain: %v", err)
+	}
+	defer secondary.Stop()
+
+	if head := secondary.CurrentBlock(); head.Hash() != blocks[9].Hash() {
+		t.Fatalf("secondary head mismatch: have #%d, want #10", head.NumberU64())
+	}
+	var (
+		chainCh = make(chan ChainEvent, 16)
+		headCh  = make(chan ChainHeadEvent, 16)
+	)
+	chainSub := secondary.SubscribeChainEvent(chainCh)
+	defer chainSub.Unsubscribe()
+	headSub := secondary.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	if _, err := primary.InsertChain(blocks[10:]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	// The secondary may catch up in the middle of the insertion
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case ev := <-headCh:
+			done = ev.Block.Hash() == blocks[14].Hash()
+		case <-timeout:
+			t.Fatal("secondary chain didn't follow the primary")
+		}
+	}
+	for i := 10; i < 15; i++ {
+		select {
+		case ev := <-chainCh:
+			if ev.Hash != blocks[i].Hash() {
+				t.Fatalf("announced block mismatch: have #%d, want #%d", ev.Block.NumberU64(), i+1)
+			}
+		default:
+			t.Fatalf("block #%d not announced", i+1)
+		}
+	}
+	if head := secondary.CurrentBlock(); head.Hash() != blocks[14].Hash() {
+		t.Fatalf("secondary head mismatch: have #%d, want #15", head.NumberU64())
+	}
+	if block := secondary.GetBlockByNumber(12); block == nil || block.Hash() != blocks[11].Hash() {
+		t.Fatal("caught up block not available")
+	}
+	// Secondary chains can't be written
+	if err := secondary.SetHead(5); err != errSecondaryChain {
+		t.Fatalf("rewind error mismatch: have %v, want %v", err, errSecondaryChain)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	snapshotAuditCheckMeter    = metrics.NewRegisteredMeter("state/snapshot/audit/check", nil)
+	snapshotAuditMismatchMeter = metrics.NewRegisteredMeter("state/snapshot/audit/mismatch", nil)
+)
+
+// SnapshotAudit compares a random sample of the account and storage reads served
+// from the snapshot with the same reads from the trie, reporting the mismatches.
+// It can be shared by any number of state databases.
+//
+// A nil audit samples nothing.
+type SnapshotAudit struct {
+	rate       float64 // Fraction of the snapshot reads to check
+	checked    uint64  // Number of snapshot reads checked (atomic)
+	mismatched uint64  // Number of snapshot reads differing from the trie (atomic)
+}
+
+// NewSnapshotAudit creates an audit checking the given fraction of the snapshot
+// reads, between 0 and 1.
+func NewSnapshotAudit(rate float64) *SnapshotAudit {
+	return &SnapshotAudit{rate: rate}
+}
+
+// Rate returns the fraction of the snapshot reads checked.
+func (a *SnapshotAudit) Rate() float64 {
+	return a.rate
+}
+
+// Stats returns the number of snapshot reads checked so far, and the number of
+// those differing from the trie.
+func (a *SnapshotAudit) Stats() (checked uint64, mismatched uint64) {
+	return atomic.LoadUint64(&a.checked), atomic.LoadUint64(&a.mismatched)
+}
+
+// sample reports whether the next snapshot read is to be checked.
+func (a *SnapshotAudit) sample() bool {
+	return a != nil && a.rate > 0 && rand.Float64() < a.rate
+}
+
+// check records the outcome of checking a snapshot read, logging mismatches.
+func (a *SnapshotAudit) check(match bool, ctx ...interface{}) {
+	atomic.AddUint64(&a.checked, 1)
+	snapshotAuditCheckMeter.Mark(1)
+	if !match {
+		atomic.AddUint64(&a.mismatched, 1)
+		snapshotAuditMismatchMeter.Mark(1)
+		log.Error("Snapshot read mismatches the trie", ctx...)
+	}
+}
+
+// SetSnapshotAudit sets the audit checking the snapshot reads of the state.
+func (s *StateDB) SetSnapshotAudit(audit *SnapshotAudit) {
+	s.snapAudit = audit
+}
+
+// auditAccount checks an account read from the snapshot, nil if missing,
+// against the trie.
+func (s *StateDB) auditAccount(addr common.Address, data *Account) {
+	enc, err := s.trie.TryGet(addr.Bytes())
+	if err != nil {
+		log.Debug("Failed to audit snapshot account", "addr", addr, "err", err)
+		return
+	}
+	var want *Account
+	if len(enc) > 0 {
+		want = new(Account)
+		if err := rlp.DecodeBytes(enc, want); err != nil {
+			log.Debug("Failed to audit snapshot account", "addr", addr, "err", err)
+			return
+		}
+	}
+	match := (data == nil) == (want == nil)
+	if match && data != nil {
+		match = data.Nonce == want.Nonce && data.Balance.Cmp(want.Balance) == 0 &&
+			data.Root == want.Root && bytes.Equal(data.CodeHash, want.CodeHash)
+	}
+	s.snapAudit.check(match, "root", s.snap.Root(), "addr", addr, "snapshot", data, "trie", want)
+}
+
+// auditStorage checks a storage slot read from the snapshot against the trie.
+func (s *stateObject) auditStorage(db Database, key common.Hash, enc []byte) {
+	want, err := s.getTrie(db).TryGet(key.Bytes())
+	if err != nil {
+		log.Debug("Failed to audit snapshot storage", "addr", s.address, "key", key, "err", err)
+		return
+	}
+	s.db.snapAudit.check(bytes.Equal(enc, want), "root", s.db.snap.Root(), "addr", s.address, "key", key, "snapshot", common.Bytes2Hex(enc), "trie", common.Bytes2Hex(want))
+}
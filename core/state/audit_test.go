@@ -0,0 +1,75 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the snapshot audit detects the snapshot reads differing from the
+// trie.
+func TestSnapshotAudit(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		sdb     = NewDatabase(db)
+		good    = common.Address{0x01}
+		corrupt = common.Address{0x02}
+		key     = common.Hash{0x03}
+	)
+	state, _ := New(common.Hash{}, sdb, nil)
+	state.SetBalance(good, big.NewInt(1))
+	state.SetState(good, key, common.Hash{0x04})
+	state.SetBalance(corrupt, big.NewInt(2))
+	root, _ := state.Commit(false)
+	if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	snaps := snapshot.New(db, sdb.TrieDB(), 16, root, false)
+
+	// Corrupt an account in the snapshot only
+	rawdb.WriteAccountSnapshot(db, crypto.Keccak256Hash(corrupt[:]), snapshot.SlimAccountRLP(0, big.NewInt(3), emptyRoot, emptyCodeHash))
+
+	audit := NewSnapshotAudit(1)
+	state, _ = New(root, sdb, snaps)
+	state.SetSnapshotAudit(audit)
+
+	state.GetBalance(good)
+	state.GetState(good, key)
+	if checked, mismatched := audit.Stats(); checked != 2 || mismatched != 0 {
+		t.Fatalf("audit stats mismatch: have %d checked, %d mismatched, want 2, 0", checked, mismatched)
+	}
+	if balance := state.GetBalance(corrupt); balance.Cmp(big.NewInt(3)) != 0 {
+		t.Fatalf("corrupt snapshot not served: balance %v", balance)
+	}
+	state.GetBalance(common.Address{0x05}) // missing from both
+	if checked, mismatched := audit.Stats(); checked != 4 || mismatched != 1 {
+		t.Fatalf("audit stats mismatch: have %d checked, %d mismatched, want 4, 1", checked, mismatched)
+	}
+	// Audits with a zero rate check nothing
+	state, _ = New(root, sdb, snaps)
+	state.SetSnapshotAudit(NewSnapshotAudit(0))
+	state.GetBalance(good)
+	if checked, _ := state.snapAudit.Stats(); checked != 0 {
+		t.Fatalf("zero rate audit checked %d reads", checked)
+	}
+}
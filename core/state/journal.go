@@ -124,6 +124,7 @@ type (
 	addLogChange struct {
 		txhash common.Hash
 	}
+	addCreationChange struct{}
 	addPreimageChange struct {
 		hash common.Hash
 	}
@@ -227,6 +228,14 @@ func (ch addLogChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch addCreationChange) revert(s *StateDB) {
+	s.creations = s.creations[:len(s.creations)-1]
+}
+
+func (ch addCreationChange) dirtied() *common.Address {
+	return nil
+}
+
 func (ch addPreimageChange) revert(s *StateDB) {
 	delete(s.preimages, ch.hash)
 }
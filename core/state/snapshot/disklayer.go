@@ -34,6 +34,8 @@ type diskLayer struct {
 	triedb *trie.Database      // Trie node cache for reconstuction purposes
 	cache  *fastcache.Cache    // Cache to avoid hitting the disk for direct access
 
+	profile *AccessProfile // Tracker of the accounts read from the layer, if any
+
 	root  common.Hash // Root hash of the base snapshot
 	stale bool        // Signals that the layer became stale (state progressed)
 
@@ -98,6 +100,7 @@ func (dl *diskLayer) AccountRLP(hash common.Hash) ([]byte, error) {
 	}
 	// If we're in the disk layer, all diff layers missed
 	snapshotDirtyAccountMissMeter.Mark(1)
+	dl.profile.record(hash)
 
 	// Try to retrieve the account from the memory cache
 	if blob, found := dl.cache.HasGet(nil, hash[:]); found {
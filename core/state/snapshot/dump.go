@@ -0,0 +1,600 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+)
+
+const (
+	// StateDumpManifestFile is the name of the file describing a state dump.
+	StateDumpManifestFile = "manifest.json"
+
+	// DefaultStateDumpChunkSize is the default amount of uncompressed state data
+	// held by a chunk of a state dump.
+	DefaultStateDumpChunkSize = 16 * 1024 * 1024
+
+	// stateDumpVersion is the version of the state dump layout.
+	stateDumpVersion = 1
+
+	// stateDumpFlushItems is the number of items inserted into a trie being
+	// rebuilt from a state dump after which its nodes are flushed to disk.
+	stateDumpFlushItems = 100000
+)
+
+// Kinds of the records of a state dump.
+const (
+	dumpAccount = iota // Account in slim format, followed by its storage slots
+	dumpStorage        // Storage slot of the last account
+	dumpCode           // Contract code, preceding the first account using it
+)
+
+var (
+	// errStateDumpExists is returned if the dump target directory is not empty.
+	errStateDumpExists = errors.New("state dump directory already exists and is not empty")
+
+	// errStateDumpVersion is returned if a state dump was created by an unknown
+	// version.
+	errStateDumpVersion = errors.New("unsupported state dump version")
+
+	// errStateDumpChain is returned if a state dump was exported from another
+	// chain than the local one.
+	errStateDumpChain = errors.New("state dump of another chain")
+)
+
+// StateDumpChunk describes a single chunk file of a state dump.
+type StateDumpChunk struct {
+	Name string      `json:"name"`
+	Size int64       `json:"size"` // Size of the compressed chunk file
+	Hash common.Hash `json:"hash"` // Keccak256 hash of the uncompressed chunk
+}
+
+// StateDumpManifest describes the contents of a state dump. The commitment is
+// the root of the binary Merkle tree of the chunk hashes, so a dump can be
+// verified chunk by chunk against it.
+type StateDumpManifest struct {
+	Version uint64    `json:"version"`
+	Created time.Time `json:"created"`
+
+	Genesis common.Hash `json:"genesis"` // Genesis hash of the exporting chain
+	Root    common.Hash `json:"root"`
+	Number  uint64      `json:"number"`
+	Hash    common.Hash `json:"hash"`
+
+	Accounts uint64 `json:"accounts"`
+	Slots    uint64 `json:"slots"`
+	Codes    uint64 `json:"codes"`
+
+	Chunks     []StateDumpChunk `json:"chunks"`
+	Commitment common.Hash      `json:"commitment"`
+}
+
+// dumpRecord is a single flat state item of a state dump chunk.
+type dumpRecord struct {
+	Kind  uint8
+	Hash  common.Hash
+	Value []byte
+}
+
+// ReadStateDumpManifest loads the manifest of the state dump stored in dir.
+func ReadStateDumpManifest(dir string) (*StateDumpManifest, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, StateDumpManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(StateDumpManifest)
+	if err := json.Unmarshal(blob, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != stateDumpVersion {
+		return nil, fmt.Errorf("%w: %d", errStateDumpVersion, manifest.Version)
+	}
+	return manifest, nil
+}
+
+// ExportState writes the flat accounts, storage slots and contract codes of the
+// state of the given block into dir, which must either not exist or be empty.
+// The state is split into snappy compressed chunks of about chunkSize bytes of
+// uncompressed data, described by a manifest committing to their contents.
+func ExportState(db ethdb.Database, header *types.Header, dir string, chunkSize int) (*StateDumpManifest, error) {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, errStateDumpExists
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultStateDumpChunkSize
+	}
+	triedb := trie.NewDatabase(db)
+	accTrie, err := trie.New(header.Root, triedb)
+	if err != nil {
+		return nil, fmt.Errorf("state of block #%d not available: %v", header.Number, err)
+	}
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		return nil, errors.New("genesis block not found")
+	}
+	manifest := &StateDumpManifest{
+		Version: stateDumpVersion,
+		Created: time.Now().UTC(),
+		Genesis: genesis,
+		Root:    header.Root,
+		Number:  header.Number.Uint64(),
+		Hash:    header.Hash(),
+	}
+	var (
+		records []dumpRecord
+		size    int
+		codes   = make(map[common.Hash]struct{})
+		start   = time.Now()
+		logged  = time.Now()
+	)
+	add := func(record dumpRecord) error {
+		records = append(records, record)
+		if size += common.HashLength + len(record.Value) + 1; size < chunkSize {
+			return nil
+		}
+		err := writeStateDumpChunk(dir, manifest, records)
+		records, size = records[:0], 0
+		return err
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(nil))
+	for accIt.Next() {
+		var acc struct {
+			Nonce    uint64
+			Balance  *big.Int
+			Root     common.Hash
+			CodeHash []byte
+		}
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			return nil, fmt.Errorf("invalid account %x: %v", accIt.Key, err)
+		}
+		if codeHash := common.BytesToHash(acc.CodeHash); codeHash != emptyCode {
+			if _, ok := codes[codeHash]; !ok {
+				code := rawdb.ReadCode(db, codeHash)
+				if len(code) == 0 {
+					return nil, fmt.Errorf("missing code %x of account %x", codeHash, accIt.Key)
+				}
+				if err := add(dumpRecord{Kind: dumpCode, Hash: codeHash, Value: code}); err != nil {
+					return nil, err
+				}
+				codes[codeHash] = struct{}{}
+				manifest.Codes++
+			}
+		}
+		data := SlimAccountRLP(acc.Nonce, acc.Balance, acc.Root, acc.CodeHash)
+		if err := add(dumpRecord{Kind: dumpAccount, Hash: common.BytesToHash(accIt.Key), Value: data}); err != nil {
+			return nil, err
+		}
+		manifest.Accounts++
+
+		if acc.Root != emptyRoot {
+			storeTrie, err := trie.New(acc.Root, triedb)
+			if err != nil {
+				return nil, fmt.Errorf("storage of account %x not available: %v", accIt.Key, err)
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+			for storeIt.Next() {
+				if err := add(dumpRecord{Kind: dumpStorage, Hash: common.BytesToHash(storeIt.Key), Value: common.CopyBytes(storeIt.Value)}); err != nil {
+					return nil, err
+				}
+				manifest.Slots++
+			}
+			if storeIt.Err != nil {
+				return nil, storeIt.Err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state", "accounts", manifest.Accounts, "slots", manifest.Slots, "chunks", len(manifest.Chunks), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if accIt.Err != nil {
+		return nil, accIt.Err
+	}
+	if len(records) > 0 {
+		if err := writeStateDumpChunk(dir, manifest, records); err != nil {
+			return nil, err
+		}
+	}
+	manifest.Commitment = stateDumpCommitment(manifest.Chunks)
+
+	blob, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, StateDumpManifestFile), blob, 0644); err != nil {
+		return nil, err
+	}
+	log.Info("Exported state", "root", header.Root, "number", header.Number, "accounts", manifest.Accounts, "slots", manifest.Slots, "codes", manifest.Codes, "chunks", len(manifest.Chunks), "elapsed", common.PrettyDuration(time.Since(start)))
+	return manifest, nil
+}
+
+// writeStateDumpChunk compresses the given records into the next chunk file of
+// a state dump, adding it to the manifest.
+func writeStateDumpChunk(dir string, manifest *StateDumpManifest, records []dumpRecord) error {
+	blob, err := rlp.EncodeToBytes(records)
+	if err != nil {
+		return err
+	}
+	chunk := StateDumpChunk{
+		Name: stateDumpChunkName(len(manifest.Chunks)),
+		Hash: crypto.Keccak256Hash(blob),
+	}
+	compressed := snappy.Encode(nil, blob)
+	if err := ioutil.WriteFile(filepath.Join(dir, chunk.Name), compressed, 0644); err != nil {
+		return err
+	}
+	chunk.Size = int64(len(compressed))
+	manifest.Chunks = append(manifest.Chunks, chunk)
+	return nil
+}
+
+// stateDumpChunkName returns the file name of the chunk at the given index.
+func stateDumpChunkName(index int) string {
+	return fmt.Sprintf("chunk-%06d.snappy", index)
+}
+
+// readStateDumpChunk loads the records of the state dump chunk at the given
+// index, checking them against the hash of the chunk in the manifest. Only the
+// chunk file names written by exports are accepted, so a manifest can't point
+// outside of the dump directory.
+func readStateDumpChunk(dir string, index int, chunk StateDumpChunk) ([]dumpRecord, error) {
+	if chunk.Name != stateDumpChunkName(index) {
+		return nil, fmt.Errorf("invalid chunk name %q, want %q", chunk.Name, stateDumpChunkName(index))
+	}
+	compressed, err := ioutil.ReadFile(filepath.Join(dir, chunk.Name))
+	if err != nil {
+		return nil, err
+	}
+	blob, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s corrupted: %v", chunk.Name, err)
+	}
+	if hash := crypto.Keccak256Hash(blob); hash != chunk.Hash {
+		return nil, fmt.Errorf("chunk %s hash mismatch: have %x, want %x", chunk.Name, hash, chunk.Hash)
+	}
+	var records []dumpRecord
+	if err := rlp.DecodeBytes(blob, &records); err != nil {
+		return nil, fmt.Errorf("chunk %s corrupted: %v", chunk.Name, err)
+	}
+	return records, nil
+}
+
+// stateDumpCommitment computes the root of the binary Merkle tree of the hashes
+// of the chunks, an odd node out being carried up to the next level as is.
+func stateDumpCommitment(chunks []StateDumpChunk) common.Hash {
+	if len(chunks) == 0 {
+		return common.Hash{}
+	}
+	level := make([]common.Hash, len(chunks))
+	for i, chunk := range chunks {
+		level[i] = chunk.Hash
+	}
+	for len(level) > 1 {
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, crypto.Keccak256Hash(level[i][:], level[i+1][:]))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// VerifyStateDump checks the chunks of the state dump stored in dir against the
+// commitment of its manifest, along with the ordering of their records. The
+// state root itself is only verified on import, when the tries are rebuilt.
+func VerifyStateDump(dir string) (*StateDumpManifest, error) {
+	manifest, err := ReadStateDumpManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if commitment := stateDumpCommitment(manifest.Chunks); commitment != manifest.Commitment {
+		return nil, fmt.Errorf("commitment mismatch: have %x, want %x", commitment, manifest.Commitment)
+	}
+	check := new(dumpChecker)
+	for i, chunk := range manifest.Chunks {
+		records, err := readStateDumpChunk(dir, i, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if err := check.next(record); err != nil {
+				return nil, fmt.Errorf("chunk %s: %v", chunk.Name, err)
+			}
+		}
+	}
+	if err := check.done(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// dumpChecker verifies the ordering and the counts of the records of a state
+// dump as they are read.
+type dumpChecker struct {
+	account  *common.Hash // Last account seen
+	slot     *common.Hash // Last storage slot of the last account seen
+	accounts uint64
+	slots    uint64
+	codes    uint64
+}
+
+// next checks the next record of a state dump.
+func (c *dumpChecker) next(record dumpRecord) error {
+	switch record.Kind {
+	case dumpAccount:
+		if c.account != nil && bytes.Compare(record.Hash[:], c.account[:]) <= 0 {
+			return fmt.Errorf("account %x out of order", record.Hash)
+		}
+		if _, err := FullAccount(record.Value); err != nil {
+			return fmt.Errorf("invalid account %x: %v", record.Hash, err)
+		}
+		hash := record.Hash
+		c.account, c.slot = &hash, nil
+		c.accounts++
+
+	case dumpStorage:
+		if c.account == nil {
+			return fmt.Errorf("storage slot %x without account", record.Hash)
+		}
+		if c.slot != nil && bytes.Compare(record.Hash[:], c.slot[:]) <= 0 {
+			return fmt.Errorf("storage slot %x of account %x out of order", record.Hash, *c.account)
+		}
+		hash := record.Hash
+		c.slot = &hash
+		c.slots++
+
+	case dumpCode:
+		if hash := crypto.Keccak256Hash(record.Value); hash != record.Hash {
+			return fmt.Errorf("code hash mismatch: have %x, want %x", hash, record.Hash)
+		}
+		c.codes++
+
+	default:
+		return fmt.Errorf("unknown record kind %d", record.Kind)
+	}
+	return nil
+}
+
+// done checks the record counts of a state dump against its manifest.
+func (c *dumpChecker) done(manifest *StateDumpManifest) error {
+	if c.accounts != manifest.Accounts || c.slots != manifest.Slots || c.codes != manifest.Codes {
+		return fmt.Errorf("item count mismatch: have %d accounts, %d slots, %d codes, want %d, %d, %d",
+			c.accounts, c.slots, c.codes, manifest.Accounts, manifest.Slots, manifest.Codes)
+	}
+	return nil
+}
+
+// dumpTrie is a trie rebuilt from the sorted items of a state dump, flushed to
+// disk along the way to bound its memory use.
+type dumpTrie struct {
+	db    *trie.Database
+	trie  *trie.Trie
+	items int
+}
+
+// newDumpTrie creates an empty trie to rebuild from a state dump.
+func newDumpTrie(db *trie.Database) *dumpTrie {
+	tr, _ := trie.New(common.Hash{}, db)
+	return &dumpTrie{db: db, trie: tr}
+}
+
+// update inserts the next item into the trie.
+func (t *dumpTrie) update(key common.Hash, value []byte) error {
+	if err := t.trie.TryUpdate(key[:], value); err != nil {
+		return err
+	}
+	if t.items++; t.items >= stateDumpFlushItems {
+		_, err := t.commit()
+		return err
+	}
+	return nil
+}
+
+// commit writes the nodes of the trie to disk, returning its root. As the keys
+// are inserted in order, only the few nodes of the last path written before are
+// left unreferenced on disk.
+func (t *dumpTrie) commit() (common.Hash, error) {
+	root, err := t.trie.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := t.db.Commit(root, false, nil); err != nil {
+		return common.Hash{}, err
+	}
+	t.items = 0
+	t.trie, err = trie.New(root, t.db)
+	return root, err
+}
+
+// checkStateDumpChain checks that a state dump was exported from the local
+// chain: the genesis must match, and so must the exported block if the local
+// chain already has a canonical block at its height.
+func checkStateDumpChain(db ethdb.Reader, manifest *StateDumpManifest) error {
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		return errors.New("genesis block not found, the chain must be initialized first")
+	}
+	if genesis != manifest.Genesis {
+		return fmt.Errorf("%w: genesis mismatch: have %x, want %x", errStateDumpChain, genesis, manifest.Genesis)
+	}
+	hash := rawdb.ReadCanonicalHash(db, manifest.Number)
+	if hash == (common.Hash{}) {
+		return nil // Block not synced yet, snap sync heals to it later
+	}
+	if hash != manifest.Hash {
+		return fmt.Errorf("%w: block #%d mismatch: have %x, want %x", errStateDumpChain, manifest.Number, hash, manifest.Hash)
+	}
+	if header := rawdb.ReadHeader(db, hash, manifest.Number); header != nil && header.Root != manifest.Root {
+		return fmt.Errorf("%w: state root mismatch of block #%d: have %x, want %x", errStateDumpChain, manifest.Number, header.Root, manifest.Root)
+	}
+	return nil
+}
+
+// ImportState rebuilds the state tries of the state dump stored in dir into the
+// database, failing if they don't match the state root of the dump, along with
+// the contract codes and a complete state snapshot at the state root, replacing
+// any previous one. The dump is checked against the local chain and verified
+// chunk by chunk before the previous snapshot is dropped, only a state root
+// mismatch being detected once the tries are rebuilt.
+func ImportState(db ethdb.Database, dir string) (*StateDumpManifest, error) {
+	manifest, err := ReadStateDumpManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStateDumpChain(db, manifest); err != nil {
+		return nil, err
+	}
+	if _, err := VerifyStateDump(dir); err != nil {
+		return nil, err
+	}
+	// Drop any previous snapshot, the imported one replacing it
+	rawdb.DeleteSnapshotRoot(db)
+	if err := wipeContent(db); err != nil {
+		return nil, err
+	}
+	var (
+		triedb  = trie.NewDatabase(db)
+		accTrie = newDumpTrie(triedb)
+		batch   = db.NewBatch()
+		check   = new(dumpChecker)
+		start   = time.Now()
+		logged  = time.Now()
+
+		account   common.Hash // Account whose storage is being rebuilt
+		full      Account     // Consensus format of the account
+		storeTrie *dumpTrie
+	)
+	// finish completes the storage trie of the last account, inserting it into
+	// the account trie
+	finish := func() error {
+		if check.account == nil {
+			return nil
+		}
+		root := emptyRoot
+		if storeTrie != nil {
+			var err error
+			if root, err = storeTrie.commit(); err != nil {
+				return err
+			}
+			storeTrie = nil
+		}
+		if !bytes.Equal(root[:], full.Root) {
+			return fmt.Errorf("storage root mismatch of account %x: have %x, want %x", account, root, full.Root)
+		}
+		blob, err := rlp.EncodeToBytes(full)
+		if err != nil {
+			return err
+		}
+		return accTrie.update(account, blob)
+	}
+	for i, chunk := range manifest.Chunks {
+		records, err := readStateDumpChunk(dir, i, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.Kind == dumpAccount {
+				if err := finish(); err != nil {
+					return nil, err
+				}
+			}
+			if err := check.next(record); err != nil {
+				return nil, fmt.Errorf("chunk %s: %v", chunk.Name, err)
+			}
+			switch record.Kind {
+			case dumpAccount:
+				account = record.Hash
+				if full, err = FullAccount(record.Value); err != nil {
+					return nil, err
+				}
+				rawdb.WriteAccountSnapshot(batch, record.Hash, record.Value)
+
+			case dumpStorage:
+				if storeTrie == nil {
+					storeTrie = newDumpTrie(triedb)
+				}
+				if err := storeTrie.update(record.Hash, record.Value); err != nil {
+					return nil, err
+				}
+				rawdb.WriteStorageSnapshot(batch, account, record.Hash, record.Value)
+
+			case dumpCode:
+				rawdb.WriteCode(batch, record.Hash, record.Value)
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return nil, err
+				}
+				batch.Reset()
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state", "accounts", check.accounts, "slots", check.slots, "chunks", chunk.Name, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := check.done(manifest); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	root, err := accTrie.commit()
+	if err != nil {
+		return nil, err
+	}
+	if root != manifest.Root {
+		return nil, fmt.Errorf("state root mismatch: have %x, want %x", root, manifest.Root)
+	}
+	// The state is complete, mark the snapshot as generated
+	journal, err := rlp.EncodeToBytes(journalGenerator{Done: true, Accounts: check.accounts, Slots: check.slots})
+	if err != nil {
+		return nil, err
+	}
+	rawdb.WriteSnapshotJournal(batch, journal)
+	rawdb.WriteSnapshotRoot(batch, root)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	log.Info("Imported state", "root", root, "number", manifest.Number, "accounts", check.accounts, "slots", check.slots, "codes", check.codes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return manifest, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeDumpState creates a state with plain accounts and contracts sharing code,
+// some of them with storage, returning its root.
+func makeDumpState(t *testing.T, db ethdb.Database) common.Hash {
+	triedb := trie.NewDatabase(db)
+	accTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	codeHash := crypto.Keccak256Hash(code)
+	rawdb.WriteCode(db, codeHash, code)
+
+	for i := 0; i < 50; i++ {
+		acc := Account{Nonce: uint64(i), Balance: big.NewInt(int64(i) * 1000), Root: emptyRoot[:], CodeHash: emptyCode[:]}
+		if i%5 == 0 {
+			storeTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+			for j := 0; j <= i; j++ {
+				value, _ := rlp.EncodeToBytes(big.NewInt(int64(j + 1)))
+				storeTrie.Update(common.BigToHash(big.NewInt(int64(j))).Bytes(), value)
+			}
+			root, _ := storeTrie.Commit(nil)
+			if err := triedb.Commit(root, false, nil); err != nil {
+				t.Fatal(err)
+			}
+			acc.Root, acc.CodeHash = root[:], codeHash[:]
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update(common.BigToAddress(big.NewInt(int64(i))).Bytes(), blob)
+	}
+	root, _ := accTrie.Commit(nil)
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// Tests that a state exported into a chunked dump is verified and rebuilt into
+// another database along with its snapshot, and that corrupted dumps are
+// refused.
+func TestStateDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statedump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := rawdb.NewMemoryDatabase()
+	genesis := &types.Header{Number: big.NewInt(0), Extra: []byte("dump")}
+	rawdb.WriteHeader(src, genesis)
+	rawdb.WriteCanonicalHash(src, genesis.Hash(), 0)
+	header := &types.Header{Number: big.NewInt(10), Root: makeDumpState(t, src)}
+
+	manifest, err := ExportState(src, header, dir, 512)
+	if err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	if manifest.Accounts != 50 || manifest.Slots != 235 || manifest.Codes != 1 {
+		t.Fatalf("item count mismatch: have %d accounts, %d slots, %d codes", manifest.Accounts, manifest.Slots, manifest.Codes)
+	}
+	if len(manifest.Chunks) < 2 {
+		t.Fatalf("state not chunked: %d chunks", len(manifest.Chunks))
+	}
+	if _, err := ExportState(src, header, dir, 512); err != errStateDumpExists {
+		t.Fatalf("export into existing dump error mismatch: have %v, want %v", err, errStateDumpExists)
+	}
+	if _, err := VerifyStateDump(dir); err != nil {
+		t.Fatalf("failed to verify state dump: %v", err)
+	}
+	// Dumps of other chains must be refused before touching the local snapshot
+	dst := rawdb.NewMemoryDatabase()
+	if _, err := ImportState(dst, dir); err == nil {
+		t.Fatal("state dump imported without a local chain")
+	}
+	other := &types.Header{Number: big.NewInt(0), Extra: []byte("other")}
+	rawdb.WriteCanonicalHash(dst, other.Hash(), 0)
+	rawdb.WriteSnapshotRoot(dst, common.HexToHash("0x01"))
+	if _, err := ImportState(dst, dir); !errors.Is(err, errStateDumpChain) {
+		t.Fatalf("other genesis error mismatch: have %v, want %v", err, errStateDumpChain)
+	}
+	rawdb.WriteCanonicalHash(dst, genesis.Hash(), 0)
+	fork := &types.Header{Number: big.NewInt(10), Extra: []byte("fork")}
+	rawdb.WriteCanonicalHash(dst, fork.Hash(), 10)
+	if _, err := ImportState(dst, dir); !errors.Is(err, errStateDumpChain) {
+		t.Fatalf("other block error mismatch: have %v, want %v", err, errStateDumpChain)
+	}
+	if root := rawdb.ReadSnapshotRoot(dst); root != common.HexToHash("0x01") {
+		t.Fatalf("snapshot dropped by refused import: root %x", root)
+	}
+	rawdb.WriteCanonicalHash(dst, header.Hash(), 10)
+
+	// Import the dump and check the rebuilt state and snapshot
+	if _, err := ImportState(dst, dir); err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	if root := rawdb.ReadSnapshotRoot(dst); root != header.Root {
+		t.Fatalf("snapshot root mismatch: have %x, want %x", root, header.Root)
+	}
+	snaps := New(dst, trie.NewDatabase(dst), 16, header.Root, false)
+	if snap, ok := snaps.Snapshot(header.Root).(*diskLayer); !ok || snap.genMarker != nil {
+		t.Fatal("imported snapshot not loaded as generated")
+	}
+	srcTrie, _ := trie.New(header.Root, trie.NewDatabase(src))
+	dstTrie, err := trie.New(header.Root, trie.NewDatabase(dst))
+	if err != nil {
+		t.Fatalf("imported state not available: %v", err)
+	}
+	srcIt, dstIt := srcTrie.NodeIterator(nil), dstTrie.NodeIterator(nil)
+	for srcIt.Next(true) {
+		if !dstIt.Next(true) || srcIt.Hash() != dstIt.Hash() {
+			t.Fatalf("imported account trie mismatch at %x", srcIt.Path())
+		}
+	}
+	accIt := trie.NewIterator(dstTrie.NodeIterator(nil))
+	for accIt.Next() {
+		var acc Account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			t.Fatal(err)
+		}
+		storeTrie, err := trie.New(common.BytesToHash(acc.Root), trie.NewDatabase(dst))
+		if err != nil {
+			t.Fatalf("imported storage of account %x not available: %v", accIt.Key, err)
+		}
+		storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+		for storeIt.Next() {
+			if blob := rawdb.ReadStorageSnapshot(dst, common.BytesToHash(accIt.Key), common.BytesToHash(storeIt.Key)); !bytes.Equal(blob, storeIt.Value) {
+				t.Fatalf("storage snapshot mismatch: have %x, want %x", blob, storeIt.Value)
+			}
+		}
+		if !bytes.Equal(acc.CodeHash, emptyCode[:]) && len(rawdb.ReadCode(dst, common.BytesToHash(acc.CodeHash))) == 0 {
+			t.Fatalf("code of account %x missing", accIt.Key)
+		}
+		if blob := rawdb.ReadAccountSnapshot(dst, common.BytesToHash(accIt.Key)); !bytes.Equal(blob, SlimAccountRLP(acc.Nonce, acc.Balance, common.BytesToHash(acc.Root), acc.CodeHash)) {
+			t.Fatalf("account snapshot mismatch of %x", accIt.Key)
+		}
+	}
+	// Corrupt a chunk and ensure the dump is refused
+	chunk := filepath.Join(dir, manifest.Chunks[1].Name)
+	blob, _ := ioutil.ReadFile(chunk)
+	blob[len(blob)-1] ^= 0xff
+	if err := ioutil.WriteFile(chunk, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyStateDump(dir); err == nil {
+		t.Fatal("corrupted state dump verified")
+	}
+	if _, err := ImportState(dst, dir); err == nil {
+		t.Fatal("corrupted state dump imported")
+	}
+	if root := rawdb.ReadSnapshotRoot(dst); root != header.Root {
+		t.Fatalf("snapshot dropped by corrupted import: root %x", root)
+	}
+	// Chunk names pointing out of the dump directory must be refused
+	manifest.Chunks[1].Name = filepath.Join("..", filepath.Base(dir), manifest.Chunks[1].Name)
+	if _, err := readStateDumpChunk(dir, 1, manifest.Chunks[1]); err == nil {
+		t.Fatal("chunk read out of its expected name")
+	}
+}
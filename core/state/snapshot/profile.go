@@ -0,0 +1,70 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// AccessProfile tracks the accounts most recently read from the disk layer of a
+// snapshot tree, missing all the diff layers. These are the accounts worth to
+// preload into the caches after a restart.
+type AccessProfile struct {
+	accounts *lru.Cache
+}
+
+// NewAccessProfile creates an access profile tracking up to the given number
+// of accounts.
+func NewAccessProfile(size int) *AccessProfile {
+	accounts, _ := lru.New(size)
+	return &AccessProfile{accounts: accounts}
+}
+
+// record marks an account as read. It is a noop on a nil profile.
+func (p *AccessProfile) record(hash common.Hash) {
+	if p != nil {
+		p.accounts.Add(hash, struct{}{})
+	}
+}
+
+// Accounts returns the hashes of the tracked accounts, the most recently read
+// first.
+func (p *AccessProfile) Accounts() []common.Hash {
+	keys := p.accounts.Keys()
+	hashes := make([]common.Hash, len(keys))
+	for i, key := range keys {
+		hashes[len(keys)-1-i] = key.(common.Hash)
+	}
+	return hashes
+}
+
+// SetAccessProfile starts tracking the accounts read from the disk layer into
+// the given profile, or stops it if nil.
+func (t *Tree) SetAccessProfile(profile *AccessProfile) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.profile = profile
+	for _, layer := range t.layers {
+		if dl, ok := layer.(*diskLayer); ok {
+			dl.lock.Lock()
+			dl.profile = profile
+			dl.lock.Unlock()
+		}
+	}
+}
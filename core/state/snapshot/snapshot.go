@@ -158,6 +158,8 @@ type Tree struct {
 	cache  int                      // Megabytes permitted to use for read caches
 	layers map[common.Hash]snapshot // Collection of all known layers
 	lock   sync.RWMutex
+
+	profile *AccessProfile // Tracker of the accounts read from the disk layer, if any
 }
 
 // New attempts to load an already existing snapshot from a persistent key-value
@@ -520,6 +522,7 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 		triedb:     base.triedb,
 		genMarker:  base.genMarker,
 		genPending: base.genPending,
+		profile:    base.profile,
 	}
 	// If snapshot generation hasn't finished yet, port over all the starts and
 	// continue where the previous round left off.
@@ -601,9 +604,9 @@ func (t *Tree) Rebuild(root common.Hash) {
 	// Start generating a new snapshot from scratch on a backgroung thread. The
 	// generator will run a wiper first if there's not one running right now.
 	log.Info("Rebuilding state snapshot")
-	t.layers = map[common.Hash]snapshot{
-		root: generateSnapshot(t.diskdb, t.triedb, t.cache, root, wiper),
-	}
+	base := generateSnapshot(t.diskdb, t.triedb, t.cache, root, wiper)
+	base.profile = t.profile
+	t.layers = map[common.Hash]snapshot{root: base}
 }
 
 // AccountIterator creates a new account iterator for the specified root hash and
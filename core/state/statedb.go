@@ -18,6 +18,7 @@
 package state
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -70,6 +71,7 @@ type StateDB struct {
 	snapDestructs map[common.Hash]struct{}
 	snapAccounts  map[common.Hash][]byte
 	snapStorage   map[common.Hash]map[common.Hash][]byte
+	snapAudit     *SnapshotAudit // Checker of a sample of the snapshot reads, if any
 
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects        map[common.Address]*stateObject
@@ -90,6 +92,7 @@ type StateDB struct {
 	txIndex      int
 	logs         map[common.Hash][]*types.Log
 	logSize      uint
+	creations    []*types.ContractCreation
 
 	preimages map[common.Hash][]byte
 
@@ -167,6 +170,7 @@ func (s *StateDB) Reset(root common.Hash) error {
 	s.txIndex = 0
 	s.logs = make(map[common.Hash][]*types.Log)
 	s.logSize = 0
+	s.creations = nil
 	s.preimages = make(map[common.Hash][]byte)
 	s.clearJournalAndRefund()
 
@@ -204,6 +208,24 @@ func (s *StateDB) Logs() []*types.Log {
 	return logs
 }
 
+// AddCreation records a contract deployed by the VM, with the code it stored.
+func (s *StateDB) AddCreation(creator, contract common.Address) {
+	s.journal.append(addCreationChange{})
+
+	s.creations = append(s.creations, &types.ContractCreation{
+		Address:  contract,
+		Creator:  creator,
+		CodeHash: s.GetCodeHash(contract),
+		TxHash:   s.thash,
+		TxIndex:  uint(s.txIndex),
+	})
+}
+
+// Creations returns the contracts deployed so far, in the order of deployment.
+func (s *StateDB) Creations() []*types.ContractCreation {
+	return s.creations
+}
+
 // AddPreimage records a SHA3 preimage seen by the VM.
 func (s *StateDB) AddPreimage(hash common.Hash, preimage []byte) {
 	if _, ok := s.preimages[hash]; !ok {
@@ -513,6 +535,9 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		var acc *snapshot.Account
 		if acc, err = s.snap.Account(crypto.Keccak256Hash(addr.Bytes())); err == nil {
 			if acc == nil {
+				if s.snapAudit.sample() {
+					s.auditAccount(addr, nil)
+				}
 				return nil
 			}
 			data = &Account{
@@ -527,6 +552,9 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 			if data.Root == (common.Hash{}) {
 				data.Root = emptyRoot
 			}
+			if s.snapAudit.sample() {
+				s.auditAccount(addr, data)
+			}
 		}
 	}
 	// If snapshot unavailable or reading from it failed, load from the database
@@ -652,6 +680,7 @@ func (s *StateDB) Copy() *StateDB {
 		refund:              s.refund,
 		logs:                make(map[common.Hash][]*types.Log, len(s.logs)),
 		logSize:             s.logSize,
+		creations:           make([]*types.ContractCreation, len(s.creations)),
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
 	}
@@ -694,6 +723,10 @@ func (s *StateDB) Copy() *StateDB {
 		}
 		state.logs[hash] = cpy
 	}
+	for i, creation := range s.creations {
+		cpy := *creation
+		state.creations[i] = &cpy
+	}
 	for hash, preimage := range s.preimages {
 		state.preimages[hash] = preimage
 	}
@@ -793,6 +826,133 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	return s.trie.Hash()
 }
 
+// BalanceChange returns the change in the sum of all account balances caused by
+// the finalised but not yet committed modifications, relative to the state with
+// the given root.
+func (s *StateDB) BalanceChange(root common.Hash) (*big.Int, error) {
+	_, change, err := s.BalanceChanges(root)
+	return change, err
+}
+
+// BalanceChanges returns the new balances of the accounts whose balance changed
+// by the finalised but not yet committed modifications, relative to the state
+// with the given root, along with the change in the sum of all balances. Deleted
+// accounts are reported with a zero balance.
+func (s *StateDB) BalanceChanges(root common.Hash) (map[common.Address]*big.Int, *big.Int, error) {
+	tr, err := s.db.OpenTrie(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		balances = make(map[common.Address]*big.Int)
+		change   = new(big.Int)
+	)
+	for addr := range s.stateObjectsDirty {
+		balance := new(big.Int)
+		if obj := s.stateObjects[addr]; !obj.deleted {
+			balance.Set(obj.Balance())
+		}
+		prev := new(big.Int)
+		enc, err := tr.TryGet(addr.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(enc) > 0 {
+			var data Account
+			if err := rlp.DecodeBytes(enc, &data); err != nil {
+				return nil, nil, err
+			}
+			prev = data.Balance
+		}
+		if balance.Cmp(prev) != 0 {
+			balances[addr] = balance
+			change.Add(change, balance)
+			change.Sub(change, prev)
+		}
+	}
+	return balances, change, nil
+}
+
+// AccountDiff is the change of an account caused by the finalised but not yet
+// committed modifications of a state database.
+type AccountDiff struct {
+	Deleted bool                        // Whether the account was deleted
+	Nonce   *uint64                     // New nonce, nil if unchanged
+	Balance *big.Int                    // New balance, nil if unchanged
+	Code    []byte                      // New code, nil if unchanged
+	Storage map[common.Hash]common.Hash // Changed storage slots with their new values
+}
+
+// Diff returns the changes of the accounts modified by the finalised but not
+// yet committed modifications, relative to the state with the given root. Storage
+// changes already written into the tries by IntermediateRoot aren't reported.
+func (s *StateDB) Diff(root common.Hash) (map[common.Address]*AccountDiff, error) {
+	tr, err := s.db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make(map[common.Address]*AccountDiff)
+	for addr := range s.stateObjectsDirty {
+		var (
+			obj  = s.stateObjects[addr]
+			prev = Account{Balance: new(big.Int), Root: emptyRoot, CodeHash: emptyCodeHash}
+		)
+		enc, err := tr.TryGet(addr.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) > 0 {
+			if err := rlp.DecodeBytes(enc, &prev); err != nil {
+				return nil, err
+			}
+		}
+		if obj.deleted {
+			if len(enc) > 0 {
+				diffs[addr] = &AccountDiff{Deleted: true}
+			}
+			continue
+		}
+		diff := &AccountDiff{Storage: make(map[common.Hash]common.Hash)}
+		if obj.Nonce() != prev.Nonce {
+			nonce := obj.Nonce()
+			diff.Nonce = &nonce
+		}
+		if obj.Balance().Cmp(prev.Balance) != 0 {
+			diff.Balance = new(big.Int).Set(obj.Balance())
+		}
+		if !bytes.Equal(obj.CodeHash(), prev.CodeHash) {
+			diff.Code = common.CopyBytes(obj.Code(s.db))
+		}
+		if len(obj.pendingStorage) > 0 {
+			st, err := s.db.OpenStorageTrie(obj.addrHash, prev.Root)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range obj.pendingStorage {
+				enc, err := st.TryGet(key.Bytes())
+				if err != nil {
+					return nil, err
+				}
+				var old common.Hash
+				if len(enc) > 0 {
+					_, content, _, err := rlp.Split(enc)
+					if err != nil {
+						return nil, err
+					}
+					old.SetBytes(content)
+				}
+				if value != old {
+					diff.Storage[key] = value
+				}
+			}
+		}
+		if diff.Nonce != nil || diff.Balance != nil || diff.Code != nil || len(diff.Storage) > 0 {
+			diffs[addr] = diff
+		}
+	}
+	return diffs, nil
+}
+
 // Prepare sets the current transaction hash and index and block hash which is
 // used when the EVM emits new state logs.
 func (s *StateDB) Prepare(thash, bhash common.Hash, ti int) {
@@ -727,3 +727,58 @@ func TestMissingTrieNodes(t *testing.T) {
 		t.Fatalf("expected error, got root :%x", root)
 	}
 }
+
+func TestDiff(t *testing.T) {
+	db := NewDatabase(rawdb.NewMemoryDatabase())
+	state, _ := New(common.Hash{}, db, nil)
+
+	var (
+		kept    = toAddr([]byte("kept"))
+		changed = toAddr([]byte("changed"))
+		killed  = toAddr([]byte("killed"))
+		created = toAddr([]byte("created"))
+	)
+	state.SetBalance(kept, big.NewInt(1))
+	state.SetState(kept, common.Hash{1}, common.Hash{1})
+	state.SetBalance(changed, big.NewInt(2))
+	state.SetState(changed, common.Hash{1}, common.Hash{1})
+	state.SetState(changed, common.Hash{2}, common.Hash{2})
+	state.SetBalance(killed, big.NewInt(3))
+	root, _ := state.Commit(false)
+	state, _ = New(root, db, nil)
+
+	// Modify the state across two finalised transactions, rewriting some values
+	state.SetState(kept, common.Hash{1}, common.Hash{1})
+	state.SetNonce(changed, 1)
+	state.SetState(changed, common.Hash{1}, common.Hash{3})
+	state.SetState(changed, common.Hash{3}, common.Hash{3})
+	state.Suicide(killed)
+	state.Finalise(true)
+
+	state.SetState(changed, common.Hash{3}, common.Hash{})
+	state.SetState(changed, common.Hash{2}, common.Hash{4})
+	state.SetCode(created, []byte{1, 2, 3})
+	state.Finalise(true)
+
+	diffs, err := state.Diff(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("have %d changed accounts, want 3: %v", len(diffs), diffs)
+	}
+	if diff := diffs[changed]; diff == nil || diff.Nonce == nil || *diff.Nonce != 1 || diff.Balance != nil || diff.Code != nil {
+		t.Errorf("changed account diff mismatch: %+v", diff)
+	} else {
+		want := map[common.Hash]common.Hash{{1}: {3}, {2}: {4}}
+		if !reflect.DeepEqual(diff.Storage, want) {
+			t.Errorf("storage diff mismatch: have %v, want %v", diff.Storage, want)
+		}
+	}
+	if diff := diffs[killed]; diff == nil || !diff.Deleted {
+		t.Errorf("killed account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[created]; diff == nil || !bytes.Equal(diff.Code, []byte{1, 2, 3}) || diff.Nonce != nil {
+		t.Errorf("created account diff mismatch: %+v", diff)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// EnableSupplyTracking starts recording the circulating supply at every written
+// block, seeding the record of the genesis block from its allocation if missing,
+// along with the balance changes of the accounts. It must be called before
+// importing blocks. Blocks whose parent has no supply record, e.g. ones imported
+// by fast sync, are not tracked.
+func (bc *BlockChain) EnableSupplyTracking() error {
+	genesis := bc.genesisBlock
+	seeded := rawdb.ReadSupply(bc.db, genesis.Hash(), 0) != nil
+	if rawdb.ReadBalanceIndexTail(bc.db) == nil {
+		// Supply tracked without balance changes, index them from now on
+		tail := uint64(0)
+		if seeded {
+			tail = bc.CurrentBlock().NumberU64() + 1
+		}
+		rawdb.WriteBalanceIndexTail(bc.db, tail)
+	}
+	if !seeded {
+		supply, err := stateSupply(bc.stateCache, genesis.Root())
+		if err != nil {
+			return fmt.Errorf("failed to sum genesis allocation: %v", err)
+		}
+		rawdb.WriteSupply(bc.db, genesis.Hash(), 0, &rawdb.SupplyRecord{
+			Supply:   supply,
+			Issuance: new(big.Int),
+			Burned:   new(big.Int),
+		})
+		log.Info("Seeded supply tracking from genesis", "supply", supply)
+	}
+	bc.trackSupply = true
+	return nil
+}
+
+// stateSupply sums the balances of all the accounts in a state.
+func stateSupply(db state.Database, root common.Hash) (*big.Int, error) {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	supply := new(big.Int)
+	for it := trie.NewIterator(tr.NodeIterator(nil)); it.Next(); {
+		var account state.Account
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return nil, err
+		}
+		supply.Add(supply, account.Balance)
+	}
+	return supply, nil
+}
+
+// supplyRecord derives the supply record of a block from the one of its parent
+// and the balance changes of its finalised, but not yet committed, state, also
+// returning the changed balances. It returns nil if the parent's supply is
+// unknown.
+func (bc *BlockChain) supplyRecord(block *types.Block, statedb *state.StateDB) (*rawdb.SupplyRecord, map[common.Address]*big.Int, error) {
+	number := block.NumberU64()
+	parent := rawdb.ReadSupply(bc.db, block.ParentHash(), number-1)
+	if parent == nil {
+		return nil, nil, nil
+	}
+	header := bc.GetHeader(block.ParentHash(), number-1)
+	if header == nil {
+		return nil, nil, fmt.Errorf("parent %x unknown", block.ParentHash())
+	}
+	balances, change, err := statedb.BalanceChanges(header.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Whatever was minted but didn't show up in the balances was destroyed
+	issuance := new(big.Int)
+	if _, ok := bc.engine.(*ethash.Ethash); ok {
+		reward, uncleRewards := ethash.GetRewards(bc.chainConfig, block.Header(), block.Uncles())
+		issuance.Add(issuance, reward)
+		for _, uncleReward := range uncleRewards {
+			issuance.Add(issuance, uncleReward)
+		}
+	}
+	burned := new(big.Int).Sub(issuance, change)
+	if burned.Sign() < 0 {
+		log.Warn("Supply grew beyond the block rewards", "number", number, "hash", block.Hash(), "excess", new(big.Int).Neg(burned))
+	}
+	return &rawdb.SupplyRecord{
+		Supply:   new(big.Int).Add(parent.Supply, change),
+		Issuance: new(big.Int).Add(parent.Issuance, issuance),
+		Burned:   new(big.Int).Add(parent.Burned, burned),
+	}, balances, nil
+}
+
+// IndexedBalances reconstructs the balances of an account after the given
+// canonical blocks, in ascending order, from the balance changes indexed along
+// the supply records. Blocks not covered by the index get a nil balance.
+//
+// The index starts from the balance in the state preceding its oldest block, the
+// genesis allocation unless supply tracking predates the index. An error is
+// returned if that state was pruned while blocks covered by the index are asked
+// for, as none of their balances can be reconstructed then.
+func (bc *BlockChain) IndexedBalances(address common.Address, headers []*types.Header) ([]*big.Int, error) {
+	balances := make([]*big.Int, len(headers))
+	tail := rawdb.ReadBalanceIndexTail(bc.db)
+	if tail == nil || len(headers) == 0 {
+		return balances, nil
+	}
+	base := bc.genesisBlock.Header()
+	if *tail > 0 {
+		if base = bc.GetHeaderByNumber(*tail - 1); base == nil {
+			return balances, nil
+		}
+	}
+	var (
+		number = base.Number.Uint64()
+		last   = headers[len(headers)-1].Number.Uint64()
+	)
+	if last < number {
+		return balances, nil
+	}
+	statedb, err := bc.StateAt(base.Root)
+	if err != nil {
+		return nil, fmt.Errorf("balance index incomplete, requires archive state at #%d: %v", number, err)
+	}
+	var (
+		balance = statedb.GetBalance(address)
+		entries []*rawdb.BalanceChangeEntry
+	)
+	if last > number {
+		entries = rawdb.ReadBalanceChanges(bc.db, address, number+1, last)
+	}
+	for i, header := range headers {
+		n := header.Number.Uint64()
+		if n < number || (n > number && rawdb.ReadSupply(bc.db, header.Hash(), n) == nil) {
+			continue
+		}
+		for len(entries) > 0 && entries[0].BlockNumber <= n {
+			if rawdb.ReadCanonicalHash(bc.db, entries[0].BlockNumber) == entries[0].BlockHash {
+				balance = entries[0].Balance
+			}
+			entries = entries[1:]
+		}
+		balances[i] = new(big.Int).Set(balance)
+	}
+	return balances, nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that the supply tracker follows the rewards minted by the blocks and the
+// ether destroyed by contracts self-destructing to themselves.
+func TestSupplyTracking(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		aa      = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				aa: {
+					Code:    []byte{byte(vm.ADDRESS), byte(vm.SELFDESTRUCT)},
+					Balance: big.NewInt(1000),
+				},
+			},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, block *BlockGen) {
+		switch i {
+		case 0:
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), aa, big.NewInt(7), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+			block.AddTx(tx)
+		case 1:
+			block.AddUncle(&types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Coinbase: common.Address{0x1}})
+		}
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFullFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if err := chain.EnableSupplyTracking(); err != nil {
+		t.Fatalf("failed to enable supply tracking: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	issuance := new(big.Int)
+	for _, block := range blocks {
+		reward, uncleRewards := ethash.GetRewards(gspec.Config, block.Header(), block.Uncles())
+		issuance.Add(issuance, reward)
+		for _, uncleReward := range uncleRewards {
+			issuance.Add(issuance, uncleReward)
+		}
+	}
+	head := chain.CurrentBlock()
+	record := rawdb.ReadSupply(diskdb, head.Hash(), head.NumberU64())
+	if record == nil {
+		t.Fatalf("supply of head block not recorded")
+	}
+	supply, err := stateSupply(chain.stateCache, head.Root())
+	if err != nil {
+		t.Fatalf("failed to sum head state: %v", err)
+	}
+	if record.Supply.Cmp(supply) != 0 {
+		t.Errorf("supply mismatch: have %v, want %v", record.Supply, supply)
+	}
+	if record.Issuance.Cmp(issuance) != 0 {
+		t.Errorf("issuance mismatch: have %v, want %v", record.Issuance, issuance)
+	}
+	if record.Burned.Cmp(big.NewInt(1007)) != 0 {
+		t.Errorf("burned ether mismatch: have %v, want 1007", record.Burned)
+	}
+	// Blocks of an untracked parent must not be tracked either
+	rawdb.DeleteSupply(diskdb, blocks[1].Hash(), 2)
+	rawdb.DeleteSupply(diskdb, head.Hash(), head.NumberU64())
+	chain.SetHead(2)
+	if _, err := chain.InsertChain(blocks[2:]); err != nil {
+		t.Fatalf("failed to reinsert head block: %v", err)
+	}
+	if rawdb.ReadSupply(diskdb, head.Hash(), head.NumberU64()) != nil {
+		t.Errorf("supply of block with untracked parent recorded")
+	}
+}
+
+// Tests that the balances of an account are reconstructed from the balance index
+// at every block covered by it, following the canonical chain through reorgs.
+func TestIndexedBalances(t *testing.T) {
+	var (
+		db        = rawdb.NewMemoryDatabase()
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.Address{0xaa}
+		gspec     = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}, recipient: {Balance: big.NewInt(5)}},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	makeChain := func(parent *types.Block, n int, amount int64) []*types.Block {
+		blocks, _ := GenerateChain(gspec.Config, parent, ethash.NewFaker(), db, n, func(i int, block *BlockGen) {
+			block.SetCoinbase(common.Address{byte(amount)})
+			if i%2 == 0 {
+				tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), recipient, big.NewInt(amount), 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+				block.AddTx(tx)
+			}
+		})
+		return blocks
+	}
+	blocks := makeChain(genesis, 4, 1)
+
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if err := chain.EnableSupplyTracking(); err != nil {
+		t.Fatalf("failed to enable supply tracking: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check := func(addr common.Address) {
+		t.Helper()
+		var headers []*types.Header
+		for n := uint64(0); n <= chain.CurrentBlock().NumberU64(); n++ {
+			headers = append(headers, chain.GetHeaderByNumber(n))
+		}
+		balances, err := chain.IndexedBalances(addr, headers)
+		if err != nil {
+			t.Fatalf("failed to reconstruct balances of %x: %v", addr, err)
+		}
+		for i, balance := range balances {
+			statedb, _ := chain.StateAt(headers[i].Root)
+			if want := statedb.GetBalance(addr); balance == nil || balance.Cmp(want) != 0 {
+				t.Errorf("balance of %x at #%d mismatch: have %v, want %v", addr, i, balance, want)
+			}
+		}
+	}
+	check(address)
+	check(recipient)
+
+	// Reorg onto a fork transferring different amounts
+	if _, err := chain.InsertChain(makeChain(blocks[0], 5, 3)); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	check(address)
+	check(recipient)
+
+	// Blocks imported before balance changes were indexed are not covered
+	diskdb = rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+	untracked, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer untracked.Stop()
+
+	if _, err := untracked.InsertChain(blocks[:2]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if err := untracked.EnableSupplyTracking(); err != nil {
+		t.Fatalf("failed to enable supply tracking: %v", err)
+	}
+	headers := []*types.Header{untracked.GetHeaderByNumber(0), untracked.GetHeaderByNumber(2)}
+	balances, err := untracked.IndexedBalances(recipient, headers)
+	if err != nil {
+		t.Fatalf("failed to reconstruct balances: %v", err)
+	}
+	for i, balance := range balances {
+		if i == 0 && (balance == nil || balance.Int64() != 5) {
+			t.Errorf("genesis balance mismatch: have %v, want 5", balance)
+		}
+		if i == 1 && balance != nil {
+			t.Errorf("untracked block #2 covered by the index: have %v", balance)
+		}
+	}
+}
+
+// Tests that balance changes indexed on a chain whose supply was tracked before,
+// starting above the genesis, are reconstructed from the state preceding the
+// index, and that a pruned one is reported instead of yielding no balances.
+func TestIndexedBalancesUpgrade(t *testing.T) {
+	var (
+		db        = rawdb.NewMemoryDatabase()
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.Address{0xaa}
+		gspec     = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}, recipient: {Balance: big.NewInt(5)}},
+		}
+		genesis = MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 6, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), recipient, big.NewInt(int64(i+1)), 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		block.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	MustCommitGenesis(diskdb, gspec)
+	chain, _ := NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+
+	// Track the supply of a few blocks as before balance changes were indexed
+	if err := chain.EnableSupplyTracking(); err != nil {
+		t.Fatalf("failed to enable supply tracking: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	rawdb.DeleteBalanceIndexTail(diskdb)
+	if err := chain.EnableSupplyTracking(); err != nil {
+		t.Fatalf("failed to reenable supply tracking: %v", err)
+	}
+	if tail := rawdb.ReadBalanceIndexTail(diskdb); tail == nil || *tail != 4 {
+		t.Fatalf("balance index tail mismatch: have %v, want 4", tail)
+	}
+	if _, err := chain.InsertChain(blocks[3:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var headers []*types.Header
+	for n := uint64(3); n <= 6; n++ {
+		headers = append(headers, chain.GetHeaderByNumber(n))
+	}
+	balances, err := chain.IndexedBalances(recipient, headers)
+	if err != nil {
+		t.Fatalf("failed to reconstruct balances: %v", err)
+	}
+	for i, balance := range balances {
+		statedb, _ := chain.StateAt(headers[i].Root)
+		if want := statedb.GetBalance(recipient); balance == nil || balance.Cmp(want) != 0 {
+			t.Errorf("balance at #%d mismatch: have %v, want %v", headers[i].Number, balance, want)
+		}
+	}
+	// Restart without the state preceding the index, only the head ones are kept
+	chain.Stop()
+	chain, _ = NewBlockChain(diskdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if _, err := chain.StateAt(headers[0].Root); err == nil {
+		t.Fatalf("state at #3 not pruned")
+	}
+	if _, err := chain.IndexedBalances(recipient, headers); err == nil || !strings.Contains(err.Error(), "requires archive state at #3") {
+		t.Errorf("pruned index base error mismatch: have %v", err)
+	}
+	// Blocks before the index don't need its base state
+	early := []*types.Header{chain.GetHeaderByNumber(1), chain.GetHeaderByNumber(2)}
+	balances, err = chain.IndexedBalances(recipient, early)
+	if err != nil {
+		t.Fatalf("failed to look up blocks before the index: %v", err)
+	}
+	for i, balance := range balances {
+		if balance != nil {
+			t.Errorf("block #%d before the index covered by it: have %v", early[i].Number, balance)
+		}
+	}
+}
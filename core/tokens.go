@@ -0,0 +1,66 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// transferEventTopic is the signature hash of the Transfer event shared by the
+// ERC-20 and ERC-721 standards.
+var transferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// EnableTokenIndex starts indexing the token transfers announced by the written
+// blocks. It must be called before importing blocks.
+func (bc *BlockChain) EnableTokenIndex() {
+	bc.indexTokens = true
+}
+
+// ParseTokenTransfers recognizes the ERC-20 and ERC-721 Transfer events among the
+// given logs. The two standards are told apart by the token id being indexed by
+// ERC-721, while ERC-20 carries the amount in the event data.
+func ParseTokenTransfers(logs []*types.Log) []*rawdb.TokenTransfer {
+	var transfers []*rawdb.TokenTransfer
+	for _, log := range logs {
+		if len(log.Topics) == 0 || log.Topics[0] != transferEventTopic {
+			continue
+		}
+		transfer := &rawdb.TokenTransfer{
+			Token:    log.Address,
+			TxHash:   log.TxHash,
+			LogIndex: log.Index,
+		}
+		switch {
+		case len(log.Topics) == 3 && len(log.Data) == common.HashLength:
+			transfer.Value = new(big.Int).SetBytes(log.Data)
+		case len(log.Topics) == 4 && len(log.Data) == 0:
+			transfer.Value = log.Topics[3].Big()
+			transfer.NonFungible = true
+		default:
+			continue
+		}
+		transfer.From = common.BytesToAddress(log.Topics[1].Bytes())
+		transfer.To = common.BytesToAddress(log.Topics[2].Bytes())
+		transfers = append(transfers, transfer)
+	}
+	return transfers
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that ERC-20 and ERC-721 Transfer events are recognized, and that other
+// events are ignored.
+func TestParseTokenTransfers(t *testing.T) {
+	var (
+		token, nft = common.Address{0x70}, common.Address{0x71}
+		from, to   = common.Address{0xa}, common.Address{0xb}
+		fromTopic  = common.BytesToHash(from.Bytes())
+		toTopic    = common.BytesToHash(to.Bytes())
+	)
+	logs := []*types.Log{
+		{Address: token, Topics: []common.Hash{transferEventTopic, fromTopic, toTopic}, Data: common.BigToHash(big.NewInt(100)).Bytes(), Index: 0},
+		{Address: nft, Topics: []common.Hash{transferEventTopic, fromTopic, toTopic, common.BigToHash(big.NewInt(7))}, Index: 1},
+		// Malformed transfers and other events
+		{Address: token, Topics: []common.Hash{transferEventTopic, fromTopic, toTopic}, Index: 2},
+		{Address: nft, Topics: []common.Hash{transferEventTopic, fromTopic, toTopic, {}}, Data: make([]byte, 32), Index: 3},
+		{Address: token, Topics: []common.Hash{{0x1}, fromTopic, toTopic}, Data: make([]byte, 32), Index: 4},
+		{Address: token, Index: 5},
+	}
+	transfers := ParseTokenTransfers(logs)
+	if len(transfers) != 2 {
+		t.Fatalf("transfer count mismatch: have %d, want 2", len(transfers))
+	}
+	if tr := transfers[0]; tr.Token != token || tr.From != from || tr.To != to || tr.Value.Cmp(big.NewInt(100)) != 0 || tr.NonFungible || tr.LogIndex != 0 {
+		t.Errorf("ERC-20 transfer mismatch: %+v", tr)
+	}
+	if tr := transfers[1]; tr.Token != nft || tr.From != from || tr.To != to || tr.Value.Cmp(big.NewInt(7)) != 0 || !tr.NonFungible || tr.LogIndex != 1 {
+		t.Errorf("ERC-721 transfer mismatch: %+v", tr)
+	}
+}
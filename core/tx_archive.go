@@ -0,0 +1,276 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Reasons of transactions leaving the pool, short of being included after being
+// promoted to the pending set.
+const (
+	TxDropReplaced     = "replaced"           // Replaced by another transaction with the same nonce
+	TxDropUnderpriced  = "underpriced"        // Evicted by better priced transactions or a price limit bump
+	TxDropExpired      = "expired"            // Queued for longer than the pool lifetime
+	TxDropNonceTooLow  = "nonce too low"      // Nonce used by another transaction included in the chain
+	TxDropIncluded     = "included"           // Included in the chain while queued
+	TxDropUnpayable    = "insufficient funds" // Unpayable by the sender or over the block gas limit
+	TxDropAccountLimit = "account limit"      // Over the number of transactions allowed per account
+	TxDropPoolLimit    = "pool limit"         // Over the number of transactions allowed in the pool
+)
+
+// ArchivedTx is a transaction that left the pool short of being included after
+// being promoted, along with the reason it was dropped.
+type ArchivedTx struct {
+	Tx         *types.Transaction
+	From       common.Address
+	Reason     string
+	ReplacedBy common.Hash // Hash of the replacement transaction, if replaced
+	Time       uint64      // Unix time the transaction was dropped
+}
+
+// txArchive is a bounded archive of the transactions dropped by the pool,
+// evicting the oldest ones first, optionally persisted to disk.
+type txArchive struct {
+	limit int
+	path  string // Filesystem path to persist the archive at, if any
+
+	txs     map[common.Hash]*ArchivedTx
+	senders map[common.Address][]common.Hash
+	order   []common.Hash // Archived transactions, oldest first
+	dirty   bool
+
+	lock sync.RWMutex
+}
+
+// newTxArchive creates a transaction archive retaining up to the given number
+// of transactions, loading the ones persisted previously.
+func newTxArchive(limit int, path string) *txArchive {
+	archive := &txArchive{
+		limit:   limit,
+		path:    path,
+		txs:     make(map[common.Hash]*ArchivedTx),
+		senders: make(map[common.Address][]common.Hash),
+	}
+	if path != "" {
+		if err := archive.load(); err != nil {
+			log.Warn("Failed to load transaction archive", "path", path, "err", err)
+		}
+	}
+	return archive
+}
+
+// add archives a dropped transaction, evicting the oldest one if the archive is
+// full.
+func (a *txArchive) add(entry *ArchivedTx) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	hash := entry.Tx.Hash()
+	if _, ok := a.txs[hash]; ok {
+		return
+	}
+	for len(a.order) >= a.limit {
+		a.evict()
+	}
+	a.txs[hash] = entry
+	a.senders[entry.From] = append(a.senders[entry.From], hash)
+	a.order = append(a.order, hash)
+	a.dirty = true
+}
+
+// evict removes the oldest archived transaction.
+func (a *txArchive) evict() {
+	hash := a.order[0]
+	a.order = a.order[1:]
+
+	entry := a.txs[hash]
+	delete(a.txs, hash)
+
+	hashes := a.senders[entry.From]
+	for i, h := range hashes {
+		if h == hash {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			break
+		}
+	}
+	if len(hashes) == 0 {
+		delete(a.senders, entry.From)
+	} else {
+		a.senders[entry.From] = hashes
+	}
+}
+
+// get retrieves an archived transaction by hash.
+func (a *txArchive) get(hash common.Hash) *ArchivedTx {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	return a.txs[hash]
+}
+
+// from retrieves the archived transactions of a sender, oldest first.
+func (a *txArchive) from(addr common.Address) []*ArchivedTx {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	hashes := a.senders[addr]
+	entries := make([]*ArchivedTx, len(hashes))
+	for i, hash := range hashes {
+		entries[i] = a.txs[hash]
+	}
+	return entries
+}
+
+// load reads the archived transactions persisted previously.
+func (a *txArchive) load() error {
+	input, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	stream := rlp.NewStream(input, 0)
+	for {
+		entry := new(ArchivedTx)
+		if err := stream.Decode(entry); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			a.dirty = false
+			log.Info("Loaded transaction archive", "transactions", len(a.order))
+			return err
+		}
+		a.add(entry)
+	}
+}
+
+// save persists the archived transactions if any changed since last saved.
+func (a *txArchive) save() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.path == "" || !a.dirty {
+		return nil
+	}
+	output, err := os.OpenFile(a.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, hash := range a.order {
+		if err := rlp.Encode(output, a.txs[hash]); err != nil {
+			output.Close()
+			return err
+		}
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(a.path+".new", a.path); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// archiveTxs archives transactions dropped from the pool for the given reason,
+// if the archive is enabled.
+func (pool *TxPool) archiveTxs(txs types.Transactions, reason string) {
+	if pool.archive == nil {
+		return
+	}
+	for _, tx := range txs {
+		pool.archiveTx(tx, reason, common.Hash{})
+	}
+}
+
+// setIncluded records the transactions included in the chain since the last
+// reset, to tell them apart from the ones whose nonce was used by others.
+func (pool *TxPool) setIncluded(txs types.Transactions) {
+	if pool.archive == nil {
+		return
+	}
+	pool.included = make(map[common.Hash]struct{}, len(txs))
+	for _, tx := range txs {
+		pool.included[tx.Hash()] = struct{}{}
+	}
+}
+
+// archiveStale archives transactions dropped for their nonce being too low. The
+// ones included in the chain are labelled as such if keepIncluded is set, and
+// left out otherwise. Nothing is archived if the included transactions are
+// unknown, such as after a deep reorg.
+func (pool *TxPool) archiveStale(txs types.Transactions, keepIncluded bool) {
+	if pool.archive == nil || pool.included == nil {
+		return
+	}
+	for _, tx := range txs {
+		reason := TxDropNonceTooLow
+		if _, ok := pool.included[tx.Hash()]; ok {
+			if !keepIncluded {
+				continue
+			}
+			reason = TxDropIncluded
+		}
+		pool.archiveTx(tx, reason, common.Hash{})
+	}
+}
+
+// archiveTx archives a transaction dropped from the pool, if the archive is
+// enabled.
+func (pool *TxPool) archiveTx(tx *types.Transaction, reason string, replacedBy common.Hash) {
+	if pool.archive == nil {
+		return
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	pool.archive.add(&ArchivedTx{
+		Tx:         tx,
+		From:       from,
+		Reason:     reason,
+		ReplacedBy: replacedBy,
+		Time:       uint64(time.Now().Unix()),
+	})
+}
+
+// ArchivedTx retrieves a transaction that left the pool without being included,
+// nil if it's unknown or the archive is disabled.
+func (pool *TxPool) ArchivedTx(hash common.Hash) *ArchivedTx {
+	if pool.archive == nil {
+		return nil
+	}
+	return pool.archive.get(hash)
+}
+
+// ArchivedTxsFrom retrieves the transactions of a sender that left the pool
+// without being included, oldest first.
+func (pool *TxPool) ArchivedTxsFrom(addr common.Address) []*ArchivedTx {
+	if pool.archive == nil {
+		return nil
+	}
+	return pool.archive.from(addr)
+}
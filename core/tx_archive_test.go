@@ -0,0 +1,148 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that transactions leaving the pool without inclusion are archived with
+// the reason they were dropped, and that the archive survives restarts.
+func TestTransactionArchive(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "txarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.ArchiveLimit = 2
+	config.ArchiveFile = filepath.Join(dir, "txarchive.rlp")
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	// Replaced transactions are archived along with their replacement
+	original := pricedTransaction(0, 100000, big.NewInt(1), key)
+	replacement := pricedTransaction(0, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(original); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(replacement); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	entry := pool.ArchivedTx(original.Hash())
+	if entry == nil || entry.Reason != TxDropReplaced || entry.ReplacedBy != replacement.Hash() || entry.From != from {
+		t.Fatalf("replaced transaction archive mismatch: %+v", entry)
+	}
+	// Underpriced transactions are archived when the price limit is bumped
+	pool.SetGasPrice(big.NewInt(10))
+	if entry := pool.ArchivedTx(replacement.Hash()); entry == nil || entry.Reason != TxDropUnderpriced {
+		t.Fatalf("underpriced transaction archive mismatch: %+v", entry)
+	}
+	// The oldest transactions are evicted once the archive is full
+	future := pricedTransaction(2, 100000, big.NewInt(10), key)
+	other := pricedTransaction(2, 100000, big.NewInt(20), key)
+	if err := pool.addRemoteSync(future); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(other); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	if pool.ArchivedTx(original.Hash()) != nil {
+		t.Fatalf("oldest transaction not evicted")
+	}
+	if entries := pool.ArchivedTxsFrom(from); len(entries) != 2 || entries[0].Tx.Hash() != replacement.Hash() || entries[1].Tx.Hash() != future.Hash() {
+		t.Fatalf("sender archive mismatch: %v", entries)
+	}
+	// The archive is persisted across restarts
+	pool.Stop()
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if entries := pool.ArchivedTxsFrom(from); len(entries) != 2 || entries[1].Reason != TxDropReplaced || entries[1].ReplacedBy != other.Hash() {
+		t.Fatalf("reloaded archive mismatch: %v", entries)
+	}
+}
+
+// Tests that transactions dropped for their nonce being too low are told apart
+// by whether they were included in the chain.
+func TestTransactionArchiveStale(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.ArchiveLimit = 16
+	config.ArchiveFile = ""
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	var (
+		included = transaction(0, 100000, key)
+		reorged  = transaction(1, 100000, key)
+		queued   = transaction(5, 100000, key)
+	)
+	for _, tx := range []*types.Transaction{included, reorged, queued} {
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	// The nonces of all of them are used by the chain, but only some of them were
+	// included in it
+	pool.mu.Lock()
+	pool.setIncluded(types.Transactions{included, queued})
+	pool.currentState.SetNonce(from, 6)
+	pool.demoteUnexecutables()
+	pool.promoteExecutables([]common.Address{from})
+	pool.mu.Unlock()
+
+	if entry := pool.ArchivedTx(included.Hash()); entry != nil {
+		t.Fatalf("included pending transaction archived: %+v", entry)
+	}
+	if entry := pool.ArchivedTx(reorged.Hash()); entry == nil || entry.Reason != TxDropNonceTooLow {
+		t.Fatalf("reorged transaction archive mismatch: %+v", entry)
+	}
+	if entry := pool.ArchivedTx(queued.Hash()); entry == nil || entry.Reason != TxDropIncluded {
+		t.Fatalf("included queued transaction archive mismatch: %+v", entry)
+	}
+}
@@ -148,6 +148,9 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	ArchiveLimit int    // Maximum number of transactions dropped without inclusion to archive (0 = disabled)
+	ArchiveFile  string // File to persist the archive of dropped transactions in across node restarts
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -165,6 +168,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	ArchiveFile: "txarchive.rlp",
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -229,6 +234,9 @@ type TxPool struct {
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
+	archive *txArchive  // Archive of transactions dropped without inclusion, if enabled
+
+	included map[common.Hash]struct{} // Transactions included since the last reset, nil if unknown or not archiving
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
@@ -283,6 +291,9 @@ func NewTxPool(config TxPoolConfig, chainconfig ctypes.ChainConfigurator, chain
 		pool.locals.add(addr)
 	}
 	pool.priced = newTxPricedList(pool.all)
+	if config.ArchiveLimit > 0 {
+		pool.archive = newTxArchive(config.ArchiveLimit, config.ArchiveFile)
+	}
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// Start the reorg loop early so it can handle requests generated during journal loading.
@@ -371,6 +382,7 @@ func (pool *TxPool) loop() {
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
+					pool.archiveTxs(list, TxDropExpired)
 					for _, tx := range list {
 						pool.removeTx(tx.Hash(), true)
 					}
@@ -388,6 +400,11 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+			if pool.archive != nil {
+				if err := pool.archive.save(); err != nil {
+					log.Warn("Failed to save transaction archive", "err", err)
+				}
+			}
 		}
 	}
 }
@@ -404,6 +421,11 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.archive != nil {
+		if err := pool.archive.save(); err != nil {
+			log.Warn("Failed to save transaction archive", "err", err)
+		}
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -428,7 +450,9 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	defer pool.mu.Unlock()
 
 	pool.gasPrice = price
-	for _, tx := range pool.priced.Cap(price, pool.locals) {
+	drop := pool.priced.Cap(price, pool.locals)
+	pool.archiveTxs(drop, TxDropUnderpriced)
+	for _, tx := range drop {
 		pool.removeTx(tx.Hash(), false)
 	}
 	log.Info("Transaction pool price threshold updated", "price", price)
@@ -601,6 +625,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxMeter.Mark(1)
+			pool.archiveTx(tx, TxDropUnderpriced, common.Hash{})
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -618,6 +643,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.archiveTx(old, TxDropReplaced, hash)
 		}
 		pool.all.Add(tx)
 		pool.priced.Put(tx)
@@ -670,6 +696,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.archiveTx(old, TxDropReplaced, hash)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -721,6 +748,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
+		pool.archiveTx(old, TxDropReplaced, hash)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
@@ -754,6 +782,35 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// Validate checks a transaction against the rules it would be added to the pool by,
+// local ones like AddLocals or remote ones like AddRemotes, without adding it.
+func (pool *TxPool) Validate(tx *types.Transaction, local bool) error {
+	local = local && !pool.config.NoLocals
+
+	pool.mu.Lock() // Pricing queries discard stale price points
+	defer pool.mu.Unlock()
+
+	if pool.all.Get(tx.Hash()) != nil {
+		return ErrAlreadyKnown
+	}
+	if err := pool.validateTx(tx, local); err != nil {
+		return err
+	}
+	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
+		if !local && pool.priced.Underpriced(tx, pool.locals) {
+			return ErrUnderpriced
+		}
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	if list := pool.pending[from]; list != nil && !list.Replaceable(tx, pool.config.PriceBump) {
+		return ErrReplaceUnderpriced
+	}
+	if list := pool.queue[from]; list != nil && !list.Replaceable(tx, pool.config.PriceBump) {
+		return ErrReplaceUnderpriced
+	}
+	return nil
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -1107,6 +1164,8 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	var reinject types.Transactions
 
 	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
+		pool.included = nil
+
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
 		oldNum := oldHead.Number.Uint64()
 		newNum := newHead.Number.Uint64()
@@ -1125,44 +1184,53 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 				// head from the chain.
 				// If that is the case, we don't have the lost transactions any more, and
 				// there's nothing to add
-				if newNum < oldNum {
-					// If the reorg ended up on a lower number, it's indicative of setHead being the cause
-					log.Debug("Skipping transaction reset caused by setHead",
-						"old", oldHead.Hash(), "oldnum", oldNum, "new", newHead.Hash(), "newnum", newNum)
-				} else {
+				if newNum >= oldNum {
 					// If we reorged to a same or higher number, then it's not a case of setHead
 					log.Warn("Transaction pool reset with missing oldhead",
 						"old", oldHead.Hash(), "oldnum", oldNum, "new", newHead.Hash(), "newnum", newNum)
-				}
-				return
-			}
-			for rem.NumberU64() > add.NumberU64() {
-				discarded = append(discarded, rem.Transactions()...)
-				if rem = pool.chain.GetBlock(rem.ParentHash(), rem.NumberU64()-1); rem == nil {
-					log.Error("Unrooted old chain seen by tx pool", "block", oldHead.Number, "hash", oldHead.Hash())
 					return
 				}
-			}
-			for add.NumberU64() > rem.NumberU64() {
-				included = append(included, add.Transactions()...)
-				if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
-					log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
-					return
+				// If the reorg ended up on a lower number, it's indicative of setHead being the cause
+				log.Debug("Skipping transaction reset caused by setHead",
+					"old", oldHead.Hash(), "oldnum", oldNum, "new", newHead.Hash(), "newnum", newNum)
+				// We still need to update the current state s.th. the lost transactions can be readded by the user
+			} else {
+				for rem.NumberU64() > add.NumberU64() {
+					discarded = append(discarded, rem.Transactions()...)
+					if rem = pool.chain.GetBlock(rem.ParentHash(), rem.NumberU64()-1); rem == nil {
+						log.Error("Unrooted old chain seen by tx pool", "block", oldHead.Number, "hash", oldHead.Hash())
+						return
+					}
 				}
-			}
-			for rem.Hash() != add.Hash() {
-				discarded = append(discarded, rem.Transactions()...)
-				if rem = pool.chain.GetBlock(rem.ParentHash(), rem.NumberU64()-1); rem == nil {
-					log.Error("Unrooted old chain seen by tx pool", "block", oldHead.Number, "hash", oldHead.Hash())
-					return
+				for add.NumberU64() > rem.NumberU64() {
+					included = append(included, add.Transactions()...)
+					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
+						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
+						return
+					}
 				}
-				included = append(included, add.Transactions()...)
-				if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
-					log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
-					return
+				for rem.Hash() != add.Hash() {
+					discarded = append(discarded, rem.Transactions()...)
+					if rem = pool.chain.GetBlock(rem.ParentHash(), rem.NumberU64()-1); rem == nil {
+						log.Error("Unrooted old chain seen by tx pool", "block", oldHead.Number, "hash", oldHead.Hash())
+						return
+					}
+					included = append(included, add.Transactions()...)
+					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
+						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
+						return
+					}
 				}
+				reinject = types.TxDifference(discarded, included)
+				pool.setIncluded(included)
+			}
+		}
+	} else {
+		pool.included = nil
+		if oldHead != nil && pool.archive != nil {
+			if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+				pool.setIncluded(block.Transactions())
 			}
-			reinject = types.TxDifference(discarded, included)
 		}
 	}
 	// Initialize the internal state to the current head
@@ -1208,6 +1276,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			pool.all.Remove(hash)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
+		pool.archiveStale(forwards, true)
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
 		for _, tx := range drops {
@@ -1215,6 +1284,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			pool.all.Remove(hash)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
+		pool.archiveTxs(drops, TxDropUnpayable)
 		queuedNofundsMeter.Mark(int64(len(drops)))
 
 		// Gather all executable transactions and promote them
@@ -1238,6 +1308,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
+			pool.archiveTxs(caps, TxDropAccountLimit)
 		}
 		// Mark all the items dropped as removed
 		pool.priced.Removed(len(forwards) + len(drops) + len(caps))
@@ -1303,6 +1374,7 @@ func (pool *TxPool) truncatePending() {
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 					}
 					pool.priced.Removed(len(caps))
+					pool.archiveTxs(caps, TxDropPoolLimit)
 					pendingGauge.Dec(int64(len(caps)))
 					if pool.locals.contains(offenders[i]) {
 						localGauge.Dec(int64(len(caps)))
@@ -1330,6 +1402,7 @@ func (pool *TxPool) truncatePending() {
 					log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 				}
 				pool.priced.Removed(len(caps))
+				pool.archiveTxs(caps, TxDropPoolLimit)
 				pendingGauge.Dec(int64(len(caps)))
 				if pool.locals.contains(addr) {
 					localGauge.Dec(int64(len(caps)))
@@ -1369,7 +1442,9 @@ func (pool *TxPool) truncateQueue() {
 
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
-			for _, tx := range list.Flatten() {
+			txs := list.Flatten()
+			pool.archiveTxs(txs, TxDropPoolLimit)
+			for _, tx := range txs {
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1379,6 +1454,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.archiveTx(txs[i], TxDropPoolLimit, common.Hash{})
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1394,13 +1470,15 @@ func (pool *TxPool) demoteUnexecutables() {
 	for addr, list := range pool.pending {
 		nonce := pool.currentState.GetNonce(addr)
 
-		// Drop all transactions that are deemed too old (low nonce)
+		// Drop all transactions that are deemed too old (low nonce). These are mostly
+		// included in the chain, so only the ones invalidated by a reorg are archived.
 		olds := list.Forward(nonce)
 		for _, tx := range olds {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
+		pool.archiveStale(olds, false)
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
 		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
 		for _, tx := range drops {
@@ -1410,6 +1488,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		}
 		pool.priced.Removed(len(olds) + len(drops))
 		pendingNofundsMeter.Mark(int64(len(drops)))
+		pool.archiveTxs(drops, TxDropUnpayable)
 
 		for _, tx := range invalids {
 			hash := tx.Hash()
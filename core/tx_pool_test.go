@@ -1659,6 +1659,48 @@ func TestTransactionDeduplication(t *testing.T) {
 
 // Tests that the pool rejects replacement transactions that don't meet the minimum
 // price bump required.
+// Tests that transactions are validated against the pool rules without being
+// added to the pool.
+func TestTransactionValidate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+	pool.currentState.SetNonce(from, 1)
+
+	if err := pool.Validate(transaction(0, 100000, key), false); err != ErrNonceTooLow {
+		t.Errorf("stale nonce error mismatch: have %v, want %v", err, ErrNonceTooLow)
+	}
+	if err := pool.Validate(pricedTransaction(1, 100000, big.NewInt(100000), key), false); err != ErrInsufficientFunds {
+		t.Errorf("insufficient funds error mismatch: have %v, want %v", err, ErrInsufficientFunds)
+	}
+	if err := pool.Validate(transaction(1, 20000, key), false); err != ErrIntrinsicGas {
+		t.Errorf("intrinsic gas error mismatch: have %v, want %v", err, ErrIntrinsicGas)
+	}
+	tx := transaction(1, 100000, key)
+	if err := pool.Validate(tx, false); err != nil {
+		t.Fatalf("valid transaction rejected: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending+queued != 0 {
+		t.Fatalf("validated transaction added: %d pending, %d queued", pending, queued)
+	}
+	if err := pool.addRemoteSync(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.Validate(tx, false); err != ErrAlreadyKnown {
+		t.Errorf("known transaction error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if err := pool.Validate(pricedTransaction(1, 100001, big.NewInt(1), key), false); err != ErrReplaceUnderpriced {
+		t.Errorf("underpriced replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.Validate(pricedTransaction(1, 100000, big.NewInt(2), key), false); err != nil {
+		t.Errorf("valid replacement rejected: %v", err)
+	}
+}
+
 func TestTransactionReplacement(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,29 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "github.com/ethereum/go-ethereum/common"
+
+// ContractCreation is a contract deployed by a transaction, either directly or by
+// one of the contracts it called.
+type ContractCreation struct {
+	Address  common.Address // Address of the deployed contract
+	Creator  common.Address // Account executing the deployment: the sender or a contract
+	CodeHash common.Hash    // Hash of the code stored by the deployment
+	TxHash   common.Hash    // Hash of the deploying transaction
+	TxIndex  uint           // Index of the deploying transaction in the block
+}
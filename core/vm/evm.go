@@ -135,8 +135,8 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig ctypes.ChainConfigurator,
 		StateDB:     statedb,
 		vmConfig:    vmConfig,
 		chainConfig: chainConfig,
-		// The list of interpreters, space reserved for both EVM and EWASM ones.
-		interpreters: make([]Interpreter, 0, 2),
+		// The list of interpreters, space reserved for the EWASM, EVMC and built-in EVM ones.
+		interpreters: make([]Interpreter, 0, 3),
 	}
 
 	// In some implementations, EWASM may be configured with a block number.
@@ -145,11 +145,12 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig ctypes.ChainConfigurator,
 		evm.interpreters = append(evm.interpreters, &EVMC{ewasmModule, evm, evmc.CapabilityEWASM, false})
 	}
 
+	// The built-in interpreter is kept as a fallback for the blocks whose rules
+	// an external EVM can't be configured with.
 	if vmConfig.EVMInterpreter != "" {
 		evm.interpreters = append(evm.interpreters, &EVMC{evmModule, evm, evmc.CapabilityEVM1, false})
-	} else {
-		evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	}
+	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 
 	evm.interpreter = evm.interpreters[0]
 
@@ -453,6 +454,8 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
+	} else {
+		evm.StateDB.AddCreation(caller.Address(), address)
 	}
 	// Assign err if contract code size exceeds the max while the err is still empty.
 	if maxCodeSizeExceeded && err == nil {
@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/evmc/bindings/go/evmc"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/holiman/uint256"
 )
@@ -298,32 +299,75 @@ func (host *hostContext) Call(kind evmc.CallKind,
 	return output, gasLeft, createAddr, err
 }
 
-// getRevision translates ChainConfig's HF block information into EVMC revision.
-func getRevision(env *EVM) evmc.Revision {
-	n := env.BlockNumber
-	conf := env.ChainConfig()
-	switch {
-	// This is an example of choosing to use an "abstracted" idea
-	// about chain config, where I'm choosing to prioritize "indicative" features
-	// as identifiers for Fork-Feature-Groups. Note that this is very different
-	// than using Feature-complete sets to assert "did Forkage."
-	case conf.IsEnabled(conf.GetEIP1884Transition, n):
-		return evmc.Istanbul
-	case conf.IsEnabled(conf.GetEIP1283DisableTransition, n):
-		return evmc.Petersburg
-	case conf.IsEnabled(conf.GetEIP145Transition, n):
-		return evmc.Constantinople
-	case conf.IsEnabled(conf.GetEIP198Transition, n):
-		return evmc.Byzantium
-	case conf.IsEnabled(conf.GetEIP155Transition, n):
-		return evmc.SpuriousDragon
-	case conf.IsEnabled(conf.GetEIP150Transition, n):
-		return evmc.TangerineWhistle
-	case conf.IsEnabled(conf.GetEIP7Transition, n):
-		return evmc.Homestead
-	default:
-		return evmc.Frontier
+// evmcRevisions lists the EVMC revisions along with the protocol changes they
+// introduce which are visible to the EVM, i.e. not implemented by the host
+// (e.g. precompiles) or outside of the EVM (e.g. transaction validation).
+var evmcRevisions = []struct {
+	revision evmc.Revision
+	eips     []func(ctypes.ChainConfigurator) *uint64
+}{
+	{evmc.Homestead, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP7Transition,
+	}},
+	{evmc.TangerineWhistle, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP150Transition,
+	}},
+	{evmc.SpuriousDragon, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP160Transition,
+		ctypes.ChainConfigurator.GetEIP161abcTransition,
+		ctypes.ChainConfigurator.GetEIP170Transition,
+	}},
+	{evmc.Byzantium, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP140Transition,
+		ctypes.ChainConfigurator.GetEIP211Transition,
+		ctypes.ChainConfigurator.GetEIP214Transition,
+	}},
+	{evmc.Petersburg, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP145Transition,
+		ctypes.ChainConfigurator.GetEIP1014Transition,
+		ctypes.ChainConfigurator.GetEIP1052Transition,
+	}},
+	{evmc.Istanbul, []func(ctypes.ChainConfigurator) *uint64{
+		ctypes.ChainConfigurator.GetEIP1344Transition,
+		ctypes.ChainConfigurator.GetEIP1884Transition,
+		ctypes.ChainConfigurator.GetEIP2200Transition,
+	}},
+}
+
+// getRevision translates the protocol changes enabled by the chain configuration
+// at a block into the EVMC revision implementing them.
+//
+// Revisions are identified by their feature sets rather than by the Ethereum fork
+// blocks, so that chains enabling them at other blocks (e.g. Ethereum Classic's
+// Atlantis, Agharta and Phoenix) are mapped too. If the enabled changes don't match
+// a revision exactly (e.g. Ethereum Classic's Die Hard, enabling EIP-160 alone),
+// false is returned.
+func getRevision(conf ctypes.ChainConfigurator, n *big.Int) (evmc.Revision, bool) {
+	var (
+		revision = evmc.Frontier
+		complete = true // Whether all the changes of the revisions so far are enabled
+	)
+	for _, rev := range evmcRevisions {
+		count := 0
+		for _, eip := range rev.eips {
+			if conf.IsEnabled(func() *uint64 { return eip(conf) }, n) {
+				count++
+			}
+		}
+		switch {
+		case count == 0:
+			complete = false
+		case count < len(rev.eips) || !complete:
+			return revision, false
+		default:
+			revision = rev.revision
+		}
+	}
+	// Constantinople is Petersburg with EIP-1283, removed by the latter
+	if revision == evmc.Petersburg && conf.IsEnabled(conf.GetEIP1283Transition, n) && !conf.IsEnabled(conf.GetEIP1283DisableTransition, n) {
+		revision = evmc.Constantinople
 	}
+	return revision, true
 }
 
 // Run implements Interpreter.Run().
@@ -349,9 +393,10 @@ func (evm *EVMC) Run(contract *Contract, input []byte, readOnly bool) (ret []byt
 		defer func() { evm.readOnly = false }()
 	}
 
+	revision, _ := getRevision(evm.env.ChainConfig(), evm.env.BlockNumber)
 	output, gasLeft, err := evm.instance.Execute(
 		&hostContext{evm.env, contract},
-		getRevision(evm.env),
+		revision,
 		kind,
 		evm.readOnly,
 		evm.env.depth-1,
@@ -383,5 +428,15 @@ func (evm *EVMC) CanRun(code []byte) bool {
 	if bytes.HasPrefix(code, wasmPreamble) {
 		required = evmc.CapabilityEWASM
 	}
-	return evm.cap == required
+	if evm.cap != required {
+		return false
+	}
+	// Leave the code to the built-in interpreter if the active protocol changes
+	// can't be expressed as an EVMC revision.
+	if required == evmc.CapabilityEVM1 {
+		if _, ok := getRevision(evm.env.ChainConfig(), evm.env.BlockNumber); !ok {
+			return false
+		}
+	}
+	return true
 }
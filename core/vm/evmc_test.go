@@ -0,0 +1,55 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/evmc/bindings/go/evmc"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+func TestEVMCRevision(t *testing.T) {
+	tests := []struct {
+		config   ctypes.ChainConfigurator
+		number   int64
+		revision evmc.Revision
+		ok       bool
+	}{
+		{params.MainnetChainConfig, 0, evmc.Frontier, true},
+		{params.MainnetChainConfig, 2675000, evmc.SpuriousDragon, true},
+		{params.MainnetChainConfig, 7280000, evmc.Petersburg, true},
+		{params.MainnetChainConfig, 9069000, evmc.Istanbul, true},
+		{params.RopstenChainConfig, 4230000, evmc.Constantinople, true},
+		{params.RopstenChainConfig, 4939394, evmc.Petersburg, true},
+
+		{params.ClassicChainConfig, 1150000, evmc.Homestead, true},
+		{params.ClassicChainConfig, 2500000, evmc.TangerineWhistle, true},
+		{params.ClassicChainConfig, 3000000, 0, false}, // Die Hard: EIP-160 without EIP-161
+		{params.ClassicChainConfig, 8772000, evmc.Byzantium, true},
+		{params.ClassicChainConfig, 9573000, evmc.Petersburg, true},
+		{params.ClassicChainConfig, 10500839, evmc.Istanbul, true},
+	}
+	for i, tt := range tests {
+		revision, ok := getRevision(tt.config, big.NewInt(tt.number))
+		if ok != tt.ok || (ok && revision != tt.revision) {
+			t.Errorf("test %d: revision mismatch: have %v/%v, want %v/%v", i, revision, ok, tt.revision, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+// ActiveOpcode is an opcode enabled at a block, along with its gas schedule.
+type ActiveOpcode struct {
+	Op          OpCode
+	ConstantGas uint64
+	DynamicGas  bool // Whether a dynamic cost is charged on top of the constant one
+}
+
+// ActiveOpcodes returns the opcodes enabled at the given block under the chain
+// config, in opcode order.
+func ActiveOpcodes(config ctypes.ChainConfigurator, bn *big.Int) []ActiveOpcode {
+	var (
+		table = instructionSetForConfig(config, bn)
+		ops   []ActiveOpcode
+	)
+	for i, operation := range table {
+		if operation == nil {
+			continue
+		}
+		ops = append(ops, ActiveOpcode{
+			Op:          OpCode(i),
+			ConstantGas: operation.constantGas,
+			DynamicGas:  operation.dynamicGas != nil,
+		})
+	}
+	return ops
+}
+
+// PrecompileName returns the name of a precompiled contract, suffixed with the
+// gas schedule it's priced by if it was repriced.
+func PrecompileName(p PrecompiledContract) string {
+	switch p.(type) {
+	case *ecrecover:
+		return "ecrecover"
+	case *sha256hash:
+		return "sha256"
+	case *ripemd160hash:
+		return "ripemd160"
+	case *dataCopy:
+		return "identity"
+	case *bigModExp:
+		return "modexp"
+	case *bn256AddByzantium:
+		return "bn256Add/byzantium"
+	case *bn256AddIstanbul:
+		return "bn256Add/istanbul"
+	case *bn256ScalarMulByzantium:
+		return "bn256ScalarMul/byzantium"
+	case *bn256ScalarMulIstanbul:
+		return "bn256ScalarMul/istanbul"
+	case *bn256PairingByzantium:
+		return "bn256Pairing/byzantium"
+	case *bn256PairingIstanbul:
+		return "bn256Pairing/istanbul"
+	case *blake2F:
+		return "blake2f"
+	case *bls12381G1Add:
+		return "bls12381G1Add"
+	case *bls12381G1Mul:
+		return "bls12381G1Mul"
+	case *bls12381G1MultiExp:
+		return "bls12381G1MultiExp"
+	case *bls12381G2Add:
+		return "bls12381G2Add"
+	case *bls12381G2Mul:
+		return "bls12381G2Mul"
+	case *bls12381G2MultiExp:
+		return "bls12381G2MultiExp"
+	case *bls12381Pairing:
+		return "bls12381Pairing"
+	case *bls12381MapG1:
+		return "bls12381MapG1"
+	case *bls12381MapG2:
+		return "bls12381MapG2"
+	default:
+		return "unknown"
+	}
+}
+
+// SstoreGasMetering returns the SSTORE gas metering in effect at the given block
+// under the chain config: legacy, eip1283 (net metering, Constantinople) or
+// eip2200 (net metering with the stipend check, Istanbul).
+func SstoreGasMetering(config ctypes.ChainConfigurator, bn *big.Int) string {
+	if config.IsEnabled(config.GetEIP2200Transition, bn) && !config.IsEnabled(config.GetEIP2200DisableTransition, bn) {
+		return "eip2200"
+	}
+	if config.IsEnabled(config.GetEIP1283Transition, bn) && !config.IsEnabled(config.GetEIP1283DisableTransition, bn) {
+		return "eip1283"
+	}
+	return "legacy"
+}
@@ -38,6 +38,8 @@ type Config struct {
 	EVMInterpreter   string // External EVM interpreter options
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	OpcodeStats *OpcodeStats // Collects per-opcode execution statistics, if set
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -266,6 +268,16 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			logged = true
 		}
 
+		if in.cfg.OpcodeStats != nil {
+			// The gas forwarded to calls is used by the callee, not the opcode
+			used := cost
+			switch op {
+			case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+				used -= in.evm.callGasTemp
+			}
+			in.cfg.OpcodeStats.record(op, used)
+		}
+
 		// execute the operation
 		res, err = operation.execute(&pc, in, callContext)
 		// if the operation clears the return data (e.g. it has returning data)
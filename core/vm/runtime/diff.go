@@ -0,0 +1,101 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ExecFunc executes code in the EVM with the given configuration, e.g. by
+// invoking Call or Create.
+type ExecFunc func(cfg *Config) (ret []byte, leftOverGas uint64, err error)
+
+// Result is the outcome of an execution, as compared by Compare.
+type Result struct {
+	Output      []byte
+	LeftOverGas uint64
+	Err         error
+	Root        common.Hash // State root after the execution
+	Logs        []byte      // RLP encoding of the emitted logs
+}
+
+// Divergence describes the first difference found between two executions.
+type Divergence struct {
+	Field string // Name of the diverging part of the result
+	A, B  *Result
+}
+
+func (d *Divergence) String() string {
+	var a, b interface{}
+	switch d.Field {
+	case "output":
+		a, b = fmt.Sprintf("%#x", d.A.Output), fmt.Sprintf("%#x", d.B.Output)
+	case "gas":
+		a, b = d.A.LeftOverGas, d.B.LeftOverGas
+	case "error":
+		a, b = d.A.Err, d.B.Err
+	case "state root":
+		a, b = d.A.Root.Hex(), d.B.Root.Hex()
+	case "logs":
+		a, b = fmt.Sprintf("%#x", d.A.Logs), fmt.Sprintf("%#x", d.B.Logs)
+	}
+	return fmt.Sprintf("%s diverged: %v != %v", d.Field, a, b)
+}
+
+// Compare runs the same execution with two configurations and reports the first
+// divergence between their results, or nil if they agree. The state of a is used
+// as the pre-state of both runs, each executing against its own copy of it, which
+// is left in the State field of its config.
+func Compare(exec ExecFunc, a, b *Config) (*Result, *Result, *Divergence) {
+	pre := a.State
+	if pre == nil {
+		pre, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	}
+	a.State, b.State = pre.Copy(), pre.Copy()
+
+	resA, resB := run(exec, a), run(exec, b)
+	switch {
+	case !bytes.Equal(resA.Output, resB.Output):
+		return resA, resB, &Divergence{"output", resA, resB}
+	case resA.LeftOverGas != resB.LeftOverGas:
+		return resA, resB, &Divergence{"gas", resA, resB}
+	case (resA.Err == nil) != (resB.Err == nil) || (resA.Err != nil && resA.Err.Error() != resB.Err.Error()):
+		return resA, resB, &Divergence{"error", resA, resB}
+	case resA.Root != resB.Root:
+		return resA, resB, &Divergence{"state root", resA, resB}
+	case !bytes.Equal(resA.Logs, resB.Logs):
+		return resA, resB, &Divergence{"logs", resA, resB}
+	}
+	return resA, resB, nil
+}
+
+// run executes the code with a config, collecting the result.
+func run(exec ExecFunc, cfg *Config) *Result {
+	setDefaults(cfg)
+
+	output, leftOverGas, err := exec(cfg)
+	res := &Result{Output: output, LeftOverGas: leftOverGas, Err: err}
+	res.Root = cfg.State.IntermediateRoot(cfg.ChainConfig.IsEnabled(cfg.ChainConfig.GetEIP161dTransition, cfg.BlockNumber))
+	res.Logs, _ = rlp.EncodeToBytes(cfg.State.Logs())
+	return res
+}
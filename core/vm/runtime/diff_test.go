@@ -0,0 +1,74 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/types/goethereum"
+)
+
+func TestCompare(t *testing.T) {
+	petersburg := &goethereum.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      new(big.Int),
+		EIP150Block:         new(big.Int),
+		EIP155Block:         new(big.Int),
+		EIP158Block:         new(big.Int),
+		ByzantiumBlock:      new(big.Int),
+		ConstantinopleBlock: new(big.Int),
+		PetersburgBlock:     new(big.Int),
+	}
+	address := common.BytesToAddress([]byte("contract"))
+	exec := func(cfg *Config) ([]byte, uint64, error) {
+		return Call(address, nil, cfg)
+	}
+	newConfig := func(eips ...int) *Config {
+		return &Config{ChainConfig: petersburg, GasLimit: 100000, EVMConfig: vm.Config{ExtraEips: eips}}
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(address, []byte{
+		byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.SSTORE), // Modify the state
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), // Repriced by EIP-1884
+		byte(vm.STOP),
+	})
+	// Identical configurations agree, and leave the pre-state untouched
+	a := newConfig()
+	a.State = statedb
+	resA, resB, div := Compare(exec, a, newConfig())
+	if div != nil {
+		t.Fatalf("identical configs diverged: %v", div)
+	}
+	if resA.Root != resB.Root || resA.Root == statedb.IntermediateRoot(true) {
+		t.Fatalf("state roots mismatch")
+	}
+	// Enabling an EIP is detected
+	a = newConfig()
+	a.State = statedb
+	resA, resB, div = Compare(exec, a, newConfig(1884))
+	if div == nil || div.Field != "gas" {
+		t.Fatalf("divergence mismatch: have %v, want gas", div)
+	}
+	if have := resA.LeftOverGas - resB.LeftOverGas; have != 600 {
+		t.Fatalf("gas divergence mismatch: have %d, want 600", have)
+	}
+}
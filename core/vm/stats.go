@@ -0,0 +1,95 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// opcodeStatsBuckets are the upper bounds of the gas cost histogram buckets, the
+// last one collecting anything above.
+var opcodeStatsBuckets = [...]uint64{2, 3, 5, 10, 100, 1000, 10000, 100000}
+
+// OpcodeStats collects the number of executions and the gas used by each opcode
+// run by the built-in interpreter. It's safe for concurrent use.
+type OpcodeStats struct {
+	counts  [256]uint64
+	gas     [256]uint64
+	buckets [256][len(opcodeStatsBuckets) + 1]uint64
+}
+
+// OpcodeStat is the summary of the executions of an opcode.
+type OpcodeStat struct {
+	Count     uint64            `json:"count"`
+	Gas       uint64            `json:"gas"`
+	Histogram map[string]uint64 `json:"histogram"` // Cumulative executions by gas cost upper bound
+}
+
+// record accounts an execution of an opcode, with the gas it used.
+func (s *OpcodeStats) record(op OpCode, gas uint64) {
+	atomic.AddUint64(&s.counts[op], 1)
+	atomic.AddUint64(&s.gas[op], gas)
+
+	bucket := len(opcodeStatsBuckets)
+	for i, limit := range opcodeStatsBuckets {
+		if gas <= limit {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddUint64(&s.buckets[op][bucket], 1)
+}
+
+// Snapshot returns the statistics of the opcodes executed so far, keyed by their
+// names.
+func (s *OpcodeStats) Snapshot() map[string]*OpcodeStat {
+	stats := make(map[string]*OpcodeStat)
+	for op := range s.counts {
+		count := atomic.LoadUint64(&s.counts[op])
+		if count == 0 {
+			continue
+		}
+		stat := &OpcodeStat{
+			Count:     count,
+			Gas:       atomic.LoadUint64(&s.gas[op]),
+			Histogram: make(map[string]uint64),
+		}
+		var total uint64
+		for i := range s.buckets[op] {
+			total += atomic.LoadUint64(&s.buckets[op][i])
+			if i < len(opcodeStatsBuckets) {
+				stat.Histogram[strconv.FormatUint(opcodeStatsBuckets[i], 10)] = total
+			} else {
+				stat.Histogram["+Inf"] = total
+			}
+		}
+		stats[OpCode(op).String()] = stat
+	}
+	return stats
+}
+
+// Reset clears the collected statistics.
+func (s *OpcodeStats) Reset() {
+	for op := range s.counts {
+		atomic.StoreUint64(&s.counts[op], 0)
+		atomic.StoreUint64(&s.gas[op], 0)
+		for i := range s.buckets[op] {
+			atomic.StoreUint64(&s.buckets[op][i], 0)
+		}
+	}
+}
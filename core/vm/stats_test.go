@@ -0,0 +1,80 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestOpcodeStats(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.CreateAccount(address)
+	statedb.SetCode(address, []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0xff,
+		byte(PUSH2), 0x10, 0x00, byte(CALL),
+		byte(STOP),
+	})
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	stats := new(OpcodeStats)
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{OpcodeStats: stats})
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("failed to run code: %v", err)
+	}
+	snapshot := stats.Snapshot()
+	if len(snapshot) != 4 {
+		t.Fatalf("opcode count mismatch: have %d, want 4", len(snapshot))
+	}
+	tests := map[string]struct {
+		count, gas uint64
+		histogram  map[string]uint64
+	}{
+		"PUSH1": {6, 18, map[string]uint64{"2": 0, "3": 6, "+Inf": 6}},
+		"PUSH2": {1, 3, map[string]uint64{"3": 1}},
+		"CALL":  {1, 700, map[string]uint64{"100": 0, "1000": 1, "+Inf": 1}}, // Forwarded gas excluded
+		"STOP":  {1, 0, map[string]uint64{"2": 1}},
+	}
+	for op, want := range tests {
+		have := snapshot[op]
+		if have == nil {
+			t.Fatalf("%s: missing stats", op)
+		}
+		if have.Count != want.count || have.Gas != want.gas {
+			t.Errorf("%s: stats mismatch: have %d/%d, want %d/%d", op, have.Count, have.Gas, want.count, want.gas)
+		}
+		for bound, count := range want.histogram {
+			if have.Histogram[bound] != count {
+				t.Errorf("%s: histogram bucket %s mismatch: have %d, want %d", op, bound, have.Histogram[bound], count)
+			}
+		}
+	}
+	stats.Reset()
+	if snapshot := stats.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("stats not reset: %v", snapshot)
+	}
+}
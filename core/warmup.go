@@ -0,0 +1,145 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	warmupTrieDepth    = 4      // Nibbles of the state trie paths preloaded around the root
+	warmupTrieNodes    = 100000 // Maximum number of state trie nodes preloaded around the root
+	warmupProfileSize  = 65536  // Number of accounts tracked in the snapshot access profile
+	warmupTrieAccounts = 1024   // Number of accounts resolved on a trie before releasing its nodes
+)
+
+// EnableCacheWarmup preloads the recent headers and blocks, the state trie
+// around the head and the recently accessed accounts into the caches in the
+// background, to avoid the latency spike of serving cold data after a restart.
+//
+// The accounts read from the snapshot are tracked from now on and saved on Stop,
+// to guide the next warmup. Without such a profile, the recipients of the
+// transactions of the recent blocks are preloaded instead.
+func (bc *BlockChain) EnableCacheWarmup() {
+	if bc.snaps != nil {
+		bc.snapProfile = snapshot.NewAccessProfile(warmupProfileSize)
+		bc.snaps.SetAccessProfile(bc.snapProfile)
+	}
+	bc.wg.Add(1)
+	go func() {
+		defer bc.wg.Done()
+		bc.warmCaches(rawdb.ReadSnapshotAccessProfile(bc.db))
+	}()
+}
+
+// warmCaches preloads the caches, preferring the given accounts over the ones
+// derived from the recent blocks.
+func (bc *BlockChain) warmCaches(accounts []common.Hash) {
+	var (
+		start = time.Now()
+		head  = bc.CurrentBlock()
+
+		headers, blocks, nodes, resolved int
+	)
+	log.Info("Warming up caches", "number", head.NumberU64(), "hash", head.Hash(), "profile", len(accounts))
+
+	// Preload the recent headers, blocks and receipts
+	for number := head.NumberU64(); headers < headerCacheLimit && !bc.warmupAborted(); number-- {
+		header := bc.GetHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		bc.GetTd(header.Hash(), number)
+		headers++
+
+		if blocks < blockCacheLimit {
+			block := bc.GetBlock(header.Hash(), number)
+			if block == nil {
+				break
+			}
+			blocks++
+			if blocks <= receiptsCacheLimit {
+				bc.GetReceiptsByHash(block.Hash())
+			}
+			// Without a profile, guess the hot accounts from the recent transactions
+			if len(accounts) == 0 {
+				for _, tx := range block.Transactions() {
+					if to := tx.To(); to != nil {
+						accounts = append(accounts, crypto.Keccak256Hash(to[:]))
+					}
+				}
+			}
+		}
+		if number == 0 {
+			break
+		}
+	}
+	// Preload the top of the state trie
+	triedb := bc.stateCache.TrieDB()
+	if tr, err := trie.New(head.Root(), triedb); err == nil {
+		it := tr.NodeIterator(nil)
+		for descend := true; nodes < warmupTrieNodes && it.Next(descend); nodes++ {
+			if nodes%1000 == 0 && bc.warmupAborted() {
+				return
+			}
+			descend = len(it.Path()) < warmupTrieDepth
+		}
+	} else {
+		log.Debug("Failed to open state trie for warmup", "root", head.Root(), "err", err)
+	}
+	// Preload the snapshot entries and trie paths of the hot accounts
+	var snap snapshot.Snapshot
+	if bc.snaps != nil {
+		snap = bc.snaps.Snapshot(head.Root())
+	}
+	var tr *trie.Trie
+	for _, hash := range accounts {
+		if bc.warmupAborted() {
+			return
+		}
+		if snap != nil {
+			snap.AccountRLP(hash)
+		}
+		// Recreate the trie periodically not to hold onto all the resolved nodes
+		if resolved%warmupTrieAccounts == 0 {
+			var err error
+			if tr, err = trie.New(head.Root(), triedb); err != nil {
+				break
+			}
+		}
+		tr.TryGet(hash[:])
+		resolved++
+	}
+	log.Info("Warmed up caches", "headers", headers, "blocks", blocks, "nodes", nodes, "accounts", resolved, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// warmupAborted reports whether the chain is shutting down.
+func (bc *BlockChain) warmupAborted() bool {
+	select {
+	case <-bc.quit:
+		return true
+	default:
+		return false
+	}
+}
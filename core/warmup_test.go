@@ -0,0 +1,104 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Tests that the cache warmup preloads the recent chain segment, and that the
+// accounts read from the snapshot disk layer are saved on shutdown to guide
+// the next warmup.
+func TestCacheWarmup(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		idle    = common.Address{0xaa}
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				idle:    {Balance: big.NewInt(1)},
+			},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.GetChainID())
+		db     = rawdb.NewMemoryDatabase()
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := MustCommitGenesis(gendb, gspec)
+	MustCommitGenesis(db, gspec)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 32, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), vars.TxGas, nil, nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, err := NewBlockChain(db, defaultCacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// Drop the caches filled by the import and warm them up again
+	chain.blockCache.Purge()
+	chain.receiptsCache.Purge()
+	chain.hc.headerCache.Purge()
+
+	chain.EnableCacheWarmup()
+	chain.wg.Wait()
+
+	head := chain.CurrentBlock()
+	if !chain.blockCache.Contains(head.Hash()) || !chain.blockCache.Contains(blocks[0].Hash()) {
+		t.Error("recent blocks not preloaded")
+	}
+	if !chain.receiptsCache.Contains(head.Hash()) {
+		t.Error("recent receipts not preloaded")
+	}
+	if !chain.hc.headerCache.Contains(genesis.Hash()) {
+		t.Error("recent headers not preloaded")
+	}
+	// Accounts untouched by the diff layers are read from the disk layer
+	idleHash := crypto.Keccak256Hash(idle[:])
+	if _, err := chain.snaps.Snapshot(head.Root()).AccountRLP(idleHash); err != nil {
+		t.Fatalf("failed to read idle account: %v", err)
+	}
+	chain.Stop()
+
+	var found bool
+	for _, hash := range rawdb.ReadSnapshotAccessProfile(db) {
+		if hash == idleHash {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("accessed account missing from the saved profile")
+	}
+}
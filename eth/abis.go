@@ -0,0 +1,362 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var errNoABI = errors.New("no ABI registered for the address")
+
+// contractABI is a registered contract ABI, along with its JSON definition.
+type contractABI struct {
+	abi abi.ABI
+	raw json.RawMessage
+}
+
+// abiStore holds the contract ABIs registered for decoding logs and transaction
+// inputs, persisted as one JSON file per address in a directory.
+type abiStore struct {
+	dir  string // Directory the ABIs are persisted in, kept in memory only if empty
+	abis map[common.Address]*contractABI
+	lock sync.RWMutex
+}
+
+// newABIStore creates an ABI store persisted in the given directory, loading the
+// ABIs registered previously.
+func newABIStore(dir string) (*abiStore, error) {
+	store := &abiStore{dir: dir, abis: make(map[common.Address]*contractABI)}
+	if dir == "" {
+		return store, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.IsDir() || name == file.Name() || !common.IsHexAddress(name) {
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := abi.JSON(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ABI %s: %v", file.Name(), err)
+		}
+		store.abis[common.HexToAddress(name)] = &contractABI{abi: parsed, raw: raw}
+	}
+	return store, nil
+}
+
+// path returns the file the ABI of the given address is persisted in.
+func (s *abiStore) path(address common.Address) string {
+	return filepath.Join(s.dir, strings.ToLower(address.Hex())+".json")
+}
+
+// register parses and stores the ABI of a contract, replacing any previous one.
+func (s *abiStore) register(address common.Address, raw json.RawMessage) error {
+	parsed, err := abi.JSON(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("invalid ABI: %v", err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.dir != "" {
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			return err
+		}
+		// Write into a temporary file first to never leave a truncated ABI behind
+		tmp := s.path(address) + ".tmp"
+		if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, s.path(address)); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	s.abis[address] = &contractABI{abi: parsed, raw: raw}
+	return nil
+}
+
+// unregister removes the ABI of a contract, reporting whether it was registered.
+func (s *abiStore) unregister(address common.Address) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.abis[address]; !ok {
+		return false, nil
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.path(address)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	delete(s.abis, address)
+	return true, nil
+}
+
+// get retrieves the ABI of a contract, nil if not registered.
+func (s *abiStore) get(address common.Address) *contractABI {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.abis[address]
+}
+
+// addresses returns the addresses having an ABI registered, sorted.
+func (s *abiStore) addresses() []common.Address {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	addresses := make([]common.Address, 0, len(s.abis))
+	for address := range s.abis {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+	return addresses
+}
+
+// DecodedLog is a log along with its event decoded by the ABI registered for the
+// emitting contract, or the reason it couldn't be decoded.
+type DecodedLog struct {
+	Log       *types.Log             `json:"log"`
+	Event     string                 `json:"event,omitempty"`
+	Signature string                 `json:"signature,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// DecodedCall is a transaction input decoded by the ABI registered for the called
+// contract.
+type DecodedCall struct {
+	Method    string                 `json:"method"`
+	Signature string                 `json:"signature"`
+	Args      map[string]interface{} `json:"args"`
+}
+
+// decodeLog decodes a log with the ABI registered for the emitting contract.
+func (s *abiStore) decodeLog(log *types.Log) *DecodedLog {
+	decoded := &DecodedLog{Log: log}
+	contract := s.get(log.Address)
+	if contract == nil {
+		decoded.Error = errNoABI.Error()
+		return decoded
+	}
+	if len(log.Topics) == 0 {
+		decoded.Error = "anonymous events can't be decoded"
+		return decoded
+	}
+	event, err := contract.abi.EventByID(log.Topics[0])
+	if err != nil {
+		decoded.Error = err.Error()
+		return decoded
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	args := make(map[string]interface{})
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		decoded.Error = err.Error()
+		return decoded
+	}
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(args, log.Data); err != nil {
+		decoded.Error = err.Error()
+		return decoded
+	}
+	decoded.Event, decoded.Signature, decoded.Args = event.Name, event.Sig, formatABIArgs(args)
+	return decoded
+}
+
+// decodeInput decodes a call to a contract with the ABI registered for it.
+func (s *abiStore) decodeInput(address common.Address, input []byte) (*DecodedCall, error) {
+	contract := s.get(address)
+	if contract == nil {
+		return nil, errNoABI
+	}
+	method, err := contract.abi.MethodById(input)
+	if err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	if err := method.Inputs.UnpackIntoMap(args, input[4:]); err != nil {
+		return nil, err
+	}
+	return &DecodedCall{Method: method.Name, Signature: method.Sig, Args: formatABIArgs(args)}, nil
+}
+
+// formatABIArgs converts the decoded arguments into their JSON-RPC encoding: hex
+// quantities for integers and hex strings for byte arrays.
+func formatABIArgs(args map[string]interface{}) map[string]interface{} {
+	for name, value := range args {
+		args[name] = formatABIValue(reflect.ValueOf(value))
+	}
+	return args
+}
+
+func formatABIValue(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	switch v := value.Interface().(type) {
+	case *big.Int:
+		return (*hexutil.Big)(v)
+	case []byte:
+		return hexutil.Bytes(v)
+	case encoding.TextMarshaler:
+		return v // Addresses, hashes and the like encode themselves
+	}
+	switch value.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return hexutil.Uint64(value.Uint())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return (*hexutil.Big)(big.NewInt(value.Int()))
+	case reflect.Array, reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			blob := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(blob), value)
+			return hexutil.Bytes(blob)
+		}
+		list := make([]interface{}, value.Len())
+		for i := range list {
+			list[i] = formatABIValue(value.Index(i))
+		}
+		return list
+	}
+	return value.Interface()
+}
+
+// PublicABIAPI decodes logs and transaction inputs with the contract ABIs
+// registered on the node.
+type PublicABIAPI struct {
+	eth *Ethereum
+}
+
+// NewPublicABIAPI creates a new ABI decoding API.
+func NewPublicABIAPI(eth *Ethereum) *PublicABIAPI {
+	return &PublicABIAPI{eth: eth}
+}
+
+// List returns the addresses of the contracts having an ABI registered.
+func (api *PublicABIAPI) List() []common.Address {
+	return api.eth.abis.addresses()
+}
+
+// Get returns the ABI registered for a contract.
+func (api *PublicABIAPI) Get(address common.Address) (json.RawMessage, error) {
+	contract := api.eth.abis.get(address)
+	if contract == nil {
+		return nil, errNoABI
+	}
+	return contract.raw, nil
+}
+
+// DecodeLog decodes a log with the ABI registered for the emitting contract, or
+// names its event from the 4byte database if there's none.
+func (api *PublicABIAPI) DecodeLog(log types.Log) *DecodedLog {
+	return api.decodeLog(&log)
+}
+
+// GetTransactionLogs returns the logs of a transaction, decoded with the ABIs
+// registered for the emitting contracts.
+func (api *PublicABIAPI) GetTransactionLogs(ctx context.Context, hash common.Hash) ([]*DecodedLog, error) {
+	receipt, _, _, _ := rawdb.ReadReceipt(api.eth.ChainDb(), hash, api.eth.blockchain.Config())
+	if receipt == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	logs := make([]*DecodedLog, len(receipt.Logs))
+	for i, log := range receipt.Logs {
+		logs[i] = api.decodeLog(log)
+	}
+	return logs, nil
+}
+
+// DecodeInput decodes a call to a contract with the ABI registered for it, or
+// the 4byte database if there's none.
+func (api *PublicABIAPI) DecodeInput(address common.Address, input hexutil.Bytes) (*DecodedCall, error) {
+	return api.decodeInput(address, input)
+}
+
+// DecodeTransactionInput decodes the input of a transaction with the ABI
+// registered for the called contract.
+func (api *PublicABIAPI) DecodeTransactionInput(ctx context.Context, hash common.Hash) (*DecodedCall, error) {
+	tx, _, _, _ := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		if tx = api.eth.txPool.Get(hash); tx == nil {
+			return nil, fmt.Errorf("transaction %#x not found", hash)
+		}
+	}
+	if tx.To() == nil {
+		return nil, errors.New("contract creations can't be decoded")
+	}
+	return api.decodeInput(*tx.To(), tx.Data())
+}
+
+// PrivateABIAPI manages the contract ABIs registered on the node.
+type PrivateABIAPI struct {
+	eth *Ethereum
+}
+
+// NewPrivateABIAPI creates a new ABI management API.
+func NewPrivateABIAPI(eth *Ethereum) *PrivateABIAPI {
+	return &PrivateABIAPI{eth: eth}
+}
+
+// Register stores the ABI of a contract, given as a JSON array or a string
+// containing it, replacing any previous one. Registered ABIs are persisted in
+// the data directory.
+func (api *PrivateABIAPI) Register(address common.Address, definition json.RawMessage) error {
+	var text string
+	if err := json.Unmarshal(definition, &text); err == nil {
+		definition = json.RawMessage(text)
+	}
+	return api.eth.abis.register(address, definition)
+}
+
+// Unregister removes the ABI of a contract, reporting whether it was registered.
+func (api *PrivateABIAPI) Unregister(address common.Address) (bool, error) {
+	return api.eth.abis.unregister(address)
+}
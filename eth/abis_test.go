@@ -0,0 +1,151 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testTokenABI = `[
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+func TestABIStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newABIStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	var (
+		token = common.Address{0x01}
+		from  = common.Address{0x02}
+		to    = common.Address{0x03}
+	)
+	if err := store.register(token, json.RawMessage(`[{"type":"bogus"}]`)); err == nil {
+		t.Fatal("invalid ABI accepted")
+	}
+	if err := store.register(token, json.RawMessage(testTokenABI)); err != nil {
+		t.Fatalf("failed to register ABI: %v", err)
+	}
+	// Registered ABIs are loaded again from the directory
+	if store, err = newABIStore(dir); err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if addresses := store.addresses(); len(addresses) != 1 || addresses[0] != token {
+		t.Fatalf("registered addresses mismatch: %v", addresses)
+	}
+	// Logs and inputs of the contract are decoded
+	log := &types.Log{
+		Address: token,
+		Topics:  []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")), from.Hash(), to.Hash()},
+		Data:    common.LeftPadBytes([]byte{0x2a}, 32),
+	}
+	decoded := store.decodeLog(log)
+	if decoded.Error != "" || decoded.Event != "Transfer" || decoded.Signature != "Transfer(address,address,uint256)" {
+		t.Fatalf("log decoding mismatch: %+v", decoded)
+	}
+	if decoded.Args["from"] != from || decoded.Args["to"] != to || decoded.Args["value"].(*hexutil.Big).ToInt().Int64() != 42 {
+		t.Fatalf("log arguments mismatch: %v", decoded.Args)
+	}
+	input := append(crypto.Keccak256([]byte("transfer(address,uint256)"))[:4], append(common.LeftPadBytes(to[:], 32), common.LeftPadBytes(big.NewInt(7).Bytes(), 32)...)...)
+	call, err := store.decodeInput(token, input)
+	if err != nil {
+		t.Fatalf("failed to decode input: %v", err)
+	}
+	if call.Method != "transfer" || call.Args["to"] != to || call.Args["value"].(*hexutil.Big).ToInt().Int64() != 7 {
+		t.Fatalf("input decoding mismatch: %+v", call)
+	}
+	// Other contracts and unregistered ones aren't decoded
+	log.Address = from
+	if decoded := store.decodeLog(log); decoded.Error != errNoABI.Error() {
+		t.Fatalf("log of unknown contract decoded: %+v", decoded)
+	}
+	if ok, err := store.unregister(token); !ok || err != nil {
+		t.Fatalf("failed to unregister ABI: %v, %v", ok, err)
+	}
+	if _, err := store.decodeInput(token, input); err != errNoABI {
+		t.Fatalf("input of unregistered contract decoded: %v", err)
+	}
+	if store, _ = newABIStore(dir); len(store.addresses()) != 0 {
+		t.Fatalf("unregistered ABI loaded again")
+	}
+}
+
+func TestSignatureFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newABIStore("")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	eth := &Ethereum{abis: store, signatures: &signatureDB{path: filepath.Join(dir, "4byte.json")}}
+	api := NewPublicABIAPI(eth)
+
+	// Calls without a registered ABI are decoded with the bundled signatures
+	input := append(crypto.Keccak256([]byte("transfer(address,uint256)"))[:4], make([]byte, 64)...)
+	input[len(input)-1] = 0x2a
+	call, err := api.DecodeInput(common.Address{0x01}, input)
+	if err != nil {
+		t.Fatalf("failed to decode input: %v", err)
+	}
+	if call.Method != "transfer" || call.Signature != "transfer(address,uint256)" || call.Args["1"].(*hexutil.Big).ToInt().Int64() != 42 {
+		t.Fatalf("decoded call mismatch: %+v", call)
+	}
+	// Custom event signatures name the events of logs
+	if _, err := NewPrivateABIAPI(eth).AddEventSignature("Transfer(address,address,uint256)"); err != nil {
+		t.Fatalf("failed to add event signature: %v", err)
+	}
+	topic := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	if decoded := api.DecodeLog(types.Log{Topics: []common.Hash{topic}}); decoded.Event != "Transfer" || decoded.Error != "" {
+		t.Fatalf("decoded log mismatch: %+v", decoded)
+	}
+	if sig, err := api.LookupSignature(topic[:]); err != nil || sig.Signature != "Transfer(address,address,uint256)" {
+		t.Fatalf("event lookup mismatch: %v, %v", sig, err)
+	}
+	// Call tracer frames are annotated recursively
+	frames := json.RawMessage(`{"input":"` + hexutil.Encode(input) + `","calls":[{"input":"0x095ea7b3"}]}`)
+	var annotated struct {
+		Signature string
+		Calls     []struct{ Signature string }
+	}
+	if err := json.Unmarshal(eth.signatures.annotateCallFrames(frames), &annotated); err != nil {
+		t.Fatal(err)
+	}
+	if annotated.Signature != "transfer(address,uint256)" || annotated.Calls[0].Signature != "approve(address,uint256)" {
+		t.Fatalf("annotated frames mismatch: %+v", annotated)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package alerts implements a notifier posting critical node events, such as
+// deep reorgs or sync stalls, to webhooks (Slack or generic JSON).
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Kind is the kind of event an alert is raised for.
+type Kind string
+
+const (
+	DeepReorg                Kind = "deep-reorg"
+	SyncStall                Kind = "sync-stall"
+	LowPeers                 Kind = "low-peers"
+	DatabaseCorruption       Kind = "database-corruption"
+	RemoteFreezerUnreachable Kind = "remote-freezer-unreachable"
+)
+
+// checkInterval is the interval between two checks of the sync progress, the
+// peer count and the reachability of the remote freezer.
+var checkInterval = time.Minute
+
+// Config are the configuration parameters of the alert notifier.
+type Config struct {
+	Webhooks   []string      // Webhook URLs to post the alerts to (none = disabled)
+	Format     string        // Payload format of the webhooks: "json" or "slack"
+	Template   string        // Path of a text/template file rendering the payloads, overriding the format
+	Node       string        // Name of the node in the alerts (empty = host name)
+	RateLimit  time.Duration // Minimum time between two alerts of the same kind
+	ReorgDepth uint64        // Number of blocks dropped by a reorg to raise an alert (0 = disabled)
+	SyncStall  time.Duration // Time without sync progress to raise an alert (0 = disabled)
+	MinPeers   int           // Peer count below which to raise an alert (0 = disabled)
+}
+
+// DefaultConfig contains the default settings of the alert notifier.
+var DefaultConfig = Config{
+	Format:     "json",
+	RateLimit:  5 * time.Minute,
+	ReorgDepth: 64,
+	SyncStall:  10 * time.Minute,
+}
+
+// Payload templates of the supported webhook formats.
+var formats = map[string]string{
+	"json":  `{{json .}}`,
+	"slack": `{"text": {{json (printf "*%s* [%s] %s" .Node .Kind .Message)}}}`,
+}
+
+// Alert is a critical event of the node, rendered into the webhook payloads.
+type Alert struct {
+	Kind       Kind                   `json:"kind"`
+	Node       string                 `json:"node"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Suppressed int                    `json:"suppressed,omitempty"` // Alerts of the same kind dropped by rate limiting since the previous one
+	Time       time.Time              `json:"time"`
+}
+
+// Backend wraps all methods required by the alert notifier to watch the node.
+type Backend interface {
+	BlockChain() *core.BlockChain
+	ChainDb() ethdb.Database
+	Downloader() *downloader.Downloader
+	PeerCount() int
+}
+
+// Notifier posts the alerts raised by the node to the configured webhooks, at
+// most one per kind of event within the rate limit.
+type Notifier struct {
+	config Config
+	tmpl   *template.Template
+	client *http.Client
+
+	last       map[Kind]time.Time // Time of the last alert posted for each kind
+	suppressed map[Kind]int       // Number of alerts dropped since the last one for each kind
+	lock       sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates an alert notifier posting to the configured webhooks.
+func New(config Config) (*Notifier, error) {
+	source, ok := formats[config.Format]
+	if config.Template != "" {
+		blob, err := ioutil.ReadFile(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read alert template: %v", err)
+		}
+		source, ok = string(blob), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown alert format %q", config.Format)
+	}
+	tmpl, err := template.New("alert").Funcs(template.FuncMap{"json": marshal}).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert template: %v", err)
+	}
+	if config.Node == "" {
+		config.Node, _ = os.Hostname()
+	}
+	return &Notifier{
+		config:     config,
+		tmpl:       tmpl,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		last:       make(map[Kind]time.Time),
+		suppressed: make(map[Kind]int),
+		quit:       make(chan struct{}),
+	}, nil
+}
+
+// marshal renders a value as JSON within the payload templates.
+func marshal(v interface{}) (string, error) {
+	blob, err := json.Marshal(v)
+	return string(blob), err
+}
+
+// Start launches the background loop watching the node for critical events.
+func (n *Notifier) Start(backend Backend) {
+	n.wg.Add(1)
+	go n.loop(backend)
+}
+
+// Stop terminates the background loop of the notifier, waiting for the alerts
+// being posted.
+func (n *Notifier) Stop() {
+	close(n.quit)
+	n.wg.Wait()
+}
+
+// Notify raises an alert of the given kind, posting it in the background unless
+// another one of the same kind was posted within the rate limit.
+func (n *Notifier) Notify(kind Kind, message string, details map[string]interface{}) {
+	n.lock.Lock()
+	if last, ok := n.last[kind]; ok && time.Since(last) < n.config.RateLimit {
+		n.suppressed[kind]++
+		n.lock.Unlock()
+		log.Debug("Rate limited alert", "kind", kind, "message", message)
+		return
+	}
+	alert := &Alert{
+		Kind:       kind,
+		Node:       n.config.Node,
+		Message:    message,
+		Details:    details,
+		Suppressed: n.suppressed[kind],
+		Time:       time.Now(),
+	}
+	n.last[kind], n.suppressed[kind] = alert.Time, 0
+	n.lock.Unlock()
+
+	var payload bytes.Buffer
+	if err := n.tmpl.Execute(&payload, alert); err != nil {
+		log.Warn("Failed to render alert", "kind", kind, "err", err)
+		return
+	}
+	for _, webhook := range n.config.Webhooks {
+		n.wg.Add(1)
+		go func(webhook string) {
+			defer n.wg.Done()
+			if err := n.post(webhook, payload.Bytes()); err != nil {
+				log.Warn("Failed to post alert", "kind", kind, "webhook", webhook, "err", err)
+			}
+		}(webhook)
+	}
+}
+
+// post sends an alert payload to a webhook.
+func (n *Notifier) post(webhook string, payload []byte) error {
+	res, err := n.client.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// loop watches the chain head for deep reorgs, and periodically checks the sync
+// progress, the peer count and the reachability of the remote freezer.
+func (n *Notifier) loop(backend Backend) {
+	defer n.wg.Done()
+
+	var (
+		chain  = backend.BlockChain()
+		headCh = make(chan core.ChainHeadEvent, 16)
+		head   = chain.CurrentHeader()
+		ticker = time.NewTicker(checkInterval)
+
+		progress   uint64       // Last block synced
+		progressed = time.Now() // Time the last block was synced
+		stalled    bool         // Whether the stalled sync was alerted
+		lowPeers   bool         // Whether the low peer count was alerted
+		outage     bool         // Whether the remote freezer outage was alerted
+	)
+	sub := chain.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-headCh:
+			if n.config.ReorgDepth > 0 && n.reorgDepth(chain, head) >= n.config.ReorgDepth {
+				n.Notify(DeepReorg, fmt.Sprintf("Chain reorg dropped %d blocks or more", n.config.ReorgDepth), map[string]interface{}{
+					"oldNumber": head.Number.Uint64(),
+					"oldHash":   head.Hash(),
+					"newNumber": ev.Block.NumberU64(),
+					"newHash":   ev.Block.Hash(),
+				})
+			}
+			head = ev.Block.Header()
+
+		case <-ticker.C:
+			// Alert if the sync isn't making any progress
+			if dl := backend.Downloader(); dl.Synchronising() {
+				if current := dl.Progress().CurrentBlock; current != progress {
+					progress, progressed, stalled = current, time.Now(), false
+				} else if n.config.SyncStall > 0 && !stalled && time.Since(progressed) >= n.config.SyncStall {
+					stalled = true
+					n.Notify(SyncStall, fmt.Sprintf("Sync made no progress for %v", time.Since(progressed).Round(time.Second)), map[string]interface{}{
+						"current": current,
+						"highest": dl.Progress().HighestBlock,
+					})
+				}
+			} else {
+				progressed, stalled = time.Now(), false
+			}
+			// Alert once if the peer count drops below the threshold
+			if peers := backend.PeerCount(); peers < n.config.MinPeers {
+				if !lowPeers {
+					lowPeers = true
+					n.Notify(LowPeers, fmt.Sprintf("Peer count dropped to %d, below %d", peers, n.config.MinPeers), map[string]interface{}{
+						"peers": peers,
+					})
+				}
+			} else {
+				lowPeers = false
+			}
+			// Alert once if the remote freezer became unreachable
+			if reporter, ok := backend.ChainDb().(rawdb.AncientOutageReporter); ok {
+				if err := reporter.AncientOutage(); err != nil {
+					if !outage {
+						outage = true
+						n.Notify(RemoteFreezerUnreachable, "Remote freezer unreachable", map[string]interface{}{
+							"error": err.Error(),
+						})
+					}
+				} else {
+					outage = false
+				}
+			}
+
+		case <-sub.Err():
+			return
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+// reorgDepth returns the number of blocks of the chain up to the given former
+// head which aren't canonical anymore, counting at most the alerted depth.
+func (n *Notifier) reorgDepth(chain *core.BlockChain, head *types.Header) uint64 {
+	var dropped uint64
+	for head != nil && dropped < n.config.ReorgDepth {
+		if chain.GetCanonicalHash(head.Number.Uint64()) == head.Hash() {
+			break
+		}
+		dropped++
+		head = chain.GetHeader(head.ParentHash, head.Number.Uint64()-1)
+	}
+	return dropped
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// webhook collects the payloads posted to it.
+type webhook struct {
+	payloads [][]byte
+	lock     sync.Mutex
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	blob, _ := ioutil.ReadAll(r.Body)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.payloads = append(w.payloads, blob)
+}
+
+func (w *webhook) posted() [][]byte {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([][]byte{}, w.payloads...)
+}
+
+// Tests that alerts of the same kind are rate limited, the ones dropped being
+// counted in the next one.
+func TestNotifyRateLimit(t *testing.T) {
+	hook := new(webhook)
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	config := DefaultConfig
+	config.Webhooks, config.Node = []string{server.URL}, "test"
+	notifier, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	notifier.Notify(LowPeers, "first", nil)
+	notifier.Notify(LowPeers, "second", nil)
+	notifier.Notify(SyncStall, "third", nil)
+
+	// Pretend the rate limit passed for the low peer count
+	notifier.lock.Lock()
+	notifier.last[LowPeers] = time.Now().Add(-config.RateLimit)
+	notifier.lock.Unlock()
+
+	notifier.Notify(LowPeers, "fourth", map[string]interface{}{"peers": 1})
+	notifier.Stop()
+
+	alerts := make(map[string]*Alert)
+	for _, payload := range hook.posted() {
+		alert := new(Alert)
+		if err := json.Unmarshal(payload, alert); err != nil {
+			t.Fatalf("invalid payload %s: %v", payload, err)
+		}
+		alerts[alert.Message] = alert
+	}
+	if len(alerts) != 3 || alerts["first"] == nil || alerts["third"] == nil || alerts["fourth"] == nil {
+		t.Fatalf("posted alerts mismatch: have %v, want first, third and fourth", alerts)
+	}
+	if alert := alerts["fourth"]; alert.Suppressed != 1 || alert.Node != "test" || alert.Details["peers"] != 1.0 {
+		t.Errorf("rate limited alert mismatch: have %+v", alert)
+	}
+}
+
+// Tests that the alerts are rendered into Slack messages.
+func TestNotifySlack(t *testing.T) {
+	hook := new(webhook)
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	config := DefaultConfig
+	config.Webhooks, config.Node, config.Format = []string{server.URL}, "test", "slack"
+	notifier, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	notifier.Notify(DeepReorg, `reorg "deep"`, nil)
+	notifier.Stop()
+
+	posted := hook.posted()
+	if len(posted) != 1 {
+		t.Fatalf("posted alerts mismatch: have %d, want 1", len(posted))
+	}
+	var message struct{ Text string }
+	if err := json.Unmarshal(posted[0], &message); err != nil {
+		t.Fatalf("invalid payload %s: %v", posted[0], err)
+	}
+	if want := `*test* [deep-reorg] reorg "deep"`; message.Text != want {
+		t.Errorf("message mismatch: have %q, want %q", message.Text, want)
+	}
+	if _, err := New(Config{Format: "xml"}); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+// Tests that the depth of a reorg is measured from the former head, up to the
+// alerted depth.
+func TestReorgDepth(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &genesisT.Genesis{Config: params.TestChainConfig}
+		engine = ethash.NewFaker()
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	gendb := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(gendb, gspec)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, gendb, 10, nil)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	head := chain.CurrentHeader()
+
+	// Fork the chain off block #2 with a longer one
+	fork, _ := core.GenerateChain(gspec.Config, blocks[1], engine, gendb, 12, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if chain.CurrentBlock().Hash() != fork[len(fork)-1].Hash() {
+		t.Fatal("fork not canonical")
+	}
+	notifier := &Notifier{config: Config{ReorgDepth: 64}}
+	if depth := notifier.reorgDepth(chain, head); depth != 8 {
+		t.Errorf("reorg depth mismatch: have %d, want 8", depth)
+	}
+	notifier.config.ReorgDepth = 5
+	if depth := notifier.reorgDepth(chain, head); depth != 5 {
+		t.Errorf("capped reorg depth mismatch: have %d, want 5", depth)
+	}
+	if depth := notifier.reorgDepth(chain, chain.CurrentHeader()); depth != 0 {
+		t.Errorf("canonical head depth mismatch: have %d, want 0", depth)
+	}
+}
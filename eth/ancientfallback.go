@@ -0,0 +1,278 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// ancientFetchPeers is the maximum number of peers an ancient item is
+	// requested from before giving up.
+	ancientFetchPeers = 3
+
+	// ancientFetchTimeout is the time a peer has to deliver a requested item.
+	ancientFetchTimeout = 5 * time.Second
+
+	// ancientFetchConcurrency is the maximum number of ancient items retrieved
+	// from the peers at once, further reads failing right away.
+	ancientFetchConcurrency = 4
+)
+
+var (
+	errAncientFetchBusy   = errors.New("too many ancient items being retrieved")
+	errAncientFetchFailed = errors.New("no peer delivered the ancient item")
+	errUnknownAncientKind = errors.New("ancient kind not retrievable from peers")
+)
+
+// ancientRequest is an ancient item requested from a peer, awaiting delivery.
+type ancientRequest struct {
+	code   uint64        // Message code of the awaited response
+	hash   common.Hash   // Hash of the requested block
+	header *types.Header // Header of the requested block, to verify its body or receipts against
+	done   chan []byte   // Verified item in the ancient store encoding
+}
+
+// ancientFetcher retrieves the headers, bodies and receipts of ancient blocks
+// from the peers when the remote freezer fails to serve them, so that the reads
+// of historical data keep working while it is unreachable. The eth protocol has
+// no request ids, so a single request is outstanding per peer, and a response is
+// only taken as the delivery if it checks out against the requested block; any
+// other response is left to the downloader and the block fetcher.
+//
+// The responses are delivered by the message handlers of the peers, so items are
+// only requested from the peers not handling a message already, and the data
+// served to the peers is read through a view of the database never falling back,
+// since waiting on the peers would block the handler of the requesting one. Only
+// the local and RPC reads fall back thus, for all kinds of items alike.
+type ancientFetcher struct {
+	peers   *peerSet
+	slots   chan struct{} // Limits the number of concurrent retrievals
+	pending map[string]*ancientRequest
+	lock    sync.Mutex
+}
+
+// newAncientFetcher creates a fetcher of ancient items from the given peers.
+func newAncientFetcher(peers *peerSet) *ancientFetcher {
+	return &ancientFetcher{
+		peers:   peers,
+		slots:   make(chan struct{}, ancientFetchConcurrency),
+		pending: make(map[string]*ancientRequest),
+	}
+}
+
+// FetchAncient implements rawdb.AncientFallback, retrieving the header first to
+// verify the body or receipts against.
+func (f *ancientFetcher) FetchAncient(kind string, number uint64, hash common.Hash) ([]byte, error) {
+	switch kind {
+	case rawdb.FreezerRemoteHeaderTable, rawdb.FreezerRemoteBodiesTable, rawdb.FreezerRemoteReceiptTable:
+	default:
+		return nil, errUnknownAncientKind
+	}
+	select {
+	case f.slots <- struct{}{}:
+		defer func() { <-f.slots }()
+	default:
+		return nil, errAncientFetchBusy
+	}
+	blob, err := f.request(BlockHeadersMsg, hash, nil)
+	if err != nil || kind == rawdb.FreezerRemoteHeaderTable {
+		return blob, err
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(blob, header); err != nil {
+		return nil, err
+	}
+	if kind == rawdb.FreezerRemoteBodiesTable {
+		return f.request(BlockBodiesMsg, hash, header)
+	}
+	return f.request(ReceiptsMsg, hash, header)
+}
+
+// request retrieves an item of the given block from the best peers in turn,
+// until one delivers it.
+func (f *ancientFetcher) request(code uint64, hash common.Hash, header *types.Header) ([]byte, error) {
+	attempts := 0
+	for _, p := range f.peers.PeersByTd() {
+		if attempts >= ancientFetchPeers {
+			break
+		}
+		if atomic.LoadInt32(&p.handling) == 1 {
+			continue // Handler blocked, it couldn't deliver in time
+		}
+		req := &ancientRequest{code: code, hash: hash, header: header, done: make(chan []byte, 1)}
+
+		f.lock.Lock()
+		if _, busy := f.pending[p.id]; busy {
+			f.lock.Unlock()
+			continue
+		}
+		f.pending[p.id] = req
+		f.lock.Unlock()
+		attempts++
+
+		var err error
+		switch code {
+		case BlockHeadersMsg:
+			err = p.RequestHeadersByHash(hash, 1, 0, false)
+		case BlockBodiesMsg:
+			err = p.RequestBodies([]common.Hash{hash})
+		case ReceiptsMsg:
+			err = p.RequestReceipts([]common.Hash{hash})
+		}
+		if err == nil {
+			timer := time.NewTimer(ancientFetchTimeout)
+			select {
+			case blob := <-req.done:
+				timer.Stop()
+				return blob, nil
+			case <-timer.C:
+			}
+		}
+		f.lock.Lock()
+		if f.pending[p.id] == req {
+			delete(f.pending, p.id)
+		}
+		f.lock.Unlock()
+
+		// The item may have been delivered right after the timeout
+		select {
+		case blob := <-req.done:
+			return blob, nil
+		default:
+		}
+		p.Log().Debug("Peer failed to deliver ancient item", "code", code, "hash", hash, "err", err)
+	}
+	return nil, errAncientFetchFailed
+}
+
+// deliver hands the item verified by the given function over to the request
+// outstanding with the peer for the given message code, if any, reporting
+// whether the response was consumed.
+func (f *ancientFetcher) deliver(peer string, code uint64, verify func(req *ancientRequest) []byte) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	req := f.pending[peer]
+	if req == nil || req.code != code {
+		return false
+	}
+	blob := verify(req)
+	if blob == nil {
+		return false
+	}
+	delete(f.pending, peer)
+	req.done <- blob
+	return true
+}
+
+// deliverHeaders consumes a headers response of the peer if it is the header
+// of the requested ancient block.
+func (f *ancientFetcher) deliverHeaders(peer string, headers []*types.Header) bool {
+	if len(headers) != 1 {
+		return false
+	}
+	return f.deliver(peer, BlockHeadersMsg, func(req *ancientRequest) []byte {
+		if headers[0].Hash() != req.hash {
+			return nil
+		}
+		blob, _ := rlp.EncodeToBytes(headers[0])
+		return blob
+	})
+}
+
+// deliverBodies consumes a bodies response of the peer if it is the body of the
+// requested ancient block.
+func (f *ancientFetcher) deliverBodies(peer string, bodies blockBodiesData) bool {
+	if len(bodies) != 1 {
+		return false
+	}
+	return f.deliver(peer, BlockBodiesMsg, func(req *ancientRequest) []byte {
+		if types.DeriveSha(types.Transactions(bodies[0].Transactions), new(trie.Trie)) != req.header.TxHash {
+			return nil
+		}
+		if types.CalcUncleHash(bodies[0].Uncles) != req.header.UncleHash {
+			return nil
+		}
+		blob, _ := rlp.EncodeToBytes(&types.Body{Transactions: bodies[0].Transactions, Uncles: bodies[0].Uncles})
+		return blob
+	})
+}
+
+// deliverReceipts consumes a receipts response of the peer if it holds the
+// receipts of the requested ancient block, converting them into the storage
+// encoding of the ancient store.
+func (f *ancientFetcher) deliverReceipts(peer string, receipts [][]*types.Receipt) bool {
+	if len(receipts) != 1 {
+		return false
+	}
+	return f.deliver(peer, ReceiptsMsg, func(req *ancientRequest) []byte {
+		if types.DeriveSha(types.Receipts(receipts[0]), new(trie.Trie)) != req.header.ReceiptHash {
+			return nil
+		}
+		storage := make([]*types.ReceiptForStorage, len(receipts[0]))
+		for i, receipt := range receipts[0] {
+			storage[i] = (*types.ReceiptForStorage)(receipt)
+		}
+		blob, _ := rlp.EncodeToBytes(storage)
+		return blob
+	})
+}
+
+// servedHeader retrieves a header to serve to the peers, without falling back
+// to the peers for ancient ones.
+func (pm *ProtocolManager) servedHeader(hash common.Hash, number uint64) *types.Header {
+	if pm.servingDb == nil {
+		return pm.blockchain.GetHeader(hash, number)
+	}
+	return rawdb.ReadHeader(pm.servingDb, hash, number)
+}
+
+// servedHeaderByHash retrieves a header by hash to serve to the peers, without
+// falling back to the peers for ancient ones.
+func (pm *ProtocolManager) servedHeaderByHash(hash common.Hash) *types.Header {
+	if pm.servingDb == nil {
+		return pm.blockchain.GetHeaderByHash(hash)
+	}
+	number := rawdb.ReadHeaderNumber(pm.servingDb, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(pm.servingDb, hash, *number)
+}
+
+// servedHeaderByNumber retrieves a canonical header by number to serve to the
+// peers, without falling back to the peers for ancient ones.
+func (pm *ProtocolManager) servedHeaderByNumber(number uint64) *types.Header {
+	if pm.servingDb == nil {
+		return pm.blockchain.GetHeaderByNumber(number)
+	}
+	hash := rawdb.ReadCanonicalHash(pm.servingDb, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(pm.servingDb, hash, number)
+}
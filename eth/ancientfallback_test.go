@@ -0,0 +1,123 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that the ancient fetcher only consumes the responses of the peers it
+// requested an item from which check out against the requested block.
+func TestAncientFetcherDelivery(t *testing.T) {
+	fetcher := newAncientFetcher(newPeerSet())
+
+	header := &types.Header{
+		Number:      big.NewInt(100),
+		TxHash:      types.EmptyRootHash,
+		UncleHash:   types.EmptyUncleHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  big.NewInt(1),
+	}
+	other := &types.Header{Number: big.NewInt(101), Difficulty: big.NewInt(1)}
+
+	request := func(code uint64) *ancientRequest {
+		req := &ancientRequest{code: code, hash: header.Hash(), header: header, done: make(chan []byte, 1)}
+		fetcher.pending["peer"] = req
+		return req
+	}
+	// Headers are only consumed if the requested one is delivered
+	req := request(BlockHeadersMsg)
+	if fetcher.deliverHeaders("other", []*types.Header{header}) {
+		t.Fatal("header consumed from a peer not requested")
+	}
+	if fetcher.deliverHeaders("peer", []*types.Header{other}) {
+		t.Fatal("wrong header consumed")
+	}
+	if fetcher.deliverBodies("peer", blockBodiesData{{}}) {
+		t.Fatal("body consumed for a header request")
+	}
+	if !fetcher.deliverHeaders("peer", []*types.Header{header}) {
+		t.Fatal("requested header not consumed")
+	}
+	if want, _ := rlp.EncodeToBytes(header); string(<-req.done) != string(want) {
+		t.Fatal("delivered header mismatch")
+	}
+	if _, ok := fetcher.pending["peer"]; ok {
+		t.Fatal("request still pending after delivery")
+	}
+	// Bodies are verified against the header
+	request(BlockBodiesMsg)
+	if fetcher.deliverBodies("peer", blockBodiesData{{Uncles: []*types.Header{other}}}) {
+		t.Fatal("body with wrong uncles consumed")
+	}
+	if !fetcher.deliverBodies("peer", blockBodiesData{{}}) {
+		t.Fatal("requested body not consumed")
+	}
+	// Receipts as well, and converted into the storage encoding
+	req = request(ReceiptsMsg)
+	receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{}}
+	if fetcher.deliverReceipts("peer", [][]*types.Receipt{{receipt}}) {
+		t.Fatal("receipts with wrong root consumed")
+	}
+	if !fetcher.deliverReceipts("peer", [][]*types.Receipt{{}}) {
+		t.Fatal("requested receipts not consumed")
+	}
+	var receipts []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(<-req.done, &receipts); err != nil || len(receipts) != 0 {
+		t.Fatalf("delivered receipts mismatch: %v, %v", receipts, err)
+	}
+	// Nothing is consumed without an outstanding request
+	if fetcher.deliverHeaders("peer", []*types.Header{header}) {
+		t.Fatal("header consumed without a request")
+	}
+	if _, err := fetcher.FetchAncient(rawdb.FreezerRemoteDifficultyTable, 100, common.Hash{}); err != errUnknownAncientKind {
+		t.Fatalf("unretrievable kind error mismatch: have %v, want %v", err, errUnknownAncientKind)
+	}
+	if _, err := fetcher.FetchAncient(rawdb.FreezerRemoteHeaderTable, 100, header.Hash()); err != errAncientFetchFailed {
+		t.Fatalf("retrieval without peers error mismatch: have %v, want %v", err, errAncientFetchFailed)
+	}
+}
+
+// Tests that no ancient item is requested from the peers busy handling a message,
+// as they couldn't deliver it before being done.
+func TestAncientFetcherBusyPeers(t *testing.T) {
+	peers := newPeerSet()
+	busy := newPeer(eth65, p2p.NewPeer(enode.ID{1}, "busy", nil), nil, nil)
+	busy.td, busy.handling = big.NewInt(1), 1
+	peers.peers[busy.id] = busy
+
+	fetcher := newAncientFetcher(peers)
+	start := time.Now()
+	if _, err := fetcher.FetchAncient(rawdb.FreezerRemoteHeaderTable, 100, common.Hash{1}); err != errAncientFetchFailed {
+		t.Fatalf("retrieval from busy peers error mismatch: have %v, want %v", err, errAncientFetchFailed)
+	}
+	if elapsed := time.Since(start); elapsed >= ancientFetchTimeout {
+		t.Fatalf("busy peer waited on: %v", elapsed)
+	}
+	if len(fetcher.pending) != 0 {
+		t.Fatal("item requested from a busy peer")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// ancientReadAhead is the number of consecutive ancient items retrieved from
+	// the remote freezer whenever an item is missing from the read-ahead buffer.
+	ancientReadAhead = 128
+
+	// ancientReadAheadBytes is the maximum size of a single read-ahead retrieval.
+	ancientReadAheadBytes = softResponseLimit
+
+	// ancientBufferItems is the number of read-ahead items kept in memory.
+	ancientBufferItems = 2048
+)
+
+var (
+	errNotAncient      = errors.New("not an ancient block")
+	errBudgetExhausted = errors.New("ancient serving budget exhausted")
+)
+
+// ancientKey identifies an item in the read-ahead buffer.
+type ancientKey struct {
+	kind   string
+	number uint64
+}
+
+// ancientBudget tracks the ancient data that may still be served to a peer.
+type ancientBudget struct {
+	bytes   float64   // Remaining bytes, may go negative after a large item
+	updated time.Time // Last time the budget was recharged
+}
+
+// ancientServer serves block bodies and receipts of ancient blocks from a remote
+// freezer. Consecutive items are retrieved with a single range request into a
+// local read-ahead buffer, since peers mostly request runs of blocks. The data
+// served to each peer is limited, to keep the load on the remote freezer bounded.
+type ancientServer struct {
+	db     ethdb.Database
+	ranger rawdb.AncientRanger
+	limit  uint64 // Bytes per second served to a single peer (0 = unlimited)
+
+	buffer  *lru.Cache // Read-ahead items, keyed by ancientKey
+	budgets map[string]*ancientBudget
+	lock    sync.Mutex
+}
+
+// newAncientServer creates a server for the ancient items of the given database.
+func newAncientServer(db ethdb.Database, ranger rawdb.AncientRanger, limit uint64) *ancientServer {
+	buffer, _ := lru.New(ancientBufferItems)
+	return &ancientServer{
+		db:      db,
+		ranger:  ranger,
+		limit:   limit,
+		buffer:  buffer,
+		budgets: make(map[string]*ancientBudget),
+	}
+}
+
+// bodyRLP retrieves the body of an ancient block in RLP encoding. If the block is
+// not ancient, errNotAncient is returned and the regular database should be used.
+func (s *ancientServer) bodyRLP(peer string, hash common.Hash) (rlp.RawValue, error) {
+	return s.retrieve(peer, rawdb.FreezerRemoteBodiesTable, hash)
+}
+
+// receiptsRLP retrieves the receipts of an ancient block in network encoding. If
+// the block is not ancient, errNotAncient is returned and the regular database
+// should be used.
+func (s *ancientServer) receiptsRLP(peer string, hash common.Hash) (rlp.RawValue, error) {
+	blob, err := s.retrieve(peer, rawdb.FreezerRemoteReceiptTable, hash)
+	if err != nil {
+		return nil, err
+	}
+	// Ancient receipts are in storage encoding, which lacks the blooms
+	var stored []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(blob, &stored); err != nil {
+		return nil, err
+	}
+	receipts := make(types.Receipts, len(stored))
+	for i, receipt := range stored {
+		receipts[i] = (*types.Receipt)(receipt)
+		receipts[i].Bloom = types.CreateBloom(types.Receipts{receipts[i]})
+	}
+	return rlp.EncodeToBytes(receipts)
+}
+
+// retrieve looks up a single ancient item of the given block, charging it to the
+// budget of the requesting peer.
+func (s *ancientServer) retrieve(peer string, kind string, hash common.Hash) ([]byte, error) {
+	number := rawdb.ReadHeaderNumber(s.db, hash)
+	if number == nil {
+		return nil, errNotAncient
+	}
+	if frozen, err := s.db.Ancients(); err != nil || *number >= frozen {
+		return nil, errNotAncient
+	}
+	if !s.allow(peer) {
+		return nil, errBudgetExhausted
+	}
+	blob, err := s.fetch(kind, *number)
+	if err != nil {
+		return nil, err
+	}
+	s.charge(peer, len(blob))
+	return blob, nil
+}
+
+// fetch retrieves an ancient item from the read-ahead buffer, filling it up from
+// the remote freezer if the item is missing.
+func (s *ancientServer) fetch(kind string, number uint64) ([]byte, error) {
+	if blob, ok := s.buffer.Get(ancientKey{kind, number}); ok {
+		return blob.([]byte), nil
+	}
+	blobs, err := s.ranger.AncientRange(kind, number, ancientReadAhead, ancientReadAheadBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, errors.New("ancient item not found")
+	}
+	for i, blob := range blobs {
+		s.buffer.Add(ancientKey{kind, number + uint64(i)}, blob)
+	}
+	return blobs[0], nil
+}
+
+// allow recharges the budget of a peer and reports whether it may be served
+// any more ancient data.
+func (s *ancientServer) allow(peer string) bool {
+	if s.limit == 0 {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	budget := s.budgets[peer]
+	if budget == nil {
+		budget = &ancientBudget{bytes: float64(s.limit), updated: now}
+		s.budgets[peer] = budget
+	}
+	budget.bytes += now.Sub(budget.updated).Seconds() * float64(s.limit)
+	if budget.bytes > float64(s.limit) {
+		budget.bytes = float64(s.limit)
+	}
+	budget.updated = now
+	return budget.bytes > 0
+}
+
+// charge deducts the size of a served item from the budget of a peer.
+func (s *ancientServer) charge(peer string, size int) {
+	if s.limit == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if budget := s.budgets[peer]; budget != nil {
+		budget.bytes -= float64(size)
+	}
+}
+
+// drop forgets the budget of a disconnected peer.
+func (s *ancientServer) drop(peer string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.budgets, peer)
+}
+
+// tiering returns the tiering of the remote ancient store, if one is configured.
+func (api *PrivateAdminAPI) tiering() (rawdb.AncientTiering, error) {
+	tiering, ok := api.eth.ChainDb().(rawdb.AncientTiering)
+	if !ok || api.eth.config.DatabaseFreezerRemote == "" {
+		return nil, errors.New("no remote ancient store configured")
+	}
+	return tiering, nil
+}
+
+// AncientTiering returns the tiering policy of the remote ancient store and the
+// state of its local mirror, including the hits of each tier.
+func (api *PrivateAdminAPI) AncientTiering() (*rawdb.TieringStats, error) {
+	tiering, err := api.tiering()
+	if err != nil {
+		return nil, err
+	}
+	stats := tiering.TieringStats()
+	return &stats, nil
+}
+
+// ReloadAncientTiering replaces the tiering policy of the remote ancient store
+// with the given one, or the one of the policy file if nil. The blocks to mirror
+// or evict accordingly are moved in the background.
+func (api *PrivateAdminAPI) ReloadAncientTiering(policy *rawdb.TieringPolicy) (*rawdb.TieringStats, error) {
+	tiering, err := api.tiering()
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		tiering.SetTieringPolicy(*policy, tiering.TieringStats().PolicyFile)
+	} else if err := tiering.ReloadTieringPolicy(); err != nil {
+		return nil, fmt.Errorf("failed to reload ancient tiering policy: %v", err)
+	}
+	stats := tiering.TieringStats()
+	return &stats, nil
+}
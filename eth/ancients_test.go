@@ -0,0 +1,153 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testAncientDB is a database pretending its first frozen blocks are ancient.
+type testAncientDB struct {
+	ethdb.Database
+	frozen uint64
+}
+
+func (db *testAncientDB) Ancients() (uint64, error) { return db.frozen, nil }
+
+// testAncientRanger is a remote freezer counting the range retrievals made.
+type testAncientRanger struct {
+	items map[ancientKey][]byte
+	calls int
+}
+
+func (r *testAncientRanger) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	r.calls++
+
+	var (
+		res  [][]byte
+		size uint64
+	)
+	for i := uint64(0); i < count && size < maxBytes; i++ {
+		blob, ok := r.items[ancientKey{kind, start + i}]
+		if !ok {
+			break
+		}
+		res = append(res, blob)
+		size += uint64(len(blob))
+	}
+	return res, nil
+}
+
+// newTestAncientServer creates an ancient server with 10 frozen blocks, each
+// having a 10 byte body and a single receipt.
+func newTestAncientServer(t *testing.T, limit uint64) (*ancientServer, *testAncientRanger, []common.Hash) {
+	db := &testAncientDB{Database: rawdb.NewMemoryDatabase(), frozen: 10}
+	ranger := &testAncientRanger{items: make(map[ancientKey][]byte)}
+
+	var hashes []common.Hash
+	for i := uint64(0); i < 11; i++ {
+		hash := common.Hash{byte(i + 1)}
+		rawdb.WriteHeaderNumber(db, hash, i)
+		hashes = append(hashes, hash)
+
+		receipt := &types.ReceiptForStorage{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000 * (i + 1),
+			Logs:              []*types.Log{{Address: common.Address{byte(i)}, Topics: []common.Hash{hash}}},
+		}
+		blob, err := rlp.EncodeToBytes([]*types.ReceiptForStorage{receipt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranger.items[ancientKey{rawdb.FreezerRemoteBodiesTable, i}] = bytes.Repeat([]byte{byte(i)}, 10)
+		ranger.items[ancientKey{rawdb.FreezerRemoteReceiptTable, i}] = blob
+	}
+	return newAncientServer(db, ranger, limit), ranger, hashes
+}
+
+// Tests that ancient items are served from a read-ahead buffer filled with range
+// retrievals, and that recent blocks are left to the regular database.
+func TestAncientServerReadAhead(t *testing.T) {
+	server, ranger, hashes := newTestAncientServer(t, 0)
+
+	for i, hash := range hashes[:10] {
+		body, err := server.bodyRLP("peer", hash)
+		if err != nil {
+			t.Fatalf("body %d: failed to retrieve: %v", i, err)
+		}
+		if !bytes.Equal(body, bytes.Repeat([]byte{byte(i)}, 10)) {
+			t.Fatalf("body %d: content mismatch: have %x", i, body)
+		}
+	}
+	if ranger.calls != 1 {
+		t.Fatalf("range retrievals mismatch: have %d, want 1", ranger.calls)
+	}
+	if _, err := server.bodyRLP("peer", hashes[10]); err != errNotAncient {
+		t.Fatalf("recent body error mismatch: have %v, want %v", err, errNotAncient)
+	}
+	if _, err := server.bodyRLP("peer", common.Hash{0xff}); err != errNotAncient {
+		t.Fatalf("unknown body error mismatch: have %v, want %v", err, errNotAncient)
+	}
+	// Receipts must be served in network encoding, blooms included
+	blob, err := server.receiptsRLP("peer", hashes[3])
+	if err != nil {
+		t.Fatalf("failed to retrieve receipts: %v", err)
+	}
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(blob, &receipts); err != nil {
+		t.Fatalf("failed to decode receipts: %v", err)
+	}
+	if len(receipts) != 1 || receipts[0].CumulativeGasUsed != 4*21000 || receipts[0].Bloom != types.CreateBloom(receipts) {
+		t.Fatalf("receipts mismatch: %+v", receipts)
+	}
+}
+
+// Tests that the ancient data served to each peer is limited by its budget.
+func TestAncientServerBudget(t *testing.T) {
+	server, _, hashes := newTestAncientServer(t, 25)
+
+	// The budget may be overdrawn by the last item served
+	for i := 0; i < 3; i++ {
+		if _, err := server.bodyRLP("peer", hashes[i]); err != nil {
+			t.Fatalf("body %d: failed to retrieve: %v", i, err)
+		}
+	}
+	if _, err := server.bodyRLP("peer", hashes[3]); err != errBudgetExhausted {
+		t.Fatalf("error mismatch: have %v, want %v", err, errBudgetExhausted)
+	}
+	// Other peers have their own budget
+	if _, err := server.bodyRLP("other", hashes[3]); err != nil {
+		t.Fatalf("failed to retrieve for another peer: %v", err)
+	}
+	// The budget is recharged over time
+	server.budgets["peer"].updated = time.Now().Add(-time.Second)
+	if _, err := server.bodyRLP("peer", hashes[3]); err != nil {
+		t.Fatalf("failed to retrieve after recharge: %v", err)
+	}
+	server.drop("peer")
+	if _, ok := server.budgets["peer"]; ok {
+		t.Fatalf("budget retained for dropped peer")
+	}
+}
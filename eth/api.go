@@ -17,15 +17,12 @@
 package eth
 
 import (
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"math/big"
 	"os"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -34,6 +31,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/forkmon"
+	"github.com/ethereum/go-ethereum/eth/wit"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -75,6 +75,100 @@ func (api *PublicEthereumAPI) ChainId() hexutil.Uint64 {
 	return (hexutil.Uint64)(chainID.Uint64())
 }
 
+// Supply is the circulating supply at a block, with the ether minted and destroyed
+// since genesis and by the block itself.
+type Supply struct {
+	Number        hexutil.Uint64 `json:"number"`
+	Hash          common.Hash    `json:"hash"`
+	Supply        *hexutil.Big   `json:"supply"`        // Sum of all account balances after the block
+	Issuance      *hexutil.Big   `json:"issuance"`      // Cumulative block and uncle rewards
+	Burned        *hexutil.Big   `json:"burned"`        // Cumulative ether destroyed
+	BlockIssuance *hexutil.Big   `json:"blockIssuance"` // Rewards minted by the block
+	BlockBurned   *hexutil.Big   `json:"blockBurned"`   // Ether destroyed by the block
+}
+
+// GetSupply returns the circulating supply at the given block, as recorded by the
+// supply tracker at import time.
+func (api *PublicEthereumAPI) GetSupply(blockNrOrHash rpc.BlockNumberOrHash) (*Supply, error) {
+	chain := api.e.blockchain
+
+	var header *types.Header
+	if number, ok := blockNrOrHash.Number(); ok {
+		switch number {
+		case rpc.PendingBlockNumber:
+			return nil, errors.New("supply of the pending block is not tracked")
+		case rpc.LatestBlockNumber:
+			header = chain.CurrentHeader()
+		default:
+			header = chain.GetHeaderByNumber(uint64(number))
+		}
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		header = chain.GetHeaderByHash(hash)
+	}
+	if header == nil {
+		return nil, errors.New("block not found")
+	}
+	hash, number := header.Hash(), header.Number.Uint64()
+	record := rawdb.ReadSupply(api.e.chainDb, hash, number)
+	if record == nil {
+		return nil, fmt.Errorf("supply of block #%d [%x] not tracked", number, hash)
+	}
+	res := &Supply{
+		Number:        hexutil.Uint64(number),
+		Hash:          hash,
+		Supply:        (*hexutil.Big)(record.Supply),
+		Issuance:      (*hexutil.Big)(record.Issuance),
+		Burned:        (*hexutil.Big)(record.Burned),
+		BlockIssuance: (*hexutil.Big)(record.Issuance),
+		BlockBurned:   (*hexutil.Big)(record.Burned),
+	}
+	if number > 0 {
+		parent := rawdb.ReadSupply(api.e.chainDb, header.ParentHash, number-1)
+		if parent == nil {
+			return nil, fmt.Errorf("supply of block #%d [%x] not tracked", number-1, header.ParentHash)
+		}
+		res.BlockIssuance = (*hexutil.Big)(new(big.Int).Sub(record.Issuance, parent.Issuance))
+		res.BlockBurned = (*hexutil.Big)(new(big.Int).Sub(record.Burned, parent.Burned))
+	}
+	return res, nil
+}
+
+// ContractCreation is the deployment of a contract found in the canonical chain.
+type ContractCreation struct {
+	Address          common.Address `json:"address"`
+	Creator          common.Address `json:"creator"`
+	CodeHash         common.Hash    `json:"codeHash"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	BlockHash        common.Hash    `json:"blockHash"`
+	TransactionHash  common.Hash    `json:"transactionHash"`
+	TransactionIndex hexutil.Uint   `json:"transactionIndex"`
+}
+
+// GetContractCreation returns the latest canonical deployment of the contract at
+// the given address, or nil if none is known. It requires the contract index.
+func (api *PublicEthereumAPI) GetContractCreation(address common.Address) (*ContractCreation, error) {
+	if !api.e.config.ContractIndex {
+		return nil, errors.New("contract index disabled")
+	}
+	entries := rawdb.ReadContractLookupEntries(api.e.chainDb, address)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if rawdb.ReadCanonicalHash(api.e.chainDb, entry.BlockNumber) != entry.BlockHash {
+			continue
+		}
+		return &ContractCreation{
+			Address:          entry.Creation.Address,
+			Creator:          entry.Creation.Creator,
+			CodeHash:         entry.Creation.CodeHash,
+			BlockNumber:      hexutil.Uint64(entry.BlockNumber),
+			BlockHash:        entry.BlockHash,
+			TransactionHash:  entry.Creation.TxHash,
+			TransactionIndex: hexutil.Uint(entry.Creation.TxIndex),
+		}, nil
+	}
+	return nil, nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -157,7 +251,8 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
-	eth *Ethereum
+	eth    *Ethereum
+	ioBusy int32 // Whether a chain import or export is running
 }
 
 // NewPrivateAdminAPI creates a new API definition for the full node private
@@ -169,37 +264,21 @@ func NewPrivateAdminAPI(eth *Ethereum) *PrivateAdminAPI {
 // ExportChain exports the current blockchain into a local file,
 // or a range of blocks if first and last are non-nil
 func (api *PrivateAdminAPI) ExportChain(file string, first *uint64, last *uint64) (bool, error) {
-	if first == nil && last != nil {
-		return false, errors.New("last cannot be specified without first")
-	}
-	if first != nil && last == nil {
-		head := api.eth.BlockChain().CurrentHeader().Number.Uint64()
-		last = &head
-	}
-	if _, err := os.Stat(file); err == nil {
-		// File already exists. Allowing overwrite could be a DoS vecotor,
-		// since the 'file' may point to arbitrary paths on the drive
-		return false, errors.New("location would overwrite an existing file")
-	}
-	// Make sure we can create the file to export into
-	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	begin, end, err := api.exportRange(first, last)
 	if err != nil {
 		return false, err
 	}
-	defer out.Close()
+	if !api.acquireChainIO() {
+		return false, errChainIOBusy
+	}
+	defer api.releaseChainIO()
 
-	var writer io.Writer = out
-	if strings.HasSuffix(file, ".gz") {
-		writer = gzip.NewWriter(writer)
-		defer writer.(*gzip.Writer).Close()
+	out, err := createExportFile(file)
+	if err != nil {
+		return false, err
 	}
 
-	// Export the blockchain
-	if first != nil {
-		if err := api.eth.BlockChain().ExportN(writer, *first, *last); err != nil {
-			return false, err
-		}
-	} else if err := api.eth.BlockChain().Export(writer); err != nil {
+	if err := api.exportChain(out, begin, end, new(chainIOTracker)); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -217,51 +296,39 @@ func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
 
 // ImportChain imports a blockchain from a local file.
 func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
+	if !api.acquireChainIO() {
+		return false, errChainIOBusy
+	}
+	defer api.releaseChainIO()
+
 	// Make sure the can access the file to import
 	in, err := os.Open(file)
 	if err != nil {
 		return false, err
 	}
-	defer in.Close()
-
-	var reader io.Reader = in
-	if strings.HasSuffix(file, ".gz") {
-		if reader, err = gzip.NewReader(reader); err != nil {
-			return false, err
-		}
+	if err := api.importChain(in, new(chainIOTracker)); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	// Run actual the import in pre-configured batches
-	stream := rlp.NewStream(reader, 0)
-
-	blocks, index := make([]*types.Block, 0, 2500), 0
-	for batch := 0; ; batch++ {
-		// Load a batch of blocks from the input file
-		for len(blocks) < cap(blocks) {
-			block := new(types.Block)
-			if err := stream.Decode(block); err == io.EOF {
-				break
-			} else if err != nil {
-				return false, fmt.Errorf("block %d: failed to parse: %v", index, err)
-			}
-			blocks = append(blocks, block)
-			index++
-		}
-		if len(blocks) == 0 {
-			break
-		}
-
-		if hasAllBlocks(api.eth.BlockChain(), blocks) {
-			blocks = blocks[:0]
-			continue
-		}
-		// Import the batch and reset the buffer
-		if _, err := api.eth.BlockChain().InsertChain(blocks); err != nil {
-			return false, fmt.Errorf("batch %d: failed to insert: %v", batch, err)
-		}
-		blocks = blocks[:0]
+// Backup writes a consistent backup of the chain database into the given
+// directory, which must not exist yet or be empty. If base is non-empty, it
+// denotes a previous backup to reuse unchanged ancient files from.
+func (api *PrivateAdminAPI) Backup(dir string, base *string) (*rawdb.BackupManifest, error) {
+	var baseDir string
+	if base != nil {
+		baseDir = *base
 	}
-	return true, nil
+	return rawdb.CreateBackup(api.eth.ChainDb(), dir, baseDir)
+}
+
+// PruneFrozen deletes the key-value entries of the frozen blocks made redundant
+// by the ancient store: the leftover block data and side chain entries at the
+// frozen heights, and the stale transaction lookups. In a dry run, the entries
+// are only counted, reporting the space that pruning would reclaim.
+func (api *PrivateAdminAPI) PruneFrozen(dryRun bool) (*rawdb.FrozenPruneReport, error) {
+	return rawdb.PruneFrozen(api.eth.ChainDb(), dryRun)
 }
 
 // PublicDebugAPI is the collection of Ethereum full node APIs exposed
@@ -321,6 +388,162 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// VmStats returns the number of executions and the gas used by each opcode in the
+// blocks processed since the node started, or since the statistics were last reset.
+func (api *PrivateDebugAPI) VmStats(reset *bool) (map[string]*vm.OpcodeStat, error) {
+	stats := api.eth.BlockChain().OpcodeStats()
+	if stats == nil {
+		return nil, errors.New("opcode statistics not enabled (--vm.stats)")
+	}
+	snapshot := stats.Snapshot()
+	if reset != nil && *reset {
+		stats.Reset()
+	}
+	return snapshot, nil
+}
+
+// TrieFlushPolicy is the policy of flushing the in-memory state to disk.
+type TrieFlushPolicy struct {
+	TimeLimit  string `json:"timeLimit"`  // Block processing time after which to flush the state, e.g. "1h0m0s"
+	BlockLimit uint64 `json:"blockLimit"` // Number of blocks after which to flush the state (0 = no limit)
+	DirtyLimit int    `json:"dirtyLimit"` // Memory limit (MB) at which to start flushing dirty trie nodes
+}
+
+// TrieFlushPolicyArgs are the changes to the policy of flushing the in-memory
+// state to disk, leaving the omitted fields unchanged.
+type TrieFlushPolicyArgs struct {
+	TimeLimit  *string `json:"timeLimit"`
+	BlockLimit *uint64 `json:"blockLimit"`
+	DirtyLimit *int    `json:"dirtyLimit"`
+}
+
+func newTrieFlushPolicy(policy core.TrieFlushPolicy) *TrieFlushPolicy {
+	return &TrieFlushPolicy{
+		TimeLimit:  policy.TimeLimit.String(),
+		BlockLimit: policy.BlockLimit,
+		DirtyLimit: policy.DirtyLimit,
+	}
+}
+
+// TrieFlushPolicy returns the policy of flushing the in-memory state to disk.
+func (api *PrivateDebugAPI) TrieFlushPolicy() *TrieFlushPolicy {
+	return newTrieFlushPolicy(api.eth.BlockChain().TrieFlushPolicy())
+}
+
+// SetTrieFlushPolicy changes the policy of flushing the in-memory state to disk,
+// returning the resulting policy. The changes are not persisted across restarts.
+func (api *PrivateDebugAPI) SetTrieFlushPolicy(args TrieFlushPolicyArgs) (*TrieFlushPolicy, error) {
+	chain := api.eth.BlockChain()
+	policy := chain.TrieFlushPolicy()
+	if args.TimeLimit != nil {
+		limit, err := time.ParseDuration(*args.TimeLimit)
+		if err != nil {
+			return nil, err
+		}
+		policy.TimeLimit = limit
+	}
+	if args.BlockLimit != nil {
+		policy.BlockLimit = *args.BlockLimit
+	}
+	if args.DirtyLimit != nil {
+		policy.DirtyLimit = *args.DirtyLimit
+	}
+	if err := chain.SetTrieFlushPolicy(policy); err != nil {
+		return nil, err
+	}
+	return newTrieFlushPolicy(policy), nil
+}
+
+// ReceiptVerification is the progress of verifying the receipts of the blocks
+// imported without execution by fast sync against their headers.
+type ReceiptVerification struct {
+	Pivot         *hexutil.Uint64 `json:"pivot"`  // Last block to verify, nil if the node never fast synced
+	Number        hexutil.Uint64  `json:"number"` // Last verified block
+	Done          bool            `json:"done"`
+	Mismatches    hexutil.Uint64  `json:"mismatches"`
+	FirstMismatch *hexutil.Uint64 `json:"firstMismatch,omitempty"`
+}
+
+// ReceiptVerification returns the progress of verifying the fast synced receipts,
+// enabled by --sync.verifyreceipts.
+func (api *PrivateDebugAPI) ReceiptVerification() *ReceiptVerification {
+	result := new(ReceiptVerification)
+	if pivot := rawdb.ReadLastPivotNumber(api.eth.ChainDb()); pivot != nil {
+		result.Pivot = (*hexutil.Uint64)(pivot)
+	}
+	if progress := api.eth.BlockChain().ReceiptVerification(); progress != nil {
+		result.Number = hexutil.Uint64(progress.Number)
+		result.Mismatches = hexutil.Uint64(progress.Mismatches)
+		if progress.Mismatches > 0 {
+			result.FirstMismatch = (*hexutil.Uint64)(&progress.FirstMismatch)
+		}
+	}
+	result.Done = result.Pivot != nil && result.Number >= *result.Pivot
+	return result
+}
+
+// maxBalanceSamples is the maximum number of balances a balance history query may
+// return.
+const maxBalanceSamples = 10000
+
+// BalanceSample is the balance of an account after a block.
+type BalanceSample struct {
+	Number  hexutil.Uint64 `json:"number"`
+	Hash    common.Hash    `json:"hash"`
+	Balance *hexutil.Big   `json:"balance"`
+}
+
+// GetBalanceHistory returns the balances of an account after every step-th block
+// of the given range of canonical blocks. Balances are reconstructed from the
+// balance changes indexed by supply tracking where the index covers the blocks,
+// and read from the state otherwise, which is only available for all blocks on
+// archive nodes. Blocks covered by the index cannot be queried if the state the
+// index starts from was pruned.
+func (api *PrivateDebugAPI) GetBalanceHistory(address common.Address, fromBlock, toBlock rpc.BlockNumber, step hexutil.Uint64) ([]*BalanceSample, error) {
+	chain := api.eth.blockchain
+	begin, end, err := ethapi.ResolveBlockRange(chain.CurrentBlock().NumberU64(), fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	if step == 0 {
+		step = 1
+	}
+	if samples := (end-begin)/uint64(step) + 1; samples > maxBalanceSamples {
+		return nil, fmt.Errorf("query samples %d blocks, more than the limit of %d", samples, maxBalanceSamples)
+	}
+	var headers []*types.Header
+	for number := begin; number <= end; number += uint64(step) {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		headers = append(headers, header)
+		if end-number < uint64(step) {
+			break
+		}
+	}
+	balances, err := chain.IndexedBalances(address, headers)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]*BalanceSample, len(headers))
+	for i, balance := range balances {
+		if balance == nil {
+			statedb, err := chain.StateAt(headers[i].Root)
+			if err != nil {
+				return nil, fmt.Errorf("balance at block #%d not available: %v", headers[i].Number, err)
+			}
+			balance = statedb.GetBalance(address)
+		}
+		samples[i] = &BalanceSample{
+			Number:  hexutil.Uint64(headers[i].Number.Uint64()),
+			Hash:    headers[i].Hash(),
+			Balance: (*hexutil.Big)(balance),
+		}
+	}
+	return samples, nil
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
@@ -351,6 +574,96 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs,
 	return results, nil
 }
 
+// WriteBadBlockReport writes the bad-block report of the given block, one of the
+// bad blocks seen on the network or a local one, into a local file of the node.
+// The report bundles the block with the witness of its parent state, so that its
+// execution can be replayed in isolation with geth replay-bad-block.
+func (api *PrivateDebugAPI) WriteBadBlockReport(ctx context.Context, hash common.Hash, file string) (string, error) {
+	var block *types.Block
+	for _, bad := range api.eth.BlockChain().BadBlocks() {
+		if bad.Hash() == hash {
+			block = bad
+			break
+		}
+	}
+	if block == nil {
+		block = api.eth.BlockChain().GetBlockByHash(hash)
+	}
+	if block == nil {
+		return "", fmt.Errorf("block %#x not found", hash)
+	}
+	if block.NumberU64() == 0 {
+		return "", errors.New("genesis is not reportable")
+	}
+	report, err := wit.NewBadBlockReport(api.eth.BlockChain(), block)
+	if err != nil {
+		return "", err
+	}
+	if api.eth.p2pServer != nil {
+		report.Client = api.eth.p2pServer.Name
+	}
+	if err := wit.WriteBadBlockReport(file, report); err != nil {
+		return "", err
+	}
+	return report.Reason, nil
+}
+
+// ForkView returns the branches of the chain the connected peers are on, with
+// the work carried by each branch since it forked off the local chain. It
+// requires the fork monitor.
+func (api *PrivateDebugAPI) ForkView() (*forkmon.View, error) {
+	if api.eth.forkMonitor == nil {
+		return nil, errors.New("fork monitor disabled")
+	}
+	return api.eth.forkMonitor.View(), nil
+}
+
+// GetAddressesByCodeHash returns the addresses of the contracts which were
+// deployed in the canonical chain storing the code with the given hash. It
+// requires the contract index.
+func (api *PublicDebugAPI) GetAddressesByCodeHash(codeHash common.Hash) ([]common.Address, error) {
+	if !api.eth.config.ContractIndex {
+		return nil, errors.New("contract index disabled")
+	}
+	addresses := []common.Address{}
+	for _, entry := range rawdb.ReadCodeHashLookupEntries(api.eth.chainDb, codeHash) {
+		if rawdb.ReadCanonicalHash(api.eth.chainDb, entry.BlockNumber) != entry.BlockHash {
+			continue
+		}
+		// Entries are ordered by address, so redeployments are adjacent
+		if n := len(addresses); n > 0 && addresses[n-1] == entry.Creation.Address {
+			continue
+		}
+		addresses = append(addresses, entry.Creation.Address)
+	}
+	return addresses, nil
+}
+
+// maxHeadersRange is the maximum number of headers debug_getHeadersRange returns
+// per call.
+const maxHeadersRange = 8192
+
+// GetHeadersRange returns the RLP encodings of up to count canonical headers from
+// the start block onwards, stopping early at the chain head. Frozen headers are
+// served straight from the ancient store.
+func (api *PublicDebugAPI) GetHeadersRange(start, count hexutil.Uint64) ([]hexutil.Bytes, error) {
+	if count > maxHeadersRange {
+		return nil, fmt.Errorf("requested %d headers, more than the limit of %d", count, maxHeadersRange)
+	}
+	var (
+		head    = api.eth.blockchain.CurrentHeader().Number.Uint64()
+		headers = []hexutil.Bytes{}
+	)
+	for number := uint64(start); number < uint64(start)+uint64(count) && number <= head; number++ {
+		data := rawdb.ReadCanonicalHeaderRLP(api.eth.chainDb, number)
+		if len(data) == 0 {
+			return nil, fmt.Errorf("header #%d not found", number)
+		}
+		headers = append(headers, hexutil.Bytes(data))
+	}
+	return headers, nil
+}
+
 // AccountRangeMaxResults is the maximum number of results to be returned per call
 const AccountRangeMaxResults = 256
 
@@ -411,11 +724,14 @@ type storageEntry struct {
 }
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
+// Use eth_getStorageRangeAt to page through the storage of a contract at the end of
+// a block, in a stable order.
 func (api *PrivateDebugAPI) StorageRangeAt(blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
-	_, _, statedb, err := api.computeTxEnv(blockHash, txIndex, 0)
+	_, _, statedb, release, err := api.computeTxEnv(blockHash, txIndex, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
+	defer release()
 	st := statedb.StorageTrie(contractAddress)
 	if st == nil {
 		return StorageRangeResult{}, fmt.Errorf("account %x doesn't exist", contractAddress)
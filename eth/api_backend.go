@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
@@ -45,6 +46,7 @@ type EthAPIBackend struct {
 	extRPCEnabled bool
 	eth           *Ethereum
 	gpo           *gasprice.Oracle
+	snapAudit     *state.SnapshotAudit // Checker of the state reads served from the snapshot, if enabled
 }
 
 // ChainConfig returns the active chain configuration.
@@ -61,6 +63,10 @@ func (b *EthAPIBackend) SetHead(number uint64) {
 	b.eth.blockchain.SetHead(number)
 }
 
+func (b *EthAPIBackend) SetHeadPreview(number uint64) (*core.SetHeadPlan, error) {
+	return b.eth.blockchain.SetHeadPreview(number), nil
+}
+
 func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
 	// Pending block is only known by the miner
 	if number == rpc.PendingBlockNumber {
@@ -147,7 +153,7 @@ func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.B
 	if header == nil {
 		return nil, nil, errors.New("header not found")
 	}
-	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	stateDb, err := b.stateAt(header.Root)
 	return stateDb, header, err
 }
 
@@ -166,12 +172,26 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
 			return nil, nil, errors.New("hash is not currently canonical")
 		}
-		stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+		stateDb, err := b.stateAt(header.Root)
 		return stateDb, header, err
 	}
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// stateAt opens the state of the given root to serve RPC reads from, bypassing
+// the snapshot if it's disabled for reads.
+func (b *EthAPIBackend) stateAt(root common.Hash) (*state.StateDB, error) {
+	if b.eth.config.SnapshotNoReads {
+		return state.New(root, b.eth.blockchain.StateCache(), nil)
+	}
+	statedb, err := b.eth.blockchain.StateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	statedb.SetSnapshotAudit(b.snapAudit)
+	return statedb, nil
+}
+
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
 	return b.eth.blockchain.GetReceiptsByHash(hash), nil
 }
@@ -223,8 +243,22 @@ func (b *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 	return b.eth.BlockChain().SubscribeLogsEvent(ch)
 }
 
+func (b *EthAPIBackend) ValidateTx(ctx context.Context, tx *types.Transaction, local bool) error {
+	return b.eth.txPool.Validate(tx, local)
+}
+
 func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
-	return b.eth.txPool.AddLocal(signedTx)
+	// A secondary instance has no networking, pooled transactions would never leave
+	if b.eth.stack != nil && b.eth.stack.Config().PrimaryDataDir != "" {
+		return errSecondaryTransaction
+	}
+	if err := b.eth.txPool.AddLocal(signedTx); err != nil {
+		return err
+	}
+	if b.eth.txManager != nil {
+		b.eth.txManager.Track(signedTx)
+	}
+	return nil
 }
 
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
@@ -264,6 +298,10 @@ func (b *EthAPIBackend) TxPool() *core.TxPool {
 	return b.eth.TxPool()
 }
 
+func (b *EthAPIBackend) BlockChain() *core.BlockChain {
+	return b.eth.BlockChain()
+}
+
 func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.eth.TxPool().SubscribeNewTxsEvent(ch)
 }
@@ -280,6 +318,14 @@ func (b *EthAPIBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *EthAPIBackend) GasForecast(ctx context.Context, blocks int, percentiles []float64) (*gasprice.Forecast, error) {
+	pending, err := b.GetPoolTransactions()
+	if err != nil {
+		return nil, err
+	}
+	return b.gpo.Forecast(ctx, pending, blocks, percentiles)
+}
+
 func (b *EthAPIBackend) ChainDb() ethdb.Database {
 	return b.eth.ChainDb()
 }
@@ -304,6 +350,22 @@ func (b *EthAPIBackend) RPCTxFeeCap() float64 {
 	return b.eth.config.RPCTxFeeCap
 }
 
+func (b *EthAPIBackend) RPCCacheSize() int {
+	return b.eth.config.RPCCacheSize
+}
+
+func (b *EthAPIBackend) RPCCacheTTL() time.Duration {
+	return b.eth.config.RPCCacheTTL
+}
+
+func (b *EthAPIBackend) RPCLogsRangeCap() uint64 {
+	return b.eth.config.RPCLogsRangeCap
+}
+
+func (b *EthAPIBackend) RPCErrorCodes() bool {
+	return b.eth.config.RPCErrorCodes
+}
+
 func (b *EthAPIBackend) BloomStatus() (uint64, uint64) {
 	sections, _, _ := b.eth.bloomIndexer.Sections()
 	return vars.BloomBitsBlocks, sections
@@ -330,3 +392,7 @@ func (b *EthAPIBackend) Miner() *miner.Miner {
 func (b *EthAPIBackend) StartMining(threads int) error {
 	return b.eth.StartMining(threads)
 }
+
+func (b *EthAPIBackend) SetEtherbase(etherbase common.Address) {
+	b.eth.SetEtherbase(etherbase)
+}
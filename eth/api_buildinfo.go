@@ -0,0 +1,94 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// BuildInfo describes the binary a node is running and the subsystems enabled
+// in it, for fleet management to verify nodes run the intended feature set.
+type BuildInfo struct {
+	Version    string        `json:"version"`
+	Commit     string        `json:"commit,omitempty"`
+	CommitDate string        `json:"commitDate,omitempty"`
+	Go         string        `json:"go"`
+	Platform   string        `json:"platform"`
+	Tags       []string      `json:"tags"`
+	Features   BuildFeatures `json:"features"`
+	Chain      ChainIdentity `json:"chain"`
+}
+
+// BuildFeatures are the optional subsystems enabled in a node.
+type BuildFeatures struct {
+	RemoteFreezer  bool `json:"remoteFreezer"`  // Ancient data stored on a remote freezer server
+	Snapshot       bool `json:"snapshot"`       // State snapshot acceleration
+	HistoryPruning bool `json:"historyPruning"` // Old block bodies and receipts discarded
+	UncleIndex     bool `json:"uncleIndex"`
+	ContractIndex  bool `json:"contractIndex"`
+	TokenIndex     bool `json:"tokenIndex"`
+	TrackSupply    bool `json:"trackSupply"`
+	Preimages      bool `json:"preimages"`
+	HeadWatch      bool `json:"headWatch"`
+	ForkMonitor    bool `json:"forkMonitor"`
+}
+
+// ChainIdentity identifies the network a node is running on.
+type ChainIdentity struct {
+	NetworkID hexutil.Uint64 `json:"networkId"`
+	ChainID   *hexutil.Big   `json:"chainId"`
+	Genesis   common.Hash    `json:"genesis"`
+}
+
+// BuildInfo reports the build of the node, the optional subsystems enabled and
+// the network it is running on. The report only depends on the binary and the
+// configuration, so nodes set up alike report the same.
+func (api *PrivateAdminAPI) BuildInfo() *BuildInfo {
+	config := api.eth.config
+	info := &BuildInfo{
+		Version:    params.VersionWithMeta,
+		Commit:     params.GitCommit,
+		CommitDate: params.GitDate,
+		Go:         runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Tags:       params.BuildTags(),
+		Features: BuildFeatures{
+			RemoteFreezer:  config.DatabaseFreezerRemote != "",
+			Snapshot:       config.SnapshotCache > 0,
+			HistoryPruning: config.HistoryRetain > 0,
+			UncleIndex:     config.UncleIndex,
+			ContractIndex:  config.ContractIndex,
+			TokenIndex:     config.TokenIndex,
+			TrackSupply:    config.TrackSupply,
+			Preimages:      config.EnablePreimageRecording,
+			HeadWatch:      len(config.HeadWatch.Endpoints) > 0,
+			ForkMonitor:    config.ForkMonitor.Enabled,
+		},
+		Chain: ChainIdentity{
+			NetworkID: hexutil.Uint64(api.eth.networkID),
+			Genesis:   api.eth.blockchain.Genesis().Hash(),
+		},
+	}
+	if id := api.eth.blockchain.Config().GetChainID(); id != nil {
+		info.Chain.ChainID = (*hexutil.Big)(id)
+	}
+	return info
+}
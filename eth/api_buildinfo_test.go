@@ -0,0 +1,57 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+func TestBuildInfo(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &genesisT.Genesis{Config: params.TestChainConfig}
+		config = DefaultConfig
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	config.TokenIndex = true
+	config.DatabaseFreezerRemote = "http://localhost:9797"
+	api := NewPrivateAdminAPI(&Ethereum{config: &config, blockchain: chain, networkID: 7})
+
+	info := api.BuildInfo()
+	if info.Version != params.VersionWithMeta {
+		t.Errorf("version mismatch: have %s, want %s", info.Version, params.VersionWithMeta)
+	}
+	if !info.Features.TokenIndex || !info.Features.RemoteFreezer || info.Features.ContractIndex {
+		t.Errorf("features mismatch: %+v", info.Features)
+	}
+	if info.Chain.NetworkID != 7 || info.Chain.Genesis != genesis.Hash() {
+		t.Errorf("chain identity mismatch: %+v", info.Chain)
+	}
+	if info.Chain.ChainID == nil || info.Chain.ChainID.ToInt().Cmp(gspec.Config.GetChainID()) != 0 {
+		t.Errorf("chain id mismatch: have %v, want %v", info.Chain.ChainID, gspec.Config.GetChainID())
+	}
+}
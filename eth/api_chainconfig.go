@@ -0,0 +1,107 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/confp/generic"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// ChainConfigDiff describes how a chain specification differs from the one the
+// node is running on.
+type ChainConfigDiff struct {
+	Genesis         *GenesisDiff       `json:"genesis,omitempty"` // Only for full genesis specifications
+	Config          []ctypes.FieldDiff `json:"config"`
+	Compatible      bool               `json:"compatible"`
+	Incompatibility string             `json:"incompatibility,omitempty"`
+	RewindTo        *hexutil.Uint64    `json:"rewindTo,omitempty"` // Block the chain would be rewound to
+}
+
+// GenesisDiff describes how the genesis block of a specification differs from
+// the one of the running chain.
+type GenesisDiff struct {
+	Stored common.Hash        `json:"stored"`
+	New    common.Hash        `json:"new"`
+	Fields []ctypes.FieldDiff `json:"fields"`
+}
+
+// ChainConfigDiff compares a chain specification, either a full genesis or a
+// chain configuration in any of the supported formats, with the one the node is
+// running on, reporting the differing fields and whether switching to it would
+// be accepted at the current head. The stored configuration is left untouched.
+func (api *PrivateAdminAPI) ChainConfigDiff(spec json.RawMessage) (*ChainConfigDiff, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(spec, &fields); err != nil {
+		return nil, err
+	}
+	var (
+		config  ctypes.ChainConfigurator
+		genesis *genesisT.Genesis
+	)
+	if _, ok := fields["alloc"]; ok {
+		genesis = new(genesisT.Genesis)
+		if err := json.Unmarshal(spec, genesis); err != nil {
+			return nil, err
+		}
+		config = genesis.Config
+	} else {
+		var err error
+		if config, err = generic.UnmarshalChainConfigurator(spec); err != nil {
+			return nil, err
+		}
+	}
+	if config == nil || confp.IsEmpty(config) {
+		return nil, errors.New("chain specification has no configuration")
+	}
+	chain := api.eth.blockchain
+	diff := &ChainConfigDiff{Config: confp.Diff(chain.Config(), config), Compatible: true}
+	if diff.Config == nil {
+		diff.Config = []ctypes.FieldDiff{}
+	}
+	if genesis != nil {
+		stored := chain.Genesis()
+		diff.Genesis = &GenesisDiff{
+			Stored: stored.Hash(),
+			New:    core.GenesisToBlock(genesis, nil).Hash(),
+			Fields: core.DiffGenesis(stored.Header(), genesis),
+		}
+		if diff.Genesis.Fields == nil {
+			diff.Genesis.Fields = []ctypes.FieldDiff{}
+		}
+		if diff.Genesis.Stored != diff.Genesis.New {
+			diff.Compatible = false
+			diff.Incompatibility = (&genesisT.GenesisMismatchError{Stored: diff.Genesis.Stored, New: diff.Genesis.New}).Error()
+			return diff, nil
+		}
+	}
+	head := chain.CurrentHeader().Number.Uint64()
+	if err := confp.Compatible(&head, chain.Config(), config); err != nil {
+		diff.Compatible = false
+		diff.Incompatibility = err.Error()
+		rewind := hexutil.Uint64(err.RewindTo)
+		diff.RewindTo = &rewind
+	}
+	return diff, nil
+}
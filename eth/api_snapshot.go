@@ -0,0 +1,187 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Sources of the state reads served over RPC.
+const (
+	stateSourceSnapshot = "snapshot"
+	stateSourceTrie     = "trie"
+)
+
+// StateSourceAccount is an account as read from the snapshot or the trie.
+type StateSourceAccount struct {
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Balance     *hexutil.Big   `json:"balance"`
+	StorageRoot common.Hash    `json:"storageRoot"`
+	CodeHash    common.Hash    `json:"codeHash"`
+}
+
+// StateSourceSlot is a storage slot as read from the snapshot and the trie.
+type StateSourceSlot struct {
+	Key      common.Hash  `json:"key"`
+	Source   string       `json:"source"`             // Source serving the RPC reads of the slot
+	Reason   string       `json:"reason,omitempty"`   // Reason of serving the slot from the trie, if so
+	Snapshot *common.Hash `json:"snapshot,omitempty"` // Value in the snapshot, if readable
+	Trie     common.Hash  `json:"trie"`               // Value in the trie
+	Match    bool         `json:"match"`
+}
+
+// StateSourceResult tells where the RPC reads of an account and its storage
+// are served from, along with their values in both the snapshot and the trie.
+type StateSourceResult struct {
+	Address  common.Address      `json:"address"`
+	Source   string              `json:"source"`             // Source serving the RPC reads of the account
+	Reason   string              `json:"reason,omitempty"`   // Reason of serving the account from the trie, if so
+	Snapshot *StateSourceAccount `json:"snapshot,omitempty"` // Account in the snapshot, if readable and existing
+	Trie     *StateSourceAccount `json:"trie,omitempty"`     // Account in the trie, if existing
+	Match    bool                `json:"match"`
+	Storage  []StateSourceSlot   `json:"storage"`
+}
+
+// SnapshotAuditStats are the results of the sampled comparison of the RPC state
+// reads served from the snapshot with the trie.
+type SnapshotAuditStats struct {
+	Rate       float64        `json:"rate"`
+	Checked    hexutil.Uint64 `json:"checked"`
+	Mismatched hexutil.Uint64 `json:"mismatched"`
+}
+
+// StateSource reports whether the RPC reads of an account and the given storage
+// slots at a block are served from the snapshot or the trie, reading them from
+// both to check they match.
+func (api *PrivateDebugAPI) StateSource(ctx context.Context, address common.Address, keys []common.Hash, blockNrOrHash rpc.BlockNumberOrHash) (*StateSourceResult, error) {
+	header, err := api.eth.APIBackend.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errors.New("header not found")
+	}
+	statedb, err := state.New(header.Root, api.eth.blockchain.StateCache(), nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &StateSourceResult{Address: address, Source: stateSourceSnapshot, Storage: []StateSourceSlot{}}
+	if statedb.Exist(address) {
+		result.Trie = &StateSourceAccount{
+			Nonce:    hexutil.Uint64(statedb.GetNonce(address)),
+			Balance:  (*hexutil.Big)(statedb.GetBalance(address)),
+			CodeHash: statedb.GetCodeHash(address),
+		}
+		if tr := statedb.StorageTrie(address); tr != nil {
+			result.Trie.StorageRoot = tr.Hash()
+		}
+	}
+	// Resolve the snapshot layer serving the reads, if any
+	var snap snapshot.Snapshot
+	switch tree := api.eth.blockchain.Snapshot(); {
+	case api.eth.config.SnapshotNoReads:
+		result.Reason = "snapshot reads disabled"
+	case tree == nil:
+		result.Reason = "snapshot disabled"
+	default:
+		if snap = tree.Snapshot(header.Root); snap == nil {
+			result.Reason = "snapshot unavailable for the state"
+		}
+	}
+	accountHash := crypto.Keccak256Hash(address.Bytes())
+	if snap != nil {
+		if acc, err := snap.Account(accountHash); err != nil {
+			result.Reason = err.Error()
+		} else if acc != nil {
+			result.Snapshot = &StateSourceAccount{
+				Nonce:       hexutil.Uint64(acc.Nonce),
+				Balance:     (*hexutil.Big)(acc.Balance),
+				StorageRoot: common.BytesToHash(acc.Root),
+				CodeHash:    common.BytesToHash(acc.CodeHash),
+			}
+			if len(acc.Root) == 0 {
+				result.Snapshot.StorageRoot = types.EmptyRootHash
+			}
+			if len(acc.CodeHash) == 0 {
+				result.Snapshot.CodeHash = crypto.Keccak256Hash(nil)
+			}
+		}
+	}
+	if result.Reason != "" {
+		result.Source = stateSourceTrie
+		result.Match = true
+	} else {
+		result.Match = sameStateSourceAccount(result.Snapshot, result.Trie)
+	}
+	// Read the requested storage slots from both sources as well
+	for _, key := range keys {
+		slot := StateSourceSlot{Key: key, Source: result.Source, Reason: result.Reason, Trie: statedb.GetState(address, key), Match: true}
+		if result.Reason == "" {
+			enc, err := snap.Storage(accountHash, crypto.Keccak256Hash(key.Bytes()))
+			if err != nil {
+				slot.Source, slot.Reason = stateSourceTrie, err.Error()
+			} else {
+				var value common.Hash
+				if len(enc) > 0 {
+					_, content, _, err := rlp.Split(enc)
+					if err != nil {
+						return nil, err
+					}
+					value.SetBytes(content)
+				}
+				slot.Snapshot, slot.Match = &value, value == slot.Trie
+			}
+		}
+		result.Storage = append(result.Storage, slot)
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SnapshotAuditStats returns the results of the sampled comparison of the RPC
+// state reads served from the snapshot with the trie, enabled by the
+// --snapshot.audit flag.
+func (api *PrivateDebugAPI) SnapshotAuditStats() (*SnapshotAuditStats, error) {
+	audit := api.eth.APIBackend.snapAudit
+	if audit == nil {
+		return nil, errors.New("snapshot audit disabled")
+	}
+	checked, mismatched := audit.Stats()
+	return &SnapshotAuditStats{Rate: audit.Rate(), Checked: hexutil.Uint64(checked), Mismatched: hexutil.Uint64(mismatched)}, nil
+}
+
+// sameStateSourceAccount reports whether two accounts read from the snapshot
+// and the trie, nil if missing, are the same.
+func sameStateSourceAccount(a, b *StateSourceAccount) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce && a.Balance.ToInt().Cmp(b.Balance.ToInt()) == 0 &&
+		a.StorageRoot == b.StorageRoot && a.CodeHash == b.CodeHash
+}
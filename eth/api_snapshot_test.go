@@ -0,0 +1,99 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestStateSource(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		good    = common.Address{0x01}
+		corrupt = common.Address{0x02}
+		key     = common.Hash{0x03}
+		gspec   = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				good:    {Balance: big.NewInt(1), Storage: map[common.Hash]common.Hash{key: {0x04}}},
+				corrupt: {Balance: big.NewInt(2)},
+			},
+		}
+		cacheConfig = &core.CacheConfig{TrieCleanLimit: 16, TrieDirtyLimit: 16, TrieTimeLimit: time.Minute, SnapshotLimit: 16, SnapshotWait: true}
+	)
+	core.MustCommitGenesis(db, gspec)
+	chain, err := core.NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	eth := &Ethereum{blockchain: chain, chainDb: db, config: &Config{}}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	api := NewPrivateDebugAPI(eth)
+
+	// Reads are served from the snapshot, matching the trie
+	block := rpc.BlockNumberOrHashWithNumber(0)
+	result, err := api.StateSource(context.Background(), good, []common.Hash{key}, block)
+	if err != nil {
+		t.Fatalf("failed to retrieve state source: %v", err)
+	}
+	if result.Source != stateSourceSnapshot || !result.Match || result.Trie == nil || result.Trie.Balance.ToInt().Int64() != 1 {
+		t.Fatalf("account source mismatch: %+v", result)
+	}
+	if slot := result.Storage[0]; slot.Source != stateSourceSnapshot || !slot.Match || slot.Trie != (common.Hash{0x04}) {
+		t.Fatalf("slot source mismatch: %+v", slot)
+	}
+	// Corrupted snapshot entries are detected
+	rawdb.WriteAccountSnapshot(db, crypto.Keccak256Hash(corrupt[:]), snapshot.SlimAccountRLP(0, big.NewInt(3), types.EmptyRootHash, crypto.Keccak256(nil)))
+	if result, err = api.StateSource(context.Background(), corrupt, nil, block); err != nil {
+		t.Fatalf("failed to retrieve state source: %v", err)
+	}
+	if result.Match || result.Snapshot.Balance.ToInt().Int64() != 3 {
+		t.Fatalf("corrupt snapshot not detected: %+v", result)
+	}
+	// Reads are served from the trie if disabled for the snapshot
+	eth.config.SnapshotNoReads = true
+	if result, err = api.StateSource(context.Background(), corrupt, []common.Hash{key}, block); err != nil {
+		t.Fatalf("failed to retrieve state source: %v", err)
+	}
+	if result.Source != stateSourceTrie || result.Reason == "" || result.Storage[0].Source != stateSourceTrie {
+		t.Fatalf("snapshot reads not disabled: %+v", result)
+	}
+	statedb, _, err := eth.APIBackend.StateAndHeaderByNumber(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if balance := statedb.GetBalance(corrupt); balance.Int64() != 2 {
+		t.Fatalf("state read from the snapshot: balance %v", balance)
+	}
+}
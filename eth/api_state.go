@@ -0,0 +1,466 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// TrieStats are the statistics of the nodes making up a trie.
+type TrieStats struct {
+	Root        common.Hash      `json:"root"`
+	FullNodes   hexutil.Uint64   `json:"fullNodes"`
+	ShortNodes  hexutil.Uint64   `json:"shortNodes"`
+	Values      hexutil.Uint64   `json:"values"`
+	HashedNodes hexutil.Uint64   `json:"hashedNodes"` // Nodes stored on their own, the others being embedded in their parent
+	Size        hexutil.Uint64   `json:"size"`        // Total size of the nodes stored on their own
+	Depths      []hexutil.Uint64 `json:"depths"`      // Number of values by the number of nodes on their path
+	Elapsed     string           `json:"elapsed"`
+}
+
+// TrieStats iterates over all the nodes of the trie with the given root, a state
+// or a storage root, counting them by type and their values by depth. Iterating
+// over a whole state trie takes hours, cancel the request to abort it.
+func (api *PrivateDebugAPI) TrieStats(ctx context.Context, root common.Hash) (*TrieStats, error) {
+	tr, err := trie.New(root, api.eth.blockchain.StateCache().TrieDB())
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	stats, err := tr.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &TrieStats{
+		Root:        root,
+		FullNodes:   hexutil.Uint64(stats.FullNodes),
+		ShortNodes:  hexutil.Uint64(stats.ShortNodes),
+		Values:      hexutil.Uint64(stats.Values),
+		HashedNodes: hexutil.Uint64(stats.HashedNodes),
+		Size:        hexutil.Uint64(stats.Size),
+		Depths:      make([]hexutil.Uint64, len(stats.Depths)),
+		Elapsed:     time.Since(start).String(),
+	}
+	for i, count := range stats.Depths {
+		res.Depths[i] = hexutil.Uint64(count)
+	}
+	return res, nil
+}
+
+// storageSizeTimeout is the maximum time spent counting the storage slots of an
+// account, past which the count so far is returned.
+var storageSizeTimeout = 5 * time.Second
+
+// StorageSize is the number of storage slots of an account.
+type StorageSize struct {
+	Address  common.Address `json:"address"`
+	Block    hexutil.Uint64 `json:"block"`
+	Root     common.Hash    `json:"storageRoot"`
+	Slots    hexutil.Uint64 `json:"slots"`
+	Source   string         `json:"source"`   // Data the slots were counted in, "snapshot" or "trie"
+	Complete bool           `json:"complete"` // Whether all the slots were counted, the count being a lower bound otherwise
+}
+
+// GetStorageSize counts the storage slots of the account at the given address in
+// the current state. As the state keeps changing, the count is an estimate. The
+// slots are counted in the state snapshot if enabled and generated, otherwise in
+// the storage trie, which is much slower. Counting stops after a few seconds,
+// reporting the slots counted so far as incomplete.
+func (api *PublicEthereumAPI) GetStorageSize(parent context.Context, address common.Address) (*StorageSize, error) {
+	ctx, cancel := context.WithTimeout(parent, storageSizeTimeout)
+	defer cancel()
+
+	block := api.e.blockchain.CurrentBlock()
+	statedb, err := api.e.blockchain.StateAt(block.Root())
+	if err != nil {
+		return nil, err
+	}
+	res := &StorageSize{
+		Address: address,
+		Block:   hexutil.Uint64(block.NumberU64()),
+	}
+	tr := statedb.StorageTrie(address)
+	if tr == nil {
+		res.Source, res.Complete = "trie", true
+		return res, nil
+	}
+	res.Root = tr.Hash()
+
+	if snaps := api.e.blockchain.Snapshot(); snaps != nil {
+		slots, err := countSnapshotSlots(ctx, snaps, block.Root(), crypto.Keccak256Hash(address.Bytes()))
+		if err == nil || ctx.Err() != nil {
+			if parent.Err() != nil {
+				return nil, parent.Err()
+			}
+			res.Slots, res.Source, res.Complete = hexutil.Uint64(slots), "snapshot", err == nil
+			return res, nil
+		}
+	}
+	res.Source = "trie"
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for slots := 0; it.Next(); slots++ {
+		if slots%1024 == 0 && ctx.Err() != nil {
+			if parent.Err() != nil {
+				return nil, parent.Err()
+			}
+			return res, nil
+		}
+		res.Slots++
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	res.Complete = true
+	return res, nil
+}
+
+// countSnapshotSlots counts the storage slots of an account in the snapshot of
+// the given state, failing if the snapshot doesn't cover all of them yet. If the
+// context is done, the slots counted so far are returned with its error.
+func countSnapshotSlots(ctx context.Context, snaps *snapshot.Tree, root common.Hash, account common.Hash) (uint64, error) {
+	snap := snaps.Snapshot(root)
+	if snap == nil {
+		return 0, snapshot.ErrNotCoveredYet
+	}
+	// The snapshot is generated in order, so coverage of the last possible slot
+	// ensures all the slots of the account are covered
+	last := common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	if _, err := snap.Storage(account, last); err != nil {
+		return 0, err
+	}
+	it, err := snaps.StorageIterator(root, account, common.Hash{})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Release()
+
+	var slots uint64
+	for it.Next() {
+		if slots%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return slots, err
+			}
+		}
+		slots++
+	}
+	return slots, it.Error()
+}
+
+const (
+	// diffStateDefaultLimit is the default number of accounts returned by a
+	// state diff, diffStateMaxLimit the maximum.
+	diffStateDefaultLimit = 256
+	diffStateMaxLimit     = 4096
+
+	// diffStateDefaultStorageLimit is the default number of storage slots returned
+	// per account by a state diff.
+	diffStateDefaultStorageLimit = 1024
+)
+
+// DiffStateOptions are the options of a state diff.
+type DiffStateOptions struct {
+	Start        *common.Hash `json:"start"`        // Hash of the first account to diff, for paging
+	Limit        int          `json:"limit"`        // Maximum number of accounts to return
+	NoStorage    bool         `json:"noStorage"`    // Whether to omit the storage slots changed
+	StorageLimit int          `json:"storageLimit"` // Maximum number of storage slots to return per account
+}
+
+// StateDiffAccount is the state of an account on one side of a state diff.
+type StateDiffAccount struct {
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Balance     *hexutil.Big   `json:"balance"`
+	StorageRoot common.Hash    `json:"storageRoot"`
+	CodeHash    common.Hash    `json:"codeHash"`
+}
+
+// StateDiffSlot is a storage slot changed between the two sides of a state diff.
+type StateDiffSlot struct {
+	Hash   common.Hash  `json:"hash"`             // Hash of the slot, its key in the storage trie
+	Key    *common.Hash `json:"key,omitempty"`    // Slot, if its preimage is known
+	Before *common.Hash `json:"before,omitempty"` // Value before, nil if unset
+	After  *common.Hash `json:"after,omitempty"`  // Value after, nil if unset
+}
+
+// StateDiffEntry is an account changed between the two sides of a state diff.
+type StateDiffEntry struct {
+	Hash             common.Hash       `json:"hash"`              // Hash of the address, its key in the state trie
+	Address          *common.Address   `json:"address,omitempty"` // Address, if its preimage is known
+	Change           string            `json:"change"`            // Either "created", "deleted" or "modified"
+	Before           *StateDiffAccount `json:"before,omitempty"`
+	After            *StateDiffAccount `json:"after,omitempty"`
+	Storage          []*StateDiffSlot  `json:"storage,omitempty"`
+	StorageTruncated bool              `json:"storageTruncated,omitempty"` // Whether more slots changed than returned
+}
+
+// StateDiffBlock identifies the block on one side of a state diff.
+type StateDiffBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+	Root   common.Hash    `json:"stateRoot"`
+}
+
+// StateDiff is a page of the accounts changed between two blocks, ordered by
+// the hash of their address.
+type StateDiff struct {
+	From     StateDiffBlock    `json:"from"`
+	To       StateDiffBlock    `json:"to"`
+	Accounts []*StateDiffEntry `json:"accounts"`
+	Next     *common.Hash      `json:"next,omitempty"` // Start of the next page, nil if complete
+}
+
+// DiffState returns the accounts created, deleted and modified between the state
+// of two blocks, along with their storage slots changed, by walking the parts of
+// the state tries that differ. The states of both blocks must be available. The
+// accounts are returned in pages, starting from the account hash in the options.
+func (api *PrivateDebugAPI) DiffState(ctx context.Context, from rpc.BlockNumberOrHash, to rpc.BlockNumberOrHash, options *DiffStateOptions) (*StateDiff, error) {
+	opts := DiffStateOptions{Limit: diffStateDefaultLimit, StorageLimit: diffStateDefaultStorageLimit}
+	if options != nil {
+		opts.Start, opts.NoStorage = options.Start, options.NoStorage
+		if options.Limit > 0 {
+			opts.Limit = options.Limit
+		}
+		if options.StorageLimit > 0 {
+			opts.StorageLimit = options.StorageLimit
+		}
+	}
+	if opts.Limit > diffStateMaxLimit {
+		return nil, fmt.Errorf("limit %d exceeds the maximum of %d", opts.Limit, diffStateMaxLimit)
+	}
+	fromHeader, err := api.stateHeader(from)
+	if err != nil {
+		return nil, err
+	}
+	toHeader, err := api.stateHeader(to)
+	if err != nil {
+		return nil, err
+	}
+	triedb := api.eth.blockchain.StateCache().TrieDB()
+	fromTrie, err := trie.New(fromHeader.Root, triedb)
+	if err != nil {
+		return nil, err
+	}
+	toTrie, err := trie.New(toHeader.Root, triedb)
+	if err != nil {
+		return nil, err
+	}
+	res := &StateDiff{
+		From:     StateDiffBlock{Number: hexutil.Uint64(fromHeader.Number.Uint64()), Hash: fromHeader.Hash(), Root: fromHeader.Root},
+		To:       StateDiffBlock{Number: hexutil.Uint64(toHeader.Number.Uint64()), Hash: toHeader.Hash(), Root: toHeader.Root},
+		Accounts: []*StateDiffEntry{},
+	}
+	var start []byte
+	if opts.Start != nil {
+		start = opts.Start.Bytes()
+	}
+	var failure error
+	next, err := diffTries(fromTrie, toTrie, start, func(key, before, after []byte) bool {
+		if len(res.Accounts) >= opts.Limit {
+			return false
+		}
+		if failure = ctx.Err(); failure != nil {
+			return false
+		}
+		var entry *StateDiffEntry
+		if entry, failure = api.diffAccount(triedb, key, before, after, &opts); failure != nil {
+			return false
+		}
+		res.Accounts = append(res.Accounts, entry)
+		return true
+	})
+	if failure != nil {
+		return nil, failure
+	}
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		hash := common.BytesToHash(next)
+		res.Next = &hash
+	}
+	return res, nil
+}
+
+// stateHeader resolves the header of the block whose state to access.
+func (api *PrivateDebugAPI) stateHeader(blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	chain := api.eth.blockchain
+
+	var header *types.Header
+	if number, ok := blockNrOrHash.Number(); ok {
+		switch number {
+		case rpc.PendingBlockNumber:
+			return nil, errors.New("state of the pending block is not diffable")
+		case rpc.LatestBlockNumber:
+			header = chain.CurrentHeader()
+		default:
+			header = chain.GetHeaderByNumber(uint64(number))
+		}
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		header = chain.GetHeaderByHash(hash)
+	}
+	if header == nil {
+		return nil, errors.New("block not found")
+	}
+	return header, nil
+}
+
+// diffAccount assembles the diff of an account out of its encodings on both
+// sides, nil if missing, diffing its storage as well unless disabled.
+func (api *PrivateDebugAPI) diffAccount(triedb *trie.Database, key, before, after []byte, opts *DiffStateOptions) (*StateDiffEntry, error) {
+	entry := &StateDiffEntry{Hash: common.BytesToHash(key)}
+	if preimage := rawdb.ReadPreimage(api.eth.chainDb, entry.Hash); preimage != nil {
+		address := common.BytesToAddress(preimage)
+		entry.Address = &address
+	}
+	var err error
+	if entry.Before, err = decodeDiffAccount(before); err != nil {
+		return nil, err
+	}
+	if entry.After, err = decodeDiffAccount(after); err != nil {
+		return nil, err
+	}
+	fromRoot, toRoot := types.EmptyRootHash, types.EmptyRootHash
+	switch {
+	case entry.Before == nil:
+		entry.Change, toRoot = "created", entry.After.StorageRoot
+	case entry.After == nil:
+		entry.Change, fromRoot = "deleted", entry.Before.StorageRoot
+	default:
+		entry.Change, fromRoot, toRoot = "modified", entry.Before.StorageRoot, entry.After.StorageRoot
+	}
+	if opts.NoStorage || fromRoot == toRoot {
+		return entry, nil
+	}
+	fromTrie, err := trie.New(fromRoot, triedb)
+	if err != nil {
+		return nil, err
+	}
+	toTrie, err := trie.New(toRoot, triedb)
+	if err != nil {
+		return nil, err
+	}
+	var failure error
+	_, err = diffTries(fromTrie, toTrie, nil, func(key, before, after []byte) bool {
+		if len(entry.Storage) >= opts.StorageLimit {
+			entry.StorageTruncated = true
+			return false
+		}
+		slot := &StateDiffSlot{Hash: common.BytesToHash(key)}
+		if preimage := rawdb.ReadPreimage(api.eth.chainDb, slot.Hash); preimage != nil {
+			key := common.BytesToHash(preimage)
+			slot.Key = &key
+		}
+		if slot.Before, failure = decodeDiffSlot(before); failure != nil {
+			return false
+		}
+		if slot.After, failure = decodeDiffSlot(after); failure != nil {
+			return false
+		}
+		entry.Storage = append(entry.Storage, slot)
+		return true
+	})
+	if failure != nil {
+		return nil, failure
+	}
+	return entry, err
+}
+
+// diffTries walks the leaves differing between two tries in key order from the
+// given start, calling visit with their values on both sides, nil if missing.
+// If visit returns false, the walk is stopped and the key of the leaf rejected
+// returned.
+func diffTries(from, to *trie.Trie, start []byte, visit func(key, before, after []byte) bool) ([]byte, error) {
+	removed, _ := trie.NewDifferenceIterator(to.NodeIterator(start), from.NodeIterator(start))
+	added, _ := trie.NewDifferenceIterator(from.NodeIterator(start), to.NodeIterator(start))
+
+	var (
+		before = trie.NewIterator(removed)
+		after  = trie.NewIterator(added)
+	)
+	hasBefore, hasAfter := before.Next(), after.Next()
+	for hasBefore || hasAfter {
+		var (
+			stepBefore = hasBefore && (!hasAfter || bytes.Compare(before.Key, after.Key) <= 0)
+			stepAfter  = hasAfter && (!hasBefore || bytes.Compare(after.Key, before.Key) <= 0)
+			key        []byte
+			prev, next []byte
+		)
+		if stepBefore {
+			key, prev = before.Key, before.Value
+		}
+		if stepAfter {
+			key, next = after.Key, after.Value
+		}
+		if !visit(key, prev, next) {
+			return key, nil
+		}
+		if stepBefore {
+			hasBefore = before.Next()
+		}
+		if stepAfter {
+			hasAfter = after.Next()
+		}
+	}
+	if before.Err != nil {
+		return nil, before.Err
+	}
+	return nil, after.Err
+}
+
+// decodeDiffAccount decodes an account of the state trie, nil if missing.
+func decodeDiffAccount(blob []byte) (*StateDiffAccount, error) {
+	if blob == nil {
+		return nil, nil
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		return nil, err
+	}
+	return &StateDiffAccount{
+		Nonce:       hexutil.Uint64(account.Nonce),
+		Balance:     (*hexutil.Big)(account.Balance),
+		StorageRoot: account.Root,
+		CodeHash:    common.BytesToHash(account.CodeHash),
+	}, nil
+}
+
+// decodeDiffSlot decodes a value of a storage trie, nil if missing.
+func decodeDiffSlot(blob []byte) (*common.Hash, error) {
+	if blob == nil {
+		return nil, nil
+	}
+	_, content, _, err := rlp.Split(blob)
+	if err != nil {
+		return nil, err
+	}
+	value := common.BytesToHash(content)
+	return &value, nil
+}
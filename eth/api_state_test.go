@@ -0,0 +1,194 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the storage slots of a contract are counted both in the snapshot
+// and in the storage trie, and that the trie statistics of its storage agree.
+func TestStorageSize(t *testing.T) {
+	var (
+		contract = common.Address{0xcc}
+		storage  = map[common.Hash]common.Hash{{0x01}: {0x01}, {0x02}: {0x02}, {0x03}: {0x03}}
+	)
+	for _, snapshots := range []bool{true, false} {
+		var (
+			db    = rawdb.NewMemoryDatabase()
+			gspec = &genesisT.Genesis{
+				Config: params.TestChainConfig,
+				Alloc:  genesisT.GenesisAlloc{contract: {Balance: big.NewInt(1), Code: []byte{0x00}, Storage: storage}},
+			}
+		)
+		core.MustCommitGenesis(db, gspec)
+
+		var cache *core.CacheConfig // Defaults to waiting for the snapshot to be generated
+		if !snapshots {
+			cache = &core.CacheConfig{TrieCleanLimit: 16, TrieDirtyLimit: 16}
+		}
+		chain, err := core.NewBlockChain(db, cache, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eth := &Ethereum{blockchain: chain, chainDb: db}
+
+		size, err := NewPublicEthereumAPI(eth).GetStorageSize(context.Background(), contract)
+		if err != nil {
+			t.Fatalf("snapshots %v: failed to count slots: %v", snapshots, err)
+		}
+		if source := map[bool]string{true: "snapshot", false: "trie"}[snapshots]; size.Slots != 3 || size.Source != source || !size.Complete {
+			t.Fatalf("snapshots %v: slot count mismatch: have %d from %s (complete %v), want all 3 from %s", snapshots, size.Slots, size.Source, size.Complete, source)
+		}
+		stats, err := NewPrivateDebugAPI(eth).TrieStats(context.Background(), size.Root)
+		if err != nil {
+			t.Fatalf("snapshots %v: failed to collect storage trie stats: %v", snapshots, err)
+		}
+		if stats.Values != 3 {
+			t.Fatalf("snapshots %v: storage trie value count mismatch: have %d, want 3", snapshots, stats.Values)
+		}
+		if size, _ := NewPublicEthereumAPI(eth).GetStorageSize(context.Background(), common.Address{0xdd}); size.Slots != 0 {
+			t.Fatalf("snapshots %v: missing account has %d slots", snapshots, size.Slots)
+		}
+		// Counts running out of time are reported as incomplete, aborted ones fail
+		timeout := storageSizeTimeout
+		storageSizeTimeout = 0
+		if size, err := NewPublicEthereumAPI(eth).GetStorageSize(context.Background(), contract); err != nil || size.Complete {
+			t.Fatalf("snapshots %v: timed out count mismatch: %+v, %v", snapshots, size, err)
+		}
+		storageSizeTimeout = timeout
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := NewPublicEthereumAPI(eth).GetStorageSize(ctx, contract); err != context.Canceled {
+			t.Fatalf("snapshots %v: aborted count error mismatch: have %v, want %v", snapshots, err, context.Canceled)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that the accounts created, deleted and modified between two blocks are
+// diffed along with their storage, page by page.
+func TestDiffState(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		created  = common.Address{0xc1}
+		modified = common.Address{0xc2} // Stores the call value in slot 0
+		deleted  = common.Address{0xc3} // Self-destructs when called
+		db       = rawdb.NewMemoryDatabase()
+		gspec    = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: genesisT.GenesisAlloc{
+				sender:   {Balance: big.NewInt(vars.Ether)},
+				modified: {Balance: new(big.Int), Code: common.FromHex("34600055"), Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}},
+				deleted:  {Balance: big.NewInt(1), Code: common.FromHex("33ff"), Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}},
+			},
+		}
+		genesis = core.MustCommitGenesis(db, gspec)
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 1, func(i int, gen *core.BlockGen) {
+		for nonce, tx := range []*types.Transaction{
+			types.NewTransaction(0, created, big.NewInt(1), 21000, big.NewInt(1), nil),
+			types.NewTransaction(1, modified, big.NewInt(5), 100000, big.NewInt(1), nil),
+			types.NewTransaction(2, deleted, new(big.Int), 100000, big.NewInt(1), nil),
+		} {
+			signed, err := types.SignTx(tx, signer, key)
+			if err != nil {
+				t.Fatalf("failed to sign transaction %d: %v", nonce, err)
+			}
+			gen.AddTx(signed)
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var (
+		api  = NewPrivateDebugAPI(&Ethereum{blockchain: chain, chainDb: db})
+		from = rpc.BlockNumberOrHashWithNumber(0)
+		to   = rpc.BlockNumberOrHashWithNumber(1)
+	)
+	diff, err := api.DiffState(context.Background(), from, to, nil)
+	if err != nil {
+		t.Fatalf("failed to diff state: %v", err)
+	}
+	if diff.Next != nil || len(diff.Accounts) != 5 { // Including the sender and the coinbase
+		t.Fatalf("diff size mismatch: have %d accounts, next %v, want 5", len(diff.Accounts), diff.Next)
+	}
+	entries := make(map[common.Hash]*StateDiffEntry)
+	for _, entry := range diff.Accounts {
+		entries[entry.Hash] = entry
+	}
+	if entry := entries[crypto.Keccak256Hash(created.Bytes())]; entry == nil || entry.Change != "created" || entry.Before != nil || entry.After.Balance.ToInt().Int64() != 1 || len(entry.Storage) != 0 {
+		t.Fatalf("created account mismatch: %+v", entry)
+	}
+	entry := entries[crypto.Keccak256Hash(modified.Bytes())]
+	if entry == nil || entry.Change != "modified" || len(entry.Storage) != 1 {
+		t.Fatalf("modified account mismatch: %+v", entry)
+	}
+	if slot := entry.Storage[0]; slot.Hash != crypto.Keccak256Hash(common.Hash{}.Bytes()) || slot.Before != nil || *slot.After != common.BigToHash(big.NewInt(5)) {
+		t.Fatalf("modified slot mismatch: %+v", slot)
+	}
+	entry = entries[crypto.Keccak256Hash(deleted.Bytes())]
+	if entry == nil || entry.Change != "deleted" || entry.After != nil || len(entry.Storage) != 1 || entry.Storage[0].After != nil {
+		t.Fatalf("deleted account mismatch: %+v", entry)
+	}
+	// Paging through the diff must yield the same accounts in the same order
+	var (
+		paged []*StateDiffEntry
+		start *common.Hash
+	)
+	for {
+		page, err := api.DiffState(context.Background(), from, to, &DiffStateOptions{Start: start, Limit: 2, NoStorage: true})
+		if err != nil {
+			t.Fatalf("failed to diff state page: %v", err)
+		}
+		paged = append(paged, page.Accounts...)
+		if start = page.Next; start == nil {
+			break
+		}
+	}
+	if len(paged) != len(diff.Accounts) {
+		t.Fatalf("paged diff size mismatch: have %d, want %d", len(paged), len(diff.Accounts))
+	}
+	for i, entry := range paged {
+		if entry.Hash != diff.Accounts[i].Hash || entry.Change != diff.Accounts[i].Change || entry.Storage != nil {
+			t.Fatalf("paged entry %d mismatch: have %x %s, want %x %s", i, entry.Hash, entry.Change, diff.Accounts[i].Hash, diff.Accounts[i].Change)
+		}
+	}
+}
@@ -26,9 +26,17 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var dumper = spew.ConfigState{Indent: "    "}
@@ -201,3 +209,63 @@ func TestStorageRangeAt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the balance history of an account is sampled over the requested
+// range, both with and without the help of the balance index.
+func TestBalanceHistory(t *testing.T) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.Address{0xaa}
+		gspec     = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.MustCommitGenesis(gendb, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 9, func(i int, gen *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(address), recipient, big.NewInt(int64(i+1)), 21000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		gen.AddTx(tx)
+	})
+	for _, tracked := range []bool{false, true} {
+		db := rawdb.NewMemoryDatabase()
+		core.MustCommitGenesis(db, gspec)
+		chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+		if tracked {
+			if err := chain.EnableSupplyTracking(); err != nil {
+				t.Fatalf("failed to enable supply tracking: %v", err)
+			}
+		}
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		api := NewPrivateDebugAPI(&Ethereum{blockchain: chain, chainDb: db})
+
+		samples, err := api.GetBalanceHistory(recipient, 1, rpc.LatestBlockNumber, 3)
+		if err != nil {
+			t.Fatalf("tracked %v: failed to retrieve balance history: %v", tracked, err)
+		}
+		// Block N transfers N wei, the recipient holds N*(N+1)/2 after it
+		var have, want []uint64
+		for _, sample := range samples {
+			have = append(have, uint64(sample.Number), sample.Balance.ToInt().Uint64())
+			if sample.Hash != chain.GetHeaderByNumber(uint64(sample.Number)).Hash() {
+				t.Errorf("tracked %v: sample #%d hash mismatch", tracked, sample.Number)
+			}
+		}
+		for _, n := range []uint64{1, 4, 7} {
+			want = append(want, n, n*(n+1)/2)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("tracked %v: balance history mismatch: have %v, want %v", tracked, have, want)
+		}
+		if _, err := api.GetBalanceHistory(recipient, 5, 4, 1); err == nil {
+			t.Errorf("tracked %v: inverted range accepted", tracked)
+		}
+		if samples, err := api.GetBalanceHistory(recipient, rpc.EarliestBlockNumber, 9, hexutil.Uint64(100)); err != nil || len(samples) != 1 || samples[0].Balance.ToInt().Sign() != 0 {
+			t.Errorf("tracked %v: genesis sample mismatch: have %v, %v", tracked, samples, err)
+		}
+		chain.Stop()
+	}
+}
@@ -57,9 +57,10 @@ const (
 // TraceConfig holds extra parameters to trace functions.
 type TraceConfig struct {
 	*vm.LogConfig
-	Tracer  *string
-	Timeout *string
-	Reexec  *uint64
+	Tracer     *string
+	Timeout    *string
+	Reexec     *uint64
+	Signatures bool // Annotates the call frames of the result with 4byte signatures
 }
 
 // StdTraceConfig holds extra parameters to standard-json trace functions.
@@ -147,7 +148,6 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 
 	// Ensure we have a valid starting state before doing any work
 	origin := start.NumberU64()
-	database := state.NewDatabaseWithCache(api.eth.ChainDb(), 16, "") // Chain tracing will probably start at genesis
 
 	if number := start.NumberU64(); number > 0 {
 		start = api.eth.blockchain.GetBlock(start.ParentHash(), start.NumberU64()-1)
@@ -155,33 +155,16 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 			return nil, fmt.Errorf("parent block #%d not found", number-1)
 		}
 	}
-	statedb, err := state.New(start.Root(), database, nil)
+	// If the starting state is missing, allow some number of blocks to be reexecuted
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, release, err := api.computeStateDB(start, reexec)
 	if err != nil {
-		// If the starting state is missing, allow some number of blocks to be reexecuted
-		reexec := defaultTraceReexec
-		if config != nil && config.Reexec != nil {
-			reexec = *config.Reexec
-		}
-		// Find the most recent block that has the state available
-		for i := uint64(0); i < reexec; i++ {
-			start = api.eth.blockchain.GetBlock(start.ParentHash(), start.NumberU64()-1)
-			if start == nil {
-				break
-			}
-			if statedb, err = state.New(start.Root(), database, nil); err == nil {
-				break
-			}
-		}
-		// If we still don't have the state available, bail out
-		if err != nil {
-			switch err.(type) {
-			case *trie.MissingNodeError:
-				return nil, errors.New("required historical state unavailable")
-			default:
-				return nil, err
-			}
-		}
+		return nil, err
 	}
+	database := statedb.Database()
 	// Execute all the transaction contained within the chain concurrently for each block
 	blocks := int(end.NumberU64() - origin)
 
@@ -242,6 +225,7 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 		defer func() {
 			close(tasks)
 			pend.Wait()
+			release()
 
 			switch {
 			case failed != nil:
@@ -454,10 +438,11 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	// Execute all the transaction contained within the block concurrently
 	var (
 		signer = types.MakeSigner(api.eth.blockchain.Config(), block.Number())
@@ -542,10 +527,11 @@ func (api *PrivateDebugAPI) standardTraceBlockToFile(ctx context.Context, block
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	// Retrieve the tracing configurations, or use default values
 	var (
 		logConfig vm.LogConfig
@@ -632,17 +618,65 @@ func containsTx(block *types.Block, hash common.Hash) bool {
 
 // computeStateDB retrieves the state database associated with a certain block.
 // If no state is locally available for the given block, a number of blocks are
-// attempted to be reexecuted to generate the desired state.
-func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, error) {
+// attempted to be reexecuted to generate the desired state. If that fails and
+// the node regenerates historical states for the tracers, they are regenerated
+// within its block budget instead, and retained for the subsequent traces.
+//
+// The returned release function must be called once the state is no longer
+// used, letting a regenerated state go once the trace is done with it.
+func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, func(), error) {
 	// If we have the state fully available, use that
 	statedb, err := api.eth.blockchain.StateAt(block.Root())
 	if err == nil {
-		return statedb, nil
+		return statedb, func() {}, nil
 	}
 	// Otherwise try to reexec blocks until we find a state or reach our limit
-	origin := block.NumberU64()
 	database := state.NewDatabaseWithCache(api.eth.ChainDb(), 16, "")
+	statedb, err = api.regenerateState(block, reexec, database, nil)
+
+	regen := api.eth.traceStates
+	if _, missing := err.(*missingStateError); !missing || regen == nil {
+		if err != nil {
+			return nil, nil, err
+		}
+		return statedb, func() {}, nil
+	}
+	regen.lock.Lock()
+	defer regen.lock.Unlock()
 
+	if statedb, err = api.regenerateState(block, regen.budget, regen.database, regen.retain); err != nil {
+		return nil, nil, err
+	}
+	// Pin the state until traced, the retained ones may be released meanwhile
+	return statedb, regen.pin(block.Root()), nil
+}
+
+// missingStateError is returned if no state is available within the blocks to
+// reexecute to regenerate a historical state.
+type missingStateError struct {
+	reexec uint64
+}
+
+func (e *missingStateError) Error() string {
+	return fmt.Sprintf("required historical state unavailable (reexec=%d)", e.reexec)
+}
+
+// regenerateState reexecutes up to reexec blocks from the nearest state available
+// in the database to generate the state of the given block. If retain is non-nil,
+// the states of the checkpoint blocks along the way and of the given one are
+// handed over to it to keep them referenced.
+func (api *PrivateDebugAPI) regenerateState(block *types.Block, reexec uint64, database state.Database, retain func(number uint64, root common.Hash)) (*state.StateDB, error) {
+	var (
+		statedb *state.StateDB
+		err     error
+		origin  = block.NumberU64()
+	)
+	// Retained states may hold the one of the block itself
+	if retain != nil {
+		if statedb, err = state.New(block.Root(), database, nil); err == nil {
+			return statedb, nil
+		}
+	}
 	for i := uint64(0); i < reexec; i++ {
 		block = api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 		if block == nil {
@@ -655,7 +689,7 @@ func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*
 	if err != nil {
 		switch err.(type) {
 		case *trie.MissingNodeError:
-			return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+			return nil, &missingStateError{reexec: reexec}
 		default:
 			return nil, err
 		}
@@ -673,8 +707,9 @@ func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*
 			logged = time.Now()
 		}
 		// Retrieve the next block to regenerate and process it
-		if block = api.eth.blockchain.GetBlockByNumber(block.NumberU64() + 1); block == nil {
-			return nil, fmt.Errorf("block #%d not found", block.NumberU64()+1)
+		next := block.NumberU64() + 1
+		if block = api.eth.blockchain.GetBlockByNumber(next); block == nil {
+			return nil, fmt.Errorf("block #%d not found", next)
 		}
 		_, _, _, err := api.eth.blockchain.Processor().Process(block, statedb, vm.Config{})
 		if err != nil {
@@ -693,6 +728,14 @@ func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*
 			database.TrieDB().Dereference(proot)
 		}
 		proot = root
+
+		if retain != nil && (block.NumberU64()%traceStatesCheckpoint == 0 || block.NumberU64() == origin) {
+			retain(block.NumberU64(), root)
+		}
+	}
+	// Leave the regenerated state referenced by the retained ones only
+	if retain != nil && proot != (common.Hash{}) {
+		database.TrieDB().Dereference(proot)
 	}
 	nodes, imgs := database.TrieDB().Size()
 	log.Info("Historical state regenerated", "block", block.NumberU64(), "elapsed", time.Since(start), "nodes", nodes, "preimages", imgs)
@@ -711,10 +754,11 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	msg, vmctx, statedb, err := api.computeTxEnv(blockHash, int(index), reexec)
+	msg, vmctx, statedb, release, err := api.computeTxEnv(blockHash, int(index), reexec)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	// Trace the transaction and return
 	return api.traceTx(ctx, msg, vmctx, statedb, config)
 }
@@ -760,7 +804,11 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 
 	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
 	if err != nil {
-		return nil, fmt.Errorf("tracing failed: %v", err)
+		err = fmt.Errorf("tracing failed: %w", err)
+		if api.eth.config.RPCErrorCodes {
+			err = ethapi.CanonicalError(err)
+		}
+		return nil, err
 	}
 	// Depending on the tracer type, format and return the output
 	switch tracer := tracer.(type) {
@@ -778,7 +826,11 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 		}, nil
 
 	case *tracers.Tracer:
-		return tracer.GetResult()
+		res, err := tracer.GetResult()
+		if err != nil || !config.Signatures || api.eth.signatures == nil {
+			return res, err
+		}
+		return api.eth.signatures.annotateCallFrames(res), nil
 
 	default:
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
@@ -786,23 +838,25 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 }
 
 // computeTxEnv returns the execution environment of a certain transaction.
-func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
+//
+// The returned release function must be called once the state is no longer used.
+func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, func(), error) {
 	// Create the parent state database
 	block := api.eth.blockchain.GetBlockByHash(blockHash)
 	if block == nil {
-		return nil, vm.Context{}, nil, fmt.Errorf("block %#x not found", blockHash)
+		return nil, vm.Context{}, nil, nil, fmt.Errorf("block %#x not found", blockHash)
 	}
 	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 	if parent == nil {
-		return nil, vm.Context{}, nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+		return nil, vm.Context{}, nil, nil, fmt.Errorf("parent %#x not found", block.ParentHash())
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, release, err := api.computeStateDB(parent, reexec)
 	if err != nil {
-		return nil, vm.Context{}, nil, err
+		return nil, vm.Context{}, nil, nil, err
 	}
 
 	if txIndex == 0 && len(block.Transactions()) == 0 {
-		return nil, vm.Context{}, statedb, nil
+		return nil, vm.Context{}, statedb, release, nil
 	}
 
 	// Recompute transactions up to the target index.
@@ -813,16 +867,18 @@ func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, ree
 		msg, _ := tx.AsMessage(signer)
 		context := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 		if idx == txIndex {
-			return msg, context, statedb, nil
+			return msg, context, statedb, release, nil
 		}
 		// Not yet the searched for transaction, execute on top of the current state
 		vmenv := vm.NewEVM(context, statedb, api.eth.blockchain.Config(), vm.Config{})
 		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
-			return nil, vm.Context{}, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+			release()
+			return nil, vm.Context{}, nil, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
 		}
 		// Ensure any modifications are committed to the state
 		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
 		statedb.Finalise(vmenv.ChainConfig().IsEnabled(vmenv.ChainConfig().GetEIP161dTransition, block.Number()))
 	}
-	return nil, vm.Context{}, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, blockHash)
+	release()
+	return nil, vm.Context{}, nil, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, blockHash)
 }
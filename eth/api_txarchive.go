@@ -0,0 +1,93 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// ArchivedTransaction is a transaction that left the pool without being
+// included, along with the reason it was dropped.
+type ArchivedTransaction struct {
+	Hash       common.Hash     `json:"hash"`
+	From       common.Address  `json:"from"`
+	To         *common.Address `json:"to"`
+	Nonce      hexutil.Uint64  `json:"nonce"`
+	GasPrice   *hexutil.Big    `json:"gasPrice"`
+	Gas        hexutil.Uint64  `json:"gas"`
+	Value      *hexutil.Big    `json:"value"`
+	Input      hexutil.Bytes   `json:"input"`
+	Reason     string          `json:"reason"`
+	ReplacedBy *common.Hash    `json:"replacedBy,omitempty"`
+	Time       hexutil.Uint64  `json:"time"`
+}
+
+func newArchivedTransaction(entry *core.ArchivedTx) *ArchivedTransaction {
+	tx := entry.Tx
+	archived := &ArchivedTransaction{
+		Hash:     tx.Hash(),
+		From:     entry.From,
+		To:       tx.To(),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		Value:    (*hexutil.Big)(tx.Value()),
+		Input:    tx.Data(),
+		Reason:   entry.Reason,
+		Time:     hexutil.Uint64(entry.Time),
+	}
+	if entry.ReplacedBy != (common.Hash{}) {
+		archived.ReplacedBy = &entry.ReplacedBy
+	}
+	return archived
+}
+
+// PublicTxArchiveAPI offers the transactions that left the pool without being
+// included, if the archive is enabled.
+type PublicTxArchiveAPI struct {
+	eth *Ethereum
+}
+
+// NewPublicTxArchiveAPI creates a new transaction archive API.
+func NewPublicTxArchiveAPI(eth *Ethereum) *PublicTxArchiveAPI {
+	return &PublicTxArchiveAPI{eth: eth}
+}
+
+// GetArchivedTransaction returns a transaction dropped from the pool along with
+// the reason it was dropped.
+func (api *PublicTxArchiveAPI) GetArchivedTransaction(hash common.Hash) (*ArchivedTransaction, error) {
+	entry := api.eth.txPool.ArchivedTx(hash)
+	if entry == nil {
+		return nil, fmt.Errorf("transaction %#x not archived", hash)
+	}
+	return newArchivedTransaction(entry), nil
+}
+
+// GetArchivedTransactions returns the transactions of a sender dropped from the
+// pool, oldest first.
+func (api *PublicTxArchiveAPI) GetArchivedTransactions(from common.Address) []*ArchivedTransaction {
+	entries := api.eth.txPool.ArchivedTxsFrom(from)
+	txs := make([]*ArchivedTransaction, len(entries))
+	for i, entry := range entries {
+		txs[i] = newArchivedTransaction(entry)
+	}
+	return txs
+}
@@ -26,6 +26,7 @@ import (
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -34,11 +35,17 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/alerts"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/eth/forkmon"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/headwatch"
+	"github.com/ethereum/go-ethereum/eth/txmgr"
+	"github.com/ethereum/go-ethereum/eth/wit"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -66,6 +73,17 @@ type Ethereum struct {
 	txPool          *core.TxPool
 	blockchain      *core.BlockChain
 	protocolManager *ProtocolManager
+	txManager       *txmgr.Manager
+	headWatch       *headwatch.Watcher
+	forkMonitor     *forkmon.Monitor
+	traceStates     *traceStates // Regenerates the historical states beyond the tracers' reexecution limit, if enabled
+	alerts          *alerts.Notifier
+	stack           *node.Node
+	maintenance     maintenance
+	abis            *abiStore    // Contract ABIs registered for decoding logs and inputs
+	signatures      *signatureDB // 4byte signatures for decoding calls without an ABI
+	witness         *wit.Handler
+	devSealer       *miner.DevSealer
 	dialCandidates  enode.Iterator
 
 	// DB interfaces
@@ -78,6 +96,7 @@ type Ethereum struct {
 	bloomRequests     chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer      *core.ChainIndexer             // Bloom indexer operating during block imports
 	closeBloomHandler chan struct{}
+	uncleIndexer      *core.ChainIndexer // Uncle indexer operating during block imports, nil if disabled
 
 	APIBackend *EthAPIBackend
 
@@ -123,15 +142,72 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024)
 
 	// Assemble the Ethereum object
+	freezerOptions := &rawdb.FreezerOptions{
+		Threshold:   config.AncientThreshold,
+		Aggressive:  config.AncientAggressive,
+		Compression: config.AncientCompression,
+		FileSizes:   config.AncientFileSizes,
+		SyncItems:   config.AncientSyncItems,
+	}
+	// Secondary instances follow the chain database of another node read-only,
+	// leaving its maintenance to the primary one
+	secondary := stack.Config().PrimaryDataDir != ""
+
+	// Make sure a remote ancient store shared between chains holds this one's
+	if config.DatabaseFreezerRemote != "" && !secondary {
+		freezerOptions.Genesis, freezerOptions.NetworkID = params.MainnetGenesisHash, config.NetworkId
+		if config.Genesis != nil {
+			freezerOptions.Genesis = core.GenesisToBlock(config.Genesis, nil).Hash()
+		}
+	}
 	if config.DatabaseFreezerRemote != "" {
-		chainDb, err = stack.OpenDatabaseWithFreezerRemote("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezerRemote)
+		chainDb, err = stack.OpenDatabaseWithFreezerRemote("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezerRemote, freezerOptions)
 	} else {
-		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "eth/db/chaindata/")
+		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "eth/db/chaindata/", freezerOptions)
 	}
 	if err != nil {
 		return nil, err
 	}
-	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
+	if tiering, ok := chainDb.(rawdb.AncientTiering); ok && config.DatabaseFreezerRemote != "" && !secondary {
+		policy := config.AncientTiering
+		if config.AncientTieringFile != "" {
+			if policy, err = rawdb.LoadTieringPolicy(config.AncientTieringFile); err != nil {
+				return nil, fmt.Errorf("failed to load ancient tiering policy: %v", err)
+			}
+		}
+		tiering.SetTieringPolicy(policy, config.AncientTieringFile)
+	}
+	var notifier *alerts.Notifier
+	if len(config.Alerts.Webhooks) > 0 {
+		if notifier, err = alerts.New(config.Alerts); err != nil {
+			return nil, err
+		}
+	}
+	var integrityRepair *uint64
+	if config.IntegrityCheck > 0 && secondary {
+		log.Warn("Skipping chain integrity check of secondary database")
+	} else if config.IntegrityCheck > 0 {
+		if integrityRepair, err = checkChainIntegrity(chainDb, config.IntegrityCheck, config.IntegrityRepair); err != nil {
+			if notifier != nil {
+				notifier.Notify(alerts.DatabaseCorruption, "Chain integrity check failed", map[string]interface{}{"error": err.Error()})
+				notifier.Stop()
+			}
+			return nil, err
+		}
+		if integrityRepair != nil && notifier != nil {
+			notifier.Notify(alerts.DatabaseCorruption, "Chain integrity check failed, chain rewound", map[string]interface{}{"rewind": *integrityRepair})
+		}
+	}
+	var (
+		chainConfig ctypes.ChainConfigurator
+		genesisHash common.Hash
+		genesisErr  error
+	)
+	if secondary {
+		chainConfig, genesisHash, genesisErr = setupSecondaryGenesis(chainDb, config.Genesis)
+	} else {
+		chainConfig, genesisHash, genesisErr = core.SetupGenesisBlock(chainDb, config.Genesis)
+	}
 	if _, ok := genesisErr.(*confp.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
 	}
@@ -150,6 +226,8 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		bloomRequests:     make(chan chan *bloombits.Retrieval),
 		bloomIndexer:      NewBloomIndexer(chainDb, vars.BloomBitsBlocks, vars.BloomConfirms),
 		p2pServer:         stack.Server(),
+		alerts:            notifier,
+		stack:             stack,
 	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb)
@@ -159,7 +237,11 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	}
 	log.Info("Initialising Ethereum protocol", "versions", ProtocolVersions, "network", config.NetworkId, "dbversion", dbVer)
 
-	if !config.SkipBcVersionCheck {
+	if secondary {
+		if err := checkSecondaryVersion(chainDb); err != nil {
+			return nil, err
+		}
+	} else if !config.SkipBcVersionCheck {
 		if bcVersion != nil && *bcVersion > core.BlockChainVersion {
 			return nil, fmt.Errorf("database version is v%d, Geth %s only supports v%d", *bcVersion, params.VersionWithMeta, core.BlockChainVersion)
 		} else if bcVersion == nil || *bcVersion < core.BlockChainVersion {
@@ -167,6 +249,14 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			rawdb.WriteDatabaseVersion(chainDb, core.BlockChainVersion)
 		}
 	}
+	// Migrate the key schema of existing databases, new ones start at the latest
+	if !secondary {
+		if bcVersion == nil && rawdb.ReadSchemaVersion(chainDb) == 0 {
+			rawdb.WriteSchemaVersion(chainDb, rawdb.LatestSchemaVersion(rawdb.SchemaMigrations))
+		} else if _, err := rawdb.RunMigrations(chainDb, rawdb.SchemaMigrations, rawdb.LatestSchemaVersion(rawdb.SchemaMigrations), false); err != nil {
+			return nil, fmt.Errorf("database schema migration failed: %v", err)
+		}
+	}
 	var (
 		vmConfig = vm.Config{
 			EnablePreimageRecording: config.EnablePreimageRecording,
@@ -181,24 +271,82 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			TrieDirtyLimit:      config.TrieDirtyCache,
 			TrieDirtyDisabled:   config.NoPruning,
 			TrieTimeLimit:       config.TrieTimeout,
+			TrieBlockLimit:      config.TrieFlushBlocks,
+			TrieFlushTimeout:    config.TrieFlushTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 		}
 	)
+	if secondary {
+		cacheConfig.SecondaryCatchup = stack.Config().SecondaryCatchup
+		if cacheConfig.SecondaryCatchup == 0 {
+			cacheConfig.SecondaryCatchup = rawdb.DefaultSecondaryCatchup
+		}
+	}
+	// Retain the blocks a reorg may still need to rewind to
+	if config.HistoryRetain > 0 && config.HistoryRetain < vars.FullImmutabilityThreshold {
+		log.Warn("History retention below the immutability threshold", "provided", config.HistoryRetain, "updated", vars.FullImmutabilityThreshold)
+		config.HistoryRetain = vars.FullImmutabilityThreshold
+	}
+	// Transactions can't be looked up in pruned blocks
+	if config.HistoryRetain > 0 && (config.TxLookupLimit == 0 || config.TxLookupLimit > config.HistoryRetain) {
+		log.Info("Limiting transaction index to retained history", "blocks", config.HistoryRetain)
+		config.TxLookupLimit = config.HistoryRetain
+	}
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
 	if err != nil {
 		return nil, err
 	}
+	if !secondary {
+		eth.blockchain.EnableHistoryPruning(config.HistoryRetain)
+	}
+	if config.VerifyReceipts {
+		eth.blockchain.EnableReceiptVerification()
+	}
+	if config.CacheWarmup {
+		eth.blockchain.EnableCacheWarmup()
+	}
+	if config.EnableOpcodeStats {
+		eth.blockchain.EnableOpcodeStats()
+	}
+	if config.ContractIndex && !secondary {
+		eth.blockchain.EnableContractIndex()
+	}
+	if config.TokenIndex && !secondary {
+		eth.blockchain.EnableTokenIndex()
+	}
+	if config.TrackSupply && !secondary {
+		if err := eth.blockchain.EnableSupplyTracking(); err != nil {
+			return nil, err
+		}
+	}
+	// Clean up any data beyond the repaired head after a failed integrity check.
+	if integrityRepair != nil {
+		log.Warn("Rewinding chain to repair integrity", "number", *integrityRepair)
+		if err := eth.blockchain.SetHead(*integrityRepair); err != nil {
+			return nil, err
+		}
+	}
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*confp.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
 		eth.blockchain.SetHead(compat.RewindTo)
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
-	eth.bloomIndexer.Start(eth.blockchain)
+	// The indexes of a secondary database are the ones built by the primary
+	if !secondary {
+		eth.bloomIndexer.Start(eth.blockchain)
+	}
+	if config.UncleIndex && !secondary {
+		eth.uncleIndexer = NewUncleIndexer(chainDb, uncleIndexSectionSize, vars.BloomConfirms)
+		eth.uncleIndexer.Start(eth.blockchain)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.ArchiveFile != "" {
+		config.TxPool.ArchiveFile = stack.ResolvePath(config.TxPool.ArchiveFile)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
 
 	// Permit the downloader to use the trie cache allowance during fast sync
@@ -214,10 +362,63 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if eth.protocolManager, err = NewProtocolManager(chainConfig, checkpoint, config.SyncMode, config.NetworkId, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb, cacheLimit, config.Whitelist); err != nil {
 		return nil, err
 	}
+	if ranger, ok := chainDb.(rawdb.AncientRanger); ok && config.DatabaseFreezerRemote != "" {
+		eth.protocolManager.ancients = newAncientServer(chainDb, ranger, config.AncientServeLimit)
+	}
+	if setter, ok := chainDb.(rawdb.AncientFallbackSetter); ok && config.DatabaseFreezerRemote != "" && config.AncientFallback {
+		eth.protocolManager.ancientFetcher = newAncientFetcher(eth.protocolManager.peers)
+		eth.protocolManager.servingDb = rawdb.NoAncientFallback(chainDb)
+		setter.SetAncientFallback(eth.protocolManager.ancientFetcher, config.AncientFallbackTimeout)
+	}
+	eth.protocolManager.recordDir, eth.protocolManager.recordPayloads = config.P2PRecordDir, config.P2PRecordPayloads
+	eth.protocolManager.propagation = config.BlockPropagation
+	eth.protocolManager.stateBudget.set(config.StateServeLimit, nil)
+	if config.TxManager.Enabled {
+		eth.txManager = txmgr.New(config.TxManager, eth, func(txs types.Transactions) {
+			eth.protocolManager.BroadcastTransactions(txs, true)
+			eth.protocolManager.BroadcastTransactions(txs, false)
+		})
+	}
+	if config.Witness.Enabled {
+		eth.witness = wit.NewHandler(config.Witness, eth.blockchain)
+	}
+	if len(config.HeadWatch.Endpoints) > 0 {
+		eth.headWatch = headwatch.New(config.HeadWatch, eth)
+		stack.RegisterHandler("Head watcher", "/health", node.NewHTTPHandlerStack(eth.headWatch, nil, stack.Config().HTTPVirtualHosts))
+	}
+	if config.ForkMonitor.Enabled {
+		eth.forkMonitor = forkmon.New(config.ForkMonitor, eth)
+	}
+	if config.TraceRegenerate > 0 {
+		eth.traceStates = newTraceStates(chainDb, config.TraceRegenerate)
+	}
+	stack.SetRPCHeadFunc(func() uint64 { return eth.blockchain.CurrentBlock().NumberU64() })
+	stack.SetRPCNumberFunc(func(hash common.Hash) (uint64, bool) {
+		if header := eth.blockchain.GetHeaderByHash(hash); header != nil {
+			return header.Number.Uint64(), true
+		}
+		return 0, false
+	})
+	if eth.abis, err = newABIStore(stack.ResolvePath("abis")); err != nil {
+		return nil, err
+	}
+	eth.signatures = &signatureDB{path: stack.ResolvePath("4byte.json")}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
+	if config.Miner.ClockGuard {
+		if len(stack.Config().P2P.NTPServers) == 0 {
+			log.Warn("Miner clock guard enabled without NTP servers to measure the clock drift against")
+		}
+		eth.miner.SetSealGuard(stack.Server().CheckClock)
+	}
+	if config.DeveloperPoW {
+		eth.devSealer = miner.NewDevSealer(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, config.DeveloperPeriod)
+	}
 
-	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), eth, nil}
+	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), eth, nil, nil}
+	if config.SnapshotAudit > 0 {
+		eth.APIBackend.snapAudit = state.NewSnapshotAudit(config.SnapshotAudit)
+	}
 	gpoParams := config.GPO
 	if gpoParams.Default == nil {
 		gpoParams.Default = config.Miner.GasPrice
@@ -234,7 +435,9 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 
 	// Register the backend on the node
 	stack.RegisterAPIs(eth.APIs())
-	stack.RegisterProtocols(eth.Protocols())
+	if !secondary {
+		stack.RegisterProtocols(eth.Protocols())
+	}
 	stack.RegisterLifecycle(eth)
 	return eth, nil
 }
@@ -270,6 +473,9 @@ func CreateConsensusEngine(stack *node.Node, chainConfig ctypes.ChainConfigurato
 	case ethash.ModeFake:
 		log.Warn("Ethash used in fake mode")
 		return ethash.NewFaker()
+	case ethash.ModeFullFake:
+		log.Warn("Ethash used in full fake mode")
+		return ethash.NewFullFaker()
 	case ethash.ModeTest:
 		log.Warn("Ethash used in test mode")
 		return ethash.NewTester(nil, noverify)
@@ -292,6 +498,26 @@ func CreateConsensusEngine(stack *node.Node, chainConfig ctypes.ChainConfigurato
 	}
 }
 
+// checkChainIntegrity runs the startup integrity check over the chain database.
+// If the check fails and repair is requested, the head markers are rewound to
+// the last consistent block, whose number is returned so the blockchain can be
+// rewound there once loaded. Otherwise the failure is returned as is.
+func checkChainIntegrity(db ethdb.Database, depth uint64, repair bool) (*uint64, error) {
+	err := rawdb.CheckChainIntegrity(db, depth)
+	if err == nil {
+		return nil, nil
+	}
+	ierr, ok := err.(*rawdb.IntegrityError)
+	if !ok || !repair {
+		return nil, err
+	}
+	log.Error("Chain integrity check failed, repairing", "reason", ierr.Reason, "rewind", ierr.Repair)
+	if err := rawdb.RewindChainHeads(db, ierr.Repair); err != nil {
+		return nil, fmt.Errorf("integrity repair failed: %v", err)
+	}
+	return &ierr.Repair, nil
+}
+
 // APIs return the collection of RPC services the ethereum package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *Ethereum) APIs() []rpc.API {
@@ -300,6 +526,51 @@ func (s *Ethereum) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append the local transaction manager APIs if enabled
+	if s.txManager != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "txmgr",
+			Version:   "1.0",
+			Service:   txmgr.NewPublicTxManagerAPI(s.txManager),
+			Public:    true,
+		})
+	}
+	// Append the token APIs if the token index is maintained
+	if s.config.TokenIndex {
+		apis = append(apis, rpc.API{
+			Namespace: "token",
+			Version:   "1.0",
+			Service:   NewPublicTokenAPI(s),
+			Public:    true,
+		})
+	}
+	// Append the API inspecting the transactions dropped from the pool
+	apis = append(apis, rpc.API{
+		Namespace: "txpool",
+		Version:   "1.0",
+		Service:   NewPublicTxArchiveAPI(s),
+		Public:    true,
+	})
+	// Append the APIs decoding with the registered contract ABIs
+	apis = append(apis, rpc.API{
+		Namespace: "abi",
+		Version:   "1.0",
+		Service:   NewPublicABIAPI(s),
+		Public:    true,
+	}, rpc.API{
+		Namespace: "abi",
+		Version:   "1.0",
+		Service:   NewPrivateABIAPI(s),
+	})
+	// Append the developer chain test APIs if sealing with the developer sealer
+	if s.devSealer != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "evm",
+			Version:   "1.0",
+			Service:   miner.NewPublicDevAPI(s.devSealer),
+			Public:    true,
+		})
+	}
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -307,6 +578,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicEthereumAPI(s),
 			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicUncleAPI(s),
+			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -325,7 +601,12 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.APIBackend, false),
+			Service:   filters.NewPublicFilterAPIWithConfig(s.APIBackend, false, s.config.Filters),
+			Public:    true,
+		}, {
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   filters.NewPublicDebugFilterAPI(s.APIBackend),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -437,6 +718,9 @@ func (s *Ethereum) SetEtherbase(etherbase common.Address) {
 	s.lock.Unlock()
 
 	s.miner.SetEtherbase(etherbase)
+	if s.devSealer != nil {
+		s.devSealer.SetEtherbase(etherbase)
+	}
 }
 
 // StartMining starts the miner with the given number of CPU threads. If mining
@@ -474,12 +758,22 @@ func (s *Ethereum) StartMining(threads int) error {
 				log.Error("Etherbase account unavailable locally", "err", err)
 				return fmt.Errorf("signer missing: %v", err)
 			}
+			// Ledger and Trezor only sign transactions and prefixed messages,
+			// never the raw seal hashes of clique blocks
+			if scheme := wallet.URL().Scheme; scheme == usbwallet.LedgerScheme || scheme == usbwallet.TrezorScheme {
+				log.Error("Etherbase account held by a hardware wallet", "url", wallet.URL())
+				return fmt.Errorf("signer %x held by a %s wallet, which can't sign clique blocks", eb, scheme)
+			}
 			clique.Authorize(eb, wallet.SignData)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.protocolManager.acceptTxs, 1)
 
+		if s.devSealer != nil {
+			s.devSealer.Start(eb)
+			return nil
+		}
 		go s.miner.Start(eb)
 	}
 	return nil
@@ -496,10 +790,18 @@ func (s *Ethereum) StopMining() {
 		th.SetThreads(-1)
 	}
 	// Stop the block creating itself
+	if s.devSealer != nil {
+		s.devSealer.Stop()
+	}
 	s.miner.Stop()
 }
 
-func (s *Ethereum) IsMining() bool      { return s.miner.Mining() }
+func (s *Ethereum) IsMining() bool {
+	if s.devSealer != nil {
+		return s.devSealer.Mining()
+	}
+	return s.miner.Mining()
+}
 func (s *Ethereum) Miner() *miner.Miner { return s.miner }
 
 func (s *Ethereum) AccountManager() *accounts.Manager  { return s.accountManager }
@@ -511,11 +813,26 @@ func (s *Ethereum) ChainDb() ethdb.Database            { return s.chainDb }
 func (s *Ethereum) IsListening() bool                  { return true } // Always listening
 func (s *Ethereum) EthVersion() int                    { return int(ProtocolVersions[0]) }
 func (s *Ethereum) NetVersion() uint64                 { return s.networkID }
+func (s *Ethereum) PeerCount() int                     { return s.p2pServer.PeerCount() }
 func (s *Ethereum) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
 func (s *Ethereum) Synced() bool                       { return atomic.LoadUint32(&s.protocolManager.acceptTxs) == 1 }
 func (s *Ethereum) ArchiveMode() bool                  { return s.config.NoPruning }
 func (s *Ethereum) BloomIndexer() *core.ChainIndexer   { return s.bloomIndexer }
 
+// PeerHeads returns the heads advertised by the connected eth peers.
+func (s *Ethereum) PeerHeads() []forkmon.PeerHead {
+	peers := s.protocolManager.peers
+	peers.lock.RLock()
+	defer peers.lock.RUnlock()
+
+	heads := make([]forkmon.PeerHead, 0, len(peers.peers))
+	for id, p := range peers.peers {
+		hash, td := p.Head()
+		heads = append(heads, forkmon.PeerHead{ID: id, Hash: hash, TD: td})
+	}
+	return heads
+}
+
 // Protocols returns all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
@@ -525,6 +842,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 		protos[i].Attributes = []enr.Entry{s.currentEthEntry()}
 		protos[i].DialCandidates = s.dialCandidates
 	}
+	if s.witness != nil {
+		protos = append(protos, s.witness.Protocols()...)
+	}
 	return protos
 }
 
@@ -546,6 +866,21 @@ func (s *Ethereum) Start() error {
 	}
 	// Start the networking layer and the light server if requested
 	s.protocolManager.Start(maxPeers)
+	if s.txManager != nil {
+		s.txManager.Start()
+	}
+	if s.headWatch != nil {
+		s.headWatch.Start()
+	}
+	if s.forkMonitor != nil {
+		s.forkMonitor.Start()
+	}
+	if s.witness != nil {
+		s.witness.Start()
+	}
+	if s.alerts != nil {
+		s.alerts.Start(s)
+	}
 	return nil
 }
 
@@ -556,9 +891,30 @@ func (s *Ethereum) Stop() error {
 	s.protocolManager.Stop()
 
 	// Then stop everything else.
+	if s.headWatch != nil {
+		s.headWatch.Stop()
+	}
+	if s.forkMonitor != nil {
+		s.forkMonitor.Stop()
+	}
+	if s.witness != nil {
+		s.witness.Stop()
+	}
+	if s.alerts != nil {
+		s.alerts.Stop()
+	}
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
+	if s.uncleIndexer != nil {
+		s.uncleIndexer.Close()
+	}
+	if s.txManager != nil {
+		s.txManager.Stop()
+	}
 	s.txPool.Stop()
+	if s.devSealer != nil {
+		s.devSealer.Stop()
+	}
 	s.miner.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
@@ -18,6 +18,9 @@ package eth
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -141,3 +144,114 @@ func (b *BloomIndexer) Commit() error {
 func (b *BloomIndexer) Prune(threshold uint64) error {
 	return nil
 }
+
+// RebuildBloomBits regenerates the bloombits index of the canonical chain from
+// scratch, recomputing the blooms of each block from its stored receipts. The
+// complete sections are generated by the given number of parallel workers, with
+// progress reported after each one. It returns the number of indexed sections.
+func RebuildBloomBits(db ethdb.Database, size, confirms uint64, workers int, progress func(done, total uint64)) (uint64, error) {
+	hash := rawdb.ReadHeadHeaderHash(db)
+	number := rawdb.ReadHeaderNumber(db, hash)
+	if number == nil {
+		return 0, fmt.Errorf("head header %x not found", hash)
+	}
+	var sections uint64
+	if *number+1 >= confirms {
+		sections = (*number + 1 - confirms) / size
+	}
+	// Invalidate the whole index before touching it, so an interrupted rebuild
+	// gets picked up by the regular indexer instead of serving partial data
+	table := rawdb.NewTable(db, string(rawdb.BloomBitsIndexPrefix))
+	core.WriteChainIndexSections(table, nil)
+	for i := 0; i < types.BloomBitLength; i++ {
+		rawdb.DeleteBloombits(db, uint(i), 0, ^uint64(0))
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		heads = make([]common.Hash, sections)
+		tasks = make(chan uint64)
+		errs  = make(chan error, workers)
+		done  uint64
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for section := range tasks {
+				head, err := rebuildBloomSection(db, size, section)
+				if err != nil {
+					errs <- err
+					return
+				}
+				heads[section] = head
+				if progress != nil {
+					progress(atomic.AddUint64(&done, 1), sections)
+				}
+			}
+		}()
+	}
+	var err error
+feed:
+	for section := uint64(0); section < sections; section++ {
+		select {
+		case tasks <- section:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	core.WriteChainIndexSections(table, heads)
+	return sections, nil
+}
+
+// rebuildBloomSection generates and stores the bloom bits of a single section of
+// the canonical chain from the receipts of its blocks, returning the hash of the
+// last block in it.
+func rebuildBloomSection(db ethdb.Database, size, section uint64) (common.Hash, error) {
+	gen, err := bloombits.NewGenerator(uint(size))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var head common.Hash
+	for number := section * size; number < (section+1)*size; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return common.Hash{}, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		header := rawdb.ReadHeader(db, hash, number)
+		if header == nil {
+			return common.Hash{}, fmt.Errorf("header #%d [%x] not found", number, hash)
+		}
+		receipts := rawdb.ReadRawReceipts(db, hash, number)
+		if receipts == nil && header.ReceiptHash != types.EmptyRootHash {
+			return common.Hash{}, fmt.Errorf("receipts of block #%d [%x] not found", number, hash)
+		}
+		if err := gen.AddBloom(uint(number-section*size), types.CreateBloom(receipts)); err != nil {
+			return common.Hash{}, err
+		}
+		head = hash
+	}
+	batch := db.NewBatch()
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, err := gen.Bitset(uint(i))
+		if err != nil {
+			return common.Hash{}, err
+		}
+		rawdb.WriteBloomBits(batch, uint(i), section, head, bitutil.CompressBytes(bits))
+	}
+	return head, batch.Write()
+}
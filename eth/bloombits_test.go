@@ -0,0 +1,105 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the bloombits index is regenerated from the receipts of the chain,
+// matching what the regular indexer produces and dropping stale sections.
+func TestRebuildBloomBits(t *testing.T) {
+	const size, blocks = 8, 20
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		want    = rawdb.NewMemoryDatabase()
+		indexer = &BloomIndexer{db: want, size: size}
+		headers []*types.Header
+	)
+	for i := uint64(0); i < blocks; i++ {
+		receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{{
+			Address: common.BigToAddress(new(big.Int).SetUint64(i % 3)),
+			Topics:  []common.Hash{common.BigToHash(new(big.Int).SetUint64(i))},
+		}}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+		header := &types.Header{Number: new(big.Int).SetUint64(i), Bloom: receipt.Bloom, Extra: []byte("test")}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), i)
+		rawdb.WriteReceipts(db, header.Hash(), i, types.Receipts{receipt})
+		headers = append(headers, header)
+	}
+	rawdb.WriteHeadHeaderHash(db, headers[blocks-1].Hash())
+
+	// Leave a stale index with more sections than the chain has
+	table := rawdb.NewTable(db, string(rawdb.BloomBitsIndexPrefix))
+	core.WriteChainIndexSections(table, []common.Hash{{0x1}, {0x2}, {0x3}})
+	rawdb.WriteBloomBits(db, 0, 0, common.Hash{0x1}, []byte{0xff})
+
+	var calls uint64
+	sections, err := RebuildBloomBits(db, size, 0, 3, func(done, total uint64) {
+		atomic.AddUint64(&calls, 1)
+		if total != blocks/size {
+			t.Errorf("total sections mismatch: have %d, want %d", total, blocks/size)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to rebuild index: %v", err)
+	}
+	if sections != blocks/size || calls != sections {
+		t.Fatalf("sections mismatch: have %d (%d reported), want %d", sections, calls, blocks/size)
+	}
+	if data, _ := table.Get([]byte("count")); !bytes.Equal(data, []byte{0, 0, 0, 0, 0, 0, 0, 2}) {
+		t.Fatalf("stored section count mismatch: %x", data)
+	}
+	if has, _ := table.Has(append([]byte("shead"), 0, 0, 0, 0, 0, 0, 0, 2)); has {
+		t.Fatalf("stale section head not removed")
+	}
+	if _, err := rawdb.ReadBloomBits(db, 0, 0, common.Hash{0x1}); err == nil {
+		t.Fatalf("stale bloom bits not removed")
+	}
+	for section := uint64(0); section < sections; section++ {
+		indexer.Reset(context.Background(), section, common.Hash{})
+		for _, header := range headers[section*size : (section+1)*size] {
+			indexer.Process(context.Background(), header)
+		}
+		if err := indexer.Commit(); err != nil {
+			t.Fatalf("failed to index section %d: %v", section, err)
+		}
+		head := headers[(section+1)*size-1].Hash()
+		if stored, _ := table.Get(append([]byte("shead"), 0, 0, 0, 0, 0, 0, 0, byte(section))); !bytes.Equal(stored, head.Bytes()) {
+			t.Errorf("section %d: head mismatch: have %x, want %x", section, stored, head)
+		}
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			have, _ := rawdb.ReadBloomBits(db, bit, section, head)
+			exp, _ := rawdb.ReadBloomBits(want, bit, section, head)
+			if !bytes.Equal(have, exp) {
+				t.Fatalf("section %d, bit %d: bloom bits mismatch: have %x, want %x", section, bit, have, exp)
+			}
+		}
+	}
+}
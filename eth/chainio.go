@@ -0,0 +1,306 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// chainIOReportInterval is the minimum time between two progress notifications
+// of a chain import or export.
+const chainIOReportInterval = time.Second
+
+var (
+	errChainIOBusy    = errors.New("another chain import or export is running")
+	errChainIOAborted = errors.New("aborted by unsubscribing")
+)
+
+// ChainIOProgress is the progress of a chain import or export, notified to the
+// subscribers of the operation.
+type ChainIOProgress struct {
+	File     string         `json:"file"`
+	First    hexutil.Uint64 `json:"first,omitempty"`    // First block to export
+	Last     hexutil.Uint64 `json:"last,omitempty"`     // Last block to export
+	Blocks   hexutil.Uint64 `json:"blocks"`             // Number of blocks read from or written into the file
+	Imported hexutil.Uint64 `json:"imported,omitempty"` // Number of blocks of the batches inserted, skipping known batches
+	Number   hexutil.Uint64 `json:"number"`             // Number of the last block processed
+	Elapsed  string         `json:"elapsed"`
+	Done     bool           `json:"done"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// chainIOTracker tracks the progress of a chain import or export, notifying it
+// periodically to the subscriber, if any.
+type chainIOTracker struct {
+	progress ChainIOProgress
+	notify   func(*ChainIOProgress) // Nil for synchronous operations
+	quit     <-chan struct{}        // Closed if the subscriber went away
+	start    time.Time
+	reported time.Time
+}
+
+// aborted reports whether the subscriber of the operation went away.
+func (t *chainIOTracker) aborted() bool {
+	select {
+	case <-t.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// report notifies the progress to the subscriber if enough time passed since
+// the previous notification, or regardless if forced.
+func (t *chainIOTracker) report(force bool) {
+	if t.notify == nil || (!force && time.Since(t.reported) < chainIOReportInterval) {
+		return
+	}
+	t.progress.Elapsed = time.Since(t.start).String()
+	t.notify(&t.progress)
+	t.reported = time.Now()
+}
+
+func (api *PrivateAdminAPI) acquireChainIO() bool {
+	return atomic.CompareAndSwapInt32(&api.ioBusy, 0, 1)
+}
+
+func (api *PrivateAdminAPI) releaseChainIO() {
+	atomic.StoreInt32(&api.ioBusy, 0)
+}
+
+// exportRange resolves the range of blocks to export, the whole chain if first
+// and last are nil, or up to the head if only last is.
+func (api *PrivateAdminAPI) exportRange(first *uint64, last *uint64) (uint64, uint64, error) {
+	if first == nil && last != nil {
+		return 0, 0, errors.New("last cannot be specified without first")
+	}
+	head := api.eth.BlockChain().CurrentBlock().NumberU64()
+	begin, end := uint64(0), head
+	if first != nil {
+		begin = *first
+	}
+	if last != nil {
+		end = *last
+	}
+	if begin > end {
+		return 0, 0, fmt.Errorf("export failed: first (%d) is greater than last (%d)", begin, end)
+	}
+	return begin, end, nil
+}
+
+// createExportFile creates the file to export blocks into.
+func createExportFile(file string) (*os.File, error) {
+	if _, err := os.Stat(file); err == nil {
+		// File already exists. Allowing overwrite could be a DoS vecotor,
+		// since the 'file' may point to arbitrary paths on the drive
+		return nil, errors.New("location would overwrite an existing file")
+	}
+	return os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+}
+
+// exportChain writes the given range of canonical blocks into the file, gzipped
+// if its name ends with .gz, and closes it.
+func (api *PrivateAdminAPI) exportChain(out *os.File, first, last uint64, tracker *chainIOTracker) (err error) {
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	var writer io.Writer = out
+	if strings.HasSuffix(out.Name(), ".gz") {
+		gz := gzip.NewWriter(out)
+		defer func() {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		writer = gz
+	}
+	tracker.progress.First, tracker.progress.Last = hexutil.Uint64(first), hexutil.Uint64(last)
+
+	chain := api.eth.BlockChain()
+	for nr := first; nr <= last; nr++ {
+		if tracker.aborted() {
+			return errChainIOAborted
+		}
+		block := chain.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		if err := block.EncodeRLP(writer); err != nil {
+			return err
+		}
+		tracker.progress.Blocks++
+		tracker.progress.Number = hexutil.Uint64(nr)
+		tracker.report(false)
+	}
+	return nil
+}
+
+// importChain inserts the blocks of the file, gzipped if its name ends with
+// .gz, into the chain in batches, and closes it.
+func (api *PrivateAdminAPI) importChain(in *os.File, tracker *chainIOTracker) error {
+	defer in.Close()
+
+	var (
+		reader io.Reader = in
+		err    error
+	)
+	if strings.HasSuffix(in.Name(), ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	// Run actual the import in pre-configured batches
+	stream := rlp.NewStream(reader, 0)
+
+	blocks, index := make([]*types.Block, 0, 2500), 0
+	for batch := 0; ; batch++ {
+		// Load a batch of blocks from the input file
+		for len(blocks) < cap(blocks) {
+			block := new(types.Block)
+			if err := stream.Decode(block); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("block %d: failed to parse: %v", index, err)
+			}
+			index++
+
+			// Don't import the genesis block, exported with the whole chain
+			if block.NumberU64() == 0 {
+				tracker.progress.Blocks++
+				continue
+			}
+			blocks = append(blocks, block)
+		}
+		if len(blocks) == 0 {
+			break
+		}
+		if tracker.aborted() {
+			return errChainIOAborted
+		}
+		if !hasAllBlocks(api.eth.BlockChain(), blocks) {
+			// Import the batch
+			if _, err := api.eth.BlockChain().InsertChain(blocks); err != nil {
+				return fmt.Errorf("batch %d: failed to insert: %v", batch, err)
+			}
+			tracker.progress.Imported += hexutil.Uint64(len(blocks))
+		}
+		tracker.progress.Blocks += hexutil.Uint64(len(blocks))
+		tracker.progress.Number = hexutil.Uint64(blocks[len(blocks)-1].NumberU64())
+		tracker.report(false)
+
+		blocks = blocks[:0]
+	}
+	return nil
+}
+
+// runChainIO runs a chain import or export in the background, notifying its
+// progress to the subscriber, and aborting it if the subscriber goes away.
+func (api *PrivateAdminAPI) runChainIO(notifier *rpc.Notifier, sub *rpc.Subscription, file string, run func(tracker *chainIOTracker) error) {
+	defer api.releaseChainIO()
+
+	quit := make(chan struct{})
+	tracker := &chainIOTracker{
+		progress: ChainIOProgress{File: file},
+		notify:   func(progress *ChainIOProgress) { notifier.Notify(sub.ID, progress) },
+		quit:     quit,
+		start:    time.Now(),
+		reported: time.Now(),
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sub.Err():
+			close(quit)
+		case <-done:
+		}
+	}()
+	if err := run(tracker); err != nil {
+		log.Warn("Chain import or export failed", "file", file, "err", err)
+		tracker.progress.Error = err.Error()
+	}
+	tracker.progress.Done = true
+	tracker.report(true)
+}
+
+// ChainExport exports the current blockchain into a local file of the node, or
+// a range of blocks if first and last are non-nil, like ExportChain, but runs in
+// the background, notifying its progress to the subscriber. The export is
+// aborted if the subscriber unsubscribes.
+func (api *PrivateAdminAPI) ChainExport(ctx context.Context, file string, first *uint64, last *uint64) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	begin, end, err := api.exportRange(first, last)
+	if err != nil {
+		return nil, err
+	}
+	if !api.acquireChainIO() {
+		return nil, errChainIOBusy
+	}
+	out, err := createExportFile(file)
+	if err != nil {
+		api.releaseChainIO()
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+	go api.runChainIO(notifier, sub, file, func(tracker *chainIOTracker) error {
+		return api.exportChain(out, begin, end, tracker)
+	})
+	return sub, nil
+}
+
+// ChainImport imports a blockchain from a local file of the node like
+// ImportChain, but runs in the background, notifying its progress to the
+// subscriber. The import is aborted between two batches of blocks if the
+// subscriber unsubscribes.
+func (api *PrivateAdminAPI) ChainImport(ctx context.Context, file string) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if !api.acquireChainIO() {
+		return nil, errChainIOBusy
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		api.releaseChainIO()
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+	go api.runChainIO(notifier, sub, file, func(tracker *chainIOTracker) error {
+		return api.importChain(in, tracker)
+	})
+	return sub, nil
+}
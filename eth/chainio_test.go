@@ -0,0 +1,121 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newChainIOTestClient creates an in-process admin API client for a chain with
+// the given number of blocks.
+func newChainIOTestClient(t *testing.T, n int) (*core.BlockChain, *rpc.Client) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &genesisT.Genesis{Config: params.TestChainConfig}
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rawdb.NewMemoryDatabase(), n, nil)
+
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("admin", NewPrivateAdminAPI(&Ethereum{blockchain: chain, chainDb: db})); err != nil {
+		t.Fatalf("failed to register admin API: %v", err)
+	}
+	return chain, rpc.DialInProc(server)
+}
+
+// waitChainIO waits for the final progress notification of a chain import or
+// export subscription.
+func waitChainIO(t *testing.T, client *rpc.Client, method string, args ...interface{}) *ChainIOProgress {
+	progress := make(chan *ChainIOProgress, 16)
+	sub, err := client.Subscribe(context.Background(), "admin", progress, append([]interface{}{method}, args...)...)
+	if err != nil {
+		t.Fatalf("failed to subscribe to %s: %v", method, err)
+	}
+	defer sub.Unsubscribe()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case p := <-progress:
+			if p.Done {
+				return p
+			}
+		case err := <-sub.Err():
+			t.Fatalf("%s subscription failed: %v", method, err)
+		case <-timeout:
+			t.Fatalf("%s timed out", method)
+		}
+	}
+}
+
+// Tests that a chain exported by an admin subscription is imported by another
+// one into a fresh chain.
+func TestChainIOSubscriptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chainio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, srcClient := newChainIOTestClient(t, 32)
+	defer src.Stop()
+	defer srcClient.Close()
+
+	file := filepath.Join(dir, "chain.rlp.gz")
+	progress := waitChainIO(t, srcClient, "chainExport", file)
+	if progress.Error != "" {
+		t.Fatalf("export failed: %s", progress.Error)
+	}
+	if progress.Blocks != 33 || progress.Number != 32 {
+		t.Fatalf("export progress mismatch: have %d blocks up to #%d, want 33 up to #32", progress.Blocks, progress.Number)
+	}
+	// Exports never overwrite existing files
+	if _, err := srcClient.Subscribe(context.Background(), "admin", make(chan *ChainIOProgress), "chainExport", file); err == nil {
+		t.Fatal("export overwrote an existing file")
+	}
+	dst, dstClient := newChainIOTestClient(t, 0)
+	defer dst.Stop()
+	defer dstClient.Close()
+
+	progress = waitChainIO(t, dstClient, "chainImport", file)
+	if progress.Error != "" {
+		t.Fatalf("import failed: %s", progress.Error)
+	}
+	if progress.Blocks != 33 || progress.Imported != 32 {
+		t.Fatalf("import progress mismatch: have %d blocks, %d imported, want 33 and 32", progress.Blocks, progress.Imported)
+	}
+	if head := dst.CurrentBlock(); head.Hash() != src.CurrentBlock().Hash() {
+		t.Fatalf("imported head mismatch: have #%d [%x], want #%d", head.NumberU64(), head.Hash(), src.CurrentBlock().NumberU64())
+	}
+}
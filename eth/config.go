@@ -27,8 +27,15 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/eth/alerts"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/eth/forkmon"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/headwatch"
+	"github.com/ethereum/go-ethereum/eth/txmgr"
+	"github.com/ethereum/go-ethereum/eth/wit"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/types/genesisT"
@@ -69,6 +76,8 @@ var DefaultConfig = Config{
 	TrieDirtyCache:          256,
 	TrieTimeout:             60 * time.Minute,
 	SnapshotCache:           102,
+	AncientServeLimit:       1024 * 1024,
+	AncientFallbackTimeout:  5 * time.Second,
 	Miner: miner.Config{
 		GasFloor: 8000000,
 		GasCeil:  8000000,
@@ -78,7 +87,14 @@ var DefaultConfig = Config{
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   25000000,
 	GPO:         DefaultFullGPOConfig,
+	TxManager:   txmgr.DefaultConfig,
+	HeadWatch:   headwatch.DefaultConfig,
+	Alerts:      alerts.DefaultConfig,
+	ForkMonitor: forkmon.DefaultConfig,
+	Witness:     wit.DefaultConfig,
 	RPCTxFeeCap: 1, // 1 ether
+	RPCCacheTTL: 10 * time.Minute,
+	Filters:     filters.DefaultConfig,
 }
 
 func init() {
@@ -120,11 +136,30 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
+	CacheWarmup bool `toml:",omitempty"` // Whether to preload the chain and state caches in the background after startup
+
+	VerifyReceipts bool `toml:",omitempty"` // Whether to verify the receipts of the fast synced blocks against their headers
+
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryRetain uint64 `toml:",omitempty"` // The number of blocks from head whose bodies and receipts are retained (0 = all)
+	UncleIndex    bool   `toml:",omitempty"` // Whether to index the included uncles by miner
+	TrackSupply   bool   `toml:",omitempty"` // Whether to track the circulating supply and balance changes at every imported block
+	ContractIndex bool   `toml:",omitempty"` // Whether to index the deployed contracts by address and code hash
+	TokenIndex    bool   `toml:",omitempty"` // Whether to index the ERC-20 and ERC-721 token transfers
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
+	// Protocol message recording options
+	P2PRecordDir      string `toml:",omitempty"` // Directory to record the eth protocol sessions into (empty = disabled)
+	P2PRecordPayloads bool   `toml:",omitempty"` // Whether to record the message payloads too, needed for replays
+
+	// Block propagation options
+	BlockPropagation BlockPropagationConfig
+
+	// State serving options
+	StateServeLimit uint64 `toml:",omitempty"` // Bytes per second of state data served to all syncing peers together (0 = unlimited)
+
 	// Light client options
 	LightServ    int  `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightIngress int  `toml:",omitempty"` // Incoming bandwidth limit for light servers
@@ -138,22 +173,44 @@ type Config struct {
 	UltraLightOnlyAnnounce bool     `toml:",omitempty"` // Whether to only announce headers, or also serve them
 
 	// Database options
-	SkipBcVersionCheck    bool `toml:"-"`
-	DatabaseHandles       int  `toml:"-"`
-	DatabaseCache         int
-	DatabaseFreezer       string
-	DatabaseFreezerRemote string
+	SkipBcVersionCheck     bool `toml:"-"`
+	DatabaseHandles        int  `toml:"-"`
+	DatabaseCache          int
+	DatabaseFreezer        string
+	DatabaseFreezerRemote  string
+	AncientServeLimit      uint64                   `toml:",omitempty"` // Bytes per second of remote ancient data served to each peer (0 = unlimited)
+	AncientTiering         rawdb.TieringPolicy      `toml:",omitempty"` // Remote ancient blocks mirrored locally
+	AncientTieringFile     string                   `toml:",omitempty"` // JSON file of the tiering policy, overriding AncientTiering and reloadable
+	AncientCompression     rawdb.FreezerCompression `toml:",omitempty"` // Local ancient tables to snappy-compress when created (nil = defaults)
+	AncientFileSizes       map[string]uint32        `toml:",omitempty"` // Maximum local ancient data file sizes by table (missing = 2GB)
+	AncientSyncItems       uint64                   `toml:",omitempty"` // Items appended to a local ancient table between flushes (0 = flush after each freezing batch)
+	AncientThreshold       uint64                   `toml:",omitempty"` // Number of recent blocks not to freeze (0 = 90000, or 128 in aggressive mode)
+	AncientAggressive      bool                     `toml:",omitempty"` // Whether to freeze blocks as soon as they pass the threshold
+	AncientFallback        bool                     `toml:",omitempty"` // Whether to retrieve the ancient items the remote freezer fails to serve from the peers
+	AncientFallbackTimeout time.Duration            `toml:",omitempty"` // Time a remote ancient read may take before falling back to the peers (0 = unlimited)
+
+	// Startup integrity check options
+	IntegrityCheck  uint64 `toml:",omitempty"` // Number of recent blocks to verify the linkage of on startup (0 = disabled)
+	IntegrityRepair bool   `toml:",omitempty"` // Whether to rewind to the last consistent block instead of refusing to start
 
 	TrieCleanCache          int
 	TrieCleanCacheJournal   string        `toml:",omitempty"` // Disk journal directory for trie cache to survive node restarts
 	TrieCleanCacheRejournal time.Duration `toml:",omitempty"` // Time interval to regenerate the journal for clean cache
 	TrieDirtyCache          int
 	TrieTimeout             time.Duration
+	TrieFlushBlocks         uint64        `toml:",omitempty"` // Number of blocks after which to flush the in-memory state to disk (0 = no limit)
+	TrieFlushTimeout        time.Duration `toml:",omitempty"` // Time limit on shutdown after which to only flush the head state (0 = no limit)
 	SnapshotCache           int
+	SnapshotNoReads         bool    `toml:",omitempty"` // Whether to serve the RPC state reads from the trie, using the snapshot for block processing only
+	SnapshotAudit           float64 `toml:",omitempty"` // Fraction of the RPC state reads served from the snapshot to check against the trie
 
 	// Mining options
 	Miner miner.Config
 
+	// Developer chain options, sealing blocks with a faked ethash instead of clique
+	DeveloperPoW    bool   `toml:",omitempty"`
+	DeveloperPeriod uint64 `toml:",omitempty"` // Seconds between developer blocks (0 = seal on transactions)
+
 	// Ethash options
 	Ethash ethash.Config
 
@@ -163,6 +220,21 @@ type Config struct {
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// Local transaction manager options
+	TxManager txmgr.Config
+
+	// Chain head watcher options
+	HeadWatch headwatch.Config
+
+	// Critical event alerting options
+	Alerts alerts.Config
+
+	// Peer branch monitoring options
+	ForkMonitor forkmon.Config
+
+	// Block execution witness options
+	Witness wit.Config
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
@@ -175,6 +247,9 @@ type Config struct {
 	// Type of the EVM interpreter ("" for default)
 	EVMInterpreter string
 
+	// Enables collecting the opcode statistics of the processed blocks
+	EnableOpcodeStats bool
+
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap uint64 `toml:",omitempty"`
 
@@ -182,6 +257,27 @@ type Config struct {
 	// send-transction variants. The unit is ether.
 	RPCTxFeeCap float64 `toml:",omitempty"`
 
+	// RPCLogsRangeCap is the maximum number of blocks a log query can span.
+	RPCLogsRangeCap uint64 `toml:",omitempty"`
+
+	// RPCErrorCodes enables the canonical error codes and data of the eth, debug
+	// and txpool APIs, instead of the default -32000 code.
+	RPCErrorCodes bool `toml:",omitempty"`
+
+	// TraceRegenerate is the number of blocks the tracers may reexecute to
+	// regenerate a historical state beyond their own reexecution limit, the
+	// regenerated states being retained for the subsequent traces. Disabled if
+	// zero.
+	TraceRegenerate uint64 `toml:",omitempty"`
+
+	// RPCCacheSize is the number of responses of historical queries to cache,
+	// expiring after RPCCacheTTL. Caching is disabled if zero.
+	RPCCacheSize int           `toml:",omitempty"`
+	RPCCacheTTL  time.Duration `toml:",omitempty"`
+
+	// Options of the filters polled via eth_getFilterChanges
+	Filters filters.Config
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *ctypes.TrustedCheckpoint `toml:",omitempty"`
 
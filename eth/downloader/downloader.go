@@ -117,6 +117,8 @@ type Downloader struct {
 	syncStatsChainOrigin uint64 // Origin block number where syncing started at
 	syncStatsChainHeight uint64 // Highest block number known when syncing started
 	syncStatsState       stateSyncStats
+	syncStatsStart       time.Time    // Time the current or last sync cycle started at
+	syncStatsStateOrigin uint64       // Number of state entries processed when the sync cycle started
 	syncStatsLock        sync.RWMutex // Lock protecting the sync stats fields
 
 	lightchain LightChain
@@ -237,10 +239,16 @@ func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom,
 		quitCh:         make(chan struct{}),
 		stateCh:        make(chan dataPack),
 		stateSyncStart: make(chan *stateSync),
-		syncStatsState: stateSyncStats{
-			processed: rawdb.ReadFastTrieProgress(stateDb),
-		},
-		trackStateReq: make(chan *stateReq),
+		trackStateReq:  make(chan *stateReq),
+	}
+	// Continue reporting the state download progress across restarts
+	progress := rawdb.ReadStateSyncProgress(stateDb)
+	dl.syncStatsState = stateSyncStats{
+		root:       progress.Root,
+		processed:  progress.Processed,
+		duplicate:  progress.Duplicate,
+		unexpected: progress.Unexpected,
+		pending:    progress.Pending,
 	}
 	go dl.qosTuner()
 	go dl.stateFetcher()
@@ -474,6 +482,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		d.syncStatsChainOrigin = origin
 	}
 	d.syncStatsChainHeight = height
+	d.syncStatsStart, d.syncStatsStateOrigin = time.Now(), d.syncStatsState.processed
 	d.syncStatsLock.Unlock()
 
 	// Ensure our origin point is below any fast sync pivot point
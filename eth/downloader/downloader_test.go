@@ -554,6 +554,29 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, chain.len())
 }
 
+// Tests that the state download progress is persisted and reported again by a
+// downloader created after a restart.
+func TestStateSyncProgressPersistence(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	chain := testChainBase.shorten(blockCacheItems - 15)
+	tester.newPeer("peer", 64, chain)
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	progress := rawdb.ReadStateSyncProgress(tester.stateDb)
+	if progress.Root == (common.Hash{}) || progress.Processed == 0 || progress.Pending != 0 {
+		t.Fatalf("state sync progress not persisted: %+v", progress)
+	}
+	restarted := New(0, tester.stateDb, trie.NewSyncBloom(1, tester.stateDb), new(event.TypeMux), tester, nil, tester.dropPeer)
+	defer restarted.Terminate()
+
+	if have := restarted.Progress(); have.PulledStates != progress.Processed || have.KnownStates != progress.Processed {
+		t.Fatalf("restarted state progress mismatch: have %d/%d, want %d", have.PulledStates, have.KnownStates, progress.Processed)
+	}
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling63Full(t *testing.T) { testThrottling(t, 63, FullSync) }
@@ -58,6 +58,11 @@ type peerConnection struct {
 	receiptThroughput float64 // Number of receipts measured to be retrievable per second
 	stateThroughput   float64 // Number of node data pieces measured to be retrievable per second
 
+	headerStats  fetchStats // Retrieval counters of headers
+	blockStats   fetchStats // Retrieval counters of blocks (bodies)
+	receiptStats fetchStats // Retrieval counters of receipts
+	stateStats   fetchStats // Retrieval counters of node data
+
 	rtt time.Duration // Request round trip time to track responsiveness (QoS)
 
 	headerStarted  time.Time // Time instance when the last header fetch was started
@@ -211,41 +216,45 @@ func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
 // requests. Its estimated header retrieval throughput is updated with that measured
 // just now.
 func (p *peerConnection) SetHeadersIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.headerStarted), delivered, &p.headerThroughput, &p.headerIdle)
+	p.setIdle(deliveryTime.Sub(p.headerStarted), delivered, &p.headerThroughput, &p.headerStats, &p.headerIdle)
 }
 
 // SetBodiesIdle sets the peer to idle, allowing it to execute block body retrieval
 // requests. Its estimated body retrieval throughput is updated with that measured
 // just now.
 func (p *peerConnection) SetBodiesIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.blockStarted), delivered, &p.blockThroughput, &p.blockIdle)
+	p.setIdle(deliveryTime.Sub(p.blockStarted), delivered, &p.blockThroughput, &p.blockStats, &p.blockIdle)
 }
 
 // SetReceiptsIdle sets the peer to idle, allowing it to execute new receipt
 // retrieval requests. Its estimated receipt retrieval throughput is updated
 // with that measured just now.
 func (p *peerConnection) SetReceiptsIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.receiptStarted), delivered, &p.receiptThroughput, &p.receiptIdle)
+	p.setIdle(deliveryTime.Sub(p.receiptStarted), delivered, &p.receiptThroughput, &p.receiptStats, &p.receiptIdle)
 }
 
 // SetNodeDataIdle sets the peer to idle, allowing it to execute new state trie
 // data retrieval requests. Its estimated state retrieval throughput is updated
 // with that measured just now.
 func (p *peerConnection) SetNodeDataIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.stateStarted), delivered, &p.stateThroughput, &p.stateIdle)
+	p.setIdle(deliveryTime.Sub(p.stateStarted), delivered, &p.stateThroughput, &p.stateStats, &p.stateIdle)
 }
 
 // setIdle sets the peer to idle, allowing it to execute new retrieval requests.
 // Its estimated retrieval throughput is updated with that measured just now.
-func (p *peerConnection) setIdle(elapsed time.Duration, delivered int, throughput *float64, idle *int32) {
+func (p *peerConnection) setIdle(elapsed time.Duration, delivered int, throughput *float64, stats *fetchStats, idle *int32) {
 	// Irrelevant of the scaling, make sure the peer ends up idle
 	defer atomic.StoreInt32(idle, 0)
 
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	stats.requests++
+	stats.delivered += uint64(delivered)
+
 	// If nothing was delivered (hard timeout / unavailable data), reduce throughput to minimum
 	if delivered == 0 {
+		stats.failures++
 		*throughput = 0
 		return
 	}
@@ -330,6 +339,7 @@ func (p *peerConnection) Lacks(hash common.Hash) bool {
 // download procedure.
 type peerSet struct {
 	peers        map[string]*peerConnection
+	pinned       string // Identifier of the peer preferred for all retrievals if idle
 	newPeerFeed  event.Feed
 	peerDropFeed event.Feed
 	lock         sync.RWMutex
@@ -520,9 +530,16 @@ func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerC
 			total++
 		}
 	}
-	// And sort them
+	// And sort them, the pinned peer first
 	sortPeers := &peerThroughputSort{idle, tps}
 	sort.Sort(sortPeers)
+	for i, p := range sortPeers.p {
+		if p.id == ps.pinned {
+			copy(sortPeers.p[1:i+1], sortPeers.p[:i])
+			sortPeers.p[0] = p
+			break
+		}
+	}
 	return sortPeers.p, total
 }
 
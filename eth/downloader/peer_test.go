@@ -19,6 +19,9 @@ package downloader
 import (
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
 )
 
 func TestPeerThroughputSorting(t *testing.T) {
@@ -51,3 +54,35 @@ func TestPeerThroughputSorting(t *testing.T) {
 	}
 
 }
+
+// Tests that the pinned peer comes first among the idle peers regardless of its
+// throughput, and that its retrievals are counted.
+func TestPeerPinningAndStats(t *testing.T) {
+	d := &Downloader{peers: newPeerSet()}
+	for i, id := range []string{"a", "b", "c"} {
+		p := newPeerConnection(id, 64, nil, log.New())
+		p.headerThroughput = float64(3 - i)
+		d.peers.peers[id] = p
+	}
+	d.PinPeer("c")
+
+	idle, _ := d.peers.HeaderIdlePeers()
+	if ids := []string{idle[0].id, idle[1].id, idle[2].id}; ids[0] != "c" || ids[1] != "a" || ids[2] != "b" {
+		t.Fatalf("idle peer order mismatch: have %v, want [c a b]", ids)
+	}
+	p := d.peers.Peer("c")
+	p.SetHeadersIdle(192, time.Now())
+	p.SetHeadersIdle(0, time.Now())
+
+	stats := d.PeerStats()
+	if len(stats) != 3 || stats[2].ID != "c" || !stats[2].Pinned {
+		t.Fatalf("peer stats mismatch: %+v", stats)
+	}
+	if have := stats[2].Headers; have.Requests != 2 || have.Delivered != 192 || have.Failures != 1 {
+		t.Errorf("header stats mismatch: have %+v, want 2 requests, 192 delivered, 1 failure", have)
+	}
+	d.PinPeer("")
+	if idle, _ := d.peers.HeaderIdlePeers(); idle[0].id != "a" {
+		t.Errorf("unpinned idle peer order mismatch: have %s first, want a", idle[0].id)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// fetchStats are the retrieval counters of a peer for one kind of data.
+type fetchStats struct {
+	requests  uint64 // Number of requests completed, delivered or not
+	delivered uint64 // Number of items delivered
+	failures  uint64 // Number of requests timed out or delivering nothing
+}
+
+// PeerFetchStats are the retrieval statistics of a sync peer for one kind of
+// data.
+type PeerFetchStats struct {
+	Active     bool    `json:"active"`     // Whether a request is in flight
+	Throughput float64 `json:"throughput"` // Items per second, as measured for the current sync
+	Requests   uint64  `json:"requests"`
+	Delivered  uint64  `json:"delivered"`
+	Failures   uint64  `json:"failures"`
+}
+
+// PeerSyncStats are the retrieval statistics of a sync peer since it connected.
+type PeerSyncStats struct {
+	ID       string         `json:"id"`
+	Master   bool           `json:"master"` // Whether the current sync follows the chain of the peer
+	Pinned   bool           `json:"pinned"`
+	RTT      string         `json:"rtt"`
+	Headers  PeerFetchStats `json:"headers"`
+	Bodies   PeerFetchStats `json:"bodies"`
+	Receipts PeerFetchStats `json:"receipts"`
+	States   PeerFetchStats `json:"states"`
+}
+
+func newPeerFetchStats(idle *int32, throughput float64, stats fetchStats) PeerFetchStats {
+	return PeerFetchStats{
+		Active:     atomic.LoadInt32(idle) != 0,
+		Throughput: throughput,
+		Requests:   stats.requests,
+		Delivered:  stats.delivered,
+		Failures:   stats.failures,
+	}
+}
+
+// PeerStats returns the retrieval statistics of the sync peers, sorted by id.
+func (d *Downloader) PeerStats() []PeerSyncStats {
+	var master string
+	if atomic.LoadInt32(&d.synchronising) == 1 {
+		d.cancelLock.RLock()
+		master = d.cancelPeer
+		d.cancelLock.RUnlock()
+	}
+	d.peers.lock.RLock()
+	pinned := d.peers.pinned
+	d.peers.lock.RUnlock()
+
+	var stats []PeerSyncStats
+	for _, p := range d.peers.AllPeers() {
+		p.lock.RLock()
+		stats = append(stats, PeerSyncStats{
+			ID:       p.id,
+			Master:   p.id == master,
+			Pinned:   p.id == pinned,
+			RTT:      p.rtt.String(),
+			Headers:  newPeerFetchStats(&p.headerIdle, p.headerThroughput, p.headerStats),
+			Bodies:   newPeerFetchStats(&p.blockIdle, p.blockThroughput, p.blockStats),
+			Receipts: newPeerFetchStats(&p.receiptIdle, p.receiptThroughput, p.receiptStats),
+			States:   newPeerFetchStats(&p.stateIdle, p.stateThroughput, p.stateStats),
+		})
+		p.lock.RUnlock()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// PinPeer sets the peer preferred for all retrievals whenever it's idle, and as
+// the source of the syncs if it's ahead of the local chain, or unpins the
+// pinned one if id is empty. The peer doesn't have to be connected yet.
+func (d *Downloader) PinPeer(id string) {
+	d.peers.lock.Lock()
+	defer d.peers.lock.Unlock()
+
+	d.peers.pinned = id
+}
+
+// PinnedPeer returns the identifier of the pinned peer, empty if none.
+func (d *Downloader) PinnedPeer() string {
+	d.peers.lock.RLock()
+	defer d.peers.lock.RUnlock()
+
+	return d.peers.pinned
+}
@@ -52,10 +52,11 @@ func (req *stateReq) timedOut() bool {
 // stateSyncStats is a collection of progress stats to report during a state trie
 // sync to RPC requests as well as to display in user logs.
 type stateSyncStats struct {
-	processed  uint64 // Number of state entries processed
-	duplicate  uint64 // Number of state entries downloaded twice
-	unexpected uint64 // Number of non-requested state entries received
-	pending    uint64 // Number of still pending state entries
+	root       common.Hash // State root of the current or last download
+	processed  uint64      // Number of state entries processed
+	duplicate  uint64      // Number of state entries downloaded twice
+	unexpected uint64      // Number of non-requested state entries received
+	pending    uint64      // Number of still pending state entries
 }
 
 // syncState starts downloading state with the given root hash.
@@ -319,6 +320,8 @@ func (s *stateSync) Cancel() error {
 // and timeouts.
 func (s *stateSync) loop() (err error) {
 	close(s.started)
+	s.resumeStats()
+
 	// Listen for new peer events to assign tasks to them
 	newPeer := make(chan *peerConnection, 1024)
 	peerSub := s.d.peers.SubscribeNewPeers(newPeer)
@@ -521,6 +524,19 @@ func (s *stateSync) processNodeData(blob []byte) (common.Hash, error) {
 	return res.Hash, err
 }
 
+// resumeStats marks the root of the sync in the progress counters, noting if it
+// continues a download interrupted by a restart. Trie nodes already persisted
+// are skipped along with their subtries, so only the missing ones are requested.
+func (s *stateSync) resumeStats() {
+	s.d.syncStatsLock.Lock()
+	defer s.d.syncStatsLock.Unlock()
+
+	if s.d.syncStatsState.root == s.root && s.d.syncStatsState.pending > 0 {
+		log.Info("Resuming state sync", "root", s.root, "processed", s.d.syncStatsState.processed, "pending", s.d.syncStatsState.pending)
+	}
+	s.d.syncStatsState.root = s.root
+}
+
 // updateStats bumps the various state sync progress counters and displays a log
 // message for the user to see.
 func (s *stateSync) updateStats(written, duplicate, unexpected int, duration time.Duration) {
@@ -536,6 +552,12 @@ func (s *stateSync) updateStats(written, duplicate, unexpected int, duration tim
 		log.Info("Imported new state entries", "count", written, "elapsed", common.PrettyDuration(duration), "processed", s.d.syncStatsState.processed, "pending", s.d.syncStatsState.pending, "retry", len(s.tasks), "duplicate", s.d.syncStatsState.duplicate, "unexpected", s.d.syncStatsState.unexpected)
 	}
 	if written > 0 {
-		rawdb.WriteFastTrieProgress(s.d.stateDB, s.d.syncStatsState.processed)
+		rawdb.WriteStateSyncProgress(s.d.stateDB, &rawdb.StateSyncProgress{
+			Root:       s.root,
+			Processed:  s.d.syncStatsState.processed,
+			Pending:    s.d.syncStatsState.pending,
+			Duplicate:  s.d.syncStatsState.duplicate,
+			Unexpected: s.d.syncStatsState.unexpected,
+		})
 	}
 }
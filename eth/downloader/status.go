@@ -0,0 +1,141 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// Sync stages, in the order a sync cycle goes through them.
+const (
+	StageHeaders  = "headers"
+	StageBodies   = "bodies"
+	StageReceipts = "receipts"
+	StageState    = "state"
+)
+
+// StageProgress is the progress of a sync stage.
+type StageProgress struct {
+	Current uint64        // Number of the last block, or state entry, downloaded by the stage
+	Highest uint64        // Number of the block, or state entries, the stage is heading to
+	Pending uint64        // Number of items scheduled but not downloaded yet
+	ETA     time.Duration // Estimated time to complete the stage, zero if unknown
+}
+
+// AncientStatus is the status of the ancient store backfill. Blocks older than
+// the immutability threshold are moved into the ancient store in the background,
+// which may lag behind the sync stages.
+type AncientStatus struct {
+	Frozen      uint64 // Number of blocks moved into the ancient store
+	Target      uint64 // Number of blocks the ancient store is expected to hold at the current head
+	HistoryTail uint64 // Number of the oldest block whose body and receipts are retained
+}
+
+// SyncStatus is the progress of a sync cycle broken down by stage. The stages
+// the sync mode doesn't go through are nil.
+type SyncStatus struct {
+	ethereum.SyncProgress
+
+	Mode     SyncMode
+	Stage    string // Most advanced stage currently active
+	Headers  *StageProgress
+	Bodies   *StageProgress
+	Receipts *StageProgress
+	State    *StageProgress
+	Ancients AncientStatus
+}
+
+// Status retrieves the progress of the current or last sync cycle broken down
+// by stage, along with the status of the ancient store backfill.
+func (d *Downloader) Status() SyncStatus {
+	status := SyncStatus{SyncProgress: d.Progress(), Mode: d.getMode()}
+
+	d.syncStatsLock.RLock()
+	var (
+		start        = d.syncStatsStart
+		origin       = d.syncStatsChainOrigin
+		stateOrigin  = d.syncStatsStateOrigin
+		statePending = d.syncStatsState.pending
+	)
+	d.syncStatsLock.RUnlock()
+
+	// Estimate the remaining time of the stages from their rate since the start
+	// of the sync cycle
+	eta := func(done, remaining uint64) time.Duration {
+		if start.IsZero() || done == 0 || remaining == 0 {
+			return 0
+		}
+		return time.Duration(float64(time.Since(start)) * float64(remaining) / float64(done)).Round(time.Second)
+	}
+	blocks := func(current uint64, pending int) *StageProgress {
+		stage := &StageProgress{Current: current, Highest: status.HighestBlock, Pending: uint64(pending)}
+		if current > origin && current < stage.Highest {
+			stage.ETA = eta(current-origin, stage.Highest-current)
+		}
+		return stage
+	}
+	status.Headers = blocks(d.lightchain.CurrentHeader().Number.Uint64(), d.queue.PendingHeaders())
+
+	var head uint64
+	switch {
+	case d.blockchain != nil && status.Mode == FullSync:
+		head = d.blockchain.CurrentBlock().NumberU64()
+		status.Bodies = blocks(head, d.queue.PendingBlocks())
+
+	case d.blockchain != nil && status.Mode == FastSync:
+		head = d.blockchain.CurrentFastBlock().NumberU64()
+		status.Bodies = blocks(head, d.queue.PendingBlocks())
+		status.Receipts = blocks(head, d.queue.PendingReceipts())
+		status.State = &StageProgress{
+			Current: status.PulledStates,
+			Highest: status.KnownStates,
+			Pending: statePending,
+		}
+		if status.PulledStates > stateOrigin {
+			status.State.ETA = eta(status.PulledStates-stateOrigin, statePending)
+		}
+	}
+	if d.blockchain != nil {
+		frozen, _ := d.stateDB.Ancients()
+		status.Ancients.Frozen = frozen
+		if head > vars.FullImmutabilityThreshold {
+			status.Ancients.Target = head - vars.FullImmutabilityThreshold
+		}
+		if tail := rawdb.ReadHistoryTail(d.stateDB); tail != nil {
+			status.Ancients.HistoryTail = *tail
+		}
+	}
+	status.Stage = status.stage()
+	return status
+}
+
+// stage returns the most advanced stage still having work to do.
+func (s *SyncStatus) stage() string {
+	switch {
+	case s.State != nil && s.State.Pending > 0:
+		return StageState
+	case s.Receipts != nil && s.Receipts.Pending > 0:
+		return StageReceipts
+	case s.Bodies != nil && s.Bodies.Pending > 0:
+		return StageBodies
+	}
+	return StageHeaders
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"testing"
+)
+
+// Tests that the sync status reports the stages the sync mode goes through.
+func TestSyncStatusFull(t *testing.T)  { testSyncStatus(t, FullSync) }
+func TestSyncStatusFast(t *testing.T)  { testSyncStatus(t, FastSync) }
+func TestSyncStatusLight(t *testing.T) { testSyncStatus(t, LightSync) }
+
+func testSyncStatus(t *testing.T, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+	chain := testChainBase.shorten(blockCacheItems - 15)
+
+	tester.newPeer("peer", 65, chain)
+	if err := tester.sync("peer", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	status := tester.downloader.Status()
+	if status.Mode != mode || status.Stage != StageHeaders {
+		t.Fatalf("status mismatch: mode %v, stage %s", status.Mode, status.Stage)
+	}
+	highest := uint64(chain.len() - 1)
+	if status.Headers == nil || status.Headers.Current != highest || status.Headers.Highest != highest || status.Headers.ETA != 0 {
+		t.Fatalf("headers stage mismatch: %+v", status.Headers)
+	}
+	if (status.Bodies != nil) != (mode != LightSync) {
+		t.Errorf("bodies stage presence mismatch: %+v", status.Bodies)
+	}
+	if status.Bodies != nil && status.Bodies.Current != highest {
+		t.Errorf("bodies stage mismatch: %+v", status.Bodies)
+	}
+	if (status.Receipts != nil) != (mode == FastSync) || (status.State != nil) != (mode == FastSync) {
+		t.Errorf("fast sync stages presence mismatch: receipts %+v, state %+v", status.Receipts, status.State)
+	}
+}
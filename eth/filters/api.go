@@ -34,10 +34,6 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-var (
-	deadline = 5 * time.Minute // consider a filter inactive if it has not been polled for within deadline
-)
-
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -47,6 +43,15 @@ type filter struct {
 	crit     FilterCriteria
 	logs     []*types.Log
 	s        *Subscription // associated subscription in event system
+
+	created time.Time // When the filter was installed
+	polled  time.Time // When the changes of the filter were last polled
+
+	// Polling positions, tracked to resume persisted filters after restarts
+	last      uint64 // Number of the last block whose hash is waiting to be polled
+	delivered uint64 // Number of the block of the last change polled
+	pollHead  uint64 // Head of the chain on the last poll
+	position  uint64 // Last block whose changes were surely delivered
 }
 
 // PublicFilterAPI offers support to create and manage filters. This will allow external clients to retrieve various
@@ -59,25 +64,48 @@ type PublicFilterAPI struct {
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
+	timeout   time.Duration // Time after which the filters not polled are uninstalled
+	persist   bool          // Whether the log and block filters are persisted across restarts
+
+	resumeWindow uint64 // Maximum number of blocks replayed to resumed subscriptions
 }
 
 // NewPublicFilterAPI returns a new PublicFilterAPI instance.
 func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+	return NewPublicFilterAPIWithConfig(backend, lightMode, DefaultConfig)
+}
+
+// NewPublicFilterAPIWithConfig returns a new PublicFilterAPI instance with the
+// given settings, restoring the persisted filters if enabled.
+func NewPublicFilterAPIWithConfig(backend Backend, lightMode bool, config Config) *PublicFilterAPI {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	if config.ResumeWindow == 0 {
+		config.ResumeWindow = DefaultConfig.ResumeWindow
+	}
 	api := &PublicFilterAPI{
 		backend: backend,
 		chainDb: backend.ChainDb(),
 		events:  NewEventSystem(backend, lightMode),
 		filters: make(map[rpc.ID]*filter),
+		timeout: config.Timeout,
+		persist: config.Persist,
+
+		resumeWindow: config.ResumeWindow,
+	}
+	if api.persist {
+		api.restoreFilters()
 	}
 	go api.timeoutLoop()
 
 	return api
 }
 
-// timeoutLoop runs every 5 minutes and deletes filters that have not been recently used.
+// timeoutLoop runs every timeout period and deletes filters that have not been recently used.
 // Tt is started when the api is created.
 func (api *PublicFilterAPI) timeoutLoop() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(api.timeout)
 	defer ticker.Stop()
 	for {
 		<-ticker.C
@@ -87,6 +115,7 @@ func (api *PublicFilterAPI) timeoutLoop() {
 			case <-f.deadline.C:
 				f.s.Unsubscribe()
 				delete(api.filters, id)
+				api.forgetFilter(id)
 			default:
 				continue
 			}
@@ -95,6 +124,73 @@ func (api *PublicFilterAPI) timeoutLoop() {
 	}
 }
 
+// newPollFilter creates the metadata of a filter polled via eth_getFilterChanges,
+// positioned at the current head.
+func (api *PublicFilterAPI) newPollFilter(typ Type, crit FilterCriteria, sub *Subscription) *filter {
+	head := api.headNumber()
+	return &filter{
+		typ:       typ,
+		crit:      crit,
+		deadline:  time.NewTimer(api.timeout),
+		s:         sub,
+		created:   time.Now(),
+		polled:    time.Now(),
+		delivered: head,
+		pollHead:  head,
+		position:  head,
+	}
+}
+
+// headNumber returns the number of the current head of the chain.
+func (api *PublicFilterAPI) headNumber() uint64 {
+	header, _ := api.backend.HeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+	if header == nil {
+		return 0
+	}
+	return header.Number.Uint64()
+}
+
+// trackHeaders collects the hashes of the new heads for the block filter with
+// the given id to be polled.
+func (api *PublicFilterAPI) trackHeaders(id rpc.ID, headers chan *types.Header, sub *Subscription) {
+	for {
+		select {
+		case h := <-headers:
+			api.filtersMu.Lock()
+			if f, found := api.filters[id]; found {
+				f.hashes = append(f.hashes, h.Hash())
+				f.last = h.Number.Uint64()
+			}
+			api.filtersMu.Unlock()
+		case <-sub.Err():
+			api.filtersMu.Lock()
+			delete(api.filters, id)
+			api.filtersMu.Unlock()
+			return
+		}
+	}
+}
+
+// trackLogs collects the matching logs for the log filter with the given id to
+// be polled.
+func (api *PublicFilterAPI) trackLogs(id rpc.ID, logs chan []*types.Log, sub *Subscription) {
+	for {
+		select {
+		case l := <-logs:
+			api.filtersMu.Lock()
+			if f, found := api.filters[id]; found {
+				f.logs = append(f.logs, l...)
+			}
+			api.filtersMu.Unlock()
+		case <-sub.Err():
+			api.filtersMu.Lock()
+			delete(api.filters, id)
+			api.filtersMu.Unlock()
+			return
+		}
+	}
+}
+
 // NewPendingTransactionFilter creates a filter that fetches pending transaction hashes
 // as transactions enter the pending state.
 //
@@ -109,7 +205,7 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	)
 
 	api.filtersMu.Lock()
-	api.filters[pendingTxSub.ID] = &filter{typ: PendingTransactionsSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: pendingTxSub}
+	api.filters[pendingTxSub.ID] = &filter{typ: PendingTransactionsSubscription, deadline: time.NewTimer(api.timeout), hashes: make([]common.Hash, 0), s: pendingTxSub, created: time.Now(), polled: time.Now()}
 	api.filtersMu.Unlock()
 
 	go func() {
@@ -178,48 +274,80 @@ func (api *PublicFilterAPI) NewBlockFilter() rpc.ID {
 		headerSub = api.events.SubscribeNewHeads(headers)
 	)
 
+	f := api.newPollFilter(BlocksSubscription, FilterCriteria{}, headerSub)
+	f.hashes = make([]common.Hash, 0)
+
 	api.filtersMu.Lock()
-	api.filters[headerSub.ID] = &filter{typ: BlocksSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: headerSub}
+	api.filters[headerSub.ID] = f
+	api.persistFilter(headerSub.ID, f)
 	api.filtersMu.Unlock()
 
-	go func() {
-		for {
-			select {
-			case h := <-headers:
-				api.filtersMu.Lock()
-				if f, found := api.filters[headerSub.ID]; found {
-					f.hashes = append(f.hashes, h.Hash())
-				}
-				api.filtersMu.Unlock()
-			case <-headerSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, headerSub.ID)
-				api.filtersMu.Unlock()
-				return
-			}
-		}
-	}()
+	go api.trackHeaders(headerSub.ID, headers, headerSub)
 
 	return headerSub.ID
 }
 
 // NewHeads send a notification each time a new (header) block is appended to the chain.
-func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+//
+// If the cursor of the last header received by a previous subscription is given,
+// the headers of the blocks imported since are sent first.
+func (api *PublicFilterAPI) NewHeads(ctx context.Context, cursor *Cursor) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
-
-	rpcSub := notifier.CreateSubscription()
-
+	var point *resumePoint
+	if cursor != nil {
+		var err error
+		if point, err = api.resolveCursor(ctx, cursor); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		rpcSub     = notifier.CreateSubscription()
+		headers    = make(chan *types.Header)
+		headersSub = api.events.SubscribeNewHeads(headers)
+	)
 	go func() {
-		headers := make(chan *types.Header)
-		headersSub := api.events.SubscribeNewHeads(headers)
-
+		var (
+			replayed chan []*types.Header
+			pending  []*types.Header
+			seen     map[common.Hash]struct{} // Replayed headers, skipped if also received live
+			last     uint64                   // Number of the last replayed header
+		)
+		if point != nil {
+			replayed = make(chan []*types.Header, 1)
+			go func() { replayed <- api.replayHeaders(point) }()
+		}
+		notify := func(h *types.Header) {
+			if seen != nil {
+				if _, ok := seen[h.Hash()]; ok {
+					return
+				}
+				if h.Number.Uint64() > last {
+					seen = nil
+				}
+			}
+			notifier.Notify(rpcSub.ID, h)
+		}
 		for {
 			select {
 			case h := <-headers:
-				notifier.Notify(rpcSub.ID, h)
+				if replayed != nil {
+					pending = append(pending, h)
+					continue
+				}
+				notify(h)
+			case hs := <-replayed:
+				replayed, seen = nil, make(map[common.Hash]struct{}, len(hs))
+				for _, h := range hs {
+					notifier.Notify(rpcSub.ID, h)
+					seen[h.Hash()], last = struct{}{}, h.Number.Uint64()
+				}
+				for _, h := range pending {
+					notify(h)
+				}
+				pending = nil
 			case <-rpcSub.Err():
 				headersSub.Unsubscribe()
 				return
@@ -234,12 +362,22 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
-func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+//
+// If the cursor of the last log received by a previous subscription is given,
+// the matching logs of the blocks imported since are sent first, preceded by the
+// ones received from blocks reorged out in the meantime, marked as removed.
+func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria, cursor *Cursor) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
-
+	var point *resumePoint
+	if cursor != nil {
+		var err error
+		if point, err = api.resolveCursor(ctx, cursor); err != nil {
+			return nil, err
+		}
+	}
 	var (
 		rpcSub      = notifier.CreateSubscription()
 		matchedLogs = make(chan []*types.Log)
@@ -251,13 +389,49 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	}
 
 	go func() {
-
+		var (
+			replayed chan []*types.Log
+			pending  []*types.Log
+			seen     map[logKey]struct{} // Replayed logs, skipped if also received live
+			last     uint64              // Number of the block of the last replayed log
+		)
+		if point != nil {
+			replayed = make(chan []*types.Log, 1)
+			go func() { replayed <- api.replayLogs(crit, point) }()
+		}
+		notify := func(l *types.Log) {
+			if seen != nil {
+				if _, ok := seen[logKey{l.BlockHash, l.Index}]; ok && !l.Removed {
+					return
+				}
+				if l.BlockNumber > last {
+					seen = nil
+				}
+			}
+			notifier.Notify(rpcSub.ID, l)
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
+				if replayed != nil {
+					pending = append(pending, logs...)
+					continue
+				}
 				for _, log := range logs {
-					notifier.Notify(rpcSub.ID, &log)
+					notify(log)
+				}
+			case logs := <-replayed:
+				replayed, seen = nil, make(map[logKey]struct{}, len(logs))
+				for _, log := range logs {
+					notifier.Notify(rpcSub.ID, log)
+					if !log.Removed {
+						seen[logKey{log.BlockHash, log.Index}], last = struct{}{}, log.BlockNumber
+					}
 				}
+				for _, log := range pending {
+					notify(log)
+				}
+				pending = nil
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
@@ -295,27 +469,15 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 		return rpc.ID(""), err
 	}
 
+	f := api.newPollFilter(LogsSubscription, crit, logsSub)
+	f.logs = make([]*types.Log, 0)
+
 	api.filtersMu.Lock()
-	api.filters[logsSub.ID] = &filter{typ: LogsSubscription, crit: crit, deadline: time.NewTimer(deadline), logs: make([]*types.Log, 0), s: logsSub}
+	api.filters[logsSub.ID] = f
+	api.persistFilter(logsSub.ID, f)
 	api.filtersMu.Unlock()
 
-	go func() {
-		for {
-			select {
-			case l := <-logs:
-				api.filtersMu.Lock()
-				if f, found := api.filters[logsSub.ID]; found {
-					f.logs = append(f.logs, l...)
-				}
-				api.filtersMu.Unlock()
-			case <-logsSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, logsSub.ID)
-				api.filtersMu.Unlock()
-				return
-			}
-		}
-	}()
+	go api.trackLogs(logsSub.ID, logs, logsSub)
 
 	return logsSub.ID, nil
 }
@@ -324,31 +486,51 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getlogs
 func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
-	var filter *Filter
-	if crit.BlockHash != nil {
-		// Block filter requested, construct a single-shot filter
-		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
-	} else {
-		// Convert the RPC block numbers into internal representations
-		begin := rpc.LatestBlockNumber.Int64()
-		if crit.FromBlock != nil {
-			begin = crit.FromBlock.Int64()
-		}
-		end := rpc.LatestBlockNumber.Int64()
-		if crit.ToBlock != nil {
-			end = crit.ToBlock.Int64()
-		}
-		// Construct the range filter
-		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
-	}
 	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
+	logs, err := newCriteriaFilter(api.backend, crit).Logs(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return returnLogs(logs), err
 }
 
+// newCriteriaFilter creates the single-shot filter retrieving the logs matching
+// the criteria.
+func newCriteriaFilter(backend Backend, crit FilterCriteria) *Filter {
+	if crit.BlockHash != nil {
+		// Block filter requested, construct a single-shot filter
+		return NewBlockFilter(backend, *crit.BlockHash, crit.Addresses, crit.Topics)
+	}
+	// Convert the RPC block numbers into internal representations
+	begin := rpc.LatestBlockNumber.Int64()
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Int64()
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Int64()
+	}
+	// Construct the range filter
+	return NewRangeFilter(backend, begin, end, crit.Addresses, crit.Topics)
+}
+
+// PublicDebugFilterAPI offers the methods to inspect log queries before running
+// them.
+type PublicDebugFilterAPI struct {
+	backend Backend
+}
+
+// NewPublicDebugFilterAPI creates the debug API of the log filters.
+func NewPublicDebugFilterAPI(backend Backend) *PublicDebugFilterAPI {
+	return &PublicDebugFilterAPI{backend: backend}
+}
+
+// EstimateLogsQuery returns how many blocks and bloom bits sections a log query
+// would scan, along with an estimate of its cost, without running it.
+func (api *PublicDebugFilterAPI) EstimateLogsQuery(ctx context.Context, crit FilterCriteria) (*QueryPlan, error) {
+	return newCriteriaFilter(api.backend, crit).Plan(ctx)
+}
+
 // UninstallFilter removes the filter with the given filter id.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_uninstallfilter
@@ -357,6 +539,7 @@ func (api *PublicFilterAPI) UninstallFilter(id rpc.ID) bool {
 	f, found := api.filters[id]
 	if found {
 		delete(api.filters, id)
+		api.forgetFilter(id)
 	}
 	api.filtersMu.Unlock()
 	if found {
@@ -421,16 +604,29 @@ func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 			// receive timer value and reset timer
 			<-f.deadline.C
 		}
-		f.deadline.Reset(deadline)
+		f.deadline.Reset(api.timeout)
+		f.polled = time.Now()
 
 		switch f.typ {
-		case PendingTransactionsSubscription, BlocksSubscription:
+		case PendingTransactionsSubscription:
 			hashes := f.hashes
 			f.hashes = nil
 			return returnHashes(hashes), nil
+		case BlocksSubscription:
+			hashes := f.hashes
+			f.hashes = nil
+			if len(hashes) > 0 {
+				f.delivered = f.last
+			}
+			api.advanceFilter(id, f)
+			return returnHashes(hashes), nil
 		case LogsSubscription, MinedAndPendingLogsSubscription:
 			logs := f.logs
 			f.logs = nil
+			if len(logs) > 0 && logs[len(logs)-1].BlockNumber > f.delivered {
+				f.delivered = logs[len(logs)-1].BlockNumber
+			}
+			api.advanceFilter(id, f)
 			return returnLogs(logs), nil
 		}
 	}
@@ -438,6 +634,59 @@ func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 	return []interface{}{}, fmt.Errorf("filter not found")
 }
 
+// advanceFilter moves the position of a polled filter forward and persists it.
+// The changes of the head seen by the previous poll are assumed delivered by now.
+func (api *PublicFilterAPI) advanceFilter(id rpc.ID, f *filter) {
+	if f.delivered > f.position {
+		f.position = f.delivered
+	}
+	if f.pollHead > f.position {
+		f.position = f.pollHead
+	}
+	f.pollHead = api.headNumber()
+	api.persistFilter(id, f)
+}
+
+// FilterInfo describes an installed filter polled via eth_getFilterChanges.
+type FilterInfo struct {
+	ID         rpc.ID         `json:"id"`
+	Type       string         `json:"type"` // "logs", "blocks" or "pendingTransactions"
+	Created    time.Time      `json:"created"`
+	LastPolled time.Time      `json:"lastPolled"`
+	Expires    time.Time      `json:"expires"`
+	Position   hexutil.Uint64 `json:"position"`   // Last block whose changes were surely polled
+	Pending    int            `json:"pending"`    // Number of changes waiting to be polled
+	Persistent bool           `json:"persistent"` // Whether the filter survives restarts
+}
+
+// GetFilterInfo returns the state of the filter with the given id.
+func (api *PublicFilterAPI) GetFilterInfo(id rpc.ID) (*FilterInfo, error) {
+	api.filtersMu.Lock()
+	defer api.filtersMu.Unlock()
+
+	f, found := api.filters[id]
+	if !found {
+		return nil, fmt.Errorf("filter not found")
+	}
+	info := &FilterInfo{
+		ID:         id,
+		Created:    f.created,
+		LastPolled: f.polled,
+		Expires:    f.polled.Add(api.timeout),
+		Position:   hexutil.Uint64(f.position),
+		Persistent: api.persist && isPersistable(f.typ),
+	}
+	switch f.typ {
+	case PendingTransactionsSubscription:
+		info.Type, info.Pending = "pendingTransactions", len(f.hashes)
+	case BlocksSubscription:
+		info.Type, info.Pending = "blocks", len(f.hashes)
+	default:
+		info.Type, info.Pending = "logs", len(f.logs)
+	}
+	return info, nil
+}
+
 // returnHashes is a helper that will return an empty hash array case the given hash array is nil,
 // otherwise the given hashes array is returned.
 func returnHashes(hashes []common.Hash) []common.Hash {
@@ -456,6 +705,18 @@ func returnLogs(logs []*types.Log) []*types.Log {
 	return logs
 }
 
+// OldestBlock returns the oldest block the logs are queried from, for the RPC
+// scheduler to tell the log queries deep into the history.
+func (args FilterCriteria) OldestBlock() rpc.BlockNumberOrHash {
+	if args.BlockHash != nil {
+		return rpc.BlockNumberOrHashWithHash(*args.BlockHash, false)
+	}
+	if args.FromBlock == nil || !args.FromBlock.IsInt64() {
+		return rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	}
+	return rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(args.FromBlock.Int64()))
+}
+
 // UnmarshalJSON sets *args fields with given data.
 func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
 	type input struct {
@@ -19,6 +19,7 @@ package filters
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -183,3 +184,28 @@ func TestUnmarshalJSONNewFilterArgs(t *testing.T) {
 		t.Fatalf("expected 0 topics, got %d topics", len(test7.Topics[2]))
 	}
 }
+
+// Tests that the oldest block of the filter criteria is reported for the RPC
+// scheduler to classify log queries.
+func TestFilterCriteriaOldestBlock(t *testing.T) {
+	hash := common.HexToHash("0x01")
+	tests := []struct {
+		json string
+		want rpc.BlockNumberOrHash
+	}{
+		{`{}`, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)},
+		{`{"fromBlock":"earliest"}`, rpc.BlockNumberOrHashWithNumber(0)},
+		{`{"fromBlock":"0x10","toBlock":"latest"}`, rpc.BlockNumberOrHashWithNumber(0x10)},
+		{`{"fromBlock":"pending"}`, rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)},
+		{fmt.Sprintf(`{"blockHash":"%s"}`, hash.Hex()), rpc.BlockNumberOrHashWithHash(hash, false)},
+	}
+	for _, tt := range tests {
+		var crit FilterCriteria
+		if err := json.Unmarshal([]byte(tt.json), &crit); err != nil {
+			t.Fatalf("%s: failed to decode criteria: %v", tt.json, err)
+		}
+		if have := crit.OldestBlock(); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: oldest block mismatch: have %v, want %v", tt.json, have, tt.want)
+		}
+	}
+}
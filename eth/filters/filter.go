@@ -19,17 +19,30 @@ package filters
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// logSegmentBlocks is the number of blocks of the segments large log queries
+// are split into to be filtered in parallel, a multiple of the bloom sections.
+var logSegmentBlocks = 8 * vars.BloomBitsBlocks
+
+// logSegmentWorkers is the maximum number of segments of a query filtered at
+// the same time.
+var logSegmentWorkers = runtime.NumCPU()
+
 type Backend interface {
 	ChainDb() ethdb.Database
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
@@ -45,6 +58,8 @@ type Backend interface {
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
+
+	RPCLogsRangeCap() uint64
 }
 
 // Filter can be used to retrieve and filter logs.
@@ -129,19 +144,24 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		return f.blockLogs(ctx, header)
 	}
 	// Figure out the limits of the filter range
-	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
-	if header == nil {
+	begin, end, ok := f.bounds(ctx)
+	if !ok {
 		return nil, nil
 	}
-	head := header.Number.Uint64()
+	f.begin = int64(begin)
 
-	if f.begin == -1 {
-		f.begin = int64(head)
+	if limit := f.backend.RPCLogsRangeCap(); limit > 0 && end >= begin && end-begin >= limit {
+		return nil, fmt.Errorf("query spans %d blocks, more than the limit of %d", end-begin+1, limit)
 	}
-	end := uint64(f.end)
-	if f.end == -1 {
-		end = head
+	if end >= begin && end-begin >= logSegmentBlocks {
+		return f.segmentedLogs(ctx, begin, end)
 	}
+	return f.rangeLogs(ctx, end)
+}
+
+// rangeLogs returns the logs matching the filter criteria from the start of the
+// filter up to the given block.
+func (f *Filter) rangeLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
 	// Gather all indexed logs, and finish with non indexed ones
 	var (
 		logs []*types.Log
@@ -163,6 +183,167 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	return logs, err
 }
 
+// segmentedLogs splits the given range into segments aligned to the bloom
+// sections, filtering them in parallel with their own matchers, and merges
+// their logs in order. If a segment fails, the logs of the segments before it
+// are returned along with the error.
+func (f *Filter) segmentedLogs(ctx context.Context, begin, end uint64) ([]*types.Log, error) {
+	type segment struct {
+		begin, end uint64
+		logs       []*types.Log
+		err        error
+	}
+	var segments []*segment
+	for first := begin; first <= end; {
+		last := (first/logSegmentBlocks+1)*logSegmentBlocks - 1
+		if last > end {
+			last = end
+		}
+		segments = append(segments, &segment{begin: first, end: last})
+		first = last + 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		tasks   = make(chan *segment, len(segments))
+		workers = logSegmentWorkers
+		wg      sync.WaitGroup
+		failure error // First error of a segment, cancelling the others
+		lock    sync.Mutex
+	)
+	for _, s := range segments {
+		tasks <- s
+	}
+	close(tasks)
+	if workers > len(segments) {
+		workers = len(segments)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range tasks {
+				if ctx.Err() != nil {
+					s.err = ctx.Err()
+					continue
+				}
+				filter := NewRangeFilter(f.backend, int64(s.begin), int64(s.end), f.addresses, f.topics)
+				if s.logs, s.err = filter.rangeLogs(ctx, s.end); s.err != nil {
+					lock.Lock()
+					if failure == nil {
+						failure = s.err
+					}
+					lock.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var logs []*types.Log
+	for _, s := range segments {
+		if s.err != nil {
+			f.begin = int64(s.begin)
+			if failure != nil {
+				return logs, failure
+			}
+			return logs, s.err
+		}
+		logs = append(logs, s.logs...)
+	}
+	f.begin = int64(end) + 1
+	return logs, nil
+}
+
+// bounds resolves the range of the filter against the current head of the chain,
+// returning false if it's unknown.
+func (f *Filter) bounds(ctx context.Context) (uint64, uint64, bool) {
+	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil {
+		return 0, 0, false
+	}
+	head := header.Number.Uint64()
+
+	begin, end := uint64(f.begin), uint64(f.end)
+	if f.begin == -1 {
+		begin = head
+	}
+	if f.end == -1 {
+		end = head
+	}
+	return begin, end, true
+}
+
+// QueryPlan describes the work needed to run a log query, estimated without
+// running it.
+type QueryPlan struct {
+	FromBlock       hexutil.Uint64 `json:"fromBlock"`
+	ToBlock         hexutil.Uint64 `json:"toBlock"`
+	Blocks          hexutil.Uint64 `json:"blocks"`          // Number of blocks in the range
+	IndexedBlocks   hexutil.Uint64 `json:"indexedBlocks"`   // Blocks filtered via the bloom bits index
+	Sections        hexutil.Uint64 `json:"sections"`        // Bloom bits sections scanned
+	UnindexedBlocks hexutil.Uint64 `json:"unindexedBlocks"` // Blocks filtered by their header blooms
+	EstimatedReads  hexutil.Uint64 `json:"estimatedReads"`  // Database reads, excluding the receipts of matching blocks
+	RangeCap        hexutil.Uint64 `json:"rangeCap"`        // Max number of blocks of a query, 0 if unlimited
+	ExceedsCap      bool           `json:"exceedsCap"`      // Whether the query would be rejected
+}
+
+// Plan estimates the work needed to retrieve the logs of the filter.
+func (f *Filter) Plan(ctx context.Context) (*QueryPlan, error) {
+	plan := &QueryPlan{RangeCap: hexutil.Uint64(f.backend.RPCLogsRangeCap())}
+
+	// Singleton block filters only need the receipts of the block
+	if f.block != (common.Hash{}) {
+		header, err := f.backend.HeaderByHash(ctx, f.block)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errors.New("unknown block")
+		}
+		number := hexutil.Uint64(header.Number.Uint64())
+		plan.FromBlock, plan.ToBlock, plan.Blocks, plan.UnindexedBlocks, plan.EstimatedReads = number, number, 1, 1, 1
+		return plan, nil
+	}
+	begin, end, ok := f.bounds(ctx)
+	if !ok {
+		return nil, errors.New("unknown chain head")
+	}
+	plan.FromBlock, plan.ToBlock = hexutil.Uint64(begin), hexutil.Uint64(end)
+	if end < begin {
+		return plan, nil
+	}
+	plan.Blocks = hexutil.Uint64(end - begin + 1)
+	plan.ExceedsCap = plan.RangeCap > 0 && plan.Blocks > plan.RangeCap
+
+	size, sections := f.backend.BloomStatus()
+	if indexed := sections * size; indexed > begin {
+		last := end
+		if indexed <= end {
+			last = indexed - 1
+		}
+		plan.IndexedBlocks = hexutil.Uint64(last - begin + 1)
+		plan.Sections = hexutil.Uint64(last/size - begin/size + 1)
+	}
+	plan.UnindexedBlocks = plan.Blocks - plan.IndexedBlocks
+
+	// Every address and topic is matched via three bloom bits, each retrieved once
+	// per section. Unindexed blocks are matched by their headers.
+	var bits uint64
+	bits += 3 * uint64(len(f.addresses))
+	for _, topics := range f.topics {
+		bits += 3 * uint64(len(topics))
+	}
+	plan.EstimatedReads = plan.Sections*hexutil.Uint64(bits) + plan.UnindexedBlocks
+	if bits == 0 {
+		// Without criteria, all the blocks match
+		plan.EstimatedReads += plan.IndexedBlocks
+	}
+	return plan, nil
+}
+
 // indexedLogs returns the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
 func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
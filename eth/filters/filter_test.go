@@ -223,3 +223,103 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+func TestFilterRangeCapAndPlan(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db, rangeCap: 10}
+		addr    = common.BytesToAddress([]byte("jeff"))
+		topic   = common.BytesToHash([]byte("topic"))
+	)
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 100, func(i int, gen *core.BlockGen) {})
+	for _, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+	}
+	// Queries spanning more blocks than the cap are rejected
+	if _, err := NewRangeFilter(backend, 0, -1, []common.Address{addr}, nil).Logs(context.Background()); err == nil {
+		t.Fatalf("query exceeding the range cap accepted")
+	}
+	if _, err := NewRangeFilter(backend, 91, -1, []common.Address{addr}, nil).Logs(context.Background()); err != nil {
+		t.Fatalf("query within the range cap rejected: %v", err)
+	}
+	// Plans report the scanned blocks, without running the query
+	plan, err := NewRangeFilter(backend, 1, -1, []common.Address{addr}, [][]common.Hash{{topic}}).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("failed to plan query: %v", err)
+	}
+	want := QueryPlan{FromBlock: 1, ToBlock: 100, Blocks: 100, UnindexedBlocks: 100, EstimatedReads: 100, RangeCap: 10, ExceedsCap: true}
+	if *plan != want {
+		t.Fatalf("plan mismatch: have %+v, want %+v", *plan, want)
+	}
+	backend.sections = 1
+	if plan, err = NewRangeFilter(backend, 1, -1, []common.Address{addr}, [][]common.Hash{{topic}}).Plan(context.Background()); err != nil {
+		t.Fatalf("failed to plan query: %v", err)
+	}
+	want = QueryPlan{FromBlock: 1, ToBlock: 100, Blocks: 100, IndexedBlocks: 100, Sections: 1, EstimatedReads: 6, RangeCap: 10, ExceedsCap: true}
+	if *plan != want {
+		t.Fatalf("plan mismatch: have %+v, want %+v", *plan, want)
+	}
+	if plan, err = NewBlockFilter(backend, chain[4].Hash(), nil, nil).Plan(context.Background()); err != nil {
+		t.Fatalf("failed to plan query: %v", err)
+	}
+	want = QueryPlan{FromBlock: 5, ToBlock: 5, Blocks: 1, UnindexedBlocks: 1, EstimatedReads: 1, RangeCap: 10}
+	if *plan != want {
+		t.Fatalf("plan mismatch: have %+v, want %+v", *plan, want)
+	}
+}
+
+// Tests that large queries split into segments filtered in parallel return the
+// same logs, in order, as sequential ones.
+func TestSegmentedLogs(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		addr    = common.BytesToAddress([]byte("jeff"))
+		topic   = common.BytesToHash([]byte("topic"))
+	)
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 500, func(i int, gen *core.BlockGen) {
+		if i%7 == 0 {
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{topic}}}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.HexToAddress("0x1"), big.NewInt(1), 1, big.NewInt(1), nil))
+		}
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	want, err := NewRangeFilter(backend, 3, -1, []common.Address{addr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("sequential query failed: %v", err)
+	}
+	defer func(blocks uint64, workers int) {
+		logSegmentBlocks, logSegmentWorkers = blocks, workers
+	}(logSegmentBlocks, logSegmentWorkers)
+	logSegmentBlocks, logSegmentWorkers = 32, 4
+
+	have, err := NewRangeFilter(backend, 3, -1, []common.Address{addr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("segmented query failed: %v", err)
+	}
+	if len(have) != len(want) || len(want) != 71 {
+		t.Fatalf("log count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i].BlockNumber != want[i].BlockNumber || have[i].TxHash != want[i].TxHash {
+			t.Fatalf("log %d mismatch: have block %d, want %d", i, have[i].BlockNumber, want[i].BlockNumber)
+		}
+	}
+	// Cancelled queries fail
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewRangeFilter(backend, 3, -1, []common.Address{addr}, nil).Logs(ctx); err == nil {
+		t.Fatal("cancelled query succeeded")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Config contains the settings of the filters polled via eth_getFilterChanges
+// and of the resumed subscriptions.
+type Config struct {
+	Timeout time.Duration // Time after which the filters not polled are uninstalled
+	Persist bool          // Whether to persist the log and block filters across restarts
+
+	ResumeWindow uint64 // Maximum number of blocks replayed to resumed subscriptions
+}
+
+// DefaultConfig contains the default settings of the filters.
+var DefaultConfig = Config{
+	Timeout:      5 * time.Minute,
+	ResumeWindow: 1024,
+}
+
+// storedFilter is a log or block filter persisted across restarts.
+type storedFilter struct {
+	Type      Type                 `json:"type"`
+	Criteria  ethereum.FilterQuery `json:"criteria"`
+	Created   time.Time            `json:"created"`
+	Polled    time.Time            `json:"polled"`
+	Delivered uint64               `json:"delivered"`
+	Position  uint64               `json:"position"`
+}
+
+// isPersistable reports whether filters of the given type survive restarts.
+// Pending transactions come and go with the pool, so their filters don't.
+func isPersistable(typ Type) bool {
+	return typ == LogsSubscription || typ == BlocksSubscription
+}
+
+// persistFilter stores the filter with the given id if persistence is enabled.
+func (api *PublicFilterAPI) persistFilter(id rpc.ID, f *filter) {
+	if !api.persist || !isPersistable(f.typ) {
+		return
+	}
+	enc, err := json.Marshal(&storedFilter{
+		Type:      f.typ,
+		Criteria:  ethereum.FilterQuery(f.crit),
+		Created:   f.created,
+		Polled:    f.polled,
+		Delivered: f.delivered,
+		Position:  f.position,
+	})
+	if err != nil {
+		log.Error("Failed to encode filter", "id", id, "err", err)
+		return
+	}
+	rawdb.WriteInstalledFilter(api.chainDb, string(id), enc)
+}
+
+// forgetFilter removes the uninstalled filter with the given id from the
+// database if persistence is enabled.
+func (api *PublicFilterAPI) forgetFilter(id rpc.ID) {
+	if api.persist {
+		rawdb.DeleteInstalledFilter(api.chainDb, string(id))
+	}
+}
+
+// restoreFilters reinstalls the persisted filters not expired yet under their
+// original ids, with the changes since their position waiting to be polled.
+func (api *PublicFilterAPI) restoreFilters() {
+	api.filtersMu.Lock()
+	defer api.filtersMu.Unlock()
+
+	head := api.headNumber()
+	for key, enc := range rawdb.ReadInstalledFilters(api.chainDb) {
+		id := rpc.ID(key)
+
+		var stored storedFilter
+		if err := json.Unmarshal(enc, &stored); err != nil {
+			log.Warn("Dropping invalid persisted filter", "id", id, "err", err)
+			rawdb.DeleteInstalledFilter(api.chainDb, key)
+			continue
+		}
+		idle := time.Since(stored.Polled)
+		if idle >= api.timeout || !isPersistable(stored.Type) {
+			rawdb.DeleteInstalledFilter(api.chainDb, key)
+			continue
+		}
+		// The changes up to the current head are retrieved right away
+		f := &filter{
+			typ:       stored.Type,
+			crit:      FilterCriteria(stored.Criteria),
+			deadline:  time.NewTimer(api.timeout - idle),
+			created:   stored.Created,
+			polled:    stored.Polled,
+			delivered: stored.Delivered,
+			pollHead:  head,
+			position:  stored.Position,
+		}
+		switch stored.Type {
+		case BlocksSubscription:
+			headers := make(chan *types.Header)
+			f.s = api.events.SubscribeNewHeads(headers)
+			f.hashes, f.last = api.missedHashes(f, head)
+			api.filters[id] = f
+			go api.trackHeaders(id, headers, f.s)
+
+		case LogsSubscription:
+			logs := make(chan []*types.Log)
+			sub, err := api.events.SubscribeLogs(stored.Criteria, logs)
+			if err != nil {
+				log.Warn("Dropping persisted filter", "id", id, "err", err)
+				rawdb.DeleteInstalledFilter(api.chainDb, key)
+				continue
+			}
+			f.s = sub
+			f.logs = api.missedLogs(f, head)
+			api.filters[id] = f
+			go api.trackLogs(id, logs, f.s)
+		}
+		log.Debug("Restored persisted filter", "id", id, "type", stored.Type, "position", stored.Position)
+	}
+}
+
+// missedHashes returns the hashes of the blocks imported after the position of
+// a block filter, skipping already delivered ones, and the number of the last.
+func (api *PublicFilterAPI) missedHashes(f *filter, head uint64) ([]common.Hash, uint64) {
+	hashes, last := make([]common.Hash, 0), f.last
+	for number := f.position + 1; number <= head; number++ {
+		if number <= f.delivered {
+			continue
+		}
+		header, _ := api.backend.HeaderByNumber(context.Background(), rpc.BlockNumber(number))
+		if header == nil {
+			break
+		}
+		hashes, last = append(hashes, header.Hash()), number
+	}
+	return hashes, last
+}
+
+// missedLogs returns the logs matching a log filter in the blocks imported after
+// its position, skipping the already delivered ones.
+func (api *PublicFilterAPI) missedLogs(f *filter, head uint64) []*types.Log {
+	logs := make([]*types.Log, 0)
+	if f.crit.BlockHash != nil {
+		return logs
+	}
+	begin, end, ok := criteriaRange(f.crit, f.position+1, head)
+	if !ok {
+		return logs
+	}
+	found, err := NewRangeFilter(api.backend, int64(begin), int64(end), f.crit.Addresses, f.crit.Topics).Logs(context.Background())
+	if err != nil {
+		log.Warn("Failed to retrieve the logs missed by a persisted filter", "from", begin, "to", end, "err", err)
+	}
+	for _, l := range found {
+		if l.BlockNumber > f.delivered {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that persisted filters are restored under their ids after a restart,
+// with the changes imported meanwhile waiting to be polled.
+func TestFilterPersistence(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		config  = Config{Timeout: time.Minute, Persist: true}
+		addr    = common.BytesToAddress([]byte("jeff"))
+	)
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {
+		if i == 6 || i == 2 {
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{{byte(i)}}}}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.HexToAddress("0x1"), big.NewInt(1), 1, big.NewInt(1), nil))
+		}
+	})
+	insert := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			rawdb.WriteBlock(db, block)
+			rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			rawdb.WriteHeadBlockHash(db, block.Hash())
+			rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[block.NumberU64()-1])
+		}
+	}
+	insert(chain[:4])
+
+	api := NewPublicFilterAPIWithConfig(backend, false, config)
+	blockID := api.NewBlockFilter()
+	logID, err := api.NewFilter(FilterCriteria{Addresses: []common.Address{addr}})
+	if err != nil {
+		t.Fatalf("failed to install log filter: %v", err)
+	}
+	pendingID := api.NewPendingTransactionFilter()
+
+	// Restart after importing more blocks
+	insert(chain[4:])
+	api = NewPublicFilterAPIWithConfig(backend, false, config)
+
+	hashes, err := api.GetFilterChanges(blockID)
+	if err != nil {
+		t.Fatalf("block filter not restored: %v", err)
+	}
+	if have := hashes.([]common.Hash); len(have) != 6 || have[0] != chain[4].Hash() || have[5] != chain[9].Hash() {
+		t.Fatalf("missed block hashes mismatch: have %d hashes", len(have))
+	}
+	logs, err := api.GetFilterChanges(logID)
+	if err != nil {
+		t.Fatalf("log filter not restored: %v", err)
+	}
+	if have := logs.([]*types.Log); len(have) != 1 || have[0].BlockNumber != 7 {
+		t.Fatalf("missed logs mismatch: have %v", have)
+	}
+	if _, err := api.GetFilterChanges(pendingID); err == nil {
+		t.Fatal("pending transaction filter restored")
+	}
+	info, err := api.GetFilterInfo(logID)
+	if err != nil {
+		t.Fatalf("failed to retrieve filter info: %v", err)
+	}
+	if info.Type != "logs" || !info.Persistent || info.Position != 10 {
+		t.Fatalf("filter info mismatch: %+v", info)
+	}
+	// Uninstalled filters are forgotten
+	api.UninstallFilter(blockID)
+	if stored := rawdb.ReadInstalledFilters(db); len(stored) != 1 {
+		t.Fatalf("persisted filters mismatch: have %d, want 1", len(stored))
+	}
+	// Filters expiring while the node was down are dropped
+	time.Sleep(10 * time.Millisecond)
+	api = NewPublicFilterAPIWithConfig(backend, false, Config{Timeout: 5 * time.Millisecond, Persist: true})
+	if _, err := api.GetFilterInfo(logID); err == nil {
+		t.Fatal("expired filter restored")
+	}
+	if stored := rawdb.ReadInstalledFilters(db); len(stored) != 0 {
+		t.Fatalf("expired filter still persisted")
+	}
+}
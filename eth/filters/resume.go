@@ -0,0 +1,181 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errUnknownCursor = errors.New("unknown cursor block")
+
+// Cursor is the position of the last event received by a subscriber, presented
+// when resubscribing to have the events missed in the meantime replayed before
+// the new ones. The block hash is optional and allows detecting the cursor
+// block was reorged out, the log index only applies to log subscriptions and
+// marks the cursor block as partially received.
+type Cursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   *common.Hash   `json:"blockHash,omitempty"`
+	LogIndex    *hexutil.Uint  `json:"logIndex,omitempty"`
+}
+
+// resumePoint is a cursor resolved against the canonical chain.
+type resumePoint struct {
+	cursor   *Cursor
+	orphaned []*types.Header // Blocks up to the cursor reorged out of the chain, newest first
+	begin    uint64          // First canonical block to replay
+}
+
+// resolveCursor resolves the cursor of a resumed subscription, walking back to
+// the canonical chain if the cursor block was reorged out. Cursors further away
+// from the head than the resume window are rejected, the subscriber having to
+// catch up through regular queries instead.
+func (api *PublicFilterAPI) resolveCursor(ctx context.Context, cursor *Cursor) (*resumePoint, error) {
+	var (
+		point  = &resumePoint{cursor: cursor}
+		number = uint64(cursor.BlockNumber)
+	)
+	if cursor.BlockHash != nil {
+		header, _ := api.backend.HeaderByHash(ctx, *cursor.BlockHash)
+		if header == nil {
+			return nil, errUnknownCursor
+		}
+		if header.Number.Uint64() != number {
+			return nil, fmt.Errorf("cursor block %x is #%d, not #%d", *cursor.BlockHash, header.Number, number)
+		}
+		for {
+			canon, _ := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+			if canon != nil && canon.Hash() == header.Hash() {
+				break
+			}
+			if uint64(len(point.orphaned)) >= api.resumeWindow {
+				return nil, fmt.Errorf("cursor reorged beyond the resume window of %d blocks", api.resumeWindow)
+			}
+			point.orphaned = append(point.orphaned, header)
+			if header, _ = api.backend.HeaderByHash(ctx, header.ParentHash); header == nil {
+				return nil, errUnknownCursor
+			}
+		}
+	}
+	switch {
+	case len(point.orphaned) > 0:
+		point.begin = point.orphaned[len(point.orphaned)-1].Number.Uint64()
+	case cursor.LogIndex != nil:
+		point.begin = number
+	default:
+		point.begin = number + 1
+	}
+	if head := api.headNumber(); head >= point.begin && head-point.begin+1 > api.resumeWindow {
+		return nil, fmt.Errorf("cursor #%d is beyond the resume window of %d blocks", number, api.resumeWindow)
+	}
+	return point, nil
+}
+
+// replayHeaders returns the canonical headers from the resume point up to the
+// current head.
+func (api *PublicFilterAPI) replayHeaders(point *resumePoint) []*types.Header {
+	var headers []*types.Header
+	for number, head := point.begin, api.headNumber(); number <= head; number++ {
+		header, _ := api.backend.HeaderByNumber(context.Background(), rpc.BlockNumber(number))
+		if header == nil {
+			break
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// replayLogs returns the logs matching the criteria missed since the resume
+// point: the logs already received from reorged out blocks marked as removed,
+// and then the ones of the canonical blocks up to the current head.
+func (api *PublicFilterAPI) replayLogs(crit FilterCriteria, point *resumePoint) []*types.Log {
+	var logs []*types.Log
+	if crit.BlockHash != nil {
+		return logs
+	}
+	for i, header := range point.orphaned {
+		blockLogs, err := api.backend.GetLogs(context.Background(), header.Hash())
+		if err != nil {
+			log.Warn("Failed to retrieve the logs of a reorged block", "number", header.Number, "hash", header.Hash(), "err", err)
+			continue
+		}
+		var unfiltered []*types.Log
+		for _, txLogs := range blockLogs {
+			unfiltered = append(unfiltered, txLogs...)
+		}
+		matched := filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics)
+		for j := len(matched) - 1; j >= 0; j-- {
+			// Only the part of the cursor block up to the cursor was received
+			if i == 0 && point.cursor.LogIndex != nil && matched[j].Index > uint(*point.cursor.LogIndex) {
+				continue
+			}
+			removed := *matched[j]
+			removed.Removed = true
+			logs = append(logs, &removed)
+		}
+	}
+	begin, end, ok := criteriaRange(crit, point.begin, api.headNumber())
+	if !ok {
+		return logs
+	}
+	found, err := NewRangeFilter(api.backend, int64(begin), int64(end), crit.Addresses, crit.Topics).Logs(context.Background())
+	if err != nil {
+		log.Warn("Failed to retrieve the logs missed by a resumed subscription", "from", begin, "to", end, "err", err)
+	}
+	for _, l := range found {
+		if len(point.orphaned) == 0 && point.cursor.LogIndex != nil &&
+			l.BlockNumber == uint64(point.cursor.BlockNumber) && l.Index <= uint(*point.cursor.LogIndex) {
+			continue
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+// criteriaRange restricts a range of blocks to the one of the criteria, if any,
+// reporting whether anything is left.
+func criteriaRange(crit FilterCriteria, begin, end uint64) (uint64, uint64, bool) {
+	if crit.FromBlock != nil {
+		from := crit.FromBlock.Int64()
+		if from == rpc.PendingBlockNumber.Int64() {
+			return 0, 0, false
+		}
+		if from >= 0 && uint64(from) > begin {
+			begin = uint64(from)
+		}
+	}
+	if crit.ToBlock != nil {
+		if to := crit.ToBlock.Int64(); to >= 0 && uint64(to) < end {
+			end = uint64(to)
+		}
+	}
+	return begin, end, begin <= end
+}
+
+// logKey identifies a log within the chain.
+type logKey struct {
+	block common.Hash
+	index uint
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that subscriptions resumed from a cursor receive the events missed
+// since, once, before the new ones.
+func TestResumeSubscriptions(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		addr    = common.BytesToAddress([]byte("jeff"))
+	)
+	addLogs := func(topic byte) func(i int, gen *core.BlockGen) {
+		return func(i int, gen *core.BlockGen) {
+			if i == 6 || i == 2 || i == 1 {
+				receipt := types.NewReceipt(nil, false, 0)
+				receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{{topic, byte(i)}}}}
+				gen.AddUncheckedReceipt(receipt)
+				gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.HexToAddress("0x1"), big.NewInt(1), 1, big.NewInt(1), nil))
+			}
+		}
+	}
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 11, addLogs(0))
+	fork, forkReceipts := core.GenerateChain(params.TestChainConfig, chain[4], ethash.NewFaker(), db, 3, addLogs(1))
+
+	write := func(block *types.Block, receipts types.Receipts, canonical bool) {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts)
+		if canonical {
+			rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			rawdb.WriteHeadBlockHash(db, block.Hash())
+		}
+	}
+	for i, block := range fork {
+		write(block, forkReceipts[i], false)
+	}
+	for i, block := range chain[:10] {
+		write(block, receipts[i], true)
+	}
+	api := NewPublicFilterAPIWithConfig(backend, false, Config{ResumeWindow: 9})
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Headers are replayed from the block following the cursor, the ones sent
+	// live meanwhile only once
+	headers := make(chan *types.Header, 16)
+	sub, err := client.EthSubscribe(context.Background(), headers, "newHeads", &Cursor{BlockNumber: 5})
+	if err != nil {
+		t.Fatalf("failed to resume newHeads: %v", err)
+	}
+	write(chain[10], receipts[10], true)
+	backend.chainFeed.Send(core.ChainEvent{Block: chain[9], Hash: chain[9].Hash()})
+	backend.chainFeed.Send(core.ChainEvent{Block: chain[10], Hash: chain[10].Hash()})
+
+	for number := uint64(6); number <= 11; number++ {
+		select {
+		case h := <-headers:
+			if h.Number.Uint64() != number || h.Hash() != chain[number-1].Hash() {
+				t.Fatalf("header mismatch: have #%d, want #%d", h.Number, number)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("header #%d not received", number)
+		}
+	}
+	select {
+	case h := <-headers:
+		t.Fatalf("unexpected header #%d", h.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sub.Unsubscribe()
+
+	// Logs are replayed from the cursor position within its block
+	logs := make(chan types.Log, 16)
+	var (
+		index   = hexutil.Uint(0)
+		cursor  = chain[2].Hash()
+		reorged = fork[2].Hash()
+		unknown = common.Hash{1}
+	)
+	sub, err = client.EthSubscribe(context.Background(), logs, "logs", FilterCriteria{Addresses: []common.Address{addr}}, &Cursor{BlockNumber: 3, BlockHash: &cursor, LogIndex: &index})
+	if err != nil {
+		t.Fatalf("failed to resume logs: %v", err)
+	}
+	if l := <-logs; l.BlockNumber != 7 || l.Removed {
+		t.Fatalf("replayed log mismatch: have #%d, removed %v", l.BlockNumber, l.Removed)
+	}
+	sub.Unsubscribe()
+
+	// Logs received from reorged out blocks are removed first
+	sub, err = client.EthSubscribe(context.Background(), logs, "logs", FilterCriteria{Addresses: []common.Address{addr}}, &Cursor{BlockNumber: 8, BlockHash: &reorged})
+	if err != nil {
+		t.Fatalf("failed to resume logs from a reorged block: %v", err)
+	}
+	for _, block := range []*types.Block{fork[2], fork[1]} {
+		if l := <-logs; l.BlockHash != block.Hash() || !l.Removed {
+			t.Fatalf("removed log mismatch: have #%d [%x], removed %v", l.BlockNumber, l.BlockHash, l.Removed)
+		}
+	}
+	if l := <-logs; l.BlockHash != chain[6].Hash() || l.Removed {
+		t.Fatalf("replayed log mismatch: have #%d [%x], removed %v", l.BlockNumber, l.BlockHash, l.Removed)
+	}
+	sub.Unsubscribe()
+
+	// Cursors beyond the resume window or unknown are rejected
+	if _, err := client.EthSubscribe(context.Background(), headers, "newHeads", &Cursor{BlockNumber: 1}); err == nil {
+		t.Error("cursor beyond the resume window accepted")
+	}
+	if _, err := client.EthSubscribe(context.Background(), headers, "newHeads", &Cursor{BlockNumber: 9, BlockHash: &unknown}); err == nil {
+		t.Error("unknown cursor block accepted")
+	}
+}
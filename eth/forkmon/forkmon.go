@@ -0,0 +1,340 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package forkmon implements a monitor clustering the heads advertised by the
+// connected peers by the branch of the chain they are on, measuring the work
+// carried by each branch to give early warning of chain splits.
+package forkmon
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	branchesGauge       = metrics.NewRegisteredGauge("forkmon/branches", nil)
+	canonicalPeersGauge = metrics.NewRegisteredGauge("forkmon/peers/canonical", nil)
+	forkedPeersGauge    = metrics.NewRegisteredGauge("forkmon/peers/forked", nil)
+	invalidPeersGauge   = metrics.NewRegisteredGauge("forkmon/peers/invalid", nil)
+	unknownPeersGauge   = metrics.NewRegisteredGauge("forkmon/peers/unknown", nil)
+
+	// forkedWorkGauge is the work carried by the heaviest forked branch since its
+	// fork point, in percent of the work of the canonical chain since then.
+	forkedWorkGauge = metrics.NewRegisteredGauge("forkmon/work/forked", nil)
+)
+
+// Config are the configuration parameters of the fork monitor.
+type Config struct {
+	Enabled    bool          // Whether to monitor the branches advertised by the peers
+	Interval   time.Duration // Interval between two samplings of the peer heads
+	Depth      uint64        // Maximum number of blocks to trace a branch back to its fork point
+	WarnLength uint64        // Number of blocks of a forked branch beyond its fork point to warn about it
+}
+
+// DefaultConfig contains the default settings of the fork monitor.
+var DefaultConfig = Config{
+	Interval:   10 * time.Second,
+	Depth:      1024,
+	WarnLength: 3,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if conf.Interval < time.Second {
+		log.Warn("Sanitizing invalid fork monitor interval", "provided", conf.Interval, "updated", DefaultConfig.Interval)
+		conf.Interval = DefaultConfig.Interval
+	}
+	if conf.Depth < 1 {
+		log.Warn("Sanitizing invalid fork monitor depth", "provided", conf.Depth, "updated", DefaultConfig.Depth)
+		conf.Depth = DefaultConfig.Depth
+	}
+	return conf
+}
+
+// PeerHead is the head advertised by a connected peer.
+type PeerHead struct {
+	ID   string
+	Hash common.Hash
+	TD   *big.Int
+}
+
+// Backend wraps all methods required by the fork monitor.
+type Backend interface {
+	BlockChain() *core.BlockChain
+	PeerHeads() []PeerHead
+}
+
+// Branch is a branch of the chain advertised by at least one peer. The fork data
+// is only available for the branches whose blocks are known locally, the heads
+// unknown to the local node are listed on their own.
+type Branch struct {
+	Canonical     bool            `json:"canonical"`               // Whether the branch is the local canonical chain
+	Invalid       bool            `json:"invalid"`                 // Whether the local node rejected a block of the branch
+	Known         bool            `json:"known"`                   // Whether the head of the branch is known locally
+	Head          common.Hash     `json:"head"`                    // Heaviest head advertised on the branch
+	Number        *hexutil.Uint64 `json:"number,omitempty"`        // Number of the head, if known
+	TD            *hexutil.Big    `json:"totalDifficulty"`         // Total difficulty of the head
+	ForkPoint     *hexutil.Uint64 `json:"forkPoint,omitempty"`     // Number of the last canonical block of the branch
+	ForkHash      *common.Hash    `json:"forkHash,omitempty"`      // Hash of the last canonical block of the branch
+	Work          *hexutil.Big    `json:"work,omitempty"`          // Work carried by the branch since the fork point
+	CanonicalWork *hexutil.Big    `json:"canonicalWork,omitempty"` // Work carried by the canonical chain since the fork point
+	Hashrate      *hexutil.Big    `json:"hashrate,omitempty"`      // Work per second carried by the branch since the fork point
+	Peers         []string        `json:"peers"`
+}
+
+// View is the set of branches advertised by the peers at a point in time.
+type View struct {
+	Head     common.Hash    `json:"head"` // Local head
+	Number   hexutil.Uint64 `json:"number"`
+	TD       *hexutil.Big   `json:"totalDifficulty"`
+	Branches []*Branch      `json:"branches"` // Canonical first, then by descending total difficulty
+	Sampled  time.Time      `json:"sampled"`
+}
+
+// Monitor periodically clusters the heads advertised by the connected peers by
+// the branch of the chain they are on, reporting the branches in metrics and
+// warning about the long forked ones.
+type Monitor struct {
+	config  Config
+	backend Backend
+
+	warned map[common.Hash]struct{} // Branches already warned about, by fork hash
+	lock   sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a fork monitor on top of the given backend.
+func New(config Config, backend Backend) *Monitor {
+	return &Monitor{
+		config:  config.sanitize(),
+		backend: backend,
+		warned:  make(map[common.Hash]struct{}),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start launches the background loop of the monitor.
+func (m *Monitor) Start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// Stop terminates the background loop of the monitor.
+func (m *Monitor) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+func (m *Monitor) loop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.report(m.View())
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// report updates the metrics from the given view and warns about the forked
+// branches longer than the configured length, once per branch.
+func (m *Monitor) report(view *View) {
+	var canonical, forked, invalid, unknown, ratio int64
+	for _, branch := range view.Branches {
+		switch {
+		case branch.Canonical:
+			canonical += int64(len(branch.Peers))
+		case !branch.Known:
+			unknown += int64(len(branch.Peers))
+		case branch.Invalid:
+			invalid += int64(len(branch.Peers))
+		default:
+			forked += int64(len(branch.Peers))
+		}
+		if branch.Canonical || branch.Work == nil || branch.CanonicalWork == nil || branch.CanonicalWork.ToInt().Sign() == 0 {
+			continue
+		}
+		percent := new(big.Int).Mul(branch.Work.ToInt(), big.NewInt(100))
+		if percent.Div(percent, branch.CanonicalWork.ToInt()); percent.IsInt64() && percent.Int64() > ratio {
+			ratio = percent.Int64()
+		}
+	}
+	branchesGauge.Update(int64(len(view.Branches)))
+	canonicalPeersGauge.Update(canonical)
+	forkedPeersGauge.Update(forked)
+	invalidPeersGauge.Update(invalid)
+	unknownPeersGauge.Update(unknown)
+	forkedWorkGauge.Update(ratio)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, branch := range view.Branches {
+		if branch.Canonical || branch.ForkHash == nil || branch.Number == nil || uint64(*branch.Number)-uint64(*branch.ForkPoint) < m.config.WarnLength {
+			continue
+		}
+		if _, ok := m.warned[*branch.ForkHash]; ok {
+			continue
+		}
+		m.warned[*branch.ForkHash] = struct{}{}
+		log.Warn("Peers on a forked branch", "forkpoint", uint64(*branch.ForkPoint), "head", uint64(*branch.Number), "hash", branch.Head,
+			"invalid", branch.Invalid, "peers", len(branch.Peers), "work", branch.Work, "canonical", branch.CanonicalWork)
+	}
+}
+
+// View clusters the heads currently advertised by the peers by branch.
+func (m *Monitor) View() *View {
+	chain := m.backend.BlockChain()
+	head := chain.CurrentHeader()
+
+	view := &View{
+		Head:    head.Hash(),
+		Number:  hexutil.Uint64(head.Number.Uint64()),
+		TD:      (*hexutil.Big)(chain.GetTd(head.Hash(), head.Number.Uint64())),
+		Sampled: time.Now(),
+	}
+	bad := make(map[common.Hash]*types.Header)
+	for _, block := range chain.BadBlocks() {
+		bad[block.Hash()] = block.Header()
+	}
+	var (
+		canonical = &Branch{Canonical: true, Known: true}
+		branches  = make(map[common.Hash]*Branch) // Forked and unknown branches by fork or head hash
+	)
+	for _, peer := range m.backend.PeerHeads() {
+		header, invalid := chain.GetHeaderByHash(peer.Hash), false
+		if header == nil {
+			header, invalid = bad[peer.Hash], true
+		}
+		if header == nil {
+			branch := branches[peer.Hash]
+			if branch == nil {
+				branch = &Branch{Head: peer.Hash, TD: (*hexutil.Big)(peer.TD)}
+				branches[peer.Hash] = branch
+			}
+			branch.Peers = append(branch.Peers, peer.ID)
+			continue
+		}
+		if !invalid && chain.GetCanonicalHash(header.Number.Uint64()) == peer.Hash {
+			if canonical.Number == nil || uint64(*canonical.Number) < header.Number.Uint64() {
+				canonical.Head, canonical.Number = peer.Hash, numberOf(header)
+				canonical.TD = (*hexutil.Big)(chain.GetTd(peer.Hash, header.Number.Uint64()))
+			}
+			canonical.Peers = append(canonical.Peers, peer.ID)
+			continue
+		}
+		fork := m.forkPoint(chain, header)
+		key := header.Hash()
+		if fork != nil {
+			key = fork.Hash()
+		}
+		branch := branches[key]
+		if branch == nil {
+			branch = &Branch{Known: true}
+			if fork != nil {
+				branch.ForkPoint, branch.ForkHash = numberOf(fork), &key
+			}
+			branches[key] = branch
+		}
+		branch.Invalid = branch.Invalid || invalid
+		branch.Peers = append(branch.Peers, peer.ID)
+
+		td := m.headTd(chain, header, invalid)
+		if td == nil || (branch.TD != nil && branch.TD.ToInt().Cmp(td) >= 0) {
+			continue
+		}
+		branch.Head, branch.Number, branch.TD = header.Hash(), numberOf(header), (*hexutil.Big)(td)
+		if fork != nil {
+			if forkTd := chain.GetTd(fork.Hash(), fork.Number.Uint64()); forkTd != nil {
+				work := new(big.Int).Sub(td, forkTd)
+				branch.Work = (*hexutil.Big)(work)
+				if view.TD != nil {
+					branch.CanonicalWork = (*hexutil.Big)(new(big.Int).Sub(view.TD.ToInt(), forkTd))
+				}
+				if elapsed := header.Time - fork.Time; elapsed > 0 {
+					branch.Hashrate = (*hexutil.Big)(new(big.Int).Div(work, new(big.Int).SetUint64(elapsed)))
+				}
+			}
+		}
+	}
+	if len(canonical.Peers) > 0 {
+		view.Branches = append(view.Branches, canonical)
+	}
+	others := make([]*Branch, 0, len(branches))
+	for _, branch := range branches {
+		others = append(others, branch)
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if others[i].TD == nil || others[j].TD == nil {
+			return others[j].TD == nil && others[i].TD != nil
+		}
+		return others[i].TD.ToInt().Cmp(others[j].TD.ToInt()) > 0
+	})
+	view.Branches = append(view.Branches, others...)
+	return view
+}
+
+// forkPoint traces a non-canonical header back to its last canonical ancestor,
+// nil if not found within the configured depth.
+func (m *Monitor) forkPoint(chain *core.BlockChain, header *types.Header) *types.Header {
+	for i := uint64(0); i < m.config.Depth && header.Number.Sign() > 0; i++ {
+		parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil
+		}
+		if chain.GetCanonicalHash(parent.Number.Uint64()) == parent.Hash() {
+			return parent
+		}
+		header = parent
+	}
+	return nil
+}
+
+// headTd retrieves the total difficulty of a head, deriving it from its parent
+// for the rejected blocks.
+func (m *Monitor) headTd(chain *core.BlockChain, header *types.Header, invalid bool) *big.Int {
+	if !invalid {
+		return chain.GetTd(header.Hash(), header.Number.Uint64())
+	}
+	td := chain.GetTd(header.ParentHash, header.Number.Uint64()-1)
+	if td == nil {
+		return nil
+	}
+	return new(big.Int).Add(td, header.Difficulty)
+}
+
+func numberOf(header *types.Header) *hexutil.Uint64 {
+	number := hexutil.Uint64(header.Number.Uint64())
+	return &number
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkmon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+type testBackend struct {
+	chain *core.BlockChain
+	heads []PeerHead
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain { return b.chain }
+func (b *testBackend) PeerHeads() []PeerHead        { return b.heads }
+
+// Tests that the peer heads are clustered by the branch they are on, with the
+// work carried by each branch since its fork point.
+func TestForkView(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	canon, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 11, nil)
+	side, _ := core.GenerateChain(gspec.Config, canon[4], ethash.NewFaker(), db, 3, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(canon[:10]); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	if _, err := chain.InsertChain(side); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	// Have the chain reject a block for a forged state root
+	header := canon[10].Header()
+	header.Root = common.Hash{0xba, 0xd}
+	bad := types.NewBlockWithHeader(header)
+	if _, err := chain.InsertChain(types.Blocks{bad}); err == nil {
+		t.Fatal("bad block accepted")
+	}
+	backend := &testBackend{chain: chain, heads: []PeerHead{
+		{ID: "canonical-head", Hash: canon[9].Hash(), TD: new(big.Int)},
+		{ID: "canonical-behind", Hash: canon[7].Hash(), TD: new(big.Int)},
+		{ID: "forked", Hash: side[2].Hash(), TD: new(big.Int)},
+		{ID: "invalid", Hash: bad.Hash(), TD: new(big.Int)},
+		{ID: "unknown", Hash: common.Hash{0xff}, TD: big.NewInt(1)},
+	}}
+	view := New(DefaultConfig, backend).View()
+	if view.Head != canon[9].Hash() || len(view.Branches) != 4 {
+		t.Fatalf("view mismatch: head %x, %d branches", view.Head, len(view.Branches))
+	}
+	branches := make(map[string]*Branch)
+	for _, branch := range view.Branches {
+		for _, peer := range branch.Peers {
+			branches[peer] = branch
+		}
+	}
+	if branch := branches["canonical-head"]; !branch.Canonical || branch.Head != canon[9].Hash() || len(branch.Peers) != 2 || branches["canonical-behind"] != branch {
+		t.Fatalf("canonical branch mismatch: %+v", branch)
+	}
+	tdOf := func(block *types.Block) *big.Int { return chain.GetTd(block.Hash(), block.NumberU64()) }
+
+	forked := branches["forked"]
+	if forked.Canonical || forked.Invalid || !forked.Known || forked.ForkHash == nil || *forked.ForkHash != canon[4].Hash() {
+		t.Fatalf("forked branch mismatch: %+v", forked)
+	}
+	if want := new(big.Int).Sub(tdOf(side[2]), tdOf(canon[4])); forked.Work.ToInt().Cmp(want) != 0 {
+		t.Fatalf("forked work mismatch: have %v, want %v", forked.Work, want)
+	}
+	if want := new(big.Int).Sub(tdOf(canon[9]), tdOf(canon[4])); forked.CanonicalWork.ToInt().Cmp(want) != 0 {
+		t.Fatalf("canonical work mismatch: have %v, want %v", forked.CanonicalWork, want)
+	}
+	invalid := branches["invalid"]
+	if !invalid.Invalid || invalid.ForkHash == nil || *invalid.ForkHash != canon[9].Hash() || invalid.Work.ToInt().Cmp(bad.Difficulty()) != 0 {
+		t.Fatalf("invalid branch mismatch: %+v", invalid)
+	}
+	if unknown := branches["unknown"]; unknown.Known || unknown.Number != nil || unknown.TD.ToInt().Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("unknown branch mismatch: %+v", unknown)
+	}
+}
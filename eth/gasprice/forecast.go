@@ -0,0 +1,180 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	forecastHistory   = 20 // Number of recent blocks sampled for a forecast
+	maxForecastBlocks = 64 // Maximum number of future blocks to forecast
+)
+
+// DefaultForecastPercentiles are the percentiles forecast if none are requested.
+var DefaultForecastPercentiles = []float64{10, 50, 90}
+
+// Forecast is the predicted gas prices needed for inclusion in the next blocks.
+type Forecast struct {
+	Head       uint64          // Number of the block the forecast is based on
+	GasLimit   uint64          // Gas limit of the head block, assumed for the next blocks
+	Fullness   float64         // Average gas used ratio of the recent blocks
+	GasUsed    []float64       // Gas used ratios of the recent blocks, oldest first
+	PendingGas uint64          // Gas of the executable transactions in the pool
+	Blocks     []ForecastBlock // Forecast for each of the next blocks
+}
+
+// ForecastBlock is the predicted gas prices needed for inclusion in one of the
+// next blocks, at the requested percentiles.
+type ForecastBlock struct {
+	Number uint64
+	Prices []*big.Int
+}
+
+// Forecast predicts the gas prices needed for inclusion in each of the given
+// number of next blocks, at the given percentiles of likelihood.
+//
+// On ETC blocks are rarely full and miners include the cheapest transactions
+// they accept, so the baseline is sampled from the cheapest transactions of the
+// recent blocks instead of their average price. The pending transactions only
+// raise the forecast of a block if the pool holds more gas paying better than
+// the baseline than fits into the blocks up to it.
+func (gpo *Oracle) Forecast(ctx context.Context, pending types.Transactions, blocks int, percentiles []float64) (*Forecast, error) {
+	if blocks < 1 || blocks > maxForecastBlocks {
+		return nil, fmt.Errorf("invalid number of blocks %d, want 1 to %d", blocks, maxForecastBlocks)
+	}
+	if len(percentiles) == 0 {
+		percentiles = DefaultForecastPercentiles
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %v", p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return nil, errors.New("percentiles must be ascending")
+		}
+	}
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil {
+		return nil, err
+	}
+	prices, ratios, err := gpo.sampleRecentBlocks(ctx, head.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	// Compute the baseline from the history, falling back to the last price
+	baseline := make([]*big.Int, len(percentiles))
+	for i, p := range percentiles {
+		if len(prices) == 0 {
+			gpo.cacheLock.RLock()
+			baseline[i] = gpo.lastPrice
+			gpo.cacheLock.RUnlock()
+			continue
+		}
+		baseline[i] = prices[int(float64(len(prices)-1)*p/100)]
+	}
+	// Rank the pending transactions by price to find the ones outbidding the
+	// rest for the capacity of each next block
+	txs := make(types.Transactions, len(pending))
+	copy(txs, pending)
+	sort.Sort(sort.Reverse(transactionsByGasPrice(txs)))
+
+	forecast := &Forecast{
+		Head:     head.Number.Uint64(),
+		GasLimit: head.GasLimit,
+		GasUsed:  ratios,
+	}
+	for _, ratio := range ratios {
+		forecast.Fullness += ratio / float64(len(ratios))
+	}
+	for _, tx := range txs {
+		forecast.PendingGas += tx.Gas()
+	}
+	for k := 1; k <= blocks; k++ {
+		block := ForecastBlock{Number: forecast.Head + uint64(k), Prices: make([]*big.Int, len(percentiles))}
+
+		clearing := clearingPrice(txs, head.GasLimit*uint64(k))
+		for i := range percentiles {
+			price := baseline[i]
+			if clearing != nil && clearing.Cmp(price) > 0 {
+				price = clearing
+			}
+			if price.Cmp(maxPrice) > 0 {
+				price = maxPrice
+			}
+			block.Prices[i] = new(big.Int).Set(price)
+		}
+		forecast.Blocks = append(forecast.Blocks, block)
+	}
+	return forecast, nil
+}
+
+// clearingPrice returns the price of the best priced transaction not fitting
+// into the given capacity, nil if all of them fit.
+func clearingPrice(txs types.Transactions, capacity uint64) *big.Int {
+	var gas uint64
+	for _, tx := range txs {
+		if gas += tx.Gas(); gas > capacity {
+			return tx.GasPrice()
+		}
+	}
+	return nil
+}
+
+// sampleRecentBlocks retrieves the sorted prices of the cheapest transactions
+// of the recent blocks, along with their gas used ratios, oldest first.
+func (gpo *Oracle) sampleRecentBlocks(ctx context.Context, head uint64) ([]*big.Int, []float64, error) {
+	var (
+		sent   int
+		result = make(chan getBlockPricesResult, forecastHistory)
+		quit   = make(chan struct{})
+		prices []*big.Int
+		ratios []float64
+	)
+	defer close(quit)
+
+	for number := head; sent < forecastHistory && number > 0; number-- {
+		go gpo.getBlockPrices(ctx, types.MakeSigner(gpo.backend.ChainConfig(), new(big.Int).SetUint64(number)), number, sampleNumber, result, quit)
+		sent++
+
+		header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if header == nil {
+			return nil, nil, err
+		}
+		var ratio float64
+		if header.GasLimit > 0 {
+			ratio = float64(header.GasUsed) / float64(header.GasLimit)
+		}
+		ratios = append([]float64{ratio}, ratios...)
+	}
+	for i := 0; i < sent; i++ {
+		res := <-result
+		if res.err != nil {
+			return nil, nil, res.err
+		}
+		prices = append(prices, res.prices...)
+	}
+	sort.Sort(bigIntArray(prices))
+	return prices, ratios, nil
+}
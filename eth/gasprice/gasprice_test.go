@@ -119,3 +119,42 @@ func TestSuggestPrice(t *testing.T) {
 		t.Fatalf("Gas price mismatch, want %d, got %d", expect, got)
 	}
 }
+
+func TestForecast(t *testing.T) {
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(vars.GWei)})
+
+	// Two pending transactions filling a block each, only one of them fitting
+	// into the next block
+	limit := backend.chain.CurrentBlock().GasLimit()
+	pending := types.Transactions{
+		types.NewTransaction(0, common.Address{}, nil, limit, big.NewInt(50*vars.GWei), nil),
+		types.NewTransaction(0, common.Address{}, nil, limit, big.NewInt(100*vars.GWei), nil),
+	}
+	// The gas prices sampled are the 20 most recent ones: 13G to 32G
+	forecast, err := oracle.Forecast(context.Background(), pending, 2, []float64{0, 50, 100})
+	if err != nil {
+		t.Fatalf("Failed to forecast gas prices: %v", err)
+	}
+	if forecast.Head != 32 || len(forecast.GasUsed) != 20 || forecast.PendingGas != 2*limit {
+		t.Fatalf("Forecast mismatch: head %d, %d blocks sampled, %d pending gas", forecast.Head, len(forecast.GasUsed), forecast.PendingGas)
+	}
+	want := [][]int64{{50, 50, 50}, {13, 22, 32}}
+	for i, block := range forecast.Blocks {
+		if block.Number != forecast.Head+uint64(i)+1 {
+			t.Errorf("Block %d number mismatch: have %d", i, block.Number)
+		}
+		for j, price := range block.Prices {
+			if expect := big.NewInt(want[i][j] * vars.GWei); price.Cmp(expect) != 0 {
+				t.Errorf("Block %d percentile %d price mismatch: have %d, want %d", i, j, price, expect)
+			}
+		}
+	}
+	// Invalid requests are rejected
+	if _, err := oracle.Forecast(context.Background(), nil, 0, nil); err == nil {
+		t.Error("Forecast of no blocks succeeded")
+	}
+	if _, err := oracle.Forecast(context.Background(), nil, 1, []float64{50, 10}); err == nil {
+		t.Error("Forecast of descending percentiles succeeded")
+	}
+}
@@ -8,8 +8,15 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/eth/alerts"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/eth/forkmon"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/headwatch"
+	"github.com/ethereum/go-ethereum/eth/txmgr"
+	"github.com/ethereum/go-ethereum/eth/wit"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/types/genesisT"
@@ -24,36 +31,77 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		DiscoveryURLs           []string
 		NoPruning               bool
 		NoPrefetch              bool
+		CacheWarmup             bool                   `toml:",omitempty"`
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		HistoryRetain           uint64                 `toml:",omitempty"`
+		VerifyReceipts          bool                   `toml:",omitempty"`
+		UncleIndex              bool                   `toml:",omitempty"`
+		TrackSupply             bool                   `toml:",omitempty"`
+		ContractIndex           bool                   `toml:",omitempty"`
+		TokenIndex              bool                   `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
-		LightServ               int                    `toml:",omitempty"`
-		LightIngress            int                    `toml:",omitempty"`
-		LightEgress             int                    `toml:",omitempty"`
-		LightPeers              int                    `toml:",omitempty"`
-		LightNoPrune            bool                   `toml:",omitempty"`
-		UltraLightServers       []string               `toml:",omitempty"`
-		UltraLightFraction      int                    `toml:",omitempty"`
-		UltraLightOnlyAnnounce  bool                   `toml:",omitempty"`
-		SkipBcVersionCheck      bool                   `toml:"-"`
-		DatabaseHandles         int                    `toml:"-"`
+		P2PRecordDir            string                 `toml:",omitempty"`
+		P2PRecordPayloads       bool                   `toml:",omitempty"`
+		BlockPropagation        BlockPropagationConfig
+		StateServeLimit         uint64   `toml:",omitempty"`
+		LightServ               int      `toml:",omitempty"`
+		LightIngress            int      `toml:",omitempty"`
+		LightEgress             int      `toml:",omitempty"`
+		LightPeers              int      `toml:",omitempty"`
+		LightNoPrune            bool     `toml:",omitempty"`
+		UltraLightServers       []string `toml:",omitempty"`
+		UltraLightFraction      int      `toml:",omitempty"`
+		UltraLightOnlyAnnounce  bool     `toml:",omitempty"`
+		SkipBcVersionCheck      bool     `toml:"-"`
+		DatabaseHandles         int      `toml:"-"`
 		DatabaseCache           int
 		DatabaseFreezer         string
+		AncientServeLimit       uint64                   `toml:",omitempty"`
+		AncientTiering          rawdb.TieringPolicy      `toml:",omitempty"`
+		AncientTieringFile      string                   `toml:",omitempty"`
+		AncientCompression      rawdb.FreezerCompression `toml:",omitempty"`
+		AncientFileSizes        map[string]uint32        `toml:",omitempty"`
+		AncientSyncItems        uint64                   `toml:",omitempty"`
+		AncientThreshold        uint64                   `toml:",omitempty"`
+		AncientAggressive       bool                     `toml:",omitempty"`
+		AncientFallback         bool                     `toml:",omitempty"`
+		AncientFallbackTimeout  time.Duration            `toml:",omitempty"`
+		IntegrityCheck          uint64                   `toml:",omitempty"`
+		IntegrityRepair         bool                     `toml:",omitempty"`
 		TrieCleanCache          int
 		TrieCleanCacheJournal   string        `toml:",omitempty"`
 		TrieCleanCacheRejournal time.Duration `toml:",omitempty"`
 		TrieDirtyCache          int
 		TrieTimeout             time.Duration
+		TrieFlushBlocks         uint64        `toml:",omitempty"`
+		TrieFlushTimeout        time.Duration `toml:",omitempty"`
 		SnapshotCache           int
+		SnapshotNoReads         bool    `toml:",omitempty"`
+		SnapshotAudit           float64 `toml:",omitempty"`
 		Miner                   miner.Config
+		DeveloperPoW            bool   `toml:",omitempty"`
+		DeveloperPeriod         uint64 `toml:",omitempty"`
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
+		TxManager               txmgr.Config
+		HeadWatch               headwatch.Config
+		Alerts                  alerts.Config
+		ForkMonitor             forkmon.Config
+		Witness                 wit.Config
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
 		EWASMInterpreter        string
 		EVMInterpreter          string
-		RPCGasCap               uint64                         `toml:",omitempty"`
-		RPCTxFeeCap             float64                        `toml:",omitempty"`
+		EnableOpcodeStats       bool
+		RPCGasCap               uint64        `toml:",omitempty"`
+		RPCTxFeeCap             float64       `toml:",omitempty"`
+		RPCLogsRangeCap         uint64        `toml:",omitempty"`
+		RPCErrorCodes           bool          `toml:",omitempty"`
+		TraceRegenerate         uint64        `toml:",omitempty"`
+		RPCCacheSize            int           `toml:",omitempty"`
+		RPCCacheTTL             time.Duration `toml:",omitempty"`
+		Filters                 filters.Config
 		Checkpoint              *ctypes.TrustedCheckpoint      `toml:",omitempty"`
 		CheckpointOracle        *ctypes.CheckpointOracleConfig `toml:",omitempty"`
 	}
@@ -64,8 +112,19 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.DiscoveryURLs = c.DiscoveryURLs
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
+	enc.CacheWarmup = c.CacheWarmup
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.HistoryRetain = c.HistoryRetain
+	enc.VerifyReceipts = c.VerifyReceipts
+	enc.UncleIndex = c.UncleIndex
+	enc.TrackSupply = c.TrackSupply
+	enc.ContractIndex = c.ContractIndex
+	enc.TokenIndex = c.TokenIndex
 	enc.Whitelist = c.Whitelist
+	enc.P2PRecordDir = c.P2PRecordDir
+	enc.P2PRecordPayloads = c.P2PRecordPayloads
+	enc.BlockPropagation = c.BlockPropagation
+	enc.StateServeLimit = c.StateServeLimit
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
 	enc.LightEgress = c.LightEgress
@@ -78,22 +137,52 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
 	enc.DatabaseFreezer = c.DatabaseFreezer
+	enc.AncientServeLimit = c.AncientServeLimit
+	enc.AncientTiering = c.AncientTiering
+	enc.AncientTieringFile = c.AncientTieringFile
+	enc.AncientCompression = c.AncientCompression
+	enc.AncientFileSizes = c.AncientFileSizes
+	enc.AncientSyncItems = c.AncientSyncItems
+	enc.AncientThreshold = c.AncientThreshold
+	enc.AncientAggressive = c.AncientAggressive
+	enc.AncientFallback = c.AncientFallback
+	enc.AncientFallbackTimeout = c.AncientFallbackTimeout
+	enc.IntegrityCheck = c.IntegrityCheck
+	enc.IntegrityRepair = c.IntegrityRepair
 	enc.TrieCleanCache = c.TrieCleanCache
 	enc.TrieCleanCacheJournal = c.TrieCleanCacheJournal
 	enc.TrieCleanCacheRejournal = c.TrieCleanCacheRejournal
 	enc.TrieDirtyCache = c.TrieDirtyCache
 	enc.TrieTimeout = c.TrieTimeout
+	enc.TrieFlushBlocks = c.TrieFlushBlocks
+	enc.TrieFlushTimeout = c.TrieFlushTimeout
 	enc.SnapshotCache = c.SnapshotCache
+	enc.SnapshotNoReads = c.SnapshotNoReads
+	enc.SnapshotAudit = c.SnapshotAudit
 	enc.Miner = c.Miner
+	enc.DeveloperPoW = c.DeveloperPoW
+	enc.DeveloperPeriod = c.DeveloperPeriod
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
+	enc.TxManager = c.TxManager
+	enc.HeadWatch = c.HeadWatch
+	enc.Alerts = c.Alerts
+	enc.ForkMonitor = c.ForkMonitor
+	enc.Witness = c.Witness
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
 	enc.EWASMInterpreter = c.EWASMInterpreter
 	enc.EVMInterpreter = c.EVMInterpreter
+	enc.EnableOpcodeStats = c.EnableOpcodeStats
 	enc.RPCGasCap = c.RPCGasCap
 	enc.RPCTxFeeCap = c.RPCTxFeeCap
+	enc.RPCLogsRangeCap = c.RPCLogsRangeCap
+	enc.RPCErrorCodes = c.RPCErrorCodes
+	enc.TraceRegenerate = c.TraceRegenerate
+	enc.RPCCacheSize = c.RPCCacheSize
+	enc.RPCCacheTTL = c.RPCCacheTTL
+	enc.Filters = c.Filters
 	enc.Checkpoint = c.Checkpoint
 	enc.CheckpointOracle = c.CheckpointOracle
 	return &enc, nil
@@ -108,36 +197,77 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		DiscoveryURLs           []string
 		NoPruning               *bool
 		NoPrefetch              *bool
+		CacheWarmup             *bool                  `toml:",omitempty"`
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		HistoryRetain           *uint64                `toml:",omitempty"`
+		VerifyReceipts          *bool                  `toml:",omitempty"`
+		UncleIndex              *bool                  `toml:",omitempty"`
+		TrackSupply             *bool                  `toml:",omitempty"`
+		ContractIndex           *bool                  `toml:",omitempty"`
+		TokenIndex              *bool                  `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
-		LightServ               *int                   `toml:",omitempty"`
-		LightIngress            *int                   `toml:",omitempty"`
-		LightEgress             *int                   `toml:",omitempty"`
-		LightPeers              *int                   `toml:",omitempty"`
-		LightNoPrune            *bool                  `toml:",omitempty"`
-		UltraLightServers       []string               `toml:",omitempty"`
-		UltraLightFraction      *int                   `toml:",omitempty"`
-		UltraLightOnlyAnnounce  *bool                  `toml:",omitempty"`
-		SkipBcVersionCheck      *bool                  `toml:"-"`
-		DatabaseHandles         *int                   `toml:"-"`
+		P2PRecordDir            *string                `toml:",omitempty"`
+		P2PRecordPayloads       *bool                  `toml:",omitempty"`
+		BlockPropagation        *BlockPropagationConfig
+		StateServeLimit         *uint64  `toml:",omitempty"`
+		LightServ               *int     `toml:",omitempty"`
+		LightIngress            *int     `toml:",omitempty"`
+		LightEgress             *int     `toml:",omitempty"`
+		LightPeers              *int     `toml:",omitempty"`
+		LightNoPrune            *bool    `toml:",omitempty"`
+		UltraLightServers       []string `toml:",omitempty"`
+		UltraLightFraction      *int     `toml:",omitempty"`
+		UltraLightOnlyAnnounce  *bool    `toml:",omitempty"`
+		SkipBcVersionCheck      *bool    `toml:"-"`
+		DatabaseHandles         *int     `toml:"-"`
 		DatabaseCache           *int
 		DatabaseFreezer         *string
+		AncientServeLimit       *uint64                  `toml:",omitempty"`
+		AncientTiering          *rawdb.TieringPolicy     `toml:",omitempty"`
+		AncientTieringFile      *string                  `toml:",omitempty"`
+		AncientCompression      rawdb.FreezerCompression `toml:",omitempty"`
+		AncientFileSizes        map[string]uint32        `toml:",omitempty"`
+		AncientSyncItems        *uint64                  `toml:",omitempty"`
+		AncientThreshold        *uint64                  `toml:",omitempty"`
+		AncientAggressive       *bool                    `toml:",omitempty"`
+		AncientFallback         *bool                    `toml:",omitempty"`
+		AncientFallbackTimeout  *time.Duration           `toml:",omitempty"`
+		IntegrityCheck          *uint64                  `toml:",omitempty"`
+		IntegrityRepair         *bool                    `toml:",omitempty"`
 		TrieCleanCache          *int
 		TrieCleanCacheJournal   *string        `toml:",omitempty"`
 		TrieCleanCacheRejournal *time.Duration `toml:",omitempty"`
 		TrieDirtyCache          *int
 		TrieTimeout             *time.Duration
+		TrieFlushBlocks         *uint64        `toml:",omitempty"`
+		TrieFlushTimeout        *time.Duration `toml:",omitempty"`
 		SnapshotCache           *int
+		SnapshotNoReads         *bool    `toml:",omitempty"`
+		SnapshotAudit           *float64 `toml:",omitempty"`
 		Miner                   *miner.Config
+		DeveloperPoW            *bool   `toml:",omitempty"`
+		DeveloperPeriod         *uint64 `toml:",omitempty"`
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
+		TxManager               *txmgr.Config
+		HeadWatch               *headwatch.Config
+		Alerts                  *alerts.Config
+		ForkMonitor             *forkmon.Config
+		Witness                 *wit.Config
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
 		EWASMInterpreter        *string
 		EVMInterpreter          *string
-		RPCGasCap               *uint64                        `toml:",omitempty"`
-		RPCTxFeeCap             *float64                       `toml:",omitempty"`
+		EnableOpcodeStats       *bool
+		RPCGasCap               *uint64        `toml:",omitempty"`
+		RPCTxFeeCap             *float64       `toml:",omitempty"`
+		RPCLogsRangeCap         *uint64        `toml:",omitempty"`
+		RPCErrorCodes           *bool          `toml:",omitempty"`
+		TraceRegenerate         *uint64        `toml:",omitempty"`
+		RPCCacheSize            *int           `toml:",omitempty"`
+		RPCCacheTTL             *time.Duration `toml:",omitempty"`
+		Filters                 *filters.Config
 		Checkpoint              *ctypes.TrustedCheckpoint      `toml:",omitempty"`
 		CheckpointOracle        *ctypes.CheckpointOracleConfig `toml:",omitempty"`
 	}
@@ -163,12 +293,45 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPrefetch != nil {
 		c.NoPrefetch = *dec.NoPrefetch
 	}
+	if dec.CacheWarmup != nil {
+		c.CacheWarmup = *dec.CacheWarmup
+	}
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.HistoryRetain != nil {
+		c.HistoryRetain = *dec.HistoryRetain
+	}
+	if dec.VerifyReceipts != nil {
+		c.VerifyReceipts = *dec.VerifyReceipts
+	}
+	if dec.UncleIndex != nil {
+		c.UncleIndex = *dec.UncleIndex
+	}
+	if dec.TrackSupply != nil {
+		c.TrackSupply = *dec.TrackSupply
+	}
+	if dec.ContractIndex != nil {
+		c.ContractIndex = *dec.ContractIndex
+	}
+	if dec.TokenIndex != nil {
+		c.TokenIndex = *dec.TokenIndex
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
+	if dec.P2PRecordDir != nil {
+		c.P2PRecordDir = *dec.P2PRecordDir
+	}
+	if dec.P2PRecordPayloads != nil {
+		c.P2PRecordPayloads = *dec.P2PRecordPayloads
+	}
+	if dec.BlockPropagation != nil {
+		c.BlockPropagation = *dec.BlockPropagation
+	}
+	if dec.StateServeLimit != nil {
+		c.StateServeLimit = *dec.StateServeLimit
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -205,6 +368,42 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseFreezer != nil {
 		c.DatabaseFreezer = *dec.DatabaseFreezer
 	}
+	if dec.AncientServeLimit != nil {
+		c.AncientServeLimit = *dec.AncientServeLimit
+	}
+	if dec.AncientTiering != nil {
+		c.AncientTiering = *dec.AncientTiering
+	}
+	if dec.AncientTieringFile != nil {
+		c.AncientTieringFile = *dec.AncientTieringFile
+	}
+	if dec.AncientCompression != nil {
+		c.AncientCompression = dec.AncientCompression
+	}
+	if dec.AncientFileSizes != nil {
+		c.AncientFileSizes = dec.AncientFileSizes
+	}
+	if dec.AncientSyncItems != nil {
+		c.AncientSyncItems = *dec.AncientSyncItems
+	}
+	if dec.AncientThreshold != nil {
+		c.AncientThreshold = *dec.AncientThreshold
+	}
+	if dec.AncientAggressive != nil {
+		c.AncientAggressive = *dec.AncientAggressive
+	}
+	if dec.AncientFallback != nil {
+		c.AncientFallback = *dec.AncientFallback
+	}
+	if dec.AncientFallbackTimeout != nil {
+		c.AncientFallbackTimeout = *dec.AncientFallbackTimeout
+	}
+	if dec.IntegrityCheck != nil {
+		c.IntegrityCheck = *dec.IntegrityCheck
+	}
+	if dec.IntegrityRepair != nil {
+		c.IntegrityRepair = *dec.IntegrityRepair
+	}
 	if dec.TrieCleanCache != nil {
 		c.TrieCleanCache = *dec.TrieCleanCache
 	}
@@ -220,12 +419,30 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TrieTimeout != nil {
 		c.TrieTimeout = *dec.TrieTimeout
 	}
+	if dec.TrieFlushBlocks != nil {
+		c.TrieFlushBlocks = *dec.TrieFlushBlocks
+	}
+	if dec.TrieFlushTimeout != nil {
+		c.TrieFlushTimeout = *dec.TrieFlushTimeout
+	}
 	if dec.SnapshotCache != nil {
 		c.SnapshotCache = *dec.SnapshotCache
 	}
+	if dec.SnapshotNoReads != nil {
+		c.SnapshotNoReads = *dec.SnapshotNoReads
+	}
+	if dec.SnapshotAudit != nil {
+		c.SnapshotAudit = *dec.SnapshotAudit
+	}
 	if dec.Miner != nil {
 		c.Miner = *dec.Miner
 	}
+	if dec.DeveloperPoW != nil {
+		c.DeveloperPoW = *dec.DeveloperPoW
+	}
+	if dec.DeveloperPeriod != nil {
+		c.DeveloperPeriod = *dec.DeveloperPeriod
+	}
 	if dec.Ethash != nil {
 		c.Ethash = *dec.Ethash
 	}
@@ -235,6 +452,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
+	if dec.TxManager != nil {
+		c.TxManager = *dec.TxManager
+	}
+	if dec.HeadWatch != nil {
+		c.HeadWatch = *dec.HeadWatch
+	}
+	if dec.Alerts != nil {
+		c.Alerts = *dec.Alerts
+	}
+	if dec.ForkMonitor != nil {
+		c.ForkMonitor = *dec.ForkMonitor
+	}
+	if dec.Witness != nil {
+		c.Witness = *dec.Witness
+	}
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
@@ -247,12 +479,33 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.EVMInterpreter != nil {
 		c.EVMInterpreter = *dec.EVMInterpreter
 	}
+	if dec.EnableOpcodeStats != nil {
+		c.EnableOpcodeStats = *dec.EnableOpcodeStats
+	}
 	if dec.RPCGasCap != nil {
 		c.RPCGasCap = *dec.RPCGasCap
 	}
 	if dec.RPCTxFeeCap != nil {
 		c.RPCTxFeeCap = *dec.RPCTxFeeCap
 	}
+	if dec.RPCLogsRangeCap != nil {
+		c.RPCLogsRangeCap = *dec.RPCLogsRangeCap
+	}
+	if dec.RPCErrorCodes != nil {
+		c.RPCErrorCodes = *dec.RPCErrorCodes
+	}
+	if dec.TraceRegenerate != nil {
+		c.TraceRegenerate = *dec.TraceRegenerate
+	}
+	if dec.RPCCacheSize != nil {
+		c.RPCCacheSize = *dec.RPCCacheSize
+	}
+	if dec.RPCCacheTTL != nil {
+		c.RPCCacheTTL = *dec.RPCCacheTTL
+	}
+	if dec.Filters != nil {
+		c.Filters = *dec.Filters
+	}
 	if dec.Checkpoint != nil {
 		c.Checkpoint = dec.Checkpoint
 	}
@@ -88,6 +88,19 @@ type ProtocolManager struct {
 
 	whitelist map[uint64]common.Hash
 
+	ancients       *ancientServer  // Serves ancient bodies and receipts from a remote freezer, if any
+	ancientFetcher *ancientFetcher // Retrieves the ancient items the remote freezer fails to serve, if enabled
+	servingDb      ethdb.Database  // View of the chain database never falling back to the peers, if falling back is enabled
+	stateBudget    *servingBudget  // Limits the state data served to the syncing peers
+
+	recordDir      string // Directory to record the peer sessions into, if any
+	recordPayloads bool   // Whether to record the message payloads too
+
+	propagation BlockPropagationConfig // Policy of sending new blocks in full or only announcing them
+
+	servingLock   sync.RWMutex // Held while serving a data request, to wait for the ones in flight when pausing
+	servingPaused uint32       // Flag whether the data requests are answered empty for maintenance (accessed atomically)
+
 	// channels for fetcher, syncer, txsyncLoop
 	txsyncCh chan *txsync
 	quitSync chan struct{}
@@ -105,16 +118,17 @@ type ProtocolManager struct {
 func NewProtocolManager(config ctypes.ChainConfigurator, checkpoint *ctypes.TrustedCheckpoint, mode downloader.SyncMode, networkID uint64, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb ethdb.Database, cacheLimit int, whitelist map[uint64]common.Hash) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
-		networkID:  networkID,
-		forkFilter: forkid.NewFilter(blockchain),
-		eventMux:   mux,
-		txpool:     txpool,
-		blockchain: blockchain,
-		chaindb:    chaindb,
-		peers:      newPeerSet(),
-		whitelist:  whitelist,
-		txsyncCh:   make(chan *txsync),
-		quitSync:   make(chan struct{}),
+		networkID:   networkID,
+		forkFilter:  forkid.NewFilter(blockchain),
+		eventMux:    mux,
+		txpool:      txpool,
+		blockchain:  blockchain,
+		chaindb:     chaindb,
+		peers:       newPeerSet(),
+		whitelist:   whitelist,
+		stateBudget: newServingBudget(0),
+		txsyncCh:    make(chan *txsync),
+		quitSync:    make(chan struct{}),
 	}
 
 	if mode == downloader.FullSync {
@@ -216,6 +230,15 @@ func (pm *ProtocolManager) makeProtocol(version uint) p2p.Protocol {
 		Version: version,
 		Length:  length,
 		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			if pm.recordDir != "" {
+				rec, err := newMsgRecorder(pm.recordDir, pm.recordPayloads, p, version, pm.networkID, pm.blockchain.CurrentHeader(), rw)
+				if err != nil {
+					log.Warn("Failed to start recording peer session", "peer", p.ID(), "err", err)
+				} else {
+					defer rec.Close()
+					rw = rec
+				}
+			}
 			return pm.runPeer(pm.newPeer(int(version), p, rw, pm.txpool.Get))
 		},
 		NodeInfo: func() interface{} {
@@ -227,6 +250,9 @@ func (pm *ProtocolManager) makeProtocol(version uint) p2p.Protocol {
 			}
 			return nil
 		},
+		MessageName: func(code uint64) string {
+			return msgNames[code]
+		},
 	}
 }
 
@@ -241,6 +267,9 @@ func (pm *ProtocolManager) removePeer(id string) {
 	// Unregister the peer from the downloader and Ethereum peer set
 	pm.downloader.UnregisterPeer(id)
 	pm.txFetcher.Drop(id)
+	if pm.ancients != nil {
+		pm.ancients.drop(id)
+	}
 
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
@@ -318,7 +347,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		number  = head.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
-	if err := p.Handshake(pm.networkID, td, hash, genesis.Hash(), forkid.NewID(pm.blockchain), pm.forkFilter); err != nil {
+	err := p.Handshake(pm.networkID, td, hash, genesis.Hash(), forkid.NewID(pm.blockchain), pm.forkFilter)
+	p.Peer.NotifyHandshake(protocolName, p.handshakeInfo(), err)
+	if err != nil {
 		p.Log().Debug("Ethereum handshake failed", "err", err)
 		return err
 	}
@@ -387,6 +418,21 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	}
 	defer msg.Discard()
 
+	// Mark the peer busy, so that no ancient item is requested from it meanwhile
+	atomic.StoreInt32(&p.handling, 1)
+	defer atomic.StoreInt32(&p.handling, 0)
+
+	// Answer the data requests empty while in maintenance mode, waiting for the
+	// ones in flight otherwise before pausing
+	if servingRequest(msg.Code) {
+		pm.servingLock.RLock()
+		defer pm.servingLock.RUnlock()
+
+		if atomic.LoadUint32(&pm.servingPaused) == 1 {
+			msg.Discard()
+			return pm.refuseServing(p, msg.Code)
+		}
+	}
 	// Handle the message depending on its contents
 	switch {
 	case msg.Code == StatusMsg:
@@ -416,15 +462,15 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			if hashMode {
 				if first {
 					first = false
-					origin = pm.blockchain.GetHeaderByHash(query.Origin.Hash)
+					origin = pm.servedHeaderByHash(query.Origin.Hash)
 					if origin != nil {
 						query.Origin.Number = origin.Number.Uint64()
 					}
 				} else {
-					origin = pm.blockchain.GetHeader(query.Origin.Hash, query.Origin.Number)
+					origin = pm.servedHeader(query.Origin.Hash, query.Origin.Number)
 				}
 			} else {
-				origin = pm.blockchain.GetHeaderByNumber(query.Origin.Number)
+				origin = pm.servedHeaderByNumber(query.Origin.Number)
 			}
 			if origin == nil {
 				break
@@ -454,7 +500,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 					p.Log().Warn("GetBlockHeaders skip overflow attack", "current", current, "skip", query.Skip, "next", next, "attacker", infos)
 					unknown = true
 				} else {
-					if header := pm.blockchain.GetHeaderByNumber(next); header != nil {
+					if header := pm.servedHeaderByNumber(next); header != nil {
 						nextHash := header.Hash()
 						expOldHash, _ := pm.blockchain.GetAncestor(nextHash, next, query.Skip+1, &maxNonCanonical)
 						if expOldHash == query.Origin.Hash {
@@ -504,6 +550,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Filter out any explicitly requested headers, deliver the rest to the downloader
 		filter := len(headers) == 1
 		if filter {
+			// Hand the header of an ancient block over to the ancient store, if requested
+			if pm.ancientFetcher != nil && pm.ancientFetcher.deliverHeaders(p.id, headers) {
+				return nil
+			}
 			// If it's a potential sync progress check, validate the content and advertised chain weight
 			if p.syncDrop != nil && headers[0].Number.Uint64() == pm.checkpointNumber {
 				// Disable the sync drop timer
@@ -553,6 +603,20 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
+			// Serve ancient bodies from the remote freezer within the peer's budget
+			if pm.ancients != nil {
+				data, err := pm.ancients.bodyRLP(p.id, hash)
+				if err == errBudgetExhausted {
+					break
+				}
+				if err != errNotAncient {
+					if err == nil {
+						bodies = append(bodies, data)
+						bytes += len(data)
+					}
+					continue
+				}
+			}
 			// Retrieve the requested block body, stopping if enough was found
 			if data := pm.blockchain.GetBodyRLP(hash); len(data) != 0 {
 				bodies = append(bodies, data)
@@ -567,6 +631,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&request); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		// Hand the body of an ancient block over to the ancient store, if requested
+		if pm.ancientFetcher != nil && pm.ancientFetcher.deliverBodies(p.id, request) {
+			return nil
+		}
 		// Deliver them all to the downloader for queuing
 		transactions := make([][]*types.Transaction, len(request))
 		uncles := make([][]*types.Header, len(request))
@@ -593,13 +661,19 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if _, err := msgStream.List(); err != nil {
 			return err
 		}
-		// Gather state data until the fetch or network limits is reached
+		// Gather state data until the fetch, network or serving limits is reached
 		var (
-			hash  common.Hash
-			bytes int
-			data  [][]byte
+			hash      common.Hash
+			bytes     int
+			data      [][]byte
+			start     = time.Now()
+			throttled bool
 		)
 		for bytes < softResponseLimit && len(data) < downloader.MaxStateFetch {
+			if !pm.stateBudget.allow(bytes) {
+				throttled = true
+				break
+			}
 			// Retrieve the hash of the next state entry
 			if err := msgStream.Decode(&hash); err == rlp.EOL {
 				break
@@ -623,6 +697,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(entry)
 			}
 		}
+		pm.stateBudget.charge(bytes, throttled, time.Since(start))
 		return p.SendNodeData(data)
 
 	case p.version >= eth63 && msg.Code == NodeDataMsg:
@@ -655,6 +730,20 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
+			// Serve ancient receipts from the remote freezer within the peer's budget
+			if pm.ancients != nil {
+				encoded, err := pm.ancients.receiptsRLP(p.id, hash)
+				if err == errBudgetExhausted {
+					break
+				}
+				if err != errNotAncient {
+					if err == nil {
+						receipts = append(receipts, encoded)
+						bytes += len(encoded)
+					}
+					continue
+				}
+			}
 			// Retrieve the requested block's receipts, skipping if unknown to us
 			results := pm.blockchain.GetReceiptsByHash(hash)
 			if results == nil {
@@ -678,6 +767,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&receipts); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		// Hand the receipts of an ancient block over to the ancient store, if requested
+		if pm.ancientFetcher != nil && pm.ancientFetcher.deliverReceipts(p.id, receipts) {
+			return nil
+		}
 		// Deliver all to the downloader
 		if err := pm.downloader.DeliverReceipts(p.id, receipts); err != nil {
 			log.Debug("Failed to deliver receipts", "err", err)
@@ -819,6 +912,12 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 // BroadcastBlock will either propagate a block to a subset of its peers, or
 // will only announce its availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
+	pm.broadcastBlock(block, propagate, nil)
+}
+
+// broadcastBlock propagates or announces a block, tracking the sends if a
+// propagation tracker of a locally mined block is given.
+func (pm *ProtocolManager) broadcastBlock(block *types.Block, propagate bool, prop *blockPropagation) {
 	hash := block.Hash()
 	peers := pm.peers.PeersWithoutBlock(hash)
 
@@ -833,9 +932,12 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 			return
 		}
 		// Send the block to a subset of our peers
-		transfer := peers[:int(math.Sqrt(float64(len(peers))))]
+		transfer := peers[:pm.propagation.fullPeers(len(peers), prop != nil)]
 		for _, peer := range transfer {
-			peer.AsyncSendNewBlock(block, td)
+			peer.AsyncSendNewBlock(block, td, prop)
+		}
+		if prop != nil {
+			minedFullPeersGauge.Update(int64(len(transfer)))
 		}
 		log.Trace("Propagated block", "hash", hash, "recipients", len(transfer), "duration", common.PrettyDuration(time.Since(block.ReceivedAt)))
 		return
@@ -843,7 +945,10 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 	// Otherwise if the block is indeed in out own chain, announce it
 	if pm.blockchain.HasBlock(hash, block.NumberU64()) {
 		for _, peer := range peers {
-			peer.AsyncSendNewBlockHash(block)
+			peer.AsyncSendNewBlockHash(block, prop)
+		}
+		if prop != nil {
+			minedAnnPeersGauge.Update(int64(len(peers)))
 		}
 		log.Trace("Announced block", "hash", hash, "recipients", len(peers), "duration", common.PrettyDuration(time.Since(block.ReceivedAt)))
 	}
@@ -895,8 +1000,10 @@ func (pm *ProtocolManager) minedBroadcastLoop() {
 
 	for obj := range pm.minedBlockSub.Chan() {
 		if ev, ok := obj.Data.(core.NewMinedBlockEvent); ok {
-			pm.BroadcastBlock(ev.Block, true)  // First propagate block to peers
-			pm.BroadcastBlock(ev.Block, false) // Only then announce to the rest
+			prop := newBlockPropagation()
+			pm.broadcastBlock(ev.Block, true, prop)  // First propagate block to peers
+			pm.broadcastBlock(ev.Block, false, prop) // Only then announce to the rest
+			prop.release()
 		}
 	}
 }
@@ -42,11 +42,18 @@ import (
 )
 
 // Tests that block headers can be retrieved from a remote chain based on user queries.
-func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63) }
-func TestGetBlockHeaders64(t *testing.T) { testGetBlockHeaders(t, 64) }
+func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63, false) }
+func TestGetBlockHeaders64(t *testing.T) { testGetBlockHeaders(t, 64, false) }
 
-func testGetBlockHeaders(t *testing.T, protocol int) {
-	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxHashFetch+15, nil, nil)
+// Tests that the headers are served the same when read through the view of the
+// database never falling back to the peers.
+func TestGetBlockHeadersNoFallback(t *testing.T) { testGetBlockHeaders(t, 64, true) }
+
+func testGetBlockHeaders(t *testing.T, protocol int, noFallback bool) {
+	pm, db := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxHashFetch+15, nil, nil)
+	if noFallback {
+		pm.servingDb = rawdb.NoAncientFallback(db)
+	}
 	peer, _ := newTestPeer("peer", protocol, pm, true)
 	defer peer.close()
 
@@ -0,0 +1,324 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package headwatch implements a watcher comparing the head of the local chain
+// against a set of reference nodes, which marks the node unhealthy when it keeps
+// diverging from them, to take it out of a load balanced deployment.
+package headwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var healthyGauge = metrics.NewRegisteredGauge("headwatch/healthy", nil)
+
+// Config are the configuration parameters of the head watcher.
+type Config struct {
+	Endpoints  []string      // RPC endpoints of the reference nodes (none = disabled)
+	Interval   time.Duration // Interval between two comparisons against the references
+	Depth      uint64        // Number of blocks the local chain may diverge by before being considered diverged
+	Checks     int           // Number of consecutive diverged comparisons to mark the node unhealthy
+	HaltMining bool          // Whether to stop block production when the node is marked unhealthy
+}
+
+// DefaultConfig contains the default settings of the head watcher.
+var DefaultConfig = Config{
+	Interval: 15 * time.Second,
+	Depth:    6,
+	Checks:   3,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if conf.Interval < time.Second {
+		log.Warn("Sanitizing invalid head watcher interval", "provided", conf.Interval, "updated", DefaultConfig.Interval)
+		conf.Interval = DefaultConfig.Interval
+	}
+	if conf.Checks < 1 {
+		log.Warn("Sanitizing invalid head watcher checks", "provided", conf.Checks, "updated", DefaultConfig.Checks)
+		conf.Checks = DefaultConfig.Checks
+	}
+	return conf
+}
+
+// Backend wraps all methods required by the head watcher.
+type Backend interface {
+	BlockChain() *core.BlockChain
+	IsMining() bool
+	StopMining()
+}
+
+// reference is a node the local chain is compared against.
+type reference interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// rpcReference is a reference node reached over RPC, dialed on first use and
+// redialed after failing to, so that an unreachable reference doesn't prevent
+// the node from starting.
+type rpcReference struct {
+	endpoint string
+	client   *rpc.Client // Nil until dialed
+}
+
+// HeaderByNumber retrieves a canonical header of the reference, the head if the
+// number is nil.
+func (r *rpcReference) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if r.client == nil {
+		client, err := rpc.DialContext(ctx, r.endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial reference: %v", err)
+		}
+		r.client = client
+	}
+	arg := "latest"
+	if number != nil {
+		arg = hexutil.EncodeBig(number)
+	}
+	var header *types.Header
+	if err := r.client.CallContext(ctx, &header, "eth_getBlockByNumber", arg, false); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %s not found", arg)
+	}
+	return header, nil
+}
+
+// ReferenceStatus is the outcome of the last comparison against a reference.
+type ReferenceStatus struct {
+	Endpoint string          `json:"endpoint"`
+	Head     *hexutil.Uint64 `json:"head,omitempty"`
+	Diverged bool            `json:"diverged"`
+	Reason   string          `json:"reason,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Status is the health of the node as reported by the head watcher.
+type Status struct {
+	Healthy      bool               `json:"healthy"`
+	Head         hexutil.Uint64     `json:"head"`
+	Failures     int                `json:"failures"` // Consecutive diverged comparisons
+	MiningHalted bool               `json:"miningHalted"`
+	Checked      time.Time          `json:"checked"`
+	References   []*ReferenceStatus `json:"references"`
+}
+
+// Watcher periodically compares the head of the local chain against a set of
+// reference nodes, marking the node unhealthy if a majority of the references
+// reachable keeps reporting a chain diverging beyond the configured depth.
+type Watcher struct {
+	config    Config
+	backend   Backend
+	endpoints []string
+	refs      []reference
+
+	status Status
+	lock   sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a head watcher comparing the local chain against the configured
+// reference endpoints, which are dialed by the background loop.
+func New(config Config, backend Backend) *Watcher {
+	refs := make([]reference, len(config.Endpoints))
+	for i, endpoint := range config.Endpoints {
+		refs[i] = &rpcReference{endpoint: endpoint}
+	}
+	return newWatcher(config, backend, config.Endpoints, refs)
+}
+
+func newWatcher(config Config, backend Backend, endpoints []string, refs []reference) *Watcher {
+	healthyGauge.Update(1)
+	return &Watcher{
+		config:    config.sanitize(),
+		backend:   backend,
+		endpoints: endpoints,
+		refs:      refs,
+		status:    Status{Healthy: true},
+		quit:      make(chan struct{}),
+	}
+}
+
+// Start launches the background loop of the watcher.
+func (w *Watcher) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// Stop terminates the background loop of the watcher.
+func (w *Watcher) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+
+	for _, ref := range w.refs {
+		if ref, ok := ref.(*rpcReference); ok && ref.client != nil {
+			ref.client.Close()
+		}
+	}
+}
+
+// Status returns the health of the node as of the last comparison.
+func (w *Watcher) Status() *Status {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	status := w.status
+	return &status
+}
+
+// ServeHTTP reports the health of the node to load balancers, with a 503 status
+// code if the node is unhealthy.
+func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	status := w.Status()
+	rw.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(rw).Encode(status)
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// check compares the local chain against all the references, updating the
+// health of the node.
+func (w *Watcher) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.Interval)
+	defer cancel()
+
+	var (
+		chain    = w.backend.BlockChain()
+		head     = chain.CurrentHeader().Number.Uint64()
+		statuses = make([]*ReferenceStatus, len(w.refs))
+		reached  int
+		diverged int
+	)
+	for i, ref := range w.refs {
+		statuses[i] = w.compare(ctx, chain, head, ref)
+		statuses[i].Endpoint = w.endpoints[i]
+		if statuses[i].Error != "" {
+			continue
+		}
+		reached++
+		if statuses[i].Diverged {
+			diverged++
+		}
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.status.Head, w.status.Checked, w.status.References = hexutil.Uint64(head), time.Now(), statuses
+
+	// Mining halted by the watcher may have been restarted by the operator since
+	if w.status.MiningHalted && w.backend.IsMining() {
+		w.status.MiningHalted = false
+	}
+	switch {
+	case reached == 0:
+		log.Warn("No head watcher reference reachable", "references", len(w.refs))
+		return
+	case diverged*2 <= reached:
+		if !w.status.Healthy {
+			log.Info("Local chain converged with the references, marking node healthy", "head", head)
+			healthyGauge.Update(1)
+		}
+		w.status.Healthy, w.status.Failures = true, 0
+		return
+	}
+	w.status.Failures++
+	log.Warn("Local chain diverged from the references", "head", head, "diverged", diverged, "reached", reached, "failures", w.status.Failures)
+
+	if w.status.Healthy && w.status.Failures >= w.config.Checks {
+		log.Error("Local chain keeps diverging from the references, marking node unhealthy", "head", head, "failures", w.status.Failures)
+		w.status.Healthy = false
+		healthyGauge.Update(0)
+
+		if w.config.HaltMining && w.backend.IsMining() {
+			log.Error("Halting block production, restart mining once the divergence is resolved")
+			w.backend.StopMining()
+			w.status.MiningHalted = true
+		}
+	}
+}
+
+// compare checks whether the local chain diverges from the one of a reference
+// beyond the configured depth: either lagging behind it by more blocks, or
+// having another canonical block at the depth below the lowest of both heads.
+func (w *Watcher) compare(ctx context.Context, chain *core.BlockChain, head uint64, ref reference) *ReferenceStatus {
+	status := new(ReferenceStatus)
+
+	refHead, err := ref.HeaderByNumber(ctx, nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	number := refHead.Number.Uint64()
+	status.Head = (*hexutil.Uint64)(&number)
+
+	if number > head+w.config.Depth {
+		status.Diverged, status.Reason = true, fmt.Sprintf("lagging behind by %d blocks", number-head)
+		return status
+	}
+	check := head
+	if number < check {
+		check = number
+	}
+	if check < w.config.Depth {
+		return status
+	}
+	check -= w.config.Depth
+
+	refHeader, err := ref.HeaderByNumber(ctx, new(big.Int).SetUint64(check))
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if hash := chain.GetCanonicalHash(check); hash != refHeader.Hash() {
+		status.Diverged, status.Reason = true, fmt.Sprintf("block #%d mismatch: have %x, want %x", check, hash, refHeader.Hash())
+	}
+	return status
+}
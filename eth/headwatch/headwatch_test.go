@@ -0,0 +1,169 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package headwatch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+type testBackend struct {
+	chain  *core.BlockChain
+	mining bool
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain { return b.chain }
+func (b *testBackend) IsMining() bool               { return b.mining }
+func (b *testBackend) StopMining()                  { b.mining = false }
+
+// chainReference serves the headers of a local chain as a reference.
+type chainReference struct {
+	chain *core.BlockChain
+	down  bool
+}
+
+func (r *chainReference) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if r.down {
+		return nil, errors.New("connection refused")
+	}
+	if number == nil {
+		return r.chain.CurrentHeader(), nil
+	}
+	return r.chain.GetHeaderByNumber(number.Uint64()), nil
+}
+
+// newTestChain creates a chain of the given length, whose blocks are mined by
+// the given coinbase from the given number on.
+func newTestChain(t *testing.T, n int, fork int, coinbase common.Address) *core.BlockChain {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &genesisT.Genesis{Config: params.TestChainConfig}
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rawdb.NewMemoryDatabase(), n, func(i int, b *core.BlockGen) {
+		if i >= fork {
+			b.SetCoinbase(coinbase)
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// Tests that an unreachable reference endpoint doesn't prevent the watcher from
+// being created, and is reported as failing until it can be dialed.
+func TestHeadWatcherUnreachable(t *testing.T) {
+	local := newTestChain(t, 20, 20, common.Address{})
+	defer local.Stop()
+
+	w := New(Config{Endpoints: []string{"ws://127.0.0.1:1"}, Interval: time.Minute}, &testBackend{chain: local})
+	defer w.Stop()
+
+	w.check()
+	if status := w.Status(); !status.Healthy || status.References[0].Error == "" {
+		t.Fatalf("status mismatch: %+v", status)
+	}
+}
+
+func TestHeadWatcher(t *testing.T) {
+	local := newTestChain(t, 20, 20, common.Address{})
+	defer local.Stop()
+
+	// Two references agreeing with the local chain, one ahead within the depth,
+	// and one forked off deeper than it
+	same := newTestChain(t, 20, 20, common.Address{})
+	defer same.Stop()
+	ahead := newTestChain(t, 22, 20, common.Address{})
+	defer ahead.Stop()
+	forked := newTestChain(t, 20, 5, common.Address{0x01})
+	defer forked.Stop()
+
+	var (
+		backend = &testBackend{chain: local, mining: true}
+		refs    = []*chainReference{{chain: same}, {chain: ahead}, {chain: forked}}
+	)
+	w := newWatcher(Config{Interval: time.Minute, Depth: 4, Checks: 2, HaltMining: true}, backend, []string{"same", "ahead", "forked"}, []reference{refs[0], refs[1], refs[2]})
+
+	w.check()
+	status := w.Status()
+	if !status.Healthy || status.Failures != 0 || status.Head != 20 {
+		t.Fatalf("status mismatch: %+v", status)
+	}
+	if status.References[0].Diverged || status.References[1].Diverged || !status.References[2].Diverged {
+		t.Fatalf("reference divergence mismatch: %+v %+v %+v", status.References[0], status.References[1], status.References[2])
+	}
+	// With a majority of the references diverged, the node is marked unhealthy
+	// after the configured number of checks, halting mining
+	refs[0].down = true
+	for i := 0; i < 2; i++ {
+		if !w.Status().Healthy {
+			t.Fatalf("node marked unhealthy after %d checks", i)
+		}
+		refs[1].chain = forked
+		w.check()
+	}
+	if status := w.Status(); status.Healthy || status.Failures != 2 || !status.MiningHalted || backend.mining {
+		t.Fatalf("status mismatch: %+v, mining %v", status, backend.mining)
+	}
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unhealthy status code mismatch: have %d", rec.Code)
+	}
+	// Unreachable references don't change the health
+	refs[1].down, refs[2].down = true, true
+	w.check()
+	if w.Status().Healthy {
+		t.Fatalf("node marked healthy without reachable references")
+	}
+	// Converging with the references makes the node healthy again
+	refs[0].down, refs[1].chain, refs[1].down = false, same, false
+	w.check()
+	if status := w.Status(); !status.Healthy || status.Failures != 0 || !status.MiningHalted {
+		t.Fatalf("status mismatch: %+v", status)
+	}
+	// Mining restarted by the operator is no longer reported halted
+	backend.mining = true
+	w.check()
+	if status := w.Status(); status.MiningHalted {
+		t.Fatalf("restarted mining still reported halted: %+v", status)
+	}
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthy status code mismatch: have %d", rec.Code)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maintenanceDrainTimeout is the maximum time to wait for the RPC calls in flight
+// to complete when entering the maintenance mode.
+const maintenanceDrainTimeout = 30 * time.Second
+
+// MaintenanceStatus is the state of the maintenance mode of the node.
+type MaintenanceStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Since         *time.Time `json:"since,omitempty"`
+	RPCPaused     bool       `json:"rpcPaused"`     // Whether the HTTP and WebSocket calls in flight completed
+	ServingPaused bool       `json:"servingPaused"` // Whether the p2p data requests in flight were served
+	FreezerPaused bool       `json:"freezerPaused"` // Whether the freezer stopped at a block boundary
+	Quiescent     bool       `json:"quiescent"`     // Whether the node is safe to back up or upgrade
+	Error         string     `json:"error,omitempty"`
+}
+
+// maintenance tracks the maintenance mode of the node, draining and pausing the
+// public RPC endpoints, the p2p data serving and the freezer.
+type maintenance struct {
+	status MaintenanceStatus
+	lock   sync.Mutex // Protects the status
+	opLock sync.Mutex // Serializes entering and leaving the maintenance mode
+}
+
+// servingRequest reports whether a message is a request for chain or state data
+// served to the peers.
+func servingRequest(code uint64) bool {
+	switch code {
+	case GetBlockHeadersMsg, GetBlockBodiesMsg, GetNodeDataMsg, GetReceiptsMsg, GetPooledTransactionsMsg:
+		return true
+	}
+	return false
+}
+
+// pauseServing answers the new data requests of the peers empty, returning once
+// the requests in flight are served.
+func (pm *ProtocolManager) pauseServing() {
+	atomic.StoreUint32(&pm.servingPaused, 1)
+	pm.servingLock.Lock()
+	pm.servingLock.Unlock()
+}
+
+// resumeServing serves the data requests of the peers again.
+func (pm *ProtocolManager) resumeServing() {
+	atomic.StoreUint32(&pm.servingPaused, 0)
+}
+
+// refuseServing answers a data request empty, as if none of the data requested
+// was available.
+func (pm *ProtocolManager) refuseServing(p *peer, code uint64) error {
+	switch code {
+	case GetBlockHeadersMsg:
+		return p.SendBlockHeaders(nil)
+	case GetBlockBodiesMsg:
+		return p.SendBlockBodiesRLP(nil)
+	case GetNodeDataMsg:
+		return p.SendNodeData(nil)
+	case GetReceiptsMsg:
+		return p.SendReceiptsRLP(nil)
+	case GetPooledTransactionsMsg:
+		return p.SendPooledTransactionsRLP(nil, nil)
+	}
+	return nil
+}
+
+// enableMaintenance enters the maintenance mode, draining and pausing the public
+// RPC endpoints, the p2p data serving and the freezer in the background.
+func (s *Ethereum) enableMaintenance() *MaintenanceStatus {
+	s.maintenance.lock.Lock()
+	defer s.maintenance.lock.Unlock()
+
+	if !s.maintenance.status.Enabled {
+		since := time.Now()
+		s.maintenance.status = MaintenanceStatus{Enabled: true, Since: &since}
+		go s.quiesce()
+	}
+	status := s.maintenance.status
+	return &status
+}
+
+// quiesce waits for the work in flight to complete, pausing each part of the
+// node in turn, and records once the node is quiescent.
+func (s *Ethereum) quiesce() {
+	s.maintenance.opLock.Lock()
+	defer s.maintenance.opLock.Unlock()
+
+	// Bail out if the maintenance mode was left before getting here
+	if !s.maintenanceStatus().Enabled {
+		return
+	}
+	log.Info("Entering maintenance mode")
+	update := func(fn func(status *MaintenanceStatus)) {
+		s.maintenance.lock.Lock()
+		defer s.maintenance.lock.Unlock()
+		fn(&s.maintenance.status)
+	}
+	if s.stack != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), maintenanceDrainTimeout)
+		err := s.stack.PauseRPC(ctx)
+		cancel()
+		if err != nil {
+			log.Warn("RPC calls still in flight, node not quiescent", "timeout", maintenanceDrainTimeout)
+			update(func(status *MaintenanceStatus) { status.Error = "RPC calls still in flight" })
+			return
+		}
+	}
+	update(func(status *MaintenanceStatus) { status.RPCPaused = true })
+
+	s.protocolManager.pauseServing()
+	update(func(status *MaintenanceStatus) { status.ServingPaused = true })
+
+	if pauser, ok := s.chainDb.(rawdb.AncientFreezePauser); ok {
+		pauser.PauseFreezing()
+	}
+	update(func(status *MaintenanceStatus) {
+		status.FreezerPaused = true
+		status.Quiescent = true
+	})
+	log.Info("Node quiescent, safe to back up or upgrade")
+}
+
+// disableMaintenance leaves the maintenance mode, resuming the freezer, the p2p
+// data serving and the public RPC endpoints.
+func (s *Ethereum) disableMaintenance() *MaintenanceStatus {
+	s.maintenance.lock.Lock()
+	enabled := s.maintenance.status.Enabled
+	s.maintenance.lock.Unlock()
+
+	if enabled {
+		// Wait for the node to be quiesced before resuming it
+		s.maintenance.opLock.Lock()
+		if pauser, ok := s.chainDb.(rawdb.AncientFreezePauser); ok {
+			pauser.ResumeFreezing()
+		}
+		s.protocolManager.resumeServing()
+		if s.stack != nil {
+			s.stack.ResumeRPC()
+		}
+		s.maintenance.opLock.Unlock()
+
+		s.maintenance.lock.Lock()
+		s.maintenance.status = MaintenanceStatus{}
+		s.maintenance.lock.Unlock()
+		log.Info("Left maintenance mode")
+	}
+	return s.maintenanceStatus()
+}
+
+// MaintenanceMode enters or leaves the maintenance mode. Entering it stops the
+// HTTP and WebSocket endpoints from taking new calls, answering them with a 503
+// status, answers the new p2p data requests empty and pauses the freezer at a
+// block boundary, once the work in flight completed; the status reports when the
+// node is quiescent, to be backed up or upgraded. The IPC endpoint keeps taking
+// calls meanwhile, to leave the maintenance mode.
+func (api *PrivateAdminAPI) MaintenanceMode(enable bool) *MaintenanceStatus {
+	if enable {
+		return api.eth.enableMaintenance()
+	}
+	return api.eth.disableMaintenance()
+}
+
+// MaintenanceStatus returns the state of the maintenance mode.
+func (api *PrivateAdminAPI) MaintenanceStatus() *MaintenanceStatus {
+	return api.eth.maintenanceStatus()
+}
+
+// maintenanceStatus returns the state of the maintenance mode.
+func (s *Ethereum) maintenanceStatus() *MaintenanceStatus {
+	s.maintenance.lock.Lock()
+	defer s.maintenance.lock.Unlock()
+
+	status := s.maintenance.status
+	return &status
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// Tests that the data requests of the peers are answered empty while in
+// maintenance mode, and served again once it's left.
+func TestMaintenanceMode(t *testing.T) {
+	pm, db := newTestProtocolManagerMust(t, downloader.FullSync, 8, nil, nil)
+	defer pm.Stop()
+
+	peer, _ := newTestPeer("peer", eth64, pm, true)
+	defer peer.close()
+
+	eth := &Ethereum{protocolManager: pm, chainDb: db}
+	api := NewPrivateAdminAPI(eth)
+
+	if status := api.MaintenanceMode(true); !status.Enabled || status.Since == nil {
+		t.Fatalf("maintenance mode not enabled: %+v", status)
+	}
+	for start := time.Now(); !api.MaintenanceStatus().Quiescent; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("node not quiescent: %+v", api.MaintenanceStatus())
+		}
+	}
+	query := &getBlockHeadersData{Origin: hashOrNumber{Number: 1}, Amount: 1}
+	p2p.Send(peer.app, GetBlockHeadersMsg, query)
+	if err := p2p.ExpectMsg(peer.app, BlockHeadersMsg, []*types.Header{}); err != nil {
+		t.Fatalf("headers served in maintenance mode: %v", err)
+	}
+	if status := api.MaintenanceMode(false); status.Enabled {
+		t.Fatalf("maintenance mode not disabled: %+v", status)
+	}
+	p2p.Send(peer.app, GetBlockHeadersMsg, query)
+	if err := p2p.ExpectMsg(peer.app, BlockHeadersMsg, []*types.Header{pm.blockchain.GetHeaderByNumber(1)}); err != nil {
+		t.Fatalf("headers not served after maintenance: %v", err)
+	}
+}
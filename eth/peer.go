@@ -20,11 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/forkid"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -78,10 +80,28 @@ type PeerInfo struct {
 	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
 }
 
+// HandshakeInfo is the status a peer announced in the eth protocol handshake,
+// reported in the handshake events of the p2p server.
+type HandshakeInfo struct {
+	Version    uint32      `json:"version"`
+	NetworkID  uint64      `json:"network"`
+	Difficulty *big.Int    `json:"difficulty"`
+	Head       common.Hash `json:"head"`
+	Genesis    common.Hash `json:"genesis"`
+	ForkID     *ForkIDInfo `json:"forkid,omitempty"` // Announced since eth/64
+}
+
+// ForkIDInfo is a fork ID announced by a peer.
+type ForkIDInfo struct {
+	Hash hexutil.Bytes `json:"hash"` // CRC32 checksum of the genesis block and passed forks
+	Next uint64        `json:"next"` // Block number of the next upcoming fork, or 0 if unknown
+}
+
 // propEvent is a block propagation, waiting for its turn in the broadcast queue.
 type propEvent struct {
 	block *types.Block
-	td    *big.Int
+	td    *big.Int          // Total difficulty of the block, nil for announcements
+	prop  *blockPropagation // Propagation tracker of locally mined blocks, nil otherwise
 }
 
 type peer struct {
@@ -91,15 +111,17 @@ type peer struct {
 	rw p2p.MsgReadWriter
 
 	version  int         // Protocol version negotiated
+	handling int32       // Whether a message of the peer is being handled (atomic)
 	syncDrop *time.Timer // Timed connection dropper if sync progress isn't validated in time
 
-	head common.Hash
-	td   *big.Int
-	lock sync.RWMutex
+	head   common.Hash
+	td     *big.Int
+	status *HandshakeInfo // Status announced in the handshake, nil until received
+	lock   sync.RWMutex
 
-	knownBlocks     mapset.Set        // Set of block hashes known to be known by this peer
-	queuedBlocks    chan *propEvent   // Queue of blocks to broadcast to the peer
-	queuedBlockAnns chan *types.Block // Queue of blocks to announce to the peer
+	knownBlocks     mapset.Set      // Set of block hashes known to be known by this peer
+	queuedBlocks    chan *propEvent // Queue of blocks to broadcast to the peer
+	queuedBlockAnns chan *propEvent // Queue of blocks to announce to the peer
 
 	knownTxs    mapset.Set                           // Set of transaction hashes known to be known by this peer
 	txBroadcast chan []common.Hash                   // Channel used to queue transaction propagation requests
@@ -118,7 +140,7 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter, getPooledTx func(ha
 		knownTxs:        mapset.NewSet(),
 		knownBlocks:     mapset.NewSet(),
 		queuedBlocks:    make(chan *propEvent, maxQueuedBlocks),
-		queuedBlockAnns: make(chan *types.Block, maxQueuedBlockAnns),
+		queuedBlockAnns: make(chan *propEvent, maxQueuedBlockAnns),
 		txBroadcast:     make(chan []common.Hash),
 		txAnnounce:      make(chan []common.Hash),
 		getPooledTx:     getPooledTx,
@@ -133,14 +155,23 @@ func (p *peer) broadcastBlocks(removePeer func(string)) {
 	for {
 		select {
 		case prop := <-p.queuedBlocks:
-			if err := p.SendNewBlock(prop.block, prop.td); err != nil {
+			err := p.SendNewBlock(prop.block, prop.td)
+			if prop.prop != nil {
+				prop.prop.done(err == nil)
+			}
+			if err != nil {
 				removePeer(p.id)
 				return
 			}
 			p.Log().Trace("Propagated block", "number", prop.block.Number(), "hash", prop.block.Hash(), "td", prop.td)
 
-		case block := <-p.queuedBlockAnns:
-			if err := p.SendNewBlockHashes([]common.Hash{block.Hash()}, []uint64{block.NumberU64()}); err != nil {
+		case ann := <-p.queuedBlockAnns:
+			block := ann.block
+			err := p.SendNewBlockHashes([]common.Hash{block.Hash()}, []uint64{block.NumberU64()})
+			if ann.prop != nil {
+				ann.prop.done(err == nil)
+			}
+			if err != nil {
 				removePeer(p.id)
 				return
 			}
@@ -448,10 +479,13 @@ func (p *peer) SendNewBlockHashes(hashes []common.Hash, numbers []uint64) error
 
 // AsyncSendNewBlockHash queues the availability of a block for propagation to a
 // remote peer. If the peer's broadcast queue is full, the event is silently
-// dropped.
-func (p *peer) AsyncSendNewBlockHash(block *types.Block) {
+// dropped. The propagation tracker of locally mined blocks is optional.
+func (p *peer) AsyncSendNewBlockHash(block *types.Block, prop *blockPropagation) {
+	if prop != nil {
+		prop.queued()
+	}
 	select {
-	case p.queuedBlockAnns <- block:
+	case p.queuedBlockAnns <- &propEvent{block: block, prop: prop}:
 		// Mark all the block hash as known, but ensure we don't overflow our limits
 		for p.knownBlocks.Cardinality() >= maxKnownBlocks {
 			p.knownBlocks.Pop()
@@ -459,6 +493,10 @@ func (p *peer) AsyncSendNewBlockHash(block *types.Block) {
 		p.knownBlocks.Add(block.Hash())
 	default:
 		p.Log().Debug("Dropping block announcement", "number", block.NumberU64(), "hash", block.Hash())
+		blockDroppedMeter.Mark(1)
+		if prop != nil {
+			prop.release()
+		}
 	}
 }
 
@@ -473,10 +511,14 @@ func (p *peer) SendNewBlock(block *types.Block, td *big.Int) error {
 }
 
 // AsyncSendNewBlock queues an entire block for propagation to a remote peer. If
-// the peer's broadcast queue is full, the event is silently dropped.
-func (p *peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
+// the peer's broadcast queue is full, the event is silently dropped. The
+// propagation tracker of locally mined blocks is optional.
+func (p *peer) AsyncSendNewBlock(block *types.Block, td *big.Int, prop *blockPropagation) {
+	if prop != nil {
+		prop.queued()
+	}
 	select {
-	case p.queuedBlocks <- &propEvent{block: block, td: td}:
+	case p.queuedBlocks <- &propEvent{block: block, td: td, prop: prop}:
 		// Mark all the block hash as known, but ensure we don't overflow our limits
 		for p.knownBlocks.Cardinality() >= maxKnownBlocks {
 			p.knownBlocks.Pop()
@@ -484,6 +526,10 @@ func (p *peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
 		p.knownBlocks.Add(block.Hash())
 	default:
 		p.Log().Debug("Dropping block propagation", "number", block.NumberU64(), "hash", block.Hash())
+		blockDroppedMeter.Mark(1)
+		if prop != nil {
+			prop.release()
+		}
 	}
 }
 
@@ -628,6 +674,27 @@ func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 	return nil
 }
 
+// handshakeInfo returns the status the peer announced in the handshake, or nil
+// if it wasn't received.
+func (p *peer) handshakeInfo() interface{} {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.status == nil {
+		return nil
+	}
+	return p.status
+}
+
+// setStatus stores the status the peer announced in the handshake, before it
+// is validated.
+func (p *peer) setStatus(status *HandshakeInfo) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.status = status
+}
+
 func (p *peer) readStatusLegacy(network uint64, status *statusData63, genesis common.Hash) error {
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
@@ -643,6 +710,13 @@ func (p *peer) readStatusLegacy(network uint64, status *statusData63, genesis co
 	if err := msg.Decode(&status); err != nil {
 		return errResp(ErrDecode, "msg %v: %v", msg, err)
 	}
+	p.setStatus(&HandshakeInfo{
+		Version:    status.ProtocolVersion,
+		NetworkID:  status.NetworkId,
+		Difficulty: status.TD,
+		Head:       status.CurrentBlock,
+		Genesis:    status.GenesisBlock,
+	})
 	if status.GenesisBlock != genesis {
 		return errResp(ErrGenesisMismatch, "%x (!= %x)", status.GenesisBlock[:8], genesis[:8])
 	}
@@ -670,6 +744,14 @@ func (p *peer) readStatus(network uint64, status *statusData, genesis common.Has
 	if err := msg.Decode(&status); err != nil {
 		return errResp(ErrDecode, "msg %v: %v", msg, err)
 	}
+	p.setStatus(&HandshakeInfo{
+		Version:    status.ProtocolVersion,
+		NetworkID:  status.NetworkID,
+		Difficulty: status.TD,
+		Head:       status.Head,
+		Genesis:    status.Genesis,
+		ForkID:     &ForkIDInfo{Hash: status.ForkID.Hash[:], Next: status.ForkID.Next},
+	})
 	if status.NetworkID != network {
 		return errResp(ErrNetworkIDMismatch, "%d (!= %d)", status.NetworkID, network)
 	}
@@ -809,6 +891,23 @@ func (ps *peerSet) BestPeer() *peer {
 	return bestPeer
 }
 
+// PeersByTd retrieves the known peers sorted by decreasing total difficulty.
+func (ps *peerSet) PeersByTd() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		_, tdi := list[i].Head()
+		_, tdj := list[j].Head()
+		return tdi.Cmp(tdj) > 0
+	})
+	return list
+}
+
 // Close disconnects all peers.
 // No new peers can be registered after Close has returned.
 func (ps *peerSet) Close() {
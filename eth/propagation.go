@@ -0,0 +1,104 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	minedFirstSendTimer = metrics.NewRegisteredTimer("eth/propagation/mined/first", nil)
+	minedAllSentTimer   = metrics.NewRegisteredTimer("eth/propagation/mined/complete", nil)
+	minedFullPeersGauge = metrics.NewRegisteredGauge("eth/propagation/mined/full", nil)
+	minedAnnPeersGauge  = metrics.NewRegisteredGauge("eth/propagation/mined/announce", nil)
+	minedFailedMeter    = metrics.NewRegisteredMeter("eth/propagation/mined/failed", nil)
+	blockDroppedMeter   = metrics.NewRegisteredMeter("eth/propagation/dropped", nil)
+)
+
+// BlockPropagationConfig is the policy of gossiping new blocks, deciding which
+// peers receive them in full and which ones only get announcements.
+type BlockPropagationConfig struct {
+	MinPeers int  `toml:",omitempty"` // Minimum number of peers to send new blocks in full to
+	MaxPeers int  `toml:",omitempty"` // Maximum number of peers to send new blocks in full to (0 = unlimited)
+	MinedAll bool `toml:",omitempty"` // Whether to send locally mined blocks in full to all peers
+}
+
+// fullPeers returns the number of peers out of the given ones to send a block
+// in full to, the square root of them by default.
+func (c *BlockPropagationConfig) fullPeers(peers int, mined bool) int {
+	if mined && c.MinedAll {
+		return peers
+	}
+	n := int(math.Sqrt(float64(peers)))
+	if n < c.MinPeers {
+		n = c.MinPeers
+	}
+	if c.MaxPeers > 0 && n > c.MaxPeers {
+		n = c.MaxPeers
+	}
+	if n > peers {
+		n = peers
+	}
+	return n
+}
+
+// blockPropagation tracks the sends of a locally mined block to the peers,
+// measuring the time it takes until the first one and all of them are done.
+type blockPropagation struct {
+	start   time.Time
+	pending int32 // Number of sends not done yet, plus one until all are queued; accessed atomically
+	sent    int32 // Whether a send completed already; accessed atomically
+
+	first    time.Duration // Time until the first send completed
+	complete time.Duration // Time until all sends completed, set after first
+}
+
+// newBlockPropagation starts tracking the propagation of a mined block.
+func newBlockPropagation() *blockPropagation {
+	return &blockPropagation{start: time.Now(), pending: 1}
+}
+
+// queued registers a send of the block queued for a peer.
+func (bp *blockPropagation) queued() {
+	atomic.AddInt32(&bp.pending, 1)
+}
+
+// done registers a completed send of the block, successful or not.
+func (bp *blockPropagation) done(ok bool) {
+	if ok {
+		if atomic.CompareAndSwapInt32(&bp.sent, 0, 1) {
+			bp.first = time.Since(bp.start)
+			minedFirstSendTimer.Update(bp.first)
+		}
+	} else {
+		minedFailedMeter.Mark(1)
+	}
+	bp.release()
+}
+
+// release drops a pending send, or the hold of the broadcaster once all sends
+// are queued, recording the propagation time after the last one.
+func (bp *blockPropagation) release() {
+	if atomic.AddInt32(&bp.pending, -1) == 0 {
+		bp.complete = time.Since(bp.start)
+		minedAllSentTimer.Update(bp.complete)
+	}
+}
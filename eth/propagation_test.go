@@ -0,0 +1,69 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+)
+
+func TestBlockPropagationFullPeers(t *testing.T) {
+	tests := []struct {
+		config BlockPropagationConfig
+		peers  int
+		mined  bool
+		want   int
+	}{
+		{BlockPropagationConfig{}, 0, false, 0},
+		{BlockPropagationConfig{}, 16, false, 4},
+		{BlockPropagationConfig{}, 16, true, 4},
+		{BlockPropagationConfig{MinPeers: 8}, 16, false, 8},
+		{BlockPropagationConfig{MinPeers: 8}, 5, false, 5},
+		{BlockPropagationConfig{MaxPeers: 2}, 16, false, 2},
+		{BlockPropagationConfig{MinPeers: 8, MaxPeers: 6}, 16, false, 6},
+		{BlockPropagationConfig{MinedAll: true}, 16, false, 4},
+		{BlockPropagationConfig{MinedAll: true, MaxPeers: 2}, 16, true, 16},
+	}
+	for i, tt := range tests {
+		if have := tt.config.fullPeers(tt.peers, tt.mined); have != tt.want {
+			t.Errorf("test %d: full peers mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+func TestBlockPropagationTracking(t *testing.T) {
+	prop := newBlockPropagation()
+	prop.queued()
+	prop.queued()
+	prop.done(false)
+	if prop.first != 0 {
+		t.Errorf("first send recorded after a failed send")
+	}
+	prop.done(true)
+	if prop.first == 0 {
+		t.Errorf("first send not recorded")
+	}
+	// The propagation isn't complete until the broadcaster queued all sends
+	if prop.complete != 0 {
+		t.Errorf("propagation completed before the broadcaster released it")
+	}
+	prop.queued()
+	prop.done(true)
+	prop.release()
+	if prop.complete < prop.first {
+		t.Errorf("propagation time mismatch: complete %v, first send %v", prop.complete, prop.first)
+	}
+}
@@ -71,6 +71,26 @@ const (
 	PooledTransactionsMsg         = 0x0a
 )
 
+// msgNames are the names of the eth protocol messages, reported in the message
+// events of the p2p server.
+var msgNames = map[uint64]string{
+	StatusMsg:                     "Status",
+	NewBlockHashesMsg:             "NewBlockHashes",
+	TransactionMsg:                "Transactions",
+	GetBlockHeadersMsg:            "GetBlockHeaders",
+	BlockHeadersMsg:               "BlockHeaders",
+	GetBlockBodiesMsg:             "GetBlockBodies",
+	BlockBodiesMsg:                "BlockBodies",
+	NewBlockMsg:                   "NewBlock",
+	NewPooledTransactionHashesMsg: "NewPooledTransactionHashes",
+	GetPooledTransactionsMsg:      "GetPooledTransactions",
+	PooledTransactionsMsg:         "PooledTransactions",
+	GetNodeDataMsg:                "GetNodeData",
+	NodeDataMsg:                   "NodeData",
+	GetReceiptsMsg:                "GetReceipts",
+	ReceiptsMsg:                   "Receipts",
+}
+
 type errCode int
 
 const (
@@ -0,0 +1,320 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// RecordHeader is the first item of a recorded eth protocol session, describing
+// the peer and the local node at the time the session started.
+type RecordHeader struct {
+	ID         enode.ID    // Node ID of the remote peer
+	Name       string      // Client name advertised by the remote peer
+	RemoteAddr string      // Network address of the remote peer
+	Version    uint        // Negotiated eth protocol version
+	NetworkID  uint64      // Network ID of the local node
+	Start      uint64      // Unix time in nanoseconds the session started at
+	HeadNumber uint64      // Number of the local chain head when the session started
+	HeadHash   common.Hash // Hash of the local chain head when the session started
+}
+
+// RecordedMsg is an eth protocol message exchanged during a recorded session.
+type RecordedMsg struct {
+	Time    uint64 // Nanoseconds elapsed since the start of the session
+	Inbound bool   // Whether the message was received from the peer, or sent to it
+	Code    uint64
+	Size    uint32
+	Payload []byte // Raw payload of the message, empty if payloads weren't recorded
+}
+
+// msgRecorder is a p2p.MsgReadWriter recording the messages exchanged through
+// it into a session file.
+type msgRecorder struct {
+	rw       p2p.MsgReadWriter
+	payloads bool // Whether to record the message payloads too
+	start    time.Time
+
+	file   *os.File
+	out    *bufio.Writer
+	failed bool // Whether writing the recording failed, disabling it
+	lock   sync.Mutex
+}
+
+// newMsgRecorder creates the session file of a peer in the recording directory
+// and wraps the peer's message stream with a recorder writing into it.
+func newMsgRecorder(dir string, payloads bool, p *p2p.Peer, version uint, networkID uint64, head *types.Header, rw p2p.MsgReadWriter) (*msgRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	var (
+		start = time.Now()
+		id    = p.ID()
+		name  = fmt.Sprintf("%s-%x-eth%d.rlp", start.UTC().Format("20060102T150405.000"), id[:8], version)
+	)
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &msgRecorder{
+		rw:       rw,
+		payloads: payloads,
+		start:    start,
+		file:     file,
+		out:      bufio.NewWriter(file),
+	}
+	header := &RecordHeader{
+		ID:         id,
+		Name:       p.Name(),
+		RemoteAddr: p.RemoteAddr().String(),
+		Version:    version,
+		NetworkID:  networkID,
+		Start:      uint64(start.UnixNano()),
+		HeadNumber: head.Number.Uint64(),
+		HeadHash:   head.Hash(),
+	}
+	if err := rlp.Encode(r.out, header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadMsg implements p2p.MsgReader, recording the message read from the peer.
+func (r *msgRecorder) ReadMsg() (p2p.Msg, error) {
+	msg, err := r.rw.ReadMsg()
+	if err != nil {
+		return msg, err
+	}
+	var payload []byte
+	if r.payloads {
+		if payload, err = ioutil.ReadAll(msg.Payload); err != nil {
+			return msg, err
+		}
+		msg.Payload = bytes.NewReader(payload)
+	}
+	r.record(true, msg.Code, msg.Size, payload)
+	return msg, nil
+}
+
+// WriteMsg implements p2p.MsgWriter, recording the message sent to the peer.
+func (r *msgRecorder) WriteMsg(msg p2p.Msg) error {
+	var payload []byte
+	if r.payloads {
+		var err error
+		if payload, err = ioutil.ReadAll(msg.Payload); err != nil {
+			return err
+		}
+		msg.Payload = bytes.NewReader(payload)
+	}
+	if err := r.rw.WriteMsg(msg); err != nil {
+		return err
+	}
+	r.record(false, msg.Code, msg.Size, payload)
+	return nil
+}
+
+// record appends a message to the session file. Failing to do so only disables
+// the recording, it doesn't interfere with the session itself.
+func (r *msgRecorder) record(inbound bool, code uint64, size uint32, payload []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.failed {
+		return
+	}
+	msg := &RecordedMsg{
+		Time:    uint64(time.Since(r.start)),
+		Inbound: inbound,
+		Code:    code,
+		Size:    size,
+		Payload: payload,
+	}
+	if err := rlp.Encode(r.out, msg); err != nil {
+		log.Warn("Failed to record eth message, recording disabled", "file", r.file.Name(), "err", err)
+		r.failed = true
+	}
+}
+
+// Close flushes the recording and closes the session file.
+func (r *msgRecorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.out.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadRecording reads the header and the messages of a recorded session.
+func ReadRecording(path string) (*RecordHeader, []*RecordedMsg, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	stream := rlp.NewStream(bufio.NewReader(file), 0)
+	header := new(RecordHeader)
+	if err := stream.Decode(header); err != nil {
+		return nil, nil, fmt.Errorf("invalid recording header: %v", err)
+	}
+	var msgs []*RecordedMsg
+	for {
+		msg := new(RecordedMsg)
+		if err := stream.Decode(msg); err == io.EOF {
+			break
+		} else if err != nil {
+			// A session cut short by a crash may leave a truncated message behind
+			if err == io.ErrUnexpectedEOF {
+				log.Warn("Recording truncated", "file", path, "messages", len(msgs))
+				break
+			}
+			return nil, nil, fmt.Errorf("invalid recorded message %d: %v", len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return header, msgs, nil
+}
+
+// ReplayResult is the outcome of replaying a recorded session.
+type ReplayResult struct {
+	Inbound  int   // Number of recorded inbound messages fed into the handler
+	Outbound int   // Number of messages sent by the handler in response
+	Err      error // Error the handler dropped the replayed peer with, if any
+}
+
+// replayTxPool is a transaction pool for replays, discarding any transactions
+// received from the replayed peer.
+type replayTxPool struct {
+	txFeed event.Feed
+}
+
+func (p *replayTxPool) Has(hash common.Hash) bool                   { return false }
+func (p *replayTxPool) Get(hash common.Hash) *types.Transaction     { return nil }
+func (p *replayTxPool) AddRemotes(txs []*types.Transaction) []error { return make([]error, len(txs)) }
+func (p *replayTxPool) Pending() (map[common.Address]types.Transactions, error) {
+	return make(map[common.Address]types.Transactions), nil
+}
+func (p *replayTxPool) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return p.txFeed.Subscribe(ch)
+}
+
+// Replay re-feeds the inbound messages of a recorded session into the eth
+// protocol handlers running on top of the given chain, as if the recorded peer
+// connected again. The messages sent by the handlers in response are drained.
+// If realtime is set, the messages are fed with their recorded timing, otherwise
+// as fast as they are consumed. After the last message, the handlers are given
+// linger time to act on it before the replayed peer is disconnected.
+//
+// Note, blocks delivered by the replayed peer are imported into the chain.
+func Replay(chain *core.BlockChain, db ethdb.Database, path string, realtime bool, linger time.Duration) (*ReplayResult, error) {
+	header, msgs, err := ReadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.Inbound && len(msg.Payload) != int(msg.Size) {
+			return nil, errors.New("session recorded without message payloads")
+		}
+	}
+	if _, ok := protocolLengths[header.Version]; !ok {
+		return nil, fmt.Errorf("unsupported eth protocol version %d", header.Version)
+	}
+	pm, err := NewProtocolManager(chain.Config(), nil, downloader.FullSync, header.NetworkID, new(event.TypeMux), new(replayTxPool), chain.Engine(), chain, db, 16, nil)
+	if err != nil {
+		return nil, err
+	}
+	pm.Start(1)
+	defer pm.Stop()
+
+	var (
+		app, net = p2p.MsgPipe()
+		peer     = pm.newPeer(int(header.Version), p2p.NewPeer(header.ID, header.Name, nil), net, pm.txpool.Get)
+		errc     = make(chan error, 1)
+		result   = new(ReplayResult)
+		drained  = make(chan struct{})
+	)
+	go func() {
+		err := pm.runPeer(peer)
+		net.Close()
+		errc <- err
+	}()
+
+	// Drain the handler responses until the pipe is torn down
+	go func() {
+		defer close(drained)
+		for {
+			msg, err := app.ReadMsg()
+			if err != nil {
+				return
+			}
+			log.Debug("Replay handler response", "code", msg.Code, "size", msg.Size)
+			msg.Discard()
+			result.Outbound++
+		}
+	}()
+	// Feed the recorded inbound messages, stopping if the handler drops the peer
+	start := time.Now()
+	for _, msg := range msgs {
+		if !msg.Inbound {
+			continue
+		}
+		if realtime {
+			if wait := time.Duration(msg.Time) - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err := app.WriteMsg(p2p.Msg{Code: msg.Code, Size: msg.Size, Payload: bytes.NewReader(msg.Payload)}); err != nil {
+			break
+		}
+		result.Inbound++
+	}
+	// Give the handlers some time to act on the last messages, then disconnect
+	select {
+	case result.Err = <-errc:
+	case <-time.After(linger):
+		app.Close()
+		if err := <-errc; err != p2p.ErrPipeClosed {
+			result.Err = err
+		}
+	}
+	<-drained
+	return result, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Tests that the eth messages exchanged with a peer are recorded, and that the
+// recorded session can be replayed into the handlers of another node.
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eth-record-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 8, nil, nil)
+	defer pm.Stop()
+	pm.recordDir, pm.recordPayloads = dir, true
+
+	// Run a session requesting some headers from the recording node
+	var id enode.ID
+	rand.Read(id[:])
+
+	app, net := p2p.MsgPipe()
+	errc := make(chan error, 1)
+	go func() { errc <- pm.makeProtocol(eth64).Run(p2p.NewPeer(id, "peer", nil), net) }()
+
+	var (
+		peer    = &testPeer{app: app, net: net, peer: newPeer(eth64, p2p.NewPeer(id, "peer", nil), net, nil)}
+		genesis = pm.blockchain.Genesis()
+		head    = pm.blockchain.CurrentHeader()
+		td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
+	)
+	peer.handshake(t, td, head.Hash(), genesis.Hash(), forkid.NewID(pm.blockchain), forkid.NewFilter(pm.blockchain))
+	if err := p2p.Send(app, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Number: 1}, Amount: 2}); err != nil {
+		t.Fatalf("failed to request headers: %v", err)
+	}
+	headers := []*types.Header{pm.blockchain.GetHeaderByNumber(1), pm.blockchain.GetHeaderByNumber(2)}
+	if err := p2p.ExpectMsg(app, BlockHeadersMsg, headers); err != nil {
+		t.Fatalf("headers mismatch: %v", err)
+	}
+	app.Close()
+	<-errc
+
+	// Check the contents of the recording
+	files, err := filepath.Glob(filepath.Join(dir, "*.rlp"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("recordings mismatch: have %v, want 1 (err %v)", files, err)
+	}
+	header, msgs, err := ReadRecording(files[0])
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if header.ID != id || header.Version != eth64 || header.HeadHash != head.Hash() {
+		t.Errorf("recording header mismatch: %+v", header)
+	}
+	want := map[bool][]uint64{
+		true:  {StatusMsg, GetBlockHeadersMsg},
+		false: {StatusMsg, BlockHeadersMsg},
+	}
+	have := make(map[bool][]uint64)
+	for _, msg := range msgs {
+		if len(msg.Payload) != int(msg.Size) {
+			t.Errorf("message %d payload size mismatch: have %d, want %d", msg.Code, len(msg.Payload), msg.Size)
+		}
+		have[msg.Inbound] = append(have[msg.Inbound], msg.Code)
+	}
+	for inbound, codes := range want {
+		if len(have[inbound]) != len(codes) {
+			t.Fatalf("inbound %v messages mismatch: have %v, want %v", inbound, have[inbound], codes)
+		}
+		for i, code := range codes {
+			if have[inbound][i] != code {
+				t.Errorf("inbound %v message %d mismatch: have %d, want %d", inbound, i, have[inbound][i], code)
+			}
+		}
+	}
+	// Replay the session into an identical node
+	replayer, db := newTestProtocolManagerMust(t, downloader.FullSync, 8, nil, nil)
+	defer replayer.Stop()
+
+	result, err := Replay(replayer.blockchain, db, files[0], false, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to replay session: %v", err)
+	}
+	if result.Err != nil {
+		t.Errorf("replayed peer dropped: %v", result.Err)
+	}
+	if result.Inbound != 2 || result.Outbound != 2 {
+		t.Errorf("replayed messages mismatch: have %d/%d, want 2/2", result.Inbound, result.Outbound)
+	}
+}
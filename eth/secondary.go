@@ -0,0 +1,71 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// errSecondaryTransaction is returned if a transaction is sent to a secondary
+// instance, which has no peers to propagate it to.
+var errSecondaryTransaction = errors.New("secondary instance can't propagate transactions, send them to the primary node")
+
+// setupSecondaryGenesis loads the chain configuration stored by the primary
+// process of a secondary database, the latter being read-only. The genesis
+// block, if given, must match the stored one.
+func setupSecondaryGenesis(db ethdb.Database, genesis *genesisT.Genesis) (ctypes.ChainConfigurator, common.Hash, error) {
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	if stored == (common.Hash{}) {
+		return nil, common.Hash{}, errors.New("primary chain database not initialised")
+	}
+	if genesis != nil {
+		if hash := core.GenesisToBlock(genesis, nil).Hash(); hash != stored {
+			return nil, hash, &genesisT.GenesisMismatchError{Stored: stored, New: hash}
+		}
+	}
+	config := rawdb.ReadChainConfig(db, stored)
+	if config == nil {
+		return nil, stored, errors.New("primary chain database without chain config")
+	}
+	return config, stored, nil
+}
+
+// checkSecondaryVersion ensures the database of the primary process is at the
+// version and key schema this client supports, as a secondary can't upgrade it.
+func checkSecondaryVersion(db ethdb.Database) error {
+	version := rawdb.ReadDatabaseVersion(db)
+	if version == nil || *version != core.BlockChainVersion {
+		have := "<nil>"
+		if version != nil {
+			have = fmt.Sprintf("v%d", *version)
+		}
+		return fmt.Errorf("primary database version is %s, Geth %s only follows v%d", have, params.VersionWithMeta, core.BlockChainVersion)
+	}
+	if have, want := rawdb.ReadSchemaVersion(db), rawdb.LatestSchemaVersion(rawdb.SchemaMigrations); have != want {
+		return fmt.Errorf("primary database schema version is %d, want %d", have, want)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// defaultStateMinResponse is the amount of state data served in response to
+// every request regardless of the serving budget, so that syncing peers always
+// make progress.
+const defaultStateMinResponse = 16 * 1024
+
+var (
+	stateServedMeter    = metrics.NewRegisteredMeter("eth/serving/state/bytes", nil)
+	stateThrottledMeter = metrics.NewRegisteredMeter("eth/serving/state/throttled", nil)
+	stateServingTimer   = metrics.NewRegisteredTimer("eth/serving/state/time", nil)
+	stateBudgetGauge    = metrics.NewRegisteredGauge("eth/serving/state/budget", nil)
+)
+
+// ServingBudgetStatus is the budget of the state data served to the syncing
+// peers, and how much of it was used.
+type ServingBudgetStatus struct {
+	Rate        uint64 `json:"rate"`        // Bytes per second served to all peers together (0 = unlimited)
+	MinResponse uint64 `json:"minResponse"` // Bytes served in response to every request regardless of the budget
+	Available   int64  `json:"available"`   // Bytes that may currently be served, may go negative after a large item
+	Served      uint64 `json:"served"`      // Bytes served since the node started
+	Throttled   uint64 `json:"throttled"`   // Responses cut short by the budget since the node started
+}
+
+// servingBudget limits the state data served to the syncing peers, shared by
+// all of them, so that the node can devote its resources to other work under
+// load. Requests are still answered, with as much data as the budget allows,
+// but at least the minimum response.
+type servingBudget struct {
+	rate        uint64 // Bytes per second (0 = unlimited)
+	minResponse uint64
+
+	bytes     float64   // Remaining bytes, may go negative after a large item
+	updated   time.Time // Last time the budget was recharged
+	served    uint64
+	throttled uint64
+	lock      sync.Mutex
+}
+
+// newServingBudget creates a budget serving the given bytes per second.
+func newServingBudget(rate uint64) *servingBudget {
+	return &servingBudget{
+		rate:        rate,
+		minResponse: defaultStateMinResponse,
+		bytes:       float64(rate),
+		updated:     time.Now(),
+	}
+}
+
+// recharge tops up the budget with the bytes accrued since the last recharge,
+// up to one second worth of serving. The lock must be held.
+func (b *servingBudget) recharge() {
+	now := time.Now()
+	b.bytes += now.Sub(b.updated).Seconds() * float64(b.rate)
+	if b.bytes > float64(b.rate) {
+		b.bytes = float64(b.rate)
+	}
+	b.updated = now
+	stateBudgetGauge.Update(int64(b.bytes))
+}
+
+// allow reports whether more state data may be added to a response already
+// holding the given number of bytes.
+func (b *servingBudget) allow(size int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.rate == 0 || uint64(size) < b.minResponse {
+		return true
+	}
+	b.recharge()
+	return b.bytes > float64(size)
+}
+
+// charge deducts the size of a response from the budget, recording whether it
+// was cut short by it.
+func (b *servingBudget) charge(size int, throttled bool, elapsed time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.served += uint64(size)
+	if throttled {
+		b.throttled++
+		stateThrottledMeter.Mark(1)
+	}
+	if b.rate != 0 {
+		b.bytes -= float64(size)
+		stateBudgetGauge.Update(int64(b.bytes))
+	}
+	stateServedMeter.Mark(int64(size))
+	stateServingTimer.Update(elapsed)
+}
+
+// set replaces the rate and, if non-nil, the minimum response of the budget.
+func (b *servingBudget) set(rate uint64, minResponse *uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.recharge()
+	b.rate = rate
+	if minResponse != nil {
+		b.minResponse = *minResponse
+	}
+	if b.bytes > float64(rate) {
+		b.bytes = float64(rate)
+	}
+}
+
+// status returns the settings and the usage of the budget.
+func (b *servingBudget) status() *ServingBudgetStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.recharge()
+	return &ServingBudgetStatus{
+		Rate:        b.rate,
+		MinResponse: b.minResponse,
+		Available:   int64(b.bytes),
+		Served:      b.served,
+		Throttled:   b.throttled,
+	}
+}
+
+// SetServingBudget limits the state data served to the syncing peers to the
+// given bytes per second, shared by all of them (0 = unlimited). Every request
+// is still answered with at least minResponse bytes, if given, so the node keeps
+// serving the network while deprioritizing it.
+func (api *PrivateAdminAPI) SetServingBudget(rate uint64, minResponse *uint64) *ServingBudgetStatus {
+	budget := api.eth.protocolManager.stateBudget
+	budget.set(rate, minResponse)
+	return budget.status()
+}
+
+// ServingBudget returns the budget of the state data served to the syncing peers
+// and how much of it was used.
+func (api *PrivateAdminAPI) ServingBudget() *ServingBudgetStatus {
+	return api.eth.protocolManager.stateBudget.status()
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// Tests that the state data served to the peers is cut short by the serving
+// budget, down to the minimum response, and served in full once lifted.
+func TestServingBudget(t *testing.T) {
+	pm, db := newTestProtocolManagerMust(t, downloader.FullSync, 4, nil, nil)
+	defer pm.Stop()
+
+	peer, _ := newTestPeer("peer", eth64, pm, true)
+	defer peer.close()
+
+	var hashes []common.Hash
+	it := db.NewIterator(nil, nil)
+	for it.Next() {
+		if key := it.Key(); len(key) == common.HashLength {
+			hashes = append(hashes, common.BytesToHash(key))
+		}
+	}
+	it.Release()
+	if len(hashes) < 2 {
+		t.Fatalf("too few state entries: %d", len(hashes))
+	}
+	request := func() [][]byte {
+		p2p.Send(peer.app, GetNodeDataMsg, hashes)
+		msg, err := peer.app.ReadMsg()
+		if err != nil {
+			t.Fatalf("failed to read node data response: %v", err)
+		}
+		var data [][]byte
+		if err := msg.Decode(&data); err != nil {
+			t.Fatalf("failed to decode node data response: %v", err)
+		}
+		return data
+	}
+	api := NewPrivateAdminAPI(&Ethereum{protocolManager: pm, chainDb: db})
+
+	minResponse := uint64(1)
+	if status := api.SetServingBudget(1, &minResponse); status.Rate != 1 || status.MinResponse != 1 {
+		t.Fatalf("budget not set: %+v", status)
+	}
+	if data := request(); len(data) != 1 {
+		t.Fatalf("throttled response size mismatch: have %d entries, want 1", len(data))
+	}
+	if status := api.ServingBudget(); status.Throttled != 1 {
+		t.Fatalf("throttled responses mismatch: have %d, want 1", status.Throttled)
+	}
+	api.SetServingBudget(0, nil)
+	if data := request(); len(data) != len(hashes) {
+		t.Fatalf("unlimited response size mismatch: have %d entries, want %d", len(data), len(hashes))
+	}
+	if status := api.ServingBudget(); status.Throttled != 1 || status.MinResponse != 1 {
+		t.Fatalf("budget status mismatch: %+v", status)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/fourbyte"
+)
+
+// signatureDB is the 4byte database of function and event signatures used to
+// annotate the calls and logs of contracts without a registered ABI. The bundled
+// database is large, so it's only loaded on first use.
+type signatureDB struct {
+	path string // File the custom signatures are persisted in
+
+	once sync.Once
+	db   *fourbyte.Database
+	err  error
+}
+
+// database loads the signature database on first use.
+func (s *signatureDB) database() (*fourbyte.Database, error) {
+	s.once.Do(func() {
+		if s.db, s.err = fourbyte.NewWithFile(s.path); s.err != nil {
+			log.Warn("Failed to load the signature database", "path", s.path, "err", s.err)
+			return
+		}
+		embedded, custom := s.db.Size()
+		log.Debug("Loaded the signature database", "embedded", embedded, "custom", custom)
+	})
+	return s.db, s.err
+}
+
+// signature looks up the signature of the 4byte selector of the call data.
+func (s *signatureDB) signature(input []byte) string {
+	if len(input) < 4 {
+		return ""
+	}
+	db, err := s.database()
+	if err != nil {
+		return ""
+	}
+	sig, _ := db.Selector(input)
+	return sig
+}
+
+// decodeInput decodes a call with the signature of its 4byte selector. The
+// arguments are unnamed, so they are keyed by their position.
+func (s *signatureDB) decodeInput(input []byte) (*DecodedCall, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+	sig, values, err := db.Decode(input)
+	if err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		args[strconv.Itoa(i)] = formatABIValue(reflect.ValueOf(value))
+	}
+	return &DecodedCall{Method: signatureName(sig), Signature: sig, Args: args}, nil
+}
+
+// annotateLog names the event of a log not decoded by a registered ABI with
+// the signature of its topic. The arguments are left undecoded as signatures
+// don't tell which of them are indexed.
+func (s *signatureDB) annotateLog(decoded *DecodedLog) {
+	if decoded.Error != errNoABI.Error() || len(decoded.Log.Topics) == 0 {
+		return
+	}
+	db, err := s.database()
+	if err != nil {
+		return
+	}
+	if sig, err := db.Event(decoded.Log.Topics[0]); err == nil {
+		decoded.Event, decoded.Signature, decoded.Error = signatureName(sig), sig, ""
+	}
+}
+
+// signatureName returns the name of a function or event signature, the whole
+// signature if it has no argument list.
+func signatureName(sig string) string {
+	if i := strings.Index(sig, "("); i >= 0 {
+		return sig[:i]
+	}
+	return sig
+}
+
+// annotateCallFrames adds the signatures of the called functions to the frames
+// of a call tracer result, recursing into the nested calls.
+func (s *signatureDB) annotateCallFrames(result json.RawMessage) json.RawMessage {
+	var frame map[string]interface{}
+	if err := json.Unmarshal(result, &frame); err != nil {
+		return result // Not a call frame
+	}
+	s.annotateCallFrame(frame)
+	annotated, err := json.Marshal(frame)
+	if err != nil {
+		return result
+	}
+	return annotated
+}
+
+func (s *signatureDB) annotateCallFrame(frame map[string]interface{}) {
+	if input, ok := frame["input"].(string); ok {
+		if data, err := hexutil.Decode(input); err == nil {
+			if sig := s.signature(data); sig != "" {
+				frame["signature"] = sig
+			}
+		}
+	}
+	calls, _ := frame["calls"].([]interface{})
+	for _, call := range calls {
+		if call, ok := call.(map[string]interface{}); ok {
+			s.annotateCallFrame(call)
+		}
+	}
+}
+
+// Signature is a function or event signature of the 4byte database.
+type Signature struct {
+	Selector  hexutil.Bytes `json:"selector"`
+	Signature string        `json:"signature"`
+}
+
+// LookupSignature returns the signature of a 4 byte function selector or a 32
+// byte event topic.
+func (api *PublicABIAPI) LookupSignature(id hexutil.Bytes) (*Signature, error) {
+	db, err := api.eth.signatures.database()
+	if err != nil {
+		return nil, err
+	}
+	var sig string
+	switch len(id) {
+	case 4:
+		sig, err = db.Selector(id)
+	case common.HashLength:
+		sig, err = db.Event(common.BytesToHash(id))
+	default:
+		return nil, fmt.Errorf("invalid selector length %d, want 4 or 32 bytes", len(id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{Selector: id, Signature: sig}, nil
+}
+
+// AddFunctionSignature adds a custom function signature, e.g. transfer(address,uint256),
+// to the 4byte database, returning its selector.
+func (api *PrivateABIAPI) AddFunctionSignature(signature string) (hexutil.Bytes, error) {
+	db, err := api.eth.signatures.database()
+	if err != nil {
+		return nil, err
+	}
+	return db.AddFunction(signature)
+}
+
+// AddEventSignature adds a custom event signature, e.g. Transfer(address,address,uint256),
+// to the 4byte database, returning its topic.
+func (api *PrivateABIAPI) AddEventSignature(signature string) (common.Hash, error) {
+	db, err := api.eth.signatures.database()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return db.AddEvent(signature)
+}
+
+// ImportSignatures merges a 4byte database file of the node, mapping hex
+// selectors to signatures, into the custom signatures, returning the number of
+// signatures added.
+func (api *PrivateABIAPI) ImportSignatures(path string) (int, error) {
+	db, err := api.eth.signatures.database()
+	if err != nil {
+		return 0, err
+	}
+	return db.Import(path)
+}
+
+// decodeLog decodes a log with the ABI registered for the emitting contract,
+// falling back to the 4byte database for the event name.
+func (api *PublicABIAPI) decodeLog(log *types.Log) *DecodedLog {
+	decoded := api.eth.abis.decodeLog(log)
+	api.eth.signatures.annotateLog(decoded)
+	return decoded
+}
+
+// decodeInput decodes a call with the ABI registered for the called contract,
+// falling back to the 4byte database.
+func (api *PublicABIAPI) decodeInput(address common.Address, input []byte) (*DecodedCall, error) {
+	decoded, err := api.eth.abis.decodeInput(address, input)
+	if err == errNoABI {
+		return api.eth.signatures.decodeInput(input)
+	}
+	return decoded, err
+}
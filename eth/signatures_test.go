@@ -0,0 +1,35 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import "testing"
+
+// Tests that signature names are extracted without choking on the malformed
+// signatures of user supplied databases.
+func TestSignatureName(t *testing.T) {
+	tests := map[string]string{
+		"transfer(address,uint256)": "transfer",
+		"Transfer()":                "Transfer",
+		"fallback":                  "fallback",
+		"":                          "",
+	}
+	for sig, want := range tests {
+		if have := signatureName(sig); have != want {
+			t.Errorf("%q: name mismatch: have %q, want %q", sig, have, want)
+		}
+	}
+}
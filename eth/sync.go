@@ -258,6 +258,13 @@ func (cs *chainSyncer) nextSyncOp() *chainSyncOp {
 		return nil
 	}
 	mode, ourTD := cs.modeAndLocalHead()
+
+	// Prefer the pinned peer as long as it's ahead of us
+	if pinned := cs.pm.peers.Peer(cs.pm.downloader.PinnedPeer()); pinned != nil {
+		if _, td := pinned.Head(); td.Cmp(ourTD) > 0 {
+			peer = pinned
+		}
+	}
 	op := peerToSyncOp(mode, peer)
 	if op.td.Cmp(ourTD) <= 0 {
 		return nil // We're in sync.
@@ -0,0 +1,69 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// syncPeerID converts an enode URL or node ID, full or as abbreviated by the
+// downloader, into the identifier of the peer in the downloader.
+func syncPeerID(id string) (string, error) {
+	if strings.HasPrefix(id, "enode://") {
+		node, err := enode.ParseV4(id)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", node.ID().Bytes()[:8]), nil
+	}
+	if nodeID, err := enode.ParseID(id); err == nil {
+		return fmt.Sprintf("%x", nodeID.Bytes()[:8]), nil
+	}
+	id = strings.ToLower(strings.TrimPrefix(id, "0x"))
+	if short, err := hex.DecodeString(id); err == nil && len(short) == 8 {
+		return id, nil
+	}
+	return "", errors.New("invalid peer id: want an enode URL or node ID")
+}
+
+// SyncPeers returns which peers are serving header, body, receipt and state
+// downloads, with their throughput and request counters since they connected.
+func (api *PrivateAdminAPI) SyncPeers() []downloader.PeerSyncStats {
+	return api.eth.Downloader().PeerStats()
+}
+
+// PinSyncPeer sets the peer preferred for sync downloads whenever it's idle, and
+// as the source of the syncs if it's ahead of the local chain. The peer doesn't
+// have to be connected yet. An empty id unpins the pinned peer.
+func (api *PrivateAdminAPI) PinSyncPeer(id string) (bool, error) {
+	if id == "" {
+		api.eth.Downloader().PinPeer("")
+		return true, nil
+	}
+	peer, err := syncPeerID(id)
+	if err != nil {
+		return false, err
+	}
+	api.eth.Downloader().PinPeer(peer)
+	return true, nil
+}
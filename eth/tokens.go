@@ -0,0 +1,152 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxTokenBalances is the maximum number of tokens token_getBalances queries
+	// the balance of in a single call.
+	maxTokenBalances = 1000
+
+	// maxTokenTransfers is the maximum number of transfers token_getTransfers
+	// returns in a single call.
+	maxTokenTransfers = 10000
+
+	// tokenCallGas is the gas allowance of a balanceOf call.
+	tokenCallGas = 100000
+)
+
+// balanceOfSelector is the ABI selector of balanceOf(address), shared by the
+// ERC-20 and ERC-721 standards.
+var balanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+
+// TokenBalance is the balance of an account in a token.
+type TokenBalance struct {
+	Token   common.Address `json:"token"`
+	Balance *hexutil.Big   `json:"balance"` // Amount of ERC-20 tokens, or number of ERC-721 tokens
+}
+
+// TokenTransfer is a token transfer found in the canonical chain.
+type TokenTransfer struct {
+	Token           common.Address `json:"token"`
+	From            common.Address `json:"from"`
+	To              common.Address `json:"to"`
+	Value           *hexutil.Big   `json:"value,omitempty"`   // Amount of ERC-20 tokens transferred
+	TokenID         *hexutil.Big   `json:"tokenId,omitempty"` // Id of the ERC-721 token transferred
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	BlockHash       common.Hash    `json:"blockHash"`
+	TransactionHash common.Hash    `json:"transactionHash"`
+	LogIndex        hexutil.Uint   `json:"logIndex"`
+}
+
+// PublicTokenAPI provides access to the ERC-20 and ERC-721 token transfers and
+// holdings recorded by the token index.
+type PublicTokenAPI struct {
+	eth *Ethereum
+}
+
+// NewPublicTokenAPI creates a new token API.
+func NewPublicTokenAPI(eth *Ethereum) *PublicTokenAPI {
+	return &PublicTokenAPI{eth: eth}
+}
+
+// GetBalances returns the non-zero balances of the given account in the tokens it
+// ever sent or received, as reported by the token contracts at the chain head.
+func (api *PublicTokenAPI) GetBalances(ctx context.Context, address common.Address) ([]*TokenBalance, error) {
+	tokens := rawdb.ReadTokenHoldings(api.eth.chainDb, address)
+	if len(tokens) > maxTokenBalances {
+		return nil, fmt.Errorf("account holds %d tokens, more than the limit of %d", len(tokens), maxTokenBalances)
+	}
+	var (
+		gas      = hexutil.Uint64(tokenCallGas)
+		data     = hexutil.Bytes(append(append([]byte{}, balanceOfSelector...), common.LeftPadBytes(address.Bytes(), 32)...))
+		latest   = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		balances = []*TokenBalance{}
+	)
+	for _, token := range tokens {
+		token := token
+		args := ethapi.CallArgs{To: &token, Gas: &gas, Data: &data}
+		res, err := ethapi.DoCall(ctx, api.eth.APIBackend, args, latest, nil, vm.Config{}, 5*time.Second, api.eth.config.RPCGasCap)
+		if err != nil {
+			return nil, err
+		}
+		// Skip contracts not implementing balanceOf, e.g. ones only emitting lookalike events
+		if res.Failed() || len(res.ReturnData) != 32 {
+			continue
+		}
+		if balance := new(big.Int).SetBytes(res.ReturnData); balance.Sign() > 0 {
+			balances = append(balances, &TokenBalance{Token: token, Balance: (*hexutil.Big)(balance)})
+		}
+	}
+	return balances, nil
+}
+
+// GetTransfers returns the token transfers sent or received by the given account
+// in the given range of canonical blocks.
+func (api *PublicTokenAPI) GetTransfers(address common.Address, from, to rpc.BlockNumber) ([]*TokenTransfer, error) {
+	begin, end, err := ethapi.ResolveBlockRange(api.eth.blockchain.CurrentBlock().NumberU64(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	transfers := []*TokenTransfer{}
+	for _, entry := range rawdb.ReadTokenTransfers(api.eth.chainDb, address, begin, end) {
+		if rawdb.ReadCanonicalHash(api.eth.chainDb, entry.BlockNumber) != entry.BlockHash {
+			continue
+		}
+		if len(transfers) == maxTokenTransfers {
+			return nil, fmt.Errorf("query returned more than %d transfers", maxTokenTransfers)
+		}
+		transfer := &TokenTransfer{
+			Token:           entry.Transfer.Token,
+			From:            entry.Transfer.From,
+			To:              entry.Transfer.To,
+			BlockNumber:     hexutil.Uint64(entry.BlockNumber),
+			BlockHash:       entry.BlockHash,
+			TransactionHash: entry.Transfer.TxHash,
+			LogIndex:        hexutil.Uint(entry.Transfer.LogIndex),
+		}
+		if entry.Transfer.NonFungible {
+			transfer.TokenID = (*hexutil.Big)(entry.Transfer.Value)
+		} else {
+			transfer.Value = (*hexutil.Big)(entry.Transfer.Value)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// GetHolders returns the accounts which ever sent or received the given token.
+func (api *PublicTokenAPI) GetHolders(token common.Address) []common.Address {
+	holders := rawdb.ReadTokenHolders(api.eth.chainDb, token)
+	if holders == nil {
+		holders = []common.Address{}
+	}
+	return holders
+}
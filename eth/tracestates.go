@@ -0,0 +1,104 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// traceStatesCheckpoint is the interval of the blocks whose regenerated state
+	// is retained along a regeneration, besides the traced one, so that the traces
+	// of the blocks in between only reexecute from the checkpoint before them.
+	traceStatesCheckpoint = defaultTraceReexec
+
+	// traceStatesRetained is the maximum number of regenerated states retained.
+	traceStatesRetained = 32
+
+	// traceStatesMemory is the maximum size of the retained trie nodes, the oldest
+	// states being released beyond it.
+	traceStatesMemory = 256 * 1024 * 1024
+)
+
+// traceStates regenerates the historical states the tracers need when they are
+// beyond the reexecution limit of a trace, reexecuting up to a block budget from
+// the nearest available state. The regenerated states are retained in memory
+// for the subsequent traces in the same range.
+type traceStates struct {
+	budget   uint64         // Maximum number of blocks to reexecute
+	database state.Database // Trie database holding the retained states
+	retained []retainedState
+	lock     sync.Mutex // Serializes the regenerations
+}
+
+// retainedState is a regenerated state referenced in the trie database.
+type retainedState struct {
+	number uint64
+	root   common.Hash
+}
+
+// newTraceStates creates a regenerator of the historical states of the chain in
+// the given database, reexecuting up to budget blocks.
+func newTraceStates(db ethdb.Database, budget uint64) *traceStates {
+	return &traceStates{
+		budget:   budget,
+		database: state.NewDatabaseWithCache(db, 16, ""),
+	}
+}
+
+// retain keeps the state of the given block referenced, releasing the oldest
+// retained states beyond the limits.
+func (s *traceStates) retain(number uint64, root common.Hash) {
+	for _, retained := range s.retained {
+		if retained.root == root {
+			return
+		}
+	}
+	s.database.TrieDB().Reference(root, common.Hash{})
+	s.retained = append(s.retained, retainedState{number: number, root: root})
+
+	for len(s.retained) > 1 {
+		if nodes, _ := s.database.TrieDB().Size(); len(s.retained) <= traceStatesRetained && nodes <= traceStatesMemory {
+			break
+		}
+		log.Debug("Released regenerated state", "number", s.retained[0].number, "root", s.retained[0].root)
+		s.database.TrieDB().Dereference(s.retained[0].root)
+		s.retained = s.retained[1:]
+	}
+}
+
+// pin keeps the given state referenced until the returned release is called, so
+// it outlives the retained states released meanwhile by concurrent regenerations.
+// The caller must hold the lock, which release takes itself.
+func (s *traceStates) pin(root common.Hash) func() {
+	s.database.TrieDB().Reference(root, common.Hash{})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			s.database.TrieDB().Dereference(root)
+		})
+	}
+}
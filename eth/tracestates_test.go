@@ -0,0 +1,101 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// Tests that the historical states beyond the reexecution limit of a trace are
+// regenerated within the block budget, and retained for the subsequent traces.
+func TestTraceStateRegeneration(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &genesisT.Genesis{Config: params.TestChainConfig}
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 600, nil)
+
+	// Only the genesis and the most recent states are available
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(&Ethereum{blockchain: chain, chainDb: db})
+	if _, _, err := api.computeStateDB(chain.GetBlockByNumber(200), 64); err == nil {
+		t.Fatal("state beyond the reexecution limit regenerated without a budget")
+	}
+	regen := newTraceStates(db, 256)
+	api = NewPrivateDebugAPI(&Ethereum{blockchain: chain, chainDb: db, traceStates: regen})
+
+	// Beyond the budget, the state is still unavailable
+	if _, _, err := api.computeStateDB(chain.GetBlockByNumber(300), 64); err == nil {
+		t.Fatal("state beyond the budget regenerated")
+	}
+	var release func()
+	for _, number := range []uint64{200, 220, 150} {
+		block := chain.GetBlockByNumber(number)
+		statedb, done, err := api.computeStateDB(block, 64)
+		if err != nil {
+			t.Fatalf("block #%d: failed to regenerate state: %v", number, err)
+		}
+		if root := statedb.IntermediateRoot(false); root != block.Root() {
+			t.Fatalf("block #%d: regenerated root mismatch: have %x, want %x", number, root, block.Root())
+		}
+		if release != nil {
+			release()
+		}
+		release = done
+	}
+	// The checkpoint and traced states are retained, and let the later blocks
+	// reexecute from them within the trace's own limit
+	want := []uint64{128, 200, 220, 150}
+	if len(regen.retained) != len(want) {
+		t.Fatalf("retained states mismatch: have %v, want %v", regen.retained, want)
+	}
+	for i, number := range want {
+		if regen.retained[i].number != number {
+			t.Fatalf("retained state %d mismatch: have #%d, want #%d", i, regen.retained[i].number, number)
+		}
+	}
+	// The oldest states are released beyond the retention limit
+	for i := 0; i < traceStatesRetained; i++ {
+		block := chain.GetBlockByNumber(uint64(221 + i))
+		regen.retain(block.NumberU64(), block.Root())
+	}
+	if len(regen.retained) != traceStatesRetained || regen.retained[0].number != 221 {
+		t.Fatalf("retention limit not enforced: %d states retained from #%d", len(regen.retained), regen.retained[0].number)
+	}
+	// The state still being traced outlives its release from the retained ones
+	root := chain.GetBlockByNumber(150).Root()
+	if _, err := state.New(root, regen.database, nil); err != nil {
+		t.Fatalf("pinned state released: %v", err)
+	}
+	release()
+	if _, err := state.New(root, regen.database, nil); err == nil {
+		t.Fatal("state retained after its trace finished")
+	}
+}
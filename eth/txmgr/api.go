@@ -0,0 +1,48 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package txmgr
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PublicTxManagerAPI offers an API to follow the transactions tracked by the local
+// transaction manager.
+type PublicTxManagerAPI struct {
+	m *Manager
+}
+
+// NewPublicTxManagerAPI creates a new API for the given transaction manager.
+func NewPublicTxManagerAPI(m *Manager) *PublicTxManagerAPI {
+	return &PublicTxManagerAPI{m}
+}
+
+// Status returns the lifecycle of the transactions submitted through this node,
+// optionally filtered to a single sender.
+func (api *PublicTxManagerAPI) Status(from *common.Address) []*TxStatus {
+	statuses := api.m.Status()
+	if from == nil {
+		return statuses
+	}
+	filtered := make([]*TxStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if status.From == *from {
+			filtered = append(filtered, status)
+		}
+	}
+	return filtered
+}
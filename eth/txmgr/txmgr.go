@@ -0,0 +1,364 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package txmgr implements a manager for the transactions submitted through the
+// local node, which keeps them alive until they are included in the chain.
+package txmgr
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// finishedRetention is the time a transaction is still reported after it was
+// included, replaced or dropped.
+const finishedRetention = time.Hour
+
+// Lifecycle states of a tracked transaction.
+const (
+	StatusPending  = "pending"  // Transaction is waiting for inclusion
+	StatusIncluded = "included" // Transaction was included in the canonical chain
+	StatusReplaced = "replaced" // Another transaction with the same nonce was included or submitted
+	StatusDropped  = "dropped"  // Transaction left the pool and could not be resubmitted
+)
+
+// Config are the configuration parameters of the local transaction manager.
+type Config struct {
+	Enabled      bool          // Whether to track the transactions submitted through the node
+	Rebroadcast  time.Duration // Interval between rebroadcasts of pending transactions
+	BumpInterval time.Duration // Time after which a pending transaction is resubmitted with a higher gas price (0 = never)
+	BumpPercent  uint64        // Percentage to raise the gas price with on each bump (at least the pool's price bump)
+	PriceCap     *big.Int      `toml:",omitempty"` // Gas price a transaction is never bumped over (nil = no bumping)
+}
+
+// DefaultConfig contains the default settings of the local transaction manager.
+var DefaultConfig = Config{
+	Rebroadcast: 5 * time.Minute,
+	BumpPercent: 10,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if conf.Rebroadcast < time.Second {
+		log.Warn("Sanitizing invalid txmgr rebroadcast interval", "provided", conf.Rebroadcast, "updated", DefaultConfig.Rebroadcast)
+		conf.Rebroadcast = DefaultConfig.Rebroadcast
+	}
+	if conf.BumpPercent == 0 {
+		log.Warn("Sanitizing invalid txmgr price bump", "provided", conf.BumpPercent, "updated", DefaultConfig.BumpPercent)
+		conf.BumpPercent = DefaultConfig.BumpPercent
+	}
+	return conf
+}
+
+// Backend wraps all methods required by the transaction manager.
+type Backend interface {
+	BlockChain() *core.BlockChain
+	TxPool() *core.TxPool
+	AccountManager() *accounts.Manager
+	ChainDb() ethdb.Database
+}
+
+// TxStatus is the lifecycle of a transaction tracked by the manager.
+type TxStatus struct {
+	Hash          common.Hash     `json:"hash"`
+	From          common.Address  `json:"from"`
+	Nonce         hexutil.Uint64  `json:"nonce"`
+	GasPrice      *hexutil.Big    `json:"gasPrice"`
+	Status        string          `json:"status"`
+	Submitted     time.Time       `json:"submitted"`
+	Broadcasts    int             `json:"broadcasts"`
+	LastBroadcast *time.Time      `json:"lastBroadcast"`
+	BlockHash     *common.Hash    `json:"blockHash"`
+	BlockNumber   *hexutil.Uint64 `json:"blockNumber"`
+	ReplacedBy    *common.Hash    `json:"replacedBy"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// tracked is a transaction tracked by the manager.
+type tracked struct {
+	tx     *types.Transaction
+	from   common.Address
+	status TxStatus
+	done   time.Time // Time the transaction left the pending state
+}
+
+// Manager tracks the transactions submitted through the local node, rebroadcasts
+// them while pending, and optionally bumps their gas price on a schedule.
+type Manager struct {
+	config    Config
+	backend   Backend
+	broadcast func(types.Transactions)
+
+	txs  map[common.Hash]*tracked
+	lock sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a local transaction manager. Rebroadcasts are delivered to the
+// network through the given callback.
+func New(config Config, backend Backend, broadcast func(types.Transactions)) *Manager {
+	return &Manager{
+		config:    config.sanitize(),
+		backend:   backend,
+		broadcast: broadcast,
+		txs:       make(map[common.Hash]*tracked),
+		quit:      make(chan struct{}),
+	}
+}
+
+// Start launches the background loop of the manager.
+func (m *Manager) Start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// Stop terminates the background loop of the manager.
+func (m *Manager) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// Track starts tracking a transaction which was successfully submitted to the
+// local pool.
+func (m *Manager) Track(tx *types.Transaction) {
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return // Can't happen, the pool accepted it
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.track(tx, from)
+}
+
+// track inserts a transaction into the tracked set, marking any pending one with
+// the same sender and nonce as replaced. The lock must be held.
+func (m *Manager) track(tx *types.Transaction, from common.Address) {
+	hash := tx.Hash()
+	if _, ok := m.txs[hash]; ok {
+		return
+	}
+	for _, t := range m.txs {
+		if t.status.Status == StatusPending && t.from == from && t.tx.Nonce() == tx.Nonce() {
+			t.finish(StatusReplaced)
+			t.status.ReplacedBy = &hash
+		}
+	}
+	m.txs[hash] = &tracked{
+		tx:   tx,
+		from: from,
+		status: TxStatus{
+			Hash:      hash,
+			From:      from,
+			Nonce:     hexutil.Uint64(tx.Nonce()),
+			GasPrice:  (*hexutil.Big)(tx.GasPrice()),
+			Status:    StatusPending,
+			Submitted: time.Now(),
+		},
+	}
+}
+
+// finish moves a transaction out of the pending state.
+func (t *tracked) finish(status string) {
+	t.status.Status = status
+	t.done = time.Now()
+}
+
+// Status returns the lifecycle of all the tracked transactions, ordered by the
+// time they were submitted.
+func (m *Manager) Status() []*TxStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	statuses := make([]*TxStatus, 0, len(m.txs))
+	for _, t := range m.txs {
+		status := t.status
+		statuses = append(statuses, &status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Submitted.Before(statuses[j].Submitted)
+	})
+	return statuses
+}
+
+// loop updates the tracked transactions on every new head, and rebroadcasts or
+// bumps the pending ones periodically.
+func (m *Manager) loop() {
+	defer m.wg.Done()
+
+	headCh := make(chan core.ChainHeadEvent, 10)
+	headSub := m.backend.BlockChain().SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	rebroadcast := time.NewTicker(m.config.Rebroadcast)
+	defer rebroadcast.Stop()
+
+	for {
+		select {
+		case <-headCh:
+			m.update()
+
+		case <-rebroadcast.C:
+			m.update()
+			m.resubmit()
+
+		case <-headSub.Err():
+			return
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// update checks the pending transactions against the chain, marking the ones
+// included in it, or made obsolete by another transaction with the same nonce.
+// Transactions not pending any more are forgotten after a while.
+func (m *Manager) update() {
+	statedb, err := m.backend.BlockChain().State()
+	if err != nil {
+		log.Warn("Failed to retrieve state for txmgr", "err", err)
+		return
+	}
+	db := m.backend.ChainDb()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for hash, t := range m.txs {
+		if t.status.Status != StatusPending {
+			if time.Since(t.done) > finishedRetention {
+				delete(m.txs, hash)
+			}
+			continue
+		}
+		if tx, blockHash, blockNumber, _ := rawdb.ReadTransaction(db, hash); tx != nil {
+			t.finish(StatusIncluded)
+			t.status.BlockHash, t.status.BlockNumber = &blockHash, (*hexutil.Uint64)(&blockNumber)
+			continue
+		}
+		if statedb.GetNonce(t.from) > t.tx.Nonce() {
+			t.finish(StatusReplaced)
+		}
+	}
+}
+
+// resubmit rebroadcasts all the pending transactions to the network, re-adding
+// any which fell out of the pool, and bumps the gas price of those which have
+// been pending for too long.
+func (m *Manager) resubmit() {
+	pool := m.backend.TxPool()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// Collect the pending transactions first, bumping inserts new ones
+	var pending []*tracked
+	for _, t := range m.txs {
+		if t.status.Status == StatusPending {
+			pending = append(pending, t)
+		}
+	}
+	var txs types.Transactions
+	for _, t := range pending {
+		if m.config.BumpInterval > 0 && time.Since(t.status.Submitted) >= m.config.BumpInterval {
+			if bumped := m.bump(t); bumped != nil {
+				txs = append(txs, bumped)
+				continue
+			}
+		}
+		if !pool.Has(t.status.Hash) {
+			if err := pool.AddLocal(t.tx); err != nil {
+				log.Debug("Failed to resubmit local transaction", "hash", t.status.Hash, "err", err)
+				t.status.Error = err.Error()
+				t.finish(StatusDropped)
+				continue
+			}
+			log.Debug("Resubmitted local transaction", "hash", t.status.Hash)
+		}
+		now := time.Now()
+		t.status.Broadcasts++
+		t.status.LastBroadcast = &now
+		txs = append(txs, t.tx)
+	}
+	if len(txs) > 0 {
+		m.broadcast(txs)
+		log.Debug("Rebroadcast local transactions", "count", len(txs))
+	}
+}
+
+// bump replaces the transaction with a copy signed with a higher gas price, up
+// to the configured cap. The new transaction is returned if it was accepted by
+// the pool, in which case it replaces the old one. The lock must be held.
+func (m *Manager) bump(t *tracked) *types.Transaction {
+	limit := m.config.PriceCap
+	if limit == nil || t.tx.GasPrice().Cmp(limit) >= 0 {
+		return nil
+	}
+	price := new(big.Int).Mul(t.tx.GasPrice(), new(big.Int).SetUint64(100+m.config.BumpPercent))
+	price.Div(price, big.NewInt(100))
+	if price.Cmp(limit) > 0 {
+		price = new(big.Int).Set(limit)
+	}
+	var tx *types.Transaction
+	if to := t.tx.To(); to != nil {
+		tx = types.NewTransaction(t.tx.Nonce(), *to, t.tx.Value(), t.tx.Gas(), price, t.tx.Data())
+	} else {
+		tx = types.NewContractCreation(t.tx.Nonce(), t.tx.Value(), t.tx.Gas(), price, t.tx.Data())
+	}
+	account := accounts.Account{Address: t.from}
+	wallet, err := m.backend.AccountManager().Find(account)
+	if err != nil {
+		t.status.Error = err.Error()
+		return nil
+	}
+	var chainID *big.Int
+	if t.tx.Protected() {
+		chainID = t.tx.ChainId()
+	}
+	signed, err := wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		log.Debug("Failed to sign bumped transaction", "hash", t.status.Hash, "err", err)
+		t.status.Error = err.Error()
+		return nil
+	}
+	if err := m.backend.TxPool().AddLocal(signed); err != nil {
+		log.Debug("Failed to submit bumped transaction", "hash", t.status.Hash, "err", err)
+		t.status.Error = err.Error()
+		return nil
+	}
+	log.Info("Bumped local transaction gas price", "hash", t.status.Hash, "replacement", signed.Hash(), "price", price)
+	m.track(signed, t.from)
+	return signed
+}
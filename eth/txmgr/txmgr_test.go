@@ -0,0 +1,153 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package txmgr
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+type testBackend struct {
+	chain *core.BlockChain
+	pool  *core.TxPool
+	am    *accounts.Manager
+	db    ethdb.Database
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain      { return b.chain }
+func (b *testBackend) TxPool() *core.TxPool              { return b.pool }
+func (b *testBackend) AccountManager() *accounts.Manager { return b.am }
+func (b *testBackend) ChainDb() ethdb.Database           { return b.db }
+
+// newTestBackend creates a chain with a single funded and unlocked account.
+func newTestBackend(t *testing.T, dir string) (*testBackend, accounts.Account) {
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatal(err)
+	}
+	gspec := &genesisT.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  genesisT.GenesisAlloc{account.Address: {Balance: big.NewInt(vars.Ether)}},
+	}
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := core.NewTxPool(core.TxPoolConfig{Journal: "", PriceLimit: 1, PriceBump: 10, AccountSlots: 16, GlobalSlots: 4096, AccountQueue: 64, GlobalQueue: 1024, Lifetime: time.Hour}, gspec.Config, chain)
+
+	return &testBackend{
+		chain: chain,
+		pool:  pool,
+		am:    accounts.NewManager(&accounts.Config{InsecureUnlockAllowed: true}, ks),
+		db:    db,
+	}, account
+}
+
+// submit signs and submits a transfer, tracking it with the manager.
+func submit(t *testing.T, b *testBackend, m *Manager, account accounts.Account, nonce uint64, price int64) *types.Transaction {
+	wallet, _ := b.am.Find(account)
+	tx, err := wallet.SignTx(account, types.NewTransaction(nonce, common.Address{0xaa}, big.NewInt(1), 21000, big.NewInt(price), nil), b.chain.Config().GetChainID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.pool.AddLocal(tx); err != nil {
+		t.Fatal(err)
+	}
+	m.Track(tx)
+	return tx
+}
+
+func TestTxManagerLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txmgr-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, account := newTestBackend(t, dir)
+	defer b.chain.Stop()
+	defer b.pool.Stop()
+
+	var broadcasts []types.Transactions
+	m := New(Config{Rebroadcast: time.Minute, BumpPercent: 20, PriceCap: big.NewInt(13)}, b, func(txs types.Transactions) {
+		broadcasts = append(broadcasts, txs)
+	})
+	tx := submit(t, b, m, account, 0, 10)
+
+	// A freshly submitted transaction is only rebroadcast
+	m.resubmit()
+	if len(broadcasts) != 1 || len(broadcasts[0]) != 1 || broadcasts[0][0].Hash() != tx.Hash() {
+		t.Fatalf("rebroadcast mismatch: have %v, want [%x]", broadcasts, tx.Hash())
+	}
+	if status := m.Status(); len(status) != 1 || status[0].Status != StatusPending || status[0].Broadcasts != 1 {
+		t.Fatalf("status mismatch after rebroadcast: %+v", status[0])
+	}
+	// Once the bump interval passes, the transaction is repriced up to the cap
+	m.config.BumpInterval = time.Nanosecond
+
+	m.resubmit()
+	status := m.Status()
+	if len(status) != 2 || status[0].Status != StatusReplaced || status[1].Status != StatusPending {
+		t.Fatalf("status mismatch after bump: %+v", status)
+	}
+	if *status[0].ReplacedBy != status[1].Hash || status[1].GasPrice.ToInt().Int64() != 12 {
+		t.Fatalf("bumped transaction mismatch: %+v", status[1])
+	}
+	m.resubmit()
+	if status = m.Status(); len(status) != 3 || status[2].GasPrice.ToInt().Int64() != 13 {
+		t.Fatalf("capped bump mismatch: %+v", status)
+	}
+	m.resubmit()
+	if status = m.Status(); len(status) != 3 {
+		t.Fatalf("transaction bumped over the cap: %+v", status)
+	}
+	// Include the final transaction and ensure it's reported as such
+	bumped := b.pool.Get(status[2].Hash)
+	blocks, _ := core.GenerateChain(b.chain.Config(), b.chain.CurrentBlock(), ethash.NewFaker(), b.db, 1, func(i int, gen *core.BlockGen) {
+		gen.AddTx(bumped)
+	})
+	if _, err := b.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	m.update()
+	if status = m.Status(); status[2].Status != StatusIncluded || *status[2].BlockHash != blocks[0].Hash() {
+		t.Fatalf("status mismatch after inclusion: %+v", status[2])
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// uncleIndexSectionSize is the number of blocks indexed at once by the uncle
+	// indexer.
+	uncleIndexSectionSize = 4096
+
+	// uncleQueryScanLimit is the maximum number of blocks an uncle query may scan
+	// without the help of the uncle index.
+	uncleQueryScanLimit = 100000
+)
+
+// UncleIndexer implements a core.ChainIndexer, indexing the uncles included in
+// the canonical chain by their miners.
+type UncleIndexer struct {
+	db    ethdb.Database // database instance to write index data into
+	batch ethdb.Batch    // batch collecting the entries of the section being processed
+}
+
+// NewUncleIndexer returns a chain indexer that indexes the uncles of the canonical
+// chain by the coinbase of the uncles.
+func NewUncleIndexer(db ethdb.Database, size, confirms uint64) *core.ChainIndexer {
+	table := rawdb.NewTable(db, string(rawdb.UncleIndexPrefix))
+	return core.NewChainIndexer(db, table, &UncleIndexer{db: db}, size, confirms, bloomThrottling, "uncles")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new uncle index section.
+func (b *UncleIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	b.batch = b.db.NewBatch()
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, indexing the uncles of a block.
+func (b *UncleIndexer) Process(ctx context.Context, header *types.Header) error {
+	if header.UncleHash == types.EmptyUncleHash {
+		return nil
+	}
+	hash, number := header.Hash(), header.Number.Uint64()
+	body := rawdb.ReadBody(b.db, hash, number)
+	if body == nil {
+		return fmt.Errorf("body of block #%d [%x] missing", number, hash)
+	}
+	rawdb.WriteUncleLookupEntries(b.batch, hash, number, body.Uncles)
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, writing the section out into the
+// database.
+func (b *UncleIndexer) Commit() error {
+	return b.batch.Write()
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (b *UncleIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// UncleStats is a summary of the uncles included in a range of blocks.
+type UncleStats struct {
+	FromBlock        hexutil.Uint64                      `json:"fromBlock"`
+	ToBlock          hexutil.Uint64                      `json:"toBlock"`
+	Blocks           hexutil.Uint64                      `json:"blocks"` // Number of blocks including uncles
+	Uncles           hexutil.Uint64                      `json:"uncles"`
+	UncleRewards     *hexutil.Big                        `json:"uncleRewards"`     // Total rewards of the uncle miners
+	InclusionRewards *hexutil.Big                        `json:"inclusionRewards"` // Total rewards of the block miners for including uncles
+	Miners           map[common.Address]*UncleMinerStats `json:"miners"`
+}
+
+// UncleMinerStats is the summary of the uncles mined by an account.
+type UncleMinerStats struct {
+	Uncles  hexutil.Uint64 `json:"uncles"`
+	Rewards *hexutil.Big   `json:"rewards"`
+}
+
+// MinedUncle is an uncle included in the canonical chain.
+type MinedUncle struct {
+	Hash        common.Hash    `json:"hash"`
+	Number      hexutil.Uint64 `json:"number"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Index       hexutil.Uint   `json:"index"`
+	Reward      *hexutil.Big   `json:"reward"`
+}
+
+// PublicUncleAPI provides analytics over the uncles included in the canonical
+// chain.
+type PublicUncleAPI struct {
+	eth *Ethereum
+}
+
+// NewPublicUncleAPI creates a new uncle analytics API.
+func NewPublicUncleAPI(eth *Ethereum) *PublicUncleAPI {
+	return &PublicUncleAPI{eth: eth}
+}
+
+// canonicalUncles returns the uncles of the canonical block at the given number.
+func (api *PublicUncleAPI) canonicalUncles(number uint64) (*types.Header, []*types.Header, error) {
+	chain := api.eth.blockchain
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, nil, fmt.Errorf("block #%d not found", number)
+	}
+	if header.UncleHash == types.EmptyUncleHash {
+		return header, nil, nil
+	}
+	block := chain.GetBlock(header.Hash(), number)
+	if block == nil {
+		return nil, nil, fmt.Errorf("body of block #%d [%x] not found", number, header.Hash())
+	}
+	return header, block.Uncles(), nil
+}
+
+// GetUncleStats returns the number of uncles included in the given range of
+// blocks, the rewards paid for them and a breakdown by uncle miner.
+func (api *PublicUncleAPI) GetUncleStats(from, to rpc.BlockNumber) (*UncleStats, error) {
+	begin, end, err := ethapi.ResolveBlockRange(api.eth.blockchain.CurrentBlock().NumberU64(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	if end-begin+1 > uncleQueryScanLimit {
+		return nil, fmt.Errorf("query spans %d blocks, more than the limit of %d", end-begin+1, uncleQueryScanLimit)
+	}
+	var (
+		config     = api.eth.blockchain.Config()
+		uncleTotal = new(big.Int)
+		inclTotal  = new(big.Int)
+		stats      = &UncleStats{
+			FromBlock: hexutil.Uint64(begin),
+			ToBlock:   hexutil.Uint64(end),
+			Miners:    make(map[common.Address]*UncleMinerStats),
+		}
+	)
+	for number := begin; number <= end; number++ {
+		header, uncles, err := api.canonicalUncles(number)
+		if err != nil {
+			return nil, err
+		}
+		if len(uncles) == 0 {
+			continue
+		}
+		stats.Blocks++
+		stats.Uncles += hexutil.Uint64(len(uncles))
+
+		withUncles, uncleRewards := ethash.GetRewards(config, header, uncles)
+		withoutUncles, _ := ethash.GetRewards(config, header, nil)
+		inclTotal.Add(inclTotal, withUncles.Sub(withUncles, withoutUncles))
+
+		for i, uncle := range uncles {
+			miner := stats.Miners[uncle.Coinbase]
+			if miner == nil {
+				miner = &UncleMinerStats{Rewards: (*hexutil.Big)(new(big.Int))}
+				stats.Miners[uncle.Coinbase] = miner
+			}
+			miner.Uncles++
+			miner.Rewards.ToInt().Add(miner.Rewards.ToInt(), uncleRewards[i])
+			uncleTotal.Add(uncleTotal, uncleRewards[i])
+		}
+	}
+	stats.UncleRewards, stats.InclusionRewards = (*hexutil.Big)(uncleTotal), (*hexutil.Big)(inclTotal)
+	return stats, nil
+}
+
+// GetUnclesByMiner returns the uncles mined by the given account which were
+// included in the given range of canonical blocks. The part of the range covered
+// by the uncle index, if enabled, is looked up in it, the rest is scanned.
+func (api *PublicUncleAPI) GetUnclesByMiner(miner common.Address, from, to rpc.BlockNumber) ([]*MinedUncle, error) {
+	begin, end, err := ethapi.ResolveBlockRange(api.eth.blockchain.CurrentBlock().NumberU64(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	var indexed uint64
+	if api.eth.uncleIndexer != nil {
+		if sections, head, _ := api.eth.uncleIndexer.Sections(); sections > 0 {
+			indexed = head + 1
+		}
+	}
+	scan := begin
+	if indexed > scan {
+		scan = indexed
+	}
+	if scan <= end && end-scan+1 > uncleQueryScanLimit {
+		return nil, fmt.Errorf("query scans %d unindexed blocks, more than the limit of %d", end-scan+1, uncleQueryScanLimit)
+	}
+	var (
+		config = api.eth.blockchain.Config()
+		mined  = []*MinedUncle{}
+	)
+	collect := func(header *types.Header, uncles []*types.Header, index int) {
+		_, rewards := ethash.GetRewards(config, header, uncles)
+		mined = append(mined, &MinedUncle{
+			Hash:        uncles[index].Hash(),
+			Number:      hexutil.Uint64(uncles[index].Number.Uint64()),
+			BlockHash:   header.Hash(),
+			BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+			Index:       hexutil.Uint(index),
+			Reward:      (*hexutil.Big)(rewards[index]),
+		})
+	}
+	// Look up the indexed part of the range, skipping entries of reorged blocks
+	if begin < indexed {
+		last := end
+		if last >= indexed {
+			last = indexed - 1
+		}
+		for _, entry := range rawdb.ReadUncleLookupEntries(api.eth.chainDb, miner, begin, last) {
+			if rawdb.ReadCanonicalHash(api.eth.chainDb, entry.BlockNumber) != entry.BlockHash {
+				continue
+			}
+			header, uncles, err := api.canonicalUncles(entry.BlockNumber)
+			if err != nil {
+				return nil, err
+			}
+			if entry.Index >= len(uncles) || uncles[entry.Index].Hash() != entry.UncleHash {
+				return nil, fmt.Errorf("uncle index entry of block #%d inconsistent", entry.BlockNumber)
+			}
+			collect(header, uncles, entry.Index)
+		}
+	}
+	// Scan the rest of the blocks
+	for number := scan; number <= end; number++ {
+		header, uncles, err := api.canonicalUncles(number)
+		if err != nil {
+			return nil, err
+		}
+		for i, uncle := range uncles {
+			if uncle.Coinbase == miner {
+				collect(header, uncles, i)
+			}
+		}
+	}
+	return mined, nil
+}
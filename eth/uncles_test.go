@@ -0,0 +1,124 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the uncle statistics are summed up over the requested range and
+// that uncles are found by miner both with and without the help of the index.
+func TestUncleAPI(t *testing.T) {
+	var (
+		minerA = common.Address{0xa}
+		minerB = common.Address{0xb}
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &genesisT.Genesis{Config: params.TestChainConfig}
+	)
+	genesis := core.MustCommitGenesis(db, gspec)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {
+		uncle := func(miner common.Address, depth int) {
+			parent := gen.PrevBlock(i - depth)
+			gen.AddUncle(&types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number(), common.Big1), Coinbase: miner, Extra: []byte{byte(i)}})
+		}
+		switch i {
+		case 2:
+			uncle(minerA, 1)
+		case 5:
+			uncle(minerA, 1)
+			uncle(minerB, 2)
+		case 8:
+			uncle(minerB, 1)
+		}
+	})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFullFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPublicUncleAPI(&Ethereum{blockchain: chain, chainDb: db})
+
+	stats, err := api.GetUncleStats(rpc.EarliestBlockNumber, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to retrieve uncle stats: %v", err)
+	}
+	if stats.Blocks != 3 || stats.Uncles != 4 {
+		t.Fatalf("uncle count mismatch: have %d uncles in %d blocks, want 4 in 3", stats.Uncles, stats.Blocks)
+	}
+	if len(stats.Miners) != 2 || stats.Miners[minerA].Uncles != 2 || stats.Miners[minerB].Uncles != 2 {
+		t.Fatalf("uncle miners mismatch: %v", stats.Miners)
+	}
+	total := new(big.Int).Add(stats.Miners[minerA].Rewards.ToInt(), stats.Miners[minerB].Rewards.ToInt())
+	if total.Cmp(stats.UncleRewards.ToInt()) != 0 {
+		t.Fatalf("uncle rewards mismatch: have %v, miners got %v", stats.UncleRewards, total)
+	}
+	if stats.InclusionRewards.ToInt().Sign() <= 0 {
+		t.Fatalf("inclusion rewards missing")
+	}
+	if stats, err = api.GetUncleStats(7, 8); err != nil || stats.Uncles != 0 {
+		t.Fatalf("ranged uncle stats mismatch: %v, %v", stats, err)
+	}
+	if _, err := api.GetUncleStats(5, 4); err == nil {
+		t.Fatalf("inverted range accepted")
+	}
+	// Look up the uncles of a miner by scanning the chain, then through the index
+	scanned, err := api.GetUnclesByMiner(minerB, rpc.EarliestBlockNumber, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to scan uncles: %v", err)
+	}
+	if len(scanned) != 2 || scanned[0].BlockNumber != 6 || scanned[0].Index != 1 || scanned[1].BlockNumber != 9 {
+		t.Fatalf("scanned uncles mismatch: %v", scanned)
+	}
+	indexer := NewUncleIndexer(db, 4, 0)
+	indexer.Start(chain)
+	defer indexer.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if sections, _, _ := indexer.Sections(); sections == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("uncle indexer timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	api.eth.uncleIndexer = indexer
+
+	indexed, err := api.GetUnclesByMiner(minerB, rpc.EarliestBlockNumber, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to look up uncles: %v", err)
+	}
+	if !reflect.DeepEqual(indexed, scanned) {
+		t.Fatalf("indexed uncles mismatch: have %v, want %v", indexed, scanned)
+	}
+	if entries := rawdb.ReadUncleLookupEntries(db, minerB, 0, 7); len(entries) != 1 {
+		t.Fatalf("uncle index entries mismatch: have %d, want 1", len(entries))
+	}
+}
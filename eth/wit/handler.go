@@ -0,0 +1,323 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package wit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// chainEventChanSize is the size of channel listening to ChainEvent.
+	chainEventChanSize = 16
+
+	// generateQueueSize is the number of imported blocks waiting for their
+	// witness to be generated, above which new blocks are skipped.
+	generateQueueSize = 64
+
+	// requestTimeout is the time allowed for a peer to answer a witness request.
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	errUnknownPeer = errors.New("unknown peer")
+	errTimeout     = errors.New("request timed out")
+	errClosed      = errors.New("witness handler closed")
+)
+
+// Config are the configuration parameters of the witness handler.
+type Config struct {
+	Enabled bool // Whether to generate witnesses on import and serve them over the wit protocol
+	Cache   int  // Number of recent block witnesses to keep for serving
+}
+
+// DefaultConfig contains the default settings of the witness handler.
+var DefaultConfig = Config{
+	Cache: 128,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if conf.Cache < 1 {
+		log.Warn("Sanitizing invalid witness cache size", "provided", conf.Cache, "updated", DefaultConfig.Cache)
+		conf.Cache = DefaultConfig.Cache
+	}
+	return conf
+}
+
+// peer is a remote node speaking the wit protocol.
+type peer struct {
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	pending map[uint64]chan []*Witness // Requests waiting for a reply
+	lock    sync.Mutex
+}
+
+// Handler generates the execution witnesses of the blocks imported into the local
+// chain and serves them to remote peers. It can also request witnesses from them.
+type Handler struct {
+	reqID uint64 // Last request identifier, accessed atomically (keep 64-bit aligned)
+
+	config Config
+	chain  *core.BlockChain
+	cache  *lru.Cache // Recently generated witnesses, keyed by block hash
+
+	peers    map[enode.ID]*peer
+	peerLock sync.RWMutex
+
+	chainCh  chan core.ChainEvent
+	chainSub event.Subscription
+	queue    chan *types.Block
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewHandler creates a witness handler on top of the given chain.
+func NewHandler(config Config, chain *core.BlockChain) *Handler {
+	config = config.sanitize()
+	cache, _ := lru.New(config.Cache)
+
+	return &Handler{
+		config: config,
+		chain:  chain,
+		cache:  cache,
+		peers:  make(map[enode.ID]*peer),
+		queue:  make(chan *types.Block, generateQueueSize),
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start subscribes to the chain and starts generating the witnesses of newly
+// imported blocks.
+func (h *Handler) Start() {
+	h.chainCh = make(chan core.ChainEvent, chainEventChanSize)
+	h.chainSub = h.chain.SubscribeChainEvent(h.chainCh)
+
+	h.wg.Add(2)
+	go h.loop()
+	go h.generateLoop()
+}
+
+// Stop terminates the witness generation.
+func (h *Handler) Stop() {
+	h.chainSub.Unsubscribe()
+	close(h.quit)
+	h.wg.Wait()
+}
+
+// loop hands the imported blocks over to the generator, skipping them if it
+// lags behind rather than blocking the chain import.
+func (h *Handler) loop() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case ev := <-h.chainCh:
+			select {
+			case h.queue <- ev.Block:
+			default:
+				log.Debug("Witness generation lagging, skipping block", "number", ev.Block.Number(), "hash", ev.Hash)
+			}
+		case <-h.chainSub.Err():
+			return
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// generateLoop generates the witnesses of the queued blocks.
+func (h *Handler) generateLoop() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case block := <-h.queue:
+			start := time.Now()
+			witness, err := Generate(h.chain, block)
+			if err != nil {
+				log.Debug("Failed to generate block witness", "number", block.Number(), "hash", block.Hash(), "err", err)
+				continue
+			}
+			h.cache.Add(block.Hash(), witness)
+			log.Trace("Generated block witness", "number", block.Number(), "hash", block.Hash(), "nodes", len(witness.Nodes), "codes", len(witness.Codes), "elapsed", common.PrettyDuration(time.Since(start)))
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// Witness retrieves the witness of a recently imported block, if it's available.
+func (h *Handler) Witness(hash common.Hash) *Witness {
+	if witness, ok := h.cache.Get(hash); ok {
+		return witness.(*Witness)
+	}
+	return nil
+}
+
+// Protocols returns the wit protocols to register with the p2p server.
+func (h *Handler) Protocols() []p2p.Protocol {
+	protos := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		protos[i] = p2p.Protocol{
+			Name:    protocolName,
+			Version: version,
+			Length:  protocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return h.runPeer(p, rw)
+			},
+		}
+	}
+	return protos
+}
+
+// RequestWitnesses retrieves the witnesses of the given blocks from a remote
+// peer. Witnesses the peer doesn't have are omitted from the result.
+func (h *Handler) RequestWitnesses(id enode.ID, hashes []common.Hash) ([]*Witness, error) {
+	h.peerLock.RLock()
+	p := h.peers[id]
+	h.peerLock.RUnlock()
+
+	if p == nil {
+		return nil, errUnknownPeer
+	}
+	reqID := atomic.AddUint64(&h.reqID, 1)
+	resCh := make(chan []*Witness, 1)
+	p.lock.Lock()
+	p.pending[reqID] = resCh
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		delete(p.pending, reqID)
+		p.lock.Unlock()
+	}()
+	if err := p2p.Send(p.rw, GetBlockWitnessesMsg, &getBlockWitnessesData{ID: reqID, Hashes: hashes}); err != nil {
+		return nil, err
+	}
+	timeout := time.NewTimer(requestTimeout)
+	defer timeout.Stop()
+
+	select {
+	case witnesses := <-resCh:
+		return witnesses, nil
+	case <-timeout.C:
+		return nil, errTimeout
+	case <-h.quit:
+		return nil, errClosed
+	}
+}
+
+// runPeer registers a remote peer and serves its messages until it disconnects.
+func (h *Handler) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	wp := &peer{
+		Peer:    p,
+		rw:      rw,
+		pending: make(map[uint64]chan []*Witness),
+	}
+	h.peerLock.Lock()
+	h.peers[p.ID()] = wp
+	h.peerLock.Unlock()
+
+	defer func() {
+		h.peerLock.Lock()
+		delete(h.peers, p.ID())
+		h.peerLock.Unlock()
+	}()
+	for {
+		if err := h.handleMsg(wp); err != nil {
+			p.Log().Debug("Witness message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (h *Handler) handleMsg(p *peer) error {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > protocolMaxMsgSize {
+		return fmt.Errorf("message too large: %v > %v", msg.Size, protocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case GetBlockWitnessesMsg:
+		var query getBlockWitnessesData
+		if err := msg.Decode(&query); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		var (
+			witnesses []*Witness
+			bytes     int
+		)
+		for _, hash := range query.Hashes {
+			if len(witnesses) >= maxWitnessServe || bytes >= softResponseLimit {
+				break
+			}
+			if witness := h.Witness(hash); witness != nil {
+				witnesses = append(witnesses, witness)
+				for _, blob := range witness.Nodes {
+					bytes += len(blob)
+				}
+				for _, blob := range witness.Codes {
+					bytes += len(blob)
+				}
+			}
+		}
+		return p2p.Send(p.rw, BlockWitnessesMsg, &blockWitnessesData{ID: query.ID, Witnesses: witnesses})
+
+	case BlockWitnessesMsg:
+		var res blockWitnessesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		p.lock.Lock()
+		resCh := p.pending[res.ID]
+		p.lock.Unlock()
+
+		if resCh != nil {
+			select {
+			case resCh <- res.Witnesses:
+			default:
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("invalid message code: %v", msg.Code)
+	}
+}
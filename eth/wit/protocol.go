@@ -0,0 +1,65 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package wit
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	wit1 = 1
+)
+
+// protocolName is the official short name of the protocol used during capability negotiation.
+const protocolName = "wit"
+
+// ProtocolVersions are the supported versions of the wit protocol (first is primary).
+var ProtocolVersions = []uint{wit1}
+
+// protocolLengths are the number of implemented message corresponding to different protocol versions.
+var protocolLengths = map[uint]uint64{wit1: 2}
+
+const protocolMaxMsgSize = 16 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+// wit protocol message codes
+const (
+	GetBlockWitnessesMsg = 0x00
+	BlockWitnessesMsg    = 0x01
+)
+
+const (
+	// softResponseLimit is the target maximum size of replies to witness
+	// requests. At least one witness is always served if available.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxWitnessServe is the maximum number of witnesses to serve per request.
+	maxWitnessServe = 16
+)
+
+// getBlockWitnessesData represents a block witness query.
+type getBlockWitnessesData struct {
+	ID     uint64        // Request identifier to match up the reply with
+	Hashes []common.Hash // Hashes of the blocks to retrieve the witnesses of
+}
+
+// blockWitnessesData is the network packet for block witness distribution.
+// Witnesses of unknown blocks are omitted.
+type blockWitnessesData struct {
+	ID        uint64
+	Witnesses []*Witness
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package wit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// maxReportAncestors is the number of ancestor headers bundled into a bad-block
+// report, covering all the blocks reachable by the BLOCKHASH opcode.
+const maxReportAncestors = 256
+
+// BadBlockReport bundles a block with the witness of its parent state and the
+// headers of its recent ancestors, so that its execution can be reproduced in
+// isolation, without access to the chain it was rejected by.
+type BadBlockReport struct {
+	Block     *types.Block
+	Witness   *Witness
+	Ancestors []*types.Header // Recent ancestors of the block, parent first
+	Reason    string          // Why the reporting node rejected the block, empty if it didn't
+	Client    string          // Identifier of the reporting client
+}
+
+// NewBadBlockReport re-executes the given block on top of its parent state,
+// recording the witness of the state accessed and the reason the block is
+// rejected for, if any. Unlike Generate, it doesn't fail on invalid blocks. The
+// parent state must be available locally.
+func NewBadBlockReport(chain *core.BlockChain, block *types.Block) (*BadBlockReport, error) {
+	rec, statedb, err := newRecorder(chain, block)
+	if err != nil {
+		return nil, err
+	}
+	var reason string
+	receipts, _, usedGas, err := chain.Processor().Process(block, statedb, vm.Config{})
+	if err == nil {
+		err = chain.Validator().ValidateState(block, statedb, receipts, usedGas)
+	}
+	if err != nil {
+		reason = err.Error()
+	}
+	report := &BadBlockReport{
+		Block:   block,
+		Witness: rec.witness(),
+		Reason:  reason,
+	}
+	for header := chain.GetHeader(block.ParentHash(), block.NumberU64()-1); header != nil && len(report.Ancestors) < maxReportAncestors; {
+		report.Ancestors = append(report.Ancestors, header)
+		if header.Number.Uint64() == 0 {
+			break
+		}
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	return report, nil
+}
+
+// ReadBadBlockReport loads a bad-block report from the given file.
+func ReadBadBlockReport(path string) (*BadBlockReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	report := new(BadBlockReport)
+	if err := rlp.Decode(file, report); err != nil {
+		return nil, err
+	}
+	if report.Block == nil || report.Witness == nil {
+		return nil, errors.New("incomplete report")
+	}
+	return report, nil
+}
+
+// WriteBadBlockReport stores a bad-block report into the given file, which must
+// not exist yet.
+func WriteBadBlockReport(path string, report *BadBlockReport) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := rlp.Encode(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReplayResult is the outcome of the isolated re-execution of a reported block.
+type ReplayResult struct {
+	Receipts    types.Receipts
+	GasUsed     uint64
+	Root        common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Err         error // Error aborting the execution of the block, if any
+}
+
+// Mismatches lists the fields of the given header contradicting the replay.
+func (r *ReplayResult) Mismatches(header *types.Header) []string {
+	if r.Err != nil {
+		return []string{fmt.Sprintf("execution failed: %v", r.Err)}
+	}
+	var mismatches []string
+	if r.GasUsed != header.GasUsed {
+		mismatches = append(mismatches, fmt.Sprintf("gas used: header %d, replay %d", header.GasUsed, r.GasUsed))
+	}
+	if r.Bloom != header.Bloom {
+		mismatches = append(mismatches, "logs bloom")
+	}
+	if r.ReceiptHash != header.ReceiptHash {
+		mismatches = append(mismatches, fmt.Sprintf("receipts root: header %x, replay %x", header.ReceiptHash, r.ReceiptHash))
+	}
+	if r.Root != header.Root {
+		mismatches = append(mismatches, fmt.Sprintf("state root: header %x, replay %x", header.Root, r.Root))
+	}
+	return mismatches
+}
+
+// replayTxStart is the trace entry preceding the execution of a transaction.
+type replayTxStart struct {
+	Tx   int         `json:"tx"`
+	Hash common.Hash `json:"hash"`
+}
+
+// replayTxEnd is the trace entry following the execution of a transaction.
+type replayTxEnd struct {
+	Tx                int            `json:"tx"`
+	Status            hexutil.Uint64 `json:"status"`
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	CumulativeGasUsed hexutil.Uint64 `json:"cumulativeGasUsed"`
+	PostState         hexutil.Bytes  `json:"postState,omitempty"`
+	Logs              int            `json:"logs"`
+	Err               string         `json:"error,omitempty"`
+}
+
+// replayBlockEnd is the final entry of a trace.
+type replayBlockEnd struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	StateRoot    common.Hash    `json:"stateRoot"`
+	ReceiptsRoot common.Hash    `json:"receiptsRoot"`
+	LogsBloom    types.Bloom    `json:"logsBloom"`
+	Err          string         `json:"error,omitempty"`
+}
+
+// replayLogger is a JSON opcode logger omitting the execution times, which would
+// make the traces of the same execution differ.
+type replayLogger struct {
+	*vm.JSONLogger
+}
+
+// CaptureEnd is triggered at end of execution.
+func (l replayLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return l.JSONLogger.CaptureEnd(output, gasUsed, 0, err)
+}
+
+// Replay re-executes the block of a bad-block report on top of the witness of
+// its parent state with the given chain configuration and consensus engine,
+// tracing every opcode executed into out as JSON lines. The trace contains no
+// timing information, so the traces of two replays can be diffed.
+func Replay(config ctypes.ChainConfigurator, engine consensus.Engine, report *BadBlockReport, logConfig *vm.LogConfig, out io.Writer) (*ReplayResult, error) {
+	block := report.Block
+	if report.Witness.Block != block.Hash() {
+		return nil, fmt.Errorf("witness of block %x, want %x", report.Witness.Block, block.Hash())
+	}
+	if len(report.Ancestors) > 0 {
+		parent := report.Ancestors[0]
+		if parent.Hash() != block.ParentHash() {
+			return nil, fmt.Errorf("parent header mismatch: have %x, want %x", parent.Hash(), block.ParentHash())
+		}
+		if parent.Root != report.Witness.Root {
+			return nil, fmt.Errorf("witness of state %x, want %x", report.Witness.Root, parent.Root)
+		}
+	}
+	statedb, err := report.Witness.State()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		chain   = newReplayChain(config, engine, report.Ancestors)
+		encoder = json.NewEncoder(out)
+		tracer  = replayLogger{vm.NewJSONLogger(logConfig, out)}
+		header  = block.Header()
+		gp      = new(core.GasPool).AddGas(block.GasLimit())
+		result  = new(ReplayResult)
+	)
+	// Mutate the state according to any hard-fork specs, as the state processor
+	if config.IsEnabled(config.GetEthashEIP779Transition, block.Number()) {
+		if daoNumber := config.GetEthashEIP779Transition(); daoNumber != nil && *daoNumber == block.NumberU64() {
+			misc.ApplyDAOHardFork(statedb)
+		}
+	}
+	for i, tx := range block.Transactions() {
+		if err := encoder.Encode(replayTxStart{Tx: i, Hash: tx.Hash()}); err != nil {
+			return nil, err
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := core.ApplyTransaction(config, chain, nil, gp, statedb, header, tx, &result.GasUsed, vm.Config{Debug: true, Tracer: tracer})
+		if err != nil {
+			result.Err = fmt.Errorf("transaction %d [%x]: %v", i, tx.Hash(), err)
+			if err := encoder.Encode(replayTxEnd{Tx: i, Err: err.Error()}); err != nil {
+				return nil, err
+			}
+			break
+		}
+		result.Receipts = append(result.Receipts, receipt)
+		entry := replayTxEnd{
+			Tx:                i,
+			Status:            hexutil.Uint64(receipt.Status),
+			GasUsed:           hexutil.Uint64(receipt.GasUsed),
+			CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+			PostState:         receipt.PostState,
+			Logs:              len(receipt.Logs),
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	if result.Err == nil {
+		// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+		engine.Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
+		result.Root = statedb.IntermediateRoot(config.IsEnabled(config.GetEIP161dTransition, block.Number()))
+		result.ReceiptHash = types.DeriveSha(result.Receipts, new(trie.Trie))
+		result.Bloom = types.CreateBloom(result.Receipts)
+	}
+	// Accessing state not covered by the witness doesn't abort the execution,
+	// but leaves the results meaningless
+	if result.Err == nil && statedb.Error() != nil {
+		result.Err = fmt.Errorf("incomplete witness: %v", statedb.Error())
+	}
+	end := replayBlockEnd{
+		Number:       hexutil.Uint64(block.NumberU64()),
+		Hash:         block.Hash(),
+		GasUsed:      hexutil.Uint64(result.GasUsed),
+		StateRoot:    result.Root,
+		ReceiptsRoot: result.ReceiptHash,
+		LogsBloom:    result.Bloom,
+	}
+	if result.Err != nil {
+		end.Err = result.Err.Error()
+	}
+	if err := encoder.Encode(end); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// replayChain is a chain context serving the ancestor headers bundled into a
+// bad-block report.
+type replayChain struct {
+	config  ctypes.ChainConfigurator
+	engine  consensus.Engine
+	headers []*types.Header // Parent first
+	hashes  map[common.Hash]*types.Header
+}
+
+func newReplayChain(config ctypes.ChainConfigurator, engine consensus.Engine, headers []*types.Header) *replayChain {
+	chain := &replayChain{
+		config:  config,
+		engine:  engine,
+		headers: headers,
+		hashes:  make(map[common.Hash]*types.Header, len(headers)),
+	}
+	for _, header := range headers {
+		chain.hashes[header.Hash()] = header
+	}
+	return chain
+}
+
+// Config retrieves the chain configuration of the replay.
+func (c *replayChain) Config() ctypes.ChainConfigurator { return c.config }
+
+// Engine retrieves the consensus engine of the replay.
+func (c *replayChain) Engine() consensus.Engine { return c.engine }
+
+// CurrentHeader retrieves the parent header of the reported block.
+func (c *replayChain) CurrentHeader() *types.Header {
+	if len(c.headers) == 0 {
+		return nil
+	}
+	return c.headers[0]
+}
+
+// GetHeader retrieves an ancestor header by hash and number.
+func (c *replayChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.hashes[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByHash retrieves an ancestor header by hash.
+func (c *replayChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.hashes[hash]
+}
+
+// GetHeaderByNumber retrieves an ancestor header by number.
+func (c *replayChain) GetHeaderByNumber(number uint64) *types.Header {
+	if len(c.headers) == 0 || number > c.headers[0].Number.Uint64() {
+		return nil
+	}
+	if index := c.headers[0].Number.Uint64() - number; index < uint64(len(c.headers)) {
+		return c.headers[index]
+	}
+	return nil
+}
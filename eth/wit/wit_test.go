@@ -0,0 +1,232 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package wit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+
+	// testCode deploys a contract incrementing its first storage slot when called.
+	testCode = common.FromHex("600a600c600039600a6000f360016000540160005500")
+)
+
+// newTestChain creates a chain with a contract deployed in the first block and
+// called a few times in the second one.
+func newTestChain(t *testing.T) (*core.BlockChain, []*types.Block) {
+	gspec := &genesisT.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  genesisT.GenesisAlloc{testAddress: {Balance: big.NewInt(vars.Ether)}},
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis := core.MustCommitGenesis(db, gspec)
+
+	var (
+		signer   = types.NewEIP155Signer(gspec.Config.GetChainID())
+		contract = crypto.CreateAddress(testAddress, 0)
+		nonce    uint64
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, gen *core.BlockGen) {
+		var txs []*types.Transaction
+		switch i {
+		case 0:
+			txs = append(txs, types.NewContractCreation(nonce, new(big.Int), 100000, big.NewInt(1), testCode))
+		case 1:
+			txs = append(txs,
+				types.NewTransaction(nonce, contract, new(big.Int), 100000, big.NewInt(1), nil),
+				types.NewTransaction(nonce+1, contract, new(big.Int), 100000, big.NewInt(1), nil),
+				types.NewTransaction(nonce+2, common.Address{0xaa}, big.NewInt(1), 21000, big.NewInt(1), nil),
+			)
+		}
+		for _, tx := range txs {
+			signed, err := types.SignTx(tx, signer, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.AddTx(signed)
+			nonce++
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return chain, blocks
+}
+
+// Tests that a generated witness contains all the state needed to re-execute
+// its block without any other state.
+func TestWitnessExecution(t *testing.T) {
+	chain, blocks := newTestChain(t)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		witness, err := Generate(chain, block)
+		if err != nil {
+			t.Fatalf("block %d: failed to generate witness: %v", block.NumberU64(), err)
+		}
+		if witness.Block != block.Hash() || witness.Root != chain.GetHeaderByHash(block.ParentHash()).Root {
+			t.Fatalf("block %d: witness header mismatch", block.NumberU64())
+		}
+		if block == blocks[1] && len(witness.Codes) != 1 {
+			t.Fatalf("block %d: contract code mismatch: have %d, want 1", block.NumberU64(), len(witness.Codes))
+		}
+		statedb, err := witness.State()
+		if err != nil {
+			t.Fatalf("block %d: failed to open witness state: %v", block.NumberU64(), err)
+		}
+		if _, _, _, err := chain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			t.Fatalf("block %d: failed to execute on witness: %v", block.NumberU64(), err)
+		}
+		if root := statedb.IntermediateRoot(true); root != block.Root() {
+			t.Fatalf("block %d: state root mismatch: have %x, want %x", block.NumberU64(), root, block.Root())
+		}
+	}
+	// A witness must not cover the state of a different block
+	witness, _ := Generate(chain, blocks[0])
+	statedb, _ := witness.State()
+	if _, _, _, err := chain.Processor().Process(blocks[1], statedb, vm.Config{}); err == nil {
+		if root := statedb.IntermediateRoot(true); root == blocks[1].Root() {
+			t.Fatalf("block executed on the witness of its parent")
+		}
+	}
+}
+
+// Tests that witnesses can be retrieved from a remote peer over the wit protocol.
+func TestWitnessRequests(t *testing.T) {
+	chain, blocks := newTestChain(t)
+	defer chain.Stop()
+
+	server, client := NewHandler(DefaultConfig, chain), NewHandler(DefaultConfig, chain)
+	for _, block := range blocks[1:] {
+		witness, err := Generate(chain, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.cache.Add(block.Hash(), witness)
+	}
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	serverID, clientID := enode.ID{0x01}, enode.ID{0x02}
+	go server.runPeer(p2p.NewPeer(clientID, "client", nil), app)
+	go client.runPeer(p2p.NewPeer(serverID, "server", nil), net)
+
+	// Wait for the client to register the server
+	var (
+		hashes    = []common.Hash{blocks[0].Hash(), blocks[1].Hash()}
+		witnesses []*Witness
+		err       error
+	)
+	for i := 0; i < 100; i++ {
+		if witnesses, err = client.RequestWitnesses(serverID, hashes); err != errUnknownPeer {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to request witnesses: %v", err)
+	}
+	if len(witnesses) != 1 || witnesses[0].Block != blocks[1].Hash() {
+		t.Fatalf("witness mismatch: have %d witnesses, want 1 for block %x", len(witnesses), blocks[1].Hash())
+	}
+	want := server.Witness(blocks[1].Hash())
+	if witnesses[0].Root != want.Root || len(witnesses[0].Nodes) != len(want.Nodes) || len(witnesses[0].Codes) != len(want.Codes) {
+		t.Fatalf("witness content mismatch")
+	}
+}
+
+// Tests that a bad-block report reproduces the execution of its block on its own,
+// pointing out the header fields contradicting it.
+func TestBadBlockReport(t *testing.T) {
+	chain, blocks := newTestChain(t)
+	defer chain.Stop()
+
+	dir, err := ioutil.TempDir("", "badblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Forge a block claiming a different state root than its execution yields
+	header := blocks[1].Header()
+	header.Root = common.Hash{0xba, 0xd}
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[1].Transactions(), blocks[1].Uncles())
+
+	for i, block := range []*types.Block{blocks[1], bad} {
+		report, err := NewBadBlockReport(chain, block)
+		if err != nil {
+			t.Fatalf("block %d: failed to create report: %v", i, err)
+		}
+		if (report.Reason == "") != (block == blocks[1]) {
+			t.Fatalf("block %d: rejection reason mismatch: %q", i, report.Reason)
+		}
+		if len(report.Ancestors) != 2 || report.Ancestors[0].Hash() != block.ParentHash() {
+			t.Fatalf("block %d: ancestors mismatch", i)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("report-%d.rlp", i))
+		if err := WriteBadBlockReport(path, report); err != nil {
+			t.Fatalf("block %d: failed to write report: %v", i, err)
+		}
+		if report, err = ReadBadBlockReport(path); err != nil {
+			t.Fatalf("block %d: failed to read report: %v", i, err)
+		}
+		// Replaying the report twice must yield the same result and trace
+		var traces [2]bytes.Buffer
+		var mismatches []string
+		for j := range traces {
+			result, err := Replay(chain.Config(), ethash.NewFaker(), report, nil, &traces[j])
+			if err != nil {
+				t.Fatalf("block %d: failed to replay: %v", i, err)
+			}
+			mismatches = result.Mismatches(block.Header())
+		}
+		if !bytes.Equal(traces[0].Bytes(), traces[1].Bytes()) {
+			t.Fatalf("block %d: replay traces differ", i)
+		}
+		if len(mismatches) != i || (i == 1 && !strings.HasPrefix(mismatches[0], "state root")) {
+			t.Fatalf("block %d: mismatches mismatch: %v", i, mismatches)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wit implements the generation of block execution witnesses and the
+// wit protocol through which they are served to other peers.
+package wit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Witness contains all the state needed to execute a block on top of its parent
+// without access to any other state: every trie node resolved and every contract
+// code loaded while importing the block.
+type Witness struct {
+	Block common.Hash // Hash of the block the witness belongs to
+	Root  common.Hash // State root of the parent block
+	Nodes [][]byte    // Trie nodes accessed during execution
+	Codes [][]byte    // Contract codes accessed during execution
+}
+
+// State opens the parent state of the witness' block, backed solely by the data
+// contained in the witness. Accessing any state not covered by the witness will
+// result in a missing trie node error.
+func (w *Witness) State() (*state.StateDB, error) {
+	db := rawdb.NewMemoryDatabase()
+	for _, blob := range w.Nodes {
+		rawdb.WriteTrieNode(db, crypto.Keccak256Hash(blob), blob)
+	}
+	for _, blob := range w.Codes {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(blob), blob)
+	}
+	return state.New(w.Root, state.NewDatabase(db), nil)
+}
+
+// Generate re-executes the given block on top of its parent state, recording all
+// the trie nodes and contract codes accessed, including the ones needed to derive
+// the post state root. The parent state must be available locally.
+func Generate(chain *core.BlockChain, block *types.Block) (*Witness, error) {
+	rec, statedb, err := newRecorder(chain, block)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := chain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+		return nil, err
+	}
+	config := chain.Config()
+	if root := statedb.IntermediateRoot(config.IsEnabled(config.GetEIP161dTransition, block.Number())); root != block.Root() {
+		return nil, fmt.Errorf("state root mismatch: have %x, want %x", root, block.Root())
+	}
+	return rec.witness(), nil
+}
+
+// recorder records the state accessed through a state database opened on top of
+// the parent state of a block.
+type recorder struct {
+	block common.Hash
+	root  common.Hash
+	store *recordingStore
+	db    *recordingDatabase
+}
+
+// newRecorder opens the parent state of the given block for recording the state
+// accessed by its execution. The parent state must be available locally.
+func newRecorder(chain *core.BlockChain, block *types.Block) (*recorder, *state.StateDB, error) {
+	parent := chain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	// Load all trie nodes through a fresh, cacheless database so that every node
+	// needed by the execution is resolved and recorded. Snapshots are bypassed
+	// for the same reason.
+	store := &recordingStore{
+		KeyValueStore: chain.StateCache().TrieDB().DiskDB(),
+		source:        chain.StateCache().TrieDB(),
+		nodes:         make(map[common.Hash][]byte),
+	}
+	db := &recordingDatabase{
+		Database: state.NewDatabase(rawdb.NewDatabase(store)),
+		codes:    make(map[common.Hash][]byte),
+	}
+	statedb, err := state.New(parent.Root, db, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &recorder{block: block.Hash(), root: parent.Root, store: store, db: db}, statedb, nil
+}
+
+// witness assembles the witness of the state recorded so far.
+func (r *recorder) witness() *Witness {
+	return &Witness{
+		Block: r.block,
+		Root:  r.root,
+		Nodes: r.store.blobs(),
+		Codes: r.db.blobs(),
+	}
+}
+
+// recordingStore is a database which retrieves trie nodes from a live trie
+// database, recording every node requested.
+type recordingStore struct {
+	ethdb.KeyValueStore
+	source *trie.Database
+
+	nodes map[common.Hash][]byte
+	lock  sync.Mutex
+}
+
+// Get retrieves the given key if it's present in the key-value data store. Trie
+// nodes are looked up in the source trie database, so that nodes not flushed to
+// disk yet are also found.
+func (s *recordingStore) Get(key []byte) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return s.KeyValueStore.Get(key)
+	}
+	hash := common.BytesToHash(key)
+	blob, err := s.source.Node(hash)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.nodes[hash] = common.CopyBytes(blob)
+	s.lock.Unlock()
+	return blob, nil
+}
+
+// Has retrieves if a key is present in the key-value data store.
+func (s *recordingStore) Has(key []byte) (bool, error) {
+	if len(key) != common.HashLength {
+		return s.KeyValueStore.Has(key)
+	}
+	if _, err := s.source.Node(common.BytesToHash(key)); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Put is disallowed, the witness generation must never modify the chain data.
+func (s *recordingStore) Put(key []byte, value []byte) error {
+	return errors.New("read only database")
+}
+
+// Delete is disallowed, the witness generation must never modify the chain data.
+func (s *recordingStore) Delete(key []byte) error {
+	return errors.New("read only database")
+}
+
+// blobs returns the recorded trie nodes, sorted by hash.
+func (s *recordingStore) blobs() [][]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortedBlobs(s.nodes)
+}
+
+// recordingDatabase is a state database recording every contract code loaded.
+type recordingDatabase struct {
+	state.Database
+
+	codes map[common.Hash][]byte
+	lock  sync.Mutex
+}
+
+// ContractCode retrieves a particular contract's code.
+func (db *recordingDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.Database.ContractCode(addrHash, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	db.lock.Lock()
+	db.codes[codeHash] = common.CopyBytes(code)
+	db.lock.Unlock()
+	return code, nil
+}
+
+// ContractCodeSize retrieves a particular contracts code's size. The code itself
+// is recorded too, as a stateless client cannot derive the size otherwise.
+func (db *recordingDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// blobs returns the recorded contract codes, sorted by hash.
+func (db *recordingDatabase) blobs() [][]byte {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return sortedBlobs(db.codes)
+}
+
+// sortedBlobs flattens a set of hash to preimage mappings, sorted by hash.
+func sortedBlobs(set map[common.Hash][]byte) [][]byte {
+	hashes := make([]common.Hash, 0, len(set))
+	for hash := range set {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	blobs := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		blobs[i] = set[hash]
+	}
+	return blobs
+}
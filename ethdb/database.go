@@ -81,6 +81,10 @@ type AncientReader interface {
 
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
+
+	// AncientDatadir returns the path of the directory holding the ancient store,
+	// if the store is held on the local file system.
+	AncientDatadir() (string, error)
 }
 
 // AncientWriter contains the methods required to write to immutable ancient data.
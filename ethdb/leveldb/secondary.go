@@ -0,0 +1,419 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !js
+
+package leveldb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// secondaryMirrorAttempts is the number of times the primary database is
+// mirrored before giving up if it keeps recording new versions meanwhile.
+const secondaryMirrorAttempts = 8
+
+// errMirrorChanged is returned if the primary database recorded a new version
+// of its tables while being mirrored.
+var errMirrorChanged = errors.New("primary database changed while mirroring")
+
+// mirror is a read-only database opened on a copy of the primary database.
+type mirror struct {
+	dir     string
+	version string // Version of the primary database mirrored, see primaryVersion
+	db      *Database
+	refs    sync.WaitGroup // Reads in flight and live iterators
+}
+
+// Secondary is a read-only view of a LevelDB database written by another
+// process, catching up with its writes on demand.
+//
+// LevelDB locks its database exclusively, so the view is opened on a mirror of
+// the primary database instead: the immutable tables are hard linked while the
+// manifest and the write-ahead logs are copied, so the mirrors must be on the
+// same file system as the primary database. Each catch-up opens a fresh mirror
+// if the primary database changed since the previous one, which is then closed
+// once its reads and iterators are released.
+type Secondary struct {
+	primary string // Path of the database written by the primary process
+	root    string // Path of the directory holding the mirrors
+	cache   int    // Megabytes of memory allocated to the block cache of a mirror
+	handles int    // Number of file handles allocated to a mirror
+
+	gen     uint64  // Sequence number of the latest mirror
+	current *mirror // Latest mirror, nil once closed
+
+	lock    sync.RWMutex   // Protects the current mirror
+	catchup sync.Mutex     // Serialises the catch-ups
+	retired sync.WaitGroup // Mirrors waiting for their reads to be released
+	log     log.Logger
+}
+
+// NewSecondary opens a read-only view of the database at the primary path,
+// mirroring it into the given directory, which is wiped first.
+func NewSecondary(primary string, root string, cache int, handles int) (*Secondary, error) {
+	if cache < minCache {
+		cache = minCache
+	}
+	if handles < minHandles {
+		handles = minHandles
+	}
+	// Drop the mirrors left behind by a previous run
+	if err := os.RemoveAll(root); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	s := &Secondary{
+		primary: primary,
+		root:    root,
+		cache:   cache,
+		handles: handles,
+		log:     log.New("database", primary, "secondary", root),
+	}
+	m, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	s.current = m
+	s.log.Info("Opened secondary database", "cache", cache, "handles", handles)
+	return s, nil
+}
+
+// open mirrors the primary database and opens it read-only.
+func (s *Secondary) open() (*mirror, error) {
+	s.gen++
+	dir := filepath.Join(s.root, fmt.Sprintf("%06d", s.gen))
+
+	var (
+		version string
+		err     error
+	)
+	for i := 0; i < secondaryMirrorAttempts; i++ {
+		if version, err = primaryVersion(s.primary); err != nil {
+			break
+		}
+		if err = mirrorDatabase(s.primary, dir); err != errMirrorChanged {
+			break
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	options := configureOptions(func(options *opt.Options) {
+		options.OpenFilesCacheCapacity = s.handles
+		options.BlockCacheCapacity = s.cache / 2 * opt.MiB
+		options.ReadOnly = true
+	})
+	db, err := leveldb.OpenFile(dir, options)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &mirror{dir: dir, version: version, db: &Database{fn: s.primary, db: db, log: s.log}}, nil
+}
+
+// Catchup opens a fresh mirror of the primary database, making its writes done
+// so far visible. The current mirror is kept if the primary database didn't
+// change since.
+func (s *Secondary) Catchup() error {
+	s.catchup.Lock()
+	defer s.catchup.Unlock()
+
+	version, err := primaryVersion(s.primary)
+	if err != nil {
+		return err
+	}
+	s.lock.RLock()
+	current := s.current
+	s.lock.RUnlock()
+
+	switch {
+	case current == nil:
+		return leveldb.ErrClosed
+	case current.version == version:
+		return nil
+	}
+	m, err := s.open()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	old := s.current
+	if old != nil {
+		s.current = m
+	}
+	s.lock.Unlock()
+
+	if old == nil {
+		s.retire(m)
+		return leveldb.ErrClosed
+	}
+	s.retire(old)
+	return nil
+}
+
+// retire closes and removes a mirror in the background once all its reads and
+// iterators are released.
+func (s *Secondary) retire(m *mirror) {
+	s.retired.Add(1)
+	go func() {
+		defer s.retired.Done()
+
+		m.refs.Wait()
+		if err := m.db.Close(); err != nil {
+			s.log.Warn("Failed to close database mirror", "dir", m.dir, "err", err)
+		}
+		os.RemoveAll(m.dir)
+	}()
+}
+
+// acquire returns the current mirror, which must be released after use.
+func (s *Secondary) acquire() (*mirror, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.current == nil {
+		return nil, leveldb.ErrClosed
+	}
+	s.current.refs.Add(1)
+	return s.current, nil
+}
+
+// Close closes the view of the primary database, waiting for the reads and
+// iterators in flight to be released.
+func (s *Secondary) Close() error {
+	s.lock.Lock()
+	m := s.current
+	s.current = nil
+	s.lock.Unlock()
+
+	if m != nil {
+		s.retire(m)
+	}
+	s.retired.Wait()
+	return nil
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (s *Secondary) Has(key []byte) (bool, error) {
+	m, err := s.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer m.refs.Done()
+	return m.db.Has(key)
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (s *Secondary) Get(key []byte) ([]byte, error) {
+	m, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer m.refs.Done()
+	return m.db.Get(key)
+}
+
+// Put returns an error as the secondary database is read-only.
+func (s *Secondary) Put(key []byte, value []byte) error {
+	return leveldb.ErrReadOnly
+}
+
+// Delete returns an error as the secondary database is read-only.
+func (s *Secondary) Delete(key []byte) error {
+	return leveldb.ErrReadOnly
+}
+
+// NewBatch creates a batch failing to write, as the secondary database is
+// read-only.
+func (s *Secondary) NewBatch() ethdb.Batch {
+	return readOnlyBatch{&batch{b: new(leveldb.Batch)}}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset of database
+// content with a particular key prefix, starting at a particular initial key (or
+// after, if it does not exist). The iterator keeps iterating the view of the
+// database it was created on until released.
+func (s *Secondary) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	m, err := s.acquire()
+	if err != nil {
+		return iterator.NewEmptyIterator(err)
+	}
+	return &mirrorIterator{Iterator: m.db.NewIterator(prefix, start), mirror: m}
+}
+
+// Stat returns a particular internal stat of the current mirror.
+func (s *Secondary) Stat(property string) (string, error) {
+	m, err := s.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer m.refs.Done()
+	return m.db.Stat(property)
+}
+
+// Compact returns an error as the secondary database is read-only.
+func (s *Secondary) Compact(start []byte, limit []byte) error {
+	return leveldb.ErrReadOnly
+}
+
+// Path returns the path to the primary database directory.
+func (s *Secondary) Path() string {
+	return s.primary
+}
+
+// mirrorIterator is an iterator over a mirror, releasing it with the iterator.
+type mirrorIterator struct {
+	ethdb.Iterator
+	mirror *mirror
+	once   sync.Once
+}
+
+// Release releases the iterator and the mirror it iterates.
+func (it *mirrorIterator) Release() {
+	it.Iterator.Release()
+	it.once.Do(it.mirror.refs.Done)
+}
+
+// readOnlyBatch is a batch of a secondary database, failing to write.
+type readOnlyBatch struct {
+	*batch
+}
+
+// Write returns an error as the secondary database is read-only.
+func (b readOnlyBatch) Write() error {
+	return leveldb.ErrReadOnly
+}
+
+// primaryVersion summarises the state of the database at src as mirrored: its
+// current manifest, along with the sizes of the latter and of the write-ahead
+// logs. The tables are immutable, and adding or removing them records a new
+// version into the manifest, while the logs are only ever appended to.
+func primaryVersion(src string) (string, error) {
+	current, err := ioutil.ReadFile(filepath.Join(src, "CURRENT"))
+	if err != nil {
+		return "", err
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return "", err
+	}
+	manifest := strings.TrimSpace(string(current))
+
+	version := manifest
+	for _, file := range files {
+		if name := file.Name(); name == manifest || filepath.Ext(name) == ".log" {
+			version += fmt.Sprintf(",%s:%d", name, file.Size())
+		}
+	}
+	return version, nil
+}
+
+// mirrorDatabase mirrors the database at src into dst, hard linking the tables
+// and copying the manifest and the logs. It returns errMirrorChanged if the
+// primary recorded a new version of the database meanwhile, as the tables and
+// the logs may be inconsistent with the copied manifest then.
+func mirrorDatabase(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(filepath.Join(src, "CURRENT"))
+	if err != nil {
+		return err
+	}
+	manifest := strings.TrimSpace(string(current))
+	if !strings.HasPrefix(manifest, "MANIFEST-") || strings.ContainsAny(manifest, `/\`) {
+		return fmt.Errorf("invalid CURRENT file in %s: %q", src, current)
+	}
+	blob, err := ioutil.ReadFile(filepath.Join(src, manifest))
+	if os.IsNotExist(err) {
+		return errMirrorChanged
+	} else if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, manifest), blob, 0644); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		switch filepath.Ext(name) {
+		case ".ldb", ".sst":
+			if err = os.Link(filepath.Join(src, name), filepath.Join(dst, name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to link table %s, the mirror must be on the same file system as the database: %v", name, err)
+			}
+		case ".log":
+			err = copyFile(filepath.Join(src, name), filepath.Join(dst, name))
+		default:
+			continue
+		}
+		if os.IsNotExist(err) {
+			return errMirrorChanged
+		} else if err != nil {
+			return err
+		}
+	}
+	// Adding or removing tables records a new version into the manifest
+	if after, err := ioutil.ReadFile(filepath.Join(src, "CURRENT")); err != nil || !bytes.Equal(after, current) {
+		return errMirrorChanged
+	}
+	if info, err := os.Stat(filepath.Join(src, manifest)); err != nil || info.Size() != int64(len(blob)) {
+		return errMirrorChanged
+	}
+	return ioutil.WriteFile(filepath.Join(dst, "CURRENT"), current, 0644)
+}
+
+// copyFile copies the current content of a file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package leveldb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Tests that a secondary database follows the writes of the primary one as it
+// catches up, including compactions dropping the tables it was opened on.
+func TestSecondaryCatchup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	primary, err := New(filepath.Join(dir, "primary"), 0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to open primary: %v", err)
+	}
+	defer primary.Close()
+
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := primary.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+				t.Fatalf("failed to write key %d: %v", i, err)
+			}
+		}
+	}
+	check := func(db *Secondary, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			value, err := db.Get([]byte(fmt.Sprintf("key-%04d", i)))
+			if err != nil {
+				t.Fatalf("key %d: failed to read: %v", i, err)
+			}
+			if string(value) != fmt.Sprintf("value-%d", i) {
+				t.Fatalf("key %d: value mismatch: have %s", i, value)
+			}
+		}
+		if ok, _ := db.Has([]byte(fmt.Sprintf("key-%04d", n))); ok {
+			t.Fatalf("key %d visible before being caught up with", n)
+		}
+	}
+	put(0, 100)
+
+	secondary, err := NewSecondary(primary.Path(), filepath.Join(dir, "mirror"), 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open secondary: %v", err)
+	}
+	defer secondary.Close()
+	check(secondary, 100)
+
+	// An iterator keeps iterating the view it was created on
+	it := secondary.NewIterator(nil, nil)
+
+	// Without new writes, the current mirror is kept
+	gen := secondary.gen
+	if err := secondary.Catchup(); err != nil {
+		t.Fatalf("failed to catch up: %v", err)
+	}
+	if secondary.gen != gen {
+		t.Fatalf("unchanged primary mirrored again: generation %d, want %d", secondary.gen, gen)
+	}
+	put(100, 200)
+	check(secondary, 100)
+	if err := secondary.Catchup(); err != nil {
+		t.Fatalf("failed to catch up: %v", err)
+	}
+	check(secondary, 200)
+
+	// Compacting the primary replaces the tables of the previous mirrors
+	if err := primary.Compact(nil, nil); err != nil {
+		t.Fatalf("failed to compact primary: %v", err)
+	}
+	put(200, 300)
+	if err := secondary.Catchup(); err != nil {
+		t.Fatalf("failed to catch up after compaction: %v", err)
+	}
+	check(secondary, 300)
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iterator failed: %v", err)
+	}
+	it.Release()
+	if count != 100 {
+		t.Fatalf("iterated item count mismatch: have %d, want 100", count)
+	}
+	// The secondary can't be written
+	if err := secondary.Put([]byte("key"), []byte("value")); err != leveldb.ErrReadOnly {
+		t.Fatalf("put error mismatch: have %v, want %v", err, leveldb.ErrReadOnly)
+	}
+	batch := secondary.NewBatch()
+	batch.Put([]byte("key"), []byte("value"))
+	if err := batch.Write(); err != leveldb.ErrReadOnly {
+		t.Fatalf("batch write error mismatch: have %v, want %v", err, leveldb.ErrReadOnly)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package explorer implements a minimal block explorer web UI, served by the node
+// on its HTTP-RPC server from its own chain data and indexes.
+package explorer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// prefix is the path the explorer is served under.
+	prefix = "/explorer"
+
+	// recentBlocks is the number of blocks listed on the front page.
+	recentBlocks = 25
+
+	// tokenTransferSpan is the number of recent blocks whose token transfers are
+	// listed on the page of an address.
+	tokenTransferSpan = 100000
+
+	// maxTokenTransfers is the maximum number of token transfers listed on the
+	// page of an address, the most recent ones.
+	maxTokenTransfers = 100
+
+	// requestTimeout is the time limit to render a page.
+	requestTimeout = 10 * time.Second
+)
+
+var errNotFound = errors.New("not found")
+
+// Backend is the chain access needed by the explorer, implemented by both full
+// and light nodes.
+type Backend interface {
+	ChainConfig() ctypes.ChainConfigurator
+	ChainDb() ethdb.Database
+	CurrentHeader() *types.Header
+	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
+	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
+	StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error)
+}
+
+// Config contains the settings of the explorer.
+type Config struct {
+	VirtualHosts []string // Virtual hostnames to accept requests from
+	TokenIndex   bool     // Whether the token index is maintained, to list the token transfers of addresses
+}
+
+// New creates the explorer and registers it on the HTTP-RPC server of the node.
+func New(stack *node.Node, backend Backend, config Config) error {
+	if backend == nil {
+		panic("missing backend")
+	}
+	handler := node.NewHTTPHandlerStack(newHandler(backend, config), nil, config.VirtualHosts)
+	stack.RegisterHandler("Explorer", prefix, handler)
+	stack.RegisterHandler("Explorer", prefix+"/", handler)
+	return nil
+}
+
+// handler serves the pages of the explorer.
+type handler struct {
+	backend Backend
+	config  Config
+}
+
+func newHandler(backend Backend, config Config) *handler {
+	return &handler{backend: backend, config: config}
+}
+
+// ServeHTTP implements http.Handler, routing the request to the page it asks for.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	var (
+		path = strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		page string
+		data interface{}
+		err  error
+	)
+	switch {
+	case path == "":
+		page = "index"
+		data, err = h.index(ctx)
+	case path == "search":
+		h.search(w, r)
+		return
+	case strings.HasPrefix(path, "block/"):
+		page = "block"
+		data, err = h.block(ctx, strings.TrimPrefix(path, "block/"))
+	case strings.HasPrefix(path, "tx/"):
+		page = "tx"
+		data, err = h.transaction(ctx, strings.TrimPrefix(path, "tx/"))
+	case strings.HasPrefix(path, "address/"):
+		page = "address"
+		data, err = h.address(ctx, strings.TrimPrefix(path, "address/"))
+	default:
+		err = errNotFound
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errNotFound {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		page, data = "error", err.Error()
+	}
+	if err := templates.ExecuteTemplate(w, page, data); err != nil {
+		log.Debug("Failed to render explorer page", "path", r.URL.Path, "err", err)
+	}
+}
+
+// search redirects to the block, transaction or address page matching the query:
+// a block number, a block or transaction hash, or an address.
+func (h *handler) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	target := prefix + "/"
+	switch {
+	case common.IsHexAddress(query):
+		target += "address/" + query
+	case len(query) == 2*common.HashLength+2 && strings.HasPrefix(query, "0x"):
+		hash := common.HexToHash(query)
+		if tx, _, _, _, _ := h.backend.GetTransaction(r.Context(), hash); tx != nil {
+			target += "tx/" + query
+		} else {
+			target += "block/" + query
+		}
+	case query != "":
+		target += "block/" + query
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// blockSummary is a block as listed on the front page.
+type blockSummary struct {
+	Number       uint64
+	Hash         common.Hash
+	Time         string
+	Miner        common.Address
+	Transactions int
+	GasUsed      uint64
+}
+
+func summarizeBlock(block *types.Block) *blockSummary {
+	return &blockSummary{
+		Number:       block.NumberU64(),
+		Hash:         block.Hash(),
+		Time:         formatTime(block.Time()),
+		Miner:        block.Coinbase(),
+		Transactions: len(block.Transactions()),
+		GasUsed:      block.GasUsed(),
+	}
+}
+
+// index lists the most recent blocks.
+func (h *handler) index(ctx context.Context) ([]*blockSummary, error) {
+	head := h.backend.CurrentHeader().Number.Uint64()
+
+	var blocks []*blockSummary
+	for i := uint64(0); i < recentBlocks && i <= head; i++ {
+		block, err := h.backend.BlockByNumber(ctx, rpc.BlockNumber(head-i))
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, summarizeBlock(block))
+	}
+	return blocks, nil
+}
+
+// txSummary is a transaction as listed on the page of a block.
+type txSummary struct {
+	Hash  common.Hash
+	From  common.Address
+	To    *common.Address
+	Value string
+}
+
+// blockPage is the page of a block.
+type blockPage struct {
+	*blockSummary
+	ParentHash   common.Hash
+	Difficulty   *big.Int
+	GasLimit     uint64
+	Size         string
+	Extra        hexutil.Bytes
+	Uncles       []common.Hash
+	Transactions []*txSummary
+}
+
+// block shows a block by number or hash.
+func (h *handler) block(ctx context.Context, id string) (*blockPage, error) {
+	var (
+		block *types.Block
+		err   error
+	)
+	if strings.HasPrefix(id, "0x") && len(id) == 2*common.HashLength+2 {
+		block, err = h.backend.BlockByHash(ctx, common.HexToHash(id))
+	} else {
+		number, perr := strconv.ParseUint(id, 10, 64)
+		if perr != nil {
+			return nil, errNotFound
+		}
+		block, err = h.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errNotFound
+	}
+	page := &blockPage{
+		blockSummary: summarizeBlock(block),
+		ParentHash:   block.ParentHash(),
+		Difficulty:   block.Difficulty(),
+		GasLimit:     block.GasLimit(),
+		Size:         block.Size().String(),
+		Extra:        block.Extra(),
+	}
+	for _, uncle := range block.Uncles() {
+		page.Uncles = append(page.Uncles, uncle.Hash())
+	}
+	signer := types.MakeSigner(h.backend.ChainConfig(), block.Number())
+	for _, tx := range block.Transactions() {
+		from, _ := types.Sender(signer, tx)
+		page.Transactions = append(page.Transactions, &txSummary{Hash: tx.Hash(), From: from, To: tx.To(), Value: formatEther(tx.Value())})
+	}
+	return page, nil
+}
+
+// tokenTransfer is a token transfer as listed on the pages of transactions and
+// addresses.
+type tokenTransfer struct {
+	Token       common.Address
+	From        common.Address
+	To          common.Address
+	Value       *big.Int
+	NonFungible bool
+	TxHash      common.Hash
+	BlockNumber uint64
+}
+
+func newTokenTransfer(transfer *rawdb.TokenTransfer, number uint64) *tokenTransfer {
+	return &tokenTransfer{
+		Token:       transfer.Token,
+		From:        transfer.From,
+		To:          transfer.To,
+		Value:       transfer.Value,
+		NonFungible: transfer.NonFungible,
+		TxHash:      transfer.TxHash,
+		BlockNumber: number,
+	}
+}
+
+// txPage is the page of a transaction.
+type txPage struct {
+	Hash           common.Hash
+	BlockHash      common.Hash
+	BlockNumber    uint64
+	Index          uint64
+	From           common.Address
+	To             *common.Address
+	Value          string
+	Nonce          uint64
+	Gas            uint64
+	GasPrice       *big.Int
+	Input          hexutil.Bytes
+	Receipt        bool // Whether the receipt was found, the fields below being unset otherwise
+	Status         uint64
+	GasUsed        uint64
+	ContractAddr   *common.Address
+	Logs           int
+	TokenTransfers []*tokenTransfer
+}
+
+// transaction shows a transaction by hash, along with its receipt.
+func (h *handler) transaction(ctx context.Context, id string) (*txPage, error) {
+	hash := common.HexToHash(id)
+	tx, blockHash, number, index, err := h.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, errNotFound
+	}
+	from, _ := types.Sender(types.MakeSigner(h.backend.ChainConfig(), new(big.Int).SetUint64(number)), tx)
+	page := &txPage{
+		Hash:        hash,
+		BlockHash:   blockHash,
+		BlockNumber: number,
+		Index:       index,
+		From:        from,
+		To:          tx.To(),
+		Value:       formatEther(tx.Value()),
+		Nonce:       tx.Nonce(),
+		Gas:         tx.Gas(),
+		GasPrice:    tx.GasPrice(),
+		Input:       tx.Data(),
+	}
+	receipts, err := h.backend.GetReceipts(ctx, blockHash)
+	if err != nil || uint64(len(receipts)) <= index {
+		return page, nil
+	}
+	receipt := receipts[index]
+	page.Receipt, page.Status, page.GasUsed, page.Logs = true, receipt.Status, receipt.GasUsed, len(receipt.Logs)
+	if receipt.ContractAddress != (common.Address{}) {
+		page.ContractAddr = &receipt.ContractAddress
+	}
+	for _, transfer := range core.ParseTokenTransfers(receipt.Logs) {
+		page.TokenTransfers = append(page.TokenTransfers, newTokenTransfer(transfer, number))
+	}
+	return page, nil
+}
+
+// addressPage is the page of an address.
+type addressPage struct {
+	Address        common.Address
+	Balance        string
+	Nonce          uint64
+	CodeSize       int
+	TokenIndex     bool
+	TokenSpan      uint64
+	TokenTransfers []*tokenTransfer
+}
+
+// address shows the state of an account at the chain head, along with its recent
+// token transfers if the token index is maintained.
+func (h *handler) address(ctx context.Context, id string) (*addressPage, error) {
+	if !common.IsHexAddress(id) {
+		return nil, errNotFound
+	}
+	address := common.HexToAddress(id)
+	statedb, header, err := h.backend.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	page := &addressPage{
+		Address:    address,
+		Balance:    formatEther(statedb.GetBalance(address)),
+		Nonce:      statedb.GetNonce(address),
+		CodeSize:   statedb.GetCodeSize(address),
+		TokenIndex: h.config.TokenIndex,
+		TokenSpan:  tokenTransferSpan,
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	if !h.config.TokenIndex {
+		return page, nil
+	}
+	var (
+		db    = h.backend.ChainDb()
+		head  = header.Number.Uint64()
+		first uint64
+	)
+	if head >= tokenTransferSpan {
+		first = head - tokenTransferSpan + 1
+	}
+	entries := rawdb.ReadTokenTransfers(db, address, first, head)
+	for i := len(entries) - 1; i >= 0 && len(page.TokenTransfers) < maxTokenTransfers; i-- {
+		if rawdb.ReadCanonicalHash(db, entries[i].BlockNumber) != entries[i].BlockHash {
+			continue
+		}
+		page.TokenTransfers = append(page.TokenTransfers, newTokenTransfer(entries[i].Transfer, entries[i].BlockNumber))
+	}
+	return page, nil
+}
+
+// formatEther formats an amount of wei in ether, without trailing zeros.
+func formatEther(wei *big.Int) string {
+	ether, rem := new(big.Int).QuoRem(wei, big.NewInt(vars.Ether), new(big.Int))
+	if rem.Sign() == 0 {
+		return ether.String()
+	}
+	fraction := strings.TrimRight(fmt.Sprintf("%018d", rem), "0")
+	return ether.String() + "." + fraction
+}
+
+// formatTime formats a block timestamp.
+func formatTime(timestamp uint64) string {
+	return time.Unix(int64(timestamp), 0).UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{"prefix": func() string { return prefix }}).Parse(pageTemplates))
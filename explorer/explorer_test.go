@@ -0,0 +1,207 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package explorer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+	testTo      = common.Address{0x01}
+)
+
+// testBackend implements Backend on top of a blockchain.
+type testBackend struct {
+	chain *core.BlockChain
+	db    ethdb.Database
+}
+
+func (b *testBackend) ChainConfig() ctypes.ChainConfigurator { return b.chain.Config() }
+func (b *testBackend) ChainDb() ethdb.Database               { return b.db }
+func (b *testBackend) CurrentHeader() *types.Header          { return b.chain.CurrentHeader() }
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *testBackend) GetTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	tx, blockHash, number, index := rawdb.ReadTransaction(b.db, hash)
+	return tx, blockHash, number, index, nil
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header := b.chain.CurrentHeader()
+	if number != rpc.LatestBlockNumber {
+		header = b.chain.GetHeaderByNumber(uint64(number))
+	}
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+// newTestHandler creates an explorer on top of a chain with a transfer of 1.5
+// ether in every block.
+func newTestHandler(t *testing.T, n int) (*handler, *core.BlockChain, []*types.Block) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{testAddress: {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(vars.Ether))}},
+		}
+		genesis = core.MustCommitGenesis(db, gspec)
+		signer  = types.NewEIP155Signer(gspec.Config.GetChainID())
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(testAddress), testTo, big.NewInt(15*vars.Ether/10), vars.TxGas, nil, nil), signer, testKey)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return newHandler(&testBackend{chain: chain, db: db}, Config{TokenIndex: true}), chain, blocks
+}
+
+// get requests a page from the explorer, returning its status and contents.
+func get(h http.Handler, path string) (int, string, http.Header) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	res := rec.Result()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body), res.Header
+}
+
+func TestPages(t *testing.T) {
+	h, chain, blocks := newTestHandler(t, 3)
+	defer chain.Stop()
+	tx := blocks[1].Transactions()[0]
+
+	// Record a token transfer to the recipient, as done by the token index
+	token := common.Address{0x02}
+	rawdb.WriteTokenTransfers(h.backend.ChainDb(), blocks[1].Hash(), 2, []*rawdb.TokenTransfer{
+		{Token: token, From: testAddress, To: testTo, Value: big.NewInt(42), TxHash: tx.Hash()},
+	})
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+	}{
+		{"/explorer", http.StatusOK, []string{"Latest blocks", `href="/explorer/block/3"`, `href="/explorer/block/1"`}},
+		{"/explorer/block/2", http.StatusOK, []string{"Block 2", blocks[1].Hash().Hex(), tx.Hash().Hex(), "1.5"}},
+		{"/explorer/block/" + blocks[0].Hash().Hex(), http.StatusOK, []string{"Block 1"}},
+		{"/explorer/tx/" + tx.Hash().Hex(), http.StatusOK, []string{testAddress.Hex(), testTo.Hex(), "1.5 ether", "success", "21000"}},
+		{"/explorer/address/" + testTo.Hex(), http.StatusOK, []string{"4.5 ether", "Token transfers", token.Hex(), "42"}},
+		{"/explorer/block/4", http.StatusNotFound, []string{"not found"}},
+		{"/explorer/block/foo", http.StatusNotFound, []string{"not found"}},
+		{"/explorer/tx/" + common.Hash{0x01}.Hex(), http.StatusNotFound, []string{"not found"}},
+		{"/explorer/unknown", http.StatusNotFound, []string{"not found"}},
+	}
+	for _, tt := range tests {
+		status, body, header := get(h, tt.path)
+		if status != tt.status {
+			t.Errorf("%s: status mismatch: have %d, want %d", tt.path, status, tt.status)
+		}
+		if ctype := header.Get("Content-Type"); ctype != "text/html; charset=utf-8" {
+			t.Errorf("%s: content type mismatch: have %q", tt.path, ctype)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q", tt.path, want)
+			}
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	h, chain, blocks := newTestHandler(t, 2)
+	defer chain.Stop()
+	tx := blocks[0].Transactions()[0]
+
+	tests := []struct {
+		query, want string
+	}{
+		{"2", "/explorer/block/2"},
+		{blocks[1].Hash().Hex(), "/explorer/block/" + blocks[1].Hash().Hex()},
+		{tx.Hash().Hex(), "/explorer/tx/" + tx.Hash().Hex()},
+		{testTo.Hex(), "/explorer/address/" + testTo.Hex()},
+		{"", "/explorer/"},
+	}
+	for _, tt := range tests {
+		status, _, header := get(h, "/explorer/search?q="+tt.query)
+		if status != http.StatusFound || header.Get("Location") != tt.want {
+			t.Errorf("query %q: have %d to %q, want redirect to %q", tt.query, status, header.Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestFormatEther(t *testing.T) {
+	tests := []struct {
+		wei  *big.Int
+		want string
+	}{
+		{big.NewInt(0), "0"},
+		{big.NewInt(vars.Ether), "1"},
+		{big.NewInt(15 * vars.Ether / 10), "1.5"},
+		{big.NewInt(1), "0.000000000000000001"},
+		{new(big.Int).Mul(big.NewInt(123456789), big.NewInt(vars.Ether)), "123456789"},
+	}
+	for _, tt := range tests {
+		if have := formatEther(tt.wei); have != tt.want {
+			t.Errorf("%v wei: have %q, want %q", tt.wei, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package explorer
+
+// pageTemplates contains the HTML templates of the explorer pages, sharing the
+// header and footer of the layout.
+const pageTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 72em; padding: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; }
+td.mono, span.mono { font-family: monospace; }
+nav { display: flex; justify-content: space-between; margin-bottom: 1em; }
+input[type=text] { width: 40em; }
+</style>
+</head>
+<body>
+<nav>
+<a href="{{prefix}}/">Latest blocks</a>
+<form action="{{prefix}}/search" method="get"><input type="text" name="q" placeholder="Block number or hash, transaction hash, address"> <input type="submit" value="Search"></form>
+</nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "error"}}{{template "header"}}
+<h2>Error</h2>
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+
+{{define "index"}}{{template "header"}}
+<h2>Latest blocks</h2>
+<table>
+<tr><th>Number</th><th>Hash</th><th>Time</th><th>Miner</th><th>Transactions</th><th>Gas used</th></tr>
+{{range .}}<tr><td><a href="{{prefix}}/block/{{.Number}}">{{.Number}}</a></td><td class="mono">{{.Hash.TerminalString}}</td><td>{{.Time}}</td><td class="mono"><a href="{{prefix}}/address/{{.Miner.Hex}}">{{.Miner.Hex}}</a></td><td>{{.Transactions}}</td><td>{{.GasUsed}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header"}}
+<h2>Block {{.Number}}</h2>
+<table>
+<tr><th>Hash</th><td class="mono">{{.Hash.Hex}}</td></tr>
+<tr><th>Parent</th><td class="mono"><a href="{{prefix}}/block/{{.ParentHash.Hex}}">{{.ParentHash.Hex}}</a></td></tr>
+<tr><th>Time</th><td>{{.Time}}</td></tr>
+<tr><th>Miner</th><td class="mono"><a href="{{prefix}}/address/{{.Miner.Hex}}">{{.Miner.Hex}}</a></td></tr>
+<tr><th>Difficulty</th><td>{{.Difficulty}}</td></tr>
+<tr><th>Gas used</th><td>{{.GasUsed}} of {{.GasLimit}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+<tr><th>Extra data</th><td class="mono">{{.Extra}}</td></tr>
+<tr><th>Uncles</th><td class="mono">{{range .Uncles}}{{.Hex}}<br>{{else}}none{{end}}</td></tr>
+</table>
+<h3>Transactions</h3>
+<table>
+<tr><th>Hash</th><th>From</th><th>To</th><th>Value (ether)</th></tr>
+{{range .Transactions}}<tr><td class="mono"><a href="{{prefix}}/tx/{{.Hash.Hex}}">{{.Hash.TerminalString}}</a></td><td class="mono"><a href="{{prefix}}/address/{{.From.Hex}}">{{.From.Hex}}</a></td><td class="mono">{{if .To}}<a href="{{prefix}}/address/{{.To.Hex}}">{{.To.Hex}}</a>{{else}}contract creation{{end}}</td><td>{{.Value}}</td></tr>
+{{else}}<tr><td colspan="4">none</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "transfers"}}<table>
+<tr><th>Block</th><th>Transaction</th><th>Token</th><th>From</th><th>To</th><th>Amount</th></tr>
+{{range .}}<tr><td><a href="{{prefix}}/block/{{.BlockNumber}}">{{.BlockNumber}}</a></td><td class="mono"><a href="{{prefix}}/tx/{{.TxHash.Hex}}">{{.TxHash.TerminalString}}</a></td><td class="mono"><a href="{{prefix}}/address/{{.Token.Hex}}">{{.Token.Hex}}</a></td><td class="mono"><a href="{{prefix}}/address/{{.From.Hex}}">{{.From.Hex}}</a></td><td class="mono"><a href="{{prefix}}/address/{{.To.Hex}}">{{.To.Hex}}</a></td><td>{{if .NonFungible}}token #{{.Value}}{{else}}{{.Value}}{{end}}</td></tr>
+{{else}}<tr><td colspan="6">none</td></tr>
+{{end}}</table>{{end}}
+
+{{define "tx"}}{{template "header"}}
+<h2>Transaction</h2>
+<table>
+<tr><th>Hash</th><td class="mono">{{.Hash.Hex}}</td></tr>
+<tr><th>Block</th><td><a href="{{prefix}}/block/{{.BlockNumber}}">{{.BlockNumber}}</a> (index {{.Index}})</td></tr>
+<tr><th>From</th><td class="mono"><a href="{{prefix}}/address/{{.From.Hex}}">{{.From.Hex}}</a></td></tr>
+<tr><th>To</th><td class="mono">{{if .To}}<a href="{{prefix}}/address/{{.To.Hex}}">{{.To.Hex}}</a>{{else}}contract creation{{end}}</td></tr>
+<tr><th>Value</th><td>{{.Value}} ether</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+<tr><th>Gas</th><td>{{.Gas}} at {{.GasPrice}} wei</td></tr>
+{{if .Receipt}}<tr><th>Status</th><td>{{if eq .Status 1}}success{{else}}failed{{end}}</td></tr>
+<tr><th>Gas used</th><td>{{.GasUsed}}</td></tr>
+{{if .ContractAddr}}<tr><th>Contract created</th><td class="mono"><a href="{{prefix}}/address/{{.ContractAddr.Hex}}">{{.ContractAddr.Hex}}</a></td></tr>{{end}}
+<tr><th>Logs</th><td>{{.Logs}}</td></tr>
+{{else}}<tr><th>Receipt</th><td>not available</td></tr>
+{{end}}<tr><th>Input</th><td class="mono">{{.Input}}</td></tr>
+</table>
+{{if .TokenTransfers}}<h3>Token transfers</h3>
+{{template "transfers" .TokenTransfers}}{{end}}
+{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header"}}
+<h2>Address <span class="mono">{{.Address.Hex}}</span></h2>
+<table>
+<tr><th>Balance</th><td>{{.Balance}} ether</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+<tr><th>Code</th><td>{{if .CodeSize}}{{.CodeSize}} bytes{{else}}none{{end}}</td></tr>
+</table>
+{{if .TokenIndex}}<h3>Token transfers in the last {{.TokenSpan}} blocks</h3>
+{{template "transfers" .TokenTransfers}}{{end}}
+{{template "footer"}}{{end}}
+`
@@ -0,0 +1,201 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package firehose
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+// BlockEvent is published for every block added to the canonical chain.
+type BlockEvent struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	ParentHash   common.Hash    `json:"parentHash"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	Miner        common.Address `json:"miner"`
+	Difficulty   *hexutil.Big   `json:"difficulty"`
+	GasLimit     hexutil.Uint64 `json:"gasLimit"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Size         hexutil.Uint64 `json:"size"`
+	Transactions int            `json:"transactions"`
+	Uncles       []common.Hash  `json:"uncles"`
+}
+
+// TransactionEvent is published for every transaction of a canonical block.
+type TransactionEvent struct {
+	BlockNumber hexutil.Uint64  `json:"blockNumber"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	Index       hexutil.Uint    `json:"index"`
+	Hash        common.Hash     `json:"hash"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Value       *hexutil.Big    `json:"value"`
+	Gas         hexutil.Uint64  `json:"gas"`
+	GasPrice    *hexutil.Big    `json:"gasPrice"`
+	Nonce       hexutil.Uint64  `json:"nonce"`
+	Input       hexutil.Bytes   `json:"input"`
+}
+
+// ReceiptEvent is published for the receipt of every transaction of a canonical
+// block.
+type ReceiptEvent struct {
+	BlockNumber       hexutil.Uint64  `json:"blockNumber"`
+	BlockHash         common.Hash     `json:"blockHash"`
+	TxIndex           hexutil.Uint    `json:"transactionIndex"`
+	TxHash            common.Hash     `json:"transactionHash"`
+	Status            hexutil.Uint64  `json:"status"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	ContractAddress   *common.Address `json:"contractAddress"`
+	Logs              int             `json:"logs"`
+}
+
+// LogEvent is published for every log emitted in a canonical block.
+type LogEvent struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	TxIndex     hexutil.Uint   `json:"transactionIndex"`
+	TxHash      common.Hash    `json:"transactionHash"`
+	Index       hexutil.Uint   `json:"logIndex"`
+	Address     common.Address `json:"address"`
+	Topics      []common.Hash  `json:"topics"`
+	Data        hexutil.Bytes  `json:"data"`
+}
+
+// ReorgEvent is published when blocks previously published as canonical are
+// dropped from the canonical chain, before the blocks replacing them.
+type ReorgEvent struct {
+	AncestorNumber hexutil.Uint64 `json:"ancestorNumber"`
+	AncestorHash   common.Hash    `json:"ancestorHash"`
+	Dropped        []common.Hash  `json:"dropped"` // Hashes of the dropped blocks, from the old head down
+}
+
+// blockMessages encodes the events of a canonical block into messages, the block
+// event last so that consumers seeing it know the block is complete.
+func (s *Service) blockMessages(config ctypes.ChainConfigurator, block *types.Block, receipts types.Receipts) ([]*Message, error) {
+	var (
+		msgs   []*Message
+		key    = []byte(block.Hash().Hex())
+		number = hexutil.Uint64(block.NumberU64())
+		signer = types.MakeSigner(config, block.Number())
+	)
+	add := func(topic string, event interface{}) error {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &Message{Topic: topic, Key: key, Value: value})
+		return nil
+	}
+	for i, tx := range block.Transactions() {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, err
+		}
+		err = add(s.topics.Transactions, &TransactionEvent{
+			BlockNumber: number,
+			BlockHash:   block.Hash(),
+			Index:       hexutil.Uint(i),
+			Hash:        tx.Hash(),
+			From:        from,
+			To:          tx.To(),
+			Value:       (*hexutil.Big)(tx.Value()),
+			Gas:         hexutil.Uint64(tx.Gas()),
+			GasPrice:    (*hexutil.Big)(tx.GasPrice()),
+			Nonce:       hexutil.Uint64(tx.Nonce()),
+			Input:       tx.Data(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(receipts) {
+			continue
+		}
+		receipt := receipts[i]
+		event := &ReceiptEvent{
+			BlockNumber:       number,
+			BlockHash:         block.Hash(),
+			TxIndex:           hexutil.Uint(i),
+			TxHash:            tx.Hash(),
+			Status:            hexutil.Uint64(receipt.Status),
+			GasUsed:           hexutil.Uint64(receipt.GasUsed),
+			CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+			Logs:              len(receipt.Logs),
+		}
+		if tx.To() == nil {
+			event.ContractAddress = &receipt.ContractAddress
+		}
+		if err := add(s.topics.Receipts, event); err != nil {
+			return nil, err
+		}
+		for _, l := range receipt.Logs {
+			err := add(s.topics.Logs, &LogEvent{
+				BlockNumber: number,
+				BlockHash:   block.Hash(),
+				TxIndex:     hexutil.Uint(i),
+				TxHash:      tx.Hash(),
+				Index:       hexutil.Uint(l.Index),
+				Address:     l.Address,
+				Topics:      l.Topics,
+				Data:        l.Data,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	uncles := make([]common.Hash, 0, len(block.Uncles()))
+	for _, uncle := range block.Uncles() {
+		uncles = append(uncles, uncle.Hash())
+	}
+	err := add(s.topics.Blocks, &BlockEvent{
+		Number:       number,
+		Hash:         block.Hash(),
+		ParentHash:   block.ParentHash(),
+		Timestamp:    hexutil.Uint64(block.Time()),
+		Miner:        block.Coinbase(),
+		Difficulty:   (*hexutil.Big)(new(big.Int).Set(block.Difficulty())),
+		GasLimit:     hexutil.Uint64(block.GasLimit()),
+		GasUsed:      hexutil.Uint64(block.GasUsed()),
+		Size:         hexutil.Uint64(block.Size()),
+		Transactions: len(block.Transactions()),
+		Uncles:       uncles,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// reorgMessage encodes a reorg event into a message.
+func (s *Service) reorgMessage(ancestor *types.Header, dropped []common.Hash) (*Message, error) {
+	value, err := json.Marshal(&ReorgEvent{
+		AncestorNumber: hexutil.Uint64(ancestor.Number.Uint64()),
+		AncestorHash:   ancestor.Hash(),
+		Dropped:        dropped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Topic: s.topics.Reorgs, Key: []byte(ancestor.Hash().Hex()), Value: value}, nil
+}
@@ -0,0 +1,315 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package firehose implements a service streaming the events of the canonical
+// chain to a message broker.
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+
+	// retryDelay is the time to wait before publishing again after a failure.
+	retryDelay = 5 * time.Second
+)
+
+var (
+	publishedMeter = metrics.NewRegisteredMeter("firehose/published", nil)
+	failureMeter   = metrics.NewRegisteredMeter("firehose/failures", nil)
+)
+
+// Backend is the chain access needed by the firehose, implemented by both full
+// and light nodes.
+type Backend interface {
+	ChainConfig() ctypes.ChainConfigurator
+	ChainDb() ethdb.Database
+	CurrentHeader() *types.Header
+	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// Config contains the settings of the firehose.
+type Config struct {
+	URL         string // Broker to publish to, kafka://host:port[,host:port...], nats://host:port or tls://host:port (NATS over TLS)
+	TopicPrefix string // Prefix of the default topic names, e.g. <prefix>.blocks
+	Topics      Topics // Topic names overriding the defaults
+}
+
+// Topics are the names of the topics the events are published on.
+type Topics struct {
+	Blocks       string
+	Transactions string
+	Receipts     string
+	Logs         string
+	Reorgs       string
+}
+
+// DefaultConfig contains the default settings of the firehose.
+var DefaultConfig = Config{
+	TopicPrefix: "geth",
+}
+
+// topics returns the configured topic names, defaulting the missing ones.
+func (c *Config) topics() Topics {
+	prefix := c.TopicPrefix
+	if prefix == "" {
+		prefix = DefaultConfig.TopicPrefix
+	}
+	topics := c.Topics
+	for _, topic := range []struct {
+		name *string
+		kind string
+	}{
+		{&topics.Blocks, "blocks"},
+		{&topics.Transactions, "transactions"},
+		{&topics.Receipts, "receipts"},
+		{&topics.Logs, "logs"},
+		{&topics.Reorgs, "reorgs"},
+	} {
+		if *topic.name == "" {
+			*topic.name = prefix + "." + topic.kind
+		}
+	}
+	return topics
+}
+
+// Service publishes the events of every block added to the canonical chain, and
+// a reorg event whenever published blocks are dropped from it. The last block
+// acknowledged by the broker is recorded in the database, publishing resumes
+// after it on restart, making the delivery at-least-once.
+type Service struct {
+	backend Backend
+	config  Config
+	topics  Topics
+	db      ethdb.Database
+	dial    func(url string) (Publisher, error)
+	pub     Publisher // Connection to the broker, nil until established
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a firehose and registers it with the node.
+func New(stack *node.Node, backend Backend, config Config) error {
+	if config.URL == "" {
+		return errors.New("firehose broker URL missing")
+	}
+	if _, _, err := parseURL(config.URL); err != nil {
+		return err
+	}
+	stack.RegisterLifecycle(newService(backend, config, Dial))
+	return nil
+}
+
+func newService(backend Backend, config Config, dial func(string) (Publisher, error)) *Service {
+	return &Service{
+		backend: backend,
+		config:  config,
+		topics:  config.topics(),
+		db:      backend.ChainDb(),
+		dial:    dial,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start implements node.Lifecycle, starting the publishing loop.
+func (s *Service) Start() error {
+	s.wg.Add(1)
+	go s.loop()
+
+	log.Info("Firehose started", "url", s.config.URL)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the publishing loop.
+func (s *Service) Stop() error {
+	close(s.quit)
+	s.wg.Wait()
+	if s.pub != nil {
+		s.pub.Close()
+	}
+	log.Info("Firehose stopped")
+	return nil
+}
+
+// loop publishes the new canonical blocks on every chain head event, retrying
+// after a delay when publishing fails.
+func (s *Service) loop() {
+	defer s.wg.Done()
+
+	headCh := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	headSub := s.backend.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	retrying := true
+
+	for {
+		select {
+		case <-headCh:
+			if retrying {
+				continue
+			}
+		case <-retry.C:
+			retrying = false
+		case <-headSub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+		if err := s.sync(); err != nil {
+			log.Warn("Firehose failed to publish chain events", "err", err)
+			failureMeter.Mark(1)
+			retry.Reset(retryDelay)
+			retrying = true
+		}
+	}
+}
+
+// sync publishes the events of the canonical chain from the cursor up to the
+// current head.
+func (s *Service) sync() error {
+	if s.pub == nil {
+		pub, err := s.dial(s.config.URL)
+		if err != nil {
+			return err
+		}
+		s.pub = pub
+	}
+	ctx := context.Background()
+
+	// Start at the current head on the first run, otherwise check that the
+	// cursor is still canonical, publishing a reorg if not
+	head := s.backend.CurrentHeader()
+	cursor := rawdb.ReadFirehoseCursor(s.db)
+	if cursor == nil {
+		if head.Number.Uint64() == 0 {
+			return nil
+		}
+		parent, err := s.backend.HeaderByHash(ctx, head.ParentHash)
+		if err != nil || parent == nil {
+			return fmt.Errorf("parent of head #%d missing", head.Number)
+		}
+		cursor = &rawdb.FirehoseCursor{Number: parent.Number.Uint64(), Hash: parent.Hash()}
+	} else {
+		ancestor, dropped, err := s.ancestor(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		if len(dropped) > 0 {
+			msg, err := s.reorgMessage(ancestor, dropped)
+			if err != nil {
+				return err
+			}
+			if err := s.publish([]*Message{msg}); err != nil {
+				return err
+			}
+			log.Info("Firehose published chain reorg", "ancestor", ancestor.Number, "hash", ancestor.Hash(), "dropped", len(dropped))
+
+			cursor = &rawdb.FirehoseCursor{Number: ancestor.Number.Uint64(), Hash: ancestor.Hash()}
+			rawdb.WriteFirehoseCursor(s.db, cursor.Number, cursor.Hash)
+		}
+	}
+	// Publish the blocks on top of the cursor, one at a time, stopping if the
+	// chain reorganises meanwhile: the new head event will resume from there
+	config := s.backend.ChainConfig()
+	for number := cursor.Number + 1; number <= head.Number.Uint64(); number++ {
+		select {
+		case <-s.quit:
+			return nil
+		default:
+		}
+		block, err := s.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil || block == nil {
+			return fmt.Errorf("block #%d missing", number)
+		}
+		if block.ParentHash() != cursor.Hash {
+			return nil
+		}
+		receipts, err := s.backend.GetReceipts(ctx, block.Hash())
+		if err != nil {
+			return fmt.Errorf("receipts of block #%d missing: %v", number, err)
+		}
+		msgs, err := s.blockMessages(config, block, receipts)
+		if err != nil {
+			return err
+		}
+		if err := s.publish(msgs); err != nil {
+			return err
+		}
+		cursor = &rawdb.FirehoseCursor{Number: number, Hash: block.Hash()}
+		rawdb.WriteFirehoseCursor(s.db, cursor.Number, cursor.Hash)
+		log.Debug("Firehose published block", "number", number, "hash", block.Hash(), "messages", len(msgs))
+	}
+	return nil
+}
+
+// ancestor returns the most recent canonical ancestor of the cursor, and the
+// hashes of the non-canonical blocks from the cursor down to it.
+func (s *Service) ancestor(ctx context.Context, cursor *rawdb.FirehoseCursor) (*types.Header, []common.Hash, error) {
+	var (
+		dropped []common.Hash
+		hash    = cursor.Hash
+	)
+	for {
+		header, err := s.backend.HeaderByHash(ctx, hash)
+		if err != nil || header == nil {
+			return nil, nil, fmt.Errorf("published block %x missing", hash)
+		}
+		canon, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Uint64()))
+		if err != nil {
+			return nil, nil, err
+		}
+		if canon != nil && canon.Hash() == hash {
+			return header, dropped, nil
+		}
+		dropped = append(dropped, hash)
+		hash = header.ParentHash
+	}
+}
+
+// publish delivers a batch of messages to the broker.
+func (s *Service) publish(msgs []*Message) error {
+	if err := s.pub.Publish(msgs); err != nil {
+		return err
+	}
+	publishedMeter.Mark(int64(len(msgs)))
+	return nil
+}
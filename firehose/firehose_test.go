@@ -0,0 +1,325 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// testBackend implements Backend on top of a blockchain.
+type testBackend struct {
+	chain *core.BlockChain
+	db    ethdb.Database
+}
+
+func (b *testBackend) ChainConfig() ctypes.ChainConfigurator { return b.chain.Config() }
+func (b *testBackend) ChainDb() ethdb.Database               { return b.db }
+func (b *testBackend) CurrentHeader() *types.Header          { return b.chain.CurrentHeader() }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.chain.SubscribeChainHeadEvent(ch)
+}
+
+// testPublisher records the published messages, failing on demand.
+type testPublisher struct {
+	msgs []*Message
+	fail bool
+}
+
+func (p *testPublisher) Publish(msgs []*Message) error {
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *testPublisher) Close() error { return nil }
+
+// topic returns the messages published on a topic.
+func (p *testPublisher) topic(topic string) []*Message {
+	var msgs []*Message
+	for _, msg := range p.msgs {
+		if msg.Topic == topic {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// newTestService creates a firehose on top of a chain with a transaction in
+// every block, publishing into a test publisher.
+func newTestService(t *testing.T) (*Service, *testBackend, *testPublisher, *genesisT.Genesis, ethdb.Database) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &genesisT.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  genesisT.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000000000000)}},
+		}
+	)
+	core.MustCommitGenesis(db, gspec)
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	backend := &testBackend{chain: chain, db: db}
+	pub := new(testPublisher)
+	service := newService(backend, Config{URL: "nats://localhost:4222", Topics: Topics{Logs: "contract-logs"}}, func(string) (Publisher, error) {
+		return pub, nil
+	})
+	service.pub = pub
+
+	gendb := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(gendb, gspec)
+	return service, backend, pub, gspec, gendb
+}
+
+// makeChain generates blocks on top of the given parent, each with a transfer.
+// The state of the parent must be available in the database.
+func makeChain(gspec *genesisT.Genesis, db ethdb.Database, parent *types.Block, n int, seed byte) []*types.Block {
+	blocks, _ := core.GenerateChain(gspec.Config, parent, ethash.NewFaker(), db, n, func(i int, block *core.BlockGen) {
+		block.SetCoinbase(common.Address{seed})
+		signer := types.MakeSigner(gspec.Config, block.Number())
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddress), common.Address{seed}, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	return blocks
+}
+
+// Tests that the blocks of the canonical chain are published with their
+// transactions and receipts, resuming from the cursor.
+func TestPublish(t *testing.T) {
+	service, backend, pub, gspec, gendb := newTestService(t)
+	defer backend.chain.Stop()
+
+	genesis := backend.chain.Genesis()
+	// The genesis block isn't published
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if len(pub.msgs) != 0 || rawdb.ReadFirehoseCursor(backend.db) != nil {
+		t.Fatalf("genesis published")
+	}
+	// Publishing starts at the current head on the first run
+	blocks := makeChain(gspec, gendb, genesis, 4, 0x01)
+	if _, err := backend.chain.InsertChain(blocks[:2]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if have := len(pub.topic("geth.blocks")); have != 1 {
+		t.Fatalf("published block count mismatch: have %d, want 1", have)
+	}
+	if cursor := rawdb.ReadFirehoseCursor(backend.db); cursor == nil || cursor.Hash != blocks[1].Hash() {
+		t.Fatalf("cursor mismatch: have %v, want #2", cursor)
+	}
+	// Later blocks are published from the cursor on
+	if _, err := backend.chain.InsertChain(blocks[2:]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	published := pub.topic("geth.blocks")
+	if len(published) != 3 {
+		t.Fatalf("published block count mismatch: have %d, want 3", len(published))
+	}
+	for i, msg := range published {
+		var event BlockEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatalf("invalid block event: %v", err)
+		}
+		if want := blocks[i+1]; event.Hash != want.Hash() || uint64(event.Number) != want.NumberU64() || event.Transactions != 1 {
+			t.Errorf("block event %d mismatch: have #%d [%x]", i, event.Number, event.Hash)
+		}
+	}
+	txs := pub.topic("geth.transactions")
+	if len(txs) != 3 {
+		t.Fatalf("published transaction count mismatch: have %d, want 3", len(txs))
+	}
+	var tx TransactionEvent
+	if err := json.Unmarshal(txs[0].Value, &tx); err != nil {
+		t.Fatalf("invalid transaction event: %v", err)
+	}
+	if tx.From != testAddress || tx.Hash != blocks[1].Transactions()[0].Hash() {
+		t.Errorf("transaction event mismatch: have %x from %x", tx.Hash, tx.From)
+	}
+	receipts := pub.topic("geth.receipts")
+	if len(receipts) != 3 {
+		t.Fatalf("published receipt count mismatch: have %d, want 3", len(receipts))
+	}
+	var receipt ReceiptEvent
+	if err := json.Unmarshal(receipts[0].Value, &receipt); err != nil {
+		t.Fatalf("invalid receipt event: %v", err)
+	}
+	if uint64(receipt.Status) != types.ReceiptStatusSuccessful || uint64(receipt.GasUsed) != vars.TxGas {
+		t.Errorf("receipt event mismatch: have status %d and %d gas used", receipt.Status, receipt.GasUsed)
+	}
+	// The events of a block are published before the block itself
+	if last := pub.msgs[len(pub.msgs)-1]; last.Topic != "geth.blocks" || string(last.Key) != blocks[3].Hash().Hex() {
+		t.Errorf("last message mismatch: have %s %s", last.Topic, last.Key)
+	}
+}
+
+// Tests that failing to publish doesn't advance the cursor, and the blocks are
+// published again once the broker recovers.
+func TestPublishFailure(t *testing.T) {
+	service, backend, pub, gspec, gendb := newTestService(t)
+	defer backend.chain.Stop()
+
+	blocks := makeChain(gspec, gendb, backend.chain.Genesis(), 3, 0x01)
+	if _, err := backend.chain.InsertChain(blocks[:1]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if _, err := backend.chain.InsertChain(blocks[1:]); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	pub.fail = true
+	if err := service.sync(); err == nil {
+		t.Fatalf("publishing succeeded with failing broker")
+	}
+	if cursor := rawdb.ReadFirehoseCursor(backend.db); cursor == nil || cursor.Hash != blocks[0].Hash() {
+		t.Fatalf("cursor advanced after failure: have %v", cursor)
+	}
+	pub.fail = false
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if have := len(pub.topic("geth.blocks")); have != 3 {
+		t.Fatalf("published block count mismatch: have %d, want 3", have)
+	}
+	if cursor := rawdb.ReadFirehoseCursor(backend.db); cursor == nil || cursor.Hash != blocks[2].Hash() {
+		t.Fatalf("cursor mismatch: have %v, want #3", cursor)
+	}
+}
+
+// Tests that a reorg dropping published blocks is published before the blocks
+// of the new canonical chain.
+func TestPublishReorg(t *testing.T) {
+	service, backend, pub, gspec, gendb := newTestService(t)
+	defer backend.chain.Stop()
+
+	genesis := backend.chain.Genesis()
+	old := makeChain(gspec, gendb, genesis, 3, 0x01)
+	if _, err := backend.chain.InsertChain(old); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	// Replace the last two blocks with a heavier fork
+	fork := makeChain(gspec, gendb, old[0], 3, 0x02)
+	if _, err := backend.chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if backend.chain.CurrentBlock().Hash() != fork[2].Hash() {
+		t.Fatalf("fork not canonical")
+	}
+	pub.msgs = nil
+	if err := service.sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if len(pub.msgs) == 0 || pub.msgs[0].Topic != "geth.reorgs" {
+		t.Fatalf("reorg not published first")
+	}
+	var reorg ReorgEvent
+	if err := json.Unmarshal(pub.msgs[0].Value, &reorg); err != nil {
+		t.Fatalf("invalid reorg event: %v", err)
+	}
+	if reorg.AncestorHash != old[0].Hash() || len(reorg.Dropped) != 2 || reorg.Dropped[0] != old[2].Hash() || reorg.Dropped[1] != old[1].Hash() {
+		t.Fatalf("reorg event mismatch: have %+v", reorg)
+	}
+	if have := len(pub.topic("geth.blocks")); have != 3 {
+		t.Fatalf("published block count mismatch: have %d, want 3", have)
+	}
+	if have := len(pub.topic("contract-logs")); have != 0 {
+		t.Fatalf("published log count mismatch: have %d, want 0", have)
+	}
+	if cursor := rawdb.ReadFirehoseCursor(backend.db); cursor == nil || cursor.Hash != fork[2].Hash() {
+		t.Fatalf("cursor mismatch: have %v, want fork head", cursor)
+	}
+}
+
+// Tests the validation of the broker URLs.
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		scheme string
+		hosts  int
+		fail   bool
+	}{
+		{url: "kafka://b1:9092,b2:9092", scheme: "kafka", hosts: 2},
+		{url: "nats://localhost:4222", scheme: "nats", hosts: 1},
+		{url: "tls://localhost:4222", scheme: "tls", hosts: 1},
+		{url: "http://localhost", fail: true},
+		{url: "kafka://", fail: true},
+	}
+	for _, tt := range tests {
+		scheme, hosts, err := parseURL(tt.url)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: error mismatch: have %v, want failure %v", tt.url, err, tt.fail)
+			continue
+		}
+		if !tt.fail && (scheme != tt.scheme || len(hosts) != tt.hosts) {
+			t.Errorf("%s: have scheme %s and %d hosts, want %s and %d", tt.url, scheme, len(hosts), tt.scheme, tt.hosts)
+		}
+	}
+}
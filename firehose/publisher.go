@@ -0,0 +1,153 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package firehose
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/nats-io/nats.go"
+)
+
+// publishTimeout is the time allowed for the broker to acknowledge a batch of
+// messages.
+const publishTimeout = 30 * time.Second
+
+// Message is an event to publish on a topic.
+type Message struct {
+	Topic string
+	Key   []byte // Hash of the block the event belongs to, used for partitioning
+	Value []byte
+}
+
+// Publisher delivers messages to a broker. Publish returns once the broker
+// acknowledged all the messages, or failed, in which case the batch is
+// published again.
+type Publisher interface {
+	Publish(msgs []*Message) error
+	Close() error
+}
+
+// parseURL splits a broker URL into its scheme and hosts.
+func parseURL(rawurl string) (string, []string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid firehose URL: %v", err)
+	}
+	switch u.Scheme {
+	case "kafka", "nats", "tls":
+	default:
+		return "", nil, fmt.Errorf("unsupported firehose URL scheme %q, want kafka, nats or tls", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", nil, fmt.Errorf("firehose URL %q has no host", rawurl)
+	}
+	return u.Scheme, strings.Split(u.Host, ","), nil
+}
+
+// Dial connects to the broker of the given URL, either a Kafka cluster as
+// kafka://host:port[,host:port...] or a NATS server as nats://host:port, or as
+// tls://host:port to connect over TLS.
+func Dial(rawurl string) (Publisher, error) {
+	scheme, hosts, err := parseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == "kafka" {
+		return dialKafka(hosts)
+	}
+	return dialNATS(rawurl)
+}
+
+// kafkaPublisher publishes messages to a Kafka cluster, waiting for all the
+// in-sync replicas to acknowledge them.
+type kafkaPublisher struct {
+	producer sarama.SyncProducer
+}
+
+func dialKafka(brokers []string) (*kafkaPublisher, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "geth-firehose"
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Timeout = publishTimeout
+	config.Producer.MaxMessageBytes = 16 * 1024 * 1024
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaPublisher{producer: producer}, nil
+}
+
+func (p *kafkaPublisher) Publish(msgs []*Message) error {
+	batch := make([]*sarama.ProducerMessage, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = &sarama.ProducerMessage{
+			Topic: msg.Topic,
+			Key:   sarama.ByteEncoder(msg.Key),
+			Value: sarama.ByteEncoder(msg.Value),
+		}
+	}
+	return p.producer.SendMessages(batch)
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.producer.Close()
+}
+
+// natsPublisher publishes messages to a NATS server, flushing them with a round
+// trip to make sure the server received them.
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func dialNATS(url string) (*natsPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("geth-firehose"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn}, nil
+}
+
+func (p *natsPublisher) Publish(msgs []*Message) error {
+	for _, msg := range msgs {
+		if err := p.conn.Publish(msg.Topic, msg.Value); err != nil {
+			return err
+		}
+	}
+	if err := p.conn.FlushTimeout(publishTimeout); err != nil {
+		return err
+	}
+	if err := p.conn.LastError(); err != nil {
+		return err
+	}
+	if !p.conn.IsConnected() {
+		return errors.New("disconnected from NATS server")
+	}
+	return nil
+}
+
+func (p *natsPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
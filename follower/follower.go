@@ -0,0 +1,261 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package follower implements a service replicating the chain of a leader node
+// over RPC instead of the p2p network, keeping read replicas in lockstep with it.
+package follower
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/node"
+)
+
+const (
+	// importBatchSize is the maximum number of blocks imported at once.
+	importBatchSize = 128
+
+	// maxReorgDepth is the maximum number of blocks rewound looking for the
+	// common ancestor with the leader.
+	maxReorgDepth = 1024
+
+	// retryDelay is the time to wait before reconnecting to the leader after a
+	// failure.
+	retryDelay = 5 * time.Second
+)
+
+var (
+	importedMeter = metrics.NewRegisteredMeter("follower/imported", nil)
+	lagGauge      = metrics.NewRegisteredGauge("follower/lag", nil)
+)
+
+// Backend is the chain access needed by the follower, implemented by full nodes.
+type Backend interface {
+	BlockChain() *core.BlockChain
+}
+
+// Config contains the settings of the follower.
+type Config struct {
+	Leader string        // RPC endpoint of the leader node to replicate (empty = disabled)
+	Poll   time.Duration // Interval between polls of the leader head if it doesn't support subscriptions
+}
+
+// DefaultConfig contains the default settings of the follower.
+var DefaultConfig = Config{
+	Poll: 2 * time.Second,
+}
+
+// leader is the node the chain is replicated from.
+type leader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	Close()
+}
+
+// Service tails the chain head of a leader node, importing its blocks with full
+// verification as they are announced.
+type Service struct {
+	chain  *core.BlockChain
+	config Config
+	dial   func(ctx context.Context, url string) (leader, error)
+
+	ctx    context.Context // Cancelled when the service stops
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a follower and registers it with the node.
+func New(stack *node.Node, backend Backend, config Config) error {
+	if config.Leader == "" {
+		return errors.New("follower leader endpoint missing")
+	}
+	if stack.Config().P2P.MaxPeers > 0 {
+		log.Warn("Following a leader with p2p networking enabled", "maxpeers", stack.Config().P2P.MaxPeers)
+	}
+	stack.RegisterLifecycle(newService(backend, config, dial))
+	return nil
+}
+
+func dial(ctx context.Context, url string) (leader, error) {
+	return ethclient.DialContext(ctx, url)
+}
+
+func newService(backend Backend, config Config, dial func(context.Context, string) (leader, error)) *Service {
+	if config.Poll <= 0 {
+		config.Poll = DefaultConfig.Poll
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		chain:  backend.BlockChain(),
+		config: config,
+		dial:   dial,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start implements node.Lifecycle, starting to follow the leader.
+func (s *Service) Start() error {
+	s.wg.Add(1)
+	go s.loop()
+
+	log.Info("Following leader node", "leader", s.config.Leader)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the follower.
+func (s *Service) Stop() error {
+	s.cancel()
+	s.wg.Wait()
+
+	log.Info("Follower stopped")
+	return nil
+}
+
+// loop keeps a connection to the leader, reconnecting after failures.
+func (s *Service) loop() {
+	defer s.wg.Done()
+
+	for {
+		l, err := s.dial(s.ctx, s.config.Leader)
+		if err == nil {
+			err = s.follow(l)
+			l.Close()
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		log.Warn("Following leader failed", "leader", s.config.Leader, "err", err)
+		select {
+		case <-time.After(retryDelay):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// follow imports the blocks of the leader whenever its head changes, either
+// notified through a subscription or polled if subscriptions are not supported.
+func (s *Service) follow(l leader) error {
+	var (
+		heads = make(chan *types.Header, 16)
+		poll  <-chan time.Time
+		fail  <-chan error
+	)
+	sub, err := l.SubscribeNewHead(s.ctx, heads)
+	if err != nil {
+		log.Info("Polling leader head", "interval", s.config.Poll, "reason", err)
+		ticker := time.NewTicker(s.config.Poll)
+		defer ticker.Stop()
+		poll = ticker.C
+	} else {
+		defer sub.Unsubscribe()
+		fail = sub.Err()
+	}
+	if err := s.sync(l); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-heads:
+			if err := s.sync(l); err != nil {
+				return err
+			}
+		case <-poll:
+			if err := s.sync(l); err != nil {
+				return err
+			}
+		case err := <-fail:
+			return err
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sync imports the blocks of the leader missing from the local chain, after the
+// most recent block both chains have in common.
+func (s *Service) sync(l leader) error {
+	head, err := l.HeaderByNumber(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Find the common ancestor of the local and leader chains
+	number := s.chain.CurrentBlock().NumberU64()
+	if target := head.Number.Uint64(); number > target {
+		number = target
+	}
+	for depth := 0; ; depth++ {
+		header, err := l.HeaderByNumber(s.ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return err
+		}
+		if header.Hash() == s.chain.GetCanonicalHash(number) {
+			break
+		}
+		if number == 0 {
+			return fmt.Errorf("genesis mismatch: have %x, leader %x", s.chain.Genesis().Hash(), header.Hash())
+		}
+		if depth >= maxReorgDepth {
+			return fmt.Errorf("no common ancestor with the leader in the last %d blocks", maxReorgDepth)
+		}
+		number--
+	}
+	lagGauge.Update(int64(head.Number.Uint64() - number))
+
+	// Import the leader blocks in batches, retrying on the next head if the
+	// leader reorganised meanwhile
+	for number < head.Number.Uint64() {
+		parent := s.chain.GetCanonicalHash(number)
+
+		var blocks types.Blocks
+		for next := number + 1; next <= head.Number.Uint64() && len(blocks) < importBatchSize; next++ {
+			block, err := l.BlockByNumber(s.ctx, new(big.Int).SetUint64(next))
+			if err != nil {
+				return err
+			}
+			if block.ParentHash() != parent {
+				log.Debug("Leader reorganised while importing", "number", next)
+				return nil
+			}
+			blocks, parent = append(blocks, block), block.Hash()
+		}
+		if _, err := s.chain.InsertChain(blocks); err != nil {
+			return fmt.Errorf("failed to import leader blocks: %v", err)
+		}
+		importedMeter.Mark(int64(len(blocks)))
+
+		last := blocks[len(blocks)-1]
+		if s.chain.CurrentBlock().Hash() != last.Hash() {
+			return fmt.Errorf("leader block #%d [%x] not canonical locally", last.NumberU64(), last.Hash())
+		}
+		number = last.NumberU64()
+		lagGauge.Update(int64(head.Number.Uint64() - number))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package follower
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+)
+
+// testLeader serves the canonical chain of a local blockchain, without
+// subscription support.
+type testLeader struct {
+	chain *core.BlockChain
+}
+
+func (l *testLeader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		return l.chain.CurrentHeader(), nil
+	}
+	if header := l.chain.GetHeaderByNumber(number.Uint64()); header != nil {
+		return header, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (l *testLeader) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	if block := l.chain.GetBlockByNumber(number.Uint64()); block != nil {
+		return block, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (l *testLeader) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("notifications not supported")
+}
+
+func (l *testLeader) Close() {}
+
+type testBackend struct {
+	chain *core.BlockChain
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain { return b.chain }
+
+// newTestChain creates a blockchain with the given blocks imported.
+func newTestChain(t *testing.T, gspec *genesisT.Genesis, blocks []*types.Block) *core.BlockChain {
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return chain
+}
+
+// Tests that the follower imports the leader chain, reorganising onto it if the
+// local chain diverged.
+func TestSync(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		genesis = core.MustCommitGenesis(db, gspec)
+		engine  = ethash.NewFaker()
+	)
+	common, _ := core.GenerateChain(gspec.Config, genesis, engine, db, 5, nil)
+	local, _ := core.GenerateChain(gspec.Config, common[4], engine, db, 5, func(i int, b *core.BlockGen) {
+		b.SetExtra([]byte("local"))
+	})
+	remote, _ := core.GenerateChain(gspec.Config, common[4], engine, db, 300, nil)
+
+	leader := &testLeader{chain: newTestChain(t, gspec, append(common, remote...))}
+	defer leader.chain.Stop()
+
+	follower := newTestChain(t, gspec, append(common, local...))
+	defer follower.Stop()
+
+	s := newService(&testBackend{chain: follower}, DefaultConfig, nil)
+	if err := s.sync(leader); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if have, want := follower.CurrentBlock().Hash(), leader.chain.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch: have #%d [%x], want [%x]", follower.CurrentBlock().NumberU64(), have, want)
+	}
+	// Nothing to do if in sync
+	if err := s.sync(leader); err != nil {
+		t.Fatalf("repeated sync failed: %v", err)
+	}
+}
+
+// Tests that the follower refuses leaders of another network.
+func TestSyncGenesisMismatch(t *testing.T) {
+	leader := &testLeader{chain: newTestChain(t, &genesisT.Genesis{Config: params.TestChainConfig, ExtraData: []byte("other")}, nil)}
+	defer leader.chain.Stop()
+
+	follower := newTestChain(t, &genesisT.Genesis{Config: params.TestChainConfig}, nil)
+	defer follower.Stop()
+
+	if err := newService(&testBackend{chain: follower}, DefaultConfig, nil).sync(leader); err == nil {
+		t.Fatal("synced with a leader of another network")
+	}
+}
+
+// Tests that a running follower keeps polling the leader head.
+func TestFollow(t *testing.T) {
+	var (
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig}
+		genesis = core.MustCommitGenesis(rawdb.NewMemoryDatabase(), gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 10, nil)
+
+	remote := &testLeader{chain: newTestChain(t, gspec, blocks[:5])}
+	defer remote.chain.Stop()
+
+	follower := newTestChain(t, gspec, nil)
+	defer follower.Stop()
+
+	dial := func(ctx context.Context, url string) (leader, error) { return remote, nil }
+	s := newService(&testBackend{chain: follower}, Config{Leader: "test", Poll: 10 * time.Millisecond}, dial)
+	s.Start()
+	defer s.Stop()
+
+	if _, err := remote.chain.InsertChain(blocks[5:]); err != nil {
+		t.Fatalf("failed to extend leader chain: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); follower.CurrentBlock().NumberU64() != 10; {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower stuck at #%d", follower.CurrentBlock().NumberU64())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package grpcapi
+
+import (
+	"context"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+const chainHeadChanSize = 10
+
+var errStopping = status.Error(codes.Unavailable, "server stopping")
+
+// chainServer implements ChainServer on top of a backend.
+type chainServer struct {
+	backend        Backend
+	maxReceiptSpan uint64
+	quit           chan struct{} // Closed when the server stops, ending the streams
+}
+
+// SubscribeBlocks implements ChainServer, streaming the canonical blocks from
+// the requested one on, rewinding to the common ancestor on reorgs.
+func (s *chainServer) SubscribeBlocks(req *SubscribeBlocksRequest, stream Chain_SubscribeBlocksServer) error {
+	ctx := stream.Context()
+
+	heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := s.backend.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	var (
+		last *types.Header // Last block streamed
+		next = req.FromBlock
+	)
+	if next == 0 {
+		next = s.backend.CurrentHeader().Number.Uint64() + 1
+	}
+	for {
+		// Rewind to the common ancestor if the last block streamed got reorged
+		for last != nil {
+			canon, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(last.Number.Uint64()))
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if canon != nil && canon.Hash() == last.Hash() {
+				next = last.Number.Uint64() + 1
+				break
+			}
+			if last, err = s.backend.HeaderByHash(ctx, last.ParentHash); err != nil || last == nil {
+				return status.Error(codes.Internal, "ancestor of streamed block missing")
+			}
+		}
+		// Stream the blocks up to the current head, stopping if the chain
+		// reorganises meanwhile: the new head event will resume from there
+		head := s.backend.CurrentHeader().Number.Uint64()
+		for ; next <= head; next++ {
+			select {
+			case <-s.quit:
+				return errStopping
+			default:
+			}
+			block, err := s.backend.BlockByNumber(ctx, rpc.BlockNumber(next))
+			if err != nil || block == nil {
+				return status.Errorf(codes.NotFound, "block #%d not found", next)
+			}
+			if last != nil && block.ParentHash() != last.Hash() {
+				break
+			}
+			if err := stream.Send(s.encodeBlock(ctx, block, req.FullTransactions)); err != nil {
+				return err
+			}
+			last = block.Header()
+		}
+		select {
+		case <-heads:
+		case <-sub.Err():
+			return errStopping
+		case <-s.quit:
+			return errStopping
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetReceipts implements ChainServer, streaming the receipts of a range of
+// canonical blocks.
+func (s *chainServer) GetReceipts(req *GetReceiptsRequest, stream Chain_GetReceiptsServer) error {
+	ctx := stream.Context()
+
+	if req.FromBlock > req.ToBlock {
+		return status.Errorf(codes.InvalidArgument, "invalid block range: %d > %d", req.FromBlock, req.ToBlock)
+	}
+	if span := req.ToBlock - req.FromBlock + 1; s.maxReceiptSpan > 0 && span > s.maxReceiptSpan {
+		return status.Errorf(codes.InvalidArgument, "query spans %d blocks, more than the limit of %d", span, s.maxReceiptSpan)
+	}
+	if head := s.backend.CurrentHeader().Number.Uint64(); req.ToBlock > head {
+		return status.Errorf(codes.OutOfRange, "block #%d beyond the head #%d", req.ToBlock, head)
+	}
+	for number := req.FromBlock; number <= req.ToBlock; number++ {
+		select {
+		case <-s.quit:
+			return errStopping
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		header, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil || header == nil {
+			return status.Errorf(codes.NotFound, "block #%d not found", number)
+		}
+		receipts, err := s.backend.GetReceipts(ctx, header.Hash())
+		if err != nil {
+			return status.Errorf(codes.NotFound, "receipts of block #%d not found: %v", number, err)
+		}
+		msg := &BlockReceipts{
+			BlockNumber: number,
+			BlockHash:   header.Hash().Bytes(),
+			Receipts:    make([]*Receipt, len(receipts)),
+		}
+		for i, receipt := range receipts {
+			msg.Receipts[i] = encodeReceipt(receipt)
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetState implements ChainServer, reading the state of an account at a block.
+func (s *chainServer) GetState(ctx context.Context, req *GetStateRequest) (*GetStateResponse, error) {
+	if len(req.Address) != common.AddressLength {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid address length %d", len(req.Address))
+	}
+	block := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	switch b := req.Block.(type) {
+	case *GetStateRequest_BlockNumber:
+		if b.BlockNumber > math.MaxInt64 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid block number %d", b.BlockNumber)
+		}
+		block = rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(b.BlockNumber))
+	case *GetStateRequest_BlockHash:
+		if len(b.BlockHash) != common.HashLength {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid block hash length %d", len(b.BlockHash))
+		}
+		block = rpc.BlockNumberOrHashWithHash(common.BytesToHash(b.BlockHash), false)
+	}
+	statedb, header, err := s.backend.StateAndHeaderByNumberOrHash(ctx, block)
+	if err != nil || statedb == nil {
+		msg := "state not available"
+		if err != nil {
+			msg = err.Error()
+		}
+		return nil, status.Error(codes.NotFound, msg)
+	}
+	var (
+		addr = common.BytesToAddress(req.Address)
+		resp = &GetStateResponse{
+			BlockNumber: header.Number.Uint64(),
+			BlockHash:   header.Hash().Bytes(),
+			Balance:     statedb.GetBalance(addr).Bytes(),
+			Nonce:       statedb.GetNonce(addr),
+			CodeHash:    statedb.GetCodeHash(addr).Bytes(),
+			Storage:     make([]*StorageSlot, len(req.StorageKeys)),
+		}
+	)
+	if req.IncludeCode {
+		resp.Code = statedb.GetCode(addr)
+	}
+	for i, key := range req.StorageKeys {
+		if len(key) > common.HashLength {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid storage key length %d", len(key))
+		}
+		value := statedb.GetState(addr, common.BytesToHash(key))
+		resp.Storage[i] = &StorageSlot{Key: key, Value: value.Bytes()}
+	}
+	return resp, statedb.Error()
+}
+
+// encodeBlock converts a block into its protobuf representation.
+func (s *chainServer) encodeBlock(ctx context.Context, block *types.Block, fullTxs bool) *Block {
+	msg := &Block{
+		Header:            encodeHeader(block.Header()),
+		TransactionHashes: make([][]byte, len(block.Transactions())),
+		UncleHashes:       make([][]byte, len(block.Uncles())),
+		Size:              uint64(block.Size()),
+	}
+	if td := s.backend.GetTd(ctx, block.Hash()); td != nil {
+		msg.TotalDifficulty = td.Bytes()
+	}
+	signer := types.MakeSigner(s.backend.ChainConfig(), block.Number())
+	for i, tx := range block.Transactions() {
+		msg.TransactionHashes[i] = tx.Hash().Bytes()
+		if fullTxs {
+			msg.Transactions = append(msg.Transactions, encodeTransaction(signer, tx))
+		}
+	}
+	for i, uncle := range block.Uncles() {
+		msg.UncleHashes[i] = uncle.Hash().Bytes()
+	}
+	return msg
+}
+
+// encodeHeader converts a header into its protobuf representation.
+func encodeHeader(header *types.Header) *Header {
+	return &Header{
+		Number:           header.Number.Uint64(),
+		Hash:             header.Hash().Bytes(),
+		ParentHash:       header.ParentHash.Bytes(),
+		UncleHash:        header.UncleHash.Bytes(),
+		Coinbase:         header.Coinbase.Bytes(),
+		StateRoot:        header.Root.Bytes(),
+		TransactionsRoot: header.TxHash.Bytes(),
+		ReceiptsRoot:     header.ReceiptHash.Bytes(),
+		LogsBloom:        header.Bloom.Bytes(),
+		Difficulty:       header.Difficulty.Bytes(),
+		GasLimit:         header.GasLimit,
+		GasUsed:          header.GasUsed,
+		Timestamp:        header.Time,
+		ExtraData:        header.Extra,
+		MixDigest:        header.MixDigest.Bytes(),
+		Nonce:            header.Nonce.Uint64(),
+	}
+}
+
+// encodeTransaction converts a transaction into its protobuf representation.
+func encodeTransaction(signer types.Signer, tx *types.Transaction) *Transaction {
+	from, _ := types.Sender(signer, tx)
+	msg := &Transaction{
+		Hash:     tx.Hash().Bytes(),
+		From:     from.Bytes(),
+		Value:    tx.Value().Bytes(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice().Bytes(),
+		Nonce:    tx.Nonce(),
+		Input:    tx.Data(),
+	}
+	if to := tx.To(); to != nil {
+		msg.To = to.Bytes()
+	}
+	return msg
+}
+
+// encodeReceipt converts a receipt into its protobuf representation.
+func encodeReceipt(receipt *types.Receipt) *Receipt {
+	msg := &Receipt{
+		TransactionHash:   receipt.TxHash.Bytes(),
+		TransactionIndex:  uint32(receipt.TransactionIndex),
+		Status:            receipt.Status,
+		CumulativeGasUsed: receipt.CumulativeGasUsed,
+		GasUsed:           receipt.GasUsed,
+		LogsBloom:         receipt.Bloom.Bytes(),
+		Logs:              make([]*Log, len(receipt.Logs)),
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		msg.ContractAddress = receipt.ContractAddress.Bytes()
+	}
+	for i, l := range receipt.Logs {
+		topics := make([][]byte, len(l.Topics))
+		for j, topic := range l.Topics {
+			topics[j] = topic.Bytes()
+		}
+		msg.Logs[i] = &Log{Address: l.Address.Bytes(), Topics: topics, Data: l.Data, Index: uint32(l.Index)}
+	}
+	return msg
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package grpcapi implements a gRPC server streaming the canonical chain and
+// serving state reads, for consumers bottlenecked by JSON-RPC encoding.
+package grpcapi
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. chain.proto
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rpc"
+	"google.golang.org/grpc"
+)
+
+// Backend is the chain access needed by the gRPC server, implemented by both
+// full and light nodes.
+type Backend interface {
+	ChainConfig() ctypes.ChainConfigurator
+	CurrentHeader() *types.Header
+	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
+	GetTd(ctx context.Context, hash common.Hash) *big.Int
+	StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error)
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// Config contains the settings of the gRPC server.
+type Config struct {
+	Host           string // Interface to listen on, the server is disabled if empty
+	Port           int    // TCP port to listen on
+	MaxStreams     uint32 // Maximum number of concurrent streams per connection
+	MaxReceiptSpan uint64 // Maximum number of blocks a receipt query may span (0 = no cap)
+}
+
+// DefaultConfig contains the default settings of the gRPC server.
+var DefaultConfig = Config{
+	Port:           8549,
+	MaxStreams:     100,
+	MaxReceiptSpan: 10000,
+}
+
+// Endpoint returns the address the server listens on.
+func (c *Config) Endpoint() string {
+	return net.JoinHostPort(c.Host, fmt.Sprint(c.Port))
+}
+
+// Service is the gRPC server, running alongside the node's other RPC endpoints
+// on its own port.
+type Service struct {
+	config   Config
+	chain    *chainServer
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// New creates a gRPC server and registers it with the node.
+func New(stack *node.Node, backend Backend, config Config) error {
+	if backend == nil {
+		panic("missing backend")
+	}
+	stack.RegisterLifecycle(newService(backend, config))
+	return nil
+}
+
+func newService(backend Backend, config Config) *Service {
+	return &Service{
+		config: config,
+		chain:  &chainServer{backend: backend, maxReceiptSpan: config.MaxReceiptSpan, quit: make(chan struct{})},
+	}
+}
+
+// Start implements node.Lifecycle, starting to serve gRPC requests.
+func (s *Service) Start() error {
+	listener, err := net.Listen("tcp", s.config.Endpoint())
+	if err != nil {
+		return err
+	}
+	var opts []grpc.ServerOption
+	if s.config.MaxStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(s.config.MaxStreams))
+	}
+	s.listener, s.server = listener, grpc.NewServer(opts...)
+	RegisterChainServer(s.server, s.chain)
+
+	go s.server.Serve(listener)
+	log.Info("gRPC server started", "endpoint", listener.Addr())
+	return nil
+}
+
+// Stop implements node.Lifecycle, ending the block subscriptions and waiting
+// for the running requests to finish.
+func (s *Service) Stop() error {
+	close(s.chain.quit)
+	s.server.GracefulStop()
+	log.Info("gRPC server stopped", "endpoint", s.listener.Addr())
+	return nil
+}
+
+// Endpoint returns the address the server listens on, nil if not started.
+func (s *Service) Endpoint() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
@@ -0,0 +1,304 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(1000000000000000000)
+	testStorage = common.Address{0xff}
+)
+
+// testBackend implements Backend on top of a blockchain.
+type testBackend struct {
+	chain *core.BlockChain
+}
+
+func (b *testBackend) ChainConfig() ctypes.ChainConfigurator { return b.chain.Config() }
+func (b *testBackend) CurrentHeader() *types.Header          { return b.chain.CurrentHeader() }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *testBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
+	return b.chain.GetTdByHash(hash)
+}
+
+func (b *testBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	var header *types.Header
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		header = b.chain.GetHeaderByHash(hash)
+	} else if number, _ := blockNrOrHash.Number(); number == rpc.LatestBlockNumber {
+		header = b.chain.CurrentHeader()
+	} else {
+		header = b.chain.GetHeaderByNumber(uint64(number))
+	}
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.chain.SubscribeChainHeadEvent(ch)
+}
+
+// newTestServer starts a gRPC server on top of a chain with a transfer in every
+// block, and connects a client to it.
+func newTestServer(t *testing.T, n int) (*Service, ChainClient, *testBackend, *genesisT.Genesis, ethdb.Database) {
+	gspec := &genesisT.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: genesisT.GenesisAlloc{
+			testAddress: {Balance: testBalance},
+			testStorage: {Balance: big.NewInt(0), Code: []byte{0x00}, Storage: map[common.Hash]common.Hash{common.BytesToHash([]byte{0x01}): {0x02}}},
+		},
+	}
+	db := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(db, gspec)
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	gendb := rawdb.NewMemoryDatabase()
+	core.MustCommitGenesis(gendb, gspec)
+	if _, err := chain.InsertChain(makeChain(gspec, gendb, chain.Genesis(), n, 0x01)); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	backend := &testBackend{chain: chain}
+	service := newService(backend, Config{Host: "127.0.0.1", MaxReceiptSpan: 8})
+	if err := service.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	conn, err := grpc.Dial(service.Endpoint().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		chain.Stop()
+	})
+	return service, NewChainClient(conn), backend, gspec, gendb
+}
+
+// makeChain generates blocks on top of the given parent, each with a transfer.
+// The state of the parent must be available in the database.
+func makeChain(gspec *genesisT.Genesis, db ethdb.Database, parent *types.Block, n int, seed byte) []*types.Block {
+	blocks, _ := core.GenerateChain(gspec.Config, parent, ethash.NewFaker(), db, n, func(i int, block *core.BlockGen) {
+		block.SetCoinbase(common.Address{seed})
+		signer := types.MakeSigner(gspec.Config, block.Number())
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddress), common.Address{seed}, big.NewInt(1000), vars.TxGas, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	return blocks
+}
+
+// Tests reading account and storage state at various blocks.
+func TestGetState(t *testing.T) {
+	service, client, backend, _, _ := newTestServer(t, 3)
+	defer service.Stop()
+
+	ctx := context.Background()
+	resp, err := client.GetState(ctx, &GetStateRequest{Address: testAddress.Bytes()})
+	if err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if resp.BlockNumber != 3 || resp.Nonce != 3 || !bytes.Equal(resp.BlockHash, backend.chain.CurrentBlock().Hash().Bytes()) {
+		t.Errorf("head state mismatch: have block #%d and nonce %d", resp.BlockNumber, resp.Nonce)
+	}
+	if balance := new(big.Int).SetBytes(resp.Balance); balance.Cmp(testBalance) >= 0 {
+		t.Errorf("head balance not spent: have %v", balance)
+	}
+	resp, err = client.GetState(ctx, &GetStateRequest{Address: testAddress.Bytes(), Block: &GetStateRequest_BlockNumber{BlockNumber: 0}})
+	if err != nil {
+		t.Fatalf("failed to read genesis state: %v", err)
+	}
+	if resp.Nonce != 0 || new(big.Int).SetBytes(resp.Balance).Cmp(testBalance) != 0 {
+		t.Errorf("genesis state mismatch: have nonce %d and balance %x", resp.Nonce, resp.Balance)
+	}
+	genesis := backend.chain.Genesis().Hash()
+	resp, err = client.GetState(ctx, &GetStateRequest{
+		Address:     testStorage.Bytes(),
+		Block:       &GetStateRequest_BlockHash{BlockHash: genesis.Bytes()},
+		StorageKeys: [][]byte{{0x01}, {0x02}},
+		IncludeCode: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to read storage: %v", err)
+	}
+	if len(resp.Storage) != 2 || !bytes.Equal(resp.Storage[0].Value, common.Hash{0x02}.Bytes()) || !bytes.Equal(resp.Storage[1].Value, common.Hash{}.Bytes()) {
+		t.Errorf("storage mismatch: have %v", resp.Storage)
+	}
+	if !bytes.Equal(resp.Code, []byte{0x00}) || !bytes.Equal(resp.CodeHash, crypto.Keccak256([]byte{0x00})) {
+		t.Errorf("code mismatch: have %x with hash %x", resp.Code, resp.CodeHash)
+	}
+	// Invalid requests are rejected
+	for _, req := range []*GetStateRequest{
+		{Address: []byte{0x01}},
+		{Address: testAddress.Bytes(), Block: &GetStateRequest_BlockHash{BlockHash: []byte{0x01}}},
+		{Address: testAddress.Bytes(), StorageKeys: [][]byte{make([]byte, 33)}},
+	} {
+		if _, err := client.GetState(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("invalid request %v: have error %v, want invalid argument", req, err)
+		}
+	}
+	if _, err := client.GetState(ctx, &GetStateRequest{Address: testAddress.Bytes(), Block: &GetStateRequest_BlockNumber{BlockNumber: 10}}); status.Code(err) != codes.NotFound {
+		t.Errorf("missing block: have error %v, want not found", err)
+	}
+}
+
+// Tests streaming the receipts of a range of blocks.
+func TestGetReceipts(t *testing.T) {
+	service, client, backend, _, _ := newTestServer(t, 4)
+	defer service.Stop()
+
+	stream, err := client.GetReceipts(context.Background(), &GetReceiptsRequest{FromBlock: 1, ToBlock: 3})
+	if err != nil {
+		t.Fatalf("failed to request receipts: %v", err)
+	}
+	for number := uint64(1); number <= 3; number++ {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("failed to receive receipts of block #%d: %v", number, err)
+		}
+		block := backend.chain.GetBlockByNumber(number)
+		if msg.BlockNumber != number || !bytes.Equal(msg.BlockHash, block.Hash().Bytes()) {
+			t.Fatalf("receipts block mismatch: have #%d, want #%d", msg.BlockNumber, number)
+		}
+		if len(msg.Receipts) != 1 {
+			t.Fatalf("receipt count of block #%d mismatch: have %d, want 1", number, len(msg.Receipts))
+		}
+		receipt := msg.Receipts[0]
+		if receipt.Status != types.ReceiptStatusSuccessful || receipt.GasUsed != vars.TxGas || !bytes.Equal(receipt.TransactionHash, block.Transactions()[0].Hash().Bytes()) {
+			t.Errorf("receipt of block #%d mismatch: have %v", number, receipt)
+		}
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Fatalf("receipts streamed beyond the range")
+	}
+	// Invalid ranges are rejected
+	for _, tt := range []struct {
+		from, to uint64
+		code     codes.Code
+	}{
+		{3, 1, codes.InvalidArgument},
+		{0, 10, codes.InvalidArgument},
+		{1, 5, codes.OutOfRange},
+	} {
+		stream, err := client.GetReceipts(context.Background(), &GetReceiptsRequest{FromBlock: tt.from, ToBlock: tt.to})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("range %d-%d: have error %v, want %v", tt.from, tt.to, err, tt.code)
+		}
+	}
+}
+
+// Tests streaming the canonical blocks, from the past and as new heads arrive,
+// rewinding on reorgs.
+func TestSubscribeBlocks(t *testing.T) {
+	service, client, backend, gspec, gendb := newTestServer(t, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.SubscribeBlocks(ctx, &SubscribeBlocksRequest{FromBlock: 2, FullTransactions: true})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	expect := func(block *types.Block) {
+		t.Helper()
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("failed to receive block #%d: %v", block.NumberU64(), err)
+		}
+		if msg.Header.Number != block.NumberU64() || !bytes.Equal(msg.Header.Hash, block.Hash().Bytes()) {
+			t.Fatalf("block mismatch: have #%d [%x], want #%d [%x]", msg.Header.Number, msg.Header.Hash, block.NumberU64(), block.Hash())
+		}
+		if len(msg.Transactions) != 1 || !bytes.Equal(msg.Transactions[0].From, testAddress.Bytes()) {
+			t.Fatalf("transactions of block #%d mismatch: have %v", block.NumberU64(), msg.Transactions)
+		}
+		if td := backend.chain.GetTdByHash(block.Hash()); new(big.Int).SetBytes(msg.TotalDifficulty).Cmp(td) != 0 {
+			t.Fatalf("total difficulty of block #%d mismatch: have %x, want %v", block.NumberU64(), msg.TotalDifficulty, td)
+		}
+	}
+	// Past blocks are streamed first, then the new heads
+	expect(backend.chain.GetBlockByNumber(2))
+	expect(backend.chain.GetBlockByNumber(3))
+
+	head := backend.chain.CurrentBlock()
+	next := makeChain(gspec, gendb, head, 1, 0x01)
+	if _, err := backend.chain.InsertChain(next); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	expect(next[0])
+
+	// A reorg streams the new canonical chain from the common ancestor on
+	fork := makeChain(gspec, gendb, head, 2, 0x02)
+	if _, err := backend.chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	expect(fork[0])
+	expect(fork[1])
+
+	// Stopping the server ends the stream
+	service.Stop()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("stream error mismatch after stop: have %v, want unavailable", err)
+	}
+}
@@ -22,7 +22,9 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
@@ -46,6 +48,10 @@ var (
 		Usage: "Per-module verbosity: comma-separated list of <pattern>=<level> (e.g. eth/*=5,p2p=4)",
 		Value: "",
 	}
+	logDirFlag = cli.StringFlag{
+		Name:  "datadir.logs",
+		Usage: "Directory to also write the log output into, as <program>.log (default = no log file)",
+	}
 	backtraceAtFlag = cli.StringFlag{
 		Name:  "backtrace",
 		Usage: "Request a stack trace at a specific logging statement (e.g. \"block.go:271\")",
@@ -114,7 +120,7 @@ var (
 
 // Flags holds all command-line flags required for debugging.
 var Flags = []cli.Flag{
-	verbosityFlag, vmoduleFlag, backtraceAtFlag, debugFlag,
+	verbosityFlag, vmoduleFlag, logDirFlag, backtraceAtFlag, debugFlag,
 	pprofFlag, pprofAddrFlag, pprofPortFlag, memprofilerateFlag,
 	blockprofilerateFlag, cpuprofileFlag, traceFlag,
 }
@@ -147,6 +153,18 @@ func Setup(ctx *cli.Context) error {
 	glogger.Verbosity(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)))
 	glogger.Vmodule(ctx.GlobalString(vmoduleFlag.Name))
 	glogger.BacktraceAt(ctx.GlobalString(backtraceAtFlag.Name))
+	if dir := ctx.GlobalString(logDirFlag.Name); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("invalid log directory %q: %v", dir, err)
+		}
+		name := filepath.Base(os.Args[0])
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".log"
+		file, err := log.FileHandler(filepath.Join(dir, name), log.TerminalFormat(false))
+		if err != nil {
+			return fmt.Errorf("invalid log directory %q: %v", dir, err)
+		}
+		glogger.SetHandler(log.MultiHandler(ostream, file))
+	}
 	log.Root().SetHandler(glogger)
 
 	// profiling, tracing
@@ -30,20 +30,25 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/accounts/scwallet"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params/vars"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/tyler-smith/go-bip39"
 )
 
@@ -64,6 +69,51 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*hexutil.Big, error)
 	return (*hexutil.Big)(price), err
 }
 
+// GasForecast is the predicted gas prices needed for inclusion in the next
+// blocks, at the requested percentiles.
+type GasForecast struct {
+	Head       hexutil.Uint64      `json:"head"`
+	GasLimit   hexutil.Uint64      `json:"gasLimit"`
+	Fullness   float64             `json:"fullness"`
+	GasUsed    []float64           `json:"gasUsedRatio"`
+	PendingGas hexutil.Uint64      `json:"pendingGas"`
+	Blocks     []*GasForecastBlock `json:"blocks"`
+}
+
+// GasForecastBlock is the predicted gas prices needed for inclusion in one of
+// the next blocks.
+type GasForecastBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Prices []*hexutil.Big `json:"prices"`
+}
+
+// GasForecast returns the gas prices predicted to be needed for inclusion in
+// each of the given number of next blocks, at the given percentiles of
+// likelihood (10, 50 and 90 by default), based on the gas used by the recent
+// blocks and the transactions pending in the pool.
+func (s *PublicEthereumAPI) GasForecast(ctx context.Context, blocks hexutil.Uint, percentiles []float64) (*GasForecast, error) {
+	forecast, err := s.b.GasForecast(ctx, int(blocks), percentiles)
+	if err != nil {
+		return nil, err
+	}
+	result := &GasForecast{
+		Head:       hexutil.Uint64(forecast.Head),
+		GasLimit:   hexutil.Uint64(forecast.GasLimit),
+		Fullness:   forecast.Fullness,
+		GasUsed:    forecast.GasUsed,
+		PendingGas: hexutil.Uint64(forecast.PendingGas),
+		Blocks:     make([]*GasForecastBlock, len(forecast.Blocks)),
+	}
+	for i, block := range forecast.Blocks {
+		prices := make([]*hexutil.Big, len(block.Prices))
+		for j, price := range block.Prices {
+			prices[j] = (*hexutil.Big)(price)
+		}
+		result.Blocks[i] = &GasForecastBlock{Number: hexutil.Uint64(block.Number), Prices: prices}
+	}
+	return result, nil
+}
+
 // ProtocolVersion returns the current Ethereum protocol version this node supports
 func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 	return hexutil.Uint(s.b.ProtocolVersion())
@@ -76,8 +126,11 @@ func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 // - highestBlock:  block number of the highest block header this node has received from peers
 // - pulledStates:  number of state entries processed until now
 // - knownStates:   number of known state entries that still need to be pulled
+// - stage:         most advanced sync stage currently active
+// - stages:        progress of the stages the sync mode goes through
+// - ancients:      status of the ancient store backfill
 func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
-	progress := s.b.Downloader().Progress()
+	progress := s.b.Downloader().Status()
 
 	// Return not syncing if the synchronisation already completed
 	if progress.CurrentBlock >= progress.HighestBlock {
@@ -90,9 +143,41 @@ func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
 		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
 		"pulledStates":  hexutil.Uint64(progress.PulledStates),
 		"knownStates":   hexutil.Uint64(progress.KnownStates),
+		"stage":         progress.Stage,
+		"stages":        syncStages(&progress),
+		"ancients": map[string]interface{}{
+			"frozen":      hexutil.Uint64(progress.Ancients.Frozen),
+			"target":      hexutil.Uint64(progress.Ancients.Target),
+			"historyTail": hexutil.Uint64(progress.Ancients.HistoryTail),
+		},
 	}, nil
 }
 
+// syncStages formats the progress of the stages of a sync cycle.
+func syncStages(status *downloader.SyncStatus) map[string]interface{} {
+	stages := make(map[string]interface{})
+	for name, stage := range map[string]*downloader.StageProgress{
+		downloader.StageHeaders:  status.Headers,
+		downloader.StageBodies:   status.Bodies,
+		downloader.StageReceipts: status.Receipts,
+		downloader.StageState:    status.State,
+	} {
+		if stage == nil {
+			continue
+		}
+		fields := map[string]interface{}{
+			"current": hexutil.Uint64(stage.Current),
+			"highest": hexutil.Uint64(stage.Highest),
+			"pending": hexutil.Uint64(stage.Pending),
+		}
+		if stage.ETA > 0 {
+			fields["eta"] = stage.ETA.String()
+		}
+		stages[name] = fields
+	}
+	return stages
+}
+
 // PublicTxPoolAPI offers and API for the transaction pool. It only operates on data that is non confidential.
 type PublicTxPoolAPI struct {
 	b Backend
@@ -258,9 +343,18 @@ func (s *PrivateAccountAPI) OpenWallet(url string, passphrase *string) error {
 }
 
 // DeriveAccount requests a HD wallet to derive a new account, optionally pinning
-// it for later reuse.
+// it for later reuse. If the wallet url is empty, the account is derived on the
+// hardware wallet open, if there's exactly one.
 func (s *PrivateAccountAPI) DeriveAccount(url string, path string, pin *bool) (accounts.Account, error) {
-	wallet, err := s.am.Wallet(url)
+	var (
+		wallet accounts.Wallet
+		err    error
+	)
+	if url == "" {
+		wallet, err = s.openHardwareWallet()
+	} else {
+		wallet, err = s.am.Wallet(url)
+	}
 	if err != nil {
 		return accounts.Account{}, err
 	}
@@ -290,6 +384,28 @@ func (s *PrivateAccountAPI) NewAccount(password string) (common.Address, error)
 	return common.Address{}, err
 }
 
+// openHardwareWallet returns the hardware wallet open, failing if there's none
+// or more than one.
+func (s *PrivateAccountAPI) openHardwareWallet() (accounts.Wallet, error) {
+	var open []accounts.Wallet
+	for _, wallet := range s.am.Wallets() {
+		if scheme := wallet.URL().Scheme; scheme != usbwallet.LedgerScheme && scheme != usbwallet.TrezorScheme {
+			continue
+		}
+		if status, _ := wallet.Status(); status != "Closed" {
+			open = append(open, wallet)
+		}
+	}
+	switch len(open) {
+	case 0:
+		return nil, errors.New("no hardware wallet open")
+	case 1:
+		return open[0], nil
+	default:
+		return nil, errors.New("multiple hardware wallets open, wallet url required")
+	}
+}
+
 // fetchKeystore retrieves the encrypted keystore from the account manager.
 func fetchKeystore(am *accounts.Manager) (*keystore.KeyStore, error) {
 	if ks := am.Backends(keystore.KeyStoreType); len(ks) > 0 {
@@ -450,6 +566,22 @@ func (s *PrivateAccountAPI) Sign(ctx context.Context, data hexutil.Bytes, addr c
 	return signature, nil
 }
 
+// SignTypedData calculates an Ethereum ECDSA signature over EIP-712 typed data:
+// keccak256("\x19\x01" + domainSeparator + hashStruct(message))
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+//
+// The key used to calculate the signature is decrypted with the given password.
+func (s *PrivateAccountAPI) SignTypedData(ctx context.Context, addr common.Address, typedData apitypes.TypedData, passwd string) (hexutil.Bytes, error) {
+	signature, err := signTypedData(s.b.AccountManager(), addr, typedData, &passwd)
+	if err != nil {
+		log.Warn("Failed typed data sign attempt", "address", addr, "err", err)
+		return nil, err
+	}
+	return signature, nil
+}
+
 // EcRecover returns the address for the account that was used to create the signature.
 // Note, this function is compatible with eth_sign and personal_sign. As such it recovers
 // the address of:
@@ -527,17 +659,21 @@ func (s *PrivateAccountAPI) Unpair(ctx context.Context, url string, pin string)
 // PublicBlockChainAPI provides an API to access the Ethereum blockchain.
 // It offers only methods that operate on public data that is freely available to anyone.
 type PublicBlockChainAPI struct {
-	b Backend
+	b     Backend
+	cache *responseCache
 }
 
 // NewPublicBlockChainAPI creates a new Ethereum blockchain API.
 func NewPublicBlockChainAPI(b Backend) *PublicBlockChainAPI {
-	return &PublicBlockChainAPI{b}
+	return &PublicBlockChainAPI{b: b}
 }
 
 // ChainId returns the chainID value for transaction replay protection.
 func (s *PublicBlockChainAPI) ChainId() *hexutil.Big {
-	return (*hexutil.Big)(s.b.ChainConfig().GetChainID())
+	id, _ := s.cache.fetch("chainId", func() (interface{}, common.Hash, bool, error) {
+		return (*hexutil.Big)(s.b.ChainConfig().GetChainID()), common.Hash{}, true, nil
+	})
+	return id.(*hexutil.Big)
 }
 
 // BlockNumber returns the block number of the chain head.
@@ -574,15 +710,62 @@ type StorageResult struct {
 }
 
 // GetProof returns the Merkle-proof for a given account and optionally some storage keys.
+//
+// Any block whose state is still available can be queried, so archive nodes are
+// able to serve proofs for the entire history of the chain.
 func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
-	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
-	if state == nil || err != nil {
+	state, err := s.proofState(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return accountProof(state, address, storageKeys)
+}
+
+// ProofRequest is a single account of a batch proof request, optionally along
+// with some of its storage keys.
+type ProofRequest struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []string       `json:"storageKeys"`
+}
+
+// GetProofs returns the Merkle-proofs for a batch of accounts and their storage
+// keys, all proven against the state of the same block.
+func (s *PublicBlockChainAPI) GetProofs(ctx context.Context, requests []ProofRequest, blockNrOrHash rpc.BlockNumberOrHash) ([]*AccountResult, error) {
+	state, err := s.proofState(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*AccountResult, len(requests))
+	for i, req := range requests {
+		if results[i], err = accountProof(state, req.Address, req.StorageKeys); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// proofState retrieves the state to create proofs from, reporting if it was
+// already pruned.
+func (s *PublicBlockChainAPI) proofState(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, error) {
+	statedb, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		if _, ok := err.(*trie.MissingNodeError); ok {
+			return nil, fmt.Errorf("state not available, proofs of historical blocks require an archive node (%v)", err)
+		}
 		return nil, err
 	}
+	if statedb == nil {
+		return nil, errors.New("state not found")
+	}
+	return statedb, nil
+}
 
-	storageTrie := state.StorageTrie(address)
+// accountProof creates the Merkle-proof of an account and some of its storage
+// keys from the given state.
+func accountProof(statedb *state.StateDB, address common.Address, storageKeys []string) (*AccountResult, error) {
+	storageTrie := statedb.StorageTrie(address)
 	storageHash := types.EmptyRootHash
-	codeHash := state.GetCodeHash(address)
+	codeHash := statedb.GetCodeHash(address)
 	storageProof := make([]StorageResult, len(storageKeys))
 
 	// if we have a storageTrie, (which means the account exists), we can update the storagehash
@@ -596,18 +779,18 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	// create the proof for the storageKeys
 	for i, key := range storageKeys {
 		if storageTrie != nil {
-			proof, storageError := state.GetStorageProof(address, common.HexToHash(key))
+			proof, storageError := statedb.GetStorageProof(address, common.HexToHash(key))
 			if storageError != nil {
 				return nil, storageError
 			}
-			storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, common.HexToHash(key)).Big()), common.ToHexArray(proof)}
+			storageProof[i] = StorageResult{key, (*hexutil.Big)(statedb.GetState(address, common.HexToHash(key)).Big()), common.ToHexArray(proof)}
 		} else {
 			storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
 		}
 	}
 
 	// create the accountProof
-	accountProof, proofErr := state.GetProof(address)
+	accountProof, proofErr := statedb.GetProof(address)
 	if proofErr != nil {
 		return nil, proofErr
 	}
@@ -615,12 +798,12 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	return &AccountResult{
 		Address:      address,
 		AccountProof: common.ToHexArray(accountProof),
-		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		Balance:      (*hexutil.Big)(statedb.GetBalance(address)),
 		CodeHash:     codeHash,
-		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		Nonce:        hexutil.Uint64(statedb.GetNonce(address)),
 		StorageHash:  storageHash,
 		StorageProof: storageProof,
-	}, state.Error()
+	}, statedb.Error()
 }
 
 // GetHeaderByNumber returns the requested canonical block header.
@@ -650,12 +833,218 @@ func (s *PublicBlockChainAPI) GetHeaderByHash(ctx context.Context, hash common.H
 	return nil
 }
 
+// GetTotalDifficulty returns the total difficulty of the chain up to and including
+// the requested block.
+func (s *PublicBlockChainAPI) GetTotalDifficulty(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	header, err := s.b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	td := s.b.GetTd(ctx, header.Hash())
+	if td == nil {
+		return nil, fmt.Errorf("total difficulty of block #%d [%x] unknown", header.Number, header.Hash())
+	}
+	return (*hexutil.Big)(td), nil
+}
+
+// ChainWeightComparison is the result of comparing the total difficulties of the
+// chains ending in two blocks.
+type ChainWeightComparison struct {
+	TotalDifficultyA *hexutil.Big `json:"totalDifficultyA"`
+	TotalDifficultyB *hexutil.Big `json:"totalDifficultyB"`
+	Difference       *hexutil.Big `json:"difference"` // Total difficulty of A minus the one of B
+	Heavier          *common.Hash `json:"heavier"`    // Hash of the heavier block, nil if equal
+}
+
+// CompareChainWeight compares the total difficulties of the chains ending in the
+// two given blocks, as done by the fork choice rule.
+func (s *PublicBlockChainAPI) CompareChainWeight(ctx context.Context, a, b common.Hash) (*ChainWeightComparison, error) {
+	tdA, tdB := s.b.GetTd(ctx, a), s.b.GetTd(ctx, b)
+	if tdA == nil {
+		return nil, fmt.Errorf("total difficulty of block %x unknown", a)
+	}
+	if tdB == nil {
+		return nil, fmt.Errorf("total difficulty of block %x unknown", b)
+	}
+	res := &ChainWeightComparison{
+		TotalDifficultyA: (*hexutil.Big)(tdA),
+		TotalDifficultyB: (*hexutil.Big)(tdB),
+		Difference:       (*hexutil.Big)(new(big.Int).Sub(tdA, tdB)),
+	}
+	switch tdA.Cmp(tdB) {
+	case 1:
+		res.Heavier = &a
+	case -1:
+		res.Heavier = &b
+	}
+	return res, nil
+}
+
+// maxSupplyDeltaBlocks is the maximum number of blocks eth_getSupplyDelta may
+// sum the issuance of in a single call.
+const maxSupplyDeltaBlocks = 100000
+
+// BlockReward is the breakdown of the rewards paid for a block.
+type BlockReward struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	Miner        common.Address `json:"miner"`
+	MinerReward  *hexutil.Big   `json:"minerReward"`  // Block reward of the miner, including the uncle inclusion rewards
+	UncleRewards []*hexutil.Big `json:"uncleRewards"` // Rewards of the uncle miners, in inclusion order
+	Fees         *hexutil.Big   `json:"fees"`         // Transaction fees transferred to the miner, not issued
+	Issuance     *hexutil.Big   `json:"issuance"`     // Newly minted ether: miner and uncle rewards
+}
+
+// blockRewards returns the rewards minted for the miner and the uncles of a block
+// under the monetary policy of the chain. Neither the genesis block nor blocks of
+// engines other than ethash mint anything.
+func (s *PublicBlockChainAPI) blockRewards(header *types.Header, uncles []*types.Header) (*big.Int, []*big.Int) {
+	if _, ok := s.b.Engine().(*ethash.Ethash); !ok || header.Number.Sign() == 0 {
+		rewards := make([]*big.Int, len(uncles))
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return new(big.Int), rewards
+	}
+	return ethash.GetRewards(s.b.ChainConfig(), header, uncles)
+}
+
+// GetBlockReward returns the rewards paid to the miner and the uncle miners of a
+// block, together with the transaction fees collected by its miner.
+func (s *PublicBlockChainAPI) GetBlockReward(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*BlockReward, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	receipts, err := s.b.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("receipts of block #%d [%x] unavailable", block.NumberU64(), block.Hash())
+	}
+	fees := new(big.Int)
+	for i, tx := range block.Transactions() {
+		fees.Add(fees, new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(receipts[i].GasUsed)))
+	}
+	minerReward, uncleRewards := s.blockRewards(block.Header(), block.Uncles())
+
+	issuance := new(big.Int).Set(minerReward)
+	res := &BlockReward{
+		Number:       hexutil.Uint64(block.NumberU64()),
+		Hash:         block.Hash(),
+		Miner:        block.Coinbase(),
+		MinerReward:  (*hexutil.Big)(minerReward),
+		UncleRewards: make([]*hexutil.Big, len(uncleRewards)),
+		Fees:         (*hexutil.Big)(fees),
+	}
+	for i, reward := range uncleRewards {
+		res.UncleRewards[i] = (*hexutil.Big)(reward)
+		issuance.Add(issuance, reward)
+	}
+	res.Issuance = (*hexutil.Big)(issuance)
+	return res, nil
+}
+
+// SupplyDelta is the ether minted over a range of blocks.
+type SupplyDelta struct {
+	FromBlock    hexutil.Uint64 `json:"fromBlock"`
+	ToBlock      hexutil.Uint64 `json:"toBlock"`
+	MinerRewards *hexutil.Big   `json:"minerRewards"`
+	UncleRewards *hexutil.Big   `json:"uncleRewards"`
+	Issuance     *hexutil.Big   `json:"issuance"`
+}
+
+// ResolveBlockRange resolves the block numbers of a query range against the head
+// of the canonical chain, mapping pending, latest and future numbers to the head.
+func ResolveBlockRange(head uint64, from, to rpc.BlockNumber) (uint64, uint64, error) {
+	resolve := func(number rpc.BlockNumber) uint64 {
+		switch {
+		case number == rpc.EarliestBlockNumber:
+			return 0
+		case number < 0 || uint64(number) > head:
+			return head
+		}
+		return uint64(number)
+	}
+	begin, end := resolve(from), resolve(to)
+	if end < begin {
+		return 0, 0, fmt.Errorf("invalid block range: %d > %d", begin, end)
+	}
+	return begin, end, nil
+}
+
+// GetSupplyDelta returns the ether minted by the canonical blocks of the given
+// range, both ends included.
+func (s *PublicBlockChainAPI) GetSupplyDelta(ctx context.Context, from, to rpc.BlockNumber) (*SupplyDelta, error) {
+	begin, end, err := ResolveBlockRange(s.b.CurrentBlock().NumberU64(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	if end-begin+1 > maxSupplyDeltaBlocks {
+		return nil, fmt.Errorf("query spans %d blocks, more than the limit of %d", end-begin+1, maxSupplyDeltaBlocks)
+	}
+	minerTotal, uncleTotal := new(big.Int), new(big.Int)
+	for number := begin; number <= end; number++ {
+		header, err := s.b.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		var uncles []*types.Header
+		if header.UncleHash != types.EmptyUncleHash {
+			block, err := s.b.BlockByHash(ctx, header.Hash())
+			if err != nil {
+				return nil, err
+			}
+			if block == nil {
+				return nil, fmt.Errorf("body of block #%d [%x] not found", number, header.Hash())
+			}
+			uncles = block.Uncles()
+		}
+		minerReward, uncleRewards := s.blockRewards(header, uncles)
+		minerTotal.Add(minerTotal, minerReward)
+		for _, reward := range uncleRewards {
+			uncleTotal.Add(uncleTotal, reward)
+		}
+	}
+	return &SupplyDelta{
+		FromBlock:    hexutil.Uint64(begin),
+		ToBlock:      hexutil.Uint64(end),
+		MinerRewards: (*hexutil.Big)(minerTotal),
+		UncleRewards: (*hexutil.Big)(uncleTotal),
+		Issuance:     (*hexutil.Big)(new(big.Int).Add(minerTotal, uncleTotal)),
+	}, nil
+}
+
 // GetBlockByNumber returns the requested canonical block.
 // * When blockNr is -1 the chain head is returned.
 // * When blockNr is -2 the pending chain head is returned.
 // * When fullTx is true all transactions in the block are returned, otherwise
 //   only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	// Blocks buried deep enough are cached by number
+	if number >= 0 {
+		key := fmt.Sprintf("blockByNumber:%d:%t", number, fullTx)
+		response, err := s.cache.fetch(key, func() (interface{}, common.Hash, bool, error) {
+			block, err := s.b.BlockByNumber(ctx, number)
+			if block == nil || err != nil {
+				return nil, common.Hash{}, false, err
+			}
+			response, err := s.rpcMarshalBlock(ctx, block, true, fullTx)
+			if err != nil {
+				return nil, common.Hash{}, false, err
+			}
+			head := s.b.CurrentBlock().NumberU64()
+			return response, block.Hash(), head >= block.NumberU64()+responseCacheConfirmations, nil
+		})
+		if response == nil {
+			return nil, err
+		}
+		return response.(map[string]interface{}), err
+	}
 	block, err := s.b.BlockByNumber(ctx, number)
 	if block != nil && err == nil {
 		response, err := s.rpcMarshalBlock(ctx, block, true, fullTx)
@@ -823,6 +1212,14 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 		return nil, err
 	}
 	// Override the fields of specified contracts before execution.
+	if err := applyOverrides(state, overrides); err != nil {
+		return nil, err
+	}
+	return doCallAt(ctx, b, args, state, header, vmCfg, timeout, globalGasCap)
+}
+
+// applyOverrides overrides the fields of the specified accounts in the state.
+func applyOverrides(state *state.StateDB, overrides map[common.Address]account) error {
 	for addr, account := range overrides {
 		// Override account nonce.
 		if account.Nonce != nil {
@@ -837,7 +1234,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 			state.SetBalance(addr, (*big.Int)(*account.Balance))
 		}
 		if account.State != nil && account.StateDiff != nil {
-			return nil, fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
 		}
 		// Replace entire state if caller requires.
 		if account.State != nil {
@@ -850,6 +1247,12 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 			}
 		}
 	}
+	return nil
+}
+
+// doCallAt executes a call on top of the given state, leaving its modifications
+// in the state.
+func doCallAt(ctx context.Context, b Backend, args CallArgs, state *state.StateDB, header *types.Header, vmCfg vm.Config, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
 	var cancel context.CancelFunc
@@ -884,7 +1287,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 	}
 	// If the timer caused an abort, return an appropriate error message
 	if evm.Cancelled() {
-		return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		return nil, fmt.Errorf("%w (timeout = %v)", errExecutionAborted, timeout)
 	}
 	if err != nil {
 		return result, fmt.Errorf("err: %w (supplied gas %d)", err, msg.Gas())
@@ -893,14 +1296,18 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 }
 
 func newRevertError(result *core.ExecutionResult) *revertError {
-	reason, errUnpack := abi.UnpackRevert(result.Revert())
+	data := result.Revert()
 	err := errors.New("execution reverted")
-	if errUnpack == nil {
+	if reason, errUnpack := abi.UnpackRevert(data); errUnpack == nil {
 		err = fmt.Errorf("execution reverted: %v", reason)
+	} else if code, errUnpack := abi.UnpackPanic(data); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: panic code 0x%x", code)
+	} else if len(data) >= 4 {
+		err = fmt.Errorf("execution reverted: custom error 0x%x", data[:4])
 	}
 	return &revertError{
 		error:  err,
-		reason: hexutil.Encode(result.Revert()),
+		reason: hexutil.Encode(data),
 	}
 }
 
@@ -935,16 +1342,30 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOr
 	}
 	result, err := DoCall(ctx, s.b, args, blockNrOrHash, accounts, vm.Config{}, 5*time.Second, s.b.RPCGasCap())
 	if err != nil {
-		return nil, err
+		return nil, apiError(s.b, err)
 	}
 	// If the result contains a revert reason, try to unpack and return it.
 	if len(result.Revert()) > 0 {
 		return nil, newRevertError(result)
 	}
-	return result.Return(), result.Err
+	return result.Return(), apiError(s.b, result.Err)
 }
 
+// EstimateGasOptions are the optional parameters of a gas estimation.
+type EstimateGasOptions struct {
+	ErrorOnRevert *bool           `json:"errorOnRevert"` // Whether a revert fails the estimation (default), or the gas used up to it is returned
+	MaxGas        *hexutil.Uint64 `json:"maxGas"`        // Upper bound to limit the search to
+}
+
+// DoEstimateGas estimates the gas needed to execute the given call with the
+// default options, failing if the call reverts.
 func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64) (hexutil.Uint64, error) {
+	return DoEstimateGasWithOptions(ctx, b, args, blockNrOrHash, gasCap, nil)
+}
+
+// DoEstimateGasWithOptions estimates the gas needed to execute the given call
+// by binary searching the lowest gas limit it succeeds with.
+func DoEstimateGasWithOptions(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64, opts *EstimateGasOptions) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo  uint64 = vars.TxGas - 1
@@ -966,6 +1387,10 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 		}
 		hi = block.GasLimit()
 	}
+	// Recap the highest gas limit with the caller's upper bound.
+	if opts != nil && opts.MaxGas != nil && uint64(*opts.MaxGas) >= vars.TxGas && hi > uint64(*opts.MaxGas) {
+		hi = uint64(*opts.MaxGas)
+	}
 	// Recap the highest gas limit with account's available balance.
 	if args.GasPrice != nil && args.GasPrice.ToInt().BitLen() != 0 {
 		state, _, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
@@ -1013,6 +1438,42 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 		}
 		return result.Failed(), result, nil
 	}
+	// Execute the call with the highest allowance first. If it fails there, it
+	// will fail with any allowance, so report the reason without searching.
+	failed, result, err := executable(hi)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		if result != nil && result.Err != vm.ErrOutOfGas {
+			if len(result.Revert()) > 0 || result.Err == vm.ErrExecutionReverted {
+				if opts != nil && opts.ErrorOnRevert != nil && !*opts.ErrorOnRevert {
+					return hexutil.Uint64(result.UsedGas), nil
+				}
+				return 0, newRevertError(result)
+			}
+			return 0, result.Err
+		}
+		// Otherwise, the specified gas cap is too low
+		return 0, &gasAllowanceError{cap}
+	}
+	// The gas used by the successful execution is a lower bound of the limit
+	// needed, refunds only being returned after the execution ends. Most calls
+	// need barely more than that, so probe just above it before searching.
+	if result.UsedGas-1 > lo {
+		lo = result.UsedGas - 1
+	}
+	if optimistic := result.UsedGas * 64 / 63; lo < optimistic && optimistic < hi {
+		failed, _, err := executable(optimistic)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
 		mid := (hi + lo) / 2
@@ -1030,31 +1491,19 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 			hi = mid
 		}
 	}
-	// Reject the transaction as invalid if it still fails at the highest allowance
-	if hi == cap {
-		failed, result, err := executable(hi)
-		if err != nil {
-			return 0, err
-		}
-		if failed {
-			if result != nil && result.Err != vm.ErrOutOfGas {
-				if len(result.Revert()) > 0 {
-					return 0, newRevertError(result)
-				}
-				return 0, result.Err
-			}
-			// Otherwise, the specified gas cap is too low
-			return 0, fmt.Errorf("gas required exceeds allowance (%d)", cap)
-		}
-	}
 	return hexutil.Uint64(hi), nil
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
+//
+// On failure the decoded revert reason is returned, along with the raw revert
+// data as error data. The options allow limiting the search to an upper bound,
+// and disabling the revert error, returning the gas used up to it instead.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, opts *EstimateGasOptions) (hexutil.Uint64, error) {
 	blockNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
-	return DoEstimateGas(ctx, s.b, args, blockNrOrHash, s.b.RPCGasCap())
+	gas, err := DoEstimateGasWithOptions(ctx, s.b, args, blockNrOrHash, s.b.RPCGasCap(), opts)
+	return gas, apiError(s.b, err)
 }
 
 // ExecutionResult groups all structured logs emitted by the EVM
@@ -1285,11 +1734,12 @@ func newRPCTransactionFromBlockHash(b *types.Block, hash common.Hash) *RPCTransa
 type PublicTransactionPoolAPI struct {
 	b         Backend
 	nonceLock *AddrLocker
+	cache     *responseCache
 }
 
 // NewPublicTransactionPoolAPI creates a new RPC service with methods specific for the transaction pool.
 func NewPublicTransactionPoolAPI(b Backend, nonceLock *AddrLocker) *PublicTransactionPoolAPI {
-	return &PublicTransactionPoolAPI{b, nonceLock}
+	return &PublicTransactionPoolAPI{b: b, nonceLock: nonceLock}
 }
 
 // GetBlockTransactionCountByNumber returns the number of transactions in the block with the given block number.
@@ -1399,6 +1849,22 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	fields, err := s.cache.fetch("receipt:"+hash.Hex(), func() (interface{}, common.Hash, bool, error) {
+		fields, err := s.getTransactionReceipt(ctx, hash)
+		if fields == nil || err != nil {
+			return nil, common.Hash{}, false, err
+		}
+		return fields, fields["blockHash"].(common.Hash), true, nil
+	})
+	if fields == nil {
+		return nil, err
+	}
+	return fields.(map[string]interface{}), err
+}
+
+// getTransactionReceipt retrieves the transaction receipt for the given
+// transaction hash, bypassing the response cache.
+func (s *PublicTransactionPoolAPI) getTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
 	if err != nil {
 		return nil, nil
@@ -1553,10 +2019,10 @@ func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 	// If the transaction fee cap is already specified, ensure the
 	// fee of the given transaction is _reasonable_.
 	if err := checkTxFee(tx.GasPrice(), tx.Gas(), b.RPCTxFeeCap()); err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, txError(ctx, b, tx, err)
 	}
 	if err := b.SendTx(ctx, tx); err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, txError(ctx, b, tx, err)
 	}
 	if tx.To() == nil {
 		signer := types.MakeSigner(b.ChainConfig(), b.CurrentBlock().Number())
@@ -1655,6 +2121,55 @@ func (s *PublicTransactionPoolAPI) Sign(addr common.Address, data hexutil.Bytes)
 	return signature, err
 }
 
+// SignTypedData_v4 calculates an Ethereum ECDSA signature over EIP-712 typed data:
+// keccak256("\x19\x01" + domainSeparator + hashStruct(message))
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+//
+// The account associated with addr must be unlocked, or be managed by an external
+// signer, in which case the typed data is forwarded to it for approval.
+func (s *PublicTransactionPoolAPI) SignTypedData_v4(addr common.Address, typedData apitypes.TypedData) (hexutil.Bytes, error) {
+	return signTypedData(s.b.AccountManager(), addr, typedData, nil)
+}
+
+// typedDataSigner is implemented by wallets which are able to sign EIP-712 typed
+// data themselves, instead of being handed the final hash to sign.
+type typedDataSigner interface {
+	SignTypedData(account accounts.Account, typedData apitypes.TypedData) ([]byte, error)
+}
+
+// signTypedData signs the given EIP-712 typed data with the wallet containing addr,
+// decrypting the key with the passphrase if one is given.
+func signTypedData(am *accounts.Manager, addr common.Address, typedData apitypes.TypedData, passwd *string) (hexutil.Bytes, error) {
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: addr}
+
+	wallet, err := am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if signer, ok := wallet.(typedDataSigner); ok {
+		signature, err = signer.SignTypedData(account, typedData)
+	} else {
+		_, rawData, herr := apitypes.TypedDataAndHash(typedData)
+		if herr != nil {
+			return nil, herr
+		}
+		if passwd != nil {
+			signature, err = wallet.SignDataWithPassphrase(account, *passwd, accounts.MimetypeTypedData, rawData)
+		} else {
+			signature, err = wallet.SignData(account, accounts.MimetypeTypedData, rawData)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	return signature, nil
+}
+
 // SignTransactionResult represents a RLP encoded signed transaction.
 type SignTransactionResult struct {
 	Raw hexutil.Bytes      `json:"raw"`
@@ -1893,9 +2408,15 @@ func (api *PrivateDebugAPI) ChaindbCompact() error {
 	return nil
 }
 
-// SetHead rewinds the head of the blockchain to a previous block.
-func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) {
+// SetHead rewinds the head of the blockchain to a previous block. If dryRun is
+// set, the chain is left untouched and what the rewind would unindex, delete
+// and truncate is reported instead.
+func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64, dryRun *bool) (*core.SetHeadPlan, error) {
+	if dryRun != nil && *dryRun {
+		return api.b.SetHeadPreview(uint64(number))
+	}
 	api.b.SetHead(uint64(number))
+	return nil, nil
 }
 
 // PublicNetAPI offers network related RPC methods
@@ -1935,7 +2456,7 @@ func checkTxFee(gasPrice *big.Int, gas uint64, cap float64) error {
 	feeEth := new(big.Float).Quo(new(big.Float).SetInt(new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))), new(big.Float).SetInt(big.NewInt(vars.Ether)))
 	feeFloat, _ := feeEth.Float64()
 	if feeFloat > cap {
-		return fmt.Errorf("tx fee (%.2f ether) exceeds the configured cap (%.2f ether)", feeFloat, cap)
+		return &txFeeCapError{feeFloat, cap}
 	}
 	return nil
 }
@@ -20,6 +20,7 @@ package ethapi
 import (
 	"context"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
@@ -30,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params/types/ctypes"
@@ -43,14 +45,20 @@ type Backend interface {
 	Downloader() *downloader.Downloader
 	ProtocolVersion() int
 	SuggestPrice(ctx context.Context) (*big.Int, error)
+	GasForecast(ctx context.Context, blocks int, percentiles []float64) (*gasprice.Forecast, error)
 	ChainDb() ethdb.Database
 	AccountManager() *accounts.Manager
 	ExtRPCEnabled() bool
-	RPCGasCap() uint64    // global gas cap for eth_call over rpc: DoS protection
-	RPCTxFeeCap() float64 // global tx fee cap for all transaction related APIs
+	RPCGasCap() uint64          // global gas cap for eth_call over rpc: DoS protection
+	RPCTxFeeCap() float64       // global tx fee cap for all transaction related APIs
+	RPCCacheSize() int          // number of historical query responses to cache, 0 to disable
+	RPCCacheTTL() time.Duration // expiry of cached historical query responses
+	RPCLogsRangeCap() uint64    // global block range cap for log queries
+	RPCErrorCodes() bool        // whether errors carry their canonical codes and data
 
 	// Blockchain API
 	SetHead(number uint64)
+	SetHeadPreview(number uint64) (*core.SetHeadPlan, error)
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
 	HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error)
@@ -70,6 +78,7 @@ type Backend interface {
 
 	// Transaction pool API
 	SendTx(ctx context.Context, signedTx *types.Transaction) error
+	ValidateTx(ctx context.Context, tx *types.Transaction, local bool) error
 	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
 	GetPoolTransactions() (types.Transactions, error)
 	GetPoolTransaction(txHash common.Hash) *types.Transaction
@@ -91,7 +100,17 @@ type Backend interface {
 }
 
 func GetAPIs(apiBackend Backend) []rpc.API {
-	nonceLock := new(AddrLocker)
+	var (
+		nonceLock = new(AddrLocker)
+		cache     = newResponseCache(apiBackend.RPCCacheSize(), apiBackend.RPCCacheTTL())
+
+		blockChainAPI = NewPublicBlockChainAPI(apiBackend)
+		txPoolAPI     = NewPublicTransactionPoolAPI(apiBackend, nonceLock)
+	)
+	if cache != nil {
+		go cache.invalidateLoop(apiBackend)
+		blockChainAPI.cache, txPoolAPI.cache = cache, cache
+	}
 	return []rpc.API{
 		{
 			Namespace: "eth",
@@ -101,18 +120,28 @@ func GetAPIs(apiBackend Backend) []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   NewPublicBlockChainAPI(apiBackend),
+			Service:   blockChainAPI,
 			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   NewPublicTransactionPoolAPI(apiBackend, nonceLock),
+			Service:   txPoolAPI,
 			Public:    true,
 		}, {
 			Namespace: "txpool",
 			Version:   "1.0",
 			Service:   NewPublicTxPoolAPI(apiBackend),
 			Public:    true,
+		}, {
+			Namespace: "wallet",
+			Version:   "1.0",
+			Service:   NewPublicWalletAPI(apiBackend),
+			Public:    true,
+		}, {
+			Namespace: "proof",
+			Version:   "1.0",
+			Service:   NewPublicProofAPI(),
+			Public:    true,
 		}, {
 			Namespace: "debug",
 			Version:   "1.0",
@@ -0,0 +1,176 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// responseCacheConfirmations is the number of blocks a block must be buried
+// under before its responses are cached by number.
+const responseCacheConfirmations = 12
+
+var (
+	responseCacheHitMeter        = metrics.NewRegisteredMeter("rpc/cache/hit", nil)
+	responseCacheMissMeter       = metrics.NewRegisteredMeter("rpc/cache/miss", nil)
+	responseCacheInvalidateMeter = metrics.NewRegisteredMeter("rpc/cache/invalidate", nil)
+)
+
+// responseCacheEntry is a cached response, along with the hash of the block it
+// was derived from, zero if it doesn't depend on any.
+type responseCacheEntry struct {
+	value   interface{}
+	block   common.Hash
+	expires time.Time
+}
+
+// responseCache caches the responses of idempotent historical queries of the
+// eth namespace, shared by its services. Entries expire after a while and are
+// invalidated when the block they were derived from is reorged out.
+//
+// A nil cache is valid and caches nothing.
+type responseCache struct {
+	ttl     time.Duration
+	entries *lru.Cache                          // Response entries by request key
+	blocks  map[common.Hash]map[string]struct{} // Keys of the entries derived from each block
+	gen     uint64                              // Incremented on each invalidation to drop racing responses
+	lock    sync.Mutex
+}
+
+// newResponseCache creates a response cache of the given number of entries
+// expiring after ttl, nil if caching is disabled.
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	c := &responseCache{
+		ttl:    ttl,
+		blocks: make(map[common.Hash]map[string]struct{}),
+	}
+	// The eviction callback runs within the cache calls, which are all made
+	// under the lock
+	c.entries, _ = lru.NewWithEvict(size, func(key, value interface{}) {
+		c.unindex(key.(string), value.(*responseCacheEntry).block)
+	})
+	return c
+}
+
+// invalidateLoop drops the responses derived from the blocks reorged out of the
+// canonical chain.
+func (c *responseCache) invalidateLoop(b Backend) {
+	sideCh := make(chan core.ChainSideEvent, 64)
+	sub := b.SubscribeChainSideEvent(sideCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-sideCh:
+			c.invalidate(ev.Block.Hash())
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// invalidate drops the responses derived from the given block.
+func (c *responseCache) invalidate(block common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.gen++
+	for key := range c.blocks[block] {
+		c.entries.Remove(key)
+		responseCacheInvalidateMeter.Mark(1)
+	}
+}
+
+// unindex removes a key from the index of the entries derived from a block.
+func (c *responseCache) unindex(key string, block common.Hash) {
+	if block == (common.Hash{}) {
+		return
+	}
+	if keys := c.blocks[block]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.blocks, block)
+		}
+	}
+}
+
+// get retrieves the cached response of a request, if any.
+func (c *responseCache) get(key string) (interface{}, uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, ok := c.entries.Get(key); ok {
+		entry := item.(*responseCacheEntry)
+		if time.Now().Before(entry.expires) {
+			responseCacheHitMeter.Mark(1)
+			return entry.value, c.gen, true
+		}
+		c.entries.Remove(key)
+	}
+	responseCacheMissMeter.Mark(1)
+	return nil, c.gen, false
+}
+
+// add caches the response of a request derived from the given block, unless an
+// invalidation happened since the lookup of generation gen, as the response may
+// be derived from a block reorged out meanwhile.
+func (c *responseCache) add(key string, gen uint64, block common.Hash, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	c.entries.Add(key, &responseCacheEntry{value: value, block: block, expires: time.Now().Add(c.ttl)})
+	if block != (common.Hash{}) {
+		if c.blocks[block] == nil {
+			c.blocks[block] = make(map[string]struct{})
+		}
+		c.blocks[block][key] = struct{}{}
+	}
+}
+
+// fetch returns the cached response of a request, or retrieves and caches it.
+// The retrieval returns the response, the hash of the block it was derived from
+// and whether it may be cached.
+func (c *responseCache) fetch(key string, retrieve func() (interface{}, common.Hash, bool, error)) (interface{}, error) {
+	if c == nil {
+		value, _, _, err := retrieve()
+		return value, err
+	}
+	value, gen, ok := c.get(key)
+	if ok {
+		return value, nil
+	}
+	value, block, cacheable, err := retrieve()
+	if err == nil && cacheable {
+		c.add(key, gen, block, value)
+	}
+	return value, err
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// countingRetriever creates a retrieval of a response derived from the given
+// block, counting its invocations.
+func countingRetriever(calls *int, block common.Hash, cacheable bool) func() (interface{}, common.Hash, bool, error) {
+	return func() (interface{}, common.Hash, bool, error) {
+		*calls++
+		return *calls, block, cacheable, nil
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	var (
+		cache  = newResponseCache(2, time.Hour)
+		blockA = common.HexToHash("0xa")
+		blockB = common.HexToHash("0xb")
+		calls  int
+	)
+	// Cacheable responses are retrieved once
+	for i := 0; i < 3; i++ {
+		if v, err := cache.fetch("a", countingRetriever(&calls, blockA, true)); err != nil || v != 1 {
+			t.Fatalf("fetch %d: have %v, %v, want 1", i, v, err)
+		}
+	}
+	// Uncacheable ones every time
+	cache.fetch("b", countingRetriever(&calls, blockB, false))
+	if v, _ := cache.fetch("b", countingRetriever(&calls, blockB, false)); v != 3 {
+		t.Fatalf("uncacheable response cached: have %v, want 3", v)
+	}
+	// Reorging a block out drops the responses derived from it only
+	cache.fetch("b", countingRetriever(&calls, blockB, true))
+	cache.invalidate(blockA)
+	if v, _ := cache.fetch("a", countingRetriever(&calls, blockA, true)); v != 5 {
+		t.Fatalf("invalidated response served: have %v, want 5", v)
+	}
+	if v, _ := cache.fetch("b", countingRetriever(&calls, blockB, true)); v != 4 {
+		t.Fatalf("unrelated response invalidated: have %v, want 4", v)
+	}
+	// Evicted entries are removed from the block index
+	cache.fetch("c", countingRetriever(&calls, common.Hash{}, true))
+	if len(cache.blocks) != 1 {
+		t.Fatalf("block index size mismatch: have %d, want 1", len(cache.blocks))
+	}
+}
+
+func TestResponseCacheRace(t *testing.T) {
+	var (
+		cache = newResponseCache(16, time.Hour)
+		block = common.HexToHash("0xa")
+		calls int
+	)
+	// Responses retrieved across an invalidation aren't cached
+	cache.fetch("a", func() (interface{}, common.Hash, bool, error) {
+		cache.invalidate(block)
+		return countingRetriever(&calls, block, true)()
+	})
+	if v, _ := cache.fetch("a", countingRetriever(&calls, block, true)); v != 2 {
+		t.Fatalf("racing response cached: have %v, want 2", v)
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	var (
+		cache = newResponseCache(16, time.Millisecond)
+		calls int
+	)
+	cache.fetch("a", countingRetriever(&calls, common.Hash{}, true))
+	time.Sleep(5 * time.Millisecond)
+	if v, _ := cache.fetch("a", countingRetriever(&calls, common.Hash{}, true)); v != 2 {
+		t.Fatalf("expired response served: have %v, want 2", v)
+	}
+	// Disabled caches retrieve every time
+	var disabled *responseCache
+	disabled.fetch("a", countingRetriever(&calls, common.Hash{}, true))
+	if v, _ := disabled.fetch("a", countingRetriever(&calls, common.Hash{}, true)); v != 4 {
+		t.Fatalf("disabled cache served a response: have %v, want 4", v)
+	}
+	if newResponseCache(0, time.Hour) != nil {
+		t.Fatal("zero sized cache enabled")
+	}
+}
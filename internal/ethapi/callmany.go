@@ -0,0 +1,216 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// callManyMaxCalls is the maximum number of calls a single debug_callMany
+	// request may execute.
+	callManyMaxCalls = 256
+
+	// callManyTimeout is the time limit of executing a single call of a
+	// debug_callMany request.
+	callManyTimeout = 5 * time.Second
+
+	// callManyBatchTimeout is the time limit of executing all the calls of a
+	// debug_callMany request.
+	callManyBatchTimeout = 10 * time.Second
+)
+
+// DependentCall is a call of a debug_callMany request, along with the calls it
+// depends on.
+type DependentCall struct {
+	CallArgs
+	DependsOn []int `json:"dependsOn"` // Indexes of the calls to execute before this one
+}
+
+// DependentCallResult is the outcome of a call of a debug_callMany request.
+type DependentCallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Error      string         `json:"error,omitempty"`   // Execution error, if the call failed or was skipped
+	Skipped    bool           `json:"skipped,omitempty"` // Whether the call wasn't executed because a dependency failed
+}
+
+// AccountDiff is the change of an account caused by a debug_callMany request.
+type AccountDiff struct {
+	Deleted bool                        `json:"deleted,omitempty"`
+	Nonce   *hexutil.Uint64             `json:"nonce,omitempty"`
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// CallManyResult is the outcome of a debug_callMany request.
+type CallManyResult struct {
+	Results   []*DependentCallResult          `json:"results"`   // Outcomes of the calls, in request order
+	Order     []int                           `json:"order"`     // Order the calls were executed in
+	StateDiff map[common.Address]*AccountDiff `json:"stateDiff"` // Cumulative state changes of all the calls
+}
+
+// CallMany executes a list of calls on top of the state of the given block,
+// sharing the state between them, so each call observes the changes made by the
+// ones executed before it. Every call is executed after the calls it depends on,
+// otherwise in request order. A call whose dependency failed isn't executed.
+//
+// The overrides are applied before the first call and are part of the returned
+// state diff. Nothing is written to the chain. The request is aborted if all its
+// calls together run longer than callManyBatchTimeout.
+func (api *PublicDebugAPI) CallMany(ctx context.Context, calls []DependentCall, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]account) (*CallManyResult, error) {
+	if len(calls) > callManyMaxCalls {
+		return nil, fmt.Errorf("too many calls: %d, the limit is %d", len(calls), callManyMaxCalls)
+	}
+	order, err := dependencyOrder(calls)
+	if err != nil {
+		return nil, err
+	}
+	state, header, err := api.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		if err := applyOverrides(state, *overrides); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		config  = api.b.ChainConfig()
+		eip161d = config.IsEnabled(config.GetEIP161dTransition, header.Number)
+		results = make([]*DependentCallResult, len(calls))
+	)
+	// Finalise the overrides, so they are tracked by the state diff
+	state.Finalise(eip161d)
+
+	// Bound the calls together, not only each of them
+	batchCtx, cancel := context.WithTimeout(ctx, callManyBatchTimeout)
+	defer cancel()
+
+	for _, i := range order {
+		results[i] = new(DependentCallResult)
+		for _, dep := range calls[i].DependsOn {
+			if results[dep].Error != "" {
+				results[i].Skipped = true
+				results[i].Error = fmt.Sprintf("dependency %d failed", dep)
+				break
+			}
+		}
+		if results[i].Skipped {
+			continue
+		}
+		result, err := doCallAt(batchCtx, api.b, calls[i].CallArgs, state, header, vm.Config{}, callManyTimeout, api.b.RPCGasCap())
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if batchCtx.Err() != nil {
+			return nil, fmt.Errorf("%w (timeout = %v)", errExecutionAborted, callManyBatchTimeout)
+		}
+		switch {
+		case err != nil:
+			results[i].Error = err.Error()
+		case len(result.Revert()) > 0:
+			results[i].Error = newRevertError(result).Error()
+		case result.Err != nil:
+			results[i].Error = result.Err.Error()
+		}
+		if result != nil {
+			results[i].ReturnData, results[i].GasUsed = result.ReturnData, hexutil.Uint64(result.UsedGas)
+		}
+		state.Finalise(eip161d)
+	}
+	diffs, err := state.Diff(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	res := &CallManyResult{
+		Results:   results,
+		Order:     order,
+		StateDiff: make(map[common.Address]*AccountDiff, len(diffs)),
+	}
+	for addr, diff := range diffs {
+		d := &AccountDiff{Deleted: diff.Deleted, Code: diff.Code}
+		if diff.Nonce != nil {
+			d.Nonce = (*hexutil.Uint64)(diff.Nonce)
+		}
+		if diff.Balance != nil {
+			d.Balance = (*hexutil.Big)(new(big.Int).Set(diff.Balance))
+		}
+		if len(diff.Storage) > 0 {
+			d.Storage = diff.Storage
+		}
+		res.StateDiff[addr] = d
+	}
+	return res, nil
+}
+
+// dependencyOrder returns the order to execute the calls in, so that every call
+// comes after the ones it depends on, picking the lowest ready index first.
+func dependencyOrder(calls []DependentCall) ([]int, error) {
+	var (
+		pending    = make([]int, len(calls))   // Number of unexecuted dependencies of each call
+		dependents = make([][]int, len(calls)) // Calls depending on each call
+	)
+	for i, call := range calls {
+		seen := make(map[int]bool)
+		for _, dep := range call.DependsOn {
+			if dep < 0 || dep >= len(calls) {
+				return nil, fmt.Errorf("call %d depends on unknown call %d", i, dep)
+			}
+			if dep == i {
+				return nil, fmt.Errorf("call %d depends on itself", i)
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			pending[i]++
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+	var (
+		order = make([]int, 0, len(calls))
+		done  = make([]bool, len(calls))
+	)
+	for len(order) < len(calls) {
+		next := -1
+		for i := range calls {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("circular call dependencies")
+		}
+		done[next] = true
+		order = append(order, next)
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		deps  [][]int
+		order []int
+		fail  bool
+	}{
+		{deps: nil, order: []int{}},
+		{deps: [][]int{nil, nil, nil}, order: []int{0, 1, 2}},
+		{deps: [][]int{{2}, nil, {1}}, order: []int{1, 2, 0}},
+		{deps: [][]int{{1, 1}, nil, {0, 1}}, order: []int{1, 0, 2}},
+		{deps: [][]int{{3}, nil, nil, {1}}, order: []int{1, 2, 3, 0}},
+		{deps: [][]int{{1}, {0}}, fail: true},
+		{deps: [][]int{{0}}, fail: true},
+		{deps: [][]int{{1}}, fail: true},
+		{deps: [][]int{{-1}}, fail: true},
+	}
+	for i, tt := range tests {
+		calls := make([]DependentCall, len(tt.deps))
+		for j, deps := range tt.deps {
+			calls[j].DependsOn = deps
+		}
+		order, err := dependencyOrder(calls)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure, have order %v", i, order)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(order, tt.order) {
+			t.Errorf("test %d: order mismatch: have %v, want %v", i, order, tt.order)
+		}
+	}
+}
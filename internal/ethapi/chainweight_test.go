@@ -0,0 +1,91 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that total difficulties are reported for canonical and side blocks, and
+// that the heavier of two chains is picked by them.
+func TestChainWeight(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig, Difficulty: vars.MinimumDifficulty}
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	canon, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 5, nil)
+	side, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{0xa})
+	})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFullFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	if _, err := chain.InsertChain(side); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	api := NewPublicBlockChainAPI(&chainBackend{chain: chain})
+	ctx := context.Background()
+
+	head, fork := canon[len(canon)-1].Hash(), side[len(side)-1].Hash()
+	td, err := api.GetTotalDifficulty(ctx, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatalf("failed to retrieve head total difficulty: %v", err)
+	}
+	if want := chain.GetTdByHash(head); td.ToInt().Cmp(want) != 0 {
+		t.Fatalf("head total difficulty mismatch: have %v, want %v", td, want)
+	}
+	if td, err = api.GetTotalDifficulty(ctx, rpc.BlockNumberOrHashWithNumber(0)); err != nil || td.ToInt().Cmp(genesis.Difficulty()) != 0 {
+		t.Fatalf("genesis total difficulty mismatch: have %v, want %v (%v)", td, genesis.Difficulty(), err)
+	}
+	if td, err = api.GetTotalDifficulty(ctx, rpc.BlockNumberOrHashWithHash(fork, false)); err != nil || td.ToInt().Cmp(chain.GetTdByHash(fork)) != 0 {
+		t.Fatalf("side block total difficulty mismatch: have %v (%v)", td, err)
+	}
+	if td, err = api.GetTotalDifficulty(ctx, rpc.BlockNumberOrHashWithHash(common.Hash{0x1}, false)); td != nil || err != nil {
+		t.Fatalf("unknown block resolved: %v, %v", td, err)
+	}
+	// The longer canonical chain outweighs the side one, whatever the order
+	res, err := api.CompareChainWeight(ctx, head, fork)
+	if err != nil {
+		t.Fatalf("failed to compare chains: %v", err)
+	}
+	if res.Heavier == nil || *res.Heavier != head || res.Difference.ToInt().Sign() <= 0 {
+		t.Fatalf("comparison mismatch: heavier %v, difference %v", res.Heavier, res.Difference)
+	}
+	if res, err = api.CompareChainWeight(ctx, fork, head); err != nil || res.Heavier == nil || *res.Heavier != head || res.Difference.ToInt().Sign() >= 0 {
+		t.Fatalf("reversed comparison mismatch: %+v, %v", res, err)
+	}
+	if res, err = api.CompareChainWeight(ctx, head, head); err != nil || res.Heavier != nil || res.Difference.ToInt().Sign() != 0 {
+		t.Fatalf("self comparison mismatch: %+v, %v", res, err)
+	}
+	if _, err := api.CompareChainWeight(ctx, head, common.Hash{0x1}); err == nil {
+		t.Fatalf("comparison with an unknown block succeeded")
+	}
+}
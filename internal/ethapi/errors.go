@@ -0,0 +1,234 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Canonical error codes of the eth, debug and txpool APIs, returned instead of
+// the default -32000 if enabled. They are stable across releases, unlike the
+// error messages.
+const (
+	ErrCodeTxRejected         = -32003 // Transaction rejected for a reason without its own code
+	ErrCodeNonceTooLow        = -32010
+	ErrCodeNonceTooHigh       = -32011
+	ErrCodeInsufficientFunds  = -32012
+	ErrCodeIntrinsicGas       = -32013 // Gas below the intrinsic gas of the transaction
+	ErrCodeGasLimit           = -32014 // Gas above the block gas limit
+	ErrCodeUnderpriced        = -32015
+	ErrCodeReplaceUnderpriced = -32016
+	ErrCodeAlreadyKnown       = -32017
+	ErrCodeOversizedData      = -32018
+	ErrCodeFeeCap             = -32019 // Fee above the configured cap
+	ErrCodeOutOfGas           = -32020 // Execution out of gas, or gas estimation above the allowance
+	ErrCodeTimeout            = -32021 // Execution aborted by the timeout
+	ErrCodeInvalidChainID     = -32022 // Transaction signed for another chain
+	ErrCodeExecutionReverted  = 3      // Also returned if disabled, with the revert data
+)
+
+var (
+	errExecutionAborted = errors.New("execution aborted")
+	errInvalidChainID   = errors.New("invalid chain id")
+)
+
+// txFeeCapError is returned if the fee of a transaction exceeds the configured cap.
+type txFeeCapError struct {
+	fee, cap float64 // In ether
+}
+
+func (e *txFeeCapError) Error() string {
+	return fmt.Sprintf("tx fee (%.2f ether) exceeds the configured cap (%.2f ether)", e.fee, e.cap)
+}
+
+// gasAllowanceError is returned if a gas estimation exceeds the gas allowed.
+type gasAllowanceError struct {
+	cap uint64
+}
+
+func (e *gasAllowanceError) Error() string {
+	return fmt.Sprintf("gas required exceeds allowance (%d)", e.cap)
+}
+
+// ErrorDetails is the machine-readable data of a canonical error.
+type ErrorDetails struct {
+	Reason   string          `json:"reason"`             // Stable identifier of the error, e.g. nonceTooLow
+	Expected *hexutil.Uint64 `json:"expected,omitempty"` // Nonce or chain ID expected
+	Given    *hexutil.Uint64 `json:"given,omitempty"`    // Nonce or chain ID given
+	Required *hexutil.Big    `json:"required,omitempty"` // Gas or wei required
+	Provided *hexutil.Big    `json:"provided,omitempty"` // Gas or wei provided
+}
+
+// canonicalError is an error with its canonical code and details.
+type canonicalError struct {
+	error
+	code    int
+	details *ErrorDetails
+}
+
+func (e *canonicalError) ErrorCode() int         { return e.code }
+func (e *canonicalError) ErrorData() interface{} { return e.details }
+func (e *canonicalError) Unwrap() error          { return e.error }
+
+// canonicalCodes are the codes and reasons of the known errors.
+var canonicalCodes = []struct {
+	err    error
+	code   int
+	reason string
+}{
+	{core.ErrNonceTooLow, ErrCodeNonceTooLow, "nonceTooLow"},
+	{core.ErrNonceTooHigh, ErrCodeNonceTooHigh, "nonceTooHigh"},
+	{core.ErrInsufficientFunds, ErrCodeInsufficientFunds, "insufficientFunds"},
+	{core.ErrInsufficientFundsForTransfer, ErrCodeInsufficientFunds, "insufficientFunds"},
+	{core.ErrIntrinsicGas, ErrCodeIntrinsicGas, "intrinsicGas"},
+	{core.ErrGasLimit, ErrCodeGasLimit, "gasLimit"},
+	{core.ErrUnderpriced, ErrCodeUnderpriced, "underpriced"},
+	{core.ErrReplaceUnderpriced, ErrCodeReplaceUnderpriced, "replacementUnderpriced"},
+	{core.ErrAlreadyKnown, ErrCodeAlreadyKnown, "alreadyKnown"},
+	{core.ErrOversizedData, ErrCodeOversizedData, "oversizedData"},
+	{core.ErrNegativeValue, ErrCodeTxRejected, "negativeValue"},
+	{core.ErrInvalidSender, ErrCodeTxRejected, "invalidSender"},
+	{core.ErrGasUintOverflow, ErrCodeTxRejected, "gasUintOverflow"},
+	{vm.ErrOutOfGas, ErrCodeOutOfGas, "outOfGas"},
+	{vm.ErrExecutionReverted, ErrCodeExecutionReverted, "executionReverted"},
+	{errExecutionAborted, ErrCodeTimeout, "timeout"},
+	{errInvalidChainID, ErrCodeInvalidChainID, "invalidChainId"},
+}
+
+// canonicalize returns the canonical error of a known error, nil otherwise.
+// Errors carrying their own code are returned as they are.
+func canonicalize(err error) (error, *canonicalError) {
+	if _, ok := err.(rpc.Error); ok {
+		return err, nil
+	}
+	var feeErr *txFeeCapError
+	if errors.As(err, &feeErr) {
+		return nil, &canonicalError{err, ErrCodeFeeCap, &ErrorDetails{
+			Reason:   "feeCap",
+			Required: (*hexutil.Big)(etherToWei(feeErr.fee)),
+			Provided: (*hexutil.Big)(etherToWei(feeErr.cap)),
+		}}
+	}
+	var gasErr *gasAllowanceError
+	if errors.As(err, &gasErr) {
+		return nil, &canonicalError{err, ErrCodeOutOfGas, &ErrorDetails{
+			Reason:   "gasAllowance",
+			Provided: (*hexutil.Big)(new(big.Int).SetUint64(gasErr.cap)),
+		}}
+	}
+	for _, known := range canonicalCodes {
+		if errors.Is(err, known.err) {
+			return nil, &canonicalError{err, known.code, &ErrorDetails{Reason: known.reason}}
+		}
+	}
+	return err, nil
+}
+
+// etherToWei converts an amount of ether into wei.
+func etherToWei(ether float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(ether), new(big.Float).SetInt64(vars.Ether)).Int(nil)
+	return wei
+}
+
+// CanonicalError returns the given error with its canonical code and details if
+// it's a known one, as it is otherwise.
+func CanonicalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	plain, canonical := canonicalize(err)
+	if canonical != nil {
+		return canonical
+	}
+	return plain
+}
+
+// apiError returns the given error with its canonical code and details if they
+// are enabled.
+func apiError(b Backend, err error) error {
+	if err == nil || !b.RPCErrorCodes() {
+		return err
+	}
+	return CanonicalError(err)
+}
+
+// txError returns the error of submitting a transaction with its canonical code
+// and details if they are enabled, including the nonce, gas or funds expected
+// for the transaction.
+func txError(ctx context.Context, b Backend, tx *types.Transaction, err error) error {
+	if err == nil || !b.RPCErrorCodes() {
+		return err
+	}
+	plain, canonical := canonicalTxError(ctx, b, tx, err)
+	if canonical == nil {
+		return plain
+	}
+	return canonical
+}
+
+// canonicalTxError returns the canonical error of a known transaction error like
+// canonicalize, including the nonce, gas or funds expected for the transaction.
+func canonicalTxError(ctx context.Context, b Backend, tx *types.Transaction, err error) (error, *canonicalError) {
+	plain, canonical := canonicalize(err)
+	if canonical == nil {
+		return plain, nil
+	}
+	head := b.CurrentBlock()
+	switch canonical.code {
+	case ErrCodeNonceTooLow, ErrCodeNonceTooHigh:
+		given := hexutil.Uint64(tx.Nonce())
+		canonical.details.Given = &given
+		if from, err := types.Sender(types.MakeSigner(b.ChainConfig(), head.Number()), tx); err == nil {
+			if nonce, err := b.GetPoolNonce(ctx, from); err == nil {
+				expected := hexutil.Uint64(nonce)
+				canonical.details.Expected = &expected
+			}
+		}
+	case ErrCodeInsufficientFunds:
+		canonical.details.Required = (*hexutil.Big)(tx.Cost())
+		if from, err := types.Sender(types.MakeSigner(b.ChainConfig(), head.Number()), tx); err == nil {
+			if state, _, err := b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber); err == nil && state != nil {
+				canonical.details.Provided = (*hexutil.Big)(state.GetBalance(from))
+			}
+		}
+	case ErrCodeIntrinsicGas:
+		config := b.ChainConfig()
+		eip2 := config.IsEnabled(config.GetEIP2Transition, head.Number())
+		eip2028 := config.IsEnabled(config.GetEIP2028Transition, head.Number())
+		if gas, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, eip2, eip2028); err == nil {
+			canonical.details.Required = (*hexutil.Big)(new(big.Int).SetUint64(gas))
+		}
+		canonical.details.Provided = (*hexutil.Big)(new(big.Int).SetUint64(tx.Gas()))
+	case ErrCodeGasLimit:
+		canonical.details.Required = (*hexutil.Big)(new(big.Int).SetUint64(tx.Gas()))
+		canonical.details.Provided = (*hexutil.Big)(new(big.Int).SetUint64(head.GasLimit()))
+	case ErrCodeInvalidChainID:
+		given, expected := hexutil.Uint64(tx.ChainId().Uint64()), hexutil.Uint64(b.ChainConfig().GetChainID().Uint64())
+		canonical.details.Given, canonical.details.Expected = &given, &expected
+	}
+	return nil, canonical
+}
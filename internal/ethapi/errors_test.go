@@ -0,0 +1,124 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errorsBackend is the part of a backend needed to report canonical errors.
+type errorsBackend struct {
+	Backend
+	enabled bool
+	nonce   uint64
+}
+
+func (b *errorsBackend) RPCErrorCodes() bool { return b.enabled }
+func (b *errorsBackend) ChainConfig() ctypes.ChainConfigurator {
+	return params.TestChainConfig
+}
+func (b *errorsBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), GasLimit: 8000000})
+}
+func (b *errorsBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return b.nonce, nil
+}
+
+// Tests that known errors, wrapped or not, are given their canonical codes
+// without changing their messages.
+func TestCanonicalError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{core.ErrNonceTooLow, ErrCodeNonceTooLow, "nonceTooLow"},
+		{fmt.Errorf("err: %w (supplied gas %d)", core.ErrInsufficientFundsForTransfer, 21000), ErrCodeInsufficientFunds, "insufficientFunds"},
+		{core.ErrReplaceUnderpriced, ErrCodeReplaceUnderpriced, "replacementUnderpriced"},
+		{fmt.Errorf("tracing failed: %w", vm.ErrOutOfGas), ErrCodeOutOfGas, "outOfGas"},
+		{fmt.Errorf("%w (timeout = 5s)", errExecutionAborted), ErrCodeTimeout, "timeout"},
+		{&txFeeCapError{2, 1}, ErrCodeFeeCap, "feeCap"},
+		{&gasAllowanceError{50000}, ErrCodeOutOfGas, "gasAllowance"},
+	}
+	for i, tt := range tests {
+		err := CanonicalError(tt.err)
+		rpcErr, ok := err.(rpc.DataError)
+		if !ok {
+			t.Errorf("test %d: error %q has no data", i, tt.err)
+			continue
+		}
+		if err.Error() != tt.err.Error() {
+			t.Errorf("test %d: message mismatch: have %q, want %q", i, err.Error(), tt.err.Error())
+		}
+		if code := rpcErr.(rpc.Error).ErrorCode(); code != tt.code {
+			t.Errorf("test %d: code mismatch: have %d, want %d", i, code, tt.code)
+		}
+		if reason := rpcErr.ErrorData().(*ErrorDetails).Reason; reason != tt.reason {
+			t.Errorf("test %d: reason mismatch: have %q, want %q", i, reason, tt.reason)
+		}
+		if !errors.Is(err, errors.Unwrap(tt.err)) && !errors.Is(err, tt.err) {
+			t.Errorf("test %d: canonical error doesn't wrap the original", i)
+		}
+	}
+	// Unknown errors and errors with their own codes are returned as they are
+	unknown := errors.New("unknown")
+	if err := CanonicalError(unknown); err != unknown {
+		t.Errorf("unknown error changed: %v", err)
+	}
+	revert := &revertError{error: vm.ErrExecutionReverted, reason: "0x"}
+	if err := CanonicalError(revert); err != revert {
+		t.Errorf("revert error changed: %v", err)
+	}
+}
+
+// Tests that transaction errors carry the nonce and gas expected if enabled,
+// and are returned as they are otherwise.
+func TestTxError(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.NewEIP155Signer(params.TestChainConfig.GetChainID())
+	tx, _ := types.SignTx(types.NewTransaction(3, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil), signer, key)
+
+	backend := &errorsBackend{nonce: 5}
+	if err := txError(context.Background(), backend, tx, core.ErrNonceTooLow); err != core.ErrNonceTooLow {
+		t.Fatalf("disabled error changed: %v", err)
+	}
+	backend.enabled = true
+
+	err := txError(context.Background(), backend, tx, core.ErrNonceTooLow)
+	details := err.(rpc.DataError).ErrorData().(*ErrorDetails)
+	if details.Given == nil || *details.Given != 3 || details.Expected == nil || *details.Expected != 5 {
+		t.Errorf("nonce details mismatch: have given %v expected %v, want 3 and 5", details.Given, details.Expected)
+	}
+	err = txError(context.Background(), backend, tx, core.ErrGasLimit)
+	details = err.(rpc.DataError).ErrorData().(*ErrorDetails)
+	if details.Required.ToInt().Uint64() != 21000 || details.Provided.ToInt().Uint64() != 8000000 {
+		t.Errorf("gas limit details mismatch: have required %v provided %v", details.Required, details.Provided)
+	}
+}
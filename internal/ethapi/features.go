@@ -0,0 +1,139 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ChainFeature is a protocol upgrade (EIP or ECIP) configured in the chain config.
+type ChainFeature struct {
+	Name   string         `json:"name"`
+	Block  hexutil.Uint64 `json:"block"`
+	Active bool           `json:"active"`
+}
+
+// OpcodeFeature is an opcode enabled at a block, with its gas schedule.
+type OpcodeFeature struct {
+	Name        string         `json:"name"`
+	Code        hexutil.Uint64 `json:"code"`
+	ConstantGas hexutil.Uint64 `json:"constantGas"`
+	DynamicGas  bool           `json:"dynamicGas"`
+}
+
+// PrecompileFeature is a precompiled contract enabled at a block.
+type PrecompileFeature struct {
+	Address common.Address `json:"address"`
+	Name    string         `json:"name"`
+}
+
+// GasScheduleFeatures are the gas schedules in effect at a block which aren't
+// reflected by the constant opcode costs.
+type GasScheduleFeatures struct {
+	SstoreMetering      string         `json:"sstoreMetering"`
+	TxDataNonZeroGas    hexutil.Uint64 `json:"txDataNonZeroGas"`
+	TxContractCreation  hexutil.Uint64 `json:"txContractCreationGas"`
+	MaxCodeSizeEnforced bool           `json:"maxCodeSizeEnforced"`
+}
+
+// ChainFeatures are the protocol upgrades, opcodes, precompiled contracts and
+// gas schedules in effect at a block under the chain config.
+type ChainFeatures struct {
+	Number      hexutil.Uint64      `json:"number"`
+	Features    []ChainFeature      `json:"features"`
+	Opcodes     []OpcodeFeature     `json:"opcodes"`
+	Precompiles []PrecompileFeature `json:"precompiles"`
+	GasSchedule GasScheduleFeatures `json:"gasSchedule"`
+}
+
+// ChainFeatures returns the protocol upgrades, opcodes, precompiled contracts
+// and gas schedules in effect at the given block under the chain config of the
+// node. Blocks beyond the head are accepted, to check upcoming forks.
+func (api *PublicDebugAPI) ChainFeatures(ctx context.Context, blockNr rpc.BlockNumber) (*ChainFeatures, error) {
+	number := uint64(blockNr)
+	if blockNr < 0 {
+		header, err := api.b.HeaderByNumber(ctx, blockNr)
+		if header == nil || err != nil {
+			return nil, fmt.Errorf("block %v not found", blockNr)
+		}
+		number = header.Number.Uint64()
+	}
+	var (
+		config = api.b.ChainConfig()
+		bn     = new(big.Int).SetUint64(number)
+		result = &ChainFeatures{
+			Number:      hexutil.Uint64(number),
+			Features:    []ChainFeature{},
+			Opcodes:     []OpcodeFeature{},
+			Precompiles: []PrecompileFeature{},
+		}
+	)
+	fns, names := confp.Transitions(config)
+	for i, fn := range fns {
+		block := fn()
+		if block == nil {
+			continue
+		}
+		result.Features = append(result.Features, ChainFeature{
+			Name:   strings.TrimSuffix(strings.TrimPrefix(names[i], "Get"), "Transition"),
+			Block:  hexutil.Uint64(*block),
+			Active: config.IsEnabled(fn, bn),
+		})
+	}
+	sort.SliceStable(result.Features, func(i, j int) bool {
+		return result.Features[i].Block < result.Features[j].Block
+	})
+	for _, op := range vm.ActiveOpcodes(config, bn) {
+		result.Opcodes = append(result.Opcodes, OpcodeFeature{
+			Name:        op.Op.String(),
+			Code:        hexutil.Uint64(op.Op),
+			ConstantGas: hexutil.Uint64(op.ConstantGas),
+			DynamicGas:  op.DynamicGas,
+		})
+	}
+	for addr, p := range vm.PrecompiledContractsForConfig(config, bn) {
+		result.Precompiles = append(result.Precompiles, PrecompileFeature{Address: addr, Name: vm.PrecompileName(p)})
+	}
+	sort.Slice(result.Precompiles, func(i, j int) bool {
+		return bytes.Compare(result.Precompiles[i].Address[:], result.Precompiles[j].Address[:]) < 0
+	})
+	result.GasSchedule = GasScheduleFeatures{
+		SstoreMetering:      vm.SstoreGasMetering(config, bn),
+		TxDataNonZeroGas:    hexutil.Uint64(vars.TxDataNonZeroGasFrontier),
+		TxContractCreation:  hexutil.Uint64(vars.TxGas),
+		MaxCodeSizeEnforced: config.IsEnabled(config.GetEIP170Transition, bn),
+	}
+	if config.IsEnabled(config.GetEIP2028Transition, bn) {
+		result.GasSchedule.TxDataNonZeroGas = hexutil.Uint64(vars.TxDataNonZeroGasEIP2028)
+	}
+	if config.IsEnabled(config.GetEIP2Transition, bn) {
+		result.GasSchedule.TxContractCreation = hexutil.Uint64(vars.TxGasContractCreation)
+	}
+	return result, nil
+}
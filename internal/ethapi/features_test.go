@@ -0,0 +1,78 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// featuresBackend is the part of a backend needed to report chain features.
+type featuresBackend struct {
+	Backend
+	config ctypes.ChainConfigurator
+}
+
+func (b *featuresBackend) ChainConfig() ctypes.ChainConfigurator { return b.config }
+
+// Tests that the features reported for the blocks around an ETC fork follow its
+// activation, unlike those of ETH at the same height.
+func TestChainFeatures(t *testing.T) {
+	tests := []struct {
+		config      ctypes.ChainConfigurator
+		number      rpc.BlockNumber
+		shl         bool
+		precompiles int
+		sstore      string
+	}{
+		{params.ClassicChainConfig, 9572999, false, 8, "legacy"},  // Before Agharta
+		{params.ClassicChainConfig, 9573000, true, 8, "legacy"},   // Agharta, without EIP-1283
+		{params.ClassicChainConfig, 10500839, true, 9, "eip2200"}, // Phoenix
+		{params.MainnetChainConfig, 9572999, true, 9, "eip2200"},  // Istanbul
+	}
+	for i, tt := range tests {
+		api := NewPublicDebugAPI(&featuresBackend{config: tt.config})
+		features, err := api.ChainFeatures(context.Background(), tt.number)
+		if err != nil {
+			t.Fatalf("test %d: failed to report features: %v", i, err)
+		}
+		shl := false
+		for _, op := range features.Opcodes {
+			if op.Name == "SHL" {
+				shl = true
+			}
+		}
+		if shl != tt.shl {
+			t.Errorf("test %d: SHL activation mismatch: have %v, want %v", i, shl, tt.shl)
+		}
+		if len(features.Precompiles) != tt.precompiles {
+			t.Errorf("test %d: precompile count mismatch: have %d, want %d", i, len(features.Precompiles), tt.precompiles)
+		}
+		if features.GasSchedule.SstoreMetering != tt.sstore {
+			t.Errorf("test %d: SSTORE metering mismatch: have %s, want %s", i, features.GasSchedule.SstoreMetering, tt.sstore)
+		}
+		for _, feature := range features.Features {
+			if want := uint64(feature.Block) <= uint64(tt.number); feature.Active != want {
+				t.Errorf("test %d: %s activation mismatch: have %v, want %v", i, feature.Name, feature.Active, want)
+			}
+		}
+	}
+}
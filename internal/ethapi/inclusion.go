@@ -0,0 +1,186 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// InclusionProof is the Merkle-proof of a transaction and its receipt being
+// included in a block, against the transactions and receipts roots of the
+// block header.
+type InclusionProof struct {
+	BlockHash        common.Hash    `json:"blockHash"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	Header           hexutil.Bytes  `json:"header"` // RLP encoding of the block header, hashing to the block hash
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	TransactionsRoot common.Hash    `json:"transactionsRoot"`
+	ReceiptsRoot     common.Hash    `json:"receiptsRoot"`
+	Transaction      hexutil.Bytes  `json:"transaction"` // RLP encoding of the transaction
+	Receipt          hexutil.Bytes  `json:"receipt"`     // Consensus RLP encoding of the receipt
+	TransactionProof []string       `json:"transactionProof"`
+	ReceiptProof     []string       `json:"receiptProof"`
+}
+
+// nodeList collects the nodes of a trie proof.
+type nodeList [][]byte
+
+func (n *nodeList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *nodeList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// GetTransactionReceiptProof returns the Merkle-proofs of the given transaction
+// and its receipt against the transactions and receipts roots of the block that
+// included it, or nil if the transaction isn't known.
+func (s *PublicTransactionPoolAPI) GetTransactionReceiptProof(ctx context.Context, hash common.Hash) (*InclusionProof, error) {
+	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
+	if tx == nil || err != nil {
+		return nil, nil
+	}
+	block, err := s.b.BlockByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", blockHash)
+	}
+	receipts, err := s.b.GetReceipts(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if int(index) >= len(block.Transactions()) || len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("receipts of block %x not found", blockHash)
+	}
+	header := block.Header()
+	headerRLP, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	txProof, err := inclusionProof(block.Transactions(), header.TxHash, index)
+	if err != nil {
+		return nil, fmt.Errorf("transaction proof: %v", err)
+	}
+	receiptProof, err := inclusionProof(receipts, header.ReceiptHash, index)
+	if err != nil {
+		return nil, fmt.Errorf("receipt proof: %v", err)
+	}
+	return &InclusionProof{
+		BlockHash:        blockHash,
+		BlockNumber:      hexutil.Uint64(blockNumber),
+		Header:           headerRLP,
+		TransactionIndex: hexutil.Uint64(index),
+		TransactionsRoot: header.TxHash,
+		ReceiptsRoot:     header.ReceiptHash,
+		Transaction:      block.Transactions().GetRlp(int(index)),
+		Receipt:          types.Receipts(receipts).GetRlp(int(index)),
+		TransactionProof: txProof,
+		ReceiptProof:     receiptProof,
+	}, nil
+}
+
+// inclusionProof builds the trie of a list as done for the block header roots,
+// and proves the item at the given index, checking that the trie matches root.
+func inclusionProof(list types.DerivableList, root common.Hash, index uint64) ([]string, error) {
+	tr, err := trie.New(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	if err != nil {
+		return nil, err
+	}
+	if have := types.DeriveSha(list, tr); have != root {
+		return nil, fmt.Errorf("root mismatch: have %x, header %x", have, root)
+	}
+	key, _ := rlp.EncodeToBytes(uint(index))
+	var proof nodeList
+	if err := tr.Prove(key, 0, &proof); err != nil {
+		return nil, err
+	}
+	return common.ToHexArray(proof), nil
+}
+
+// VerifyInclusion checks the given transaction and receipt inclusion proof
+// against the block header it contains. The caller still has to check that the
+// block hash belongs to the canonical chain.
+func (api *PublicProofAPI) VerifyInclusion(proof InclusionProof) *ProofVerification {
+	if err := VerifyInclusionProof(&proof); err != nil {
+		return &ProofVerification{Error: err.Error()}
+	}
+	return &ProofVerification{Valid: true}
+}
+
+// VerifyInclusionProof checks that the header of an inclusion proof hashes to its
+// block hash, and that the transaction and receipt proofs are valid against the
+// roots of the header and prove the transaction and receipt reported alongside.
+func VerifyInclusionProof(proof *InclusionProof) error {
+	if hash := crypto.Keccak256Hash(proof.Header); hash != proof.BlockHash {
+		return fmt.Errorf("header hash mismatch: have %x, proven %x", proof.BlockHash, hash)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(proof.Header, header); err != nil {
+		return fmt.Errorf("invalid header: %v", err)
+	}
+	switch {
+	case proof.BlockNumber != hexutil.Uint64(header.Number.Uint64()):
+		return fmt.Errorf("block number mismatch: have %d, proven %d", proof.BlockNumber, header.Number)
+	case proof.TransactionsRoot != header.TxHash:
+		return fmt.Errorf("transactions root mismatch: have %x, proven %x", proof.TransactionsRoot, header.TxHash)
+	case proof.ReceiptsRoot != header.ReceiptHash:
+		return fmt.Errorf("receipts root mismatch: have %x, proven %x", proof.ReceiptsRoot, header.ReceiptHash)
+	}
+	key, _ := rlp.EncodeToBytes(uint(proof.TransactionIndex))
+	if err := verifyInclusion(header.TxHash, key, proof.TransactionProof, proof.Transaction); err != nil {
+		return fmt.Errorf("transaction: %v", err)
+	}
+	if err := verifyInclusion(header.ReceiptHash, key, proof.ReceiptProof, proof.Receipt); err != nil {
+		return fmt.Errorf("receipt: %v", err)
+	}
+	return nil
+}
+
+// verifyInclusion checks that the proof is valid against the root and proves the
+// given value at the key.
+func verifyInclusion(root common.Hash, key []byte, nodes []string, value []byte) error {
+	db, err := proofDatabase(nodes)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	blob, err := trie.VerifyProof(root, key, db)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	if blob == nil {
+		return errors.New("not included")
+	}
+	if !bytes.Equal(blob, value) {
+		return fmt.Errorf("value mismatch: have %x, proven %x", value, blob)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+func TestInclusionProof(t *testing.T) {
+	var (
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+	)
+	for i := 0; i < 200; i++ {
+		txs = append(txs, types.NewTransaction(uint64(i), common.Address{byte(i)}, big.NewInt(int64(i)), 21000, big.NewInt(1), nil))
+		receipts = append(receipts, types.NewReceipt(nil, i%3 == 0, uint64(21000*(i+1))))
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(10)}, txs, nil, receipts, new(trie.Trie))
+	header, _ := rlp.EncodeToBytes(block.Header())
+
+	for _, index := range []uint64{0, 1, 127, 128, 199} {
+		txProof, err := inclusionProof(block.Transactions(), block.TxHash(), index)
+		if err != nil {
+			t.Fatalf("index %d: failed to prove transaction: %v", index, err)
+		}
+		receiptProof, err := inclusionProof(types.Receipts(receipts), block.ReceiptHash(), index)
+		if err != nil {
+			t.Fatalf("index %d: failed to prove receipt: %v", index, err)
+		}
+		proof := &InclusionProof{
+			BlockHash:        block.Hash(),
+			BlockNumber:      hexutil.Uint64(block.NumberU64()),
+			Header:           header,
+			TransactionIndex: hexutil.Uint64(index),
+			TransactionsRoot: block.TxHash(),
+			ReceiptsRoot:     block.ReceiptHash(),
+			Transaction:      block.Transactions().GetRlp(int(index)),
+			Receipt:          types.Receipts(receipts).GetRlp(int(index)),
+			TransactionProof: txProof,
+			ReceiptProof:     receiptProof,
+		}
+		if err := VerifyInclusionProof(proof); err != nil {
+			t.Fatalf("index %d: valid proof rejected: %v", index, err)
+		}
+		// Proofs of a different index or value must be rejected
+		other := *proof
+		other.TransactionIndex = hexutil.Uint64((index + 1) % 200)
+		if err := VerifyInclusionProof(&other); err == nil {
+			t.Errorf("index %d: proof accepted for a different index", index)
+		}
+		other = *proof
+		other.Receipt = types.Receipts(receipts).GetRlp(int((index + 1) % 200))
+		if err := VerifyInclusionProof(&other); err == nil {
+			t.Errorf("index %d: proof accepted for a different receipt", index)
+		}
+		other = *proof
+		other.BlockHash = common.Hash{0x01}
+		if err := VerifyInclusionProof(&other); err == nil {
+			t.Errorf("index %d: proof accepted for a different block", index)
+		}
+	}
+	// Proofs against a root not matching the list must fail
+	if _, err := inclusionProof(block.Transactions(), common.Hash{0x01}, 0); err == nil {
+		t.Errorf("proof created against a mismatching root")
+	}
+}
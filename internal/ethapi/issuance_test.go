@@ -0,0 +1,192 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/types/genesisT"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// chainBackend is the part of a backend serving the canonical chain of a local
+// blockchain.
+type chainBackend struct {
+	Backend
+	chain *core.BlockChain
+}
+
+func (b *chainBackend) ChainConfig() ctypes.ChainConfigurator { return b.chain.Config() }
+func (b *chainBackend) Engine() consensus.Engine              { return b.chain.Engine() }
+func (b *chainBackend) CurrentBlock() *types.Block            { return b.chain.CurrentBlock() }
+func (b *chainBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number < 0 {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+func (b *chainBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		return b.chain.GetHeaderByHash(hash), nil
+	}
+	number, _ := blockNrOrHash.Number()
+	return b.HeaderByNumber(ctx, number)
+}
+func (b *chainBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+func (b *chainBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	header, _ := b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if header == nil {
+		return nil, nil
+	}
+	return b.chain.GetBlock(header.Hash(), header.Number.Uint64()), nil
+}
+func (b *chainBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+func (b *chainBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
+	return b.chain.GetTdByHash(hash)
+}
+
+// Tests that the rewards of single blocks account for uncles and fees, and that
+// the issuance of a range sums up the one of its blocks.
+func TestBlockIssuance(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		sender  = crypto.PubkeyToAddress(key.PublicKey)
+		miner   = common.Address{0xa}
+		uncler  = common.Address{0xb}
+		signer  = types.NewEIP155Signer(params.TestChainConfig.GetChainID())
+		price   = big.NewInt(vars.GWei)
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &genesisT.Genesis{Config: params.TestChainConfig, Alloc: genesisT.GenesisAlloc{sender: {Balance: big.NewInt(vars.Ether)}}}
+		genesis = core.MustCommitGenesis(db, gspec)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 4, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(miner)
+		switch i {
+		case 1:
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(sender), common.Address{0xc}, big.NewInt(1), vars.TxGas, price, nil), signer, key)
+			gen.AddTx(tx)
+		case 2:
+			parent := gen.PrevBlock(i - 1)
+			gen.AddUncle(&types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number(), common.Big1), Coinbase: uncler})
+		}
+	})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFullFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPublicBlockChainAPI(&chainBackend{chain: chain})
+	ctx := context.Background()
+
+	// The genesis block mints nothing
+	reward, err := api.GetBlockReward(ctx, rpc.BlockNumberOrHashWithNumber(0))
+	if err != nil {
+		t.Fatalf("failed to retrieve genesis reward: %v", err)
+	}
+	if reward.Issuance.ToInt().Sign() != 0 {
+		t.Fatalf("genesis issuance mismatch: have %v, want 0", reward.Issuance)
+	}
+	// Fees are reported apart from the issuance
+	base, _ := ethash.GetRewards(gspec.Config, blocks[0].Header(), nil)
+	if reward, err = api.GetBlockReward(ctx, rpc.BlockNumberOrHashWithNumber(2)); err != nil {
+		t.Fatalf("failed to retrieve block reward: %v", err)
+	}
+	if fees := new(big.Int).Mul(price, big.NewInt(int64(vars.TxGas))); reward.Fees.ToInt().Cmp(fees) != 0 {
+		t.Fatalf("fees mismatch: have %v, want %v", reward.Fees, fees)
+	}
+	if reward.Miner != miner || reward.Issuance.ToInt().Cmp(base) != 0 {
+		t.Fatalf("block reward mismatch: have %v to %x, want %v to %x", reward.Issuance, reward.Miner, base, miner)
+	}
+	// Uncles earn their own reward and an inclusion bonus for the miner
+	if reward, err = api.GetBlockReward(ctx, rpc.BlockNumberOrHashWithHash(blocks[2].Hash(), true)); err != nil {
+		t.Fatalf("failed to retrieve uncle block reward: %v", err)
+	}
+	if len(reward.UncleRewards) != 1 || reward.UncleRewards[0].ToInt().Sign() <= 0 {
+		t.Fatalf("uncle rewards mismatch: %v", reward.UncleRewards)
+	}
+	if reward.MinerReward.ToInt().Cmp(base) <= 0 {
+		t.Fatalf("inclusion reward missing: have %v, base %v", reward.MinerReward, base)
+	}
+	issuance := new(big.Int).Add(reward.MinerReward.ToInt(), reward.UncleRewards[0].ToInt())
+	if reward.Issuance.ToInt().Cmp(issuance) != 0 {
+		t.Fatalf("issuance mismatch: have %v, want %v", reward.Issuance, issuance)
+	}
+	// Ranges sum up their blocks and clamp to the head
+	total := new(big.Int)
+	for number := uint64(0); number <= 4; number++ {
+		reward, err := api.GetBlockReward(ctx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(number)))
+		if err != nil {
+			t.Fatalf("failed to retrieve reward of block #%d: %v", number, err)
+		}
+		total.Add(total, reward.Issuance.ToInt())
+	}
+	delta, err := api.GetSupplyDelta(ctx, rpc.EarliestBlockNumber, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to retrieve supply delta: %v", err)
+	}
+	if delta.FromBlock != 0 || delta.ToBlock != 4 || delta.Issuance.ToInt().Cmp(total) != 0 {
+		t.Fatalf("supply delta mismatch: have %v over [%d, %d], want %v over [0, 4]", delta.Issuance, delta.FromBlock, delta.ToBlock, total)
+	}
+	if delta, err = api.GetSupplyDelta(ctx, 4, 100); err != nil || delta.ToBlock != 4 || delta.UncleRewards.ToInt().Sign() != 0 {
+		t.Fatalf("clamped supply delta mismatch: %+v, %v", delta, err)
+	}
+	if _, err := api.GetSupplyDelta(ctx, 3, 2); err == nil {
+		t.Fatalf("inverted range accepted")
+	}
+}
+
+func TestResolveBlockRange(t *testing.T) {
+	tests := []struct {
+		from, to   rpc.BlockNumber
+		begin, end uint64
+		fail       bool
+	}{
+		{rpc.EarliestBlockNumber, rpc.LatestBlockNumber, 0, 10, false},
+		{3, rpc.PendingBlockNumber, 3, 10, false},
+		{5, 20, 5, 10, false},
+		{20, 30, 10, 10, false},
+		{6, 5, 0, 0, true},
+		{rpc.LatestBlockNumber, 5, 0, 0, true},
+	}
+	for i, tt := range tests {
+		begin, end, err := ResolveBlockRange(10, tt.from, tt.to)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if begin != tt.begin || end != tt.end {
+			t.Errorf("test %d: range mismatch: have [%d, %d], want [%d, %d]", i, begin, end, tt.begin, tt.end)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// keyJSON returns the Web3 Secret Storage document given either as a JSON object
+// or as a string holding one.
+func keyJSON(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("missing key file")
+	}
+	if raw[0] == '"' {
+		var doc string
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		return []byte(doc), nil
+	}
+	return raw, nil
+}
+
+// ImportKeystore stores the key of the given Web3 Secret Storage document into
+// the key directory. The document is decrypted with the passphrase and the key
+// encrypted with newPassphrase then, or the same passphrase if nil. Raw keys are
+// imported by encrypting them into a document first, so that they never travel
+// to the node in plain text. As for exports, importing isn't allowed when the API
+// is exposed over HTTP, unless insecure unlocking was explicitly enabled.
+func (s *PrivateAccountAPI) ImportKeystore(key json.RawMessage, passphrase string, newPassphrase *string) (common.Address, error) {
+	if s.b.ExtRPCEnabled() && !s.b.AccountManager().Config().InsecureUnlockAllowed {
+		return common.Address{}, errors.New("account import with HTTP access is forbidden")
+	}
+	doc, err := keyJSON(key)
+	if err != nil {
+		return common.Address{}, err
+	}
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if newPassphrase == nil {
+		newPassphrase = &passphrase
+	}
+	acc, err := ks.Import(doc, passphrase, *newPassphrase)
+	if err != nil {
+		return common.Address{}, err
+	}
+	log.Info("Imported key", "address", acc.Address, "path", acc.URL.Path)
+	return acc.Address, nil
+}
+
+// ExportKeystore returns the key of the given account as a Web3 Secret Storage
+// document, encrypted with exportPassphrase, or the passphrase of the account if
+// nil. Like unlocking accounts, exporting them isn't allowed when the API is
+// exposed over HTTP, unless insecure unlocking was explicitly enabled.
+func (s *PrivateAccountAPI) ExportKeystore(addr common.Address, passphrase string, exportPassphrase *string) (json.RawMessage, error) {
+	if s.b.ExtRPCEnabled() && !s.b.AccountManager().Config().InsecureUnlockAllowed {
+		return nil, errors.New("account export with HTTP access is forbidden")
+	}
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return nil, err
+	}
+	if exportPassphrase == nil {
+		exportPassphrase = &passphrase
+	}
+	doc, err := ks.Export(accounts.Account{Address: addr}, passphrase, *exportPassphrase)
+	if err != nil {
+		log.Warn("Failed account export attempt", "address", addr, "err", err)
+		return nil, err
+	}
+	log.Info("Exported key", "address", addr)
+	return doc, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+)
+
+// keystoreBackend is the part of a backend needed by the keystore methods.
+type keystoreBackend struct {
+	Backend
+	am  *accounts.Manager
+	ext bool
+}
+
+func (b *keystoreBackend) AccountManager() *accounts.Manager { return b.am }
+func (b *keystoreBackend) ExtRPCEnabled() bool               { return b.ext }
+
+// newKeystoreAPI creates an account API on a fresh keystore.
+func newKeystoreAPI(t *testing.T, ext bool) (*PrivateAccountAPI, *keystore.KeyStore, func()) {
+	dir, err := ioutil.TempDir("", "keystore-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	am := accounts.NewManager(&accounts.Config{}, ks)
+	api := NewPrivateAccountAPI(&keystoreBackend{am: am, ext: ext}, new(AddrLocker))
+	return api, ks, func() {
+		am.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Tests that a key exported from a keystore is imported into another one, with
+// the passphrases given, and that it isn't exported nor imported over HTTP.
+func TestKeystoreExportImport(t *testing.T) {
+	src, srcKs, closeSrc := newKeystoreAPI(t, false)
+	defer closeSrc()
+
+	acc, err := srcKs.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transit := "bar"
+	if _, err := src.ExportKeystore(acc.Address, "wrong", &transit); err == nil {
+		t.Fatal("key exported with a wrong passphrase")
+	}
+	doc, err := src.ExportKeystore(acc.Address, "foo", &transit)
+	if err != nil {
+		t.Fatalf("failed to export key: %v", err)
+	}
+	dst, dstKs, closeDst := newKeystoreAPI(t, false)
+	defer closeDst()
+
+	if _, err := dst.ImportKeystore(doc, "foo", nil); err == nil {
+		t.Fatal("key imported with a wrong passphrase")
+	}
+	// Documents are accepted as strings too
+	str, _ := json.Marshal(string(doc))
+	stored := "baz"
+	addr, err := dst.ImportKeystore(str, transit, &stored)
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	if addr != acc.Address {
+		t.Fatalf("imported address mismatch: have %x, want %x", addr, acc.Address)
+	}
+	if err := dstKs.Unlock(accounts.Account{Address: addr}, stored); err != nil {
+		t.Fatalf("imported key not encrypted with the new passphrase: %v", err)
+	}
+	if _, err := dst.ImportKeystore(doc, transit, nil); err == nil {
+		t.Fatal("key imported twice")
+	}
+	ext, extKs, closeExt := newKeystoreAPI(t, true)
+	defer closeExt()
+
+	acc, err = extKs.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ext.ExportKeystore(acc.Address, "foo", nil); err == nil {
+		t.Fatal("key exported with HTTP access")
+	}
+	if _, err := ext.ImportKeystore(doc, transit, nil); err == nil {
+		t.Fatal("key imported with HTTP access")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// PublicProofAPI offers helpers to validate the Merkle-proofs returned by
+// eth_getProof, without needing any chain data.
+type PublicProofAPI struct{}
+
+// NewPublicProofAPI creates a new proof verification API.
+func NewPublicProofAPI() *PublicProofAPI {
+	return &PublicProofAPI{}
+}
+
+// ProofVerification is the outcome of validating a proof.
+type ProofVerification struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// Verify checks the given account proof, along with all the storage proofs it
+// contains, against the state root.
+func (api *PublicProofAPI) Verify(proof AccountResult, stateRoot common.Hash) *ProofVerification {
+	if err := VerifyAccountProof(stateRoot, &proof); err != nil {
+		return &ProofVerification{Error: err.Error()}
+	}
+	return &ProofVerification{Valid: true}
+}
+
+// VerifyAccountProof checks that the account proof, along with all the storage
+// proofs it contains, are valid against the given state root and prove the values
+// reported alongside them.
+func VerifyAccountProof(root common.Hash, proof *AccountResult) error {
+	db, err := proofDatabase(proof.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+	blob, err := trie.VerifyProof(root, crypto.Keccak256(proof.Address.Bytes()), db)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+	account := state.Account{
+		Balance:  new(big.Int),
+		Root:     types.EmptyRootHash,
+		CodeHash: crypto.Keccak256(nil),
+	}
+	if blob != nil {
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return fmt.Errorf("invalid account data: %v", err)
+		}
+	}
+	switch {
+	case proof.Nonce != hexutil.Uint64(account.Nonce):
+		return fmt.Errorf("nonce mismatch: have %d, proven %d", proof.Nonce, account.Nonce)
+	case proof.Balance == nil || proof.Balance.ToInt().Cmp(account.Balance) != 0:
+		return fmt.Errorf("balance mismatch: have %v, proven %v", proof.Balance, account.Balance)
+	case proof.CodeHash != common.BytesToHash(account.CodeHash):
+		return fmt.Errorf("code hash mismatch: have %x, proven %x", proof.CodeHash, account.CodeHash)
+	case proof.StorageHash != account.Root:
+		return fmt.Errorf("storage hash mismatch: have %x, proven %x", proof.StorageHash, account.Root)
+	}
+	for _, slot := range proof.StorageProof {
+		if err := verifyStorageProof(account.Root, slot); err != nil {
+			return fmt.Errorf("storage slot %s: %v", slot.Key, err)
+		}
+	}
+	return nil
+}
+
+// verifyStorageProof checks that a storage proof is valid against the storage
+// root of its account, and proves the value reported alongside it.
+func verifyStorageProof(root common.Hash, proof StorageResult) error {
+	if proof.Value == nil {
+		return errors.New("missing value")
+	}
+	value := new(big.Int)
+	if root != types.EmptyRootHash || len(proof.Proof) > 0 {
+		db, err := proofDatabase(proof.Proof)
+		if err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		key := common.HexToHash(proof.Key)
+		blob, err := trie.VerifyProof(root, crypto.Keccak256(key.Bytes()), db)
+		if err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		if blob != nil {
+			_, content, _, err := rlp.Split(blob)
+			if err != nil {
+				return fmt.Errorf("invalid slot data: %v", err)
+			}
+			value.SetBytes(content)
+		}
+	}
+	if proof.Value.ToInt().Cmp(value) != 0 {
+		return fmt.Errorf("value mismatch: have %v, proven %v", proof.Value, value)
+	}
+	return nil
+}
+
+// proofDatabase loads the hex encoded nodes of a proof into a database keyed by
+// their hashes, as expected by the trie proof verifier.
+func proofDatabase(proof []string) (*memorydb.Database, error) {
+	db := memorydb.New()
+	for i, node := range proof {
+		blob, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %v", i, err)
+		}
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	return db, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// proofBackend is the part of a backend needed to create proofs.
+type proofBackend struct {
+	Backend
+	db   state.Database
+	root common.Hash
+}
+
+func (b *proofBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	statedb, err := state.New(b.root, b.db, nil)
+	return statedb, &types.Header{Root: b.root}, err
+}
+
+// newProofBackend creates a state with a few accounts, one of them holding some
+// storage slots, to create proofs from.
+func newProofBackend(t *testing.T, contract common.Address) *proofBackend {
+	var (
+		db         = state.NewDatabase(rawdb.NewMemoryDatabase())
+		statedb, _ = state.New(common.Hash{}, db, nil)
+	)
+	for i := byte(1); i <= 16; i++ {
+		statedb.SetBalance(common.Address{i}, big.NewInt(int64(i)))
+	}
+	statedb.SetNonce(contract, 3)
+	statedb.SetBalance(contract, big.NewInt(1000))
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+	for i := int64(1); i <= 16; i++ {
+		statedb.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i*100)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &proofBackend{db: db, root: root}
+}
+
+// Tests that proofs returned by GetProofs verify against the state root they
+// were created from, for both existing and absent accounts and slots.
+func TestVerifyAccountProof(t *testing.T) {
+	var (
+		contract = common.Address{0xcc}
+		b        = newProofBackend(t, contract)
+		api      = NewPublicBlockChainAPI(b)
+	)
+	requests := []ProofRequest{
+		{Address: contract, StorageKeys: []string{"0x1", "0x10", "0xff"}},
+		{Address: common.Address{0x01}},
+		{Address: common.Address{0xdd}, StorageKeys: []string{"0x1"}},
+	}
+	results, err := api.GetProofs(context.Background(), requests, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatalf("failed to create proofs: %v", err)
+	}
+	if len(results) != len(requests) {
+		t.Fatalf("proof count mismatch: have %d, want %d", len(results), len(requests))
+	}
+	for i, result := range results {
+		if err := VerifyAccountProof(b.root, result); err != nil {
+			t.Errorf("proof %d: failed to verify: %v", i, err)
+		}
+		if res := NewPublicProofAPI().Verify(*result, b.root); !res.Valid {
+			t.Errorf("proof %d: rejected by the proof API: %s", i, res.Error)
+		}
+	}
+	if results[0].StorageHash == types.EmptyRootHash || results[0].StorageProof[1].Value.ToInt().Int64() != 1600 {
+		t.Errorf("contract proof lacks storage: %+v", results[0])
+	}
+	if results[2].Balance.ToInt().Sign() != 0 || len(results[2].AccountProof) == 0 {
+		t.Errorf("absent account proof mismatch: %+v", results[2])
+	}
+	if err := VerifyAccountProof(common.Hash{0x01}, results[0]); err == nil {
+		t.Errorf("proof verified against a foreign state root")
+	}
+}
+
+// Tests that proofs whose values or nodes have been tampered with are rejected.
+func TestVerifyAccountProofTampered(t *testing.T) {
+	var (
+		contract = common.Address{0xcc}
+		b        = newProofBackend(t, contract)
+		api      = NewPublicBlockChainAPI(b)
+	)
+	prove := func(address common.Address) *AccountResult {
+		proof, err := api.GetProof(context.Background(), address, []string{"0x1", "0x2"}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+		if err != nil {
+			t.Fatalf("failed to create proof: %v", err)
+		}
+		return proof
+	}
+	// tamper flips a byte of the last node of a proof, leaving its encoding valid
+	tamper := func(nodes []string) {
+		blob := hexutil.MustDecode(nodes[len(nodes)-1])
+		blob[len(blob)-1] ^= 0x01
+		nodes[len(nodes)-1] = hexutil.Encode(blob)
+	}
+	tests := []struct {
+		name   string
+		proof  *AccountResult
+		modify func(*AccountResult)
+		err    string
+	}{
+		{"balance", prove(contract), func(p *AccountResult) { p.Balance = (*hexutil.Big)(big.NewInt(1001)) }, "balance mismatch"},
+		{"absent balance", prove(common.Address{0xdd}), func(p *AccountResult) { p.Balance = (*hexutil.Big)(big.NewInt(1)) }, "balance mismatch"},
+		{"nonce", prove(contract), func(p *AccountResult) { p.Nonce++ }, "nonce mismatch"},
+		{"storage hash", prove(contract), func(p *AccountResult) { p.StorageHash = common.Hash{0x01} }, "storage hash mismatch"},
+		{"storage value", prove(contract), func(p *AccountResult) { p.StorageProof[1].Value = (*hexutil.Big)(big.NewInt(201)) }, "value mismatch"},
+		{"storage node", prove(contract), func(p *AccountResult) { tamper(p.StorageProof[0].Proof) }, "invalid proof"},
+		{"account node", prove(contract), func(p *AccountResult) { tamper(p.AccountProof) }, "invalid account proof"},
+		{"missing node", prove(contract), func(p *AccountResult) { p.AccountProof = p.AccountProof[:len(p.AccountProof)-1] }, "invalid account proof"},
+	}
+	for _, tt := range tests {
+		if err := VerifyAccountProof(b.root, tt.proof); err != nil {
+			t.Fatalf("%s: untampered proof rejected: %v", tt.name, err)
+		}
+		tt.modify(tt.proof)
+		if err := VerifyAccountProof(b.root, tt.proof); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %q", tt.name, err, tt.err)
+		}
+		if res := NewPublicProofAPI().Verify(*tt.proof, b.root); res.Valid || res.Error == "" {
+			t.Errorf("%s: tampered proof accepted by the proof API", tt.name)
+		}
+	}
+}
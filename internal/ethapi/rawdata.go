@@ -0,0 +1,99 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// describeBlock formats a block number or hash for error messages.
+func describeBlock(blockNrOrHash rpc.BlockNumberOrHash) string {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		return hash.Hex()
+	}
+	number, _ := blockNrOrHash.Number()
+	return fmt.Sprintf("#%d", number)
+}
+
+// GetRawHeader returns the RLP encoding of the header of the given block.
+func (api *PublicDebugAPI) GetRawHeader(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	header, err := api.b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("header %s not found", describeBlock(blockNrOrHash))
+	}
+	return rlp.EncodeToBytes(header)
+}
+
+// GetRawBlock returns the RLP encoding of the given block, header, transactions
+// and uncles.
+func (api *PublicDebugAPI) GetRawBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	block, err := api.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %s not found", describeBlock(blockNrOrHash))
+	}
+	return rlp.EncodeToBytes(block)
+}
+
+// GetRawReceipts returns the consensus encodings of the receipts of the given
+// block, the ones its receipt root commits to.
+func (api *PublicDebugAPI) GetRawReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]hexutil.Bytes, error) {
+	header, err := api.b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %s not found", describeBlock(blockNrOrHash))
+	}
+	receipts, err := api.b.GetReceipts(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	encoded := make([]hexutil.Bytes, len(receipts))
+	for i, receipt := range receipts {
+		if encoded[i], err = rlp.EncodeToBytes(receipt); err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+// GetRawTransaction returns the RLP encoding of the transaction with the given
+// hash, included in the chain or pending in the pool, or nil if unknown.
+func (api *PublicDebugAPI) GetRawTransaction(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	tx, _, _, _, err := api.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		if tx = api.b.GetPoolTransaction(hash); tx == nil {
+			return nil, nil
+		}
+	}
+	return rlp.EncodeToBytes(tx)
+}
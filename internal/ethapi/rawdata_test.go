@@ -0,0 +1,148 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// rawBackend is the part of a backend serving a single block, with a pending
+// transaction in the pool.
+type rawBackend struct {
+	Backend
+	block    *types.Block
+	receipts types.Receipts
+	pending  *types.Transaction
+}
+
+func (b *rawBackend) find(blockNrOrHash rpc.BlockNumberOrHash) *types.Block {
+	if hash, ok := blockNrOrHash.Hash(); ok && hash == b.block.Hash() {
+		return b.block
+	}
+	if number, ok := blockNrOrHash.Number(); ok && uint64(number) == b.block.NumberU64() {
+		return b.block
+	}
+	return nil
+}
+func (b *rawBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	if block := b.find(blockNrOrHash); block != nil {
+		return block.Header(), nil
+	}
+	return nil, nil
+}
+func (b *rawBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	return b.find(blockNrOrHash), nil
+}
+func (b *rawBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	if hash == b.block.Hash() {
+		return b.receipts, nil
+	}
+	return nil, nil
+}
+func (b *rawBackend) GetTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	for i, tx := range b.block.Transactions() {
+		if tx.Hash() == hash {
+			return tx, b.block.Hash(), b.block.NumberU64(), uint64(i), nil
+		}
+	}
+	return nil, common.Hash{}, 0, 0, nil
+}
+func (b *rawBackend) GetPoolTransaction(hash common.Hash) *types.Transaction {
+	if b.pending.Hash() == hash {
+		return b.pending
+	}
+	return nil
+}
+
+// Tests that the raw data RPCs return the encodings the block commits to.
+func TestRawData(t *testing.T) {
+	var (
+		tx       = types.NewTransaction(0, common.Address{0x1}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		pending  = types.NewTransaction(1, common.Address{0x1}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		receipts = types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}}}
+		header   = &types.Header{Number: big.NewInt(3), Difficulty: big.NewInt(1)}
+	)
+	block := types.NewBlock(header, types.Transactions{tx}, nil, receipts, new(trie.Trie))
+	api := NewPublicDebugAPI(&rawBackend{block: block, receipts: receipts, pending: pending})
+
+	byNumber := rpc.BlockNumberOrHashWithNumber(3)
+	byHash := rpc.BlockNumberOrHashWithHash(block.Hash(), false)
+
+	for _, ref := range []rpc.BlockNumberOrHash{byNumber, byHash} {
+		raw, err := api.GetRawHeader(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("failed to retrieve raw header: %v", err)
+		}
+		decoded := new(types.Header)
+		if err := rlp.DecodeBytes(raw, decoded); err != nil || decoded.Hash() != block.Hash() {
+			t.Fatalf("raw header mismatch: %v", err)
+		}
+		raw, err = api.GetRawBlock(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("failed to retrieve raw block: %v", err)
+		}
+		if want, _ := rlp.EncodeToBytes(block); !bytes.Equal(raw, want) {
+			t.Fatal("raw block mismatch")
+		}
+		encoded, err := api.GetRawReceipts(context.Background(), ref)
+		if err != nil || len(encoded) != 1 {
+			t.Fatalf("failed to retrieve raw receipts: %d, %v", len(encoded), err)
+		}
+		decodedReceipts := make(types.Receipts, len(encoded))
+		for i, blob := range encoded {
+			decodedReceipts[i] = new(types.Receipt)
+			if err := rlp.DecodeBytes(blob, decodedReceipts[i]); err != nil {
+				t.Fatalf("failed to decode receipt %d: %v", i, err)
+			}
+		}
+		if root := types.DeriveSha(decodedReceipts, new(trie.Trie)); root != block.ReceiptHash() {
+			t.Fatalf("receipt root mismatch: have %x, want %x", root, block.ReceiptHash())
+		}
+	}
+	missing := rpc.BlockNumberOrHashWithNumber(4)
+	if _, err := api.GetRawHeader(context.Background(), missing); err == nil {
+		t.Fatal("raw header of a missing block returned")
+	}
+	if _, err := api.GetRawBlock(context.Background(), missing); err == nil {
+		t.Fatal("raw missing block returned")
+	}
+	if _, err := api.GetRawReceipts(context.Background(), missing); err == nil {
+		t.Fatal("raw receipts of a missing block returned")
+	}
+	// Transactions are looked up in the chain, then the pool
+	for _, want := range []*types.Transaction{tx, pending} {
+		raw, err := api.GetRawTransaction(context.Background(), want.Hash())
+		if err != nil {
+			t.Fatalf("failed to retrieve raw transaction: %v", err)
+		}
+		if encoded, _ := rlp.EncodeToBytes(want); !bytes.Equal(raw, encoded) {
+			t.Fatalf("raw transaction %x mismatch", want.Hash())
+		}
+	}
+	if raw, err := api.GetRawTransaction(context.Background(), common.Hash{0x1}); raw != nil || err != nil {
+		t.Fatalf("unknown raw transaction returned: %x, %v", raw, err)
+	}
+}
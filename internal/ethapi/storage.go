@@ -0,0 +1,118 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// StorageRangeMaxResults is the maximum number of storage slots returned by a
+// single eth_getStorageRangeAt call.
+const StorageRangeMaxResults = 1024
+
+// StorageSlot is a storage slot of a contract, as returned by eth_getStorageRangeAt.
+type StorageSlot struct {
+	Hash  common.Hash  `json:"hash"`  // Hash of the slot key, the order the slots are iterated in
+	Key   *common.Hash `json:"key"`   // Slot key, nil if its preimage is unknown
+	Value common.Hash  `json:"value"` // Slot value
+}
+
+// StorageRange is a page of the storage of a contract at a given block.
+type StorageRange struct {
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	StorageHash common.Hash    `json:"storageHash"`
+	Storage     []StorageSlot  `json:"storage"`
+	NextKey     *common.Hash   `json:"nextKey"` // Hash to resume the iteration from, nil at the end of the storage
+}
+
+// GetStorageRangeAt returns the storage slots of a contract at the given block,
+// ordered by the hash of their keys, starting at the slot whose key hash is
+// startKey or the one following it. At most maxResults slots are returned, the
+// next page can be retrieved by passing the returned nextKey as startKey along
+// with the returned blockHash, so all pages are taken from the same state.
+//
+// Any block whose state is still available can be queried, so archive nodes are
+// able to enumerate the storage of contracts for the entire history of the chain.
+func (s *PublicBlockChainAPI) GetStorageRangeAt(ctx context.Context, address common.Address, startKey common.Hash, maxResults int, blockNrOrHash rpc.BlockNumberOrHash) (*StorageRange, error) {
+	if maxResults <= 0 || maxResults > StorageRangeMaxResults {
+		maxResults = StorageRangeMaxResults
+	}
+	statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		if _, ok := err.(*trie.MissingNodeError); ok {
+			return nil, fmt.Errorf("state not available, storage of historical blocks requires an archive node (%v)", err)
+		}
+		return nil, err
+	}
+	if statedb == nil || header == nil {
+		return nil, fmt.Errorf("state not found")
+	}
+	result := &StorageRange{
+		BlockHash:   header.Hash(),
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		StorageHash: types.EmptyRootHash,
+		Storage:     []StorageSlot{},
+	}
+	st := statedb.StorageTrie(address)
+	if st == nil {
+		return result, statedb.Error()
+	}
+	result.StorageHash = st.Hash()
+	if result.Storage, result.NextKey, err = storageRange(st, startKey, maxResults); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// storageRange iterates the storage trie of a contract from the given key hash,
+// returning at most maxResults slots and the key hash of the slot following them.
+func storageRange(st state.Trie, start common.Hash, maxResults int) ([]StorageSlot, *common.Hash, error) {
+	var (
+		it    = trie.NewIterator(st.NodeIterator(start[:]))
+		slots = []StorageSlot{}
+	)
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if len(slots) == maxResults {
+			return slots, &hash, nil
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		slot := StorageSlot{Hash: hash, Value: common.BytesToHash(content)}
+		if preimage := st.GetKey(it.Key); preimage != nil {
+			key := common.BytesToHash(preimage)
+			slot.Key = &key
+		}
+		slots = append(slots, slot)
+	}
+	if it.Err != nil {
+		return nil, nil, it.Err
+	}
+	return slots, nil, nil
+}
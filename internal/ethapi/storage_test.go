@@ -0,0 +1,87 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+func TestStorageRange(t *testing.T) {
+	var (
+		db         = state.NewDatabase(rawdb.NewMemoryDatabase())
+		statedb, _ = state.New(common.Hash{}, db, nil)
+		addr       = common.Address{0x01}
+	)
+	for i := 1; i <= 10; i++ {
+		statedb.SetState(addr, common.BigToHash(big.NewInt(int64(i))), common.Hash{byte(i)})
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb, _ = state.New(root, db, nil)
+	st := statedb.StorageTrie(addr)
+
+	// Page through the storage, checking the order and the resumption keys
+	var (
+		slots []StorageSlot
+		start common.Hash
+	)
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatalf("too many pages")
+		}
+		page, next, err := storageRange(st, start, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) > 3 {
+			t.Fatalf("page %d: have %d slots, want at most 3", pages, len(page))
+		}
+		slots = append(slots, page...)
+		if next == nil {
+			break
+		}
+		start = *next
+	}
+	if len(slots) != 10 {
+		t.Fatalf("have %d slots, want 10", len(slots))
+	}
+	for i, slot := range slots {
+		if i > 0 && bytes.Compare(slots[i-1].Hash[:], slot.Hash[:]) >= 0 {
+			t.Errorf("slot %d: out of order", i)
+		}
+		if slot.Key == nil {
+			t.Fatalf("slot %d: missing key preimage", i)
+		}
+		if want := statedb.GetState(addr, *slot.Key); slot.Value != want {
+			t.Errorf("slot %d: value mismatch: have %x, want %x", i, slot.Value, want)
+		}
+	}
+	// Starting past the last slot returns nothing
+	last := slots[len(slots)-1].Hash
+	last[31]++
+	if page, next, err := storageRange(st, last, 3); err != nil || len(page) != 0 || next != nil {
+		t.Errorf("range past the end: have %d slots, next %v, err %v", len(page), next, err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// positionBlocks is the number of recent blocks whose gas usage is averaged to
+// estimate the time to inclusion of a transaction.
+const positionBlocks = 20
+
+// PoolPosition is the rank of a transaction among the pending transactions of
+// the pool, in the order they are mined in, and its estimated time to inclusion.
+type PoolPosition struct {
+	Hash         common.Hash     `json:"hash"`
+	Pending      bool            `json:"pending"`            // Whether the transaction is executable, not waiting for a nonce gap to fill
+	Position     *hexutil.Uint64 `json:"position,omitempty"` // Number of pending transactions mined before it
+	PendingCount hexutil.Uint64  `json:"pendingCount"`
+	GasAhead     hexutil.Uint64  `json:"gasAhead"`         // Gas of the pending transactions mined before it
+	BlockGasUsed hexutil.Uint64  `json:"blockGasUsed"`     // Average gas used by the recent blocks
+	Blocks       *hexutil.Uint64 `json:"blocks,omitempty"` // Estimated number of blocks until its inclusion
+}
+
+// EstimatePosition returns where a transaction ranks among the pending ones in
+// the pool, in the order they are mined in (by price, honouring the nonces of
+// each sender), and an estimated number of blocks until its inclusion given the
+// gas used by the recent blocks. The transaction is given by the hash of a pooled
+// one, or as a signed one not yet submitted, replacing the pending transaction
+// with the same nonce if any.
+func (s *PublicTxPoolAPI) EstimatePosition(ctx context.Context, input hexutil.Bytes) (*PoolPosition, error) {
+	var tx *types.Transaction
+	if len(input) == common.HashLength {
+		if tx = s.b.GetPoolTransaction(common.BytesToHash(input)); tx == nil {
+			return nil, errors.New("transaction not found in the pool")
+		}
+	} else {
+		tx = new(types.Transaction)
+		if err := rlp.DecodeBytes(input, tx); err != nil {
+			return nil, err
+		}
+	}
+	head := s.b.CurrentBlock()
+	signer := types.MakeSigner(s.b.ChainConfig(), head.Number())
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	result := &PoolPosition{Hash: tx.Hash()}
+
+	// Put the transaction in place among the pending ones of its sender
+	pending, _ := s.b.TxPoolContent()
+	txs := make(types.Transactions, 0, len(pending[from])+1)
+	for _, ptx := range pending[from] {
+		if ptx.Nonce() != tx.Nonce() {
+			txs = append(txs, ptx)
+		}
+	}
+	nonce, err := s.b.GetPoolNonce(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tx.Nonce() > nonce:
+		// Nonce gap, the transaction is queued until filled
+		return result, nil
+	case len(txs) == len(pending[from]) && tx.Nonce() < nonce:
+		return nil, core.ErrNonceTooLow
+	}
+	txs = append(txs, tx)
+	sort.Sort(types.TxByNonce(txs))
+	pending[from] = txs
+
+	// Count the pending transactions mined before it
+	result.Pending = true
+	for _, txs := range pending {
+		result.PendingCount += hexutil.Uint64(len(txs))
+	}
+	ordered := types.NewTransactionsByPriceAndNonce(signer, pending)
+	for position := uint64(0); ; position++ {
+		next := ordered.Peek()
+		if next == nil {
+			return nil, errors.New("transaction not reachable in the pending order")
+		}
+		if next.Hash() == tx.Hash() {
+			result.Position = (*hexutil.Uint64)(&position)
+			break
+		}
+		result.GasAhead += hexutil.Uint64(next.Gas())
+		ordered.Shift()
+	}
+	// Estimate the blocks needed to include the gas ahead and the transaction
+	var (
+		used  uint64
+		count uint64
+	)
+	for number := head.NumberU64(); count < positionBlocks && number > 0; number-- {
+		header, err := s.b.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if header == nil || err != nil {
+			break
+		}
+		used += header.GasUsed
+		count++
+	}
+	throughput := head.GasLimit()
+	if count > 0 && used > 0 {
+		throughput = used / count
+	}
+	result.BlockGasUsed = hexutil.Uint64(throughput)
+	if throughput > 0 {
+		blocks := (uint64(result.GasAhead) + tx.Gas() + throughput - 1) / throughput
+		result.Blocks = (*hexutil.Uint64)(&blocks)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// positionBackend is the part of a backend needed to rank transactions among
+// the pending ones of a pool, with blocks using a million gas each.
+type positionBackend struct {
+	Backend
+	pending map[common.Address]types.Transactions
+}
+
+func (b *positionBackend) ChainConfig() ctypes.ChainConfigurator { return params.TestChainConfig }
+func (b *positionBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(b.header(10))
+}
+func (b *positionBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return b.header(uint64(number)), nil
+}
+func (b *positionBackend) header(number uint64) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(number), GasLimit: 8000000, GasUsed: 1000000}
+}
+func (b *positionBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	pending := make(map[common.Address]types.Transactions)
+	for addr, txs := range b.pending {
+		pending[addr] = append(types.Transactions{}, txs...)
+	}
+	return pending, nil
+}
+func (b *positionBackend) GetPoolTransaction(hash common.Hash) *types.Transaction {
+	for _, txs := range b.pending {
+		for _, tx := range txs {
+			if tx.Hash() == hash {
+				return tx
+			}
+		}
+	}
+	return nil
+}
+func (b *positionBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	txs := b.pending[addr]
+	if len(txs) == 0 {
+		return 0, nil
+	}
+	return txs[len(txs)-1].Nonce() + 1, nil
+}
+
+// Tests that transactions are ranked by price honouring the nonces of their
+// senders, and their time to inclusion estimated from the recent gas usage.
+func TestEstimatePosition(t *testing.T) {
+	signer := types.NewEIP155Signer(params.TestChainConfig.GetChainID())
+	sign := func(key *ecdsa.PrivateKey, nonce uint64, gas uint64, price int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, big.NewInt(0), gas, big.NewInt(price), nil), signer, key)
+		return tx
+	}
+	rich, _ := crypto.GenerateKey()
+	poor, _ := crypto.GenerateKey()
+	backend := &positionBackend{pending: map[common.Address]types.Transactions{
+		crypto.PubkeyToAddress(rich.PublicKey): {sign(rich, 0, 900000, 100), sign(rich, 1, 900000, 50)},
+		crypto.PubkeyToAddress(poor.PublicKey): {sign(poor, 0, 300000, 10), sign(poor, 1, 300000, 200)},
+	}}
+	api := NewPublicTxPoolAPI(backend)
+
+	encode := func(tx *types.Transaction) []byte {
+		enc, _ := rlp.EncodeToBytes(tx)
+		return enc
+	}
+	newbie, _ := crypto.GenerateKey()
+	tests := []struct {
+		input    []byte
+		pending  bool
+		position uint64
+		gasAhead uint64
+		blocks   uint64
+	}{
+		// Pooled, behind the cheaper transaction of its sender
+		{backend.pending[crypto.PubkeyToAddress(poor.PublicKey)][1].Hash().Bytes(), true, 3, 2100000, 3},
+		// Not pooled, outbidding everything
+		{encode(sign(newbie, 0, 21000, 1000)), true, 0, 0, 1},
+		// Replacing a pending transaction with a higher price
+		{encode(sign(poor, 0, 300000, 60)), true, 1, 900000, 2},
+		// Nonce gap
+		{encode(sign(newbie, 1, 21000, 1000)), false, 0, 0, 0},
+	}
+	for i, tt := range tests {
+		position, err := api.EstimatePosition(context.Background(), tt.input)
+		if err != nil {
+			t.Fatalf("test %d: failed to estimate position: %v", i, err)
+		}
+		if position.Pending != tt.pending {
+			t.Fatalf("test %d: pending mismatch: have %v, want %v", i, position.Pending, tt.pending)
+		}
+		if !tt.pending {
+			continue
+		}
+		if uint64(*position.Position) != tt.position || uint64(position.GasAhead) != tt.gasAhead {
+			t.Errorf("test %d: position mismatch: have %d with %d gas ahead, want %d with %d", i, *position.Position, position.GasAhead, tt.position, tt.gasAhead)
+		}
+		if uint64(*position.Blocks) != tt.blocks {
+			t.Errorf("test %d: blocks mismatch: have %d, want %d", i, *position.Blocks, tt.blocks)
+		}
+	}
+	// Nonces below the pending ones are rejected
+	backend.pending[crypto.PubkeyToAddress(newbie.PublicKey)] = types.Transactions{sign(newbie, 5, 21000, 1)}
+	if _, err := api.EstimatePosition(context.Background(), encode(sign(newbie, 3, 21000, 1))); err != core.ErrNonceTooLow {
+		t.Errorf("stale nonce error mismatch: have %v, want %v", err, core.ErrNonceTooLow)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// TxValidation is the verdict of validating a transaction against the rules of
+// the transaction pool and the head state.
+type TxValidation struct {
+	Hash     common.Hash     `json:"hash"`
+	From     *common.Address `json:"from"` // Nil if the signature is invalid
+	Accepted bool            `json:"accepted"`
+	Error    string          `json:"error,omitempty"`
+	Code     int             `json:"code,omitempty"` // Canonical error code of the rejection
+	Data     *ErrorDetails   `json:"data,omitempty"`
+}
+
+// ValidateTransaction checks a signed transaction against the chain ID, the
+// configured fee cap and the rules of the transaction pool with the head state
+// (nonce, balance, intrinsic gas, gas limit, replacement price bump) without
+// adding it to the pool. The transaction is checked as if submitted through
+// eth_sendRawTransaction, or relayed from the network if local is false, which
+// also applies the minimum gas price and the pool capacity.
+func (s *PublicTransactionPoolAPI) ValidateTransaction(ctx context.Context, encodedTx hexutil.Bytes, local *bool) (*TxValidation, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return nil, err
+	}
+	result := &TxValidation{Hash: tx.Hash()}
+
+	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
+	if from, err := types.Sender(signer, tx); err == nil {
+		result.From = &from
+	}
+	err := s.validateTransaction(ctx, tx, local == nil || *local)
+	if err == nil {
+		result.Accepted = true
+		return result, nil
+	}
+	result.Error = err.Error()
+	if _, canonical := canonicalTxError(ctx, s.b, tx, err); canonical != nil {
+		result.Code, result.Data = canonical.code, canonical.details
+	} else {
+		result.Code = ErrCodeTxRejected
+	}
+	return result, nil
+}
+
+func (s *PublicTransactionPoolAPI) validateTransaction(ctx context.Context, tx *types.Transaction, local bool) error {
+	if tx.Protected() && tx.ChainId().Cmp(s.b.ChainConfig().GetChainID()) != 0 {
+		return errInvalidChainID
+	}
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return err
+	}
+	return s.b.ValidateTx(ctx, tx, local)
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// validationBackend is the part of a backend needed to validate transactions,
+// rejecting them by the given pool error.
+type validationBackend struct {
+	errorsBackend
+	poolErr error
+}
+
+func (b *validationBackend) RPCTxFeeCap() float64 { return 1 }
+func (b *validationBackend) ValidateTx(ctx context.Context, tx *types.Transaction, local bool) error {
+	return b.poolErr
+}
+
+// Tests that transactions are given a verdict with the canonical code and
+// details of their rejection.
+func TestValidateTransaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	sign := func(chainID int64, gasPrice int64) []byte {
+		tx := types.NewTransaction(3, common.Address{}, big.NewInt(0), 21000, big.NewInt(gasPrice), nil)
+		tx, _ = types.SignTx(tx, types.NewEIP155Signer(big.NewInt(chainID)), key)
+		enc, _ := rlp.EncodeToBytes(tx)
+		return enc
+	}
+	chainID := params.TestChainConfig.GetChainID().Int64()
+	tests := []struct {
+		tx      []byte
+		poolErr error
+		code    int
+	}{
+		{sign(chainID, 1), nil, 0},
+		{sign(chainID+1, 1), nil, ErrCodeInvalidChainID},
+		{sign(chainID, 1e14), nil, ErrCodeFeeCap},
+		{sign(chainID, 1), core.ErrNonceTooLow, ErrCodeNonceTooLow},
+		{sign(chainID, 1), errors.New("unknown"), ErrCodeTxRejected},
+	}
+	for i, tt := range tests {
+		api := NewPublicTransactionPoolAPI(&validationBackend{errorsBackend{nonce: 5}, tt.poolErr}, nil)
+		verdict, err := api.ValidateTransaction(context.Background(), tt.tx, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to validate: %v", i, err)
+		}
+		if verdict.Accepted != (tt.code == 0) || verdict.Code != tt.code {
+			t.Errorf("test %d: verdict mismatch: have accepted %v code %d, want code %d", i, verdict.Accepted, verdict.Code, tt.code)
+		}
+		if tt.code == ErrCodeInvalidChainID && (verdict.Data == nil || uint64(*verdict.Data.Expected) != uint64(chainID) || uint64(*verdict.Data.Given) != uint64(chainID+1)) {
+			t.Errorf("test %d: chain ID details mismatch: %+v", i, verdict.Data)
+		}
+		if tt.code == 0 && (verdict.From == nil || *verdict.From != from) {
+			t.Errorf("test %d: sender mismatch: have %v, want %x", i, verdict.From, from)
+		}
+	}
+}
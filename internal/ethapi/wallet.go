@@ -0,0 +1,122 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// PublicWalletAPI provides an API to construct transactions which are signed
+// outside of the node (e.g. on an air-gapped machine). None of its methods need
+// access to any private key, the signed result can be broadcast with
+// eth_sendRawTransaction.
+type PublicWalletAPI struct {
+	b Backend
+}
+
+// NewPublicWalletAPI creates a new wallet API.
+func NewPublicWalletAPI(b Backend) *PublicWalletAPI {
+	return &PublicWalletAPI{b}
+}
+
+// UnsignedTransactionResult represents an RLP encoded unsigned transaction along
+// with everything an offline signer needs to sign it.
+type UnsignedTransactionResult struct {
+	Raw         hexutil.Bytes      `json:"raw"`
+	Tx          *types.Transaction `json:"tx"`
+	ChainID     *hexutil.Big       `json:"chainId"`
+	SigningHash common.Hash        `json:"signingHash"`
+}
+
+// signer returns the transaction signer valid for the next block.
+func (s *PublicWalletAPI) signer() types.Signer {
+	next := new(big.Int).Add(s.b.CurrentBlock().Number(), common.Big1)
+	return types.MakeSigner(s.b.ChainConfig(), next)
+}
+
+// BuildTransaction fills the defaults (nonce, gas, gasPrice) on the given
+// transaction and returns it unsigned, together with the chain id it is to be
+// signed for and the hash the signature needs to be calculated over. If the
+// chain id is null, the transaction must be signed without replay protection.
+func (s *PublicWalletAPI) BuildTransaction(ctx context.Context, args SendTxArgs) (*UnsignedTransactionResult, error) {
+	if err := args.setDefaults(ctx, s.b); err != nil {
+		return nil, err
+	}
+	if err := checkTxFee(args.GasPrice.ToInt(), uint64(*args.Gas), s.b.RPCTxFeeCap()); err != nil {
+		return nil, err
+	}
+	tx := args.toTransaction()
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	signer := s.signer()
+
+	result := &UnsignedTransactionResult{
+		Raw:         data,
+		Tx:          tx,
+		SigningHash: signer.Hash(tx),
+	}
+	if _, ok := signer.(types.EIP155Signer); ok {
+		result.ChainID = (*hexutil.Big)(s.b.ChainConfig().GetChainID())
+	}
+	return result, nil
+}
+
+// AssembleTransaction attaches a signature calculated over the signing hash of
+// an unsigned transaction built by BuildTransaction, and returns the signed
+// transaction ready to be broadcast. The signature is in the [R || S || V]
+// format, where V may be 0/1 or 27/28.
+func (s *PublicWalletAPI) AssembleTransaction(ctx context.Context, raw hexutil.Bytes, signature hexutil.Bytes) (*SignTransactionResult, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return nil, err
+	}
+	if v, r, s := tx.RawSignatureValues(); v.Sign() != 0 || r.Sign() != 0 || s.Sign() != 0 {
+		return nil, errors.New("transaction is already signed")
+	}
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("signature must be 65 bytes long, got %d", len(signature))
+	}
+	sig := common.CopyBytes(signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27 // Transform V from 27/28 to 0/1 as expected by the signers
+	}
+	if sig[64] > 1 {
+		return nil, errors.New("invalid signature recovery id")
+	}
+	signed, err := tx.WithSignature(s.signer(), sig)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := types.Sender(s.signer(), signed); err != nil {
+		return nil, err
+	}
+	data, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{data, signed}, nil
+}
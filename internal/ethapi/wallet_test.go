@@ -0,0 +1,134 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/vars"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// walletBackend is the part of a backend needed to build transactions.
+type walletBackend struct {
+	Backend
+	nonce uint64
+}
+
+func (b *walletBackend) ChainConfig() ctypes.ChainConfigurator { return params.TestChainConfig }
+func (b *walletBackend) RPCTxFeeCap() float64                  { return 1 }
+func (b *walletBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), GasLimit: 8000000})
+}
+func (b *walletBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(vars.GWei), nil
+}
+func (b *walletBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return b.nonce, nil
+}
+
+// Tests that transactions built by the wallet API can be signed externally over
+// the returned signing hash, with either recovery id convention, and assembled
+// into a transaction sent by the signing key.
+func TestWalletBuildAndAssemble(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.Address{0xaa}
+	gas := hexutil.Uint64(vars.TxGas)
+
+	api := NewPublicWalletAPI(&walletBackend{nonce: 7})
+	unsigned, err := api.BuildTransaction(context.Background(), SendTxArgs{From: from, To: &to, Gas: &gas})
+	if err != nil {
+		t.Fatalf("failed to build transaction: %v", err)
+	}
+	if unsigned.Tx.Nonce() != 7 || unsigned.Tx.GasPrice().Cmp(big.NewInt(vars.GWei)) != 0 {
+		t.Fatalf("defaults mismatch: have nonce %d, gas price %v", unsigned.Tx.Nonce(), unsigned.Tx.GasPrice())
+	}
+	if unsigned.ChainID == nil || unsigned.ChainID.ToInt().Cmp(params.TestChainConfig.GetChainID()) != 0 {
+		t.Fatalf("chain id mismatch: have %v, want %v", unsigned.ChainID, params.TestChainConfig.GetChainID())
+	}
+	sig, err := crypto.Sign(unsigned.SigningHash[:], key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	for _, offset := range []byte{0, 27} {
+		signature := common.CopyBytes(sig)
+		signature[64] += offset
+
+		signed, err := api.AssembleTransaction(context.Background(), unsigned.Raw, signature)
+		if err != nil {
+			t.Fatalf("V offset %d: failed to assemble transaction: %v", offset, err)
+		}
+		sender, err := types.Sender(types.NewEIP155Signer(params.TestChainConfig.GetChainID()), signed.Tx)
+		if err != nil {
+			t.Fatalf("V offset %d: failed to recover sender: %v", offset, err)
+		}
+		if sender != from {
+			t.Errorf("V offset %d: sender mismatch: have %x, want %x", offset, sender, from)
+		}
+		if id := signed.Tx.ChainId(); id.Cmp(params.TestChainConfig.GetChainID()) != 0 {
+			t.Errorf("V offset %d: chain id mismatch: have %v, want %v", offset, id, params.TestChainConfig.GetChainID())
+		}
+		if signed.Tx.Hash() == unsigned.Tx.Hash() {
+			t.Errorf("V offset %d: assembled transaction left unsigned", offset)
+		}
+	}
+}
+
+// Tests that signatures which cannot be attached to an unsigned transaction are
+// rejected by the wallet API.
+func TestWalletAssembleInvalid(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tx := types.NewTransaction(0, common.Address{0xaa}, big.NewInt(1), vars.TxGas, big.NewInt(vars.GWei), nil)
+
+	signer := types.NewEIP155Signer(params.TestChainConfig.GetChainID())
+	sig, err := crypto.Sign(signer.Hash(tx).Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	unsigned, _ := rlp.EncodeToBytes(tx)
+	signedTx, _ := tx.WithSignature(signer, sig)
+	signed, _ := rlp.EncodeToBytes(signedTx)
+
+	badRecovery := common.CopyBytes(sig)
+	badRecovery[64] = 29
+
+	tests := []struct {
+		raw       []byte
+		signature []byte
+		err       string
+	}{
+		{signed, sig, "transaction is already signed"},
+		{unsigned, sig[:64], "signature must be 65 bytes long, got 64"},
+		{unsigned, append(common.CopyBytes(sig), 0), "signature must be 65 bytes long, got 66"},
+		{unsigned, badRecovery, "invalid signature recovery id"},
+	}
+	api := NewPublicWalletAPI(&walletBackend{})
+	for i, tt := range tests {
+		if _, err := api.AssembleTransaction(context.Background(), tt.raw, tt.signature); err == nil || err.Error() != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %q", i, err, tt.err)
+		}
+	}
+}
@@ -18,6 +18,7 @@
 package web3ext
 
 var Modules = map[string]string{
+	"abi":        AbiJs,
 	"accounting": AccountingJs,
 	"admin":      AdminJs,
 	"chequebook": ChequebookJs,
@@ -28,10 +29,14 @@ var Modules = map[string]string{
 	"miner":      MinerJs,
 	"net":        NetJs,
 	"personal":   PersonalJs,
+	"proof":      ProofJs,
 	"rpc":        RpcJs,
 	"shh":        ShhJs,
 	"swarmfs":    SwarmfsJs,
 	"txpool":     TxpoolJs,
+	"token":      TokenJs,
+	"txmgr":      TxmgrJs,
+	"wallet":     WalletJs,
 	"les":        LESJs,
 	"lespay":     LESPayJs,
 }
@@ -176,11 +181,49 @@ web3._extend({
 			params: 3,
 			inputFormatter: [null, null, null]
 		}),
+		new web3._extend.Method({
+			name: 'reloadAncientTiering',
+			call: 'admin_reloadAncientTiering',
+			params: 1,
+			inputFormatter: [null]
+		}),
 		new web3._extend.Method({
 			name: 'importChain',
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'backup',
+			call: 'admin_backup',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'pruneFrozen',
+			call: 'admin_pruneFrozen',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'chainConfigDiff',
+			call: 'admin_chainConfigDiff',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'maintenanceMode',
+			call: 'admin_maintenanceMode',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'setServingBudget',
+			call: 'admin_setServingBudget',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'pinSyncPeer',
+			call: 'admin_pinSyncPeer',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -206,6 +249,17 @@ web3._extend({
 			name: 'stopWS',
 			call: 'admin_stopWS'
 		}),
+		new web3._extend.Method({
+			name: 'dropSubscription',
+			call: 'admin_dropSubscription',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'setNat',
+			call: 'admin_setNat',
+			params: 1,
+			inputFormatter: [null]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -220,6 +274,38 @@ web3._extend({
 			name: 'datadir',
 			getter: 'admin_datadir'
 		}),
+		new web3._extend.Property({
+			name: 'natStatus',
+			getter: 'admin_natStatus'
+		}),
+		new web3._extend.Property({
+			name: 'subscriptions',
+			getter: 'admin_subscriptions'
+		}),
+		new web3._extend.Property({
+			name: 'callScheduling',
+			getter: 'admin_callScheduling'
+		}),
+		new web3._extend.Property({
+			name: 'buildInfo',
+			getter: 'admin_buildInfo'
+		}),
+		new web3._extend.Property({
+			name: 'ancientTiering',
+			getter: 'admin_ancientTiering'
+		}),
+		new web3._extend.Property({
+			name: 'maintenanceStatus',
+			getter: 'admin_maintenanceStatus'
+		}),
+		new web3._extend.Property({
+			name: 'servingBudget',
+			getter: 'admin_servingBudget'
+		}),
+		new web3._extend.Property({
+			name: 'syncPeers',
+			getter: 'admin_syncPeers'
+		}),
 	]
 });
 `
@@ -239,11 +325,40 @@ web3._extend({
 			call: 'debug_printBlock',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'chainFeatures',
+			call: 'debug_chainFeatures',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputDefaultBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getBlockRlp',
 			call: 'debug_getBlockRlp',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getRawHeader',
+			call: 'debug_getRawHeader',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRawBlock',
+			call: 'debug_getRawBlock',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRawReceipts',
+			call: 'debug_getRawReceipts',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRawTransaction',
+			call: 'debug_getRawTransaction',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'testSignCliqueBlock',
 			call: 'debug_testSignCliqueBlock',
@@ -253,7 +368,8 @@ web3._extend({
 		new web3._extend.Method({
 			name: 'setHead',
 			call: 'debug_setHead',
-			params: 1
+			params: 2,
+			inputFormatter: [null, null]
 		}),
 		new web3._extend.Method({
 			name: 'seedHash',
@@ -440,6 +556,69 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'writeBadBlockReport',
+			call: 'debug_writeBadBlockReport',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'forkView',
+			call: 'debug_forkView',
+			params: 0,
+		}),
+		new web3._extend.Method({
+			name: 'trieStats',
+			call: 'debug_trieStats',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'diffState',
+			call: 'debug_diffState',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'getHeadersRange',
+			call: 'debug_getHeadersRange',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'getAddressesByCodeHash',
+			call: 'debug_getAddressesByCodeHash',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'estimateLogsQuery',
+			call: 'debug_estimateLogsQuery',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'vmStats',
+			call: 'debug_vmStats',
+			params: 1,
+			inputFormatter: [null],
+		}),
+		new web3._extend.Method({
+			name: 'getBalanceHistory',
+			call: 'debug_getBalanceHistory',
+			params: 4,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.fromDecimal],
+		}),
+		new web3._extend.Method({
+			name: 'callMany',
+			call: 'debug_callMany',
+			params: 3,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter, null],
+		}),
+		new web3._extend.Method({
+			name: 'trieFlushPolicy',
+			call: 'debug_trieFlushPolicy',
+		}),
+		new web3._extend.Method({
+			name: 'setTrieFlushPolicy',
+			call: 'debug_setTrieFlushPolicy',
+			params: 1,
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
@@ -462,6 +641,22 @@ web3._extend({
 			call: 'debug_freezeClient',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'stateSource',
+			call: 'debug_stateSource',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter],
+		}),
+		new web3._extend.Method({
+			name: 'snapshotAuditStats',
+			call: 'debug_snapshotAuditStats',
+			params: 0,
+		}),
+		new web3._extend.Method({
+			name: 'receiptVerification',
+			call: 'debug_receiptVerification',
+			params: 0,
+		}),
 	],
 	properties: []
 });
@@ -476,6 +671,17 @@ web3._extend({
 			call: 'eth_chainId',
 			params: 0
 		}),
+		new web3._extend.Method({
+			name: 'gasForecast',
+			call: 'eth_gasForecast',
+			params: 2,
+			inputFormatter: [web3._extend.utils.fromDecimal, null]
+		}),
+		new web3._extend.Method({
+			name: 'getFilterInfo',
+			call: 'eth_getFilterInfo',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'eth_sign',
@@ -494,6 +700,12 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'validateTransaction',
+			call: 'eth_validateTransaction',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
 		new web3._extend.Method({
 			name: 'submitTransaction',
 			call: 'eth_submitTransaction',
@@ -506,6 +718,12 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'signTypedData',
+			call: 'eth_signTypedData_v4',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null]
+		}),
 		new web3._extend.Method({
 			name: 'getHeaderByNumber',
 			call: 'eth_getHeaderByNumber',
@@ -516,6 +734,58 @@ web3._extend({
 			call: 'eth_getHeaderByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getTotalDifficulty',
+			call: 'eth_getTotalDifficulty',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'compareChainWeight',
+			call: 'eth_compareChainWeight',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'getContractCreation',
+			call: 'eth_getContractCreation',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getStorageSize',
+			call: 'eth_getStorageSize',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSupply',
+			call: 'eth_getSupply',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getBlockReward',
+			call: 'eth_getBlockReward',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSupplyDelta',
+			call: 'eth_getSupplyDelta',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getUncleStats',
+			call: 'eth_getUncleStats',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getUnclesByMiner',
+			call: 'eth_getUnclesByMiner',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getBlockByNumber',
 			call: 'eth_getBlockByNumber',
@@ -531,6 +801,11 @@ web3._extend({
 			call: 'eth_getRawTransactionByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getTransactionReceiptProof',
+			call: 'eth_getTransactionReceiptProof',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransactionFromBlock',
 			call: function(args) {
@@ -545,6 +820,18 @@ web3._extend({
 			params: 3,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'getProofs',
+			call: 'eth_getProofs',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getStorageRangeAt',
+			call: 'eth_getStorageRangeAt',
+			params: 4,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -630,6 +917,18 @@ web3._extend({
 			call: 'personal_importRawKey',
 			params: 2
 		}),
+		new web3._extend.Method({
+			name: 'importKeystore',
+			call: 'personal_importKeystore',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
+		new web3._extend.Method({
+			name: 'exportKeystore',
+			call: 'personal_exportKeystore',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'personal_sign',
@@ -649,7 +948,8 @@ web3._extend({
 		new web3._extend.Method({
 			name: 'deriveAccount',
 			call: 'personal_deriveAccount',
-			params: 3
+			params: 3,
+			inputFormatter: [null, null, null]
 		}),
 		new web3._extend.Method({
 			name: 'signTransaction',
@@ -657,6 +957,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter, null]
 		}),
+		new web3._extend.Method({
+			name: 'signTypedData',
+			call: 'personal_signTypedData',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'unpair',
 			call: 'personal_unpair',
@@ -743,7 +1049,24 @@ web3._extend({
 const TxpoolJs = `
 web3._extend({
 	property: 'txpool',
-	methods: [],
+	methods: [
+		new web3._extend.Method({
+			name: 'getArchivedTransaction',
+			call: 'txpool_getArchivedTransaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getArchivedTransactions',
+			call: 'txpool_getArchivedTransactions',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'estimatePosition',
+			call: 'txpool_estimatePosition',
+			params: 1
+		}),
+	],
 	properties:
 	[
 		new web3._extend.Property({
@@ -767,6 +1090,152 @@ web3._extend({
 });
 `
 
+const ProofJs = `
+web3._extend({
+	property: 'proof',
+	methods: [
+		new web3._extend.Method({
+			name: 'verify',
+			call: 'proof_verify',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'verifyInclusion',
+			call: 'proof_verifyInclusion',
+			params: 1
+		}),
+	]
+});
+`
+
+const AbiJs = `
+web3._extend({
+	property: 'abi',
+	methods: [
+		new web3._extend.Method({
+			name: 'register',
+			call: 'abi_register',
+			params: 2,
+		}),
+		new web3._extend.Method({
+			name: 'unregister',
+			call: 'abi_unregister',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'get',
+			call: 'abi_get',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'decodeLog',
+			call: 'abi_decodeLog',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'getTransactionLogs',
+			call: 'abi_getTransactionLogs',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'decodeInput',
+			call: 'abi_decodeInput',
+			params: 2,
+		}),
+		new web3._extend.Method({
+			name: 'decodeTransactionInput',
+			call: 'abi_decodeTransactionInput',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'lookupSignature',
+			call: 'abi_lookupSignature',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'addFunctionSignature',
+			call: 'abi_addFunctionSignature',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'addEventSignature',
+			call: 'abi_addEventSignature',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'importSignatures',
+			call: 'abi_importSignatures',
+			params: 1,
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'list',
+			getter: 'abi_list',
+		}),
+	]
+});
+`
+
+const TokenJs = `
+web3._extend({
+	property: 'token',
+	methods: [
+		new web3._extend.Method({
+			name: 'getBalances',
+			call: 'token_getBalances',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getTransfers',
+			call: 'token_getTransfers',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getHolders',
+			call: 'token_getHolders',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+	]
+});
+`
+
+const TxmgrJs = `
+web3._extend({
+	property: 'txmgr',
+	methods: [
+		new web3._extend.Method({
+			name: 'status',
+			call: 'txmgr_status',
+			params: 1,
+			inputFormatter: [null]
+		}),
+	]
+});
+`
+
+const WalletJs = `
+web3._extend({
+	property: 'wallet',
+	methods: [
+		new web3._extend.Method({
+			name: 'buildTransaction',
+			call: 'wallet_buildTransaction',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'assembleTransaction',
+			call: 'wallet_assembleTransaction',
+			params: 2
+		}),
+	]
+});
+`
+
 const AccountingJs = `
 web3._extend({
 	property: 'accounting',
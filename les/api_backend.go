@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
@@ -59,6 +60,10 @@ func (b *LesApiBackend) SetHead(number uint64) {
 	b.eth.blockchain.SetHead(number)
 }
 
+func (b *LesApiBackend) SetHeadPreview(number uint64) (*core.SetHeadPlan, error) {
+	return nil, errors.New("rewind preview not supported by light clients")
+}
+
 func (b *LesApiBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
 	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
 		return b.eth.blockchain.CurrentHeader(), nil
@@ -176,6 +181,10 @@ func (b *LesApiBackend) GetEVM(ctx context.Context, msg core.Message, state *sta
 	return vm.NewEVM(context, state, b.eth.chainConfig, vm.Config{}), state.Error, nil
 }
 
+func (b *LesApiBackend) ValidateTx(ctx context.Context, tx *types.Transaction, local bool) error {
+	return b.eth.txPool.Validate(ctx, tx)
+}
+
 func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	return b.eth.txPool.Add(ctx, signedTx)
 }
@@ -251,6 +260,14 @@ func (b *LesApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *LesApiBackend) GasForecast(ctx context.Context, blocks int, percentiles []float64) (*gasprice.Forecast, error) {
+	pending, err := b.GetPoolTransactions()
+	if err != nil {
+		return nil, err
+	}
+	return b.gpo.Forecast(ctx, pending, blocks, percentiles)
+}
+
 func (b *LesApiBackend) ChainDb() ethdb.Database {
 	return b.eth.chainDb
 }
@@ -271,6 +288,22 @@ func (b *LesApiBackend) RPCTxFeeCap() float64 {
 	return b.eth.config.RPCTxFeeCap
 }
 
+func (b *LesApiBackend) RPCCacheSize() int {
+	return b.eth.config.RPCCacheSize
+}
+
+func (b *LesApiBackend) RPCCacheTTL() time.Duration {
+	return b.eth.config.RPCCacheTTL
+}
+
+func (b *LesApiBackend) RPCLogsRangeCap() uint64 {
+	return b.eth.config.RPCLogsRangeCap
+}
+
+func (b *LesApiBackend) RPCErrorCodes() bool {
+	return b.eth.config.RPCErrorCodes
+}
+
 func (b *LesApiBackend) BloomStatus() (uint64, uint64) {
 	if b.eth.bloomIndexer == nil {
 		return 0, 0
@@ -246,7 +246,12 @@ func (s *LightEthereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPIWithConfig(s.ApiBackend, true, s.config.Filters),
+			Public:    true,
+		}, {
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   filters.NewPublicDebugFilterAPI(s.ApiBackend),
 			Public:    true,
 		}, {
 			Namespace: "net",
@@ -444,6 +444,18 @@ func (pool *TxPool) add(ctx context.Context, tx *types.Transaction) error {
 	return nil
 }
 
+// Validate checks whether a transaction would be added to the pool, without
+// adding it.
+func (pool *TxPool) Validate(ctx context.Context, tx *types.Transaction) error {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.pending[tx.Hash()] != nil {
+		return core.ErrAlreadyKnown
+	}
+	return pool.validateTx(ctx, tx)
+}
+
 // Add adds a transaction to the pool if valid and passes it to the tx relay
 // backend
 func (pool *TxPool) Add(ctx context.Context, tx *types.Transaction) error {
@@ -121,6 +121,17 @@ func (r *reporter) run() {
 }
 
 func (r *reporter) send() error {
+	bps := client.BatchPoints{
+		Points:   r.points(),
+		Database: r.database,
+	}
+
+	_, err := r.client.Write(bps)
+	return err
+}
+
+// points converts the metrics of the registry into InfluxDB points.
+func (r *reporter) points() []client.Point {
 	var pts []client.Point
 
 	r.reg.Each(func(name string, i interface{}) {
@@ -246,11 +257,5 @@ func (r *reporter) send() error {
 		}
 	})
 
-	bps := client.BatchPoints{
-		Points:   pts,
-		Database: r.database,
-	}
-
-	_, err := r.client.Write(bps)
-	return err
+	return pts
 }
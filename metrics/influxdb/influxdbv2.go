@@ -0,0 +1,102 @@
+package influxdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	uurl "net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+type v2Reporter struct {
+	*reporter
+
+	endpoint string // Write API endpoint, including the organization and bucket
+	token    string
+
+	client *http.Client
+}
+
+// InfluxDBV2WithTags starts a InfluxDB v2 reporter which will post the from the given metrics.Registry at each d interval with the specified tags,
+// authenticating with the token into the bucket of the organization
+func InfluxDBV2WithTags(r metrics.Registry, d time.Duration, url, token, bucket, organization, namespace string, tags map[string]string) {
+	rep, err := newV2Reporter(r, url, token, bucket, organization, namespace, tags)
+	if err != nil {
+		log.Warn("Unable to parse InfluxDB", "url", url, "err", err)
+		return
+	}
+	for range time.Tick(d) {
+		if err := rep.send(); err != nil {
+			log.Warn("Unable to send to InfluxDB", "err", err)
+		}
+	}
+}
+
+// InfluxDBV2WithTagsOnce runs once an InfluxDB v2 reporter and post the given metrics.Registry with the specified tags
+func InfluxDBV2WithTagsOnce(r metrics.Registry, url, token, bucket, organization, namespace string, tags map[string]string) error {
+	rep, err := newV2Reporter(r, url, token, bucket, organization, namespace, tags)
+	if err != nil {
+		return fmt.Errorf("unable to parse InfluxDB. url: %s, err: %v", url, err)
+	}
+	if err := rep.send(); err != nil {
+		return fmt.Errorf("unable to send to InfluxDB. err: %v", err)
+	}
+	return nil
+}
+
+func newV2Reporter(r metrics.Registry, url, token, bucket, organization, namespace string, tags map[string]string) (*v2Reporter, error) {
+	u, err := uurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	query := uurl.Values{}
+	query.Set("org", organization)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ns")
+
+	return &v2Reporter{
+		reporter: &reporter{
+			reg:       r,
+			url:       *u,
+			namespace: namespace,
+			tags:      tags,
+			cache:     make(map[string]int64),
+		},
+		endpoint: strings.TrimSuffix(u.String(), "/") + "/api/v2/write?" + query.Encode(),
+		token:    token,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// send posts the metrics of the registry in line protocol to the v2 write API.
+func (r *v2Reporter) send() error {
+	var buf bytes.Buffer
+	for _, pt := range r.points() {
+		buf.WriteString(pt.MarshalString())
+		buf.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Token "+r.token)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// pushClient is the HTTP client pushing the metrics to the pushgateway.
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// Push starts pushing the metrics of the given registry to a Prometheus
+// pushgateway at each d interval, grouped under the given job and labels. It's
+// meant for nodes the Prometheus server can't scrape, e.g. behind a NAT.
+func Push(reg metrics.Registry, d time.Duration, gateway, job string, labels map[string]string) {
+	endpoint, err := pushURL(gateway, job, labels)
+	if err != nil {
+		log.Warn("Unable to parse Prometheus pushgateway", "url", gateway, "err", err)
+		return
+	}
+	for range time.Tick(d) {
+		if err := push(reg, endpoint); err != nil {
+			log.Warn("Unable to push to Prometheus pushgateway", "err", err)
+		}
+	}
+}
+
+// PushOnce pushes the metrics of the given registry to a Prometheus pushgateway
+// once, grouped under the given job and labels.
+func PushOnce(reg metrics.Registry, gateway, job string, labels map[string]string) error {
+	endpoint, err := pushURL(gateway, job, labels)
+	if err != nil {
+		return fmt.Errorf("unable to parse Prometheus pushgateway. url: %s, err: %v", gateway, err)
+	}
+	return push(reg, endpoint)
+}
+
+// pushURL returns the pushgateway URL of the group of metrics identified by the
+// job and the labels.
+func pushURL(gateway, job string, labels map[string]string) (string, error) {
+	u, err := url.Parse(gateway)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if job == "" {
+		return "", fmt.Errorf("empty job name")
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	grouping := "/metrics" + groupingPair("job", job)
+	for _, name := range names {
+		grouping += groupingPair(name, labels[name])
+	}
+	return strings.TrimSuffix(u.String(), "/") + grouping, nil
+}
+
+// groupingPair returns the path segments of a grouping label. Values the path
+// can't carry as is, empty or containing slashes, are base64 encoded as the
+// pushgateway expects, with the empty value written as a lone padding sign.
+func groupingPair(name, value string) string {
+	switch {
+	case value == "":
+		return "/" + url.PathEscape(name) + "@base64/="
+	case strings.Contains(value, "/"):
+		return "/" + url.PathEscape(name) + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + url.PathEscape(name) + "/" + url.PathEscape(value)
+}
+
+// push replaces the group of metrics at the given pushgateway URL with the
+// current metrics of the registry.
+func push(reg metrics.Registry, endpoint string) error {
+	c := collect(reg)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, c.buff)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+func TestPushOnce(t *testing.T) {
+	var (
+		method, path, body string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blob, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(blob)
+	}))
+	defer server.Close()
+
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("test/counter", reg).Inc(12345)
+
+	labels := map[string]string{"role": "full", "chain": "classic", "instance": "node/1", "zone": ""}
+	if err := PushOnce(reg, server.URL+"/", "geth", labels); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if method != http.MethodPut {
+		t.Errorf("method mismatch: have %s, want %s", method, http.MethodPut)
+	}
+	if want := "/metrics/job/geth/chain/classic/instance@base64/bm9kZS8x/role/full/zone@base64/="; path != want {
+		t.Errorf("path mismatch: have %s, want %s", path, want)
+	}
+	if !strings.Contains(body, "test_counter 12345") {
+		t.Errorf("pushed metrics missing the counter:\n%s", body)
+	}
+	if err := PushOnce(reg, "ftp://localhost", "geth", nil); err == nil {
+		t.Error("unsupported scheme accepted")
+	}
+}
+
+// Tests that the grouping values the URL path can't carry as is are base64
+// encoded as the pushgateway expects.
+func TestPushURLEncoding(t *testing.T) {
+	tests := []struct {
+		job    string
+		labels map[string]string
+		want   string
+	}{
+		{"geth", map[string]string{"role": "full node"}, "http://gw/metrics/job/geth/role/full%20node"},
+		{"geth/a", nil, "http://gw/metrics/job@base64/Z2V0aC9h"},
+		{"geth", map[string]string{"path": "/"}, "http://gw/metrics/job/geth/path@base64/Lw"},
+		{"geth", map[string]string{"empty": ""}, "http://gw/metrics/job/geth/empty@base64/="},
+	}
+	for _, tt := range tests {
+		have, err := pushURL("http://gw", tt.job, tt.labels)
+		if err != nil {
+			t.Errorf("%s %v: failed to build URL: %v", tt.job, tt.labels, err)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("%s %v: URL mismatch: have %s, want %s", tt.job, tt.labels, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/params/vars"
+)
+
+// devSealTimeout is the time allowed for the consensus engine to seal a block.
+const devSealTimeout = 10 * time.Second
+
+var errNoEtherbase = errors.New("etherbase missing")
+
+// devSnapshot is a point of a developer chain which can be reverted to.
+type devSnapshot struct {
+	id         uint64
+	head       common.Hash
+	number     uint64
+	timeOffset int64
+}
+
+// DevSealer creates blocks on developer chains. Unlike the miner it doesn't
+// prepare sealing work in advance, but synchronously assembles and imports a
+// block with the pending transactions, as soon as transactions arrive (automine)
+// and/or at a fixed interval. Blocks may also be sealed on demand with arbitrary
+// timestamps, so the consensus engine must accept them (e.g. a faked ethash).
+type DevSealer struct {
+	config      *Config
+	chainConfig ctypes.ChainConfigurator
+	engine      consensus.Engine
+	eth         Backend
+	mux         *event.TypeMux
+	period      uint64 // Seconds between blocks (0 = seal on transactions)
+
+	coinbase      common.Address
+	automine      bool   // Whether to seal blocks whenever transactions arrive
+	nextTimestamp uint64 // Timestamp of the next block (0 = current time)
+	timeOffset    int64  // Seconds added to the current time for block timestamps
+	snapshots     []devSnapshot
+	lastSnapshot  uint64
+	running       bool
+	quit          chan struct{}
+	wg            sync.WaitGroup
+	lock          sync.Mutex // Protects the sealer fields above
+	sealLock      sync.Mutex // Serializes block creation and chain reverts
+}
+
+// NewDevSealer creates a developer block sealer on top of the given backend.
+func NewDevSealer(eth Backend, config *Config, chainConfig ctypes.ChainConfigurator, mux *event.TypeMux, engine consensus.Engine, period uint64) *DevSealer {
+	return &DevSealer{
+		config:      config,
+		chainConfig: chainConfig,
+		engine:      engine,
+		eth:         eth,
+		mux:         mux,
+		period:      period,
+		coinbase:    config.Etherbase,
+		automine:    period == 0,
+	}
+}
+
+// Start begins sealing blocks with the given coinbase, whenever new transactions
+// arrive if automine is enabled and at the configured interval.
+func (s *DevSealer) Start(coinbase common.Address) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.coinbase = coinbase
+	if s.running {
+		return
+	}
+	s.running = true
+	s.quit = make(chan struct{})
+
+	s.wg.Add(1)
+	go s.loop(s.quit)
+}
+
+// Stop terminates the automatic sealing of blocks. Blocks may still be sealed
+// on demand.
+func (s *DevSealer) Stop() {
+	s.lock.Lock()
+	if !s.running {
+		s.lock.Unlock()
+		return
+	}
+	s.running = false
+	close(s.quit)
+	s.lock.Unlock()
+
+	s.wg.Wait()
+}
+
+// Mining reports whether blocks are being sealed automatically.
+func (s *DevSealer) Mining() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.running
+}
+
+// SetEtherbase sets the coinbase of the sealed blocks.
+func (s *DevSealer) SetEtherbase(addr common.Address) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.coinbase = addr
+}
+
+// SetNextTimestamp sets the timestamp of the next sealed block, which must be
+// later than the current head.
+func (s *DevSealer) SetNextTimestamp(timestamp uint64) error {
+	if head := s.eth.BlockChain().CurrentBlock(); timestamp <= head.Time() {
+		return fmt.Errorf("timestamp %d not after current head %d", timestamp, head.Time())
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nextTimestamp = timestamp
+	return nil
+}
+
+// SetAutomine sets whether blocks are sealed as soon as transactions arrive.
+func (s *DevSealer) SetAutomine(enabled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.automine = enabled
+}
+
+// IncreaseTime moves the time used for block timestamps forward by the given
+// number of seconds, returning the total offset from the current time.
+func (s *DevSealer) IncreaseTime(seconds uint64) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.timeOffset += int64(seconds)
+	return s.timeOffset
+}
+
+// Snapshot records the current head of the chain, returning an identifier that
+// can be used to revert to it.
+func (s *DevSealer) Snapshot() uint64 {
+	s.sealLock.Lock()
+	defer s.sealLock.Unlock()
+
+	head := s.eth.BlockChain().CurrentBlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastSnapshot++
+	s.snapshots = append(s.snapshots, devSnapshot{
+		id:         s.lastSnapshot,
+		head:       head.Hash(),
+		number:     head.NumberU64(),
+		timeOffset: s.timeOffset,
+	})
+	return s.lastSnapshot
+}
+
+// Revert rewinds the chain to the head recorded by a snapshot, discarding the
+// snapshot along with all the ones taken after it. False is returned if the
+// snapshot is unknown.
+func (s *DevSealer) Revert(id uint64) (bool, error) {
+	s.sealLock.Lock()
+	defer s.sealLock.Unlock()
+
+	s.lock.Lock()
+	index := -1
+	for i, snap := range s.snapshots {
+		if snap.id == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		s.lock.Unlock()
+		return false, nil
+	}
+	snap := s.snapshots[index]
+	s.snapshots = s.snapshots[:index]
+	s.timeOffset = snap.timeOffset
+	s.nextTimestamp = 0
+	s.lock.Unlock()
+
+	chain := s.eth.BlockChain()
+	if chain.CurrentBlock().Hash() == snap.head {
+		return true, nil
+	}
+	if err := chain.SetHead(snap.number); err != nil {
+		return false, err
+	}
+	if head := chain.CurrentBlock(); head.Hash() != snap.head {
+		return false, fmt.Errorf("reverted to block #%d instead of #%d", head.NumberU64(), snap.number)
+	}
+	log.Info("Reverted developer chain", "number", snap.number, "hash", snap.head)
+	return true, nil
+}
+
+// loop seals blocks at the configured interval, and whenever new transactions
+// are added to the pool if automine is enabled.
+func (s *DevSealer) loop(quit chan struct{}) {
+	defer s.wg.Done()
+
+	var tick <-chan time.Time
+	if s.period > 0 {
+		ticker := time.NewTicker(time.Duration(s.period) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	txsCh := make(chan core.NewTxsEvent, txChanSize)
+	txsSub := s.eth.TxPool().SubscribeNewTxsEvent(txsCh)
+	defer txsSub.Unsubscribe()
+
+	// Seal anything already pending before mining was started
+	if s.automining() {
+		if _, err := s.Seal(false); err != nil {
+			log.Warn("Failed to seal developer block", "err", err)
+		}
+	}
+	for {
+		select {
+		case <-tick:
+			if _, err := s.Seal(true); err != nil {
+				log.Warn("Failed to seal developer block", "err", err)
+			}
+		case <-txsCh:
+			if !s.automining() {
+				continue
+			}
+			if _, err := s.Seal(false); err != nil {
+				log.Warn("Failed to seal developer block", "err", err)
+			}
+		case <-txsSub.Err():
+			return
+		case <-quit:
+			return
+		}
+	}
+}
+
+// automining reports whether blocks are sealed as soon as transactions arrive.
+func (s *DevSealer) automining() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.automine
+}
+
+// Seal assembles a block with the pending transactions on top of the current
+// head and imports it into the chain. If there are no transactions to include
+// and allowEmpty is not set, no block is created and nil is returned.
+func (s *DevSealer) Seal(allowEmpty bool) (*types.Block, error) {
+	s.sealLock.Lock()
+	defer s.sealLock.Unlock()
+
+	s.lock.Lock()
+	coinbase, timestamp, offset := s.coinbase, s.nextTimestamp, s.timeOffset
+	s.lock.Unlock()
+
+	if coinbase == (common.Address{}) {
+		return nil, errNoEtherbase
+	}
+	pending, err := s.eth.TxPool().Pending()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 && !allowEmpty {
+		return nil, nil
+	}
+	var (
+		chain  = s.eth.BlockChain()
+		parent = chain.CurrentBlock()
+		num    = parent.Number()
+	)
+	if timestamp <= parent.Time() {
+		timestamp = uint64(time.Now().Unix() + offset)
+		if timestamp <= parent.Time() {
+			timestamp = parent.Time() + 1
+		}
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     num.Add(num, common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, s.config.GasFloor, s.config.GasCeil),
+		Extra:      s.config.ExtraData,
+		Time:       timestamp,
+		Coinbase:   coinbase,
+	}
+	if err := s.engine.Prepare(chain, header); err != nil {
+		return nil, fmt.Errorf("failed to prepare header: %v", err)
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		signer   = types.NewEIP155Signer(s.chainConfig.GetChainID())
+		txs      = types.NewTransactionsByPriceAndNonce(signer, pending)
+		gasPool  = new(core.GasPool).AddGas(header.GasLimit)
+		included []*types.Transaction
+		receipts []*types.Receipt
+	)
+	for gasPool.Gas() >= vars.TxGas {
+		tx := txs.Peek()
+		if tx == nil {
+			break
+		}
+		if tx.Protected() && !s.chainConfig.IsEnabled(s.chainConfig.GetEIP155Transition, header.Number) {
+			txs.Pop()
+			continue
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(included))
+
+		snap := statedb.Snapshot()
+		receipt, err := core.ApplyTransaction(s.chainConfig, chain, &coinbase, gasPool, statedb, header, tx, &header.GasUsed, *chain.GetVMConfig())
+		switch err {
+		case core.ErrGasLimitReached, core.ErrNonceTooHigh:
+			statedb.RevertToSnapshot(snap)
+			txs.Pop()
+
+		case nil:
+			included = append(included, tx)
+			receipts = append(receipts, receipt)
+			txs.Shift()
+
+		default:
+			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
+			statedb.RevertToSnapshot(snap)
+			txs.Shift()
+		}
+	}
+	if len(included) == 0 && !allowEmpty {
+		return nil, nil
+	}
+	block, err := s.engine.FinalizeAndAssemble(chain, header, statedb, included, nil, receipts)
+	if err != nil {
+		return nil, err
+	}
+	// Seal the block, the engine is expected to return quickly on developer chains
+	var (
+		results = make(chan *types.Block, 1)
+		stop    = make(chan struct{})
+	)
+	defer close(stop)
+
+	if err := s.engine.Seal(chain, block, results, stop); err != nil {
+		return nil, err
+	}
+	select {
+	case block = <-results:
+	case <-time.After(devSealTimeout):
+		return nil, errors.New("block sealing timed out")
+	}
+	// Fill in the block location of the receipts and logs, then import the block
+	var logs []*types.Log
+	for i, receipt := range receipts {
+		receipt.BlockHash = block.Hash()
+		receipt.BlockNumber = block.Number()
+		receipt.TransactionIndex = uint(i)
+		for _, log := range receipt.Logs {
+			log.BlockHash = block.Hash()
+		}
+		logs = append(logs, receipt.Logs...)
+	}
+	if _, err := chain.WriteBlockWithState(block, receipts, logs, statedb, true); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	if s.nextTimestamp <= block.Time() {
+		s.nextTimestamp = 0
+	}
+	s.lock.Unlock()
+
+	log.Info("Sealed new developer block", "number", block.Number(), "hash", block.Hash(), "txs", len(included), "time", block.Time())
+	s.mux.Post(core.NewMinedBlockEvent{Block: block})
+	return block, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// DevQuantity is a number (e.g. a timestamp or snapshot id) accepted both as a
+// JSON number and as a hex or decimal string, as sent by the development tools.
+type DevQuantity uint64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *DevQuantity) UnmarshalJSON(input []byte) error {
+	if len(input) > 0 && input[0] == '"' {
+		var str string
+		if err := json.Unmarshal(input, &str); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(str, "0x") {
+			num, err := strconv.ParseUint(str, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantity %q", str)
+			}
+			*t = DevQuantity(num)
+			return nil
+		}
+		num, err := hexutil.DecodeUint64(str)
+		if err != nil {
+			return err
+		}
+		*t = DevQuantity(num)
+		return nil
+	}
+	var num uint64
+	if err := json.Unmarshal(input, &num); err != nil {
+		return err
+	}
+	*t = DevQuantity(num)
+	return nil
+}
+
+// PublicDevAPI provides the test methods of developer chains in the evm namespace,
+// compatible with the ones of common development tools.
+type PublicDevAPI struct {
+	sealer *DevSealer
+}
+
+// NewPublicDevAPI creates the evm API on top of a developer block sealer.
+func NewPublicDevAPI(sealer *DevSealer) *PublicDevAPI {
+	return &PublicDevAPI{sealer: sealer}
+}
+
+// Mine seals a block with the pending transactions, even if there are none. If
+// a timestamp is given, it's used for the new block.
+func (api *PublicDevAPI) Mine(timestamp *DevQuantity) (string, error) {
+	if timestamp != nil {
+		if err := api.sealer.SetNextTimestamp(uint64(*timestamp)); err != nil {
+			return "", err
+		}
+	}
+	if _, err := api.sealer.Seal(true); err != nil {
+		return "", err
+	}
+	return "0x0", nil
+}
+
+// SetNextBlockTimestamp sets the timestamp of the next sealed block.
+func (api *PublicDevAPI) SetNextBlockTimestamp(timestamp DevQuantity) error {
+	return api.sealer.SetNextTimestamp(uint64(timestamp))
+}
+
+// Snapshot records the current state of the chain, returning the identifier to
+// revert to it.
+func (api *PublicDevAPI) Snapshot() hexutil.Uint64 {
+	return hexutil.Uint64(api.sealer.Snapshot())
+}
+
+// Revert rewinds the chain to a snapshot, which is discarded along with all the
+// later ones. It reports whether the snapshot was found.
+func (api *PublicDevAPI) Revert(id DevQuantity) (bool, error) {
+	return api.sealer.Revert(uint64(id))
+}
+
+// IncreaseTime moves the time of the following blocks forward by the given number
+// of seconds, returning the total time adjustment.
+func (api *PublicDevAPI) IncreaseTime(seconds DevQuantity) int64 {
+	return api.sealer.IncreaseTime(uint64(seconds))
+}
+
+// SetAutomine sets whether blocks are sealed as soon as transactions arrive.
+func (api *PublicDevAPI) SetAutomine(enabled bool) {
+	api.sealer.SetAutomine(enabled)
+}
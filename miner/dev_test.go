@@ -0,0 +1,188 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+func newTestDevSealer(t *testing.T, period uint64) (*DevSealer, *testWorkerBackend) {
+	engine := ethash.NewFullFaker()
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+
+	sealer := NewDevSealer(backend, testConfig, ethashChainConfig, new(event.TypeMux), engine, period)
+	sealer.SetEtherbase(testBankAddress)
+	return sealer, backend
+}
+
+// Tests that blocks are sealed on demand, with the requested timestamps.
+func TestDevSealerSeal(t *testing.T) {
+	sealer, backend := newTestDevSealer(t, 0)
+	defer backend.chain.Stop()
+
+	// Empty blocks are only sealed if explicitly allowed
+	if block, err := sealer.Seal(false); err != nil || block != nil {
+		t.Fatalf("empty block sealed: %v, %v", block, err)
+	}
+	block, err := sealer.Seal(true)
+	if err != nil {
+		t.Fatalf("failed to seal empty block: %v", err)
+	}
+	if head := backend.chain.CurrentBlock(); head.Hash() != block.Hash() || head.NumberU64() != 1 {
+		t.Fatalf("head mismatch: have #%d, want #1", head.NumberU64())
+	}
+	// Transactions are included, in blocks with the requested timestamp
+	if err := sealer.SetNextTimestamp(block.Time()); err == nil {
+		t.Fatalf("timestamp not after head accepted")
+	}
+	next := uint64(time.Now().Unix()) + 3600
+	if err := sealer.SetNextTimestamp(next); err != nil {
+		t.Fatalf("failed to set timestamp: %v", err)
+	}
+	backend.txPool.AddLocal(backend.newRandomTx(false))
+	if block, err = sealer.Seal(false); err != nil || block == nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if len(block.Transactions()) != 1 || block.Time() != next {
+		t.Fatalf("block mismatch: have %d txs at %d, want 1 at %d", len(block.Transactions()), block.Time(), next)
+	}
+	if receipts := backend.chain.GetReceiptsByHash(block.Hash()); len(receipts) != 1 || receipts[0].BlockHash != block.Hash() {
+		t.Fatalf("receipts not stored with block")
+	}
+	// The requested timestamp only applies to a single block
+	if block, err = sealer.Seal(true); err != nil || block.Time() != next+1 {
+		t.Fatalf("timestamp not reset: %v", err)
+	}
+}
+
+// Tests that blocks are sealed automatically as soon as transactions arrive.
+func TestDevSealerInstant(t *testing.T) {
+	sealer, backend := newTestDevSealer(t, 0)
+	defer backend.chain.Stop()
+
+	sealer.Start(testBankAddress)
+	defer sealer.Stop()
+
+	backend.txPool.AddLocal(backend.newRandomTx(false))
+	for i := 0; i < 100; i++ {
+		if backend.chain.CurrentBlock().NumberU64() == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if head := backend.chain.CurrentBlock(); head.NumberU64() != 1 || len(head.Transactions()) != 1 {
+		t.Fatalf("transaction not sealed: head #%d", head.NumberU64())
+	}
+}
+
+// Tests that the chain can be reverted to snapshots, restoring the time offsets.
+func TestDevSealerSnapshots(t *testing.T) {
+	sealer, backend := newTestDevSealer(t, 0)
+	defer backend.chain.Stop()
+
+	if _, err := sealer.Seal(true); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	var (
+		first  = sealer.Snapshot()
+		head   = backend.chain.CurrentBlock()
+		offset = sealer.IncreaseTime(3600)
+	)
+	backend.txPool.AddLocal(backend.newRandomTx(false))
+	block, err := sealer.Seal(false)
+	if err != nil || block == nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if now := uint64(time.Now().Unix()); block.Time() < now+uint64(offset) {
+		t.Fatalf("time offset not applied: have %d, want >= %d", block.Time(), now+uint64(offset))
+	}
+	second := sealer.Snapshot()
+	if _, err := sealer.Seal(true); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if pending, _ := backend.txPool.Stats(); pending == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Reverting discards the later blocks, snapshots and time offsets
+	if ok, err := sealer.Revert(first); !ok || err != nil {
+		t.Fatalf("failed to revert: %v, %v", ok, err)
+	}
+	if current := backend.chain.CurrentBlock(); current.Hash() != head.Hash() {
+		t.Fatalf("head mismatch: have #%d, want #%d", current.NumberU64(), head.NumberU64())
+	}
+	if offset := sealer.IncreaseTime(0); offset != 0 {
+		t.Fatalf("time offset not reverted: have %d", offset)
+	}
+	if ok, _ := sealer.Revert(second); ok {
+		t.Fatalf("discarded snapshot reverted to")
+	}
+	// The transaction pool follows the reverted chain
+	for i := 0; i < 100; i++ {
+		if nonce := backend.txPool.Nonce(testBankAddress); nonce == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if nonce := backend.txPool.Nonce(testBankAddress); nonce != 0 {
+		t.Fatalf("pool nonce mismatch: have %d, want 0", nonce)
+	}
+}
+
+// Tests that transactions are left pending if automine is disabled.
+func TestDevSealerAutomine(t *testing.T) {
+	sealer, backend := newTestDevSealer(t, 0)
+	defer backend.chain.Stop()
+
+	sealer.SetAutomine(false)
+	sealer.Start(testBankAddress)
+	defer sealer.Stop()
+
+	backend.txPool.AddLocal(backend.newRandomTx(false))
+	time.Sleep(100 * time.Millisecond)
+	if head := backend.chain.CurrentBlock(); head.NumberU64() != 0 {
+		t.Fatalf("block sealed without automine: head #%d", head.NumberU64())
+	}
+	if block, err := sealer.Seal(true); err != nil || len(block.Transactions()) != 1 {
+		t.Fatalf("pending transaction not sealed on demand: %v", err)
+	}
+}
+
+// Tests that quantities are accepted in the formats sent by development tools.
+func TestDevQuantityDecoding(t *testing.T) {
+	for input, want := range map[string]uint64{`1600000000`: 1600000000, `"1600000000"`: 1600000000, `"0x5f5e1000"`: 1600000000} {
+		var have DevQuantity
+		if err := json.Unmarshal([]byte(input), &have); err != nil {
+			t.Fatalf("%s: failed to decode: %v", input, err)
+		}
+		if uint64(have) != want {
+			t.Fatalf("%s: quantity mismatch: have %d, want %d", input, have, want)
+		}
+	}
+	var ts DevQuantity
+	if err := json.Unmarshal([]byte(`"12abc"`), &ts); err == nil {
+		t.Fatalf("invalid quantity accepted")
+	}
+}
@@ -52,6 +52,8 @@ type Config struct {
 	GasPrice  *big.Int       // Minimum gas price for mining a transaction
 	Recommit  time.Duration  // The time interval for miner to re-create mining work.
 	Noverify  bool           // Disable remote mining solution verification(only useful in ethash).
+
+	ClockGuard bool `toml:",omitempty"` // Refuse to seal blocks while the system clock drift exceeds the NTP threshold
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -160,6 +162,12 @@ func (miner *Miner) SetExtra(extra []byte) error {
 	return nil
 }
 
+// SetSealGuard sets a check to pass before sealing blocks. While it fails, the
+// miner keeps creating sealing work but doesn't seal it.
+func (miner *Miner) SetSealGuard(guard func() error) {
+	miner.worker.setSealGuard(guard)
+}
+
 // SetRecommitInterval sets the interval for sealing work resubmitting.
 func (miner *Miner) SetRecommitInterval(interval time.Duration) {
 	miner.worker.setRecommitInterval(interval)
@@ -156,9 +156,10 @@ type worker struct {
 	remoteUncles map[common.Hash]*types.Block // A set of side blocks as the possible uncle blocks.
 	unconfirmed  *unconfirmedBlocks           // A set of locally mined blocks pending canonicalness confirmations.
 
-	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
-	coinbase common.Address
-	extra    []byte
+	mu        sync.RWMutex // The lock used to protect the coinbase, extra and seal guard fields
+	coinbase  common.Address
+	extra     []byte
+	sealGuard func() error // Checked before sealing blocks, refusing to seal them while failing
 
 	pendingMu    sync.RWMutex
 	pendingTasks map[common.Hash]*task
@@ -251,6 +252,25 @@ func (w *worker) setExtra(extra []byte) {
 	w.extra = extra
 }
 
+// setSealGuard sets the check to pass before sealing blocks.
+func (w *worker) setSealGuard(guard func() error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sealGuard = guard
+}
+
+// checkSealGuard runs the check to pass before sealing blocks, if any.
+func (w *worker) checkSealGuard() error {
+	w.mu.RLock()
+	guard := w.sealGuard
+	w.mu.RUnlock()
+
+	if guard == nil {
+		return nil
+	}
+	return guard()
+}
+
 // setRecommitInterval updates the interval for miner sealing work recommitting.
 func (w *worker) setRecommitInterval(interval time.Duration) {
 	w.resubmitIntervalCh <- interval
@@ -527,8 +547,9 @@ func (w *worker) mainLoop() {
 // push them to consensus engine.
 func (w *worker) taskLoop() {
 	var (
-		stopCh chan struct{}
-		prev   common.Hash
+		stopCh  chan struct{}
+		prev    common.Hash
+		refused bool // Whether the seal guard refused the last task
 	)
 
 	// interrupt aborts the in-flight sealing task.
@@ -556,6 +577,16 @@ func (w *worker) taskLoop() {
 			if w.skipSealHook != nil && w.skipSealHook(task) {
 				continue
 			}
+			if err := w.checkSealGuard(); err != nil {
+				if !refused {
+					log.Warn("Refusing to seal blocks", "number", task.block.Number(), "err", err)
+				}
+				refused = true
+				continue
+			} else if refused {
+				log.Info("Resuming sealing blocks", "number", task.block.Number())
+				refused = false
+			}
 			w.pendingMu.Lock()
 			w.pendingTasks[sealHash] = task
 			w.pendingMu.Unlock()
@@ -17,6 +17,7 @@
 package miner
 
 import (
+	"errors"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -516,3 +517,36 @@ func testAdjustInterval(t *testing.T, chainConfig ctypes.ChainConfigurator, engi
 		t.Error("interval reset timeout")
 	}
 }
+
+func TestSealGuard(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var skewed int32 = 1
+	w.setSealGuard(func() error {
+		if atomic.LoadInt32(&skewed) == 1 {
+			return errors.New("clock skewed")
+		}
+		return nil
+	})
+	sub := w.mux.Subscribe(core.NewMinedBlockEvent{})
+	defer sub.Unsubscribe()
+
+	w.start()
+	b.txPool.AddLocal(b.newRandomTx(true))
+	select {
+	case <-sub.Chan():
+		t.Fatal("block sealed while the seal guard fails")
+	case <-time.After(time.Second):
+	}
+	atomic.StoreInt32(&skewed, 0)
+	b.txPool.AddLocal(b.newRandomTx(true))
+	select {
+	case <-sub.Chan():
+	case <-time.After(3 * time.Second):
+		t.Fatal("block not sealed after the seal guard passes")
+	}
+}
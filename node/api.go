@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/debug"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -124,6 +126,32 @@ func (api *privateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// SetNat switches the NAT traversal mechanism of the node to the one given in
+// the same format as the --nat flag (e.g. "any", "upnp", "pmp", "extip:<IP>" or
+// "none"), mapping the listening ports again. Without a mechanism, the ports
+// are mapped again with the current one.
+func (api *privateAdminAPI) SetNat(spec *string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if spec == nil {
+		if err := server.RemapNAT(); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	m, err := nat.Parse(*spec)
+	if err != nil {
+		return false, fmt.Errorf("invalid NAT mechanism: %v", err)
+	}
+	if err := server.SetNAT(m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *privateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
@@ -184,6 +212,9 @@ func (api *privateAdminAPI) StartRPC(host *string, port *int, cors *string, apis
 		CorsAllowedOrigins: api.node.config.HTTPCors,
 		Vhosts:             api.node.config.HTTPVirtualHosts,
 		Modules:            api.node.config.HTTPModules,
+		Coalesce:           api.node.config.RPCCoalesce,
+		Scheduler:          api.node.scheduler,
+		SlowThreshold:      api.node.config.RPCSlowThreshold,
 	}
 	if cors != nil {
 		config.CorsAllowedOrigins = nil
@@ -241,8 +272,12 @@ func (api *privateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 
 	// Determine config.
 	config := wsConfig{
-		Modules: api.node.config.WSModules,
-		Origins: api.node.config.WSOrigins,
+		Modules:       api.node.config.WSModules,
+		Origins:       api.node.config.WSOrigins,
+		Coalesce:      api.node.config.RPCCoalesce,
+		Subscriptions: api.node.subscriptions,
+		Scheduler:     api.node.scheduler,
+		SlowThreshold: api.node.config.RPCSlowThreshold,
 		// ExposeAll: api.node.config.WSExposeAll,
 	}
 	if apis != nil {
@@ -280,6 +315,27 @@ func (api *privateAdminAPI) StopWS() (bool, error) {
 	return true, nil
 }
 
+// Subscriptions returns the subscriptions of the websocket connections, the ones
+// with the most notifications waiting to be sent first.
+func (api *privateAdminAPI) Subscriptions() []rpc.SubscriptionInfo {
+	return api.node.subscriptions.Subscriptions()
+}
+
+// DropSubscription ends a subscription of a websocket connection, as if it was
+// unsubscribed.
+func (api *privateAdminAPI) DropSubscription(id rpc.ID) (bool, error) {
+	if !api.node.subscriptions.Drop(id) {
+		return false, rpc.ErrSubscriptionNotFound
+	}
+	return true, nil
+}
+
+// CallScheduling returns the state of the priority classes the HTTP and
+// websocket calls are scheduled into.
+func (api *privateAdminAPI) CallScheduling() []rpc.SchedulerStats {
+	return api.node.scheduler.Stats()
+}
+
 // publicAdminAPI is the collection of administrative API methods exposed over
 // both secure and unsecure RPC channels.
 type publicAdminAPI struct {
@@ -296,14 +352,52 @@ func (api *publicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
 	return server.PeersInfo(), nil
 }
 
+// NodeInfo is the information about the host node returned by admin_nodeInfo.
+type NodeInfo struct {
+	*p2p.NodeInfo
+	Signer *SignerInfo `json:"signer,omitempty"` // Health of the external signer, if any
+}
+
+// SignerInfo describes the health of the external signer the node delegates all
+// of its signing to.
+type SignerInfo struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+}
+
 // NodeInfo retrieves all the information we know about the host node at the
 // protocol granularity.
-func (api *publicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
+func (api *publicAdminAPI) NodeInfo() (*NodeInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	info := &NodeInfo{NodeInfo: server.NodeInfo()}
+	for _, backend := range api.node.AccountManager().Backends(external.ExternalBackendType) {
+		for _, wallet := range backend.Wallets() {
+			signer, ok := wallet.(*external.ExternalSigner)
+			if !ok {
+				continue
+			}
+			// Pinging reconnects to the signer if the connection was lost
+			version, err := signer.Ping()
+			status, _ := signer.Status()
+			info.Signer = &SignerInfo{URL: signer.URL().String(), Healthy: err == nil, Version: version, Status: status}
+		}
+	}
+	return info, nil
+}
+
+// NatStatus retrieves the state of the NAT traversal of the node: the mechanism
+// in use, the external IP it reported and the state of the port mappings.
+func (api *publicAdminAPI) NatStatus() (*p2p.NATInfo, error) {
 	server := api.node.Server()
 	if server == nil {
 		return nil, ErrNodeStopped
 	}
-	return server.NodeInfo(), nil
+	return server.NATInfo(), nil
 }
 
 // Datadir retrieves the current data directory the node is using.
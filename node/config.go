@@ -18,6 +18,7 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -25,12 +26,14 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/accounts/scwallet"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/accounts/vault"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -83,9 +86,40 @@ type Config struct {
 	// is created by New and destroyed when the node is stopped.
 	KeyStoreDir string `toml:",omitempty"`
 
+	// DatabaseDir is the file system folder containing the key-value stores of the
+	// node, allowing them to live on a different volume than the rest of DataDir.
+	// Relative paths are resolved relative to the current directory. If empty,
+	// the databases are kept in the instance directory within DataDir.
+	DatabaseDir string `toml:",omitempty"`
+
+	// PrimaryDataDir, if set, is the data directory of another node whose chain
+	// database is opened as a read-only secondary instance following the writes
+	// of that node, instead of the chain database of this node. The databases
+	// are looked up in the instance directory within PrimaryDataDir.
+	PrimaryDataDir string `toml:",omitempty"`
+
+	// SecondaryCatchup is the interval between two catch-ups of a secondary
+	// instance with the writes of the primary node. If zero, the instance catches
+	// up every rawdb.DefaultSecondaryCatchup.
+	SecondaryCatchup time.Duration `toml:",omitempty"`
+
+	// NodeKeyFile is the file storing the persistent private key of the node,
+	// generated on first use if missing. Relative paths are resolved relative to
+	// the current directory. If empty, the key is kept in the instance directory
+	// within DataDir.
+	NodeKeyFile string `toml:",omitempty"`
+
 	// ExternalSigner specifies an external URI for a clef-type signer
 	ExternalSigner string `toml:",omitempty"`
 
+	// KeyVaultFile is the path of an encrypted single-file key vault, whose accounts
+	// are made available in addition to the ones of the keystore directory.
+	KeyVaultFile string `toml:",omitempty"`
+
+	// HashicorpVault configures a HashiCorp Vault secret to load a signing key
+	// from, which is then only ever held in memory.
+	HashicorpVault *vault.HashicorpConfig `toml:",omitempty"`
+
 	// UseLightweightKDF lowers the memory and CPU requirements of the key store
 	// scrypt KDF at the expense of security.
 	UseLightweightKDF bool `toml:",omitempty"`
@@ -137,6 +171,23 @@ type Config struct {
 	// interface.
 	HTTPTimeouts rpc.HTTPTimeouts
 
+	// RPCDrainTimeout is the maximum time to wait on shutdown for the RPC calls in
+	// flight to complete, after the RPC endpoints stop taking new ones.
+	RPCDrainTimeout time.Duration `toml:",omitempty"`
+
+	// RPCCoalesce is a list of read-only RPC methods whose identical calls running
+	// at the same time on the HTTP or WebSocket endpoint are executed only once.
+	RPCCoalesce []string `toml:",omitempty"`
+
+	// RPCScheduler configures the priority classes the HTTP and WebSocket calls are
+	// scheduled into, head-state reads running on workers of their own apart from
+	// the archive ones.
+	RPCScheduler rpc.SchedulerConfig
+
+	// RPCSlowThreshold is the duration above which the served RPC calls are logged
+	// with their method and parameter count, never the parameter values (0 = disabled).
+	RPCSlowThreshold time.Duration `toml:",omitempty"`
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string
@@ -163,6 +214,14 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// WSMaxSubscriptions is the maximum number of subscriptions of a single
+	// websocket connection (0 = unlimited).
+	WSMaxSubscriptions int `toml:",omitempty"`
+
+	// WSMaxTotalSubscriptions is the maximum number of subscriptions of all the
+	// websocket connections together (0 = unlimited).
+	WSMaxTotalSubscriptions int `toml:",omitempty"`
+
 	// GraphQLCors is the Cross-Origin Resource Sharing header to send to requesting
 	// clients. Please be aware that CORS is a browser enforced security, it's fully
 	// useless for custom HTTP clients.
@@ -332,6 +391,97 @@ func (c *Config) ResolvePath(path string) string {
 	return filepath.Join(c.instanceDir(), path)
 }
 
+// ResolveDatabasePath returns the absolute path of a key-value store, located in
+// the database directory if configured, or in the instance directory otherwise.
+func (c *Config) ResolveDatabasePath(name string) string {
+	if filepath.IsAbs(name) || c.DatabaseDir == "" {
+		return c.ResolvePath(name)
+	}
+	if c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DatabaseDir, name)
+}
+
+// checkPaths makes the per-component paths of the data directory layout
+// absolute, so future changes to the current working directory don't affect
+// them, and ensures the directories they need exist and are writable.
+func (c *Config) checkPaths() error {
+	type component struct {
+		name    string
+		path    *string
+		dir     bool // Whether the path is a directory, or a file within one
+		datadir bool // Whether the component is only used by nodes with a data directory
+	}
+	components := []component{
+		{"database directory", &c.DatabaseDir, true, true},
+		{"keystore directory", &c.KeyStoreDir, true, false},
+		{"node key file", &c.NodeKeyFile, false, true},
+	}
+	for _, comp := range components {
+		if *comp.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*comp.path)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", comp.name, *comp.path, err)
+		}
+		*comp.path = abs
+		if c.DataDir == "" && comp.datadir {
+			c.Logger.Warn("Ignoring data directory layout on an ephemeral node", "component", comp.name, "path", abs)
+			continue
+		}
+		dir := abs
+		if !comp.dir {
+			dir = filepath.Dir(abs)
+		}
+		if err := checkWritableDir(dir); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", comp.name, abs, err)
+		}
+	}
+	if c.DatabaseDir != "" && c.DatabaseDir == c.KeyStoreDir {
+		return fmt.Errorf("database directory %q cannot also be the keystore directory", c.DatabaseDir)
+	}
+	if c.PrimaryDataDir != "" {
+		abs, err := filepath.Abs(c.PrimaryDataDir)
+		if err != nil {
+			return fmt.Errorf("invalid primary data directory %q: %v", c.PrimaryDataDir, err)
+		}
+		c.PrimaryDataDir = abs
+		if c.DataDir == "" {
+			return errors.New("secondary nodes need a data directory of their own")
+		}
+		if c.PrimaryDataDir == c.DataDir {
+			return fmt.Errorf("primary data directory %q cannot also be the data directory", c.PrimaryDataDir)
+		}
+	}
+	return nil
+}
+
+// ResolvePrimaryPath returns the absolute path of a resource in the instance
+// directory of the primary node, see PrimaryDataDir.
+func (c *Config) ResolvePrimaryPath(path string) string {
+	if filepath.IsAbs(path) || c.PrimaryDataDir == "" {
+		return path
+	}
+	primary := Config{Name: c.Name, DataDir: c.PrimaryDataDir}
+	return primary.ResolvePath(path)
+}
+
+// checkWritableDir creates a directory if missing and checks that files can be
+// created in it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".write-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 func (c *Config) instanceDir() string {
 	if c.DataDir == "" {
 		return ""
@@ -357,6 +507,9 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	}
 
 	keyfile := c.ResolvePath(datadirPrivateKey)
+	if c.NodeKeyFile != "" {
+		keyfile = c.NodeKeyFile
+	}
 	if key, err := crypto.LoadECDSA(keyfile); err == nil {
 		return key
 	}
@@ -365,12 +518,13 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	if err != nil {
 		log.Crit(fmt.Sprintf("Failed to generate node key: %v", err))
 	}
-	instanceDir := filepath.Join(c.DataDir, c.name())
-	if err := os.MkdirAll(instanceDir, 0700); err != nil {
+	if c.NodeKeyFile == "" {
+		keyfile = filepath.Join(c.DataDir, c.name(), datadirPrivateKey)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyfile), 0700); err != nil {
 		log.Error(fmt.Sprintf("Failed to persist node key: %v", err))
 		return key
 	}
-	keyfile = filepath.Join(instanceDir, datadirPrivateKey)
 	if err := crypto.SaveECDSA(keyfile, key); err != nil {
 		log.Error(fmt.Sprintf("Failed to persist node key: %v", err))
 	}
@@ -480,6 +634,21 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		// we can have both, but it's very confusing for the user to see the same
 		// accounts in both externally and locally, plus very racey.
 		backends = append(backends, keystore.NewKeyStore(keydir, scryptN, scryptP))
+		if conf.KeyVaultFile != "" {
+			v, err := vault.NewFileVault(conf.KeyVaultFile, scryptN, scryptP)
+			if err != nil {
+				return nil, "", fmt.Errorf("error opening key vault: %v", err)
+			}
+			backends = append(backends, v)
+		}
+		if conf.HashicorpVault != nil {
+			log.Info("Loading signing key from HashiCorp Vault", "address", conf.HashicorpVault.Address, "path", conf.HashicorpVault.Path)
+			hv, err := vault.NewHashicorpBackend(conf.HashicorpVault)
+			if err != nil {
+				return nil, "", fmt.Errorf("error loading key from HashiCorp Vault: %v", err)
+			}
+			backends = append(backends, hv)
+		}
 		if !conf.NoUSB {
 			// Start a USB hub for Ledger hardware wallets
 			if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
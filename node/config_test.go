@@ -160,3 +160,48 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that the key-value stores and the node key can be placed outside of the
+// data directory, and that the configured layout is validated.
+func TestDatadirLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		datadir = filepath.Join(dir, "data")
+		dbdir   = filepath.Join(dir, "fast", "db")
+		keyfile = filepath.Join(dir, "secrets", "nodekey")
+	)
+	config := &Config{Name: "unit-test", DataDir: datadir, DatabaseDir: dbdir, NodeKeyFile: keyfile}
+	if err := config.checkPaths(); err != nil {
+		t.Fatalf("failed to check layout: %v", err)
+	}
+	if _, err := os.Stat(dbdir); err != nil {
+		t.Fatalf("database directory not created: %v", err)
+	}
+	if path := config.ResolveDatabasePath("chaindata"); path != filepath.Join(dbdir, "chaindata") {
+		t.Errorf("database path mismatch: have %s, want %s", path, filepath.Join(dbdir, "chaindata"))
+	}
+	if path := config.ResolvePath("nodes"); path != filepath.Join(datadir, "unit-test", "nodes") {
+		t.Errorf("resource path mismatch: have %s, want %s", path, filepath.Join(datadir, "unit-test", "nodes"))
+	}
+	config.NodeKey()
+	if _, err := crypto.LoadECDSA(keyfile); err != nil {
+		t.Fatalf("node key not persisted to the configured file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(datadir, "unit-test", datadirPrivateKey)); err == nil {
+		t.Fatalf("node key persisted to data directory")
+	}
+	// The databases cannot share the keystore directory, nor live below a file
+	config = &Config{Name: "unit-test", DataDir: datadir, DatabaseDir: dbdir, KeyStoreDir: dbdir}
+	if err := config.checkPaths(); err == nil {
+		t.Errorf("database directory shared with the keystore accepted")
+	}
+	config = &Config{Name: "unit-test", DataDir: datadir, DatabaseDir: filepath.Join(keyfile, "db")}
+	if err := config.checkPaths(); err == nil {
+		t.Errorf("database directory below a file accepted")
+	}
+}
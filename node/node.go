@@ -17,6 +17,7 @@
 package node
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -25,8 +26,10 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -57,6 +60,9 @@ type Node struct {
 	ipc           *ipcServer  // Stores information about the ipc http server
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 
+	subscriptions *rpc.SubscriptionRegistry // Tracks and limits the websocket subscriptions
+	scheduler     *rpc.Scheduler            // Schedules the HTTP and websocket calls by priority class
+
 	databases map[*closeTrackingDB]struct{} // All open databases
 }
 
@@ -82,6 +88,9 @@ func New(conf *Config) (*Node, error) {
 	if conf.Logger == nil {
 		conf.Logger = log.New()
 	}
+	if err := conf.checkPaths(); err != nil {
+		return nil, err
+	}
 
 	// Ensure that the instance name doesn't cause weird conflicts with
 	// other files in the data directory.
@@ -98,6 +107,8 @@ func New(conf *Config) (*Node, error) {
 	node := &Node{
 		config:        conf,
 		inprocHandler: rpc.NewServer(),
+		subscriptions: rpc.NewSubscriptionRegistry(conf.WSMaxSubscriptions, conf.WSMaxTotalSubscriptions),
+		scheduler:     rpc.NewScheduler(conf.RPCScheduler),
 		eventmux:      new(event.TypeMux),
 		log:           conf.Logger,
 		stop:          make(chan struct{}),
@@ -105,6 +116,8 @@ func New(conf *Config) (*Node, error) {
 		databases:     make(map[*closeTrackingDB]struct{}),
 	}
 
+	node.inprocHandler.SetSlowCallThreshold(conf.RPCSlowThreshold)
+
 	// Register built-in APIs.
 	node.rpcAPIs = append(node.rpcAPIs, node.apis()...)
 
@@ -139,6 +152,7 @@ func New(conf *Config) (*Node, error) {
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
 	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
+	node.ipc.slowThreshold = conf.RPCSlowThreshold
 
 	return node, nil
 }
@@ -343,6 +357,9 @@ func (n *Node) startRPC() error {
 			CorsAllowedOrigins: n.config.HTTPCors,
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
+			Coalesce:           n.config.RPCCoalesce,
+			Scheduler:          n.scheduler,
+			SlowThreshold:      n.config.RPCSlowThreshold,
 		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
 			return err
@@ -356,8 +373,12 @@ func (n *Node) startRPC() error {
 	if n.config.WSHost != "" {
 		server := n.wsServerForPort(n.config.WSPort)
 		config := wsConfig{
-			Modules: n.config.WSModules,
-			Origins: n.config.WSOrigins,
+			Modules:       n.config.WSModules,
+			Origins:       n.config.WSOrigins,
+			Coalesce:      n.config.RPCCoalesce,
+			Subscriptions: n.subscriptions,
+			Scheduler:     n.scheduler,
+			SlowThreshold: n.config.RPCSlowThreshold,
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
@@ -381,12 +402,59 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 }
 
 func (n *Node) stopRPC() {
+	n.drainRPC()
 	n.http.stop()
 	n.ws.stop()
 	n.ipc.stop()
 	n.stopInProc()
 }
 
+// drainRPC stops all RPC endpoints from taking new calls and waits for the ones
+// in flight to complete, up to the configured drain timeout.
+func (n *Node) drainRPC() {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.RPCDrainTimeout)
+	defer cancel()
+
+	var (
+		start = time.Now()
+		errc  = make(chan error, 4)
+	)
+	go func() { errc <- n.http.drain(ctx) }()
+	go func() { errc <- n.ws.drain(ctx) }()
+	go func() { errc <- n.ipc.drain(ctx) }()
+	go func() { errc <- n.inprocHandler.Drain(ctx) }()
+
+	var failed bool
+	for i := 0; i < cap(errc); i++ {
+		if err := <-errc; err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		n.log.Warn("RPC calls still in flight, abandoning them", "timeout", n.config.RPCDrainTimeout)
+	} else {
+		n.log.Debug("RPC calls drained", "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+}
+
+// PauseRPC stops the HTTP and WebSocket endpoints from taking new calls for
+// maintenance, answering them with an error (a 503 status over HTTP), and waits
+// for the calls in flight to complete until the context is done. The IPC and
+// in-process endpoints keep taking calls, to administer the node meanwhile.
+func (n *Node) PauseRPC(ctx context.Context) error {
+	if err := n.http.pause(ctx); err != nil {
+		return err
+	}
+	return n.ws.pause(ctx)
+}
+
+// ResumeRPC lets the HTTP and WebSocket endpoints take new calls again after a
+// PauseRPC.
+func (n *Node) ResumeRPC() {
+	n.http.resume()
+	n.ws.resume()
+}
+
 // startInProc registers all RPC APIs on the inproc server.
 func (n *Node) startInProc() error {
 	for _, api := range n.rpcAPIs {
@@ -458,6 +526,20 @@ func (n *Node) RegisterHandler(name, path string, handler http.Handler) {
 	n.http.handlerNames[path] = name
 }
 
+// SetRPCHeadFunc sets the function returning the number of the chain head, from
+// which the depth of the blocks HTTP and websocket calls are made on is measured
+// to schedule them.
+func (n *Node) SetRPCHeadFunc(head func() uint64) {
+	n.scheduler.SetHeadFunc(head)
+}
+
+// SetRPCNumberFunc sets the function returning the number of a block by hash,
+// for the HTTP and websocket calls made on block hashes to be scheduled by the
+// depth of their blocks too.
+func (n *Node) SetRPCNumberFunc(number func(hash common.Hash) (uint64, bool)) {
+	n.scheduler.SetNumberFunc(number)
+}
+
 // Attach creates an RPC client attached to an in-process API handler.
 func (n *Node) Attach() (*rpc.Client, error) {
 	return rpc.DialInProc(n.inprocHandler), nil
@@ -544,7 +626,7 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace)
+		db, err = rawdb.NewLevelDBDatabase(n.ResolveDatabasePath(name), cache, handles, namespace)
 	}
 
 	if err == nil {
@@ -556,22 +638,26 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (
 // OpenDatabaseWithFreezerRemote opens an existing database with the given name (or
 // creates one if no previous can be found) from within the node's data directory,
 // also attaching a chain freezer to it that moves ancient chain data from the
-// database to immutable append-only files. If the node is an ephemeral one, a
-// memory database is returned.
-func (n *Node) OpenDatabaseWithFreezerRemote(name string, cache, handles int, freezerURL string) (ethdb.Database, error) {
+// database to a remote ancient store, as tuned by the given options (the defaults
+// if nil). If the node is an ephemeral one, a memory database is returned.
+func (n *Node) OpenDatabaseWithFreezerRemote(name string, cache, handles int, freezerURL string, options *rawdb.FreezerOptions) (ethdb.Database, error) {
 	if n.config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
-	root := n.config.ResolvePath(name)
-	return rawdb.NewLevelDBDatabaseWithFreezerRemote(root, cache, handles, freezerURL)
+	if n.config.PrimaryDataDir != "" {
+		return n.openSecondaryDatabase(name, cache, handles, "", freezerURL, "", options)
+	}
+	root := n.config.ResolveDatabasePath(name)
+	return rawdb.NewLevelDBDatabaseWithFreezerRemote(root, cache, handles, freezerURL, options)
 }
 
 // OpenDatabaseWithFreezer opens an existing database with the given name (or
 // creates one if no previous can be found) from within the node's data directory,
 // also attaching a chain freezer to it that moves ancient chain data from the
-// database to immutable append-only files. If the node is an ephemeral one, a
-// memory database is returned.
-func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string) (ethdb.Database, error) {
+// database to immutable append-only files, tuned by the given options (the
+// defaults if nil). If the node is an ephemeral one, a memory database is
+// returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string, options *rawdb.FreezerOptions) (ethdb.Database, error) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	if n.state == closedState {
@@ -580,17 +666,20 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 
 	var db ethdb.Database
 	var err error
-	if n.config.DataDir == "" {
+	switch {
+	case n.config.DataDir == "":
 		db = rawdb.NewMemoryDatabase()
-	} else {
-		root := n.ResolvePath(name)
+	case n.config.PrimaryDataDir != "":
+		db, err = n.openSecondaryDatabase(name, cache, handles, freezer, "", namespace, options)
+	default:
+		root := n.ResolveDatabasePath(name)
 		switch {
 		case freezer == "":
 			freezer = filepath.Join(root, "ancient")
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
+		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, options)
 	}
 
 	if err == nil {
@@ -599,11 +688,34 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 	return db, err
 }
 
+// openSecondaryDatabase opens the database with the given name of the primary
+// node read-only, along with its local freezer or the remote ancient store at
+// freezerURL. The key-value store is mirrored within the database directory of
+// this node, so it must be on the same file system as the primary one.
+func (n *Node) openSecondaryDatabase(name string, cache, handles int, freezer, freezerURL, namespace string, options *rawdb.FreezerOptions) (ethdb.Database, error) {
+	root := n.config.ResolvePrimaryPath(name)
+	if freezerURL == "" {
+		switch {
+		case freezer == "":
+			freezer = filepath.Join(root, "ancient")
+		case !filepath.IsAbs(freezer):
+			freezer = n.config.ResolvePrimaryPath(freezer)
+		}
+	}
+	mirror := n.ResolveDatabasePath(name + ".secondary")
+	return rawdb.NewLevelDBDatabaseSecondary(root, mirror, cache, handles, freezer, freezerURL, namespace, options, n.config.SecondaryCatchup)
+}
+
 // ResolvePath returns the absolute path of a resource in the instance directory.
 func (n *Node) ResolvePath(x string) string {
 	return n.config.ResolvePath(x)
 }
 
+// ResolveDatabasePath returns the absolute path of a key-value store of the node.
+func (n *Node) ResolveDatabasePath(name string) string {
+	return n.config.ResolveDatabasePath(name)
+}
+
 // closeTrackingDB wraps the Close method of a database. When the database is closed by the
 // service, the wrapper removes it from the node's database map. This ensures that Node
 // won't auto-close the database if it is closed by the service that opened it.
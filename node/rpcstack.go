@@ -28,6 +28,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -39,12 +40,19 @@ type httpConfig struct {
 	Modules            []string
 	CorsAllowedOrigins []string
 	Vhosts             []string
+	Coalesce           []string
+	Scheduler          *rpc.Scheduler
+	SlowThreshold      time.Duration
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
 type wsConfig struct {
-	Origins []string
-	Modules []string
+	Origins       []string
+	Modules       []string
+	Coalesce      []string
+	Subscriptions *rpc.SubscriptionRegistry
+	Scheduler     *rpc.Scheduler
+	SlowThreshold time.Duration
 }
 
 type rpcHandler struct {
@@ -199,6 +207,49 @@ func (h *httpServer) stop() {
 	h.doStop()
 }
 
+// drain stops the HTTP and WebSocket handlers from taking new calls, waiting for
+// the ones in flight until the context is done.
+func (h *httpServer) drain(ctx context.Context) error {
+	for _, srv := range h.rpcServers() {
+		if err := srv.Drain(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpcServers returns the RPC servers of the running HTTP and WebSocket handlers.
+func (h *httpServer) rpcServers() []*rpc.Server {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var servers []*rpc.Server
+	for _, handler := range []*rpcHandler{h.httpHandler.Load().(*rpcHandler), h.wsHandler.Load().(*rpcHandler)} {
+		if handler != nil {
+			servers = append(servers, handler.server)
+		}
+	}
+	return servers
+}
+
+// pause stops the HTTP and WebSocket handlers from taking new calls for
+// maintenance, waiting for the ones in flight until the context is done.
+func (h *httpServer) pause(ctx context.Context) error {
+	for _, srv := range h.rpcServers() {
+		if err := srv.Pause(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resume lets the HTTP and WebSocket handlers take new calls again.
+func (h *httpServer) resume() {
+	for _, srv := range h.rpcServers() {
+		srv.Resume()
+	}
+}
+
 func (h *httpServer) doStop() {
 	if h.listener == nil {
 		return // not running
@@ -206,7 +257,7 @@ func (h *httpServer) doStop() {
 
 	// Shut down the server.
 	httpHandler := h.httpHandler.Load().(*rpcHandler)
-	wsHandler := h.httpHandler.Load().(*rpcHandler)
+	wsHandler := h.wsHandler.Load().(*rpcHandler)
 	if httpHandler != nil {
 		h.httpHandler.Store((*rpcHandler)(nil))
 		httpHandler.server.Stop()
@@ -238,6 +289,9 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 	if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	srv.SetCoalescedMethods(config.Coalesce)
+	srv.SetScheduler(config.Scheduler)
+	srv.SetSlowCallThreshold(config.SlowThreshold)
 	h.httpConfig = config
 	h.httpHandler.Store(&rpcHandler{
 		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
@@ -270,6 +324,10 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 	if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	srv.SetCoalescedMethods(config.Coalesce)
+	srv.SetSubscriptionRegistry(config.Subscriptions)
+	srv.SetScheduler(config.Scheduler)
+	srv.SetSlowCallThreshold(config.SlowThreshold)
 	h.wsConfig = config
 	h.wsHandler.Store(&rpcHandler{
 		Handler: srv.WebsocketHandler(config.Origins),
@@ -426,8 +484,9 @@ func newGzipHandler(next http.Handler) http.Handler {
 }
 
 type ipcServer struct {
-	log      log.Logger
-	endpoint string
+	log           log.Logger
+	endpoint      string
+	slowThreshold time.Duration
 
 	mu       sync.Mutex
 	listener net.Listener
@@ -450,11 +509,25 @@ func (is *ipcServer) start(apis []rpc.API) error {
 	if err != nil {
 		return err
 	}
+	srv.SetSlowCallThreshold(is.slowThreshold)
 	is.log.Info("IPC endpoint opened", "url", is.endpoint)
 	is.listener, is.srv = listener, srv
 	return nil
 }
 
+// drain stops the IPC endpoint from taking new calls, waiting for the ones in
+// flight until the context is done.
+func (is *ipcServer) drain(ctx context.Context) error {
+	is.mu.Lock()
+	srv := is.srv
+	is.mu.Unlock()
+
+	if srv == nil {
+		return nil // not running
+	}
+	return srv.Drain(ctx)
+}
+
 func (is *ipcServer) stop() error {
 	is.mu.Lock()
 	defer is.mu.Unlock()
@@ -26,7 +26,6 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/event"
-	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -257,22 +256,24 @@ type msgEventer struct {
 	MsgReadWriter
 
 	feed          *event.Feed
-	peerID        enode.ID
+	peer          *Peer
 	Protocol      string
+	msgName       func(code uint64) string
 	localAddress  string
 	remoteAddress string
 }
 
-// newMsgEventer returns a msgEventer which sends message events to the given
-// feed
-func newMsgEventer(rw MsgReadWriter, feed *event.Feed, peerID enode.ID, proto, remote, local string) *msgEventer {
+// newMsgEventer returns a msgEventer which sends message events of a protocol
+// running on the given peer to the given feed
+func newMsgEventer(rw MsgReadWriter, feed *event.Feed, peer *Peer, proto Protocol) *msgEventer {
 	return &msgEventer{
 		MsgReadWriter: rw,
 		feed:          feed,
-		peerID:        peerID,
-		Protocol:      proto,
-		remoteAddress: remote,
-		localAddress:  local,
+		peer:          peer,
+		Protocol:      proto.Name,
+		msgName:       proto.MessageName,
+		remoteAddress: peer.RemoteAddr().String(),
+		localAddress:  peer.LocalAddr().String(),
 	}
 }
 
@@ -283,15 +284,7 @@ func (ev *msgEventer) ReadMsg() (Msg, error) {
 	if err != nil {
 		return msg, err
 	}
-	ev.feed.Send(&PeerEvent{
-		Type:          PeerEventTypeMsgRecv,
-		Peer:          ev.peerID,
-		Protocol:      ev.Protocol,
-		MsgCode:       &msg.Code,
-		MsgSize:       &msg.Size,
-		LocalAddress:  ev.localAddress,
-		RemoteAddress: ev.remoteAddress,
-	})
+	ev.feed.Send(ev.event(PeerEventTypeMsgRecv, msg))
 	return msg, nil
 }
 
@@ -302,16 +295,26 @@ func (ev *msgEventer) WriteMsg(msg Msg) error {
 	if err != nil {
 		return err
 	}
-	ev.feed.Send(&PeerEvent{
-		Type:          PeerEventTypeMsgSend,
-		Peer:          ev.peerID,
+	ev.feed.Send(ev.event(PeerEventTypeMsgSend, msg))
+	return nil
+}
+
+// event creates a message event of the given type.
+func (ev *msgEventer) event(typ PeerEventType, msg Msg) *PeerEvent {
+	event := &PeerEvent{
+		Type:          typ,
+		Peer:          ev.peer.ID(),
 		Protocol:      ev.Protocol,
 		MsgCode:       &msg.Code,
 		MsgSize:       &msg.Size,
+		Traffic:       ev.peer.Traffic(),
 		LocalAddress:  ev.localAddress,
 		RemoteAddress: ev.remoteAddress,
-	})
-	return nil
+	}
+	if ev.msgName != nil {
+		event.MsgName = ev.msgName(msg.Code)
+	}
+	return event
 }
 
 // Close closes the underlying MsgReadWriter if it implements the io.Closer
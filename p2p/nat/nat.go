@@ -97,6 +97,12 @@ const (
 // Map adds a port mapping on m and keeps it alive until c is closed.
 // This function is typically invoked in its own goroutine.
 func Map(m Interface, c <-chan struct{}, protocol string, extport, intport int, name string) {
+	MapNotify(m, c, protocol, extport, intport, name, nil)
+}
+
+// MapNotify is like Map, but also invokes notify, if non-nil, with the outcome
+// of every attempt to add or renew the mapping.
+func MapNotify(m Interface, c <-chan struct{}, protocol string, extport, intport int, name string, notify func(err error)) {
 	log := log.New("proto", protocol, "extport", extport, "intport", intport, "interface", m)
 	refresh := time.NewTimer(mapTimeout)
 	defer func() {
@@ -104,11 +110,15 @@ func Map(m Interface, c <-chan struct{}, protocol string, extport, intport int,
 		log.Debug("Deleting port mapping")
 		m.DeleteMapping(protocol, extport, intport)
 	}()
-	if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
+	err := m.AddMapping(protocol, extport, intport, name, mapTimeout)
+	if err != nil {
 		log.Debug("Couldn't add port mapping", "err", err)
 	} else {
 		log.Info("Mapped network port")
 	}
+	if notify != nil {
+		notify(err)
+	}
 	for {
 		select {
 		case _, ok := <-c:
@@ -117,9 +127,13 @@ func Map(m Interface, c <-chan struct{}, protocol string, extport, intport int,
 			}
 		case <-refresh.C:
 			log.Trace("Refreshing port mapping")
-			if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
+			err := m.AddMapping(protocol, extport, intport, name, mapTimeout)
+			if err != nil {
 				log.Debug("Couldn't add port mapping", "err", err)
 			}
+			if notify != nil {
+				notify(err)
+			}
 			refresh.Reset(mapTimeout)
 		}
 	}
@@ -0,0 +1,238 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ntp monitors the drift of the system clock against NTP servers, via
+// the SNTP protocol: https://tools.ietf.org/html/rfc4330
+package ntp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	measurements = 3               // Number of measurements to do against an NTP server
+	queryTimeout = 5 * time.Second // Timeout of a single measurement
+
+	DefaultInterval  = 10 * time.Minute // Default time between measurements
+	DefaultThreshold = 10 * time.Second // Default drift above which the clock is skewed
+)
+
+// driftGauge is the last measured drift of the system clock, in microseconds.
+var driftGauge = metrics.NewRegisteredGauge("p2p/ntp/drift", nil)
+
+// Config are the settings of the clock drift monitoring.
+type Config struct {
+	Servers   []string      // NTP servers to measure the drift against, in order of preference
+	Interval  time.Duration // Time between measurements
+	Threshold time.Duration // Drift above which the clock is considered skewed
+}
+
+// Status is the result of the last clock drift measurement.
+type Status struct {
+	Server    string    `json:"server,omitempty"` // NTP server the drift was measured against
+	Drift     float64   `json:"drift"`            // Seconds the system clock is ahead of the server
+	Threshold float64   `json:"threshold"`        // Seconds of drift above which the clock is skewed
+	Skewed    bool      `json:"skewed"`           // Whether the drift exceeds the threshold
+	Checked   time.Time `json:"checked"`          // Time of the last measurement attempt
+	Error     string    `json:"error,omitempty"`  // Error of the last measurement attempt, if all servers failed
+}
+
+// Monitor periodically measures the drift of the system clock.
+type Monitor struct {
+	config Config
+	query  func(server string) (time.Duration, error)
+
+	status Status
+	drift  time.Duration
+	lock   sync.RWMutex
+}
+
+// NewMonitor creates a clock drift monitor with the given settings, using the
+// defaults for any unset interval or threshold.
+func NewMonitor(config Config) *Monitor {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultThreshold
+	}
+	return &Monitor{
+		config: config,
+		query: func(server string) (time.Duration, error) {
+			return Drift(server, measurements)
+		},
+		status: Status{Threshold: config.Threshold.Seconds()},
+	}
+}
+
+// Run measures the drift right away and then periodically, until quit is closed.
+func (m *Monitor) Run(quit <-chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			m.check()
+			timer.Reset(m.config.Interval)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// check measures the drift against the first responsive server.
+func (m *Monitor) check() {
+	var (
+		drift  time.Duration
+		server string
+		err    = errors.New("no NTP servers configured")
+	)
+	for _, server = range m.config.Servers {
+		if drift, err = m.query(server); err == nil {
+			break
+		}
+		log.Debug("Failed to measure clock drift", "server", server, "err", err)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.status.Checked = time.Now()
+	if err != nil {
+		// Keep reporting the last drift measured, the clock doesn't get fixed by NTP going dark
+		m.status.Error = err.Error()
+		return
+	}
+	m.drift = drift
+	m.status.Server, m.status.Drift, m.status.Error = server, drift.Seconds(), ""
+	m.status.Skewed = drift < -m.config.Threshold || drift > m.config.Threshold
+	driftGauge.Update(drift.Microseconds())
+
+	if m.status.Skewed {
+		log.Warn(fmt.Sprintf("System clock seems off by %v, which can prevent network connectivity and get mined blocks rejected", drift), "server", server)
+		log.Warn("Please enable network time synchronisation in system settings.")
+	} else {
+		log.Debug("Clock drift measured", "server", server, "drift", drift)
+	}
+}
+
+// Status returns the result of the last drift measurement.
+func (m *Monitor) Status() *Status {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	status := m.status
+	return &status
+}
+
+// Check returns an error if the last measured drift exceeds the threshold.
+func (m *Monitor) Check() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.status.Skewed {
+		return fmt.Errorf("system clock off by %v, more than %v", m.drift, m.config.Threshold)
+	}
+	return nil
+}
+
+// durationSlice attaches the methods of sort.Interface to []time.Duration,
+// sorting in increasing order.
+type durationSlice []time.Duration
+
+func (s durationSlice) Len() int           { return len(s) }
+func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Drift does a naive time resolution against an NTP server and returns the
+// measured drift of the system clock, positive if it is ahead of the server.
+// The server defaults to port 123 if none is given.
+//
+// Note, it executes two extra measurements compared to the number of requested
+// ones to be able to discard the two extremes as outliers.
+func Drift(server string, measurements int) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	addr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return 0, err
+	}
+	// Construct the time request (empty package with only 2 fields set):
+	//   Bits 3-5: Protocol version, 3
+	//   Bits 6-8: Mode of operation, client, 3
+	request := make([]byte, 48)
+	request[0] = 3<<3 | 3
+
+	// Execute each of the measurements
+	drifts := []time.Duration{}
+	for i := 0; i < measurements+2; i++ {
+		drift, err := measure(addr, request)
+		if err != nil {
+			return 0, err
+		}
+		drifts = append(drifts, drift)
+	}
+	// Calculate average drift (drop two extremities to avoid outliers)
+	sort.Sort(durationSlice(drifts))
+
+	drift := time.Duration(0)
+	for i := 1; i < len(drifts)-1; i++ {
+		drift += drifts[i]
+	}
+	return drift / time.Duration(measurements), nil
+}
+
+// measure executes a single time request against an NTP server.
+func measure(addr *net.UDPAddr, request []byte) (time.Duration, error) {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	sent := time.Now()
+	if _, err = conn.Write(request); err != nil {
+		return 0, err
+	}
+	// Retrieve the reply and calculate the elapsed time
+	conn.SetDeadline(time.Now().Add(queryTimeout))
+
+	reply := make([]byte, 48)
+	if _, err = conn.Read(reply); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(sent)
+
+	// Reconstruct the time from the reply data
+	sec := uint64(reply[43]) | uint64(reply[42])<<8 | uint64(reply[41])<<16 | uint64(reply[40])<<24
+	frac := uint64(reply[47]) | uint64(reply[46])<<8 | uint64(reply[45])<<16 | uint64(reply[44])<<24
+
+	nanosec := sec*1e9 + (frac*1e9)>>32
+
+	t := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(nanosec)).Local()
+
+	// Calculate the drift based on an assumed answer time of RRT/2
+	return sent.Sub(t) + elapsed/2, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveNTP runs a fake NTP server replying with the local time shifted by the
+// given offset, until the returned connection is closed.
+func serveNTP(t *testing.T, offset time.Duration) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			since := time.Now().Add(offset).Sub(time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC))
+			reply := make([]byte, 48)
+			binary.BigEndian.PutUint32(reply[40:], uint32(since/time.Second))
+			binary.BigEndian.PutUint32(reply[44:], uint32((uint64(since%time.Second)<<32)/1e9))
+			conn.WriteToUDP(reply, addr)
+		}
+	}()
+	return conn
+}
+
+func TestDrift(t *testing.T) {
+	server := serveNTP(t, time.Hour)
+	defer server.Close()
+
+	drift, err := Drift(server.LocalAddr().String(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift > -time.Hour+time.Second || drift < -time.Hour-time.Second {
+		t.Errorf("drift mismatch: have %v, want about %v", drift, -time.Hour)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	drifts := map[string]time.Duration{"ok": time.Second, "skewed": time.Minute}
+	m := NewMonitor(Config{Servers: []string{"down", "ok"}})
+	m.query = func(server string) (time.Duration, error) {
+		if drift, ok := drifts[server]; ok {
+			return drift, nil
+		}
+		return 0, errors.New("unreachable")
+	}
+	// The first responsive server is measured against
+	m.check()
+	if status := m.Status(); status.Server != "ok" || status.Drift != 1 || status.Skewed || status.Error != "" {
+		t.Errorf("status mismatch: %+v", status)
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("clock reported skewed: %v", err)
+	}
+	// A drift above the threshold is reported
+	m.config.Servers = []string{"skewed"}
+	m.check()
+	if status := m.Status(); !status.Skewed || status.Threshold != DefaultThreshold.Seconds() {
+		t.Errorf("status mismatch: %+v", status)
+	}
+	if err := m.Check(); err == nil {
+		t.Error("clock not reported skewed")
+	}
+	// The last drift is kept if no server responds
+	m.config.Servers = []string{"down"}
+	m.check()
+	if status := m.Status(); !status.Skewed || status.Error == "" || status.Drift != 60 {
+		t.Errorf("status mismatch: %+v", status)
+	}
+}
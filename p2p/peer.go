@@ -23,6 +23,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/mclock"
@@ -87,19 +88,56 @@ const (
 	// PeerEventTypeMsgRecv is the type of event emitted when a
 	// message is received from a peer
 	PeerEventTypeMsgRecv PeerEventType = "msgrecv"
+
+	// PeerEventTypeHandshake is the type of event emitted when a
+	// subprotocol completes or fails its handshake with a peer
+	PeerEventTypeHandshake PeerEventType = "handshake"
 )
 
 // PeerEvent is an event emitted when peers are either added or dropped from
 // a p2p.Server or when a message is sent or received on a peer connection
 type PeerEvent struct {
-	Type          PeerEventType `json:"type"`
-	Peer          enode.ID      `json:"peer"`
-	Error         string        `json:"error,omitempty"`
-	Protocol      string        `json:"protocol,omitempty"`
-	MsgCode       *uint64       `json:"msg_code,omitempty"`
-	MsgSize       *uint32       `json:"msg_size,omitempty"`
-	LocalAddress  string        `json:"local,omitempty"`
-	RemoteAddress string        `json:"remote,omitempty"`
+	Type            PeerEventType `json:"type"`
+	Peer            enode.ID      `json:"peer"`
+	Error           string        `json:"error,omitempty"`
+	Reason          string        `json:"reason,omitempty"`           // Disconnect reason of drop events
+	RemoteRequested bool          `json:"remote_requested,omitempty"` // Whether the peer requested the disconnect
+	Protocol        string        `json:"protocol,omitempty"`
+	MsgCode         *uint64       `json:"msg_code,omitempty"`
+	MsgSize         *uint32       `json:"msg_size,omitempty"`
+	MsgName         string        `json:"msg_name,omitempty"`  // Message name, if provided by the protocol
+	Handshake       interface{}   `json:"handshake,omitempty"` // Protocol specific handshake details
+	Traffic         *PeerTraffic  `json:"traffic,omitempty"`   // Subprotocol traffic of the peer so far
+	LocalAddress    string        `json:"local,omitempty"`
+	RemoteAddress   string        `json:"remote,omitempty"`
+}
+
+// PeerTraffic is a summary of the subprotocol messages exchanged with a peer
+// since it connected.
+type PeerTraffic struct {
+	Duration     float64 `json:"duration"` // Seconds since the peer connected
+	IngressMsgs  uint64  `json:"ingress_msgs"`
+	IngressBytes uint64  `json:"ingress_bytes"`
+	IngressRate  float64 `json:"ingress_rate"` // Average bytes per second received
+	EgressMsgs   uint64  `json:"egress_msgs"`
+	EgressBytes  uint64  `json:"egress_bytes"`
+	EgressRate   float64 `json:"egress_rate"` // Average bytes per second sent
+}
+
+// peerTraffic counts the subprotocol messages exchanged with a peer.
+type peerTraffic struct {
+	ingressMsgs, ingressBytes uint64 // Accessed atomically
+	egressMsgs, egressBytes   uint64 // Accessed atomically
+}
+
+func (t *peerTraffic) ingress(size uint32) {
+	atomic.AddUint64(&t.ingressMsgs, 1)
+	atomic.AddUint64(&t.ingressBytes, uint64(size))
+}
+
+func (t *peerTraffic) egress(size uint32) {
+	atomic.AddUint64(&t.egressMsgs, 1)
+	atomic.AddUint64(&t.egressBytes, uint64(size))
 }
 
 // Peer represents a connected remote node.
@@ -116,6 +154,12 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// feed receives subprotocol handshake events if set
+	feed *event.Feed
+
+	traffic peerTraffic
+	reason  DiscReason // Reason of the disconnect, set when run returns
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -179,6 +223,44 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
+// Traffic returns a summary of the subprotocol messages exchanged with the peer
+// since it connected.
+func (p *Peer) Traffic() *PeerTraffic {
+	t := &PeerTraffic{
+		Duration:     time.Duration(mclock.Now() - p.created).Seconds(),
+		IngressMsgs:  atomic.LoadUint64(&p.traffic.ingressMsgs),
+		IngressBytes: atomic.LoadUint64(&p.traffic.ingressBytes),
+		EgressMsgs:   atomic.LoadUint64(&p.traffic.egressMsgs),
+		EgressBytes:  atomic.LoadUint64(&p.traffic.egressBytes),
+	}
+	if t.Duration > 0 {
+		t.IngressRate = float64(t.IngressBytes) / t.Duration
+		t.EgressRate = float64(t.EgressBytes) / t.Duration
+	}
+	return t
+}
+
+// NotifyHandshake announces the outcome of the handshake of a subprotocol with
+// the peer to the subscribers of the server's peer events. The info is protocol
+// specific, holding the details the peer announced during the handshake.
+func (p *Peer) NotifyHandshake(protocol string, info interface{}, err error) {
+	if p.feed == nil {
+		return
+	}
+	ev := &PeerEvent{
+		Type:          PeerEventTypeHandshake,
+		Peer:          p.ID(),
+		Protocol:      protocol,
+		Handshake:     info,
+		LocalAddress:  p.LocalAddr().String(),
+		RemoteAddress: p.RemoteAddr().String(),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	p.feed.Send(ev)
+}
+
 func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
@@ -244,6 +326,7 @@ loop:
 	close(p.closed)
 	p.rw.close(reason)
 	p.wg.Wait()
+	p.reason = reason
 	return remoteRequested, err
 }
 
@@ -301,6 +384,7 @@ func (p *Peer) handle(msg Msg) error {
 		if err != nil {
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		p.traffic.ingress(msg.Size)
 		if metrics.Enabled {
 			m := fmt.Sprintf("%s/%s/%d/%#02x", ingressMeterName, proto.Name, proto.Version, msg.Code-proto.offset)
 			metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
@@ -360,9 +444,10 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = &p.traffic
 		var rw MsgReadWriter = proto
 		if p.events != nil {
-			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
+			rw = newMsgEventer(rw, p.events, p, proto.Protocol)
 		}
 		p.log.Trace(fmt.Sprintf("Starting protocol %s/%d", proto.Name, proto.Version))
 		go func() {
@@ -398,6 +483,8 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *peerTraffic // counts the messages written
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -412,6 +499,9 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil && rw.traffic != nil {
+			rw.traffic.egress(msg.Size)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -28,6 +28,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/enr"
@@ -351,3 +352,95 @@ func TestMatchProtocols(t *testing.T) {
 		}
 	}
 }
+
+func TestPeerEvents(t *testing.T) {
+	proto := Protocol{
+		Name:   "a",
+		Length: 5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			peer.NotifyHandshake("a", "ok", nil)
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 3, uint(2)); err != nil {
+				t.Error(err)
+			}
+			return DiscUselessPeer
+		},
+		MessageName: func(code uint64) string {
+			return fmt.Sprintf("msg%d", code)
+		},
+	}
+	fd1, fd2 := net.Pipe()
+	c1 := &conn{fd: fd1, node: newNode(randomID(), ""), transport: newTestTransport(&newkey().PublicKey, fd1), caps: []Cap{proto.cap()}}
+	c2 := &conn{fd: fd2, node: newNode(randomID(), ""), transport: newTestTransport(&newkey().PublicKey, fd2), caps: []Cap{proto.cap()}}
+	defer c2.close(errors.New("test done"))
+
+	var feed event.Feed
+	events := make(chan *PeerEvent, 10)
+	sub := feed.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	peer := newPeer(log.Root(), c1, []Protocol{proto})
+	peer.feed, peer.events = &feed, &feed
+	errc := make(chan error, 1)
+	go func() {
+		_, err := peer.run()
+		errc <- err
+	}()
+	Send(c2, baseProtocolLength+2, []uint{1})
+	if err := ExpectMsg(c2, baseProtocolLength+3, []uint{2}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != DiscUselessPeer {
+			t.Fatalf("peer returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("peer didn't quit")
+	}
+	if peer.reason != DiscUselessPeer {
+		t.Errorf("disconnect reason mismatch: have %v, want %v", peer.reason, DiscUselessPeer)
+	}
+	var want = []struct {
+		typ     PeerEventType
+		name    string
+		ingress uint64
+		egress  uint64
+	}{
+		{PeerEventTypeHandshake, "", 0, 0},
+		{PeerEventTypeMsgRecv, "msg2", 1, 0},
+		{PeerEventTypeMsgSend, "msg3", 1, 1},
+	}
+	for i, w := range want {
+		ev := <-events
+		if ev.Type != w.typ || ev.Protocol != "a" {
+			t.Fatalf("event %d: type mismatch: have %s/%s, want %s/a", i, ev.Type, ev.Protocol, w.typ)
+		}
+		if w.typ == PeerEventTypeHandshake {
+			if ev.Handshake != "ok" {
+				t.Errorf("event %d: handshake info mismatch: have %v, want ok", i, ev.Handshake)
+			}
+			continue
+		}
+		if ev.MsgName != w.name {
+			t.Errorf("event %d: message name mismatch: have %q, want %q", i, ev.MsgName, w.name)
+		}
+		if ev.Traffic.IngressMsgs != w.ingress || ev.Traffic.EgressMsgs != w.egress {
+			t.Errorf("event %d: traffic mismatch: have %d/%d msgs, want %d/%d", i, ev.Traffic.IngressMsgs, ev.Traffic.EgressMsgs, w.ingress, w.egress)
+		}
+	}
+	if traffic := peer.Traffic(); traffic.IngressBytes == 0 || traffic.EgressBytes == 0 {
+		t.Errorf("traffic bytes not counted: %+v", traffic)
+	}
+}
+
+func TestDiscReasonString(t *testing.T) {
+	if s := DiscReason(len(discReasonToString)).String(); !strings.HasPrefix(s, "unknown disconnect reason") {
+		t.Errorf("out of range reason: have %q", s)
+	}
+	if s := DiscTooManyPeers.String(); s != "too many peers" {
+		t.Errorf("reason mismatch: have %q, want %q", s, "too many peers")
+	}
+}
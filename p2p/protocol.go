@@ -54,6 +54,10 @@ type Protocol struct {
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id enode.ID) interface{}
 
+	// MessageName is an optional helper method to retrieve the human readable name
+	// of a message code, reported in the message events of the server.
+	MessageName func(code uint64) string
+
 	// DialCandidates, if non-nil, is a way to tell Server about protocol-specific nodes
 	// that should be dialed. The server continuously reads nodes from the iterator and
 	// attempts to create connections to them.
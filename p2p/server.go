@@ -40,6 +40,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/p2p/ntp"
 )
 
 const (
@@ -156,6 +157,16 @@ type Config struct {
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
+	// NTPServers are the NTP servers to monitor the drift of the system clock
+	// against, in order of preference. Monitoring is disabled if empty.
+	NTPServers []string `toml:",omitempty"`
+
+	// NTPInterval is the time between clock drift measurements.
+	NTPInterval time.Duration `toml:",omitempty"`
+
+	// NTPThreshold is the clock drift above which warnings are logged.
+	NTPThreshold time.Duration `toml:",omitempty"`
+
 	clock mclock.Clock
 }
 
@@ -178,6 +189,7 @@ type Server struct {
 	loopWG       sync.WaitGroup // loop, listenLoop
 	peerFeed     event.Feed
 	log          log.Logger
+	ntp          *ntp.Monitor // Clock drift monitor, nil if disabled
 
 	nodedb    *enode.DB
 	localnode *enode.LocalNode
@@ -185,6 +197,7 @@ type Server struct {
 	DiscV5    *discv5.Network
 	discmix   *enode.FairMix
 	dialsched *dialScheduler
+	nat       natState
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -483,12 +496,53 @@ func (srv *Server) Start() (err error) {
 		return err
 	}
 	srv.setupDialScheduler()
+	srv.setupNTP()
 
 	srv.loopWG.Add(1)
 	go srv.run()
 	return nil
 }
 
+// setupNTP starts monitoring the clock drift if NTP servers are configured.
+func (srv *Server) setupNTP() {
+	srv.ntp = nil
+	if len(srv.NTPServers) == 0 {
+		return
+	}
+	srv.ntp = ntp.NewMonitor(ntp.Config{Servers: srv.NTPServers, Interval: srv.NTPInterval, Threshold: srv.NTPThreshold})
+	srv.loopWG.Add(1)
+	go func() {
+		defer srv.loopWG.Done()
+		srv.ntp.Run(srv.quit)
+	}()
+}
+
+// ClockStatus returns the result of the last clock drift measurement, or nil if
+// the clock drift isn't monitored.
+func (srv *Server) ClockStatus() *ntp.Status {
+	srv.lock.Lock()
+	monitor := srv.ntp
+	srv.lock.Unlock()
+
+	if monitor == nil {
+		return nil
+	}
+	return monitor.Status()
+}
+
+// CheckClock returns an error if the last measured clock drift exceeds the
+// threshold. It returns nil if the clock drift isn't monitored.
+func (srv *Server) CheckClock() error {
+	srv.lock.Lock()
+	monitor := srv.ntp
+	srv.lock.Unlock()
+
+	if monitor == nil {
+		return nil
+	}
+	return monitor.Check()
+}
+
 func (srv *Server) setupLocalNode() error {
 	// Create the devp2p handshake.
 	pubkey := crypto.FromECDSAPub(&srv.PrivateKey.PublicKey)
@@ -512,24 +566,7 @@ func (srv *Server) setupLocalNode() error {
 			srv.localnode.Set(e)
 		}
 	}
-	switch srv.NAT.(type) {
-	case nil:
-		// No NAT interface, do nothing.
-	case nat.ExtIP:
-		// ExtIP doesn't block, set the IP right away.
-		ip, _ := srv.NAT.ExternalIP()
-		srv.localnode.SetStaticIP(ip)
-	default:
-		// Ask the router about the IP. This takes a while and blocks startup,
-		// do it in the background.
-		srv.loopWG.Add(1)
-		go func() {
-			defer srv.loopWG.Done()
-			if ip, err := srv.NAT.ExternalIP(); err == nil {
-				srv.localnode.SetStaticIP(ip)
-			}
-		}()
-	}
+	srv.setupNAT()
 	return nil
 }
 
@@ -560,14 +597,8 @@ func (srv *Server) setupDiscovery() error {
 	}
 	realaddr := conn.LocalAddr().(*net.UDPAddr)
 	srv.log.Debug("UDP listener up", "addr", realaddr)
-	if srv.NAT != nil {
-		if !realaddr.IP.IsLoopback() {
-			srv.loopWG.Add(1)
-			go func() {
-				nat.Map(srv.NAT, srv.quit, "udp", realaddr.Port, realaddr.Port, "ethereum discovery")
-				srv.loopWG.Done()
-			}()
-		}
+	if !realaddr.IP.IsLoopback() {
+		srv.mapPort("udp", realaddr.Port, "ethereum discovery")
 	}
 	srv.localnode.SetFallbackUDP(realaddr.Port)
 
@@ -667,12 +698,8 @@ func (srv *Server) setupListening() error {
 	// Update the local node record and map the TCP listening port if NAT is configured.
 	if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
 		srv.localnode.Set(enr.TCP(tcp.Port))
-		if !tcp.IP.IsLoopback() && srv.NAT != nil {
-			srv.loopWG.Add(1)
-			go func() {
-				nat.Map(srv.NAT, srv.quit, "tcp", tcp.Port, tcp.Port, "ethereum p2p")
-				srv.loopWG.Done()
-			}()
+		if !tcp.IP.IsLoopback() {
+			srv.mapPort("tcp", tcp.Port, "ethereum p2p")
 		}
 	}
 
@@ -1014,6 +1041,7 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 
 func (srv *Server) launchPeer(c *conn) *Peer {
 	p := newPeer(srv.log, c, srv.Protocols)
+	p.feed = &srv.peerFeed
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
@@ -1048,11 +1076,14 @@ func (srv *Server) runPeer(p *Peer) {
 	// the peer set (i.e. Server.Peers() doesn't include the peer when the
 	// event is received.
 	srv.peerFeed.Send(&PeerEvent{
-		Type:          PeerEventTypeDrop,
-		Peer:          p.ID(),
-		Error:         err.Error(),
-		RemoteAddress: p.RemoteAddr().String(),
-		LocalAddress:  p.LocalAddr().String(),
+		Type:            PeerEventTypeDrop,
+		Peer:            p.ID(),
+		Error:           err.Error(),
+		Reason:          p.reason.String(),
+		RemoteRequested: remoteRequested,
+		Traffic:         p.Traffic(),
+		RemoteAddress:   p.RemoteAddr().String(),
+		LocalAddress:    p.LocalAddr().String(),
 	})
 }
 
@@ -1069,6 +1100,7 @@ type NodeInfo struct {
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
 	Protocols  map[string]interface{} `json:"protocols"`
+	Clock      *ntp.Status            `json:"clock,omitempty"` // Clock drift, if monitored
 }
 
 // NodeInfo gathers and returns a collection of metadata known about the host.
@@ -1082,6 +1114,7 @@ func (srv *Server) NodeInfo() *NodeInfo {
 		IP:         node.IP().String(),
 		ListenAddr: srv.ListenAddr,
 		Protocols:  make(map[string]interface{}),
+		Clock:      srv.ClockStatus(),
 	}
 	info.Ports.Discovery = node.UDP()
 	info.Ports.Listener = node.TCP()
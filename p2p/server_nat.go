@@ -0,0 +1,251 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/nat"
+)
+
+// NATInfo is the state of the NAT traversal of the server.
+type NATInfo struct {
+	Interface  string            `json:"interface"`            // NAT traversal mechanism in use, empty if none
+	ExternalIP string            `json:"externalIP,omitempty"` // External IP reported by the mechanism, if known
+	Error      string            `json:"error,omitempty"`      // Error of the last external IP query, if any
+	Mappings   []*NATMappingInfo `json:"mappings"`
+}
+
+// NATMappingInfo is the state of a port mapping maintained by the server.
+type NATMappingInfo struct {
+	Protocol   string    `json:"protocol"`
+	Name       string    `json:"name"`
+	Port       int       `json:"port"`
+	Mapped     bool      `json:"mapped"`          // Whether the last attempt to add or renew the mapping succeeded
+	Renewals   uint64    `json:"renewals"`        // Number of successful renewals of the mapping
+	LastMapped time.Time `json:"lastMapped"`      // Time of the last successful attempt
+	Error      string    `json:"error,omitempty"` // Error of the last failed attempt, if any
+}
+
+// natMapping is a listening port to be mapped by the NAT mechanism.
+type natMapping struct {
+	protocol string
+	port     int
+	name     string
+
+	attempts   uint64 // Number of attempts to add the mapping with the current mechanism
+	mapped     bool
+	renewals   uint64
+	lastMapped time.Time
+	err        error
+}
+
+// natState is the NAT traversal state of the server, allowing the mechanism to
+// be switched at runtime.
+type natState struct {
+	lock     sync.Mutex
+	m        nat.Interface // Mechanism in use, nil if none
+	gen      uint64        // Number of mechanism switches, to discard stale queries
+	ip       net.IP        // External IP reported by the mechanism
+	ipErr    error         // Error of the last external IP query
+	mappings []*natMapping
+	stop     chan struct{}  // Closed to stop the mappings of the current mechanism
+	wg       sync.WaitGroup // Mapping goroutines of the current mechanism
+
+	switching sync.Mutex // Serializes switching the mechanism
+}
+
+// setupNAT starts using the configured NAT mechanism. It's invoked by Start.
+func (srv *Server) setupNAT() {
+	srv.nat.lock.Lock()
+	defer srv.nat.lock.Unlock()
+
+	srv.nat.m, srv.nat.mappings = srv.NAT, nil
+	srv.nat.stop = make(chan struct{})
+	srv.queryExternalIP()
+}
+
+// queryExternalIP retrieves the external IP from the current NAT mechanism and
+// sets it as the IP of the local node. It's invoked with the NAT lock held.
+func (srv *Server) queryExternalIP() {
+	switch m := srv.nat.m.(type) {
+	case nil:
+		// No NAT interface, do nothing.
+	case nat.ExtIP:
+		// ExtIP doesn't block, set the IP right away.
+		ip, _ := m.ExternalIP()
+		srv.nat.ip = ip
+		srv.localnode.SetStaticIP(ip)
+	default:
+		// Ask the router about the IP. This takes a while and blocks startup,
+		// do it in the background.
+		gen := srv.nat.gen
+		srv.loopWG.Add(1)
+		go func() {
+			defer srv.loopWG.Done()
+			ip, err := m.ExternalIP()
+
+			srv.nat.lock.Lock()
+			defer srv.nat.lock.Unlock()
+			if srv.nat.gen != gen {
+				return // mechanism switched in the meantime
+			}
+			srv.nat.ip, srv.nat.ipErr = ip, err
+			if err == nil {
+				srv.localnode.SetStaticIP(ip)
+			}
+		}()
+	}
+}
+
+// mapPort registers a listening port to be mapped by the NAT mechanism, and maps
+// it if a mechanism is in use.
+func (srv *Server) mapPort(protocol string, port int, name string) {
+	srv.nat.lock.Lock()
+	defer srv.nat.lock.Unlock()
+
+	mapping := &natMapping{protocol: protocol, port: port, name: name}
+	srv.nat.mappings = append(srv.nat.mappings, mapping)
+	if srv.nat.m != nil {
+		srv.startMapping(srv.nat.m, srv.nat.stop, mapping)
+	}
+}
+
+// startMapping starts maintaining a port mapping with a NAT mechanism until its
+// stop channel is closed or the server stops. It's invoked with the NAT lock held.
+func (srv *Server) startMapping(m nat.Interface, stop chan struct{}, mapping *natMapping) {
+	srv.loopWG.Add(1)
+	srv.nat.wg.Add(1)
+	go func() {
+		defer srv.loopWG.Done()
+		defer srv.nat.wg.Done()
+
+		quit := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+			case <-srv.quit:
+			}
+			close(quit)
+		}()
+		nat.MapNotify(m, quit, mapping.protocol, mapping.port, mapping.port, mapping.name, func(err error) {
+			srv.nat.lock.Lock()
+			defer srv.nat.lock.Unlock()
+
+			mapping.attempts++
+			mapping.mapped, mapping.err = err == nil, err
+			if err == nil {
+				if mapping.attempts > 1 {
+					mapping.renewals++
+				}
+				mapping.lastMapped = time.Now()
+			}
+		})
+	}()
+}
+
+// SetNAT switches the NAT mechanism of the running server, deleting the port
+// mappings of the previous one and mapping the ports again with the new one. A
+// nil mechanism disables NAT traversal, though a previously discovered external
+// IP stays in the local node record.
+func (srv *Server) SetNAT(m nat.Interface) error {
+	srv.nat.switching.Lock()
+	defer srv.nat.switching.Unlock()
+
+	return srv.setNAT(m)
+}
+
+// RemapNAT deletes the port mappings of the current NAT mechanism and maps the
+// ports again, also querying the external IP again.
+func (srv *Server) RemapNAT() error {
+	srv.nat.switching.Lock()
+	defer srv.nat.switching.Unlock()
+
+	srv.nat.lock.Lock()
+	m := srv.nat.m
+	srv.nat.lock.Unlock()
+
+	return srv.setNAT(m)
+}
+
+// setNAT switches the NAT mechanism, with the switching lock held.
+func (srv *Server) setNAT(m nat.Interface) error {
+	// Stop the mappings of the current mechanism, waiting for them to be deleted
+	srv.nat.lock.Lock()
+	stop := srv.nat.stop
+	srv.nat.stop = nil
+	srv.nat.lock.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+	srv.nat.wg.Wait()
+
+	// Start using the new mechanism, unless the server was stopped since
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if !srv.running {
+		return errServerStopped
+	}
+	srv.nat.lock.Lock()
+	defer srv.nat.lock.Unlock()
+
+	srv.nat.m, srv.nat.ip, srv.nat.ipErr = m, nil, nil
+	srv.nat.gen++
+	srv.nat.stop = make(chan struct{})
+	for _, mapping := range srv.nat.mappings {
+		mapping.attempts, mapping.mapped, mapping.renewals, mapping.err = 0, false, 0, nil
+		if m != nil {
+			srv.startMapping(m, srv.nat.stop, mapping)
+		}
+	}
+	srv.queryExternalIP()
+	return nil
+}
+
+// NATInfo returns the state of the NAT traversal of the server.
+func (srv *Server) NATInfo() *NATInfo {
+	srv.nat.lock.Lock()
+	defer srv.nat.lock.Unlock()
+
+	info := &NATInfo{Mappings: make([]*NATMappingInfo, 0, len(srv.nat.mappings))}
+	if srv.nat.m != nil {
+		info.Interface = srv.nat.m.String()
+	}
+	if srv.nat.ip != nil {
+		info.ExternalIP = srv.nat.ip.String()
+	}
+	if srv.nat.ipErr != nil {
+		info.Error = srv.nat.ipErr.Error()
+	}
+	for _, mapping := range srv.nat.mappings {
+		mi := &NATMappingInfo{
+			Protocol:   mapping.protocol,
+			Name:       mapping.name,
+			Port:       mapping.port,
+			Mapped:     mapping.mapped,
+			Renewals:   mapping.renewals,
+			LastMapped: mapping.lastMapped,
+		}
+		if mapping.err != nil {
+			mi.Error = mapping.err.Error()
+		}
+		info.Mappings = append(info.Mappings, mi)
+	}
+	return info
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// testNAT is a NAT mechanism counting the mappings added and deleted on it.
+type testNAT struct {
+	name string
+	ip   net.IP
+	fail bool // Whether adding mappings fails
+
+	lock    sync.Mutex
+	added   map[string]int
+	deleted map[string]int
+}
+
+func newTestNAT(name string, ip net.IP, fail bool) *testNAT {
+	return &testNAT{name: name, ip: ip, fail: fail, added: make(map[string]int), deleted: make(map[string]int)}
+}
+
+func (n *testNAT) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.added[fmt.Sprintf("%s:%d", protocol, extport)]++
+	if n.fail {
+		return errors.New("mapping refused")
+	}
+	return nil
+}
+
+func (n *testNAT) DeleteMapping(protocol string, extport, intport int) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.deleted[fmt.Sprintf("%s:%d", protocol, extport)]++
+	return nil
+}
+
+func (n *testNAT) ExternalIP() (net.IP, error) { return n.ip, nil }
+func (n *testNAT) String() string              { return n.name }
+
+func (n *testNAT) counts(key string) (int, int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.added[key], n.deleted[key]
+}
+
+// waitNATInfo polls the NAT state of a server until it satisfies cond.
+func waitNATInfo(t *testing.T, srv *Server, cond func(*NATInfo) bool) *NATInfo {
+	for i := 0; i < 100; i++ {
+		if info := srv.NATInfo(); cond(info) {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info := srv.NATInfo()
+	t.Fatalf("unexpected NAT state: %+v (mappings %+v)", info, info.Mappings)
+	return nil
+}
+
+// Tests that the state of the port mappings is reported, and that the NAT
+// mechanism can be switched at runtime.
+func TestServerNATSwitch(t *testing.T) {
+	first := newTestNAT("first", net.IP{1, 2, 3, 4}, false)
+	srv := &Server{Config: Config{
+		Name:        "test",
+		MaxPeers:    10,
+		ListenAddr:  "0.0.0.0:0",
+		NoDiscovery: true,
+		NoDial:      true,
+		PrivateKey:  newkey(),
+		NAT:         first,
+		Logger:      testlog.Logger(t, log.LvlTrace),
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	defer srv.Stop()
+
+	info := waitNATInfo(t, srv, func(info *NATInfo) bool {
+		return len(info.Mappings) == 1 && info.Mappings[0].Mapped && info.ExternalIP != ""
+	})
+	if info.Interface != "first" || info.ExternalIP != "1.2.3.4" {
+		t.Errorf("NAT state mismatch: have %s/%s, want first/1.2.3.4", info.Interface, info.ExternalIP)
+	}
+	key := fmt.Sprintf("tcp:%d", info.Mappings[0].Port)
+
+	// Switch to a mechanism failing to map the port
+	second := newTestNAT("second", net.IP{5, 6, 7, 8}, true)
+	if err := srv.SetNAT(second); err != nil {
+		t.Fatalf("failed to switch NAT: %v", err)
+	}
+	if _, deleted := first.counts(key); deleted != 1 {
+		t.Errorf("first mapping deletions mismatch: have %d, want 1", deleted)
+	}
+	info = waitNATInfo(t, srv, func(info *NATInfo) bool {
+		return info.Mappings[0].Error != "" && info.ExternalIP != ""
+	})
+	if info.Interface != "second" || info.ExternalIP != "5.6.7.8" || info.Mappings[0].Mapped {
+		t.Errorf("NAT state mismatch: %+v (mappings %+v)", info, info.Mappings)
+	}
+	// Force mapping the port again
+	if err := srv.RemapNAT(); err != nil {
+		t.Fatalf("failed to remap NAT: %v", err)
+	}
+	waitNATInfo(t, srv, func(info *NATInfo) bool {
+		added, _ := second.counts(key)
+		return added == 2
+	})
+	// Disable the NAT traversal
+	if err := srv.SetNAT(nil); err != nil {
+		t.Fatalf("failed to disable NAT: %v", err)
+	}
+	info = srv.NATInfo()
+	if info.Interface != "" || info.ExternalIP != "" || info.Mappings[0].Mapped {
+		t.Errorf("NAT state mismatch: %+v (mappings %+v)", info, info.Mappings)
+	}
+	if _, deleted := second.counts(key); deleted != 2 {
+		t.Errorf("second mapping deletions mismatch: have %d, want 2", deleted)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import "sort"
+
+// GitCommit and GitDate identify the commit the running binary was built from,
+// set by the main package on startup if known.
+var (
+	GitCommit string
+	GitDate   string
+)
+
+// buildTags are the feature-relevant build tags the binary was compiled with,
+// registered by the files constrained to them.
+var buildTags []string
+
+// BuildTags returns the feature-relevant build tags the binary was compiled
+// with, sorted.
+func BuildTags() []string {
+	tags := append([]string{}, buildTags...)
+	sort.Strings(tags)
+	return tags
+}
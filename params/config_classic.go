@@ -79,6 +79,50 @@ var (
 		},
 	}
 
+	// DeveloperClassicChainConfig contains every protocol change adopted by the
+	// Ethereum Classic network, all activated at genesis, to run developer chains
+	// with the Classic rules and ECIP-1017 monetary policy.
+	DeveloperClassicChainConfig = &coregeth.CoreGethChainConfig{
+		NetworkID: 1337,
+		Ethash:    new(ctypes.EthashConfig),
+		ChainID:   big.NewInt(1337),
+
+		EIP2FBlock: big.NewInt(0),
+		EIP7FBlock: big.NewInt(0),
+
+		EIP150Block: big.NewInt(0),
+
+		EIP155Block:  big.NewInt(0),
+		EIP160FBlock: big.NewInt(0),
+
+		EIP161FBlock: big.NewInt(0),
+		EIP170FBlock: big.NewInt(0),
+
+		EIP100FBlock: big.NewInt(0),
+		EIP140FBlock: big.NewInt(0),
+		EIP198FBlock: big.NewInt(0),
+		EIP211FBlock: big.NewInt(0),
+		EIP212FBlock: big.NewInt(0),
+		EIP213FBlock: big.NewInt(0),
+		EIP214FBlock: big.NewInt(0),
+		EIP658FBlock: big.NewInt(0),
+
+		EIP145FBlock:  big.NewInt(0),
+		EIP1014FBlock: big.NewInt(0),
+		EIP1052FBlock: big.NewInt(0),
+
+		EIP152FBlock:  big.NewInt(0),
+		EIP1108FBlock: big.NewInt(0),
+		EIP1344FBlock: big.NewInt(0),
+		EIP1884FBlock: big.NewInt(0),
+		EIP2028FBlock: big.NewInt(0),
+		EIP2200FBlock: big.NewInt(0),
+
+		DisposalBlock:     big.NewInt(0),
+		ECIP1017FBlock:    big.NewInt(0),
+		ECIP1017EraRounds: big.NewInt(5000000),
+	}
+
 	DisinflationRateQuotient = big.NewInt(4)      // Disinflation rate quotient for ECIP1017
 	DisinflationRateDivisor  = big.NewInt(5)      // Disinflation rate divisor for ECIP1017
 	ExpDiffPeriod            = big.NewInt(100000) // Exponential diff period for diff bomb & ECIP1010
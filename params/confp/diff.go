@@ -0,0 +1,94 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package confp
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+)
+
+// configuratorType is the interface type whose getters are compared by Diff.
+var configuratorType = reflect.TypeOf((*ctypes.ChainConfigurator)(nil)).Elem()
+
+// Diff compares all the fields of two chain configurations, regardless of their
+// format, returning the ones whose values differ sorted by name. The values of
+// the pointer fields are dereferenced, a nil value meaning the field is unset.
+func Diff(stored, new ctypes.ChainConfigurator) []ctypes.FieldDiff {
+	var (
+		a     = reflect.ValueOf(stored)
+		b     = reflect.ValueOf(new)
+		diffs []ctypes.FieldDiff
+	)
+	for i := 0; i < configuratorType.NumMethod(); i++ {
+		method := configuratorType.Method(i)
+		if !strings.HasPrefix(method.Name, "Get") || method.Type.NumIn() != 0 || method.Type.NumOut() != 1 {
+			continue
+		}
+		va := diffValue(a.MethodByName(method.Name).Call(nil)[0])
+		vb := diffValue(b.MethodByName(method.Name).Call(nil)[0])
+		if !diffEqual(va, vb) {
+			diffs = append(diffs, ctypes.FieldDiff{
+				Field:  strings.TrimPrefix(method.Name, "Get"),
+				Stored: va,
+				New:    vb,
+			})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
+// diffValue unwraps the value returned by a configuration getter, keeping big
+// integers as pointers. Empty maps and slices are unset values.
+func diffValue(v reflect.Value) interface{} {
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		if _, ok := v.Interface().(*big.Int); !ok {
+			return v.Elem().Interface()
+		}
+	}
+	return v.Interface()
+}
+
+// diffEqual reports whether two unwrapped configuration values are the same.
+func diffEqual(a, b interface{}) bool {
+	if x, ok := a.(*big.Int); ok {
+		y, ok := b.(*big.Int)
+		return ok && x.Cmp(y) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// FormatDiff renders a list of differing fields, one per line.
+func FormatDiff(diffs []ctypes.FieldDiff) string {
+	lines := make([]string, len(diffs))
+	for i, diff := range diffs {
+		lines[i] = diff.String()
+	}
+	return strings.Join(lines, "\n")
+}
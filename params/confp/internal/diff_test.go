@@ -0,0 +1,53 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package convert_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/params/confp"
+	"github.com/ethereum/go-ethereum/params/types/coregeth"
+)
+
+// Tests that the fields differing between two chain configurations are reported,
+// and that copies of the same configuration report none.
+func TestDiff(t *testing.T) {
+	blob, err := json.Marshal(params.MordorChainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := new(coregeth.CoreGethChainConfig)
+	if err := json.Unmarshal(blob, modified); err != nil {
+		t.Fatal(err)
+	}
+	if diffs := confp.Diff(params.MordorChainConfig, modified); len(diffs) != 0 {
+		t.Fatalf("same config reported different: %s", confp.FormatDiff(diffs))
+	}
+	n := uint64(42)
+	if err := modified.SetEIP155Transition(&n); err != nil {
+		t.Fatal(err)
+	}
+	diffs := confp.Diff(params.MordorChainConfig, modified)
+	if len(diffs) != 1 {
+		t.Fatalf("diff count mismatch: have %d, want 1: %v", len(diffs), diffs)
+	}
+	if have, want := diffs[0].String(), "EIP155Transition: 0 (stored) != 42 (new)"; have != want {
+		t.Fatalf("diff mismatch: have %q, want %q", have, want)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
 	"github.com/ethereum/go-ethereum/params/types/genesisT"
 )
 
@@ -86,7 +87,7 @@ func DefaultYoloV1GenesisBlock() *genesisT.Genesis {
 
 // DeveloperGenesisBlock returns the 'geth --dev' genesis block. Note, this must
 // be seeded with the
-func DeveloperGenesisBlock(period uint64, faucet common.Address) *genesisT.Genesis {
+func DeveloperGenesisBlock(period uint64, faucet common.Address, funded ...common.Address) *genesisT.Genesis {
 	// Override the default period to the user requested one
 	config := *AllCliqueProtocolChanges
 	config.Clique.Period = period
@@ -97,16 +98,55 @@ func DeveloperGenesisBlock(period uint64, faucet common.Address) *genesisT.Genes
 		ExtraData:  append(append(make([]byte, 32), faucet[:]...), make([]byte, crypto.SignatureLength)...),
 		GasLimit:   6283185,
 		Difficulty: big.NewInt(1),
-		Alloc: map[common.Address]genesisT.GenesisAccount{
-			common.BytesToAddress([]byte{1}): {Balance: big.NewInt(1)}, // ECRecover
-			common.BytesToAddress([]byte{2}): {Balance: big.NewInt(1)}, // SHA256
-			common.BytesToAddress([]byte{3}): {Balance: big.NewInt(1)}, // RIPEMD
-			common.BytesToAddress([]byte{4}): {Balance: big.NewInt(1)}, // Identity
-			common.BytesToAddress([]byte{5}): {Balance: big.NewInt(1)}, // ModExp
-			common.BytesToAddress([]byte{6}): {Balance: big.NewInt(1)}, // ECAdd
-			common.BytesToAddress([]byte{7}): {Balance: big.NewInt(1)}, // ECScalarMul
-			common.BytesToAddress([]byte{8}): {Balance: big.NewInt(1)}, // ECPairing
-			faucet:                           {Balance: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(9))},
-		},
+		Alloc:      developerAlloc(append([]common.Address{faucet}, funded...)),
 	}
 }
+
+// DeveloperPoWGenesisBlock returns the 'geth --dev --dev.pow' genesis block, sealed
+// by a faked ethash engine. If classic is set, the chain follows the Ethereum
+// Classic rules and monetary policy.
+func DeveloperPoWGenesisBlock(classic bool, funded ...common.Address) *genesisT.Genesis {
+	var config ctypes.ChainConfigurator
+	if classic {
+		conf := *DeveloperClassicChainConfig
+		config = &conf
+	} else {
+		conf := *AllEthashProtocolChanges
+		conf.ChainID = big.NewInt(1337)
+		config = &conf
+	}
+	return &genesisT.Genesis{
+		Config:     config,
+		GasLimit:   6283185,
+		Difficulty: big.NewInt(1),
+		Alloc:      developerAlloc(funded),
+	}
+}
+
+// developerAlloc assembles the developer genesis allocation with the precompiles
+// and the given accounts pre-funded.
+func developerAlloc(funded []common.Address) genesisT.GenesisAlloc {
+	alloc := genesisT.GenesisAlloc{
+		common.BytesToAddress([]byte{1}): {Balance: big.NewInt(1)}, // ECRecover
+		common.BytesToAddress([]byte{2}): {Balance: big.NewInt(1)}, // SHA256
+		common.BytesToAddress([]byte{3}): {Balance: big.NewInt(1)}, // RIPEMD
+		common.BytesToAddress([]byte{4}): {Balance: big.NewInt(1)}, // Identity
+		common.BytesToAddress([]byte{5}): {Balance: big.NewInt(1)}, // ModExp
+		common.BytesToAddress([]byte{6}): {Balance: big.NewInt(1)}, // ECAdd
+		common.BytesToAddress([]byte{7}): {Balance: big.NewInt(1)}, // ECScalarMul
+		common.BytesToAddress([]byte{8}): {Balance: big.NewInt(1)}, // ECPairing
+	}
+	// Split the spendable supply evenly, leaving room for the precompile balances
+	unique := make(map[common.Address]struct{})
+	for _, addr := range funded {
+		unique[addr] = struct{}{}
+	}
+	if len(unique) > 0 {
+		balance := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(9))
+		balance.Div(balance, big.NewInt(int64(len(unique))))
+		for addr := range unique {
+			alloc[addr] = genesisT.GenesisAccount{Balance: balance}
+		}
+	}
+	return alloc
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package ctypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// FieldDiff is a field of a chain configuration or genesis specification whose
+// value differs between the one stored in a database and a new one.
+type FieldDiff struct {
+	Field  string      `json:"field"`
+	Stored interface{} `json:"stored"`
+	New    interface{} `json:"new"`
+}
+
+// String implements fmt.Stringer.
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s (stored) != %s (new)", d.Field, FormatDiffValue(d.Stored), FormatDiffValue(d.New))
+}
+
+// FormatDiffValue renders a value of a differing field, unset values among them,
+// composite values in their JSON encoding.
+func FormatDiffValue(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "<nil>"
+		}
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		if blob, err := json.Marshal(v); err == nil {
+			return string(blob)
+		}
+	}
+	if n, ok := v.(*big.Int); ok {
+		return n.String()
+	}
+	return fmt.Sprintf("%v", v)
+}
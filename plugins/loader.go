@@ -0,0 +1,70 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build linux,cgo darwin,cgo
+
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"strings"
+)
+
+// loadDir opens the Go plugins (*.so files) of a directory, registering the
+// plugin exported by each of them as a Plugin variable or a function returning
+// one.
+func loadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".so") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		lib, err := plugin.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open plugin %s: %v", path, err)
+		}
+		sym, err := lib.Lookup("Plugin")
+		if err != nil {
+			return fmt.Errorf("invalid plugin %s: %v", path, err)
+		}
+		var p Plugin
+		switch sym := sym.(type) {
+		case *Plugin:
+			p = *sym
+		case func() Plugin:
+			p = sym()
+		default:
+			return fmt.Errorf("invalid plugin %s: Plugin symbol is %T", path, sym)
+		}
+		if p == nil {
+			return fmt.Errorf("invalid plugin %s: nil Plugin", path)
+		}
+		registryLock.Lock()
+		err = register(p)
+		registryLock.Unlock()
+		if err != nil {
+			return fmt.Errorf("invalid plugin %s: %v", path, err)
+		}
+	}
+	return nil
+}
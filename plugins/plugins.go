@@ -0,0 +1,197 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package plugins implements in-process extensions of the node.
+//
+// A plugin registers itself with Register, usually from the init function of its
+// package. Plugins are compiled into the node by importing their packages, for
+// example from a file of cmd/geth guarded by a build tag:
+//
+//	// +build myplugin
+//
+//	package main
+//
+//	import _ "example.com/myplugin"
+//
+// Plugins may also be built as Go plugins (go build -buildmode=plugin) exporting
+// a Plugin variable or a function returning one, and placed in a plugins directory
+// from which the node loads them on startup.
+//
+// On startup, each enabled plugin is initialized with a Context, through which it
+// can register RPC namespaces, subscribe to chain events and add metrics. Plugins
+// implementing node.Lifecycle are started and stopped along with the node.
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params/types/ctypes"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Plugin is an in-process extension of the node.
+type Plugin interface {
+	// Name returns the unique name of the plugin, made of lowercase letters
+	// and digits, usable as an RPC namespace.
+	Name() string
+
+	// Init sets up the plugin before the node starts. It's invoked once.
+	Init(ctx *Context) error
+}
+
+// Backend is the view of the Ethereum service available to plugins, implemented
+// by both full and light nodes.
+type Backend interface {
+	ChainConfig() ctypes.ChainConfigurator
+	ChainDb() ethdb.Database
+	CurrentHeader() *types.Header
+	CurrentBlock() *types.Block
+	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
+
+	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
+	SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription
+	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
+}
+
+// Context is the environment a plugin is initialized in.
+type Context struct {
+	Node    *node.Node
+	Backend Backend          // Ethereum service of the node, nil if none
+	Metrics metrics.Registry // Registry of the plugin metrics, prefixed with plugins/<name>/
+	Log     log.Logger
+}
+
+// RegisterAPIs exposes RPC namespaces implemented by the plugin.
+func (ctx *Context) RegisterAPIs(apis []rpc.API) {
+	ctx.Node.RegisterAPIs(apis)
+}
+
+// Config are the plugin settings of the node.
+type Config struct {
+	Dir     string   `toml:",omitempty"` // Directory to load Go plugins from, none if empty
+	Enabled []string `toml:",omitempty"` // Names of the plugins to enable, all if empty
+}
+
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]Plugin)
+
+	validName = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+// Register makes a plugin available to the node. It panics if the name of the
+// plugin is invalid or already registered.
+func Register(plugin Plugin) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if err := register(plugin); err != nil {
+		panic(err)
+	}
+}
+
+func register(plugin Plugin) error {
+	name := plugin.Name()
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("plugin %q registered twice", name)
+	}
+	registry[name] = plugin
+	return nil
+}
+
+// Registered returns the names of the plugins available to the node, sorted.
+func Registered() []string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errPluginsUnsupported is returned when loading a plugins directory on a platform
+// without Go plugin support.
+var errPluginsUnsupported = errors.New("loading plugins is not supported on this platform")
+
+// Setup loads the plugins of the configured directory, then initializes the
+// enabled plugins on the node, registering the ones implementing node.Lifecycle.
+// It must be called before the node is started.
+func Setup(stack *node.Node, backend Backend, config Config) ([]Plugin, error) {
+	if config.Dir != "" {
+		if err := loadDir(config.Dir); err != nil {
+			return nil, err
+		}
+	}
+	names := config.Enabled
+	if len(names) == 0 {
+		names = Registered()
+	}
+	registryLock.Lock()
+	enabled := make([]Plugin, 0, len(names))
+	for _, name := range names {
+		plugin, ok := registry[name]
+		if !ok {
+			registryLock.Unlock()
+			return nil, fmt.Errorf("unknown plugin %q", name)
+		}
+		enabled = append(enabled, plugin)
+	}
+	registryLock.Unlock()
+
+	for _, plugin := range enabled {
+		name := plugin.Name()
+		ctx := &Context{
+			Node:    stack,
+			Backend: backend,
+			Metrics: metrics.NewPrefixedChildRegistry(metrics.DefaultRegistry, "plugins/"+name+"/"),
+			Log:     log.New("plugin", name),
+		}
+		if err := plugin.Init(ctx); err != nil {
+			return nil, fmt.Errorf("plugin %q: %v", name, err)
+		}
+		if lifecycle, ok := plugin.(node.Lifecycle); ok {
+			stack.RegisterLifecycle(lifecycle)
+		}
+		log.Info("Initialized plugin", "name", name)
+	}
+	return enabled, nil
+}
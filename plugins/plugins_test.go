@@ -0,0 +1,121 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package plugins
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testPlugin is a plugin exposing an RPC namespace and tracking its lifecycle.
+type testPlugin struct {
+	name    string
+	inits   int
+	started bool
+	stopped bool
+}
+
+func (p *testPlugin) Name() string { return p.name }
+
+func (p *testPlugin) Init(ctx *Context) error {
+	p.inits++
+	ctx.RegisterAPIs([]rpc.API{{Namespace: p.name, Version: "1.0", Service: &testPluginAPI{p}, Public: true}})
+	return nil
+}
+
+func (p *testPlugin) Start() error { p.started = true; return nil }
+func (p *testPlugin) Stop() error  { p.stopped = true; return nil }
+
+type testPluginAPI struct{ p *testPlugin }
+
+func (api *testPluginAPI) Name() string { return api.p.name }
+
+// Tests that enabled plugins are initialized, expose their RPC namespaces and
+// follow the lifecycle of the node.
+func TestSetup(t *testing.T) {
+	var (
+		enabled  = &testPlugin{name: "testenabled"}
+		disabled = &testPlugin{name: "testdisabled"}
+	)
+	Register(enabled)
+	Register(disabled)
+
+	stack, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	defer stack.Close()
+
+	if _, err := Setup(stack, nil, Config{Enabled: []string{"testenabled", "testmissing"}}); err == nil {
+		t.Fatalf("unknown plugin enabled")
+	}
+	plugins, err := Setup(stack, nil, Config{Enabled: []string{"testenabled"}})
+	if err != nil {
+		t.Fatalf("failed to set up plugins: %v", err)
+	}
+	if len(plugins) != 1 || plugins[0] != enabled {
+		t.Fatalf("enabled plugins mismatch: have %v", plugins)
+	}
+	if enabled.inits != 1 || disabled.inits != 0 {
+		t.Fatalf("init count mismatch: have %d enabled and %d disabled, want 1 and 0", enabled.inits, disabled.inits)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if !enabled.started {
+		t.Fatalf("plugin not started with the node")
+	}
+	client, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	defer client.Close()
+
+	var name string
+	if err := client.Call(&name, "testenabled_name"); err != nil {
+		t.Fatalf("failed to call plugin API: %v", err)
+	}
+	if name != "testenabled" {
+		t.Fatalf("plugin API result mismatch: have %q, want %q", name, "testenabled")
+	}
+	if err := client.Call(&name, "testdisabled_name"); err == nil {
+		t.Fatalf("disabled plugin API available")
+	}
+	stack.Close()
+	if !enabled.stopped {
+		t.Fatalf("plugin not stopped with the node")
+	}
+}
+
+// Tests that plugins with invalid or duplicate names are rejected.
+func TestRegisterInvalid(t *testing.T) {
+	for _, name := range []string{"", "Upper", "with_underscore", "testduplicate"} {
+		if name == "testduplicate" {
+			Register(&testPlugin{name: name})
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("plugin %q registered", name)
+				}
+			}()
+			Register(&testPlugin{name: name})
+		}()
+	}
+}
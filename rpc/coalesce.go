@@ -0,0 +1,119 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var coalescedRequestMeter = metrics.NewRegisteredMeter("rpc/coalesced", nil)
+
+// coalescer merges identical calls of the configured methods running at the
+// same time into one, sharing its result with all the callers.
+type coalescer struct {
+	mu      sync.Mutex
+	methods map[string]struct{}
+	calls   map[string]*coalescedCall // Calls in flight by method and canonical arguments
+}
+
+// coalescedCall is a call in flight, shared by identical calls.
+type coalescedCall struct {
+	done   chan struct{} // Closed when the result is available
+	dups   int           // Number of identical calls waiting for the result
+	result interface{}
+	err    error
+}
+
+// setMethods sets the methods whose calls are coalesced.
+func (c *coalescer) setMethods(methods []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.methods = make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		if method = strings.TrimSpace(method); method != "" {
+			c.methods[method] = struct{}{}
+		}
+	}
+}
+
+// key returns the key identifying identical calls of a method, the method name
+// and its arguments encoded canonically, or false if its calls aren't coalesced.
+func (c *coalescer) key(method string, args []reflect.Value) (string, bool) {
+	c.mu.Lock()
+	_, ok := c.methods[method]
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Interface()
+	}
+	enc, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+	return method + string(enc), true
+}
+
+// do runs a call of a method, or waits for an identical one in flight and
+// returns its result instead.
+func (c *coalescer) do(ctx context.Context, method string, args []reflect.Value, call func() (interface{}, error)) (interface{}, error) {
+	key, ok := c.key(method, args)
+	if !ok {
+		return call()
+	}
+	c.mu.Lock()
+	if running, ok := c.calls[key]; ok {
+		running.dups++
+		c.mu.Unlock()
+		coalescedRequestMeter.Mark(1)
+
+		select {
+		case <-running.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// Run the call again if it was only canceled for its own caller
+		if (running.err == context.Canceled || running.err == context.DeadlineExceeded) && ctx.Err() == nil {
+			return call()
+		}
+		return running.result, running.err
+	}
+	if c.calls == nil {
+		c.calls = make(map[string]*coalescedCall)
+	}
+	running := &coalescedCall{done: make(chan struct{})}
+	c.calls[key] = running
+	c.mu.Unlock()
+
+	running.result, running.err = call()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(running.done)
+
+	return running.result, running.err
+}
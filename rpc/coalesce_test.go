@@ -0,0 +1,147 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type coalesceTestService struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (s *coalesceTestService) Slow(ctx context.Context, n int) (int, error) {
+	atomic.AddInt32(&s.calls, 1)
+	select {
+	case <-s.release:
+		return n * 2, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// waitDups waits until the given number of calls wait for an identical call in
+// flight.
+func waitDups(t *testing.T, c *coalescer, dups int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		var waiting int
+		for _, call := range c.calls {
+			waiting += call.dups
+		}
+		c.mu.Unlock()
+		if waiting >= dups {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %d coalesced calls", dups)
+}
+
+func TestCoalescing(t *testing.T) {
+	var (
+		server  = NewServer()
+		service = &coalesceTestService{release: make(chan struct{})}
+	)
+	defer server.Stop()
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatal(err)
+	}
+	server.SetCoalescedMethods([]string{"test_slow"})
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]int, 10)
+		errs    = make([]error, len(results))
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Call(&results[i], "test_slow", 21)
+		}(i)
+	}
+	waitDups(t, &server.services.coalescer, len(results)-1)
+	close(service.release)
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil || results[i] != 42 {
+			t.Fatalf("call %d: have %d, %v, want 42", i, results[i], errs[i])
+		}
+	}
+	if calls := atomic.LoadInt32(&service.calls); calls != 1 {
+		t.Fatalf("coalesced calls executed %d times, want once", calls)
+	}
+	// Calls with different arguments, or of other methods, aren't coalesced
+	var result int
+	client.Call(&result, "test_slow", 1)
+	server.SetCoalescedMethods(nil)
+	client.Call(&result, "test_slow", 21)
+	if calls := atomic.LoadInt32(&service.calls); calls != 3 {
+		t.Fatalf("distinct calls executed %d times, want 3", calls)
+	}
+}
+
+// Tests that the callers waiting for a call canceled by its own caller run it
+// themselves.
+func TestCoalescingCanceled(t *testing.T) {
+	var (
+		c       coalescer
+		args    = []reflect.Value{reflect.ValueOf(21)}
+		started = make(chan struct{})
+	)
+	c.setMethods([]string{"test_slow"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.do(ctx, "test_slow", args, func() (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leader <- err
+	}()
+	<-started
+
+	follower := make(chan interface{}, 1)
+	go func() {
+		result, _ := c.do(context.Background(), "test_slow", args, func() (interface{}, error) {
+			return 42, nil
+		})
+		follower <- result
+	}()
+	waitDups(t, &c, 1)
+	cancel()
+
+	if err := <-leader; err != context.Canceled {
+		t.Fatalf("leading call error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if result := <-follower; result != 42 {
+		t.Fatalf("follower result mismatch: have %v, want 42", result)
+	}
+}
@@ -72,3 +72,34 @@ type invalidParamsError struct{ message string }
 func (e *invalidParamsError) ErrorCode() int { return -32602 }
 
 func (e *invalidParamsError) Error() string { return e.message }
+
+// server is draining its calls before stopping
+type shutdownError struct{}
+
+func (e *shutdownError) ErrorCode() int { return -32000 }
+
+func (e *shutdownError) Error() string { return "server is shutting down" }
+
+// server is paused for maintenance
+type maintenanceError struct{}
+
+func (e *maintenanceError) ErrorCode() int { return -32000 }
+
+func (e *maintenanceError) Error() string { return "node is in maintenance mode" }
+
+func (e *maintenanceError) ErrorData() interface{} {
+	return map[string]interface{}{"maintenance": true}
+}
+
+// too many calls of a priority class are waiting to be served
+type queueFullError struct{ class string }
+
+func (e *queueFullError) ErrorCode() int { return -32005 }
+
+func (e *queueFullError) Error() string {
+	return "too many " + e.class + " requests queued, try again later"
+}
+
+func (e *queueFullError) ErrorData() interface{} {
+	return map[string]interface{}{"class": e.class}
+}
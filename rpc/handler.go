@@ -61,6 +61,8 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	gate           *callGate // Calls gate of the server, nil for client connections
+	transport      string    // Transport the connection is served over, for metrics
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -84,6 +86,7 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		transport:      transportOf(conn),
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -112,8 +115,24 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	if len(calls) == 0 {
 		return
 	}
+	// Refuse new calls if the server is shutting down or paused
+	if err := h.gate.enter(); err != nil {
+		h.startCallProc(func(cp *callProc) {
+			answers := make([]*jsonrpcMessage, 0, len(calls))
+			for _, msg := range calls {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(err))
+				}
+			}
+			if len(answers) > 0 {
+				h.conn.writeJSON(cp.ctx, answers)
+			}
+		})
+		return
+	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
+		defer h.gate.leave()
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
 		for _, msg := range calls {
 			if answer := h.handleCallMsg(cp, msg); answer != nil {
@@ -135,7 +154,17 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	if ok := h.handleImmediate(msg); ok {
 		return
 	}
+	// Refuse new calls if the server is shutting down or paused
+	if err := h.gate.enter(); err != nil {
+		if msg.isCall() {
+			h.startCallProc(func(cp *callProc) {
+				h.conn.writeJSON(cp.ctx, msg.errorResponse(err))
+			})
+		}
+		return
+	}
 	h.startCallProc(func(cp *callProc) {
+		defer h.gate.leave()
 		answer := h.handleCallMsg(cp, msg)
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
@@ -200,6 +229,9 @@ func (h *handler) addSubscriptions(nn []*Notifier) {
 	for _, n := range nn {
 		if sub := n.takeSubscription(); sub != nil {
 			h.serverSubs[sub.ID] = sub
+			h.reg.subscriptions.add(h, n, sub)
+		} else {
+			h.reg.subscriptions.release(h)
 		}
 	}
 }
@@ -213,7 +245,25 @@ func (h *handler) cancelServerSubscriptions(err error) {
 		s.err <- err
 		close(s.err)
 		delete(h.serverSubs, id)
+		h.reg.subscriptions.remove(id)
+	}
+}
+
+// dropSubscription ends a subscription with the given error, reporting whether
+// it existed.
+func (h *handler) dropSubscription(id ID, err error) bool {
+	h.subLock.Lock()
+	defer h.subLock.Unlock()
+
+	s := h.serverSubs[id]
+	if s == nil {
+		return false
 	}
+	s.err <- err
+	close(s.err)
+	delete(h.serverSubs, id)
+	h.reg.subscriptions.remove(id)
+	return true
 }
 
 // startCallProc runs fn in a new goroutine and starts tracking it in the h.calls wait group.
@@ -345,8 +395,19 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 		} else {
 			successfulRequestGauge.Inc(1)
 		}
-		rpcServingTimer.UpdateSince(start)
-		newRPCServingTimer(msg.Method, answer.Error == nil).UpdateSince(start)
+		elapsed := time.Since(start)
+		rpcServingTimer.Update(elapsed)
+		newRPCServingTimer(msg.Method, answer.Error == nil).Update(elapsed)
+		newRPCTransportTimer(h.transport, msg.Method, answer.Error == nil).Update(elapsed)
+
+		if isSlowCall(elapsed, h.reg.slowCallThreshold()) {
+			slowRequestMeter.Mark(1)
+			ctx := []interface{}{"method", msg.Method, "transport", h.transport, "params", countParams(msg.Params), "t", elapsed}
+			if answer.Error != nil {
+				ctx = append(ctx, "err", answer.Error.Message)
+			}
+			h.log.Warn("Slow RPC call", ctx...)
+		}
 	}
 	return answer
 }
@@ -374,10 +435,19 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
+	var filter json.RawMessage
+	if params := []json.RawMessage{}; json.Unmarshal(msg.Params, &params) == nil && len(params) > 1 {
+		filter, _ = json.Marshal(params[1:])
+	}
 	args = args[1:]
 
+	// Reserve the subscription, refusing it if the connection or the server has
+	// too many already
+	if err := h.reg.subscriptions.reserve(h); err != nil {
+		return msg.errorResponse(err)
+	}
 	// Install notifier in context so the subscription handler can find it.
-	n := &Notifier{h: h, namespace: namespace}
+	n := &Notifier{h: h, namespace: namespace, kind: namespace + "_" + name, filter: filter}
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
@@ -386,7 +456,11 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 
 // runMethod runs the Go callback for an RPC method.
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
-	result, err := callb.call(ctx, msg.Method, args)
+	result, err := h.reg.coalescer.do(ctx, msg.Method, args, func() (interface{}, error) {
+		return h.reg.scheduler.do(ctx, msg.Method, args, func() (interface{}, error) {
+			return callb.call(ctx, msg.Method, args)
+		})
+	})
 	if err != nil {
 		return msg.errorResponse(err)
 	}
@@ -404,6 +478,7 @@ func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	}
 	close(s.err)
 	delete(h.serverSubs, id)
+	h.reg.subscriptions.remove(id)
 	return true, nil
 }
 
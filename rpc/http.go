@@ -234,6 +234,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), code)
 		return
 	}
+	// Refuse the calls with a structured error while paused for maintenance
+	if s.Paused() {
+		w.Header().Set("content-type", contentType)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(errorMessage(&maintenanceError{}))
+		return
+	}
 	// All checks passed, create a codec that reads directly from the request body
 	// until EOF, writes the response to w, and orders the server to process a
 	// single request.
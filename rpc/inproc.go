@@ -26,8 +26,13 @@ func DialInProc(handler *Server) *Client {
 	initctx := context.Background()
 	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
 		p1, p2 := net.Pipe()
-		go handler.ServeCodec(NewCodec(p1), 0)
+		go handler.ServeCodec(NewCodec(inprocConn{p1}), 0)
 		return NewCodec(p2), nil
 	})
 	return c
 }
+
+// inprocConn is the server side of an in-process connection.
+type inprocConn struct {
+	net.Conn
+}
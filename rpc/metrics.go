@@ -17,7 +17,9 @@
 package rpc
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/metrics"
 )
@@ -27,6 +29,7 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+	slowRequestMeter       = metrics.NewRegisteredMeter("rpc/slow", nil)
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -37,3 +40,53 @@ func newRPCServingTimer(method string, valid bool) metrics.Timer {
 	m := fmt.Sprintf("rpc/duration/%s/%s", method, flag)
 	return metrics.GetOrRegisterTimer(m, nil)
 }
+
+// newRPCTransportTimer returns the timer of the given method served over the
+// given transport.
+func newRPCTransportTimer(transport, method string, valid bool) metrics.Timer {
+	flag := "success"
+	if !valid {
+		flag = "failure"
+	}
+	m := fmt.Sprintf("rpc/duration/%s/%s/%s", transport, method, flag)
+	return metrics.GetOrRegisterTimer(m, nil)
+}
+
+// transportOf returns the name of the transport a connection is served over.
+func transportOf(conn jsonWriter) string {
+	switch c := conn.(type) {
+	case *websocketCodec:
+		return "ws"
+	case *jsonCodec:
+		switch c.conn.(type) {
+		case *httpServerConn:
+			return "http"
+		case inprocConn:
+			return "inproc"
+		case stdioConn:
+			return "stdio"
+		}
+		return "ipc"
+	}
+	return "other"
+}
+
+// isSlowCall reports whether a call served in the given time exceeds the slow
+// call threshold (0 = disabled).
+func isSlowCall(elapsed, threshold time.Duration) bool {
+	return threshold > 0 && elapsed >= threshold
+}
+
+// countParams returns the number of positional parameters of a call. Only the
+// count is logged for slow calls, never the values, which may hold passphrases
+// and keys (personal_unlockAccount, personal_importRawKey, ...).
+func countParams(params json.RawMessage) int {
+	var args []json.RawMessage
+	if err := json.Unmarshal(params, &args); err != nil {
+		if len(params) == 0 || string(params) == "null" {
+			return 0
+		}
+		return 1
+	}
+	return len(args)
+}
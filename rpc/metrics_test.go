@@ -0,0 +1,107 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Tests that calls are timed per transport and those exceeding the slow call
+// threshold counted.
+func TestTransportMetrics(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	server.SetSlowCallThreshold(10 * time.Millisecond)
+	client := DialInProc(server)
+	defer client.Close()
+
+	// Capture the slow call logs to check no parameter value is leaked.
+	var logged []*log.Record
+	handler := log.Root().GetHandler()
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "Slow RPC call" {
+			logged = append(logged, r)
+		}
+		return nil
+	}))
+	defer log.Root().SetHandler(handler)
+
+	slow := slowRequestMeter.Count()
+	if err := client.Call(nil, "test_sleep", 20*time.Millisecond); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if err := client.Call(nil, "test_returnError"); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, name := range []string{"rpc/duration/inproc/test_sleep/success", "rpc/duration/inproc/test_returnError/failure"} {
+		if metrics.DefaultRegistry.Get(name) == nil {
+			t.Errorf("timer %s not registered", name)
+		}
+	}
+	if metrics.Enabled && slowRequestMeter.Count() != slow+1 {
+		t.Errorf("slow calls mismatch: have %d, want %d", slowRequestMeter.Count(), slow+1)
+	}
+	if len(logged) != 1 {
+		t.Fatalf("slow call logs mismatch: have %d, want 1", len(logged))
+	}
+	for i := 0; i+1 < len(logged[0].Ctx); i += 2 {
+		if logged[0].Ctx[i] == "params" && logged[0].Ctx[i+1] != 1 {
+			t.Errorf("logged params mismatch: have %v, want parameter count 1", logged[0].Ctx[i+1])
+		}
+	}
+}
+
+func TestTransportOf(t *testing.T) {
+	tests := []struct {
+		conn jsonWriter
+		want string
+	}{
+		{&jsonCodec{conn: &httpServerConn{}}, "http"},
+		{&jsonCodec{conn: inprocConn{}}, "inproc"},
+		{&jsonCodec{conn: stdioConn{}}, "stdio"},
+		{&websocketCodec{jsonCodec: &jsonCodec{}}, "ws"},
+	}
+	for i, tt := range tests {
+		if have := transportOf(tt.conn); have != tt.want {
+			t.Errorf("test %d: transport mismatch: have %s, want %s", i, have, tt.want)
+		}
+	}
+}
+
+func TestCountParams(t *testing.T) {
+	tests := []struct {
+		params string
+		want   int
+	}{
+		{``, 0},
+		{`null`, 0},
+		{`[]`, 0},
+		{`[ "0x1",  true ]`, 2},
+		{`["0xdeadbeef", "secret passphrase", 300]`, 3},
+		{`{"passphrase": "secret"}`, 1},
+	}
+	for i, tt := range tests {
+		if have := countParams(json.RawMessage(tt.params)); have != tt.want {
+			t.Errorf("test %d: count mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
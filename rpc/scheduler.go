@@ -0,0 +1,322 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Priority classes of the scheduled calls.
+const (
+	HeadClass    = "head"    // Reads of recent blocks and state, latency sensitive
+	ArchiveClass = "archive" // Traces and reads deep into the history
+)
+
+// SchedulerConfig configures the classes calls are scheduled into, along with
+// the worker pool and queue of each class.
+type SchedulerConfig struct {
+	// ArchiveMethods are the methods whose calls are always archive work, names
+	// ending with a * matching all the methods starting with the rest.
+	ArchiveMethods []string `toml:",omitempty"`
+
+	// ArchiveDepth is the number of blocks below the head past which calls on an
+	// explicit block number or hash, or on block ranges starting there, are
+	// archive work (0 = by method only).
+	ArchiveDepth uint64 `toml:",omitempty"`
+
+	HeadWorkers    int `toml:",omitempty"` // Head calls running at once (0 = unlimited)
+	HeadQueue      int `toml:",omitempty"` // Head calls waiting for a worker (0 = unlimited)
+	ArchiveWorkers int `toml:",omitempty"` // Archive calls running at once (0 = unlimited)
+	ArchiveQueue   int `toml:",omitempty"` // Archive calls waiting for a worker (0 = unlimited)
+}
+
+// DefaultSchedulerConfig classifies traces and calls on blocks whose state has
+// been flushed out of memory by full nodes as archive work, running a few of
+// them at once.
+var DefaultSchedulerConfig = SchedulerConfig{
+	ArchiveMethods: []string{"debug_trace*", "debug_standardTrace*", "debug_storageRangeAt", "debug_getModifiedAccountsBy*", "debug_getBalanceHistory"},
+	ArchiveDepth:   128,
+	ArchiveWorkers: 4,
+	ArchiveQueue:   256,
+}
+
+// SchedulerStats describes the state of a priority class of a scheduler.
+type SchedulerStats struct {
+	Class    string `json:"class"`
+	Workers  int    `json:"workers"` // Limit of running calls (0 = unlimited)
+	Queue    int    `json:"queue"`   // Limit of waiting calls (0 = unlimited)
+	Running  int    `json:"running"`
+	Queued   int    `json:"queued"`
+	Served   uint64 `json:"served"`
+	Rejected uint64 `json:"rejected"` // Calls refused with a full queue
+}
+
+// Scheduler classifies the calls of one or more servers into priority classes,
+// running the calls of each class on a worker pool of its own, so heavy archive
+// work can't starve the head traffic. A nil scheduler runs all calls at once.
+type Scheduler struct {
+	head    *schedPool
+	archive *schedPool
+
+	methods  map[string]struct{} // Archive methods matched exactly
+	prefixes []string            // Archive methods matched by prefix
+	depth    uint64
+	number   atomic.Value // func() uint64 returning the number of the chain head
+	hashes   atomic.Value // func(common.Hash) (uint64, bool) returning the number of a block
+}
+
+// BlockRangeArg is implemented by the call arguments naming the blocks a call
+// reads otherwise than by number or hash, such as log filters, for the scheduler
+// to classify the call by the oldest of them.
+type BlockRangeArg interface {
+	OldestBlock() BlockNumberOrHash
+}
+
+// NewScheduler creates a scheduler of the given configuration.
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	s := &Scheduler{
+		head:    newSchedPool(HeadClass, config.HeadWorkers, config.HeadQueue),
+		archive: newSchedPool(ArchiveClass, config.ArchiveWorkers, config.ArchiveQueue),
+		methods: make(map[string]struct{}),
+		depth:   config.ArchiveDepth,
+	}
+	for _, method := range config.ArchiveMethods {
+		switch method = strings.TrimSpace(method); {
+		case method == "":
+		case strings.HasSuffix(method, "*"):
+			s.prefixes = append(s.prefixes, strings.TrimSuffix(method, "*"))
+		default:
+			s.methods[method] = struct{}{}
+		}
+	}
+	return s
+}
+
+// SetHeadFunc sets the function returning the number of the chain head, which
+// the depth of the blocks calls are made on is measured from.
+func (s *Scheduler) SetHeadFunc(head func() uint64) {
+	if s != nil {
+		s.number.Store(head)
+	}
+}
+
+// SetNumberFunc sets the function returning the number of the block with the
+// given hash, if known, which the depth of the calls on block hashes is measured
+// with.
+func (s *Scheduler) SetNumberFunc(number func(hash common.Hash) (uint64, bool)) {
+	if s != nil {
+		s.hashes.Store(number)
+	}
+}
+
+// Stats returns the state of the priority classes of the scheduler.
+func (s *Scheduler) Stats() []SchedulerStats {
+	if s == nil {
+		return nil
+	}
+	return []SchedulerStats{s.head.stats(), s.archive.stats()}
+}
+
+// classify returns the pool of the priority class of a call.
+func (s *Scheduler) classify(method string, args []reflect.Value) *schedPool {
+	if _, ok := s.methods[method]; ok {
+		return s.archive
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(method, prefix) {
+			return s.archive
+		}
+	}
+	head, _ := s.number.Load().(func() uint64)
+	if s.depth == 0 || head == nil {
+		return s.head
+	}
+	for _, arg := range args {
+		number, ok := s.blockNumberArg(arg)
+		if !ok || number < 0 {
+			continue
+		}
+		if current := head(); current > uint64(number) && current-uint64(number) > s.depth {
+			return s.archive
+		}
+	}
+	return s.head
+}
+
+// blockNumberArg returns the number of the block named by a call argument, if
+// any, looking up the numbers of the blocks named by hash.
+func (s *Scheduler) blockNumberArg(arg reflect.Value) (BlockNumber, bool) {
+	if arg.Kind() == reflect.Ptr && arg.IsNil() {
+		return 0, false
+	}
+	var ref BlockNumberOrHash
+	switch v := arg.Interface().(type) {
+	case BlockNumber:
+		return v, true
+	case *BlockNumber:
+		return *v, true
+	case BlockNumberOrHash:
+		ref = v
+	case *BlockNumberOrHash:
+		ref = *v
+	case BlockRangeArg:
+		ref = v.OldestBlock()
+	default:
+		return 0, false
+	}
+	if number, ok := ref.Number(); ok {
+		return number, true
+	}
+	hash, ok := ref.Hash()
+	if !ok {
+		return 0, false
+	}
+	lookup, _ := s.hashes.Load().(func(common.Hash) (uint64, bool))
+	if lookup == nil {
+		return 0, false
+	}
+	number, ok := lookup(hash)
+	return BlockNumber(number), ok
+}
+
+// do runs a call on the worker pool of its priority class, waiting for a worker
+// in the queue of the class, or failing if the queue is full.
+func (s *Scheduler) do(ctx context.Context, method string, args []reflect.Value, call func() (interface{}, error)) (interface{}, error) {
+	if s == nil {
+		return call()
+	}
+	pool := s.classify(method, args)
+	if err := pool.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer pool.release()
+	return call()
+}
+
+// schedPool is the worker pool and queue of a priority class.
+type schedPool struct {
+	class   string
+	workers int
+	queue   int
+
+	lock    sync.Mutex
+	running int
+	waiting []chan struct{} // Queued calls in arrival order, closed when handed a worker
+	served  uint64
+	refused uint64
+
+	runningGauge  metrics.Gauge
+	queuedGauge   metrics.Gauge
+	rejectedMeter metrics.Meter
+	waitTimer     metrics.Timer
+}
+
+func newSchedPool(class string, workers, queue int) *schedPool {
+	return &schedPool{
+		class:         class,
+		workers:       workers,
+		queue:         queue,
+		runningGauge:  metrics.GetOrRegisterGauge("rpc/schedule/"+class+"/running", nil),
+		queuedGauge:   metrics.GetOrRegisterGauge("rpc/schedule/"+class+"/queued", nil),
+		rejectedMeter: metrics.GetOrRegisterMeter("rpc/schedule/"+class+"/rejected", nil),
+		waitTimer:     metrics.GetOrRegisterTimer("rpc/schedule/"+class+"/wait", nil),
+	}
+}
+
+// acquire takes a worker of the pool, queueing for one until the context is
+// canceled if all are busy.
+func (p *schedPool) acquire(ctx context.Context) error {
+	p.lock.Lock()
+	if p.workers == 0 || p.running < p.workers {
+		p.running++
+		p.served++
+		p.runningGauge.Update(int64(p.running))
+		p.lock.Unlock()
+		return nil
+	}
+	if p.queue > 0 && len(p.waiting) >= p.queue {
+		p.refused++
+		p.lock.Unlock()
+		p.rejectedMeter.Mark(1)
+		return &queueFullError{class: p.class}
+	}
+	ready := make(chan struct{})
+	p.waiting = append(p.waiting, ready)
+	p.queuedGauge.Update(int64(len(p.waiting)))
+	p.lock.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ready:
+		p.waitTimer.UpdateSince(start)
+		return nil
+	case <-ctx.Done():
+	}
+	p.lock.Lock()
+	for i, ch := range p.waiting {
+		if ch == ready {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			p.queuedGauge.Update(int64(len(p.waiting)))
+			p.lock.Unlock()
+			return ctx.Err()
+		}
+	}
+	p.lock.Unlock()
+
+	// Handed a worker while the context was canceled, pass it on
+	p.release()
+	return ctx.Err()
+}
+
+// release gives back a worker, handing it over to the first queued call.
+func (p *schedPool) release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.waiting) > 0 {
+		close(p.waiting[0])
+		p.waiting = p.waiting[1:]
+		p.served++
+		p.queuedGauge.Update(int64(len(p.waiting)))
+		return
+	}
+	p.running--
+	p.runningGauge.Update(int64(p.running))
+}
+
+func (p *schedPool) stats() SchedulerStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return SchedulerStats{
+		Class:    p.class,
+		Workers:  p.workers,
+		Queue:    p.queue,
+		Running:  p.running,
+		Queued:   len(p.waiting),
+		Served:   p.served,
+		Rejected: p.refused,
+	}
+}
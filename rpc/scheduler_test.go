@@ -0,0 +1,199 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type schedulerTestService struct {
+	release chan struct{}
+}
+
+func (s *schedulerTestService) Trace(ctx context.Context) (int, error) {
+	select {
+	case <-s.release:
+		return 1, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (s *schedulerTestService) Head() int { return 2 }
+
+// waitQueued waits until the given number of calls of a class are queued.
+func waitQueued(t *testing.T, s *Scheduler, class string, queued int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		for _, stats := range s.Stats() {
+			if stats.Class == class && stats.Queued == queued {
+				return
+			}
+		}
+	}
+	t.Fatalf("timed out waiting for %d queued %s calls", queued, class)
+}
+
+// testBlockRange is a call argument naming the oldest block it reads.
+type testBlockRange BlockNumberOrHash
+
+func (r testBlockRange) OldestBlock() BlockNumberOrHash { return BlockNumberOrHash(r) }
+
+func TestSchedulerClassify(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{
+		ArchiveMethods: []string{"debug_trace*", "debug_storageRangeAt"},
+		ArchiveDepth:   128,
+	})
+	number := func(n BlockNumber) []reflect.Value { return []reflect.Value{reflect.ValueOf(n)} }
+	ref := func(n BlockNumber) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf("0x00"), reflect.ValueOf(BlockNumberOrHashWithNumber(n))}
+	}
+	byHash := func(hash common.Hash) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(BlockNumberOrHashWithHash(hash, false))}
+	}
+	span := func(ref BlockNumberOrHash) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(testBlockRange(ref))}
+	}
+	s.SetHeadFunc(func() uint64 { return 1000 })
+	s.SetNumberFunc(func(hash common.Hash) (uint64, bool) {
+		switch hash {
+		case common.Hash{0x01}:
+			return 10, true
+		case common.Hash{0x02}:
+			return 990, true
+		}
+		return 0, false
+	})
+
+	tests := []struct {
+		method string
+		args   []reflect.Value
+		class  string
+	}{
+		{"debug_traceTransaction", nil, ArchiveClass},
+		{"debug_traceBlockByNumber", number(LatestBlockNumber), ArchiveClass},
+		{"debug_storageRangeAt", nil, ArchiveClass},
+		{"debug_storageRange", nil, HeadClass},
+		{"eth_getBlockByNumber", number(LatestBlockNumber), HeadClass},
+		{"eth_getBlockByNumber", number(PendingBlockNumber), HeadClass},
+		{"eth_getBlockByNumber", number(900), HeadClass},
+		{"eth_getBlockByNumber", number(800), ArchiveClass},
+		{"eth_getBlockByNumber", number(EarliestBlockNumber), ArchiveClass},
+		{"eth_getBalance", ref(2000), HeadClass},
+		{"eth_getBalance", ref(10), ArchiveClass},
+		{"eth_getBalance", []reflect.Value{reflect.ValueOf(BlockNumberOrHash{})}, HeadClass},
+		{"eth_getBlockByNumber", []reflect.Value{reflect.ValueOf((*BlockNumber)(nil))}, HeadClass},
+		{"eth_getBlockByHash", byHash(common.Hash{0x01}), ArchiveClass},
+		{"eth_getBlockByHash", byHash(common.Hash{0x02}), HeadClass},
+		{"eth_getBlockByHash", byHash(common.Hash{0x03}), HeadClass},
+		{"eth_getLogs", span(BlockNumberOrHashWithNumber(10)), ArchiveClass},
+		{"eth_getLogs", span(BlockNumberOrHashWithNumber(950)), HeadClass},
+		{"eth_getLogs", span(BlockNumberOrHashWithNumber(LatestBlockNumber)), HeadClass},
+		{"eth_getLogs", span(BlockNumberOrHashWithHash(common.Hash{0x01}, false)), ArchiveClass},
+	}
+	for i, tt := range tests {
+		if class := s.classify(tt.method, tt.args).class; class != tt.class {
+			t.Errorf("test %d: %s class mismatch: have %s, want %s", i, tt.method, class, tt.class)
+		}
+	}
+}
+
+// Tests that archive calls run on workers of their own, queueing and being
+// refused once their queue is full, without holding up the head calls.
+func TestSchedulerPools(t *testing.T) {
+	var (
+		server    = NewServer()
+		service   = &schedulerTestService{release: make(chan struct{})}
+		scheduler = NewScheduler(SchedulerConfig{ArchiveMethods: []string{"test_trace"}, ArchiveWorkers: 1, ArchiveQueue: 1})
+	)
+	defer server.Stop()
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatal(err)
+	}
+	server.SetScheduler(scheduler)
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			var result int
+			results <- client.Call(&result, "test_trace")
+		}()
+	}
+	waitQueued(t, scheduler, ArchiveClass, 1)
+
+	var result int
+	err := client.Call(&result, "test_trace")
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32005 {
+		t.Fatalf("full queue error mismatch: have %v, want queue full error", err)
+	}
+	if err := client.Call(&result, "test_head"); err != nil || result != 2 {
+		t.Fatalf("head call failed: %d, %v", result, err)
+	}
+	close(service.release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("archive call failed: %v", err)
+		}
+	}
+	stats := scheduler.Stats()
+	if stats[0].Served != 1 || stats[1].Served != 2 || stats[1].Rejected != 1 || stats[1].Running != 0 || stats[1].Queued != 0 {
+		t.Fatalf("stats mismatch: %+v", stats)
+	}
+}
+
+// Tests that canceled queued calls leave the queue, and that the worker handed
+// over to a canceled call is passed on.
+func TestSchedulerCanceled(t *testing.T) {
+	p := NewScheduler(SchedulerConfig{ArchiveWorkers: 1}).archive
+	if err := p.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() { canceled <- p.acquire(ctx) }()
+
+	waiting := make(chan error, 1)
+	go func() {
+		for p.stats().Queued != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		waiting <- p.acquire(context.Background())
+	}()
+	for p.stats().Queued != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("canceled call error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	p.release()
+	if err := <-waiting; err != nil {
+		t.Fatalf("queued call failed: %v", err)
+	}
+	p.release()
+	if stats := p.stats(); stats.Running != 0 || stats.Queued != 0 {
+		t.Fatalf("pool not drained: %+v", stats)
+	}
+}
@@ -22,7 +22,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/log"
@@ -59,6 +61,7 @@ type Server struct {
 	idgen            func() ID
 	run              int32
 	codecs           mapset.Set
+	gate             callGate
 	OpenRPCSchemaRaw string
 }
 
@@ -106,6 +109,33 @@ func (s *Server) SetOpenRPCSchemaRaw(schemaJSON string) error {
 	return nil
 }
 
+// SetCoalescedMethods sets the methods whose identical calls running at the same
+// time, with the same canonically encoded arguments, are executed only once,
+// sharing the result. Only methods without side effects should be coalesced.
+func (s *Server) SetCoalescedMethods(methods []string) {
+	s.services.coalescer.setMethods(methods)
+}
+
+// SetSubscriptionRegistry sets the registry tracking and limiting the
+// subscriptions served by the server, which may be shared with other servers. It
+// must be called before the server starts serving.
+func (s *Server) SetSubscriptionRegistry(registry *SubscriptionRegistry) {
+	s.services.subscriptions = registry
+}
+
+// SetScheduler sets the scheduler running the method calls served by the server
+// on the worker pools of their priority classes, which may be shared with other
+// servers. It must be called before the server starts serving.
+func (s *Server) SetScheduler(scheduler *Scheduler) {
+	s.services.scheduler = scheduler
+}
+
+// SetSlowCallThreshold sets the duration above which the calls served by the
+// server are logged with their method and parameter count (0 = disabled).
+func (s *Server) SetSlowCallThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&s.services.slowCall, int64(threshold))
+}
+
 // RegisterName creates a service for the given receiver type under the given name. When no
 // methods on the given receiver match the criteria to be either a RPC method or a
 // subscription an error is returned. Otherwise a new service is created and added to the
@@ -131,7 +161,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, &s.gate)
 	<-codec.closed()
 	c.Close()
 }
@@ -147,6 +177,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 
 	h := newHandler(ctx, codec, s.idgen, &s.services)
 	h.allowSubscribe = false
+	h.gate = &s.gate
 	defer h.close(io.EOF, nil)
 
 	reqs, batch, err := codec.readBatch()
@@ -176,6 +207,113 @@ func (s *Server) Stop() {
 	}
 }
 
+// Drain stops the server from taking new calls, answering them with an error, and
+// waits for the calls in flight to complete until the context is done. The
+// connections stay open until Stop is called.
+func (s *Server) Drain(ctx context.Context) error {
+	s.gate.close()
+
+	done := make(chan struct{})
+	go func() {
+		s.gate.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops the server from taking new calls for maintenance, answering them
+// with an error, and waits for the calls in flight to complete until the context
+// is done. The calls are taken again once Resume is called.
+func (s *Server) Pause(ctx context.Context) error {
+	s.gate.pause(true)
+
+	done := make(chan struct{})
+	go func() {
+		s.gate.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume lets the server take new calls again after a Pause.
+func (s *Server) Resume() {
+	s.gate.pause(false)
+}
+
+// Paused reports whether the server is paused for maintenance.
+func (s *Server) Paused() bool {
+	return s.gate.isPaused()
+}
+
+// callGate tracks the calls in flight on a server, allowing it to stop taking
+// new ones and wait for the pending ones to complete.
+type callGate struct {
+	lock    sync.Mutex
+	closed  bool
+	paused  bool
+	pending sync.WaitGroup
+}
+
+// enter registers a new call, returning the error to answer it with if the gate
+// is closed or paused. A nil gate takes all calls.
+func (g *callGate) enter() error {
+	if g == nil {
+		return nil
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	switch {
+	case g.closed:
+		return &shutdownError{}
+	case g.paused:
+		return &maintenanceError{}
+	}
+	g.pending.Add(1)
+	return nil
+}
+
+// leave marks a call registered with enter as completed.
+func (g *callGate) leave() {
+	if g != nil {
+		g.pending.Done()
+	}
+}
+
+// close stops the gate from taking new calls.
+func (g *callGate) close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.closed = true
+}
+
+// pause stops the gate from taking new calls, or lets it take them again.
+func (g *callGate) pause(paused bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.paused = paused
+}
+
+// isPaused reports whether the gate is paused.
+func (g *callGate) isPaused() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.paused
+}
+
 // RPCService gives meta information about the server.
 // e.g. gives information about the loaded modules.
 type RPCService struct {
@@ -19,9 +19,12 @@ package rpc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -150,3 +153,100 @@ func TestServerShortLivedConn(t *testing.T) {
 		}
 	}
 }
+
+// Tests that draining the server waits for the calls in flight and refuses the
+// new ones.
+func TestServerDrain(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	// Start a call and drain the server while it's in flight
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Call(nil, "test_sleep", 200*time.Millisecond)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- server.Drain(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// New calls are refused while draining
+	err := client.Call(nil, "test_noArgsRets")
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != (&shutdownError{}).ErrorCode() {
+		t.Fatalf("call while draining: have error %v, want shutdown error", err)
+	}
+	// The call in flight completes before the drain does
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned before the call in flight completed: %v", err)
+	default:
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("call in flight failed: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+}
+
+// Tests that draining the server gives up on the calls in flight once the
+// context is done.
+func TestServerDrainTimeout(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	go client.Call(nil, "test_block")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("drain error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// Tests that a paused server answers new calls with a maintenance error, over
+// HTTP with a 503 status, until resumed.
+func TestServerPause(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Pause(ctx); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	err := client.Call(nil, "test_noArgsRets")
+	if derr, ok := err.(DataError); !ok || derr.ErrorData() == nil {
+		t.Fatalf("call while paused: have error %v, want maintenance error", err)
+	}
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	res, err := http.Post(httpsrv.URL, contentType, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test_noArgsRets"}`))
+	if err != nil {
+		t.Fatalf("HTTP call failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("HTTP status mismatch: have %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	server.Resume()
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("call after resume failed: %v", err)
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -36,8 +38,13 @@ var (
 )
 
 type serviceRegistry struct {
-	mu       sync.Mutex
-	services map[string]service
+	mu        sync.Mutex
+	services  map[string]service
+	coalescer coalescer  // Merges identical concurrent calls of the configured methods
+	scheduler *Scheduler // Runs the calls on the worker pools of their priority classes, nil if unscheduled
+	slowCall  int64      // Duration in nanoseconds above which served calls are logged (atomic, 0 = disabled)
+
+	subscriptions *SubscriptionRegistry // Tracks and limits the subscriptions, nil if untracked
 }
 
 // service represents a registered object.
@@ -109,6 +116,11 @@ func (r *serviceRegistry) subscription(service, name string) *callback {
 	return r.services[service].subscriptions[name]
 }
 
+// slowCallThreshold returns the duration above which served calls are logged.
+func (r *serviceRegistry) slowCallThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.slowCall))
+}
+
 // suitableCallbacks iterates over the methods of the given type. It determines if a method
 // satisfies the criteria for a RPC callback or a subscription callback and adds it to the
 // collection of callbacks. See server documentation for a summary of these criteria.
@@ -0,0 +1,182 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errConnSubscriptionLimit  = errors.New("too many subscriptions on the connection")
+	errTotalSubscriptionLimit = errors.New("too many subscriptions")
+	errSubscriptionDropped    = errors.New("subscription dropped by the server")
+)
+
+// SubscriptionInfo describes a subscription served to a connection.
+type SubscriptionInfo struct {
+	ID           ID              `json:"id"`
+	Owner        string          `json:"owner"` // Remote address of the connection
+	Transport    string          `json:"transport"`
+	Type         string          `json:"type"`             // Namespace and name of the subscription, e.g. eth_logs
+	Filter       json.RawMessage `json:"filter,omitempty"` // Arguments the subscription was created with
+	Since        time.Time       `json:"since"`
+	Sent         uint64          `json:"sent"`         // Notifications sent
+	Backlog      int64           `json:"backlog"`      // Notifications waiting to be sent
+	BacklogBytes int64           `json:"backlogBytes"` // Size of the notifications waiting to be sent
+}
+
+// trackedSub is a subscription tracked by a registry.
+type trackedSub struct {
+	h     *handler
+	n     *Notifier
+	since time.Time
+}
+
+// SubscriptionRegistry tracks the subscriptions served to the connections of one
+// or more servers, limiting their number per connection and in total. A nil
+// registry takes all subscriptions without tracking them.
+type SubscriptionRegistry struct {
+	lock    sync.Mutex
+	perConn int // Maximum subscriptions of a single connection (0 = unlimited)
+	total   int // Maximum subscriptions of all connections together (0 = unlimited)
+	count   int // Subscriptions reserved or active
+	conns   map[*handler]int
+	subs    map[ID]*trackedSub
+}
+
+// NewSubscriptionRegistry creates a registry with the given limits of
+// subscriptions per connection and in total (0 = unlimited).
+func NewSubscriptionRegistry(perConn, total int) *SubscriptionRegistry {
+	return &SubscriptionRegistry{
+		perConn: perConn,
+		total:   total,
+		conns:   make(map[*handler]int),
+		subs:    make(map[ID]*trackedSub),
+	}
+}
+
+// reserve accounts for a new subscription of a connection, failing if it would
+// exceed the limits. The reservation is either turned into a tracked
+// subscription by add, or given back by release.
+func (r *SubscriptionRegistry) reserve(h *handler) error {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.perConn > 0 && r.conns[h] >= r.perConn {
+		return errConnSubscriptionLimit
+	}
+	if r.total > 0 && r.count >= r.total {
+		return errTotalSubscriptionLimit
+	}
+	r.conns[h]++
+	r.count++
+	return nil
+}
+
+// release gives back a reservation not turned into a subscription.
+func (r *SubscriptionRegistry) release(h *handler) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.releaseLocked(h)
+}
+
+func (r *SubscriptionRegistry) releaseLocked(h *handler) {
+	if r.conns[h]--; r.conns[h] <= 0 {
+		delete(r.conns, h)
+	}
+	r.count--
+}
+
+// add starts tracking a subscription created on a reservation.
+func (r *SubscriptionRegistry) add(h *handler, n *Notifier, sub *Subscription) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.subs[sub.ID] = &trackedSub{h: h, n: n, since: time.Now()}
+}
+
+// remove stops tracking a subscription, giving back its reservation.
+func (r *SubscriptionRegistry) remove(id ID) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if sub := r.subs[id]; sub != nil {
+		delete(r.subs, id)
+		r.releaseLocked(sub.h)
+	}
+}
+
+// Subscriptions returns the tracked subscriptions, the ones with the largest
+// backlog first.
+func (r *SubscriptionRegistry) Subscriptions() []SubscriptionInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	infos := make([]SubscriptionInfo, 0, len(r.subs))
+	for id, sub := range r.subs {
+		infos = append(infos, SubscriptionInfo{
+			ID:           id,
+			Owner:        sub.h.conn.remoteAddr(),
+			Transport:    sub.h.transport,
+			Type:         sub.n.kind,
+			Filter:       sub.n.filter,
+			Since:        sub.since,
+			Sent:         atomic.LoadUint64(&sub.n.sent),
+			Backlog:      atomic.LoadInt64(&sub.n.backlog),
+			BacklogBytes: atomic.LoadInt64(&sub.n.backlogBytes),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].BacklogBytes != infos[j].BacklogBytes {
+			return infos[i].BacklogBytes > infos[j].BacklogBytes
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Drop ends a tracked subscription as if its connection unsubscribed, reporting
+// whether it existed. The producer of the notifications is told through the
+// error channel of the subscription.
+func (r *SubscriptionRegistry) Drop(id ID) bool {
+	r.lock.Lock()
+	sub := r.subs[id]
+	r.lock.Unlock()
+
+	if sub == nil {
+		return false
+	}
+	return sub.h.dropSubscription(id, errSubscriptionDropped)
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Tests that the subscriptions are limited per connection and in total, listed
+// with their type and arguments, and dropped on request.
+func TestSubscriptionRegistry(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	registry := NewSubscriptionRegistry(2, 3)
+	server.SetSubscriptionRegistry(registry)
+
+	client1, client2 := DialInProc(server), DialInProc(server)
+	defer client1.Close()
+	defer client2.Close()
+
+	subscribe := func(client *Client) (*ClientSubscription, error) {
+		return client.Subscribe(context.Background(), "nftest", make(chan int, 1), "someSubscription", 1, 7)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := subscribe(client1); err != nil {
+			t.Fatalf("subscription %d refused: %v", i, err)
+		}
+	}
+	if _, err := subscribe(client1); err == nil || err.Error() != errConnSubscriptionLimit.Error() {
+		t.Fatalf("connection limit not enforced: %v", err)
+	}
+	sub, err := subscribe(client2)
+	if err != nil {
+		t.Fatalf("subscription of other connection refused: %v", err)
+	}
+	if _, err := subscribe(client2); err == nil || err.Error() != errTotalSubscriptionLimit.Error() {
+		t.Fatalf("total limit not enforced: %v", err)
+	}
+	infos := registry.Subscriptions()
+	if len(infos) != 3 {
+		t.Fatalf("tracked subscriptions mismatch: have %d, want 3", len(infos))
+	}
+	first := infos[0].ID // The IDs are sequential, the first one is of client1
+	for _, info := range infos {
+		if info.Type != "nftest_someSubscription" || string(info.Filter) != "[1,7]" {
+			t.Fatalf("subscription info mismatch: %+v", info)
+		}
+		if info.ID < first {
+			first = info.ID
+		}
+	}
+	// Dropped and unsubscribed subscriptions make room for new ones
+	if !registry.Drop(first) {
+		t.Fatalf("subscription %s not dropped", first)
+	}
+	if registry.Drop(first) {
+		t.Fatalf("subscription %s dropped twice", first)
+	}
+	sub.Unsubscribe()
+	for start := time.Now(); len(registry.Subscriptions()) != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("tracked subscriptions mismatch: have %d, want 1", len(registry.Subscriptions()))
+		}
+	}
+	if _, err := subscribe(client1); err != nil {
+		t.Fatalf("subscription refused after drop: %v", err)
+	}
+	if _, err := subscribe(client2); err != nil {
+		t.Fatalf("subscription refused after unsubscribe: %v", err)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -91,8 +92,14 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 // Notifier is tied to a RPC connection that supports subscriptions.
 // Server callbacks use the notifier to send notifications.
 type Notifier struct {
+	backlog      int64  // Notifications waiting to be sent (accessed atomically)
+	backlogBytes int64  // Size of the notifications waiting to be sent (accessed atomically)
+	sent         uint64 // Notifications sent (accessed atomically)
+
 	h         *handler
 	namespace string
+	kind      string          // Namespace and name of the subscription
+	filter    json.RawMessage // Arguments of the subscription
 
 	mu           sync.Mutex
 	sub          *Subscription
@@ -126,6 +133,9 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 		return err
 	}
 
+	atomic.AddInt64(&n.backlog, 1)
+	atomic.AddInt64(&n.backlogBytes, int64(len(enc)))
+
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -173,6 +183,11 @@ func (n *Notifier) activate() error {
 }
 
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
+	defer func() {
+		atomic.AddInt64(&n.backlog, -1)
+		atomic.AddInt64(&n.backlogBytes, -int64(len(data)))
+		atomic.AddUint64(&n.sent, 1)
+	}()
 	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
 	ctx := context.Background()
 	return n.h.conn.writeJSON(ctx, &jsonrpcMessage{
@@ -0,0 +1,95 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package apitypes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// typedDataV4 is the reference example of eth_signTypedData_v4, featuring arrays
+// of structs and arrays of primitives.
+const typedDataV4 = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallets", "type": "address[]"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person[]"},
+			{"name": "contents", "type": "string"}
+		],
+		"Group": [
+			{"name": "name", "type": "string"},
+			{"name": "members", "type": "Person[]"}
+		]
+	},
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"primaryType": "Mail",
+	"message": {
+		"from": {
+			"name": "Cow",
+			"wallets": ["0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", "0xDeaDbeefdEAdbeefdEadbEEFdeadbeEFdEaDbeeF"]
+		},
+		"to": [{
+			"name": "Bob",
+			"wallets": ["0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB", "0xB0BdaBea57B0BDABeA57b0bdABEA57b0BDabEa57", "0xB0B0b0b0b0b0B000000000000000000000000000"]
+		}],
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestTypedDataV4(t *testing.T) {
+	var typedData TypedData
+	if err := json.Unmarshal([]byte(typedDataV4), &typedData); err != nil {
+		t.Fatalf("failed to unmarshal typed data: %v", err)
+	}
+	if have, want := string(typedData.EncodeType("Mail")), "Mail(Person from,Person[] to,string contents)Person(string name,address[] wallets)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	hash, _, err := TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+	if have, want := hexutil.Encode(hash), "0xa85c2e2b118698e88db68a8105b794a8cc7cec074e89ef991cb4f5f533819cc2"; have != want {
+		t.Errorf("hash mismatch: have %s, want %s", have, want)
+	}
+	key, _ := crypto.ToECDSA(crypto.Keccak256([]byte("cow")))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	sig[64] += 27
+	if have, want := hexutil.Encode(sig), "0x65cbd956f2fae28a601bebc9b906cea0191744bd4c4247bcd27cd08f8eb6b71c78efdf7a31dc9abee78f492292721f362d296cf86b4538e07b51303b67f749061b"; have != want {
+		t.Errorf("signature mismatch: have %s, want %s", have, want)
+	}
+}
@@ -86,6 +86,38 @@ var selectorRegexp = regexp.MustCompile(`^([^\)]+)\(([A-Za-z0-9,\[\]]*)\)`)
 // parseSelector converts a method selector into an ABI JSON spec. The returned
 // data is a valid JSON string which can be consumed by the standard abi package.
 func parseSelector(unescapedSelector string) ([]byte, error) {
+	return parseDeclaration(unescapedSelector, "function")
+}
+
+// signature is a function or event signature in its canonical form.
+type signature struct {
+	Sig string // Canonical signature, e.g. transfer(address,uint256)
+	ID  []byte // Function selector, or the hash of the event signature
+}
+
+// parseSignature validates a function or event signature of the given kind,
+// returning it in its canonical form.
+func parseSignature(unescapedSelector string, kind string) (*signature, error) {
+	abidata, err := parseDeclaration(unescapedSelector, kind)
+	if err != nil {
+		return nil, err
+	}
+	abispec, err := abi.JSON(bytes.NewReader(abidata))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature %q: %v", unescapedSelector, err)
+	}
+	for _, method := range abispec.Methods {
+		return &signature{Sig: method.Sig, ID: method.ID}, nil
+	}
+	for _, event := range abispec.Events {
+		return &signature{Sig: event.Sig, ID: event.ID.Bytes()}, nil
+	}
+	return nil, fmt.Errorf("invalid signature %q", unescapedSelector)
+}
+
+// parseDeclaration converts a function or event declaration of the given kind
+// into an ABI JSON spec.
+func parseDeclaration(unescapedSelector string, kind string) ([]byte, error) {
 	// Define a tiny fake ABI struct for JSON marshalling
 	type fakeArg struct {
 		Type string `json:"type"`
@@ -110,7 +142,7 @@ func parseSelector(unescapedSelector string) ([]byte, error) {
 			arguments = append(arguments, fakeArg{arg})
 		}
 	}
-	return json.Marshal([]fakeABI{{name, "function", arguments}})
+	return json.Marshal([]fakeABI{{name, kind, arguments}})
 }
 
 // parseCallData matches the provided call data against the ABI definition and
@@ -22,19 +22,28 @@
 package fourbyte
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Database is a 4byte database with the possibility of maintaining an immutable
 // set (embedded) into the process and a mutable set (loaded and written to file).
+//
+// Besides the 4 byte function selectors, the custom set may also contain event
+// signatures, keyed by their full 32 byte topic.
 type Database struct {
 	embedded   map[string]string
 	custom     map[string]string
 	customPath string
+	lock       sync.RWMutex // Protects the custom set
 }
 
 // newEmpty exists for testing purposes.
@@ -74,8 +83,7 @@ func NewFromFile(path string) (*Database, error) {
 // file) as well as a custom database. The latter will be used to write new
 // values into if they are submitted via the API.
 func NewWithFile(path string) (*Database, error) {
-	db := &Database{make(map[string]string), make(map[string]string), path}
-	db.customPath = path
+	db := &Database{embedded: make(map[string]string), custom: make(map[string]string), customPath: path}
 
 	blob, err := Asset("4byte.json")
 	if err != nil {
@@ -98,6 +106,9 @@ func NewWithFile(path string) (*Database, error) {
 
 // Size returns the number of 4byte entries in the embedded and custom datasets.
 func (db *Database) Size() (int, int) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
 	return len(db.embedded), len(db.custom)
 }
 
@@ -109,9 +120,41 @@ func (db *Database) Selector(id []byte) (string, error) {
 		return "", fmt.Errorf("expected 4-byte id, got %d", len(id))
 	}
 	sig := hex.EncodeToString(id[:4])
+	return db.lookup(sig)
+}
+
+// Decode decodes the given call data with the signature of its 4byte selector,
+// returning the signature along with the decoded arguments. The arguments are
+// verified to re-encode into the exact same call data.
+func (db *Database) Decode(calldata []byte) (string, []interface{}, error) {
+	selector, err := db.Selector(calldata)
+	if err != nil {
+		return "", nil, err
+	}
+	decoded, err := verifySelector(selector, calldata)
+	if err != nil {
+		return "", nil, err
+	}
+	args := make([]interface{}, len(decoded.inputs))
+	for i, input := range decoded.inputs {
+		args[i] = input.value
+	}
+	return decoded.signature, args, nil
+}
+
+// Event checks the given topic against the known event signatures.
+func (db *Database) Event(topic common.Hash) (string, error) {
+	return db.lookup(hex.EncodeToString(topic[:]))
+}
+
+// lookup retrieves the signature of the given hex encoded selector or topic.
+func (db *Database) lookup(sig string) (string, error) {
 	if selector, exists := db.embedded[sig]; exists {
 		return selector, nil
 	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
 	if selector, exists := db.custom[sig]; exists {
 		return selector, nil
 	}
@@ -132,7 +175,94 @@ func (db *Database) AddSelector(selector string, data []byte) error {
 		return nil
 	}
 	// Inject the custom selector into the database and persist if needed
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
 	db.custom[hex.EncodeToString(data[:4])] = selector
+	return db.save()
+}
+
+// AddFunction validates a function signature and inserts it into the database,
+// returning its 4 byte selector.
+func (db *Database) AddFunction(signature string) ([]byte, error) {
+	method, err := parseSignature(signature, "function")
+	if err != nil {
+		return nil, err
+	}
+	id := common.CopyBytes(method.ID)
+	return id, db.AddSelector(method.Sig, id)
+}
+
+// AddEvent validates an event signature and inserts it into the database,
+// returning its topic. If custom database saving is enabled, the new dataset is
+// also persisted to disk.
+func (db *Database) AddEvent(signature string) (common.Hash, error) {
+	event, err := parseSignature(signature, "event")
+	if err != nil {
+		return common.Hash{}, err
+	}
+	topic := crypto.Keccak256Hash([]byte(event.Sig))
+	if _, err := db.Event(topic); err == nil {
+		return topic, nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.custom[hex.EncodeToString(topic[:])] = event.Sig
+	return topic, db.save()
+}
+
+// Import merges a dataset in the format of the embedded one, e.g. an updated
+// export of the 4byte directory, into the custom set, returning the number of
+// entries added. Entries which are malformed, whose signature doesn't hash to
+// their selector or topic, or already known are skipped. If custom database
+// saving is enabled, the new dataset is also persisted to disk.
+func (db *Database) Import(path string) (int, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(blob, &entries); err != nil {
+		return 0, err
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var added int
+	for sig, selector := range entries {
+		id, err := hex.DecodeString(sig)
+		if err != nil || (len(id) != 4 && len(id) != common.HashLength) {
+			continue
+		}
+		kind := "function"
+		if len(id) == common.HashLength {
+			kind = "event"
+		}
+		parsed, err := parseSignature(selector, kind)
+		if err != nil || !bytes.Equal(crypto.Keccak256([]byte(parsed.Sig))[:len(id)], id) {
+			continue
+		}
+		selector = parsed.Sig
+
+		if _, exists := db.embedded[sig]; exists {
+			continue
+		}
+		if _, exists := db.custom[sig]; exists {
+			continue
+		}
+		db.custom[sig] = selector
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, db.save()
+}
+
+// save persists the custom set if custom database saving is enabled. The caller
+// must hold the lock.
+func (db *Database) save() error {
 	if db.customPath == "" {
 		return nil
 	}
@@ -19,11 +19,15 @@ package fourbyte
 import (
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Tests that all the selectors contained in the 4byte database are valid.
@@ -89,3 +93,61 @@ func TestCustomDatabase(t *testing.T) {
 		t.Fatalf("Failed to find a match for persisted abi signature: %v", err)
 	}
 }
+
+// Tests that function and event signatures are validated, imported and used to
+// decode call data.
+func TestCustomSignatures(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signer-4byte-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	db, err := NewWithFile(filepath.Join(tmpdir, "4byte_custom.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.embedded = make(map[string]string)
+
+	// Function signatures are validated before being added
+	if _, err := db.AddFunction("transfer(address,uint256)"); err != nil {
+		t.Fatalf("Failed to add function: %v", err)
+	}
+	if _, err := db.AddFunction("transfer(address"); err == nil {
+		t.Fatalf("Invalid function accepted")
+	}
+	calldata := append(crypto.Keccak256([]byte("transfer(address,uint256)"))[:4], make([]byte, 64)...)
+	calldata[len(calldata)-1] = 0x2a
+	sig, args, err := db.Decode(calldata)
+	if err != nil {
+		t.Fatalf("Failed to decode call data: %v", err)
+	}
+	if sig != "transfer(address,uint256)" || len(args) != 2 || args[1].(*big.Int).Int64() != 42 {
+		t.Fatalf("Decoded call mismatch: %s %v", sig, args)
+	}
+	// Events are looked up by their full topic
+	topic, err := db.AddEvent("Transfer(address,address,uint256)")
+	if err != nil {
+		t.Fatalf("Failed to add event: %v", err)
+	}
+	if topic != crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")) {
+		t.Fatalf("Event topic mismatch: %x", topic)
+	}
+	if sig, err := db.Event(topic); err != nil || sig != "Transfer(address,address,uint256)" {
+		t.Fatalf("Event lookup mismatch: %q, %v", sig, err)
+	}
+	// Updated datasets are merged into the custom set, skipping known entries and
+	// the ones whose signature doesn't hash to their selector
+	update := filepath.Join(tmpdir, "update.json")
+	ioutil.WriteFile(update, []byte(`{"a9059cbb": "transfer(address,uint256)", "095ea7b3": "approve(address,uint256)", "zz": "bogus()", "deadbeef": "approve(address,uint256)", "70a08231": "balanceOf"}`), 0600)
+	if added, err := db.Import(update); err != nil || added != 1 {
+		t.Fatalf("Import mismatch: have %d added, err %v, want 1", added, err)
+	}
+	reloaded, err := NewFromFile(filepath.Join(tmpdir, "4byte_custom.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, err := reloaded.Selector(common.Hex2Bytes("095ea7b3")); err != nil || sig != "approve(address,uint256)" {
+		t.Fatalf("Imported selector not persisted: %q, %v", sig, err)
+	}
+}
@@ -97,9 +97,9 @@ type btHeaderMarshaling struct {
 }
 
 func (t *BlockTest) Run(snapshotter bool) error {
-	config, ok := Forks[t.json.Network]
-	if !ok {
-		return UnsupportedForkError{t.json.Network}
+	config, err := lookupFork(t.json.Network)
+	if err != nil {
+		return err
 	}
 
 	// import pre accounts & construct test genesis block & state root
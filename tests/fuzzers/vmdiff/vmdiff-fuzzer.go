@@ -0,0 +1,69 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package vmdiff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+)
+
+// evmcConfig is the external EVM the built-in interpreter is compared against,
+// taken from the environment. If not set, the interpreter is compared against
+// itself with tracing enabled, which must not alter the execution.
+var evmcConfig = os.Getenv("FUZZ_EVMC_EVM")
+
+func init() {
+	if evmcConfig != "" {
+		vm.InitEVMCEVM(evmcConfig)
+	}
+}
+
+var address = common.BytesToAddress([]byte("contract"))
+
+// Fuzz executes the input as code in two differently configured EVMs, panicking
+// if the executions diverge.
+func Fuzz(input []byte) int {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(address, input)
+
+	a := &runtime.Config{GasLimit: 1000000, State: statedb}
+	b := &runtime.Config{GasLimit: 1000000}
+	if evmcConfig != "" {
+		b.EVMConfig.EVMInterpreter = evmcConfig
+	} else {
+		b.EVMConfig.Debug = true
+		b.EVMConfig.Tracer = vm.NewStructLogger(&vm.LogConfig{DisableMemory: true, DisableStack: true})
+	}
+	exec := func(cfg *runtime.Config) ([]byte, uint64, error) {
+		return runtime.Call(address, nil, cfg)
+	}
+	res, _, div := runtime.Compare(exec, a, b)
+	if div != nil {
+		panic(fmt.Sprintf("code %x: %v", input, div))
+	}
+	// Favour inputs which run successfully
+	if res.Err != nil {
+		return 0
+	}
+	return 1
+}
@@ -282,21 +282,56 @@ var Forks = map[string]ctypes.ChainConfigurator{
 	},
 }
 
+// ClassicForkNames maps the names of the Ethereum Classic hard forks to the test
+// forks defining their rules.
+var ClassicForkNames = map[string]string{
+	"Atlantis": "ETC_Atlantis",
+	"Agharta":  "ETC_Agharta",
+	"Phoenix":  "ETC_Phoenix",
+}
+
+// unsupportedClassicForks lists the Ethereum Classic hard forks whose rules can't
+// be run, along with the protocol changes they're missing.
+var unsupportedClassicForks = map[string]string{
+	"Magneto":  "EIP-2565, EIP-2718, EIP-2929 and EIP-2930",
+	"Mystique": "EIP-2565, EIP-2718, EIP-2929, EIP-2930, EIP-3529 and EIP-3541",
+	"Spiral":   "EIP-2565, EIP-2718, EIP-2929, EIP-2930, EIP-3529, EIP-3541, EIP-3651, EIP-3855, EIP-3860 and EIP-6049",
+}
+
+// lookupFork retrieves the chain configuration of a fork, resolving the names of
+// the Ethereum Classic hard forks.
+func lookupFork(name string) (ctypes.ChainConfigurator, error) {
+	if alias, ok := ClassicForkNames[name]; ok {
+		name = alias
+	}
+	if config, ok := Forks[name]; ok {
+		return config, nil
+	}
+	return nil, UnsupportedForkError{Name: name, Missing: unsupportedClassicForks[name]}
+}
+
 // Returns the set of defined fork names
 func AvailableForks() []string {
 	var availableForks []string
 	for k := range Forks {
 		availableForks = append(availableForks, k)
 	}
+	for k := range ClassicForkNames {
+		availableForks = append(availableForks, k)
+	}
 	sort.Strings(availableForks)
 	return availableForks
 }
 
 // UnsupportedForkError is returned when a test requests a fork that isn't implemented.
 type UnsupportedForkError struct {
-	Name string
+	Name    string
+	Missing string // Protocol changes of a known fork that aren't implemented
 }
 
 func (e UnsupportedForkError) Error() string {
+	if e.Missing != "" {
+		return fmt.Sprintf("unsupported fork %q: %s not implemented", e.Name, e.Missing)
+	}
 	return fmt.Sprintf("unsupported fork %q", e.Name)
 }
@@ -322,3 +322,26 @@ func TestMatcherWhitelist(t *testing.T) {
 		}
 	})
 }
+
+func TestLookupClassicFork(t *testing.T) {
+	t.Parallel()
+	for name, alias := range ClassicForkNames {
+		config, err := lookupFork(name)
+		if err != nil {
+			t.Fatalf("fork %s: lookup failed: %v", name, err)
+		}
+		if config != Forks[alias] {
+			t.Fatalf("fork %s: config mismatch, want %s", name, alias)
+		}
+	}
+	_, err := lookupFork("Magneto")
+	if ferr, ok := err.(UnsupportedForkError); !ok || ferr.Missing == "" {
+		t.Fatalf("unsupported fork error mismatch: %v", err)
+	}
+	// State tests report the missing features of the fork too
+	test := &StateTest{json: stJSON{Post: map[string][]stPostState{"Magneto": {{}}}}}
+	_, _, _, err = test.RunNoVerify(StateSubtest{Fork: "Magneto"}, vm.Config{}, false)
+	if ferr, ok := err.(UnsupportedForkError); !ok || ferr.Missing == "" {
+		t.Fatalf("state test fork error mismatch: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Stats are the statistics of the nodes making up a trie.
+type Stats struct {
+	FullNodes   uint64   // Number of branch nodes
+	ShortNodes  uint64   // Number of extension and leaf nodes
+	Values      uint64   // Number of values stored in the trie
+	HashedNodes uint64   // Number of nodes stored on their own, the others being embedded in their parent
+	Size        uint64   // Total size of the nodes stored on their own
+	Depths      []uint64 // Number of values by the number of nodes on their path
+}
+
+// Stats iterates over all the nodes of the trie, counting them by type and the
+// values by depth. The iteration can be aborted through the context.
+//
+// The sizes of the stored nodes are those of their encodings, computed from the
+// nodes resolved by the iteration rather than reading them again.
+func (t *Trie) Stats(ctx context.Context) (*Stats, error) {
+	var (
+		stats  = new(Stats)
+		it     = t.NodeIterator(nil).(*nodeIterator)
+		hasher = newHasher(false)
+	)
+	defer returnHasherToPool(hasher)
+
+	for i := 0; it.Next(true); i++ {
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		state := it.stack[len(it.stack)-1]
+		switch state.node.(type) {
+		case *fullNode:
+			stats.FullNodes++
+		case *shortNode:
+			stats.ShortNodes++
+		case valueNode:
+			depth := len(it.stack) - 1
+			for len(stats.Depths) <= depth {
+				stats.Depths = append(stats.Depths, 0)
+			}
+			stats.Depths[depth]++
+			stats.Values++
+			continue
+		}
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			stats.HashedNodes++
+			collapsed, _ := hasher.proofHash(state.node)
+			if blob, err := rlp.EncodeToBytes(collapsed); err == nil {
+				stats.Size += uint64(len(blob))
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
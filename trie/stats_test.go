@@ -0,0 +1,90 @@
+// Copyright 2020 The core-geth Authors
+// This file is part of the core-geth library.
+//
+// The core-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The core-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the core-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// countingStore counts the reads of a key-value store.
+type countingStore struct {
+	ethdb.KeyValueStore
+	reads int
+}
+
+func (s *countingStore) Get(key []byte) ([]byte, error) {
+	s.reads++
+	return s.KeyValueStore.Get(key)
+}
+
+// Tests that the statistics of a trie account for all its stored nodes and values.
+func TestTrieStats(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(emptyRoot, triedb)
+	for i := 0; i < 1000; i++ {
+		trie.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+	triedb.Commit(root, false, nil)
+
+	counter := &countingStore{KeyValueStore: diskdb}
+	trie, _ = New(root, NewDatabase(counter))
+	stats, err := trie.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("failed to collect stats: %v", err)
+	}
+	if stats.Values != 1000 {
+		t.Fatalf("value count mismatch: have %d, want 1000", stats.Values)
+	}
+	var values uint64
+	for _, count := range stats.Depths {
+		values += count
+	}
+	if values != stats.Values {
+		t.Fatalf("depth distribution mismatch: have %d values, want %d", values, stats.Values)
+	}
+	var nodes, size uint64
+	it := diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		nodes++
+		size += uint64(len(it.Value()))
+	}
+	it.Release()
+
+	if stats.HashedNodes != nodes || stats.Size != size {
+		t.Fatalf("stored nodes mismatch: have %d nodes of %d bytes, want %d of %d", stats.HashedNodes, stats.Size, nodes, size)
+	}
+	if uint64(counter.reads) != nodes {
+		t.Fatalf("node reads mismatch: have %d, want one per node (%d)", counter.reads, nodes)
+	}
+	if stats.FullNodes == 0 || stats.ShortNodes == 0 || stats.FullNodes+stats.ShortNodes < stats.HashedNodes {
+		t.Fatalf("node types mismatch: %d full, %d short, %d stored", stats.FullNodes, stats.ShortNodes, stats.HashedNodes)
+	}
+	// Aborted iterations return the context error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := trie.Stats(ctx); err != context.Canceled {
+		t.Fatalf("aborted stats error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}